@@ -33,6 +33,9 @@ type controllerInformer interface {
 	ClusterStatus(team, namespace, cluster string) (*spec.ClusterStatus, error)
 	ClusterLogs(team, namespace, cluster string) ([]*spec.LogEntry, error)
 	ClusterHistory(team, namespace, cluster string) ([]*spec.Diff, error)
+	SyncCluster(team, namespace, cluster string) error
+	RequestBackup(team, namespace, cluster, kind string) error
+	RequestSwitchover(team, namespace, cluster, candidate string) error
 	ClusterDatabasesMap() map[string][]string
 	WorkerLogs(workerID uint32) ([]*spec.LogEntry, error)
 	ListQueue(workerID uint32) (*spec.QueueDump, error)
@@ -51,6 +54,9 @@ var (
 	clusterStatusURL     = regexp.MustCompile(`^/clusters/(?P<team>[a-zA-Z][a-zA-Z0-9]*)/(?P<namespace>[a-z0-9]([-a-z0-9]*[a-z0-9])?)/(?P<cluster>[a-zA-Z][a-zA-Z0-9-]*)/?$`)
 	clusterLogsURL       = regexp.MustCompile(`^/clusters/(?P<team>[a-zA-Z][a-zA-Z0-9]*)/(?P<namespace>[a-z0-9]([-a-z0-9]*[a-z0-9])?)/(?P<cluster>[a-zA-Z][a-zA-Z0-9-]*)/logs/?$`)
 	clusterHistoryURL    = regexp.MustCompile(`^/clusters/(?P<team>[a-zA-Z][a-zA-Z0-9]*)/(?P<namespace>[a-z0-9]([-a-z0-9]*[a-z0-9])?)/(?P<cluster>[a-zA-Z][a-zA-Z0-9-]*)/history/?$`)
+	clusterSyncURL       = regexp.MustCompile(`^/clusters/(?P<team>[a-zA-Z][a-zA-Z0-9]*)/(?P<namespace>[a-z0-9]([-a-z0-9]*[a-z0-9])?)/(?P<cluster>[a-zA-Z][a-zA-Z0-9-]*)/sync/?$`)
+	clusterBackupURL     = regexp.MustCompile(`^/clusters/(?P<team>[a-zA-Z][a-zA-Z0-9]*)/(?P<namespace>[a-z0-9]([-a-z0-9]*[a-z0-9])?)/(?P<cluster>[a-zA-Z][a-zA-Z0-9-]*)/backup/(?P<kind>base|logical)/?$`)
+	clusterSwitchoverURL = regexp.MustCompile(`^/clusters/(?P<team>[a-zA-Z][a-zA-Z0-9]*)/(?P<namespace>[a-z0-9]([-a-z0-9]*[a-z0-9])?)/(?P<cluster>[a-zA-Z][a-zA-Z0-9-]*)/switchover(/(?P<candidate>[a-z0-9]([-a-z0-9]*[a-z0-9])?))?/?$`)
 	teamURL              = regexp.MustCompile(`^/clusters/(?P<team>[a-zA-Z][a-zA-Z0-9]*)/?$`)
 	workerLogsURL        = regexp.MustCompile(`^/workers/(?P<id>\d+)/logs/?$`)
 	workerEventsQueueURL = regexp.MustCompile(`^/workers/(?P<id>\d+)/queue/?$`)
@@ -171,6 +177,30 @@ func (s *Server) clusters(w http.ResponseWriter, req *http.Request) {
 	} else if matches := util.FindNamedStringSubmatch(clusterHistoryURL, req.URL.Path); matches != nil {
 		namespace, _ := matches["namespace"]
 		resp, err = s.controller.ClusterHistory(matches["team"], namespace, matches["cluster"])
+	} else if matches := util.FindNamedStringSubmatch(clusterSyncURL, req.URL.Path); matches != nil {
+		if req.Method != http.MethodPost {
+			resp, err = nil, fmt.Errorf("sync must be requested with POST")
+		} else if err = s.controller.SyncCluster(matches["team"], matches["namespace"], matches["cluster"]); err == nil {
+			resp = map[string]string{"status": "sync queued"}
+		}
+	} else if matches := util.FindNamedStringSubmatch(clusterBackupURL, req.URL.Path); matches != nil {
+		if req.Method != http.MethodPost {
+			resp, err = nil, fmt.Errorf("backup must be requested with POST")
+		} else if !s.controller.GetOperatorConfig().EnableAPITriggers {
+			resp, err = nil, fmt.Errorf("backups are requested with the annotation of the manifest, the API is disabled")
+		} else if err = s.controller.RequestBackup(matches["team"], matches["namespace"], matches["cluster"],
+			matches["kind"]); err == nil {
+			resp = map[string]string{"status": "backup requested"}
+		}
+	} else if matches := util.FindNamedStringSubmatch(clusterSwitchoverURL, req.URL.Path); matches != nil {
+		if req.Method != http.MethodPost {
+			resp, err = nil, fmt.Errorf("switchover must be requested with POST")
+		} else if !s.controller.GetOperatorConfig().EnableAPITriggers {
+			resp, err = nil, fmt.Errorf("switchovers are requested with the annotations of the manifest, the API is disabled")
+		} else if err = s.controller.RequestSwitchover(matches["team"], matches["namespace"], matches["cluster"],
+			matches["candidate"]); err == nil {
+			resp = map[string]string{"status": "switchover requested"}
+		}
 	} else if req.URL.Path == clustersURL {
 		clusterNamesPerTeam := make(map[string][]string)
 		for team, clusters := range s.controller.TeamClusterList() {
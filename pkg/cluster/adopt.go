@@ -0,0 +1,179 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/pkg/apis/apps/v1beta1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+// adoptionRequested checks if the manifest asks to take over the objects of an existing deployment instead of
+// creating new ones.
+func (c *Cluster) adoptionRequested() bool {
+	return c.ObjectMeta.Annotations[constants.AdoptExistingAnnotation] == "true"
+}
+
+// adoptExistingResources takes over the statefulset of a Postgres deployment created without the operator, together
+// with its pods, persistent volume claims, services, endpoints and secrets, by giving them the labels of the cluster.
+// The sync afterwards reconciles them with the manifest, replacing the statefulset if its selector differs.
+func (c *Cluster) adoptExistingResources() error {
+	c.setProcessName("adopting existing resources")
+
+	statefulSet, err := c.KubeClient.StatefulSets(c.Namespace).Get(c.statefulSetName(), metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("could not get statefulset %q to adopt: %v", c.statefulSetName(), err)
+	}
+	if err := c.checkAdoptableStatefulSet(statefulSet); err != nil {
+		return err
+	}
+	patch, err := c.adoptionPatch()
+	if err != nil {
+		return err
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(statefulSet.Spec.Selector)
+	if err != nil {
+		return fmt.Errorf("could not parse selector of the statefulset: %v", err)
+	}
+	pods, err := c.KubeClient.Pods(c.Namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return fmt.Errorf("could not list pods of the statefulset: %v", err)
+	}
+	for _, pod := range pods.Items {
+		if err := c.checkAdoptable("pod", &pod.ObjectMeta); err != nil {
+			return err
+		}
+		if _, err := c.KubeClient.Pods(c.Namespace).Patch(pod.Name, types.MergePatchType, patch); err != nil {
+			return fmt.Errorf("could not label pod %q: %v", pod.Name, err)
+		}
+	}
+
+	for _, template := range statefulSet.Spec.VolumeClaimTemplates {
+		for i := int32(0); i < *statefulSet.Spec.Replicas; i++ {
+			claimName := fmt.Sprintf("%s-%s-%d", template.Name, statefulSet.Name, i)
+			if err := c.adoptObject("persistent volume claim", claimName,
+				func(name string, options metav1.GetOptions) (metav1.Object, error) {
+					return c.KubeClient.PersistentVolumeClaims(c.Namespace).Get(name, options)
+				},
+				func(name string) error {
+					_, err := c.KubeClient.PersistentVolumeClaims(c.Namespace).Patch(name, types.MergePatchType, patch)
+					return err
+				}); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, role := range []PostgresRole{Master, Replica} {
+		if err := c.adoptObject("service", c.serviceName(role),
+			func(name string, options metav1.GetOptions) (metav1.Object, error) {
+				return c.KubeClient.Services(c.Namespace).Get(name, options)
+			},
+			func(name string) error {
+				_, err := c.KubeClient.Services(c.Namespace).Patch(name, types.MergePatchType, patch)
+				return err
+			}); err != nil {
+			return err
+		}
+		if err := c.adoptObject("endpoint", c.endpointName(role),
+			func(name string, options metav1.GetOptions) (metav1.Object, error) {
+				return c.KubeClient.Endpoints(c.Namespace).Get(name, options)
+			},
+			func(name string) error {
+				_, err := c.KubeClient.Endpoints(c.Namespace).Patch(name, types.MergePatchType, patch)
+				return err
+			}); err != nil {
+			return err
+		}
+	}
+
+	if err := c.initUsers(); err != nil {
+		return fmt.Errorf("could not init users: %v", err)
+	}
+	for _, secret := range c.generateUserSecrets() {
+		if err := c.adoptObject("secret", secret.Name,
+			func(name string, options metav1.GetOptions) (metav1.Object, error) {
+				return c.KubeClient.Secrets(c.Namespace).Get(name, options)
+			},
+			func(name string) error {
+				_, err := c.KubeClient.Secrets(c.Namespace).Patch(name, types.MergePatchType, patch)
+				return err
+			}); err != nil {
+			return err
+		}
+	}
+
+	if _, err := c.KubeClient.StatefulSets(c.Namespace).Patch(statefulSet.Name, types.MergePatchType, patch); err != nil {
+		return fmt.Errorf("could not label statefulset %q: %v", statefulSet.Name, err)
+	}
+	c.logger.Infof("statefulset %q and its objects have been adopted", statefulSet.Name)
+
+	return nil
+}
+
+// adoptObject labels the object with the given name, unless it doesn't exist.
+func (c *Cluster) adoptObject(kind, name string,
+	get func(string, metav1.GetOptions) (metav1.Object, error), label func(string) error) error {
+	object, err := get(name, metav1.GetOptions{})
+	if k8sutil.ResourceNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not get %s %q: %v", kind, name, err)
+	}
+	if err := c.checkAdoptable(kind, object); err != nil {
+		return err
+	}
+	if err := label(name); err != nil {
+		return fmt.Errorf("could not label %s %q: %v", kind, name, err)
+	}
+	c.logger.Debugf("%s %q has been adopted", kind, name)
+
+	return nil
+}
+
+// checkAdoptable refuses to take over objects of another cluster.
+func (c *Cluster) checkAdoptable(kind string, object metav1.Object) error {
+	if clusterName, ok := object.GetLabels()[c.OpConfig.ClusterNameLabel]; ok && clusterName != c.Name {
+		return fmt.Errorf("%s %q belongs to the cluster %q", kind, object.GetName(), clusterName)
+	}
+	return nil
+}
+
+// checkAdoptableStatefulSet makes sure the operator would run the same Patroni cluster on the same data volumes.
+func (c *Cluster) checkAdoptableStatefulSet(statefulSet *v1beta1.StatefulSet) error {
+	if err := c.checkAdoptable("statefulset", statefulSet); err != nil {
+		return err
+	}
+	hasDataVolume := false
+	for _, template := range statefulSet.Spec.VolumeClaimTemplates {
+		if template.Name == constants.DataVolumeName {
+			hasDataVolume = true
+		}
+	}
+	if !hasDataVolume && !c.Spec.Volume.Ephemeral {
+		return fmt.Errorf("statefulset has no %q volume claim template, its data would not be reused", constants.DataVolumeName)
+	}
+	for _, container := range statefulSet.Spec.Template.Spec.Containers {
+		for _, env := range container.Env {
+			if env.Name == "SCOPE" && env.Value != c.Name {
+				return fmt.Errorf("statefulset runs the Patroni cluster %q instead of %q", env.Value, c.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// adoptionPatch returns the merge patch giving an object the labels of the cluster.
+func (c *Cluster) adoptionPatch() ([]byte, error) {
+	patch, err := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"labels": c.labelsSet()}})
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal labels of the cluster: %v", err)
+	}
+	return patch, nil
+}
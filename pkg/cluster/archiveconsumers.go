@@ -0,0 +1,63 @@
+package cluster
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+)
+
+// archivePrefix returns the path of the WAL archive of the cluster itself, as the clones and the standbys refer to it.
+func (c *Cluster) archivePrefix() string {
+	return strings.TrimSuffix(c.cloneArchivePrefix(&spec.CloneDescription{ClusterName: c.Name, Uid: string(c.UID)}), "/")
+}
+
+// archiveConsumers lists the other clusters of the watched namespace still reading the WAL archive of the cluster:
+// the standbys replaying it and the clones restored from it that are not running yet or younger than the
+// clone_archive_grace.
+func (c *Cluster) archiveConsumers() ([]string, error) {
+	clusters, err := c.listClusters()
+	if err != nil {
+		return nil, err
+	}
+
+	return c.findArchiveConsumers(clusters, time.Now()), nil
+}
+
+func (c *Cluster) findArchiveConsumers(clusters []spec.Postgresql, now time.Time) []string {
+	prefix := c.archivePrefix()
+	readsArchive := func(path string) bool {
+		return path != "" && strings.TrimSuffix(path, "/") == prefix
+	}
+
+	consumers := make([]string, 0)
+	for i := range clusters {
+		pg := &clusters[i]
+		if pg.Namespace == c.Namespace && pg.Name == c.Name {
+			continue
+		}
+		name := pg.Namespace + "/" + pg.Name
+		if standby := pg.Spec.StandbyCluster; standby != nil && (readsArchive(standby.S3WalPath) || readsArchive(standby.GSWalPath)) {
+			consumers = append(consumers, name+" (standby)")
+			continue
+		}
+
+		clone := pg.Spec.Clone
+		if pg.CloneSource != nil {
+			clone = *pg.CloneSource
+		}
+		if clone.ClusterName == "" || cloneMethod(&clone) != "archive" {
+			continue
+		}
+		if pg.Status == spec.ClusterStatusRunning && now.Sub(pg.CreationTimestamp.Time) > c.OpConfig.CloneArchiveGrace {
+			continue
+		}
+		if readsArchive(c.cloneArchivePrefix(&clone)) {
+			consumers = append(consumers, name+" (clone)")
+		}
+	}
+	sort.Strings(consumers)
+
+	return consumers
+}
@@ -0,0 +1,50 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/config"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+func TestFindArchiveConsumers(t *testing.T) {
+	now := time.Date(2017, 12, 10, 12, 0, 0, 0, time.UTC)
+	c := New(Config{OpConfig: config.Config{WALES3Bucket: "backups", CloneArchiveGrace: 24 * time.Hour}},
+		k8sutil.KubernetesClient{}, spec.Postgresql{ObjectMeta: metav1.ObjectMeta{Name: "acid-test", Namespace: "default"}}, logger)
+
+	cluster := func(name string, status spec.PostgresStatus, age time.Duration, pgSpec spec.PostgresSpec) spec.Postgresql {
+		return spec.Postgresql{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", CreationTimestamp: metav1.Time{Time: now.Add(-age)}},
+			Spec:       pgSpec,
+			Status:     status,
+		}
+	}
+	archive := "s3://backups/spilo/acid-test/wal"
+	clusters := []spec.Postgresql{
+		cluster("acid-test", spec.ClusterStatusRunning, 0, spec.PostgresSpec{}),
+		cluster("acid-standby", spec.ClusterStatusRunning, 30*24*time.Hour,
+			spec.PostgresSpec{StandbyCluster: &spec.StandbyDescription{S3WalPath: archive + "/"}}),
+		cluster("acid-streaming", spec.ClusterStatusRunning, time.Hour,
+			spec.PostgresSpec{StandbyCluster: &spec.StandbyDescription{StandbyHost: "acid-test"}}),
+		cluster("acid-new-clone", spec.ClusterStatusRunning, time.Hour,
+			spec.PostgresSpec{Clone: spec.CloneDescription{ClusterName: "acid-test", EndTimestamp: "2017-12-10T01:00:00Z"}}),
+		cluster("acid-creating-clone", spec.ClusterStatusCreating, 48*time.Hour,
+			spec.PostgresSpec{Clone: spec.CloneDescription{ClusterName: "acid-test", S3WalPath: archive}}),
+		cluster("acid-old-clone", spec.ClusterStatusRunning, 48*time.Hour,
+			spec.PostgresSpec{Clone: spec.CloneDescription{ClusterName: "acid-test", EndTimestamp: "2017-12-01T01:00:00Z"}}),
+		cluster("acid-basebackup-clone", spec.ClusterStatusCreating, time.Hour,
+			spec.PostgresSpec{Clone: spec.CloneDescription{ClusterName: "acid-test"}}),
+		cluster("acid-other-clone", spec.ClusterStatusCreating, time.Hour,
+			spec.PostgresSpec{Clone: spec.CloneDescription{ClusterName: "acid-other", EndTimestamp: "2017-12-10T01:00:00Z"}}),
+	}
+
+	expected := []string{"default/acid-creating-clone (clone)", "default/acid-new-clone (clone)", "default/acid-standby (standby)"}
+	if consumers := c.findArchiveConsumers(clusters, now); !reflect.DeepEqual(consumers, expected) {
+		t.Errorf("expected the consumers %v, got: %v", expected, consumers)
+	}
+}
@@ -0,0 +1,114 @@
+package cluster
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+)
+
+// client backends and WAL senders, without the connection of the operator
+const clientConnectionsSQL = `SELECT count(*) FROM pg_stat_activity WHERE pid <> pg_backend_pid() AND usename IS NOT NULL;`
+
+// autoscaledInstances returns the number of instances keeping the client connections per instance below the
+// target, within the range of the manifest.
+func autoscaledInstances(autoscaling *spec.Autoscaling, connections int) int32 {
+	target := int(autoscaling.TargetConnections)
+	instances := int32((connections + target - 1) / target)
+	if instances < autoscaling.MinInstances {
+		instances = autoscaling.MinInstances
+	}
+	if instances > autoscaling.MaxInstances {
+		instances = autoscaling.MaxInstances
+	}
+	return instances
+}
+
+// syncAutoscaling changes the number of instances in the manifest to match the client connections of all pods.
+// The statefulset removes the pods with the highest numbers, so the cluster never shrinks below the pod of the
+// master. At most one change is made per autoscaling_cooldown, giving the new pods time to take over connections.
+func (c *Cluster) syncAutoscaling() error {
+	autoscaling := c.Spec.Autoscaling
+	if autoscaling == nil || c.Spec.Hibernated {
+		return nil
+	}
+	if time.Since(c.lastAutoscaling) < c.OpConfig.AutoscalingCooldown {
+		return nil
+	}
+
+	pods, err := c.listPods()
+	if err != nil {
+		return err
+	}
+	connections := 0
+	for i := range pods {
+		if !podIsReady(&pods[i]) {
+			continue
+		}
+		count, err := c.countClientConnections(&pods[i])
+		if err != nil {
+			return err
+		}
+		connections += count
+	}
+
+	instances := autoscaledInstances(autoscaling, connections)
+	if instances < c.Spec.NumberOfInstances {
+		masterPods, err := c.getRolePods(Master)
+		if err != nil {
+			return fmt.Errorf("could not get master pod: %v", err)
+		}
+		if len(masterPods) == 0 {
+			c.logger.Debugf("no master pod, not scaling the cluster down")
+			return nil
+		}
+		index, err := getPodIndex(masterPods[0].Name)
+		if err != nil {
+			return fmt.Errorf("could not get pod number: %v", err)
+		}
+		if instances <= index {
+			instances = index + 1
+		}
+	}
+	if instances == c.Spec.NumberOfInstances {
+		return nil
+	}
+
+	c.logger.Infof("scaling the cluster from %d to %d instances for %d client connections",
+		c.Spec.NumberOfInstances, instances, connections)
+	patch := []byte(fmt.Sprintf(`{"spec":{"numberOfInstances":%d}}`, instances))
+	_, err = c.KubeClient.CRDREST.Patch(types.MergePatchType).
+		Namespace(c.Namespace).
+		Resource(constants.CRDResource).
+		Name(c.Name).
+		Body(patch).
+		DoRaw()
+	if err != nil {
+		return fmt.Errorf("could not change the number of instances: %v", err)
+	}
+	c.lastAutoscaling = time.Now()
+	c.recordEvent(v1.EventTypeNormal, constants.EventReasonAutoscaled, "scaled from %d to %d instances for %d client connections",
+		c.Spec.NumberOfInstances, instances, connections)
+
+	return nil
+}
+
+// countClientConnections returns the number of client connections of the pod.
+func (c *Cluster) countClientConnections(pod *v1.Pod) (int, error) {
+	superuser := c.systemUsers[constants.SuperuserKeyName]
+	conn, err := openConnection(pod.Status.PodIP, "postgres", superuser.Name, superuser.Password)
+	if err != nil {
+		return 0, fmt.Errorf("could not connect to the pod %q: %v", pod.Name, err)
+	}
+	defer conn.Close()
+
+	var count int
+	if err := conn.QueryRow(clientConnectionsSQL).Scan(&count); err != nil {
+		return 0, fmt.Errorf("could not count client connections of the pod %q: %v", pod.Name, err)
+	}
+	return count, nil
+}
@@ -0,0 +1,126 @@
+package cluster
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+)
+
+// WAL-G encrypts with libsodium, which takes a key of exactly 32 bytes
+const walgEncryptionKeyLength = 32
+
+// generateBackupEncryptionEnvironment makes WAL-G or pgBackRest encrypt the uploads, server-side with the KMS key
+// in S3 and client-side with the key from the secret. The prefix selects the archive of the cluster or the one it
+// is cloned from.
+func generateBackupEncryptionEnvironment(encryption *spec.BackupEncryption, walTool, prefix string) []v1.EnvVar {
+	result := make([]v1.EnvVar, 0)
+	if encryption == nil {
+		return result
+	}
+	keyFromSecret := func(name string) v1.EnvVar {
+		return v1.EnvVar{
+			Name: prefix + name,
+			ValueFrom: &v1.EnvVarSource{
+				SecretKeyRef: &v1.SecretKeySelector{
+					LocalObjectReference: v1.LocalObjectReference{Name: encryption.KeySecret},
+					Key:                  constants.BackupEncryptionKeyKey,
+				},
+			},
+		}
+	}
+
+	switch walTool {
+	case constants.WALToolWALG:
+		if encryption.KMSKeyID != "" {
+			result = append(result,
+				v1.EnvVar{Name: prefix + "WALG_S3_SSE", Value: "aws:kms"},
+				v1.EnvVar{Name: prefix + "WALG_S3_SSE_KMS_ID", Value: encryption.KMSKeyID})
+		}
+		if encryption.KeySecret != "" {
+			result = append(result, keyFromSecret("WALG_LIBSODIUM_KEY"))
+		}
+	case constants.WALToolPgBackRest:
+		if encryption.KMSKeyID != "" {
+			result = append(result, v1.EnvVar{Name: prefix + "PGBACKREST_REPO1_S3_KMS_KEY_ID", Value: encryption.KMSKeyID})
+		}
+		if encryption.KeySecret != "" {
+			result = append(result, v1.EnvVar{Name: prefix + "PGBACKREST_REPO1_CIPHER_TYPE", Value: "aes-256-cbc"},
+				keyFromSecret("PGBACKREST_REPO1_CIPHER_PASS"))
+		}
+	}
+	return result
+}
+
+// validateBackupEncryption checks that the WAL tool and the archive of the cluster support the encryption of the
+// manifest and that the key secret holds a usable key, before the pods start uploading without it.
+func (c *Cluster) validateBackupEncryption(pgSpec *spec.PostgresSpec) error {
+	encryption := pgSpec.BackupEncryption
+	if encryption == nil {
+		return nil
+	}
+	walTool := c.walTool(pgSpec)
+	if walTool != constants.WALToolWALG && walTool != constants.WALToolPgBackRest {
+		return fmt.Errorf("backup encryption requires wal-g or pgbackrest, the cluster uses %s", walTool)
+	}
+	if encryption.KMSKeyID != "" {
+		s3Archive := c.gcsArchive(pgSpec) == nil && c.azureArchive(pgSpec) == nil
+		if walTool == constants.WALToolPgBackRest {
+			s3Archive = pgSpec.PgBackRest.Repo.S3 != nil
+		}
+		if !s3Archive {
+			return fmt.Errorf("the KMS key of the backup encryption requires an archive in S3")
+		}
+	}
+	if encryption.KeySecret == "" {
+		return nil
+	}
+
+	secret, err := c.KubeClient.Secrets(c.Namespace).Get(encryption.KeySecret, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("could not get backup encryption secret %q: %v", encryption.KeySecret, err)
+	}
+	key := secret.Data[constants.BackupEncryptionKeyKey]
+	if len(key) == 0 {
+		return fmt.Errorf("backup encryption secret %q has no %s", encryption.KeySecret, constants.BackupEncryptionKeyKey)
+	}
+	if walTool == constants.WALToolWALG && len(key) != walgEncryptionKeyLength {
+		return fmt.Errorf("the key of the backup encryption secret %q must have %d bytes for wal-g, got %d",
+			encryption.KeySecret, walgEncryptionKeyLength, len(key))
+	}
+
+	return nil
+}
+
+// validateBackupEncryptionChange rejects the changes of the key secret that leave the existing backups unreadable:
+// pgBackRest encrypts the whole repository with the cipher of the stanza, so its key can't be added, changed or
+// removed once the stanza exists, and WAL-G needs the key of the existing backups to restore them, so it can't be
+// removed or replaced by another secret.
+func (c *Cluster) validateBackupEncryptionChange(oldSpec, newSpec *spec.PostgresSpec) error {
+	oldKey, newKey := backupEncryptionKeySecret(oldSpec), backupEncryptionKeySecret(newSpec)
+	if oldKey == newKey {
+		return nil
+	}
+	oldTool, newTool := c.walTool(oldSpec), c.walTool(newSpec)
+	if oldTool == constants.WALToolPgBackRest && newTool == constants.WALToolPgBackRest &&
+		pgBackRestStanza(oldSpec.PgBackRest, c.Name) == pgBackRestStanza(newSpec.PgBackRest, c.Name) {
+		return fmt.Errorf("the key secret of the backup encryption can't be changed from %q to %q for the existing "+
+			"pgBackRest stanza", oldKey, newKey)
+	}
+	if oldTool == constants.WALToolWALG && oldKey != "" {
+		return fmt.Errorf("the key secret %q of the backup encryption can't be removed or replaced, the existing "+
+			"backups are encrypted with it", oldKey)
+	}
+
+	return nil
+}
+
+func backupEncryptionKeySecret(pgSpec *spec.PostgresSpec) string {
+	if pgSpec.BackupEncryption == nil {
+		return ""
+	}
+	return pgSpec.BackupEncryption.KeySecret
+}
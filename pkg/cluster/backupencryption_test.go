@@ -0,0 +1,97 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/config"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+func TestBackupEncryptionEnvironment(t *testing.T) {
+	encryption := &spec.BackupEncryption{KMSKeyID: "arn:aws:kms:eu-central-1:123456789012:key/acid", KeySecret: "acid-backup-key"}
+	tests := []struct {
+		walTool  string
+		prefix   string
+		expected []string
+	}{
+		{constants.WALToolWALG, "", []string{"WALG_S3_SSE", "WALG_S3_SSE_KMS_ID", "WALG_LIBSODIUM_KEY"}},
+		{constants.WALToolWALG, "CLONE_", []string{"CLONE_WALG_S3_SSE", "CLONE_WALG_S3_SSE_KMS_ID", "CLONE_WALG_LIBSODIUM_KEY"}},
+		{constants.WALToolPgBackRest, "", []string{"PGBACKREST_REPO1_S3_KMS_KEY_ID", "PGBACKREST_REPO1_CIPHER_TYPE",
+			"PGBACKREST_REPO1_CIPHER_PASS"}},
+		{constants.WALToolWALE, "", []string{}},
+	}
+	for _, tt := range tests {
+		env := generateBackupEncryptionEnvironment(encryption, tt.walTool, tt.prefix)
+		if len(env) != len(tt.expected) {
+			t.Errorf("%s: expected the variables %v, got: %v", tt.walTool, tt.expected, env)
+			continue
+		}
+		for i, envVar := range env {
+			if envVar.Name != tt.expected[i] {
+				t.Errorf("%s: expected the variable %q, got: %q", tt.walTool, tt.expected[i], envVar.Name)
+			}
+			if envVar.ValueFrom != nil && envVar.ValueFrom.SecretKeyRef.Name != "acid-backup-key" {
+				t.Errorf("%s: expected the key from the secret, got: %#v", tt.walTool, envVar.ValueFrom)
+			}
+		}
+	}
+}
+
+func TestValidateBackupEncryption(t *testing.T) {
+	c := New(Config{OpConfig: config.Config{WALES3Bucket: "backups", WALTool: constants.WALToolWALG}},
+		k8sutil.KubernetesClient{}, spec.Postgresql{}, logger)
+
+	kms := &spec.BackupEncryption{KMSKeyID: "acid"}
+	tests := []struct {
+		name   string
+		spec   spec.PostgresSpec
+		failed bool
+	}{
+		{"no encryption", spec.PostgresSpec{}, false},
+		{"kms in s3", spec.PostgresSpec{BackupEncryption: kms}, false},
+		{"wal-e", spec.PostgresSpec{BackupEncryption: kms, WALTool: constants.WALToolWALE}, true},
+		{"kms in gcs", spec.PostgresSpec{BackupEncryption: kms, GCSArchive: &spec.GCSArchive{Bucket: "gcs"}}, true},
+		{"kms on a repository host", spec.PostgresSpec{BackupEncryption: kms,
+			PgBackRest: &spec.PgBackRest{Repo: spec.PgBackRestRepo{Host: &spec.PgBackRestRepoHost{Host: "repo"}}}}, true},
+	}
+	for _, tt := range tests {
+		if err := c.validateBackupEncryption(&tt.spec); (err != nil) != tt.failed {
+			t.Errorf("%s: expected failure %t, got: %v", tt.name, tt.failed, err)
+		}
+	}
+}
+
+func TestValidateBackupEncryptionChange(t *testing.T) {
+	c := New(Config{OpConfig: config.Config{WALES3Bucket: "backups", WALTool: constants.WALToolWALG}},
+		k8sutil.KubernetesClient{}, spec.Postgresql{}, logger)
+
+	key := func(name string) *spec.BackupEncryption { return &spec.BackupEncryption{KeySecret: name} }
+	pgBackRest := func(stanza string) *spec.PgBackRest { return &spec.PgBackRest{Stanza: stanza} }
+	tests := []struct {
+		name     string
+		old, new spec.PostgresSpec
+		failed   bool
+	}{
+		{"unchanged key", spec.PostgresSpec{BackupEncryption: key("a")}, spec.PostgresSpec{BackupEncryption: key("a")}, false},
+		{"wal-g key added", spec.PostgresSpec{}, spec.PostgresSpec{BackupEncryption: key("a")}, false},
+		{"wal-g key removed", spec.PostgresSpec{BackupEncryption: key("a")}, spec.PostgresSpec{}, true},
+		{"wal-g key rotated", spec.PostgresSpec{BackupEncryption: key("a")}, spec.PostgresSpec{BackupEncryption: key("b")}, true},
+		{"wal-e key removed", spec.PostgresSpec{WALTool: constants.WALToolWALE},
+			spec.PostgresSpec{WALTool: constants.WALToolWALE, BackupEncryption: &spec.BackupEncryption{}}, false},
+		{"pgbackrest key added", spec.PostgresSpec{PgBackRest: pgBackRest("")},
+			spec.PostgresSpec{PgBackRest: pgBackRest(""), BackupEncryption: key("a")}, true},
+		{"pgbackrest key changed", spec.PostgresSpec{PgBackRest: pgBackRest(""), BackupEncryption: key("a")},
+			spec.PostgresSpec{PgBackRest: pgBackRest(""), BackupEncryption: key("b")}, true},
+		{"pgbackrest key with a new stanza", spec.PostgresSpec{PgBackRest: pgBackRest("")},
+			spec.PostgresSpec{PgBackRest: pgBackRest("new"), BackupEncryption: key("a")}, false},
+		{"pgbackrest added with a key", spec.PostgresSpec{},
+			spec.PostgresSpec{PgBackRest: pgBackRest(""), BackupEncryption: key("a")}, false},
+	}
+	for _, tt := range tests {
+		if err := c.validateBackupEncryptionChange(&tt.old, &tt.new); (err != nil) != tt.failed {
+			t.Errorf("%s: expected failure %t, got: %v", tt.name, tt.failed, err)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/alerts"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+const (
+	getArchiverStatusSQL = `SELECT COALESCE(last_archived_wal, ''), last_archived_time,
+		COALESCE(last_failed_wal, ''), last_failed_time FROM pg_catalog.pg_stat_archiver`
+
+	backupsHealthyReason    = "Healthy"
+	backupsNotListedReason  = "BaseBackupsNotListed"
+	walArchivingReason      = "Archiving"
+	noBaseBackupReason      = "NoBaseBackup"
+	baseBackupTooOldReason  = "BaseBackupTooOld"
+	walArchiveLaggingReason = "WALArchiveLagging"
+)
+
+// syncBackupHealth checks the age of the last base backup found by syncBaseBackups and the WAL archiving of the
+// master, and writes them to the backupStatus section of the postgresql object together with the BackupsHealthy
+// and the WALArchiveHealthy conditions.
+func (c *Cluster) syncBackupHealth() error {
+	if !c.walArchiveEnabled(&c.Spec) {
+		return nil
+	}
+	c.setProcessName("checking the backup health")
+
+	status := &spec.BackupStatus{}
+	if !c.databaseAccessDisabled() {
+		if err := c.getArchiverStatus(status); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	condition := backupHealth(status, c.GetBaseBackups(), now, c.OpConfig.BackupMaxAge, c.OpConfig.WALArchiveMaxLag)
+	conditions := setCondition(c.Conditions, condition, now)
+	if condition.Status == v1.ConditionFalse && condition.LastTransitionTime.Time.Equal(now) {
+		c.recordEvent(v1.EventTypeWarning, constants.EventReasonBackupsUnhealthy, "%s", condition.Message)
+	}
+	// without the archiver status nothing is known about the WAL archiving
+	if !c.databaseAccessDisabled() {
+		walCondition := walArchiveHealth(status, c.OpConfig.WALArchiveMaxLag)
+		c.alertWALArchiveHealth(findCondition(c.Conditions, spec.ConditionWALArchiveHealthy), walCondition, status, now)
+		conditions = setCondition(conditions, walCondition, now)
+	}
+	c.BackupStatus = status
+	c.Conditions = conditions
+
+	patch, err := json.Marshal(map[string]interface{}{"backupStatus": status, "conditions": conditions})
+	if err != nil {
+		return fmt.Errorf("could not marshal the backup status: %v", err)
+	}
+	_, err = c.KubeClient.CRDREST.Patch(types.MergePatchType).
+		Namespace(c.Namespace).
+		Resource(constants.CRDResource).
+		Name(c.Name).
+		Body(patch).
+		DoRaw()
+	if err != nil && !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not patch the postgresql object: %v", err)
+	}
+
+	return nil
+}
+
+// getArchiverStatus fills the status with the last archived and the last failed WAL segments of the master.
+func (c *Cluster) getArchiverStatus(status *spec.BackupStatus) error {
+	if err := c.initDbConn(); err != nil {
+		return fmt.Errorf("could not init db connection: %v", err)
+	}
+	defer func() {
+		if err := c.closeDbConn(); err != nil {
+			c.logger.Errorf("could not close db connection: %v", err)
+		}
+	}()
+
+	var lastArchivedTime, lastFailedTime pq.NullTime
+	err := c.pgDb.QueryRow(getArchiverStatusSQL).Scan(&status.LastArchivedWAL, &lastArchivedTime,
+		&status.LastFailedWAL, &lastFailedTime)
+	if err != nil {
+		return fmt.Errorf("could not query the archiver status: %v", err)
+	}
+	if lastArchivedTime.Valid {
+		status.LastArchivedTime = &metav1.Time{Time: lastArchivedTime.Time}
+	}
+	if lastFailedTime.Valid {
+		status.LastFailedTime = &metav1.Time{Time: lastFailedTime.Time}
+	}
+
+	return nil
+}
+
+// backupHealth completes the status with the last base backup and the archive lag, and returns the BackupsHealthy
+// condition for the thresholds. The archive lags only if archiving failed after the last archived segment, as an
+// idle cluster might not produce any segments to archive. Without the list of the base backups, i.e. when listing
+// them failed, the condition is unknown.
+func backupHealth(status *spec.BackupStatus, backups []spec.BaseBackup, now time.Time,
+	maxAge, maxLag time.Duration) spec.ClusterCondition {
+	status.CheckTime = metav1.Time{Time: now}
+	if len(backups) > 0 {
+		// the backups are sorted by their time
+		status.LastBaseBackupTime = &metav1.Time{Time: backups[len(backups)-1].Time}
+	}
+	if status.LastFailedTime != nil {
+		var lag time.Duration
+		if status.LastArchivedTime == nil {
+			lag = now.Sub(status.LastFailedTime.Time)
+		} else if status.LastFailedTime.After(status.LastArchivedTime.Time) {
+			lag = now.Sub(status.LastArchivedTime.Time)
+		}
+		seconds := int64(lag / time.Second)
+		status.ArchiveLagSeconds = &seconds
+	}
+
+	condition := spec.ClusterCondition{Type: spec.ConditionBackupsHealthy, Status: v1.ConditionFalse}
+	switch {
+	case backups == nil:
+		condition.Status = v1.ConditionUnknown
+		condition.Reason = backupsNotListedReason
+		condition.Message = "the base backups in the WAL archive could not be listed"
+	case status.LastBaseBackupTime == nil:
+		condition.Reason = noBaseBackupReason
+		condition.Message = "no base backups found in the WAL archive"
+	case maxAge > 0 && now.Sub(status.LastBaseBackupTime.Time) > maxAge:
+		condition.Reason = baseBackupTooOldReason
+		condition.Message = fmt.Sprintf("the last base backup is older than %v", maxAge)
+	case walArchiveLagging(status, maxLag):
+		condition.Reason = walArchiveLaggingReason
+		condition.Message = walArchiveLaggingMessage(status, maxLag)
+	default:
+		condition.Status = v1.ConditionTrue
+		condition.Reason = backupsHealthyReason
+	}
+
+	return condition
+}
+
+// walArchiveHealth returns the WALArchiveHealthy condition for the archive lag computed by backupHealth.
+func walArchiveHealth(status *spec.BackupStatus, maxLag time.Duration) spec.ClusterCondition {
+	if walArchiveLagging(status, maxLag) {
+		return spec.ClusterCondition{Type: spec.ConditionWALArchiveHealthy, Status: v1.ConditionFalse,
+			Reason: walArchiveLaggingReason, Message: walArchiveLaggingMessage(status, maxLag)}
+	}
+	return spec.ClusterCondition{Type: spec.ConditionWALArchiveHealthy, Status: v1.ConditionTrue,
+		Reason: walArchivingReason}
+}
+
+func walArchiveLagging(status *spec.BackupStatus, maxLag time.Duration) bool {
+	return maxLag > 0 && status.ArchiveLagSeconds != nil && time.Duration(*status.ArchiveLagSeconds)*time.Second > maxLag
+}
+
+func walArchiveLaggingMessage(status *spec.BackupStatus, maxLag time.Duration) string {
+	return fmt.Sprintf("archiving of the WAL segment %q fails for more than %v", status.LastFailedWAL, maxLag)
+}
+
+// alertWALArchiveHealth emits an event and posts to the wal_archive_alert_webhook when the WAL archiving starts
+// lagging or recovers. The webhook is called once per transition, a failed call is only logged.
+func (c *Cluster) alertWALArchiveHealth(previous *spec.ClusterCondition, condition spec.ClusterCondition,
+	status *spec.BackupStatus, now time.Time) {
+	firing := condition.Status == v1.ConditionFalse
+	if (previous == nil && !firing) || (previous != nil && previous.Status == condition.Status) {
+		return
+	}
+
+	alert := alerts.Alert{
+		Cluster:   c.Name,
+		Namespace: c.Namespace,
+		Reason:    condition.Reason,
+		Message:   condition.Message,
+		Firing:    firing,
+		Time:      now,
+		Details: map[string]string{
+			"lastArchivedWal": status.LastArchivedWAL,
+			"lastFailedWal":   status.LastFailedWAL,
+		},
+	}
+	if status.ArchiveLagSeconds != nil {
+		alert.Details["archiveLagSeconds"] = strconv.FormatInt(*status.ArchiveLagSeconds, 10)
+	}
+	if firing {
+		c.recordEvent(v1.EventTypeWarning, constants.EventReasonWALArchiveLagging, "%s", condition.Message)
+	} else {
+		alert.Message = "archiving of the WAL has recovered"
+		c.recordEvent(v1.EventTypeNormal, constants.EventReasonWALArchiveRecovered, "%s", alert.Message)
+	}
+	if err := c.alerts.Send(alert); err != nil {
+		c.logger.Warningf("could not send the WAL archive alert: %v", err)
+	}
+}
+
+// findCondition returns the condition of the type, or nil if the cluster doesn't have it.
+func findCondition(conditions []spec.ClusterCondition, conditionType string) *spec.ClusterCondition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
+
+// setCondition replaces the condition of the same type, keeping its transition time if the status did not change.
+func setCondition(conditions []spec.ClusterCondition, condition spec.ClusterCondition,
+	now time.Time) []spec.ClusterCondition {
+	result := make([]spec.ClusterCondition, 0, len(conditions)+1)
+	condition.LastTransitionTime = metav1.Time{Time: now}
+	for _, existing := range conditions {
+		if existing.Type != condition.Type {
+			result = append(result, existing)
+			continue
+		}
+		if existing.Status == condition.Status {
+			condition.LastTransitionTime = existing.LastTransitionTime
+		}
+	}
+
+	return append(result, condition)
+}
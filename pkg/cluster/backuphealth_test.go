@@ -0,0 +1,148 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/alerts"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+func TestBackupHealth(t *testing.T) {
+	now := time.Date(2017, 12, 10, 12, 0, 0, 0, time.UTC)
+	ago := func(d time.Duration) *metav1.Time { return &metav1.Time{Time: now.Add(-d)} }
+	backups := []spec.BaseBackup{
+		{Name: "base_000000010000000000000002_00000040", Time: now.Add(-48 * time.Hour)},
+		{Name: "base_000000010000000000000009_00000040", Time: now.Add(-2 * time.Hour)},
+	}
+
+	tests := []struct {
+		subtest string
+		status  spec.BackupStatus
+		backups []spec.BaseBackup
+		reason  string
+		lag     *int64
+	}{
+		{
+			subtest: "healthy idle cluster",
+			status:  spec.BackupStatus{LastArchivedTime: ago(10 * time.Hour)},
+			backups: backups,
+			reason:  backupsHealthyReason,
+		},
+		{
+			subtest: "no base backups",
+			status:  spec.BackupStatus{LastArchivedTime: ago(time.Minute)},
+			backups: []spec.BaseBackup{},
+			reason:  noBaseBackupReason,
+		},
+		{
+			subtest: "base backups not listed",
+			status:  spec.BackupStatus{LastArchivedTime: ago(time.Minute)},
+			reason:  backupsNotListedReason,
+		},
+		{
+			subtest: "base backup too old",
+			status:  spec.BackupStatus{},
+			backups: backups[:1],
+			reason:  baseBackupTooOldReason,
+		},
+		{
+			subtest: "archiving failed before the last success",
+			status:  spec.BackupStatus{LastArchivedTime: ago(time.Minute), LastFailedTime: ago(3 * time.Hour)},
+			backups: backups,
+			reason:  backupsHealthyReason,
+			lag:     new(int64),
+		},
+		{
+			subtest: "archiving fails",
+			status:  spec.BackupStatus{LastArchivedTime: ago(2 * time.Hour), LastFailedTime: ago(time.Minute)},
+			backups: backups,
+			reason:  walArchiveLaggingReason,
+		},
+	}
+	for _, tt := range tests {
+		condition := backupHealth(&tt.status, tt.backups, now, 26*time.Hour, time.Hour)
+		if condition.Reason != tt.reason {
+			t.Errorf("%s: expected the reason %q, got %q: %s", tt.subtest, tt.reason, condition.Reason, condition.Message)
+		}
+		if (condition.Status == v1.ConditionTrue) != (tt.reason == backupsHealthyReason) ||
+			(condition.Status == v1.ConditionUnknown) != (tt.reason == backupsNotListedReason) {
+			t.Errorf("%s: unexpected status of the condition %q", tt.subtest, condition.Status)
+		}
+		if tt.lag != nil && (tt.status.ArchiveLagSeconds == nil || *tt.status.ArchiveLagSeconds != *tt.lag) {
+			t.Errorf("%s: expected the archive lag %d, got %v", tt.subtest, *tt.lag, tt.status.ArchiveLagSeconds)
+		}
+	}
+}
+
+func TestSetCondition(t *testing.T) {
+	before := time.Date(2017, 12, 10, 12, 0, 0, 0, time.UTC)
+	now := before.Add(time.Hour)
+	conditions := []spec.ClusterCondition{
+		{Type: "Other", Status: v1.ConditionTrue, LastTransitionTime: metav1.Time{Time: before}},
+		{Type: spec.ConditionBackupsHealthy, Status: v1.ConditionTrue, LastTransitionTime: metav1.Time{Time: before}},
+	}
+
+	result := setCondition(conditions, spec.ClusterCondition{Type: spec.ConditionBackupsHealthy, Status: v1.ConditionTrue}, now)
+	if len(result) != 2 || !result[1].LastTransitionTime.Time.Equal(before) {
+		t.Errorf("expected the transition time to be kept for the same status, got %v", result)
+	}
+	result = setCondition(conditions, spec.ClusterCondition{Type: spec.ConditionBackupsHealthy, Status: v1.ConditionFalse}, now)
+	if len(result) != 2 || !result[1].LastTransitionTime.Time.Equal(now) || result[0].Type != "Other" {
+		t.Errorf("expected the transition time to be updated for a new status, got %v", result)
+	}
+}
+
+type mockAlerts struct {
+	sent []alerts.Alert
+}
+
+func (m *mockAlerts) Send(alert alerts.Alert) error {
+	m.sent = append(m.sent, alert)
+	return nil
+}
+
+func TestAlertWALArchiveHealth(t *testing.T) {
+	now := time.Date(2017, 12, 10, 12, 0, 0, 0, time.UTC)
+	lag := int64(5400)
+	lagging := spec.BackupStatus{LastFailedWAL: "00000001000000000000001D", ArchiveLagSeconds: &lag}
+	healthy := spec.BackupStatus{LastArchivedWAL: "00000001000000000000001D"}
+	firing, resolved := true, false
+	condition := func(status v1.ConditionStatus) *spec.ClusterCondition {
+		return &spec.ClusterCondition{Type: spec.ConditionWALArchiveHealthy, Status: status}
+	}
+
+	tests := []struct {
+		subtest  string
+		previous *spec.ClusterCondition
+		status   spec.BackupStatus
+		firing   *bool
+	}{
+		{"first check healthy", nil, healthy, nil},
+		{"first check lagging", nil, lagging, &firing},
+		{"starts lagging", condition(v1.ConditionTrue), lagging, &firing},
+		{"keeps lagging", condition(v1.ConditionFalse), lagging, nil},
+		{"recovers", condition(v1.ConditionFalse), healthy, &resolved},
+		{"stays healthy", condition(v1.ConditionTrue), healthy, nil},
+	}
+	for _, tt := range tests {
+		receiver := &mockAlerts{}
+		c := New(Config{}, k8sutil.KubernetesClient{}, spec.Postgresql{}, logger)
+		c.alerts = receiver
+
+		c.alertWALArchiveHealth(tt.previous, walArchiveHealth(&tt.status, time.Hour), &tt.status, now)
+		if tt.firing == nil {
+			if len(receiver.sent) != 0 {
+				t.Errorf("%s: expected no alert, got: %#v", tt.subtest, receiver.sent)
+			}
+			continue
+		}
+		if len(receiver.sent) != 1 || receiver.sent[0].Firing != *tt.firing {
+			t.Errorf("%s: expected one alert firing %t, got: %#v", tt.subtest, *tt.firing, receiver.sent)
+		}
+	}
+}
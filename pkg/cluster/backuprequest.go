@@ -0,0 +1,230 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/pkg/api/v1"
+	batchv1 "k8s.io/client-go/pkg/apis/batch/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+const (
+	baseBackupRequestField    = "baseBackupRequest"
+	logicalBackupRequestField = "logicalBackupRequest"
+)
+
+// syncBackupRequests takes the backups requested with the annotations of the postgresql object since the last sync
+// and writes their results to its status. The base backup is pushed in the background, and the logical backup runs
+// as a job whose result is picked up by the following syncs.
+func (c *Cluster) syncBackupRequests() error {
+	c.failInterruptedBaseBackupRequest()
+	if requestedAt := c.Annotations[constants.BaseBackupRequestAnnotation]; requestedAt != "" &&
+		requestedAt != c.requestedBaseBackup &&
+		(c.BaseBackupRequest == nil || c.BaseBackupRequest.RequestedAt != requestedAt) {
+		c.takeRequestedBaseBackup(requestedAt)
+	}
+
+	if requestedAt := c.Annotations[constants.LogicalBackupRequestAnnotation]; requestedAt != "" &&
+		(c.LogicalBackupRequest == nil || c.LogicalBackupRequest.RequestedAt != requestedAt) {
+		return c.startRequestedLogicalBackup(requestedAt)
+	}
+	if c.LogicalBackupRequest != nil && c.LogicalBackupRequest.Phase == spec.BackupRequestRunning {
+		return c.checkRequestedLogicalBackup()
+	}
+
+	return nil
+}
+
+// takeRequestedBaseBackup starts pushing the requested base backup without blocking the events of the cluster. The
+// result is written under the lock of the cluster once the push has returned.
+func (c *Cluster) takeRequestedBaseBackup(requestedAt string) {
+	c.setProcessName("taking the requested base backup")
+	c.logger.Infof("taking the base backup requested at %s", requestedAt)
+
+	status := &spec.BackupRequestStatus{
+		RequestedAt: requestedAt,
+		Phase:       spec.BackupRequestRunning,
+		StartTime:   &metav1.Time{Time: time.Now()},
+	}
+	c.requestedBaseBackup = requestedAt
+	c.BaseBackupRequest = status
+	c.patchBackupRequestStatus(baseBackupRequestField, status)
+
+	go func() {
+		err := c.pushBaseBackup(c.OpConfig.OnDemandBackupTimeout)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.finishBackupRequest(baseBackupRequestField, "base backup", status, time.Now(), err)
+		if err == nil {
+			if err := c.syncBaseBackups(); err != nil {
+				c.logger.Warningf("could not list base backups: %v", err)
+			}
+		}
+	}()
+}
+
+// failInterruptedBaseBackupRequest fails the base backup request left running by a previous operator process, as
+// the restart of the operator interrupted the backup.
+func (c *Cluster) failInterruptedBaseBackupRequest() {
+	status := c.BaseBackupRequest
+	if status == nil || status.Phase != spec.BackupRequestRunning || status.RequestedAt == c.requestedBaseBackup {
+		return
+	}
+	c.finishBackupRequest(baseBackupRequestField, "base backup", status, time.Now(),
+		fmt.Errorf("the operator has been restarted while taking the base backup"))
+}
+
+// startRequestedLogicalBackup creates the job dumping the databases from the job template of the logical backups,
+// replacing the job of the previous request.
+func (c *Cluster) startRequestedLogicalBackup(requestedAt string) error {
+	c.setProcessName("starting the requested logical backup")
+	c.logger.Infof("starting the logical backup requested at %s", requestedAt)
+
+	if err := c.deleteLogicalBackupRequestJob(); err != nil {
+		return err
+	}
+	now := time.Now()
+	status := &spec.BackupRequestStatus{
+		RequestedAt: requestedAt,
+		Phase:       spec.BackupRequestRunning,
+		StartTime:   &metav1.Time{Time: now},
+	}
+	c.LogicalBackupRequest = status
+	if !c.logicalBackupBucketConfigured() {
+		c.finishBackupRequest(logicalBackupRequestField, "logical backup", status, now,
+			fmt.Errorf("no logical backup bucket is configured"))
+		return nil
+	}
+
+	job, err := c.KubeClient.Jobs(c.Namespace).Create(c.generateLogicalBackupRequestJob(now))
+	if err != nil {
+		err = fmt.Errorf("could not create logical backup job: %v", err)
+		c.finishBackupRequest(logicalBackupRequestField, "logical backup", status, now, err)
+		return err
+	}
+	c.logger.Infof("logical backup job %q has been created", job.Name)
+	status.JobName = job.Name
+	c.patchBackupRequestStatus(logicalBackupRequestField, status)
+	if err := c.createLogicalBackupObject(status); err != nil {
+		c.logger.Warningf("%v", err)
+	}
+
+	return nil
+}
+
+// generateLogicalBackupRequestJob returns the job template of the logical backups as a job of its own, bounded by the
+// on_demand_backup_timeout.
+func (c *Cluster) generateLogicalBackupRequestJob(requestTime time.Time) *batchv1.Job {
+	deadline := int64(c.OpConfig.OnDemandBackupTimeout / time.Second)
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-%d", c.logicalBackupJobName(), requestTime.Unix()),
+			Namespace: c.Namespace,
+			Labels:    c.labelsSet(),
+		},
+		Spec: c.generateLogicalBackupJob().Spec.JobTemplate.Spec,
+	}
+	job.Spec.ActiveDeadlineSeconds = &deadline
+
+	return job
+}
+
+func (c *Cluster) checkRequestedLogicalBackup() error {
+	status := c.LogicalBackupRequest
+	job, err := c.KubeClient.Jobs(c.Namespace).Get(status.JobName, metav1.GetOptions{})
+	if k8sutil.ResourceNotFound(err) {
+		c.finishBackupRequest(logicalBackupRequestField, "logical backup", status, time.Now(),
+			fmt.Errorf("job %q has been deleted", status.JobName))
+		return c.updateLogicalBackupObject(status)
+	}
+	if err != nil {
+		return fmt.Errorf("could not get logical backup job: %v", err)
+	}
+
+	phase, completionTime, err := backupJobResult(job)
+	if phase == spec.BackupRequestRunning {
+		return nil
+	}
+	c.finishBackupRequest(logicalBackupRequestField, "logical backup", status, completionTime, err)
+
+	return c.updateLogicalBackupObject(status)
+}
+
+// backupJobResult returns the phase of the backup job from its conditions.
+func backupJobResult(job *batchv1.Job) (spec.BackupRequestPhase, time.Time, error) {
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != v1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			if job.Status.CompletionTime != nil {
+				return spec.BackupRequestSucceeded, job.Status.CompletionTime.Time, nil
+			}
+			return spec.BackupRequestSucceeded, condition.LastTransitionTime.Time, nil
+		case batchv1.JobFailed:
+			return spec.BackupRequestFailed, condition.LastTransitionTime.Time,
+				fmt.Errorf("%s: %s", condition.Reason, condition.Message)
+		}
+	}
+
+	return spec.BackupRequestRunning, time.Time{}, nil
+}
+
+// deleteLogicalBackupRequestJob removes the job of the last requested logical backup together with its pods.
+func (c *Cluster) deleteLogicalBackupRequestJob() error {
+	if c.LogicalBackupRequest == nil || c.LogicalBackupRequest.JobName == "" {
+		return nil
+	}
+
+	propagationPolicy := metav1.DeletePropagationForeground
+	err := c.KubeClient.Jobs(c.Namespace).Delete(c.LogicalBackupRequest.JobName,
+		&metav1.DeleteOptions{PropagationPolicy: &propagationPolicy})
+	if err != nil && !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not delete logical backup job %q: %v", c.LogicalBackupRequest.JobName, err)
+	}
+	c.logger.Debugf("logical backup job %q has been deleted", c.LogicalBackupRequest.JobName)
+
+	return nil
+}
+
+func (c *Cluster) finishBackupRequest(field, kind string, status *spec.BackupRequestStatus, completionTime time.Time,
+	err error) {
+	status.CompletionTime = &metav1.Time{Time: completionTime}
+	if err != nil {
+		status.Phase = spec.BackupRequestFailed
+		status.Error = err.Error()
+		c.recordEvent(v1.EventTypeWarning, constants.EventReasonBackupRequestFailed,
+			"%s requested at %s failed: %v", kind, status.RequestedAt, err)
+	} else {
+		status.Phase = spec.BackupRequestSucceeded
+		c.recordEvent(v1.EventTypeNormal, constants.EventReasonBackupRequestSucceeded,
+			"%s requested at %s has been taken", kind, status.RequestedAt)
+	}
+	c.patchBackupRequestStatus(field, status)
+}
+
+func (c *Cluster) patchBackupRequestStatus(field string, status *spec.BackupRequestStatus) {
+	patch, err := json.Marshal(map[string]interface{}{field: status})
+	if err != nil {
+		c.logger.Warningf("could not marshal the status of the backup request: %v", err)
+		return
+	}
+	_, err = c.KubeClient.CRDREST.Patch(types.MergePatchType).
+		Namespace(c.Namespace).
+		Resource(constants.CRDResource).
+		Name(c.Name).
+		Body(patch).
+		DoRaw()
+	if err != nil && !k8sutil.ResourceNotFound(err) {
+		c.logger.Warningf("could not set the status of the backup request: %v", err)
+	}
+}
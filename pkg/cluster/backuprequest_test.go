@@ -0,0 +1,70 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+	batchv1 "k8s.io/client-go/pkg/apis/batch/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+)
+
+func TestBackupJobResult(t *testing.T) {
+	started := time.Date(2017, 12, 10, 12, 0, 0, 0, time.UTC)
+	completed := started.Add(20 * time.Minute)
+
+	tests := []struct {
+		subtest    string
+		conditions []batchv1.JobCondition
+		completion *metav1.Time
+		phase      spec.BackupRequestPhase
+		time       time.Time
+		failed     bool
+	}{
+		{
+			subtest: "running job",
+			phase:   spec.BackupRequestRunning,
+		},
+		{
+			subtest: "completed job",
+			conditions: []batchv1.JobCondition{
+				{Type: batchv1.JobComplete, Status: v1.ConditionTrue, LastTransitionTime: metav1.Time{Time: started}},
+			},
+			completion: &metav1.Time{Time: completed},
+			phase:      spec.BackupRequestSucceeded,
+			time:       completed,
+		},
+		{
+			subtest: "job exceeding the deadline",
+			conditions: []batchv1.JobCondition{
+				{Type: batchv1.JobFailed, Status: v1.ConditionTrue, LastTransitionTime: metav1.Time{Time: completed},
+					Reason: "DeadlineExceeded", Message: "Job was active longer than specified deadline"},
+			},
+			phase:  spec.BackupRequestFailed,
+			time:   completed,
+			failed: true,
+		},
+		{
+			subtest: "condition not true yet",
+			conditions: []batchv1.JobCondition{
+				{Type: batchv1.JobFailed, Status: v1.ConditionFalse},
+			},
+			phase: spec.BackupRequestRunning,
+		},
+	}
+	for _, tt := range tests {
+		job := &batchv1.Job{Status: batchv1.JobStatus{Conditions: tt.conditions, CompletionTime: tt.completion}}
+		phase, completionTime, err := backupJobResult(job)
+		if phase != tt.phase {
+			t.Errorf("%s: expected the phase %q, got %q", tt.subtest, tt.phase, phase)
+		}
+		if !completionTime.Equal(tt.time) {
+			t.Errorf("%s: expected the completion time %v, got %v", tt.subtest, tt.time, completionTime)
+		}
+		if (err != nil) != tt.failed {
+			t.Errorf("%s: unexpected error: %v", tt.subtest, err)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+// backupRetention returns the number of base backups, the days of point-in-time recovery and the number of logical
+// backups to keep, the manifest overriding the operator configuration.
+func (c *Cluster) backupRetention(pgSpec *spec.PostgresSpec) (baseBackups, days, logicalBackups int) {
+	baseBackups, days, logicalBackups = c.OpConfig.BackupRetentionCount, c.OpConfig.BackupRetentionDays,
+		c.OpConfig.LogicalBackupRetention
+	if retention := pgSpec.BackupRetention; retention != nil {
+		if retention.BaseBackups != nil {
+			baseBackups = int(*retention.BaseBackups)
+		}
+		if retention.Days != nil {
+			days = int(*retention.Days)
+		}
+		if retention.LogicalBackups != nil {
+			logicalBackups = int(*retention.LogicalBackups)
+		}
+	}
+	return
+}
+
+// expiredBaseBackups returns the oldest base backups falling out of the retention, the backups being sorted by their
+// time. The newest count backups are kept, and so are the ones needed to recover to any point in time of the last
+// days, including the newest backup taken before that. At least one backup is always kept.
+func expiredBaseBackups(backups []spec.BaseBackup, count, days int, now time.Time) []spec.BaseBackup {
+	if (count <= 0 && days <= 0) || len(backups) == 0 {
+		return nil
+	}
+
+	keepFrom := len(backups) - 1
+	if count > 0 {
+		keepFrom = len(backups) - count
+	}
+	if days > 0 {
+		windowStart := now.AddDate(0, 0, -days)
+		i := keepFrom
+		for i > 0 && backups[i].Time.After(windowStart) {
+			i--
+		}
+		keepFrom = i
+	}
+	if keepFrom <= 0 {
+		return nil
+	}
+
+	return backups[:keepFrom]
+}
+
+// syncBackupRetention deletes the base backups falling out of the retention from the WAL archive, together with the
+// WAL older than the oldest remaining backup, and writes the result to the backupCleanup section of the postgresql
+// object. The cleanup is deferred while standbys or recent clones read the archive, and skipped unless the base
+// backups have been listed by this sync. pgBackRest expires the backups of its repository itself, by its
+// repo1-retention-* options.
+func (c *Cluster) syncBackupRetention() error {
+	if !c.walArchiveEnabled(&c.Spec) || c.walTool(&c.Spec) == constants.WALToolPgBackRest {
+		return nil
+	}
+	count, days, _ := c.backupRetention(&c.Spec)
+	backups := c.GetBaseBackups()
+	if backups == nil {
+		c.logger.Debugf("base backups have not been listed, not deleting expired ones")
+		return nil
+	}
+	expired := expiredBaseBackups(backups, count, days, time.Now())
+	if len(expired) == 0 {
+		return nil
+	}
+	c.setProcessName("deleting expired base backups")
+
+	oldestRetained := backups[len(expired)].Name
+	status := &spec.BackupCleanupStatus{Time: metav1.Now()}
+	consumers, err := c.archiveConsumers()
+	if err != nil {
+		err = fmt.Errorf("could not check the consumers of the archive: %v", err)
+	} else if len(consumers) == 0 {
+		err = c.deleteBaseBackupsBefore(oldestRetained)
+	}
+	switch {
+	case err != nil:
+		status.Error = err.Error()
+		c.recordEvent(v1.EventTypeWarning, constants.EventReasonBackupCleanupFailed,
+			"could not delete the base backups before %q: %v", oldestRetained, err)
+	case len(consumers) > 0:
+		status.DeferredBy = consumers
+		if c.BackupCleanup == nil || !reflect.DeepEqual(c.BackupCleanup.DeferredBy, consumers) {
+			c.recordEvent(v1.EventTypeNormal, constants.EventReasonBackupCleanupDeferred,
+				"not deleting the base backups before %q while %s read the archive", oldestRetained,
+				strings.Join(consumers, ", "))
+		}
+	default:
+		for _, backup := range expired {
+			status.DeletedBackups = append(status.DeletedBackups, backup.Name)
+			status.ReclaimedBytes += backup.Size
+		}
+		c.setBaseBackups(backups[len(expired):])
+		c.recordEvent(v1.EventTypeNormal, constants.EventReasonBackupsDeleted,
+			"deleted %d base backups before %q, reclaiming %d bytes", len(expired), oldestRetained,
+			status.ReclaimedBytes)
+		c.logger.Infof("base backups %s have been deleted", strings.Join(status.DeletedBackups, ", "))
+	}
+	c.BackupCleanup = status
+
+	patch, marshalErr := json.Marshal(map[string]interface{}{"backupCleanup": status})
+	if marshalErr != nil {
+		return fmt.Errorf("could not marshal the status of the backup cleanup: %v", marshalErr)
+	}
+	_, patchErr := c.KubeClient.CRDREST.Patch(types.MergePatchType).
+		Namespace(c.Namespace).
+		Resource(constants.CRDResource).
+		Name(c.Name).
+		Body(patch).
+		DoRaw()
+	if patchErr != nil && !k8sutil.ResourceNotFound(patchErr) {
+		c.logger.Warningf("could not set the status of the backup cleanup: %v", patchErr)
+	}
+
+	return err
+}
+
+// deleteBaseBackupsBefore runs the delete command of the WAL tool in the master pod.
+func (c *Cluster) deleteBaseBackupsBefore(name string) error {
+	command := c.walArchiveCommand("delete --confirm before " + name)
+	if c.walTool(&c.Spec) == constants.WALToolWALG {
+		command = c.walArchiveCommand("delete before " + name + " --confirm")
+	}
+	return c.execInMaster(command)
+}
+
+// execInMaster runs the shell command as the postgres user in the running master pod.
+func (c *Cluster) execInMaster(command string) error {
+	masterPods, err := c.getRolePods(Master)
+	if err != nil {
+		return fmt.Errorf("could not get master pod: %v", err)
+	}
+	if len(masterPods) == 0 || !podIsReady(&masterPods[0]) {
+		return fmt.Errorf("no running master pod")
+	}
+
+	podName := util.NameFromMeta(masterPods[0].ObjectMeta)
+	if out, err := c.ExecCommand(&podName, "/bin/su", "postgres", "-c", command); err != nil {
+		return fmt.Errorf("%v: %s", err, out)
+	}
+
+	return nil
+}
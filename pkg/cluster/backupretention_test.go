@@ -0,0 +1,59 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/config"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+func TestExpiredBaseBackups(t *testing.T) {
+	now := time.Date(2017, 12, 20, 12, 0, 0, 0, time.UTC)
+	// one backup per day, the newest taken an hour ago
+	backups := make([]spec.BaseBackup, 0)
+	for d := 9; d >= 0; d-- {
+		backups = append(backups, spec.BaseBackup{Time: now.AddDate(0, 0, -d).Add(-time.Hour)})
+	}
+
+	tests := []struct {
+		subtest string
+		count   int
+		days    int
+		expired int
+	}{
+		{"retention disabled", 0, 0, 0},
+		{"newest backups", 3, 0, 7},
+		{"more backups to keep than exist", 20, 0, 0},
+		{"backups of the recovery window", 0, 3, 6},
+		{"count keeps more than the days", 5, 3, 5},
+		{"days keep more than the count", 2, 3, 6},
+		{"last day", 1, 1, 8},
+	}
+	for _, tt := range tests {
+		expired := expiredBaseBackups(backups, tt.count, tt.days, now)
+		if len(expired) != tt.expired {
+			t.Errorf("%s: expected %d expired backups, got %d", tt.subtest, tt.expired, len(expired))
+		}
+	}
+
+	old := []spec.BaseBackup{{Time: now.AddDate(0, 0, -30)}, {Time: now.AddDate(0, 0, -20)}}
+	if expired := expiredBaseBackups(old, 0, 3, now); len(expired) != 1 || !expired[0].Time.Equal(old[0].Time) {
+		t.Errorf("expected the newest backup before the recovery window to be kept, got %v", expired)
+	}
+}
+
+func TestBackupRetention(t *testing.T) {
+	c := New(Config{OpConfig: config.Config{BackupRetentionCount: 5, BackupRetentionDays: 7, LogicalBackupRetention: 3}},
+		k8sutil.KubernetesClient{}, spec.Postgresql{}, logger)
+
+	if count, days, logical := c.backupRetention(&c.Spec); count != 5 || days != 7 || logical != 3 {
+		t.Errorf("expected the retention of the operator, got %d, %d, %d", count, days, logical)
+	}
+	zero, thirty := int32(0), int32(30)
+	c.Spec.BackupRetention = &spec.BackupRetention{BaseBackups: &zero, Days: &thirty}
+	if count, days, logical := c.backupRetention(&c.Spec); count != 0 || days != 30 || logical != 3 {
+		t.Errorf("expected the retention of the manifest, got %d, %d, %d", count, days, logical)
+	}
+}
@@ -0,0 +1,406 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/pkg/api/v1"
+	batchv1 "k8s.io/client-go/pkg/apis/batch/v1"
+	batchv2alpha1 "k8s.io/client-go/pkg/apis/batch/v2alpha1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+// the Spilo image starts as root, the data directory on the empty volume has to be handed over to postgres first
+const backupVerificationEntrypoint = `set -euo pipefail
+mkdir -p "$PGDATA"
+chown -R postgres: "$PGROOT"
+exec su postgres -s /bin/bash -c "$VERIFY_SCRIPT"`
+
+// the script restores the latest base backup, recovers until it is consistent and runs the queries in every
+// database accepting connections, a query fails the verification with an error or a false result
+const backupVerificationScript = `set -uo pipefail
+export PATH="$PG_BIN:$PATH"
+if [ "$VERIFY_TOOL" = pgbackrest ]; then
+    pgbackrest restore --type=immediate --target-action=promote || exit 1
+else
+    "$VERIFY_TOOL" backup-fetch "$PGDATA" LATEST || exit 1
+    recovery="restore_command = '$VERIFY_TOOL wal-fetch \"%f\" \"%p\"'
+recovery_target = 'immediate'
+recovery_target_action = 'promote'"
+    if [ "$(cut -d. -f1 "$PGDATA/PG_VERSION")" -ge 12 ]; then
+        echo "$recovery" >> "$PGDATA/postgresql.auto.conf"
+        touch "$PGDATA/recovery.signal"
+    else
+        echo "$recovery" > "$PGDATA/recovery.conf"
+    fi
+fi
+echo "local all all trust" > /tmp/pg_hba.conf
+pg_ctl start -w -t 3600 -D "$PGDATA" -l /tmp/postgresql.log -o "-c listen_addresses='' -c unix_socket_directories=/tmp \
+    -c hba_file=/tmp/pg_hba.conf -c archive_mode=off -c ssl=off" || { cat /tmp/postgresql.log; exit 1; }
+export PGHOST=/tmp
+until [ "$(psql -d postgres -Atc 'SELECT NOT pg_is_in_recovery()' 2>/dev/null)" = t ]; do
+    sleep 5
+done
+failed=0
+if ! psql -d postgres -Atc 'SELECT datname FROM pg_database WHERE datallowconn' > /tmp/databases; then
+    failed=1
+fi
+while read -r database; do
+    if ! psql -d "$database" -Atc 'SELECT 1' > /dev/null; then
+        echo "could not connect to the database $database"
+        failed=1
+    fi
+done < /tmp/databases
+for i in $(seq 1 "${VERIFY_QUERY_COUNT:-0}"); do
+    database_var="VERIFY_DATABASE_$i" query_var="VERIFY_QUERY_$i"
+    if ! result=$(psql -v ON_ERROR_STOP=1 -d "${!database_var}" -Atc "${!query_var}"); then
+        echo "query $i failed"
+        failed=1
+    elif [ "$result" = f ]; then
+        echo "query $i returned false"
+        failed=1
+    fi
+done
+pg_ctl stop -m fast -D "$PGDATA"
+exit $failed`
+
+// the pods of the jobs must not carry the labels of the cluster, as those select the Postgres pods
+const backupVerificationApplication = "spilo-backup-verification"
+
+const (
+	backupVerifiedReason           = "Verified"
+	backupVerificationFailedReason = "VerificationFailed"
+)
+
+func (c *Cluster) backupVerificationJobName() string {
+	return "verify-backup-" + c.Name
+}
+
+// backupVerificationSchedule returns the schedule of the manifest or the default one of the operator configuration.
+func (c *Cluster) backupVerificationSchedule() string {
+	if schedule := c.Spec.BackupVerification.Schedule; schedule != "" {
+		return schedule
+	}
+	return c.OpConfig.VerificationSchedule
+}
+
+// backupVerificationLabels selects the jobs of the CronJob and their pods.
+func (c *Cluster) backupVerificationLabels() map[string]string {
+	return map[string]string{
+		"application":            backupVerificationApplication,
+		"backup-verification-of": c.Name,
+	}
+}
+
+// generateBackupVerificationEnvironment points the WAL tool of the job to the archive of the cluster and passes
+// the validation queries.
+func (c *Cluster) generateBackupVerificationEnvironment() []v1.EnvVar {
+	walTool := c.walTool(&c.Spec)
+	envVars := []v1.EnvVar{
+		{Name: "VERIFY_TOOL", Value: walTool},
+		{Name: "VERIFY_SCRIPT", Value: backupVerificationScript},
+		{Name: "PGROOT", Value: constants.PostgresDataPath},
+		{Name: "PGDATA", Value: constants.PostgresDataPath + "/data"},
+		{Name: "PG_BIN", Value: fmt.Sprintf(pgBinariesLocationTemplate, c.Spec.PgVersion)},
+		{Name: "PGUSER", Value: c.systemUsers[constants.SuperuserKeyName].Name},
+	}
+
+	if walTool == constants.WALToolPgBackRest {
+		envVars = append(envVars,
+			generatePgBackRestEnvironment(c.Spec.PgBackRest, pgBackRestStanza(c.Spec.PgBackRest, c.Name))...)
+	} else {
+		prefix := c.cloneArchivePrefix(&spec.CloneDescription{ClusterName: c.Name, Uid: string(c.Postgresql.GetUID())})
+		switch {
+		case strings.HasPrefix(prefix, "azure://"):
+			azureArchive := c.azureArchive(&c.Spec)
+			envVars = append(envVars,
+				v1.EnvVar{Name: "AZURE_STORAGE_ACCOUNT", Value: azureArchive.StorageAccount},
+				v1.EnvVar{Name: "WALG_AZ_PREFIX", Value: prefix})
+			envVars = append(envVars, generateAzureCredentialsEnvironment(azureArchive, "")...)
+		case strings.HasPrefix(prefix, "gs://"):
+			envVars = append(envVars,
+				v1.EnvVar{Name: "WALE_GS_PREFIX", Value: prefix},
+				v1.EnvVar{Name: "WALG_GS_PREFIX", Value: prefix})
+			if gcsArchive := c.gcsArchive(&c.Spec); gcsArchive.CredentialsSecret != "" {
+				envVars = append(envVars, v1.EnvVar{Name: "GOOGLE_APPLICATION_CREDENTIALS", Value: gcpCredentialsFile})
+			}
+		default:
+			envVars = append(envVars,
+				v1.EnvVar{Name: "WALE_S3_PREFIX", Value: prefix},
+				v1.EnvVar{Name: "WALG_S3_PREFIX", Value: prefix})
+			if s3Endpoint := c.s3Endpoint(&c.Spec); s3Endpoint != nil {
+				envVars = append(envVars, generateS3EndpointEnvironment(s3Endpoint, "")...)
+			} else {
+				envVars = append(envVars, v1.EnvVar{Name: "AWS_REGION", Value: constants.AWSRegion})
+			}
+		}
+	}
+
+	envVars = append(envVars, generateBackupEncryptionEnvironment(c.Spec.BackupEncryption, walTool, "")...)
+
+	queries := c.Spec.BackupVerification.Queries
+	envVars = append(envVars, v1.EnvVar{Name: "VERIFY_QUERY_COUNT", Value: strconv.Itoa(len(queries))})
+	for i, query := range queries {
+		database := query.Database
+		if database == "" {
+			database = "postgres"
+		}
+		envVars = append(envVars,
+			v1.EnvVar{Name: fmt.Sprintf("VERIFY_DATABASE_%d", i+1), Value: database},
+			v1.EnvVar{Name: fmt.Sprintf("VERIFY_QUERY_%d", i+1), Value: query.Query})
+	}
+
+	return envVars
+}
+
+// generateBackupVerificationJob returns the CronJob restoring the latest base backup of the cluster into the empty
+// volume of a throwaway pod. Like the logical backups the runs don't overlap and are not retried, a run exceeding
+// the backup_verification_timeout fails.
+func (c *Cluster) generateBackupVerificationJob() *batchv2alpha1.CronJob {
+	image := c.OpConfig.DockerImage
+	if c.Spec.DockerImage != "" {
+		image = c.Spec.DockerImage
+	}
+	historyLimit := int32(3)
+	deadline := int64(c.OpConfig.VerificationTimeout / time.Second)
+
+	job := &batchv2alpha1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      c.backupVerificationJobName(),
+			Namespace: c.Namespace,
+			Labels:    c.labelsSet(),
+		},
+		Spec: batchv2alpha1.CronJobSpec{
+			Schedule:                   c.backupVerificationSchedule(),
+			ConcurrencyPolicy:          batchv2alpha1.ForbidConcurrent,
+			SuccessfulJobsHistoryLimit: &historyLimit,
+			FailedJobsHistoryLimit:     &historyLimit,
+			JobTemplate: batchv2alpha1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: c.backupVerificationLabels(),
+				},
+				Spec: batchv1.JobSpec{
+					ActiveDeadlineSeconds: &deadline,
+					Template: v1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels:      c.backupVerificationLabels(),
+							Annotations: c.podIAMAnnotations(c.iamRole(&c.Spec)),
+						},
+						Spec: v1.PodSpec{
+							ServiceAccountName: c.podServiceAccountName(c.iamRole(&c.Spec)),
+							RestartPolicy:      v1.RestartPolicyNever,
+							Containers: []v1.Container{
+								{
+									Name:    "verify-backup",
+									Image:   image,
+									Command: []string{"/bin/bash", "-c", backupVerificationEntrypoint},
+									Env:     c.generateBackupVerificationEnvironment(),
+									VolumeMounts: []v1.VolumeMount{
+										{Name: constants.DataVolumeName, MountPath: constants.PostgresDataMount},
+									},
+								},
+							},
+							Volumes: []v1.Volume{
+								{
+									Name:         constants.DataVolumeName,
+									VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	podSpec := &job.Spec.JobTemplate.Spec.Template.Spec
+	if pgBackRest := c.Spec.PgBackRest; pgBackRest != nil {
+		if pgBackRest.Repo.Host != nil {
+			addSecretVolume(podSpec, constants.PgBackRestTLSVolumeName, pgBackRest.Repo.Host.TLSSecret,
+				constants.PgBackRestTLSMount)
+		}
+	} else if gcsArchive := c.gcsArchive(&c.Spec); gcsArchive != nil {
+		if gcsArchive.CredentialsSecret != "" {
+			addSecretVolume(podSpec, constants.GCPCredentialsVolumeName, gcsArchive.CredentialsSecret,
+				constants.GCPCredentialsMount)
+		}
+	} else if s3Endpoint := c.s3Endpoint(&c.Spec); s3Endpoint != nil && s3Endpoint.CACertSecret != "" &&
+		c.azureArchive(&c.Spec) == nil {
+		addSecretVolume(podSpec, constants.S3CACertVolumeName, s3Endpoint.CACertSecret, constants.S3CACertMount)
+	}
+
+	return job
+}
+
+// syncBackupVerificationJob creates, updates or deletes the CronJob of the backup verification according to the
+// manifest.
+func (c *Cluster) syncBackupVerificationJob() error {
+	c.setProcessName("syncing backup verification job")
+
+	job, err := c.KubeClient.CronJobs(c.Namespace).Get(c.backupVerificationJobName(), metav1.GetOptions{})
+	if err != nil && !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not get backup verification job: %v", err)
+	}
+	if err != nil {
+		job = nil
+	}
+
+	if c.Spec.BackupVerification == nil {
+		if job == nil {
+			return nil
+		}
+		c.BackupVerificationJob = job
+		return c.deleteBackupVerificationJob()
+	}
+	if !c.walArchiveEnabled(&c.Spec) {
+		return fmt.Errorf("could not sync backup verification job: the cluster has no WAL archive")
+	}
+
+	desired := c.generateBackupVerificationJob()
+	if job == nil {
+		if job, err = c.KubeClient.CronJobs(c.Namespace).Create(desired); err != nil {
+			return fmt.Errorf("could not create backup verification job: %v", err)
+		}
+		c.logger.Infof("backup verification job %q has been created", util.NameFromMeta(job.ObjectMeta))
+		c.BackupVerificationJob = job
+		return nil
+	}
+	current, wanted := &job.Spec.JobTemplate.Spec, &desired.Spec.JobTemplate.Spec
+	if job.Spec.Schedule == desired.Spec.Schedule &&
+		reflect.DeepEqual(current.ActiveDeadlineSeconds, wanted.ActiveDeadlineSeconds) &&
+		reflect.DeepEqual(current.Template.Spec.Containers[0].Env, wanted.Template.Spec.Containers[0].Env) &&
+		current.Template.Spec.Containers[0].Image == wanted.Template.Spec.Containers[0].Image &&
+		reflect.DeepEqual(current.Template.Spec.Volumes, wanted.Template.Spec.Volumes) &&
+		current.Template.Spec.ServiceAccountName == wanted.Template.Spec.ServiceAccountName &&
+		reflect.DeepEqual(current.Template.Annotations, wanted.Template.Annotations) {
+		c.BackupVerificationJob = job
+		return nil
+	}
+	desired.ResourceVersion = job.ResourceVersion
+	if job, err = c.KubeClient.CronJobs(c.Namespace).Update(desired); err != nil {
+		return fmt.Errorf("could not update backup verification job: %v", err)
+	}
+	c.logger.Infof("backup verification job %q has been updated", util.NameFromMeta(job.ObjectMeta))
+	c.BackupVerificationJob = job
+
+	return nil
+}
+
+// deleteBackupVerificationJob removes the CronJob together with its jobs and their pods.
+func (c *Cluster) deleteBackupVerificationJob() error {
+	if c.BackupVerificationJob == nil {
+		return nil
+	}
+	c.setProcessName("deleting backup verification job")
+
+	propagationPolicy := metav1.DeletePropagationForeground
+	err := c.KubeClient.CronJobs(c.Namespace).Delete(c.BackupVerificationJob.Name,
+		&metav1.DeleteOptions{PropagationPolicy: &propagationPolicy})
+	if err != nil && !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not delete backup verification job: %v", err)
+	}
+	c.logger.Infof("backup verification job %q has been deleted", util.NameFromMeta(c.BackupVerificationJob.ObjectMeta))
+	c.BackupVerificationJob = nil
+
+	return nil
+}
+
+// syncBackupVerification writes the result of the last verification job to the lastBackupVerification section of
+// the postgresql object together with the BackupVerified condition, the finished verifications are reported once as
+// events.
+func (c *Cluster) syncBackupVerification() error {
+	if c.Spec.BackupVerification == nil {
+		return nil
+	}
+	c.setProcessName("checking the backup verification")
+
+	jobs, err := c.KubeClient.Jobs(c.Namespace).List(metav1.ListOptions{
+		LabelSelector: labels.Set(c.backupVerificationLabels()).String(),
+	})
+	if err != nil {
+		return fmt.Errorf("could not list backup verification jobs: %v", err)
+	}
+	var last *batchv1.Job
+	for i, job := range jobs.Items {
+		if last == nil || job.CreationTimestamp.After(last.CreationTimestamp.Time) {
+			last = &jobs.Items[i]
+		}
+	}
+	if last == nil {
+		return nil
+	}
+
+	status, condition := backupVerificationResult(last)
+	// the status is only written when the verification job or its phase change
+	if previous := c.LastBackupVerification; previous != nil && previous.JobName == status.JobName &&
+		previous.Phase == status.Phase {
+		return nil
+	}
+	patch := map[string]interface{}{"lastBackupVerification": status}
+	if condition != nil {
+		now := time.Now()
+		c.Conditions = setCondition(c.Conditions, *condition, now)
+		patch["conditions"] = c.Conditions
+		if condition.Status == v1.ConditionTrue {
+			c.recordEvent(v1.EventTypeNormal, constants.EventReasonBackupVerified,
+				"backup verification job %q succeeded", status.JobName)
+		} else {
+			c.recordEvent(v1.EventTypeWarning, constants.EventReasonBackupVerificationFailed,
+				"backup verification job %q failed: %s", status.JobName, status.Error)
+		}
+	}
+	c.LastBackupVerification = status
+
+	body, err := json.Marshal(patch)
+	if err != nil {
+		return fmt.Errorf("could not marshal the backup verification status: %v", err)
+	}
+	_, err = c.KubeClient.CRDREST.Patch(types.MergePatchType).
+		Namespace(c.Namespace).
+		Resource(constants.CRDResource).
+		Name(c.Name).
+		Body(body).
+		DoRaw()
+	if err != nil && !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not patch the postgresql object: %v", err)
+	}
+
+	return nil
+}
+
+// backupVerificationResult returns the status of the verification job and, once it finished, the BackupVerified
+// condition.
+func backupVerificationResult(job *batchv1.Job) (*spec.BackupVerificationStatus, *spec.ClusterCondition) {
+	status := &spec.BackupVerificationStatus{JobName: job.Name}
+	if job.Status.StartTime != nil {
+		status.StartTime = &metav1.Time{Time: job.Status.StartTime.Time}
+	}
+	phase, completionTime, err := backupJobResult(job)
+	status.Phase = phase
+	if phase == spec.BackupRequestRunning {
+		return status, nil
+	}
+	status.CompletionTime = &metav1.Time{Time: completionTime}
+
+	condition := &spec.ClusterCondition{Type: spec.ConditionBackupVerified, Status: v1.ConditionTrue,
+		Reason: backupVerifiedReason}
+	if err != nil {
+		status.Error = err.Error()
+		condition.Status = v1.ConditionFalse
+		condition.Reason = backupVerificationFailedReason
+		condition.Message = fmt.Sprintf("the restore of the latest base backup by the job %q failed: %v", job.Name, err)
+	}
+
+	return status, condition
+}
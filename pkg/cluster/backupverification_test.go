@@ -0,0 +1,78 @@
+package cluster
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/config"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+func TestGenerateBackupVerificationJob(t *testing.T) {
+	c := New(Config{OpConfig: config.Config{
+		Resources: config.Resources{
+			ClusterLabels:    map[string]string{"application": "spilo"},
+			ClusterNameLabel: "cluster-name",
+		},
+		Auth:                 config.Auth{SuperUsername: superUserName},
+		DockerImage:          "spilo:1.0",
+		WALES3Bucket:         "backups",
+		WALTool:              constants.WALToolWALG,
+		VerificationSchedule: "0 4 * * 0"}},
+		k8sutil.KubernetesClient{}, spec.Postgresql{}, logger)
+	c.Name = "acid-test"
+	c.Namespace = "default"
+	c.UID = "1234"
+	c.Spec.PgVersion = "10"
+	c.Spec.BackupVerification = &spec.BackupVerification{
+		Queries: []spec.VerificationQuery{{Query: "SELECT count(*) > 0 FROM orders", Database: "shop"}, {Query: "SELECT true"}},
+	}
+	c.initSystemUsers()
+
+	env := func() map[string]string {
+		result := make(map[string]string)
+		job := c.generateBackupVerificationJob()
+		for _, envVar := range job.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Env {
+			result[envVar.Name] = envVar.Value
+		}
+		return result
+	}
+
+	job := c.generateBackupVerificationJob()
+	if job.Spec.Schedule != "0 4 * * 0" || job.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Image != "spilo:1.0" {
+		t.Errorf("unexpected schedule or image of the job: %q %q", job.Spec.Schedule,
+			job.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Image)
+	}
+	if c.labelsSet().AsSelector().Matches(labels.Set(job.Spec.JobTemplate.Spec.Template.Labels)) {
+		t.Errorf("expected the pods of the job not to match the selector of the cluster, got labels %v",
+			job.Spec.JobTemplate.Spec.Template.Labels)
+	}
+	for name, expected := range map[string]string{
+		"VERIFY_TOOL":        constants.WALToolWALG,
+		"WALG_S3_PREFIX":     "s3://backups/spilo/acid-test/1234/wal",
+		"PG_BIN":             "/usr/lib/postgresql/10/bin",
+		"VERIFY_QUERY_COUNT": "2",
+		"VERIFY_DATABASE_1":  "shop",
+		"VERIFY_DATABASE_2":  "postgres",
+		"VERIFY_QUERY_2":     "SELECT true",
+	} {
+		if value := env()[name]; value != expected {
+			t.Errorf("expected %s=%q, got: %q", name, expected, value)
+		}
+	}
+
+	c.Spec.BackupVerification.Schedule = "0 2 * * *"
+	c.Spec.GCSArchive = &spec.GCSArchive{Bucket: "gcs-backups", CredentialsSecret: "gcp-key"}
+	if schedule := c.generateBackupVerificationJob().Spec.Schedule; schedule != "0 2 * * *" {
+		t.Errorf("expected the schedule of the manifest, got %q", schedule)
+	}
+	if prefix := env()["WALG_GS_PREFIX"]; prefix != "gs://gcs-backups/spilo/acid-test/1234/wal" {
+		t.Errorf("expected the Google Cloud Storage archive, got %q", prefix)
+	}
+	if env()["GOOGLE_APPLICATION_CREDENTIALS"] != gcpCredentialsFile {
+		t.Errorf("expected the credentials of the Google Cloud Storage archive")
+	}
+}
@@ -0,0 +1,635 @@
+package cluster
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/retryutil"
+)
+
+const (
+	upgradePhaseCreatingGreen = "CreatingGreen"
+	upgradePhaseReplicating   = "Replicating"
+	upgradePhaseSwitchingOver = "SwitchingOver"
+	upgradePhaseSwitchedOver  = "SwitchedOver"
+
+	upgradeReplicationName = "operator_upgrade"
+	getDatabaseNamesSQL    = `SELECT datname FROM pg_database WHERE datallowconn AND NOT datistemplate;`
+	createPublicationSQL   = `CREATE PUBLICATION "%s" FOR ALL TABLES;`
+	publicationExistsSQL   = `SELECT EXISTS (SELECT 1 FROM pg_publication WHERE pubname = $1);`
+	createSubscriptionSQL  = `CREATE SUBSCRIPTION "%s" CONNECTION '%s' PUBLICATION "%s";`
+	subscriptionExistsSQL  = `SELECT EXISTS (SELECT 1 FROM pg_subscription s JOIN pg_database d ON d.oid = s.subdbid
+	                                          WHERE s.subname = $1 AND d.datname = current_database());`
+	inactiveSubscriptionsSQL = `SELECT count(*) FROM pg_stat_subscription ss JOIN pg_subscription s ON s.oid = ss.subid
+	                             JOIN pg_database d ON d.oid = s.subdbid
+	                            WHERE d.datname = current_database() AND ss.pid IS NULL;`
+	unsyncedRelationsSQL = `SELECT count(*) FROM pg_subscription_rel sr JOIN pg_subscription s ON s.oid = sr.srsubid
+	                         JOIN pg_database d ON d.oid = s.subdbid
+	                        WHERE d.datname = current_database() AND sr.srsubstate <> 'r';`
+	replicationSlotLagSQL = `SELECT pg_wal_lsn_diff(pg_current_wal_lsn(), confirmed_flush_lsn)::bigint FROM pg_replication_slots
+	                          WHERE slot_name = $1;`
+	dropSubscriptionSQL = `DROP SUBSCRIPTION IF EXISTS "%s";`
+	// the blue cluster is read-only by then
+	dropPublicationSQL = `BEGIN READ WRITE; DROP PUBLICATION IF EXISTS "%s"; COMMIT;`
+
+	setBlueReadOnlySQL  = `ALTER SYSTEM SET default_transaction_read_only = on;`
+	reloadConfSQL       = `SELECT pg_reload_conf();`
+	terminateClientsSQL = `SELECT pg_terminate_backend(pid) FROM pg_stat_activity
+	                          WHERE backend_type = 'client backend' AND pid <> pg_backend_pid();`
+	getSequenceValuesSQL = `SELECT schemaname, sequencename, last_value FROM pg_sequences WHERE last_value IS NOT NULL;`
+	setSequenceValueSQL  = `SELECT setval(format('%I.%I', $1::text, $2::text)::regclass, $3);`
+
+	// the green cluster has the password of the blue superuser
+	copySchemaCommand = `PGPASSWORD="$PGPASSWORD_SUPERUSER" pg_dump --schema-only --host=%s --username=%s "%s" | ` +
+		`psql --quiet --set ON_ERROR_STOP=1 --dbname="%s" 2>&1`
+)
+
+var nonIdentifierRegexp = regexp.MustCompile("[^a-z0-9_]")
+
+// blueGreenUpgrade checks if the new major version runs in a parallel cluster instead of being upgraded in place.
+func (c *Cluster) blueGreenUpgrade() bool {
+	return c.Spec.MajorUpgrade != nil && c.Spec.MajorUpgrade.Mode == spec.MajorUpgradeModeBlueGreen
+}
+
+// greenClusterName returns the name of the cluster running the new major version, i.e. acid-batman-10.
+func (c *Cluster) greenClusterName(version string) string {
+	return fmt.Sprintf("%s-%s", c.Name, strings.Replace(version, ".", "", -1))
+}
+
+// greenSwitchedOver checks if the master service points to the cluster running the new major version.
+func (c *Cluster) greenSwitchedOver() bool {
+	status := c.lastVersionUpgrade()
+	return status != nil && status.Mode == spec.MajorUpgradeModeBlueGreen && status.Phase == upgradePhaseSwitchedOver
+}
+
+// lastVersionUpgrade returns the status of the last upgrade, falling back to the one written to the manifest
+// before the operator has been restarted.
+func (c *Cluster) lastVersionUpgrade() *spec.MajorVersionUpgradeStatus {
+	if c.versionUpgrade != nil {
+		return c.versionUpgrade
+	}
+	return c.Postgresql.MajorVersionUpgrade
+}
+
+// syncGreenCluster moves the blue/green upgrade one step further: it creates the green cluster with the new version,
+// replicates the data of the blue cluster to it with logical replication once it is running and points the master
+// service to it when the switchover is approved in the manifest. On the switchover the blue cluster becomes read-only,
+// the green one catches up with it and gets the values of its sequences before the replication is dropped, so there
+// is no way back: the blue cluster would miss the writes accepted by the green one since then.
+func (c *Cluster) syncGreenCluster(fromVersion string, fromVersionNumber int) error {
+	toVersion := c.Spec.PgVersion
+	status := c.lastVersionUpgrade()
+	if status == nil || status.Mode != spec.MajorUpgradeModeBlueGreen || status.ToVersion != toVersion {
+		if fromVersionNumber < 100000 {
+			return fmt.Errorf("blue/green upgrades rely on logical replication, which needs postgresql 10 or newer instead of %q",
+				fromVersion)
+		}
+		greenName := c.greenClusterName(toVersion)
+		if err := c.createGreenCluster(greenName, toVersion); err != nil {
+			return fmt.Errorf("could not create the cluster %q: %v", greenName, err)
+		}
+		err := c.setVersionUpgradeStatus(&spec.MajorVersionUpgradeStatus{
+			FromVersion:  fromVersion,
+			ToVersion:    toVersion,
+			Mode:         spec.MajorUpgradeModeBlueGreen,
+			Phase:        upgradePhaseCreatingGreen,
+			StartTime:    metav1.Now(),
+			GreenCluster: greenName,
+		})
+		if err != nil {
+			return err
+		}
+		c.recordEvent(v1.EventTypeNormal, constants.EventReasonUpgradeStarted,
+			"creating the cluster %q to upgrade postgresql from %q to %q", greenName, fromVersion, toVersion)
+		return nil
+	}
+
+	next := *status
+	approved := c.Spec.MajorUpgrade.Switchover
+	switch status.Phase {
+	case upgradePhaseCreatingGreen:
+		running, err := c.greenClusterRunning(status.GreenCluster)
+		if err != nil {
+			return err
+		}
+		if !running {
+			c.logger.Infof("waiting for the cluster %q to run", status.GreenCluster)
+			return nil
+		}
+		if err := c.startGreenReplication(status.GreenCluster); err != nil {
+			return fmt.Errorf("could not replicate to the cluster %q: %v", status.GreenCluster, err)
+		}
+		next.Phase = upgradePhaseReplicating
+		c.logger.Infof("replicating to the cluster %q", status.GreenCluster)
+	case upgradePhaseReplicating:
+		if !approved {
+			return nil
+		}
+		if err := c.checkGreenReplication(status.GreenCluster); err != nil {
+			return fmt.Errorf("not switching over to the cluster %q: %v", status.GreenCluster, err)
+		}
+		// once the replication is being dropped, the switchover can't be revoked anymore
+		next.Phase = upgradePhaseSwitchingOver
+		if err := c.setVersionUpgradeStatus(&next); err != nil {
+			return err
+		}
+		fallthrough
+	case upgradePhaseSwitchingOver:
+		if err := c.stopBlueWrites(); err != nil {
+			return fmt.Errorf("could not make the cluster read-only: %v", err)
+		}
+		if err := c.waitGreenReplication(status.GreenCluster); err != nil {
+			return fmt.Errorf("replication to the cluster %q has not caught up: %v", status.GreenCluster, err)
+		}
+		if err := c.copyGreenSequences(status.GreenCluster); err != nil {
+			return fmt.Errorf("could not copy the sequences to the cluster %q: %v", status.GreenCluster, err)
+		}
+		if err := c.dropGreenReplication(status.GreenCluster); err != nil {
+			return fmt.Errorf("could not drop the replication to the cluster %q: %v", status.GreenCluster, err)
+		}
+		next.Phase = upgradePhaseSwitchedOver
+		endTime := metav1.Now()
+		next.EndTime = &endTime
+	case upgradePhaseSwitchedOver:
+		if !approved {
+			c.recordEvent(v1.EventTypeWarning, constants.EventReasonUpgradeRollbackRefused,
+				"not switching the master service back from the cluster %q: the blue cluster misses the writes accepted by it",
+				status.GreenCluster)
+		}
+		return nil
+	default:
+		return nil
+	}
+	if err := c.setVersionUpgradeStatus(&next); err != nil {
+		return err
+	}
+	if next.Phase != upgradePhaseSwitchedOver {
+		return nil
+	}
+
+	c.recordEvent(v1.EventTypeNormal, constants.EventReasonUpgraded, "switched the master service over to the cluster %q",
+		next.GreenCluster)
+	if err := c.syncService(Master); err != nil {
+		return fmt.Errorf("could not switch the master service: %v", err)
+	}
+
+	return nil
+}
+
+// createGreenCluster creates the manifest of the green cluster from the one of the blue cluster. The secrets are
+// created beforehand, so that the roles of both clusters have the same passwords.
+func (c *Cluster) createGreenCluster(greenName, version string) error {
+	for _, secret := range c.generateUserSecrets() {
+		username := string(secret.Data["username"])
+		secret.Name = c.credentialSecretNameForCluster(username, greenName)
+		secret.Labels[c.OpConfig.ClusterNameLabel] = greenName
+		if _, err := c.KubeClient.Secrets(c.Namespace).Create(secret); err != nil && !k8sutil.ResourceAlreadyExists(err) {
+			return fmt.Errorf("could not create secret %q: %v", secret.Name, err)
+		}
+	}
+
+	pg, err := cloneSpec(&c.Postgresql)
+	if err != nil {
+		return err
+	}
+	green := spec.Postgresql{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       constants.CRDKind,
+			APIVersion: constants.CRDGroup + "/" + constants.CRDApiVersion,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        greenName,
+			Namespace:   c.Namespace,
+			Labels:      pg.Labels,
+			Annotations: map[string]string{constants.BlueClusterAnnotation: c.Name},
+		},
+		Spec: pg.Spec,
+	}
+	green.Spec.PgVersion = version
+	green.Spec.Clone = spec.CloneDescription{}
+	green.Spec.StandbyCluster = nil
+	green.Spec.MajorUpgrade = nil
+
+	body, err := json.Marshal(green)
+	if err != nil {
+		return fmt.Errorf("could not marshal the manifest: %v", err)
+	}
+	_, err = c.KubeClient.CRDREST.Post().
+		Namespace(c.Namespace).
+		Resource(constants.CRDResource).
+		Body(body).
+		DoRaw()
+	if err != nil && !k8sutil.ResourceAlreadyExists(err) {
+		return err
+	}
+	c.logger.Infof("created the cluster %q running postgresql %q", greenName, version)
+
+	return nil
+}
+
+func (c *Cluster) greenClusterRunning(greenName string) (bool, error) {
+	body, err := c.KubeClient.CRDREST.Get().
+		Namespace(c.Namespace).
+		Resource(constants.CRDResource).
+		Name(greenName).
+		DoRaw()
+	if err != nil {
+		return false, fmt.Errorf("could not get the cluster %q: %v", greenName, err)
+	}
+	var green spec.Postgresql
+	if err := json.Unmarshal(body, &green); err != nil {
+		return false, fmt.Errorf("could not unmarshal the cluster %q: %v", greenName, err)
+	}
+
+	return green.Status == spec.ClusterStatusRunning, nil
+}
+
+// startGreenReplication copies the schema of every database of the blue cluster to the green one and subscribes
+// the green databases to the publications of all tables in the blue ones.
+func (c *Cluster) startGreenReplication(greenName string) error {
+	if err := c.initDbConn(); err != nil {
+		return err
+	}
+	defer func() {
+		if err := c.closeDbConn(); err != nil {
+			c.logger.Errorf("could not close database connection: %v", err)
+		}
+	}()
+	databases, err := c.databaseNames()
+	if err != nil {
+		return err
+	}
+	greenMaster, err := c.greenMasterPod(greenName)
+	if err != nil {
+		return err
+	}
+	owners, err := c.getDatabases()
+	if err != nil {
+		return fmt.Errorf("could not get databases: %v", err)
+	}
+
+	superuser := c.systemUsers[constants.SuperuserKeyName]
+	blueHost := fmt.Sprintf("%s.%s.svc.cluster.local", c.Name, c.Namespace)
+	greenHost := fmt.Sprintf("%s.%s.svc.cluster.local", greenName, c.Namespace)
+	for _, datname := range databases {
+		if err := c.ensureUpgradePublication(blueHost, datname); err != nil {
+			return err
+		}
+
+		greenConn, err := openConnection(greenHost, "postgres", superuser.Name, superuser.Password)
+		if err != nil {
+			return fmt.Errorf("could not connect to the cluster %q: %v", greenName, err)
+		}
+		_, err = greenConn.Exec(fmt.Sprintf(createDatabaseSQL, datname, owners[datname]))
+		greenConn.Close()
+		if err != nil && !strings.Contains(err.Error(), "already exists") {
+			return fmt.Errorf("could not create database %q: %v", datname, err)
+		}
+
+		conn, err := openConnection(greenHost, datname, superuser.Name, superuser.Password)
+		if err != nil {
+			return fmt.Errorf("could not connect to the database %q of the cluster %q: %v", datname, greenName, err)
+		}
+		err = c.subscribeGreenDatabase(conn, greenMaster, blueHost, datname)
+		conn.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// upgradeSubscriptionName returns the name of the subscription of the green database, which is also the name of
+// its replication slot in the blue cluster and has to be unique there.
+func upgradeSubscriptionName(datname string) string {
+	name := upgradeReplicationName + "_" + nonIdentifierRegexp.ReplaceAllString(strings.ToLower(datname), "_")
+	if len(name) > constants.RoleNameMaxLength {
+		name = name[:constants.RoleNameMaxLength]
+	}
+	return name
+}
+
+func (c *Cluster) databaseNames() ([]string, error) {
+	rows, err := c.pgDb.Query(getDatabaseNamesSQL)
+	if err != nil {
+		return nil, fmt.Errorf("could not query database names: %v", err)
+	}
+	defer rows.Close()
+
+	var result []string
+	for rows.Next() {
+		var datname string
+		if err := rows.Scan(&datname); err != nil {
+			return nil, fmt.Errorf("error when processing row: %v", err)
+		}
+		result = append(result, datname)
+	}
+
+	return result, nil
+}
+
+func (c *Cluster) ensureUpgradePublication(blueHost, datname string) error {
+	superuser := c.systemUsers[constants.SuperuserKeyName]
+	conn, err := openConnection(blueHost, datname, superuser.Name, superuser.Password)
+	if err != nil {
+		return fmt.Errorf("could not connect to the database %q: %v", datname, err)
+	}
+	defer conn.Close()
+
+	var exists bool
+	if err := conn.QueryRow(publicationExistsSQL, upgradeReplicationName).Scan(&exists); err != nil {
+		return fmt.Errorf("could not check the publication of the database %q: %v", datname, err)
+	}
+	if exists {
+		return nil
+	}
+	if _, err := conn.Exec(fmt.Sprintf(createPublicationSQL, upgradeReplicationName)); err != nil {
+		return fmt.Errorf("could not create the publication of the database %q: %v", datname, err)
+	}
+
+	return nil
+}
+
+// subscribeGreenDatabase copies the schema of the blue database before subscribing to it, unless a previous
+// attempt got that far.
+func (c *Cluster) subscribeGreenDatabase(conn *sql.DB, greenMaster *v1.Pod, blueHost, datname string) error {
+	var exists bool
+	subscription := upgradeSubscriptionName(datname)
+	if err := conn.QueryRow(subscriptionExistsSQL, subscription).Scan(&exists); err != nil {
+		return fmt.Errorf("could not check the subscription of the database %q: %v", datname, err)
+	}
+	if exists {
+		return nil
+	}
+
+	superuser := c.systemUsers[constants.SuperuserKeyName]
+	podName := util.NameFromMeta(greenMaster.ObjectMeta)
+	command := fmt.Sprintf(copySchemaCommand, blueHost, superuser.Name, datname, datname)
+	if _, err := c.ExecCommand(&podName, "/bin/su", "postgres", "-c", command); err != nil {
+		return fmt.Errorf("could not copy the schema of the database %q: %v", datname, err)
+	}
+
+	connstring := strings.Replace(connectionString(blueHost, datname, superuser.Name, superuser.Password), "'", "''", -1)
+	_, err := conn.Exec(fmt.Sprintf(createSubscriptionSQL, subscription, connstring, upgradeReplicationName))
+	if err != nil {
+		return fmt.Errorf("could not subscribe the database %q: %v", datname, err)
+	}
+	c.logger.Infof("database %q is being replicated to the pod %q", datname, podName)
+
+	return nil
+}
+
+// checkGreenReplication makes sure that the replication to every database of the green cluster is running, has
+// copied the initial data of all tables and lags behind the blue cluster by no more than maximum_lag_on_failover.
+func (c *Cluster) checkGreenReplication(greenName string) error {
+	if err := c.initDbConn(); err != nil {
+		return err
+	}
+	defer func() {
+		if err := c.closeDbConn(); err != nil {
+			c.logger.Errorf("could not close database connection: %v", err)
+		}
+	}()
+	databases, err := c.databaseNames()
+	if err != nil {
+		return err
+	}
+
+	superuser := c.systemUsers[constants.SuperuserKeyName]
+	greenHost := fmt.Sprintf("%s.%s.svc.cluster.local", greenName, c.Namespace)
+	maxLag := c.maximumLagOnFailover()
+	for _, datname := range databases {
+		conn, err := openConnection(greenHost, datname, superuser.Name, superuser.Password)
+		if err != nil {
+			return fmt.Errorf("could not connect to the database %q of the cluster %q: %v", datname, greenName, err)
+		}
+		var inactive, unsynced int
+		err = conn.QueryRow(inactiveSubscriptionsSQL).Scan(&inactive)
+		if err == nil {
+			err = conn.QueryRow(unsyncedRelationsSQL).Scan(&unsynced)
+		}
+		conn.Close()
+		if err != nil {
+			return fmt.Errorf("could not check the subscription of the database %q: %v", datname, err)
+		}
+		if inactive > 0 {
+			return fmt.Errorf("replication to the database %q is not running", datname)
+		}
+		if unsynced > 0 {
+			return fmt.Errorf("%d tables of the database %q are still being copied", unsynced, datname)
+		}
+
+		lag, err := c.replicationSlotLag(datname)
+		if err != nil {
+			return err
+		}
+		if lag > maxLag {
+			return fmt.Errorf("replication to the database %q lags behind by %d bytes, more than %d", datname, lag, maxLag)
+		}
+	}
+
+	return nil
+}
+
+// replicationSlotLag returns how many bytes of the WAL of the blue cluster the subscription of the green database
+// has not confirmed yet. The slots live in the blue cluster.
+func (c *Cluster) replicationSlotLag(datname string) (int64, error) {
+	var lag sql.NullInt64
+	err := c.pgDb.QueryRow(replicationSlotLagSQL, upgradeSubscriptionName(datname)).Scan(&lag)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("replication slot of the database %q does not exist", datname)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("could not get the replication lag of the database %q: %v", datname, err)
+	}
+	if !lag.Valid {
+		return 0, fmt.Errorf("replication to the database %q has not confirmed any changes yet", datname)
+	}
+
+	return lag.Int64, nil
+}
+
+// stopBlueWrites makes every new transaction of the blue cluster read-only and terminates the client sessions, so
+// that no write is accepted by it after the green cluster has caught up. It can be repeated.
+func (c *Cluster) stopBlueWrites() error {
+	if err := c.initDbConn(); err != nil {
+		return err
+	}
+	defer func() {
+		if err := c.closeDbConn(); err != nil {
+			c.logger.Errorf("could not close database connection: %v", err)
+		}
+	}()
+	if _, err := c.pgDb.Exec(setBlueReadOnlySQL); err != nil {
+		return fmt.Errorf("could not set default_transaction_read_only: %v", err)
+	}
+	if _, err := c.pgDb.Exec(reloadConfSQL); err != nil {
+		return fmt.Errorf("could not reload the configuration: %v", err)
+	}
+	if _, err := c.pgDb.Exec(terminateClientsSQL); err != nil {
+		return fmt.Errorf("could not terminate the client sessions: %v", err)
+	}
+	c.logger.Infof("the cluster is read-only")
+
+	return nil
+}
+
+// waitGreenReplication waits for the subscriptions of all green databases to confirm the whole WAL of the blue
+// cluster, which doesn't accept writes anymore.
+func (c *Cluster) waitGreenReplication(greenName string) error {
+	if err := c.initDbConn(); err != nil {
+		return err
+	}
+	defer func() {
+		if err := c.closeDbConn(); err != nil {
+			c.logger.Errorf("could not close database connection: %v", err)
+		}
+	}()
+	databases, err := c.databaseNames()
+	if err != nil {
+		return err
+	}
+
+	for _, datname := range databases {
+		err := retryutil.Retry(c.OpConfig.ResourceCheckInterval, c.OpConfig.ResourceCheckTimeout,
+			func() (bool, error) {
+				lag, err := c.replicationSlotLag(datname)
+				if err != nil {
+					return false, err
+				}
+				return lag <= 0, nil
+			})
+		if err != nil {
+			return fmt.Errorf("replication to the database %q: %v", datname, err)
+		}
+	}
+	c.logger.Infof("the cluster %q has caught up", greenName)
+
+	return nil
+}
+
+// copyGreenSequences sets the sequences of the green databases to the values of the blue ones, since logical
+// replication doesn't replicate them.
+func (c *Cluster) copyGreenSequences(greenName string) error {
+	if err := c.initDbConn(); err != nil {
+		return err
+	}
+	databases, err := c.databaseNames()
+	if closeErr := c.closeDbConn(); closeErr != nil {
+		c.logger.Errorf("could not close database connection: %v", closeErr)
+	}
+	if err != nil {
+		return err
+	}
+
+	blueHost := fmt.Sprintf("%s.%s.svc.cluster.local", c.Name, c.Namespace)
+	greenHost := fmt.Sprintf("%s.%s.svc.cluster.local", greenName, c.Namespace)
+	for _, datname := range databases {
+		if err := c.copyDatabaseSequences(blueHost, greenHost, datname); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Cluster) copyDatabaseSequences(blueHost, greenHost, datname string) error {
+	superuser := c.systemUsers[constants.SuperuserKeyName]
+	blueConn, err := openConnection(blueHost, datname, superuser.Name, superuser.Password)
+	if err != nil {
+		return fmt.Errorf("could not connect to the database %q: %v", datname, err)
+	}
+	defer blueConn.Close()
+	greenConn, err := openConnection(greenHost, datname, superuser.Name, superuser.Password)
+	if err != nil {
+		return fmt.Errorf("could not connect to the database %q of the green cluster: %v", datname, err)
+	}
+	defer greenConn.Close()
+
+	rows, err := blueConn.Query(getSequenceValuesSQL)
+	if err != nil {
+		return fmt.Errorf("could not query the sequences of the database %q: %v", datname, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var schema, name string
+		var value int64
+		if err := rows.Scan(&schema, &name, &value); err != nil {
+			return fmt.Errorf("error when processing row: %v", err)
+		}
+		if _, err := greenConn.Exec(setSequenceValueSQL, schema, name, value); err != nil {
+			return fmt.Errorf("could not set the sequence %s.%s of the database %q: %v", schema, name, datname, err)
+		}
+	}
+
+	return rows.Err()
+}
+
+// dropGreenReplication drops the subscriptions of the green databases, which drops their replication slots in the
+// blue cluster as well, and the publications of the blue databases. It runs before the master service points to the
+// green cluster, as long as the subscriptions still reach the blue one, and can be repeated if it fails midway.
+func (c *Cluster) dropGreenReplication(greenName string) error {
+	if err := c.initDbConn(); err != nil {
+		return err
+	}
+	databases, err := c.databaseNames()
+	if closeErr := c.closeDbConn(); closeErr != nil {
+		c.logger.Errorf("could not close database connection: %v", closeErr)
+	}
+	if err != nil {
+		return err
+	}
+
+	superuser := c.systemUsers[constants.SuperuserKeyName]
+	blueHost := fmt.Sprintf("%s.%s.svc.cluster.local", c.Name, c.Namespace)
+	greenHost := fmt.Sprintf("%s.%s.svc.cluster.local", greenName, c.Namespace)
+	for _, datname := range databases {
+		conn, err := openConnection(greenHost, datname, superuser.Name, superuser.Password)
+		if err != nil {
+			return fmt.Errorf("could not connect to the database %q of the cluster %q: %v", datname, greenName, err)
+		}
+		_, err = conn.Exec(fmt.Sprintf(dropSubscriptionSQL, upgradeSubscriptionName(datname)))
+		conn.Close()
+		if err != nil {
+			return fmt.Errorf("could not drop the subscription of the database %q: %v", datname, err)
+		}
+
+		conn, err = openConnection(blueHost, datname, superuser.Name, superuser.Password)
+		if err != nil {
+			return fmt.Errorf("could not connect to the database %q: %v", datname, err)
+		}
+		_, err = conn.Exec(fmt.Sprintf(dropPublicationSQL, upgradeReplicationName))
+		conn.Close()
+		if err != nil {
+			return fmt.Errorf("could not drop the publication of the database %q: %v", datname, err)
+		}
+	}
+	c.logger.Infof("dropped the replication to the cluster %q", greenName)
+
+	return nil
+}
+
+func (c *Cluster) greenMasterPod(greenName string) (*v1.Pod, error) {
+	selector := c.roleLabelsSet(Master)
+	selector[c.OpConfig.ClusterNameLabel] = greenName
+	pods, err := c.KubeClient.Pods(c.Namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, fmt.Errorf("could not get master pod of the cluster %q: %v", greenName, err)
+	}
+	if len(pods.Items) != 1 {
+		return nil, fmt.Errorf("cluster %q has %d master pods", greenName, len(pods.Items))
+	}
+
+	return &pods.Items[0], nil
+}
@@ -0,0 +1,270 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+)
+
+const cloneAllowedSameTeam = "same team"
+
+// listClusters returns the postgresql objects of the watched namespace, the source of the teams of the clusters for
+// the authorization of the clones.
+func (c *Cluster) listClusters() ([]spec.Postgresql, error) {
+	body, err := c.KubeClient.CRDREST.Get().
+		Namespace(c.OpConfig.WatchedNamespace).
+		Resource(constants.CRDResource).
+		DoRaw()
+	if err != nil {
+		return nil, fmt.Errorf("could not list postgresql objects: %v", err)
+	}
+	var list spec.PostgresqlList
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("could not unmarshal the list of postgresql objects: %v", err)
+	}
+
+	return list.Items, nil
+}
+
+// cloneSourceTeam returns the team of the cluster to clone: the teamId of its postgresql object or, once it has been
+// deleted, the team of the new cluster if the name of the source starts with it. The team named by the clone comes
+// from the manifest of the new cluster and is not trusted.
+func cloneSourceTeam(clusters []spec.Postgresql, team, sourceNamespace, sourceCluster string) string {
+	for i := range clusters {
+		if clusters[i].Namespace == sourceNamespace && clusters[i].Name == sourceCluster {
+			return clusters[i].Spec.TeamID
+		}
+	}
+	if strings.HasPrefix(strings.ToLower(sourceCluster), strings.ToLower(team)+"-") {
+		return team
+	}
+	return ""
+}
+
+// teamClusterNames returns the names of the clusters of the team, the names their archives are kept under.
+func teamClusterNames(clusters []spec.Postgresql, team string) []string {
+	result := make([]string, 0)
+	for i := range clusters {
+		if team != "" && strings.EqualFold(clusters[i].Spec.TeamID, team) {
+			result = append(result, clusters[i].Name)
+		}
+	}
+	return result
+}
+
+// cloneAllowedBy returns what allows the clone of the source cluster: the clones of the clusters of the same team
+// in the same namespace are always allowed, the other ones only with a matching <namespace>/<cluster> pattern of
+// the clone_allowed_sources.
+func cloneAllowedBy(rules []string, namespace, team, sourceNamespace, sourceTeam, sourceCluster string) (string, bool) {
+	if sourceNamespace == namespace && sourceTeam != "" && strings.EqualFold(sourceTeam, team) {
+		return cloneAllowedSameTeam, true
+	}
+	for _, rule := range rules {
+		if matched, err := path.Match(rule, sourceNamespace+"/"+sourceCluster); err == nil && matched {
+			return rule, true
+		}
+	}
+	return "", false
+}
+
+// archiveAllowedBy returns what allows reading the WAL archive at the location: the archives of the clusters of the
+// same team in the bucket of the cluster are always allowed, the other ones only with a matching archive pattern of
+// the clone_allowed_sources, i.e. s3://batman-backups/spilo/batman-*, matching the location or one of its parents.
+func archiveAllowedBy(rules []string, root string, teamClusters []string, location string) (string, bool) {
+	for _, name := range teamClusters {
+		if strings.HasPrefix(strings.TrimSuffix(location, "/")+"/", root+name+"/") {
+			return cloneAllowedSameTeam, true
+		}
+	}
+	parts := strings.Split(strings.TrimSuffix(location, "/"), "/")
+	for _, rule := range rules {
+		if !strings.Contains(rule, "://") {
+			continue
+		}
+		for i := len(parts); i > 0; i-- {
+			if matched, err := path.Match(rule, strings.Join(parts[:i], "/")); err == nil && matched {
+				return rule, true
+			}
+		}
+	}
+	return "", false
+}
+
+// standbyHostCluster returns the cluster and the namespace of the standby host, if it is the service of a cluster in
+// the Kubernetes cluster, i.e. acid-batman or acid-batman.default.svc.cluster.local.
+func standbyHostCluster(host, namespace string) (string, string, bool) {
+	parts := strings.Split(host, ".")
+	switch {
+	case len(parts) == 1:
+		return parts[0], namespace, true
+	case len(parts) >= 3 && parts[2] == "svc":
+		return parts[0], parts[1], true
+	}
+	return "", "", false
+}
+
+// cloneMethod returns how the cluster is cloned, for the audit record.
+func cloneMethod(description *spec.CloneDescription) string {
+	switch {
+	case description.Snapshot != "":
+		return "snapshot"
+	case description.PgBackRest:
+		return "pgbackrest"
+	case cloneWithBasebackup(description):
+		return "basebackup"
+	default:
+		return "archive"
+	}
+}
+
+// authorizeClone checks that the cluster may be cloned from its source and writes the audit record of the clone to
+// the cloneAudit section of the postgresql object, once.
+func (c *Cluster) authorizeClone() error {
+	description := c.cloneDescription(&c.Spec)
+	if description.ClusterName == "" {
+		return nil
+	}
+	sourceNamespace := description.Namespace
+	if sourceNamespace == "" {
+		sourceNamespace = c.Namespace
+	}
+	clusters, err := c.listClusters()
+	if err != nil {
+		return err
+	}
+	sourceTeam := cloneSourceTeam(clusters, c.Spec.TeamID, sourceNamespace, description.ClusterName)
+	allowedBy, ok := cloneAllowedBy(c.OpConfig.CloneAllowedSources, c.Namespace, c.Spec.TeamID,
+		sourceNamespace, sourceTeam, description.ClusterName)
+	if !ok {
+		return fmt.Errorf("clone of the cluster %q of the team %q in the namespace %q is not in the clone_allowed_sources",
+			description.ClusterName, sourceTeam, sourceNamespace)
+	}
+
+	audit := &spec.CloneAudit{
+		SourceCluster:   description.ClusterName,
+		SourceNamespace: sourceNamespace,
+		SourceTeam:      sourceTeam,
+		Method:          cloneMethod(description),
+		Timestamp:       description.EndTimestamp,
+		Backup:          c.Spec.Clone.Backup,
+		AllowedBy:       allowedBy,
+		Time:            metav1.Time{Time: time.Now()},
+	}
+	switch audit.Method {
+	case "snapshot":
+		audit.Location = description.Snapshot
+	case "pgbackrest":
+		audit.Location = "stanza " + description.ClusterName
+	case "basebackup":
+		host, port := c.getClusterServiceConnectionParameters(description.ClusterName)
+		audit.Location = host + ":" + port
+	default:
+		audit.Location = c.cloneArchivePrefix(description)
+		if description.CredentialsSecret != "" && strings.HasPrefix(audit.Location, "gs://") {
+			return fmt.Errorf("clone credentials are not supported for the archive %q", audit.Location)
+		}
+		// an explicit path might point to the archive of any cluster, whatever the name of the clone
+		if description.S3WalPath != "" || description.GSWalPath != "" || description.AzWalPath != "" {
+			archiveAllowed, ok := archiveAllowedBy(c.OpConfig.CloneAllowedSources, c.archiveRoot(),
+				teamClusterNames(clusters, c.Spec.TeamID), audit.Location)
+			if !ok {
+				return fmt.Errorf("clone from the archive %q is not in the clone_allowed_sources", audit.Location)
+			}
+			if archiveAllowed != cloneAllowedSameTeam {
+				audit.AllowedBy = archiveAllowed
+			}
+		}
+	}
+	c.logger.Infof("clone of the cluster %q in the namespace %q allowed by %q", description.ClusterName,
+		sourceNamespace, audit.AllowedBy)
+	if c.CloneAudit != nil {
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{"cloneAudit": audit})
+	if err != nil {
+		return fmt.Errorf("could not marshal the clone audit: %v", err)
+	}
+	_, err = c.KubeClient.CRDREST.Patch(types.MergePatchType).
+		Namespace(c.Namespace).
+		Resource(constants.CRDResource).
+		Name(c.Name).
+		Body(patch).
+		DoRaw()
+	if err != nil {
+		return fmt.Errorf("could not set the clone audit: %v", err)
+	}
+	c.CloneAudit = audit
+
+	return nil
+}
+
+// authorizeStandby checks that the cluster may replay the WAL of the source of its standby section, by the same rules
+// as the clones: the archive by its location, the standby host by the cluster of its service. Hosts outside of the
+// Kubernetes cluster are not managed by the operator and need the credentials of their source anyway.
+func (c *Cluster) authorizeStandby() error {
+	standby := c.Spec.StandbyCluster
+	if standby == nil {
+		return nil
+	}
+	clusters, err := c.listClusters()
+	if err != nil {
+		return err
+	}
+	for _, location := range []string{standby.S3WalPath, standby.GSWalPath} {
+		if location == "" {
+			continue
+		}
+		if _, ok := archiveAllowedBy(c.OpConfig.CloneAllowedSources, c.archiveRoot(),
+			teamClusterNames(clusters, c.Spec.TeamID), location); !ok {
+			return fmt.Errorf("standby of the archive %q is not in the clone_allowed_sources", location)
+		}
+	}
+	if standby.StandbyHost == "" {
+		return nil
+	}
+	sourceCluster, sourceNamespace, ok := standbyHostCluster(standby.StandbyHost, c.Namespace)
+	if !ok {
+		return nil
+	}
+	sourceTeam := cloneSourceTeam(clusters, c.Spec.TeamID, sourceNamespace, sourceCluster)
+	if _, ok := cloneAllowedBy(c.OpConfig.CloneAllowedSources, c.Namespace, c.Spec.TeamID, sourceNamespace, sourceTeam,
+		sourceCluster); !ok {
+		return fmt.Errorf("standby of the cluster %q in the namespace %q is not in the clone_allowed_sources",
+			sourceCluster, sourceNamespace)
+	}
+
+	return nil
+}
+
+// generateCloneCredentialsEnvironment returns the S3 keys the clone reads the archive of another team with.
+func generateCloneCredentialsEnvironment(description *spec.CloneDescription) []v1.EnvVar {
+	result := make([]v1.EnvVar, 0)
+	if description.CredentialsSecret == "" {
+		return result
+	}
+	for _, variable := range []struct{ name, key string }{
+		{"CLONE_AWS_ACCESS_KEY_ID", constants.CloneAWSAccessKeyIDKey},
+		{"CLONE_AWS_SECRET_ACCESS_KEY", constants.CloneAWSSecretAccessKeyKey},
+	} {
+		result = append(result, v1.EnvVar{
+			Name: variable.name,
+			ValueFrom: &v1.EnvVarSource{
+				SecretKeyRef: &v1.SecretKeySelector{
+					LocalObjectReference: v1.LocalObjectReference{Name: description.CredentialsSecret},
+					Key:                  variable.key,
+				},
+			},
+		})
+	}
+	return result
+}
@@ -0,0 +1,120 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+)
+
+func testClusters() []spec.Postgresql {
+	cluster := func(namespace, name, team string) spec.Postgresql {
+		return spec.Postgresql{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       spec.PostgresSpec{TeamID: team},
+		}
+	}
+	return []spec.Postgresql{
+		cluster("default", "acid-batman", "acid"),
+		cluster("default", "acid-ops-main", "acid-ops"),
+		cluster("default", "batman-main", "batman"),
+	}
+}
+
+func TestCloneSourceTeam(t *testing.T) {
+	tests := []struct {
+		name            string
+		sourceNamespace string
+		sourceCluster   string
+		team            string
+	}{
+		{"cluster of the team", "default", "acid-batman", "acid"},
+		{"cluster of a team with the same prefix", "default", "acid-ops-main", "acid-ops"},
+		{"cluster of another team", "default", "batman-main", "batman"},
+		{"deleted cluster of the team", "default", "acid-deleted", "acid"},
+		{"deleted cluster of another team", "default", "batman-deleted", ""},
+		{"cluster in another namespace", "analytics", "batman-main", ""},
+	}
+	for _, tt := range tests {
+		if team := cloneSourceTeam(testClusters(), "acid", tt.sourceNamespace, tt.sourceCluster); team != tt.team {
+			t.Errorf("%s: expected the team %q, got %q", tt.name, tt.team, team)
+		}
+	}
+}
+
+func TestTeamClusterNames(t *testing.T) {
+	expected := []string{"acid-batman"}
+	if names := teamClusterNames(testClusters(), "ACID"); !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected the clusters %v, got %v", expected, names)
+	}
+}
+
+func TestCloneAllowedBy(t *testing.T) {
+	rules := []string{"analytics/*", "default/batman-archive"}
+	tests := []struct {
+		name            string
+		sourceNamespace string
+		sourceTeam      string
+		sourceCluster   string
+		allowedBy       string
+	}{
+		{"same team", "default", "ACID", "acid-batman", cloneAllowedSameTeam},
+		{"other team", "default", "batman", "batman-archive", "default/batman-archive"},
+		{"other team not allowed", "default", "batman", "batman-main", ""},
+		{"other namespace", "analytics", "acid", "acid-batman", "analytics/*"},
+		{"other namespace not allowed", "production", "acid", "acid-batman", ""},
+		{"unknown team", "default", "", "acid-batman", ""},
+	}
+	for _, tt := range tests {
+		allowedBy, ok := cloneAllowedBy(rules, "default", "acid", tt.sourceNamespace, tt.sourceTeam, tt.sourceCluster)
+		if ok != (tt.allowedBy != "") || allowedBy != tt.allowedBy {
+			t.Errorf("%s: expected the clone allowed by %q, got %q (%t)", tt.name, tt.allowedBy, allowedBy, ok)
+		}
+	}
+}
+
+func TestArchiveAllowedBy(t *testing.T) {
+	rules := []string{"default/batman-*", "s3://batman-backups/spilo/batman-*"}
+	tests := []struct {
+		name      string
+		location  string
+		allowedBy string
+	}{
+		{"same team", "s3://postgresql/spilo/acid-batman/1234/wal", cloneAllowedSameTeam},
+		{"same team without uid", "s3://postgresql/spilo/acid-batman/wal/", cloneAllowedSameTeam},
+		{"other team", "s3://postgresql/spilo/batman-main/1234/wal", ""},
+		{"other team with the same prefix", "s3://postgresql/spilo/acid-ops-main/1234/wal", ""},
+		{"cluster with the same prefix", "s3://postgresql/spilo/acid-batman2/1234/wal", ""},
+		{"other team in the bucket of the team", "s3://batman-backups/spilo/batman-main/1234/wal",
+			"s3://batman-backups/spilo/batman-*"},
+		{"other bucket", "s3://other-backups/spilo/acid-batman/1234/wal", ""},
+	}
+	for _, tt := range tests {
+		allowedBy, ok := archiveAllowedBy(rules, "s3://postgresql/spilo/", []string{"acid-batman"}, tt.location)
+		if ok != (tt.allowedBy != "") || allowedBy != tt.allowedBy {
+			t.Errorf("%s: expected the archive allowed by %q, got %q (%t)", tt.name, tt.allowedBy, allowedBy, ok)
+		}
+	}
+}
+
+func TestStandbyHostCluster(t *testing.T) {
+	tests := []struct {
+		host      string
+		cluster   string
+		namespace string
+		ok        bool
+	}{
+		{"acid-batman", "acid-batman", "default", true},
+		{"acid-batman.analytics.svc.cluster.local", "acid-batman", "analytics", true},
+		{"db.example.com", "", "", false},
+	}
+	for _, tt := range tests {
+		cluster, namespace, ok := standbyHostCluster(tt.host, "default")
+		if cluster != tt.cluster || namespace != tt.namespace || ok != tt.ok {
+			t.Errorf("%s: expected %q in %q (%t), got %q in %q (%t)", tt.host, tt.cluster, tt.namespace, tt.ok,
+				cluster, namespace, ok)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package cluster
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+const (
+	createCloneUserSQL = `CREATE ROLE "%s" WITH LOGIN REPLICATION ENCRYPTED PASSWORD '%s';`
+	dropCloneUserSQL   = `DROP ROLE IF EXISTS "%s";`
+)
+
+// cloneWithBasebackup checks if the cluster is cloned with pg_basebackup from the running source cluster.
+func cloneWithBasebackup(description *spec.CloneDescription) bool {
+	return description.ClusterName != "" && description.EndTimestamp == "" && description.S3WalPath == "" &&
+		description.GSWalPath == "" && description.AzWalPath == "" && description.Snapshot == "" && !description.PgBackRest
+}
+
+// usesCloneUser checks if the basebackup of the clone is taken by a dedicated user created in the source cluster.
+func (c *Cluster) usesCloneUser(description *spec.CloneDescription) bool {
+	return c.OpConfig.EnableCloneUser && cloneWithBasebackup(description)
+}
+
+// cloneUserName returns the name of the replication user the clone connects to the source cluster with.
+func (c *Cluster) cloneUserName() string {
+	name := constants.CloneUserPrefix + strings.Replace(c.Name, "-", "_", -1)
+	if len(name) > constants.RoleNameMaxLength {
+		name = name[:constants.RoleNameMaxLength]
+	}
+	return name
+}
+
+// createCloneUser creates the replication user in the master of the source cluster and stores its credentials
+// in a secret of the clone, referenced by the bootstrap environment of the pods.
+func (c *Cluster) createCloneUser() error {
+	c.setProcessName("creating the clone user in the cluster %q", c.Spec.Clone.ClusterName)
+
+	username := c.cloneUserName()
+	password := util.RandomPassword(constants.PasswordLength)
+
+	conn, err := c.cloneSourceConn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// a leftover of a previous attempt has an unknown password
+	if _, err := conn.Exec(fmt.Sprintf(dropCloneUserSQL, username)); err != nil {
+		return fmt.Errorf("could not drop the leftover clone user %q: %v", username, err)
+	}
+	if _, err := conn.Exec(fmt.Sprintf(createCloneUserSQL, username, password)); err != nil {
+		return fmt.Errorf("could not create the clone user %q: %v", username, err)
+	}
+
+	secret := c.generateSingleUserSecret(c.Namespace, spec.PgUser{Name: username, Password: password})
+	if _, err := c.KubeClient.Secrets(c.Namespace).Create(secret); err != nil {
+		if !k8sutil.ResourceAlreadyExists(err) {
+			return fmt.Errorf("could not create secret of the clone user: %v", err)
+		}
+		if _, err := c.KubeClient.Secrets(c.Namespace).Update(secret); err != nil {
+			return fmt.Errorf("could not update secret of the clone user: %v", err)
+		}
+	}
+	c.logger.Infof("created the clone user %q in the cluster %q", username, c.Spec.Clone.ClusterName)
+
+	return nil
+}
+
+// syncCloneUser removes the clone user once the master of the clone is up, as the basebackup is done by then.
+// The secret of the clone user is the marker that the user has not been removed yet.
+func (c *Cluster) syncCloneUser() error {
+	if !c.usesCloneUser(&c.Spec.Clone) {
+		return nil
+	}
+	secretName := c.credentialSecretName(c.cloneUserName())
+	if _, err := c.KubeClient.Secrets(c.Namespace).Get(secretName, metav1.GetOptions{}); err != nil {
+		if k8sutil.ResourceNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("could not get secret of the clone user: %v", err)
+	}
+
+	masterPods, err := c.getRolePods(Master)
+	if err != nil {
+		return fmt.Errorf("could not get master pod: %v", err)
+	}
+	if len(masterPods) == 0 || !podIsReady(&masterPods[0]) {
+		c.logger.Debugf("the clone is still bootstrapping, keeping the clone user")
+		return nil
+	}
+
+	return c.deleteCloneUser()
+}
+
+// deleteCloneUser drops the clone user in the source cluster and deletes its secret. A source cluster that is
+// gone doesn't keep the secret around.
+func (c *Cluster) deleteCloneUser() error {
+	username := c.cloneUserName()
+	conn, err := c.cloneSourceConn()
+	if err != nil {
+		c.logger.Warningf("could not drop the clone user %q in the cluster %q: %v", username, c.Spec.Clone.ClusterName, err)
+	} else {
+		defer conn.Close()
+		if _, err := conn.Exec(fmt.Sprintf(dropCloneUserSQL, username)); err != nil {
+			return fmt.Errorf("could not drop the clone user %q: %v", username, err)
+		}
+		c.logger.Infof("dropped the clone user %q in the cluster %q", username, c.Spec.Clone.ClusterName)
+	}
+
+	secretName := c.credentialSecretName(username)
+	err = c.KubeClient.Secrets(c.Namespace).Delete(secretName, c.deleteOptions)
+	if err != nil && !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not delete secret of the clone user: %v", err)
+	}
+
+	return nil
+}
+
+// cloneSourceConn connects to the master of the source cluster as its superuser.
+func (c *Cluster) cloneSourceConn() (*sql.DB, error) {
+	source := c.Spec.Clone.ClusterName
+	secretName := c.credentialSecretNameForCluster(c.OpConfig.SuperUsername, source)
+	secret, err := c.KubeClient.Secrets(c.Namespace).Get(secretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not get superuser password of the cluster %q: %v", source, err)
+	}
+
+	conn, err := openConnection(fmt.Sprintf("%s.%s.svc.cluster.local", source, c.Namespace), "postgres",
+		string(secret.Data["username"]), string(secret.Data["password"]))
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to the cluster %q: %v", source, err)
+	}
+
+	return conn, nil
+}
+
+// cloneUserEnvironment returns the credentials the bootstrap of the clone connects to the source cluster with.
+func (c *Cluster) cloneUserEnvironment(description *spec.CloneDescription) []v1.EnvVar {
+	username := c.OpConfig.ReplicationUsername
+	secretName := c.credentialSecretNameForCluster(username, description.ClusterName)
+	if c.usesCloneUser(description) {
+		username = c.cloneUserName()
+		secretName = c.credentialSecretName(username)
+	}
+
+	return []v1.EnvVar{
+		{Name: "CLONE_USER", Value: username},
+		{
+			Name: "CLONE_PASSWORD",
+			ValueFrom: &v1.EnvVarSource{
+				SecretKeyRef: &v1.SecretKeySelector{
+					LocalObjectReference: v1.LocalObjectReference{Name: secretName},
+					Key:                  "password",
+				},
+			},
+		},
+	}
+}
@@ -16,22 +16,27 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/pkg/api/v1"
 	"k8s.io/client-go/pkg/apis/apps/v1beta1"
+	batchv2alpha1 "k8s.io/client-go/pkg/apis/batch/v2alpha1"
 	policybeta1 "k8s.io/client-go/pkg/apis/policy/v1beta1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 
 	"github.com/zalando-incubator/postgres-operator/pkg/spec"
 	"github.com/zalando-incubator/postgres-operator/pkg/util"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/alerts"
 	"github.com/zalando-incubator/postgres-operator/pkg/util/config"
 	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
 	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
 	"github.com/zalando-incubator/postgres-operator/pkg/util/patroni"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/secretbackend"
 	"github.com/zalando-incubator/postgres-operator/pkg/util/teams"
 	"github.com/zalando-incubator/postgres-operator/pkg/util/users"
 )
 
 var (
 	alphaNumericRegexp    = regexp.MustCompile("^[a-zA-Z][a-zA-Z0-9]*$")
+	connectionLimitRegexp = regexp.MustCompile(`(?i)^connection\s+limit\s+(-?[0-9]+)$`)
+	validUntilRegexp      = regexp.MustCompile(`(?i)^valid\s+until\s+'?([^']+?)'?$`)
 	databaseNameRegexp    = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
 	userRegexp            = regexp.MustCompile(`^[a-z0-9]([-_a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-_a-z0-9]*[a-z0-9])?)*$`)
 	patroniObjectSuffixes = []string{"config", "failover", "sync"}
@@ -45,11 +50,13 @@ type Config struct {
 }
 
 type kubeResources struct {
-	Services            map[PostgresRole]*v1.Service
-	Endpoints           map[PostgresRole]*v1.Endpoints
-	Secrets             map[types.UID]*v1.Secret
-	Statefulset         *v1beta1.StatefulSet
-	PodDisruptionBudget *policybeta1.PodDisruptionBudget
+	Services              map[PostgresRole]*v1.Service
+	Endpoints             map[PostgresRole]*v1.Endpoints
+	Secrets               map[types.UID]*v1.Secret
+	Statefulset           *v1beta1.StatefulSet
+	PodDisruptionBudget   *policybeta1.PodDisruptionBudget
+	LogicalBackupJob      *batchv2alpha1.CronJob
+	BackupVerificationJob *batchv2alpha1.CronJob
 	//Pods are treated separately
 	//PVCs are treated separately
 }
@@ -61,6 +68,7 @@ type Cluster struct {
 	Config
 	logger           *logrus.Entry
 	patroni          patroni.Interface
+	alerts           alerts.Interface
 	pgUsers          map[string]spec.PgUser
 	systemUsers      map[string]spec.PgUser
 	podSubscribers   map[spec.NamespacedName]chan spec.PodEvent
@@ -71,12 +79,39 @@ type Cluster struct {
 	deleteOptions    *metav1.DeleteOptions
 	podEventsQueue   *cache.FIFO
 
-	teamsAPIClient   teams.Interface
-	oauthTokenGetter OAuthTokenGetter
-	KubeClient       k8sutil.KubernetesClient //TODO: move clients to the better place?
-	currentProcess   spec.Process
-	processMu        sync.RWMutex // protects the current operation for reporting, no need to hold the master mutex
-	specMu           sync.RWMutex // protects the spec for reporting, no need to hold the master mutex
+	teamsAPIClient      teams.Interface
+	oauthTokenGetter    OAuthTokenGetter
+	credentialsBackends map[string]secretbackend.Interface // backends of the credentials besides Kubernetes
+	KubeClient          k8sutil.KubernetesClient           //TODO: move clients to the better place?
+	currentProcess      spec.Process
+	processMu           sync.RWMutex // protects the current operation for reporting, no need to hold the master mutex
+	specMu              sync.RWMutex // protects the spec for reporting, no need to hold the master mutex
+
+	volumeSnapshots   map[string]string           // snapshots of the persistent volumes taken before resizing them
+	snapshotBackups   []spec.VolumeSnapshotBackup // snapshot-based backups found during the last sync
+	volumeSnapshotsMu sync.RWMutex
+
+	baseBackups   []spec.BaseBackup // base backups in the WAL archive found during the last sync
+	baseBackupsMu sync.RWMutex
+
+	createdStanza string // stanza of the pgBackRest repository created by the operator
+
+	backupPushRunning   bool // a base backup is being pushed, possibly after the operator stopped waiting for it
+	backupPushRunningMu sync.Mutex
+	requestedBaseBackup string // time of the last base backup request taken by this operator process
+
+	startedRestore *spec.RestoreStatus // the last in-place restore started by this operator process
+
+	encryptionViolations   []string // persistent volumes violating the encryption policy
+	encryptionViolationsMu sync.RWMutex
+
+	volumeResizeErrors map[string]string // errors of the last resize of the persistent volumes
+	volumesStatus      []spec.VolumeStatus
+	volumesStatusMu    sync.RWMutex
+
+	versionUpgrade *spec.MajorVersionUpgradeStatus // progress of the last major version upgrade
+
+	lastAutoscaling time.Time // when the autoscaler changed the number of instances the last time
 }
 
 type compareStatefulsetResult struct {
@@ -113,11 +148,14 @@ func New(cfg Config, kubeClient k8sutil.KubernetesClient, pgSpec spec.Postgresql
 		deleteOptions:    &metav1.DeleteOptions{OrphanDependents: &orphanDependents},
 		podEventsQueue:   podEventsQueue,
 		KubeClient:       kubeClient,
+		volumeSnapshots:  make(map[string]string),
 	}
 	cluster.logger = logger.WithField("pkg", "cluster").WithField("cluster-name", cluster.clusterName())
-	cluster.teamsAPIClient = teams.NewTeamsAPI(cfg.OpConfig.TeamsAPIUrl, logger)
+	cluster.teamsAPIClient = teams.FromConfig(&cfg.OpConfig, kubeClient, logger)
 	cluster.oauthTokenGetter = NewSecretOauthTokenGetter(&kubeClient, cfg.OpConfig.OAuthTokenSecretName)
+	cluster.credentialsBackends = secretbackend.FromConfig(&cfg.OpConfig, kubeClient, cluster.logger)
 	cluster.patroni = patroni.New(cluster.logger)
+	cluster.alerts = alerts.New(cfg.OpConfig.WALArchiveAlertWebhook, cluster.logger)
 
 	return cluster
 }
@@ -187,10 +225,30 @@ func (c *Cluster) initUsers() error {
 		return fmt.Errorf("could not init robot users: %v", err)
 	}
 
+	if err := c.initDatabaseOwners(); err != nil {
+		return fmt.Errorf("could not init database owners: %v", err)
+	}
+
+	if err := c.initDatabaseAccessRoles(); err != nil {
+		return fmt.Errorf("could not init reader and writer roles of the databases: %v", err)
+	}
+
+	if err := c.initOwnerReaderRoles(); err != nil {
+		return fmt.Errorf("could not init reader roles of the database owners: %v", err)
+	}
+
+	if err := c.initPreparedDatabaseRoles(); err != nil {
+		return fmt.Errorf("could not init roles of the prepared databases: %v", err)
+	}
+
 	if err := c.initHumanUsers(); err != nil {
 		return fmt.Errorf("could not init human users: %v", err)
 	}
 
+	if err := c.initLDAPRoles(); err != nil {
+		return fmt.Errorf("could not init LDAP roles: %v", err)
+	}
+
 	return nil
 }
 
@@ -198,6 +256,16 @@ func (c *Cluster) initUsers() error {
 func (c *Cluster) Create() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+
+	// the adopted objects are reconciled by the sync instead of being created
+	if c.adoptionRequested() {
+		if err := c.adoptExistingResources(); err != nil {
+			c.setStatus(spec.ClusterStatusAddFailed)
+			return fmt.Errorf("could not adopt existing resources: %v", err)
+		}
+		return c.sync(&c.Postgresql)
+	}
+
 	var (
 		err error
 
@@ -208,7 +276,7 @@ func (c *Cluster) Create() error {
 
 	defer func() {
 		if err == nil {
-			c.setStatus(spec.ClusterStatusRunning) //TODO: are you sure it's running?
+			c.setStatus(c.runningStatus()) //TODO: are you sure it's running?
 		} else {
 			c.setStatus(spec.ClusterStatusAddFailed)
 		}
@@ -216,8 +284,37 @@ func (c *Cluster) Create() error {
 
 	c.setStatus(spec.ClusterStatusCreating)
 
+	renamedFrom, err := c.renamedFrom()
+	if err != nil {
+		return err
+	}
+	if err = c.validateVolumeSpec(nil, &c.Spec); err != nil {
+		c.recordEvent(v1.EventTypeWarning, constants.EventReasonInvalidVolumeSpec, "%v", err)
+		return fmt.Errorf("invalid volume specification: %v", err)
+	}
+	if err = c.validateBackupEncryption(&c.Spec); err != nil {
+		c.recordEvent(v1.EventTypeWarning, constants.EventReasonInvalidBackupEncryption, "%v", err)
+		return fmt.Errorf("invalid backup encryption: %v", err)
+	}
+	if err = c.resolveCloneBackup(); err != nil {
+		c.recordEvent(v1.EventTypeWarning, constants.EventReasonInvalidCloneTarget, "%v", err)
+		return fmt.Errorf("invalid clone backup: %v", err)
+	}
+	if err = c.authorizeClone(); err != nil {
+		c.recordEvent(v1.EventTypeWarning, constants.EventReasonCloneDenied, "%v", err)
+		return fmt.Errorf("clone not allowed: %v", err)
+	}
+	if err = c.authorizeStandby(); err != nil {
+		c.recordEvent(v1.EventTypeWarning, constants.EventReasonCloneDenied, "%v", err)
+		return fmt.Errorf("standby not allowed: %v", err)
+	}
+	if err = c.checkCloneTarget(); err != nil {
+		c.recordEvent(v1.EventTypeWarning, constants.EventReasonInvalidCloneTarget, "%v", err)
+		return fmt.Errorf("invalid clone target: %v", err)
+	}
+
 	for _, role := range []PostgresRole{Master, Replica} {
-		if role == Replica && !c.Spec.ReplicaLoadBalancer {
+		if role == Replica && !c.replicaServiceEnabled() {
 			continue
 		}
 		if c.Endpoints[role] != nil {
@@ -242,6 +339,14 @@ func (c *Cluster) Create() error {
 	if err = c.initUsers(); err != nil {
 		return err
 	}
+	if c.Spec.Clone.Snapshot != "" {
+		c.initSystemUsersFromClone()
+	}
+	if renamedFrom != nil {
+		if err = c.migrateRenamedCluster(*renamedFrom); err != nil {
+			return fmt.Errorf("could not migrate the renamed cluster %q: %v", renamedFrom, err)
+		}
+	}
 	c.logger.Infof("users have been initialized")
 
 	if err = c.syncSecrets(); err != nil {
@@ -249,6 +354,10 @@ func (c *Cluster) Create() error {
 	}
 	c.logger.Infof("secrets have been successfully created")
 
+	if err = c.syncSecretCopies(); err != nil {
+		c.logger.Warningf("could not copy secrets into other namespaces: %v", err)
+	}
+
 	if c.PodDisruptionBudget != nil {
 		return fmt.Errorf("pod disruption budget already exists in the cluster")
 	}
@@ -261,11 +370,40 @@ func (c *Cluster) Create() error {
 	if c.Statefulset != nil {
 		return fmt.Errorf("statefulset already exists in the cluster")
 	}
+	if c.OpConfig.RequireVolumeEncryption {
+		if err = c.checkStorageClassEncryption(); err != nil {
+			return fmt.Errorf("refusing to create cluster volumes: %v", err)
+		}
+	}
+	if err = c.adoptRetainedVolumeClaims(); err != nil {
+		return fmt.Errorf("could not adopt retained persistent volume claims: %v", err)
+	}
+	if c.Spec.Clone.Snapshot != "" {
+		if err = c.createVolumesFromSnapshotBackup(); err != nil {
+			return fmt.Errorf("could not create volumes from the snapshot backup: %v", err)
+		}
+	}
+	if err = c.ensureInstanceVolumeClaims(); err != nil {
+		return fmt.Errorf("could not create persistent volume claims with instance sizes: %v", err)
+	}
+	if c.usesCloneUser(&c.Spec.Clone) {
+		if err = c.createCloneUser(); err != nil {
+			return fmt.Errorf("could not create the user to clone the cluster %q with: %v", c.Spec.Clone.ClusterName, err)
+		}
+	}
+	if err = c.syncIAMServiceAccount(); err != nil {
+		return fmt.Errorf("could not create the service account with the IAM role: %v", err)
+	}
 	ss, err = c.createStatefulSet()
 	if err != nil {
 		return fmt.Errorf("could not create statefulset: %v", err)
 	}
 	c.logger.Infof("statefulset %q has been successfully created", util.NameFromMeta(ss.ObjectMeta))
+	if renamedFrom != nil {
+		if err := c.deleteRenamedClusterSecrets(*renamedFrom); err != nil {
+			c.logger.Warningf("could not delete secrets of the renamed cluster: %v", err)
+		}
+	}
 
 	c.logger.Info("waiting for the cluster being ready")
 
@@ -275,8 +413,9 @@ func (c *Cluster) Create() error {
 	}
 	c.logger.Infof("pods are ready")
 
-	// create database objects unless we are running without pods or disabled that feature explicitely
-	if !(c.databaseAccessDisabled() || c.getNumberOfInstances(&c.Spec) <= 0) {
+	// create database objects unless we are running without pods, disabled that feature explicitely or the cluster
+	// is a standby, which gets them from the source cluster
+	if !(c.databaseAccessDisabled() || c.getNumberOfInstances(&c.Spec) <= 0 || c.isStandbyCluster()) {
 		if err = c.createRoles(); err != nil {
 			return fmt.Errorf("could not create users: %v", err)
 		}
@@ -286,6 +425,27 @@ func (c *Cluster) Create() error {
 			return fmt.Errorf("could not sync databases: %v", err)
 		}
 		c.logger.Infof("databases have been successfully created")
+
+		if err = c.syncTablespaces(); err != nil {
+			return fmt.Errorf("could not sync tablespaces: %v", err)
+		}
+	}
+
+	// the WAL archived before the stanza exists is retried by Postgres until it does
+	if err := c.syncPgBackRest(); err != nil {
+		c.logger.Warningf("could not create the pgBackRest stanza: %v", err)
+	}
+
+	if c.Spec.EnableLogicalBackup {
+		if err := c.syncLogicalBackupJob(); err != nil {
+			return fmt.Errorf("could not create logical backup job: %v", err)
+		}
+	}
+
+	if c.Spec.BackupVerification != nil {
+		if err := c.syncBackupVerificationJob(); err != nil {
+			return fmt.Errorf("could not create backup verification job: %v", err)
+		}
 	}
 
 	if err := c.listResources(); err != nil {
@@ -309,7 +469,25 @@ func (c *Cluster) compareStatefulSetWith(statefulSet *v1beta1.StatefulSet) *comp
 		needsRollUpdate = true
 		reasons = append(reasons, "new statefulset's container specification doesn't match the current one")
 	} else {
-		needsRollUpdate, reasons = c.compareContainers(c.Statefulset, statefulSet)
+		needsRollUpdate, reasons = c.compareContainers("container", c.Statefulset.Spec.Template.Spec.Containers,
+			statefulSet.Spec.Template.Spec.Containers)
+		// the pg_hba rules are applied via the DCS, the pods keep running with the previous ones in their environment
+		for i, container := range c.Statefulset.Spec.Template.Spec.Containers {
+			env := statefulSet.Spec.Template.Spec.Containers[i].Env
+			if !reflect.DeepEqual(container.Env, env) && reflect.DeepEqual(envWithoutDynamicConfig(container.Env), envWithoutDynamicConfig(env)) {
+				match = false
+				reasons = append(reasons, fmt.Sprintf("new statefulset's container %d pg_hba rules don't match the current ones", i))
+			}
+		}
+	}
+	if len(c.Statefulset.Spec.Template.Spec.InitContainers) != len(statefulSet.Spec.Template.Spec.InitContainers) {
+		needsRollUpdate = true
+		reasons = append(reasons, "new statefulset's init container specification doesn't match the current one")
+	} else {
+		initRollUpdate, initReasons := c.compareContainers("init container", c.Statefulset.Spec.Template.Spec.InitContainers,
+			statefulSet.Spec.Template.Spec.InitContainers)
+		needsRollUpdate = needsRollUpdate || initRollUpdate
+		reasons = append(reasons, initReasons...)
 	}
 	if len(c.Statefulset.Spec.Template.Spec.Containers) == 0 {
 		c.logger.Warningf("statefulset %q has no container", util.NameFromMeta(c.Statefulset.ObjectMeta))
@@ -335,6 +513,18 @@ func (c *Cluster) compareStatefulSetWith(statefulSet *v1beta1.StatefulSet) *comp
 		needsRollUpdate = true
 		reasons = append(reasons, "new statefulset's pod affinity doesn't match the current one")
 	}
+	// the API server drops the empty list of tolerations
+	if (len(c.Statefulset.Spec.Template.Spec.Tolerations) != 0 || len(statefulSet.Spec.Template.Spec.Tolerations) != 0) &&
+		!reflect.DeepEqual(c.Statefulset.Spec.Template.Spec.Tolerations, statefulSet.Spec.Template.Spec.Tolerations) {
+		needsReplace = true
+		needsRollUpdate = true
+		reasons = append(reasons, "new statefulset's pod tolerations don't match the current one")
+	}
+	if !reflect.DeepEqual(c.Statefulset.Spec.Template.Spec.NodeSelector, statefulSet.Spec.Template.Spec.NodeSelector) {
+		needsReplace = true
+		needsRollUpdate = true
+		reasons = append(reasons, "new statefulset's node selector doesn't match the current one")
+	}
 
 	// Some generated fields like creationTimestamp make it not possible to use DeepCompare on Spec.Template.ObjectMeta
 	if !reflect.DeepEqual(c.Statefulset.Spec.Template.Labels, statefulSet.Spec.Template.Labels) {
@@ -342,16 +532,22 @@ func (c *Cluster) compareStatefulSetWith(statefulSet *v1beta1.StatefulSet) *comp
 		needsRollUpdate = true
 		reasons = append(reasons, "new statefulset's metadata labels doesn't match the current one")
 	}
+	// the annotations of the running pods are patched, so that they don't have to be recreated
 	if !reflect.DeepEqual(c.Statefulset.Spec.Template.Annotations, statefulSet.Spec.Template.Annotations) {
-		needsRollUpdate = true
 		needsReplace = true
 		reasons = append(reasons, "new statefulset's metadata annotations doesn't match the current one")
 	}
+	for _, extension := range podSpecExtensions {
+		if c.Statefulset.Annotations[extension.annotation] != statefulSet.Annotations[extension.annotation] {
+			needsRollUpdate = true
+			reasons = append(reasons, fmt.Sprintf("new statefulset's pod %s doesn't match the current one", extension.field))
+		}
+	}
 	if len(c.Statefulset.Spec.VolumeClaimTemplates) != len(statefulSet.Spec.VolumeClaimTemplates) {
 		needsReplace = true
 		reasons = append(reasons, "new statefulset's volumeClaimTemplates contains different number of volumes to the old one")
 	}
-	for i := 0; i < len(c.Statefulset.Spec.VolumeClaimTemplates); i++ {
+	for i := 0; i < len(c.Statefulset.Spec.VolumeClaimTemplates) && i < len(statefulSet.Spec.VolumeClaimTemplates); i++ {
 		name := c.Statefulset.Spec.VolumeClaimTemplates[i].Name
 		// Some generated fields like creationTimestamp make it not possible to use DeepCompare on ObjectMeta
 		if name != statefulSet.Spec.VolumeClaimTemplates[i].Name {
@@ -363,6 +559,10 @@ func (c *Cluster) compareStatefulSetWith(statefulSet *v1beta1.StatefulSet) *comp
 			needsReplace = true
 			reasons = append(reasons, fmt.Sprintf("new statefulset's annotations for volume %q doesn't match the current one", name))
 		}
+		if !reflect.DeepEqual(c.Statefulset.Spec.VolumeClaimTemplates[i].Labels, statefulSet.Spec.VolumeClaimTemplates[i].Labels) {
+			needsReplace = true
+			reasons = append(reasons, fmt.Sprintf("new statefulset's labels for volume %q doesn't match the current one", name))
+		}
 		if !reflect.DeepEqual(c.Statefulset.Spec.VolumeClaimTemplates[i].Spec, statefulSet.Spec.VolumeClaimTemplates[i].Spec) {
 			name := c.Statefulset.Spec.VolumeClaimTemplates[i].Name
 			needsReplace = true
@@ -388,34 +588,42 @@ func NewCheck(msg string, cond ContainerCondition) ContainerCheck {
 	return ContainerCheck{reason: msg, condition: cond}
 }
 
-// compareContainers: compare containers from two stateful sets
+// compareContainers: compare containers or init containers from two stateful sets
 // and return:
 // * whether or not roll update is needed
 // * a list of reasons in a human readable format
-func (c *Cluster) compareContainers(setA, setB *v1beta1.StatefulSet) (bool, []string) {
+func (c *Cluster) compareContainers(description string, setA, setB []v1.Container) (bool, []string) {
 	reasons := make([]string, 0)
 	needsRollUpdate := false
 	checks := []ContainerCheck{
-		NewCheck("new statefulset's container %d name doesn't match the current one",
+		NewCheck("new statefulset's %s %d name doesn't match the current one",
 			func(a, b v1.Container) bool { return a.Name != b.Name }),
-		NewCheck("new statefulset's container %d image doesn't match the current one",
+		NewCheck("new statefulset's %s %d image doesn't match the current one",
 			func(a, b v1.Container) bool { return a.Image != b.Image }),
-		NewCheck("new statefulset's container %d ports don't match the current one",
+		NewCheck("new statefulset's %s %d command doesn't match the current one",
+			func(a, b v1.Container) bool { return !reflect.DeepEqual(a.Command, b.Command) }),
+		NewCheck("new statefulset's %s %d arguments don't match the current ones",
+			func(a, b v1.Container) bool { return !reflect.DeepEqual(a.Args, b.Args) }),
+		NewCheck("new statefulset's %s %d ports don't match the current one",
 			func(a, b v1.Container) bool { return !reflect.DeepEqual(a.Ports, b.Ports) }),
-		NewCheck("new statefulset's container %d resources don't match the current ones",
+		NewCheck("new statefulset's %s %d resources don't match the current ones",
 			func(a, b v1.Container) bool { return !compareResources(&a.Resources, &b.Resources) }),
-		NewCheck("new statefulset's container %d environment doesn't match the current one",
-			func(a, b v1.Container) bool { return !reflect.DeepEqual(a.Env, b.Env) }),
-		NewCheck("new statefulset's container %d environment sources don't match the current one",
+		NewCheck("new statefulset's %s %d environment doesn't match the current one",
+			func(a, b v1.Container) bool {
+				return !reflect.DeepEqual(envWithoutDynamicConfig(a.Env), envWithoutDynamicConfig(b.Env))
+			}),
+		NewCheck("new statefulset's %s %d environment sources don't match the current one",
 			func(a, b v1.Container) bool { return !reflect.DeepEqual(a.EnvFrom, b.EnvFrom) }),
+		NewCheck("new statefulset's %s %d volume mounts don't match the current ones",
+			func(a, b v1.Container) bool { return !reflect.DeepEqual(a.VolumeMounts, b.VolumeMounts) }),
 	}
 
-	for index, containerA := range setA.Spec.Template.Spec.Containers {
-		containerB := setB.Spec.Template.Spec.Containers[index]
+	for index, containerA := range setA {
+		containerB := setB[index]
 		for _, check := range checks {
 			if check.condition(containerA, containerB) {
 				needsRollUpdate = true
-				reasons = append(reasons, fmt.Sprintf(check.reason, index))
+				reasons = append(reasons, fmt.Sprintf(check.reason, description, index))
 			}
 		}
 	}
@@ -453,6 +661,13 @@ func compareResoucesAssumeFirstNotNil(a *v1.ResourceRequirements, b *v1.Resource
 
 }
 
+// userSpecChanged checks if the manifests define different roles, including the owners of the databases and the
+// access roles of the prepared ones.
+func userSpecChanged(oldSpec, newSpec *spec.PostgresSpec) bool {
+	return !reflect.DeepEqual(oldSpec.Users, newSpec.Users) || !reflect.DeepEqual(oldSpec.Databases, newSpec.Databases) ||
+		!reflect.DeepEqual(oldSpec.PreparedDatabases, newSpec.PreparedDatabases)
+}
+
 // Update changes Kubernetes objects according to the new specification. Unlike the sync case, the missing object.
 // (i.e. service) is treated as an error.
 func (c *Cluster) Update(oldSpec, newSpec *spec.Postgresql) error {
@@ -462,26 +677,60 @@ func (c *Cluster) Update(oldSpec, newSpec *spec.Postgresql) error {
 	defer c.mu.Unlock()
 
 	c.setStatus(spec.ClusterStatusUpdating)
+
+	if err := c.validateVolumeSpec(&oldSpec.Spec, &newSpec.Spec); err != nil {
+		c.logger.Errorf("rejecting the update: %v", err)
+		c.recordEvent(v1.EventTypeWarning, constants.EventReasonInvalidVolumeSpec, "update rejected: %v", err)
+		c.setStatus(spec.ClusterStatusUpdateFailed)
+		return fmt.Errorf("invalid volume specification: %v", err)
+	}
+	err := c.validateBackupEncryption(&newSpec.Spec)
+	if err == nil {
+		err = c.validateBackupEncryptionChange(&oldSpec.Spec, &newSpec.Spec)
+	}
+	if err != nil {
+		c.logger.Errorf("rejecting the update: %v", err)
+		c.recordEvent(v1.EventTypeWarning, constants.EventReasonInvalidBackupEncryption, "update rejected: %v", err)
+		c.setStatus(spec.ClusterStatusUpdateFailed)
+		return fmt.Errorf("invalid backup encryption: %v", err)
+	}
+
 	c.setSpec(newSpec)
 
 	defer func() {
 		if updateFailed {
 			c.setStatus(spec.ClusterStatusUpdateFailed)
-		} else if c.Status != spec.ClusterStatusRunning {
-			c.setStatus(spec.ClusterStatusRunning)
+		} else if c.Status != c.runningStatus() {
+			c.setStatus(c.runningStatus())
 		}
 	}()
 
-	if oldSpec.Spec.PgVersion != newSpec.Spec.PgVersion { // PG versions comparison
-		c.logger.Warningf("postgresql version change(%q -> %q) has no effect", oldSpec.Spec.PgVersion, newSpec.Spec.PgVersion)
-		//we need that hack to generate statefulset with the old version
-		newSpec.Spec.PgVersion = oldSpec.Spec.PgVersion
+	if oldSpec.Spec.PgVersion != newSpec.Spec.PgVersion || // PG versions comparison
+		!reflect.DeepEqual(oldSpec.Spec.MajorUpgrade, newSpec.Spec.MajorUpgrade) {
+		c.logger.Infof("postgresql version change (%q -> %q)", oldSpec.Spec.PgVersion, newSpec.Spec.PgVersion)
+		// a new manifest retries the failed upgrade
+		c.clearVersionUpgradeStatus()
+		if err := c.syncMajorVersion(); err != nil {
+			c.logger.Errorf("could not upgrade postgresql version: %v", err)
+			updateFailed = true
+		}
+		//we need that hack to generate statefulset with the version that is actually running
+		newSpec.Spec.PgVersion = c.Spec.PgVersion
+	}
+
+	promoteStandby := c.checkStandbyChange(&oldSpec.Spec, &newSpec.Spec)
+	if promoteStandby && !c.promotionPending() {
+		if err := c.startPromotion(oldSpec.Spec.StandbyCluster); err != nil {
+			c.logger.Errorf("could not promote the standby cluster: %v", err)
+			updateFailed = true
+		}
 	}
 
 	// Service
 	if !reflect.DeepEqual(c.generateService(Master, &oldSpec.Spec), c.generateService(Master, &newSpec.Spec)) ||
 		!reflect.DeepEqual(c.generateService(Replica, &oldSpec.Spec), c.generateService(Replica, &newSpec.Spec)) ||
-		oldSpec.Spec.ReplicaLoadBalancer != newSpec.Spec.ReplicaLoadBalancer {
+		oldSpec.Spec.ReplicaLoadBalancer != newSpec.Spec.ReplicaLoadBalancer ||
+		oldSpec.Spec.Hibernated != newSpec.Spec.Hibernated {
 		c.logger.Debugf("syncing services")
 		if err := c.syncServices(); err != nil {
 			c.logger.Errorf("could not sync services: %v", err)
@@ -489,7 +738,7 @@ func (c *Cluster) Update(oldSpec, newSpec *spec.Postgresql) error {
 		}
 	}
 
-	if !reflect.DeepEqual(oldSpec.Spec.Users, newSpec.Spec.Users) {
+	if userSpecChanged(&oldSpec.Spec, &newSpec.Spec) {
 		c.logger.Debugf("syncing secrets")
 		if err := c.initUsers(); err != nil {
 			c.logger.Errorf("could not init users: %v", err)
@@ -505,10 +754,35 @@ func (c *Cluster) Update(oldSpec, newSpec *spec.Postgresql) error {
 		}
 	}
 
+	// the policy is applied with the roles below, or by the next sync while the database is not accessible
+	if !reflect.DeepEqual(oldSpec.Spec.Users, newSpec.Spec.Users) {
+		c.recordRemovedUsers(oldSpec.Spec.Users, newSpec.Spec.Users)
+	}
+
+	if userSpecChanged(&oldSpec.Spec, &newSpec.Spec) ||
+		!reflect.DeepEqual(oldSpec.Spec.SecretNamespaces, newSpec.Spec.SecretNamespaces) {
+		c.logger.Debugf("syncing copies of the secrets")
+		if err := c.deleteSecretCopies(oldSpec.Spec.SecretNamespaces, newSpec.Spec.SecretNamespaces); err != nil {
+			c.logger.Errorf("could not delete copies of the secrets: %v", err)
+			updateFailed = true
+		}
+		if err := c.syncSecretCopies(); err != nil {
+			c.logger.Errorf("could not sync copies of the secrets: %v", err)
+			updateFailed = true
+		}
+	}
+
 	// Volume
-	if oldSpec.Spec.Size != newSpec.Spec.Size {
+	if !reflect.DeepEqual(oldSpec.Spec.Volume, newSpec.Spec.Volume) || !reflect.DeepEqual(oldSpec.Spec.WALVolume, newSpec.Spec.WALVolume) ||
+		!reflect.DeepEqual(oldSpec.Spec.Tablespaces, newSpec.Spec.Tablespaces) {
 		c.logger.Debugf("syncing persistent volumes")
 		c.logVolumeChanges(oldSpec.Spec.Volume, newSpec.Spec.Volume)
+		if !reflect.DeepEqual(oldSpec.Spec.WALVolume, newSpec.Spec.WALVolume) {
+			c.logVolumeChanges(oldSpec.Spec.WALVolume, newSpec.Spec.WALVolume)
+		}
+		if !reflect.DeepEqual(oldSpec.Spec.Tablespaces, newSpec.Spec.Tablespaces) {
+			c.logVolumeChanges(oldSpec.Spec.Tablespaces, newSpec.Spec.Tablespaces)
+		}
 
 		if err := c.syncVolumes(); err != nil {
 			c.logger.Errorf("could not sync persistent volumes: %v", err)
@@ -516,6 +790,13 @@ func (c *Cluster) Update(oldSpec, newSpec *spec.Postgresql) error {
 		}
 	}
 
+	if oldSpec.Spec.IAMRole != newSpec.Spec.IAMRole {
+		if err := c.syncIAMServiceAccount(); err != nil {
+			c.logger.Errorf("could not sync the service account with the IAM role: %v", err)
+			updateFailed = true
+		}
+	}
+
 	// Statefulset
 	func() {
 		oldSs, err := c.generateStatefulSet(&oldSpec.Spec)
@@ -535,26 +816,99 @@ func (c *Cluster) Update(oldSpec, newSpec *spec.Postgresql) error {
 		if !reflect.DeepEqual(oldSs, newSs) {
 			c.logger.Debugf("syncing statefulsets")
 			// TODO: avoid generating the StatefulSet object twice by passing it to syncStatefulSet
+			if err := c.ensureInstanceVolumeClaims(); err != nil {
+				c.logger.Errorf("could not create persistent volume claims with instance sizes: %v", err)
+				updateFailed = true
+				return
+			}
 			if err := c.syncStatefulSet(); err != nil {
 				c.logger.Errorf("could not sync statefulsets: %v", err)
 				updateFailed = true
 			}
 		}
+
+		if !reflect.DeepEqual(oldSpec.Spec.Patroni.PgHba, newSpec.Spec.Patroni.PgHba) ||
+			!reflect.DeepEqual(oldSpec.Spec.LDAP, newSpec.Spec.LDAP) {
+			c.logger.Infof("syncing pg_hba rules")
+			if err := c.syncPgHba(); err != nil {
+				c.logger.Errorf("could not sync pg_hba rules: %v", err)
+				updateFailed = true
+			}
+		}
+
+		if oldSpec.Spec.Patroni.SynchronousMode != newSpec.Spec.Patroni.SynchronousMode ||
+			oldSpec.Spec.Patroni.SynchronousModeStrict != newSpec.Spec.Patroni.SynchronousModeStrict ||
+			oldSpec.Spec.Patroni.SynchronousNodeCount != newSpec.Spec.Patroni.SynchronousNodeCount {
+			c.logger.Infof("syncing synchronous replication")
+			if err := c.syncSynchronousMode(); err != nil {
+				c.logger.Errorf("could not sync synchronous replication: %v", err)
+				updateFailed = true
+			}
+		}
+
+		if !reflect.DeepEqual(oldSpec.Spec.Patroni.DCS, newSpec.Spec.Patroni.DCS) {
+			c.logger.Infof("syncing Patroni settings")
+			if err := c.syncPatroniDCS(); err != nil {
+				c.logger.Errorf("could not sync Patroni settings: %v", err)
+				updateFailed = true
+			}
+		}
+
+		// the pod disruption budget of a stopped cluster has no minimum
+		if c.getNumberOfInstances(&oldSpec.Spec) != c.getNumberOfInstances(&newSpec.Spec) {
+			if err := c.syncPodDisruptionBudget(true); err != nil {
+				c.logger.Errorf("could not sync pod disruption budget: %v", err)
+				updateFailed = true
+			}
+		}
+
+		if oldSpec.Spec.EnableLogicalBackup != newSpec.Spec.EnableLogicalBackup ||
+			oldSpec.Spec.LogicalBackupSchedule != newSpec.Spec.LogicalBackupSchedule ||
+			!reflect.DeepEqual(oldSpec.Spec.LogicalBackupDatabases, newSpec.Spec.LogicalBackupDatabases) {
+			if err := c.syncLogicalBackupJob(); err != nil {
+				c.logger.Errorf("could not sync logical backup job: %v", err)
+				updateFailed = true
+			}
+		}
+
+		if !reflect.DeepEqual(oldSpec.Spec.BackupVerification, newSpec.Spec.BackupVerification) {
+			if err := c.syncBackupVerificationJob(); err != nil {
+				c.logger.Errorf("could not sync backup verification job: %v", err)
+				updateFailed = true
+			}
+		}
 	}()
 
-	// Roles and Databases
-	if !(c.databaseAccessDisabled() || c.getNumberOfInstances(&c.Spec) <= 0) {
+	// Roles and Databases; the promoted standby accepts writes only after a while, the next sync takes care of them
+	if !(c.databaseAccessDisabled() || c.getNumberOfInstances(&c.Spec) <= 0 || c.isStandbyCluster() || c.promotionPending()) {
 		c.logger.Debugf("syncing roles")
 		if err := c.syncRoles(); err != nil {
 			c.logger.Errorf("could not sync roles: %v", err)
 			updateFailed = true
 		}
-		if !reflect.DeepEqual(oldSpec.Spec.Databases, newSpec.Spec.Databases) {
+		c.logger.Debugf("syncing removed users")
+		if err := c.syncRemovedUsers(); err != nil {
+			c.logger.Errorf("could not handle removed users: %v", err)
+			updateFailed = true
+		}
+		if !reflect.DeepEqual(oldSpec.Spec.Databases, newSpec.Spec.Databases) ||
+			!reflect.DeepEqual(oldSpec.Spec.PreparedDatabases, newSpec.Spec.PreparedDatabases) {
 			c.logger.Infof("syncing databases")
 			if err := c.syncDatabases(); err != nil {
 				c.logger.Errorf("could not sync databases: %v", err)
 				updateFailed = true
 			}
+			if err := c.dropRemovedDatabases(oldSpec.Spec.Databases, newSpec.Spec.Databases); err != nil {
+				c.logger.Errorf("could not drop databases: %v", err)
+				updateFailed = true
+			}
+		}
+		if !reflect.DeepEqual(oldSpec.Spec.Tablespaces, newSpec.Spec.Tablespaces) {
+			c.logger.Infof("syncing tablespaces")
+			if err := c.syncTablespaces(); err != nil {
+				c.logger.Errorf("could not sync tablespaces: %v", err)
+				updateFailed = true
+			}
 		}
 	}
 
@@ -584,12 +938,35 @@ func (c *Cluster) Delete() error {
 		}
 	}
 
+	if err := c.deleteSecretCopies(c.Spec.SecretNamespaces, nil); err != nil {
+		return fmt.Errorf("could not delete copies of the secrets: %v", err)
+	}
+
 	if err := c.deletePodDisruptionBudget(); err != nil {
 		return fmt.Errorf("could not delete pod disruption budget: %v", err)
 	}
 
+	if err := c.deleteLogicalBackupJob(); err != nil {
+		return fmt.Errorf("could not delete logical backup job: %v", err)
+	}
+
+	if err := c.deleteBackupVerificationJob(); err != nil {
+		return fmt.Errorf("could not delete backup verification job: %v", err)
+	}
+
+	if err := c.deleteIAMServiceAccount(); err != nil {
+		c.logger.Warningf("%v", err)
+	}
+
+	if err := c.deleteLogicalBackupRequestJob(); err != nil {
+		return err
+	}
+	if err := c.releaseBackupObjects(); err != nil {
+		c.logger.Warningf("could not release the backup objects: %v", err)
+	}
+
 	for _, role := range []PostgresRole{Master, Replica} {
-		if role == Replica && !c.Spec.ReplicaLoadBalancer {
+		if role == Replica && !c.replicaServiceEnabled() {
 			continue
 		}
 
@@ -606,6 +983,12 @@ func (c *Cluster) Delete() error {
 		return fmt.Errorf("could not remove leftover patroni objects; %v", err)
 	}
 
+	if c.usesCloneUser(&c.Spec.Clone) {
+		if err := c.deleteCloneUser(); err != nil {
+			c.logger.Warningf("could not remove the clone user: %v", err)
+		}
+	}
+
 	return nil
 }
 
@@ -678,11 +1061,14 @@ func (c *Cluster) initRobotUsers() error {
 		if err != nil {
 			return fmt.Errorf("invalid flags for user %q: %v", username, err)
 		}
+		roles, exclusive := c.Spec.UserRoles[username]
 		if _, present := c.pgUsers[username]; !present {
 			c.pgUsers[username] = spec.PgUser{
-				Name:     username,
-				Password: util.RandomPassword(constants.PasswordLength),
-				Flags:    flags,
+				Name:              username,
+				Password:          util.RandomPassword(constants.PasswordLength),
+				Flags:             flags,
+				MemberOf:          roles,
+				ExclusiveMemberOf: exclusive,
 			}
 		} else {
 			// avoid overwriting the password if the user is already there. The flags should be
@@ -691,6 +1077,10 @@ func (c *Cluster) initRobotUsers() error {
 			c.logger.Debugf("merging manifest and infrastructure user %q data", username)
 			user := c.pgUsers[username]
 			user.Flags = flags
+			if addRoles, equal := util.SubstractStringSlices(roles, user.MemberOf); !equal {
+				user.MemberOf = append(user.MemberOf, addRoles...)
+			}
+			user.ExclusiveMemberOf = exclusive
 			c.pgUsers[username] = user
 		}
 	}
@@ -698,8 +1088,31 @@ func (c *Cluster) initRobotUsers() error {
 	return nil
 }
 
+// initDatabaseOwners adds the owners of the databases in the manifest that are not declared as users as login
+// roles, so that the databases can be created with them.
+func (c *Cluster) initDatabaseOwners() error {
+	for datname, owner := range c.Spec.Databases {
+		if _, present := c.pgUsers[owner]; present {
+			continue
+		}
+		if !isValidUsername(owner) {
+			return fmt.Errorf("invalid owner %q of the database %q", owner, datname)
+		}
+		if c.shouldAvoidProtectedOrSystemRole(owner, "database owner") {
+			continue
+		}
+		c.pgUsers[owner] = spec.PgUser{
+			Name:     owner,
+			Password: util.RandomPassword(constants.PasswordLength),
+			Flags:    []string{constants.RoleFlagLogin},
+		}
+	}
+
+	return nil
+}
+
 func (c *Cluster) initHumanUsers() error {
-	teamMembers, err := c.getTeamMembers()
+	teamMembers, err := c.getTeamMembers(c.Spec.TeamID)
 	if err != nil {
 		return fmt.Errorf("could not get list of team members: %v", err)
 	}
@@ -730,6 +1143,44 @@ func (c *Cluster) initHumanUsers() error {
 		}
 	}
 
+	return c.initSuperuserTeamMembers()
+}
+
+// initSuperuserTeamMembers adds the members of the superuser teams to every cluster, regardless of its team. They
+// become superusers, or members of the configured roles instead, overriding the role they may have from the team of
+// the cluster.
+func (c *Cluster) initSuperuserTeamMembers() error {
+	for _, teamID := range c.OpConfig.SuperuserTeams {
+		teamMembers, err := c.getTeamMembers(teamID)
+		if err != nil {
+			return fmt.Errorf("could not get list of members of the superuser team %q: %v", teamID, err)
+		}
+		for _, username := range teamMembers {
+			flags := []string{constants.RoleFlagLogin}
+			memberOf := []string{c.OpConfig.PamRoleName}
+
+			if c.shouldAvoidProtectedOrSystemRole(username, "superuser team role") {
+				continue
+			}
+			if len(c.OpConfig.SuperuserTeamsMemberOf) > 0 {
+				memberOf = append(memberOf, c.OpConfig.SuperuserTeamsMemberOf...)
+			} else {
+				flags = append(flags, constants.RoleFlagSuperuser)
+			}
+
+			if user, present := c.pgUsers[username]; present && !util.SliceContains(user.MemberOf, c.OpConfig.PamRoleName) {
+				c.logger.Warnf("overwriting existing user %q with the data from the superuser team %q", username, teamID)
+			}
+
+			c.pgUsers[username] = spec.PgUser{
+				Name:       username,
+				Flags:      flags,
+				MemberOf:   memberOf,
+				Parameters: c.OpConfig.TeamAPIRoleConfiguration,
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -787,8 +1238,13 @@ func (c *Cluster) GetStatus() *spec.ClusterStatus {
 		StatefulSet:         c.GetStatefulSet(),
 		PodDisruptionBudget: c.GetPodDisruptionBudget(),
 		CurrentProcess:      c.GetCurrentProcess(),
+		VolumeSnapshots:     c.GetVolumeSnapshots(),
+		SnapshotBackups:     c.GetSnapshotBackups(),
+		BaseBackups:         c.GetBaseBackups(),
 
-		Error: c.Error,
+		EncryptionViolations: c.GetEncryptionViolations(),
+		Volumes:              c.GetVolumesStatus(),
+		Error:                c.Error,
 	}
 }
 
@@ -838,6 +1294,19 @@ func (c *Cluster) Unlock() {
 	c.mu.Unlock()
 }
 
+// MarkPaused flags the cluster as paused, keeping the objects as they are until the manifest resumes it.
+func (c *Cluster) MarkPaused() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.specMu.Lock()
+	c.Spec.Paused = true
+	c.specMu.Unlock()
+	if c.Status != spec.ClusterStatusPaused {
+		c.setStatus(spec.ClusterStatusPaused)
+	}
+}
+
 func (c *Cluster) shouldDeleteSecret(secret *v1.Secret) (delete bool, userName string) {
 	secretUser := string(secret.Data["username"])
 	return (secretUser != c.OpConfig.ReplicationUsername && secretUser != c.OpConfig.SuperUsername), secretUser
@@ -27,6 +27,7 @@ func TestInitRobotUsers(t *testing.T) {
 	testName := "TestInitRobotUsers"
 	tests := []struct {
 		manifestUsers map[string]spec.UserFlags
+		userRoles     map[string][]string
 		infraRoles    map[string]spec.PgUser
 		result        map[string]spec.PgUser
 		err           error
@@ -57,6 +58,38 @@ func TestInitRobotUsers(t *testing.T) {
 			err: fmt.Errorf(`invalid flags for user "foobar": ` +
 				`conflicting user flags: "NOINHERIT" and "INHERIT"`),
 		},
+		{
+			manifestUsers: map[string]spec.UserFlags{"foo": {"replication", "connection limit 10", "Valid Until 2030-01-01"}},
+			infraRoles:    map[string]spec.PgUser{"foo": {Name: "foo", Password: "bar"}},
+			result: map[string]spec.PgUser{"foo": {Name: "foo", Password: "bar",
+				Flags: []string{"CONNECTION LIMIT 10", "LOGIN", "REPLICATION", "VALID UNTIL '2030-01-01T00:00:00Z'"}}},
+			err: nil,
+		},
+		{
+			manifestUsers: map[string]spec.UserFlags{"foo": {"nobypassrls", "valid until infinity"}},
+			infraRoles:    map[string]spec.PgUser{"foo": {Name: "foo", Password: "bar"}},
+			result: map[string]spec.PgUser{"foo": {Name: "foo", Password: "bar",
+				Flags: []string{"LOGIN", "NOBYPASSRLS", "VALID UNTIL 'infinity'"}}},
+			err: nil,
+		},
+		{
+			manifestUsers: map[string]spec.UserFlags{"foobar": {"connection limit 5", "connection limit 10"}},
+			err: fmt.Errorf(`invalid flags for user "foobar": ` +
+				`conflicting user flags: "CONNECTION LIMIT 5" and "CONNECTION LIMIT 10"`),
+		},
+		{
+			manifestUsers: map[string]spec.UserFlags{"foobar": {"valid until tomorrow"}},
+			err: fmt.Errorf(`invalid flags for user "foobar": ` +
+				`user flag "valid until tomorrow" is not valid: invalid expiration time "tomorrow", expected RFC 3339 or YYYY-MM-DD`),
+		},
+		{
+			manifestUsers: map[string]spec.UserFlags{"foo": {}},
+			userRoles:     map[string][]string{"foo": {"readonly", "monitoring"}},
+			infraRoles:    map[string]spec.PgUser{"foo": {Name: "foo", Password: "bar", MemberOf: []string{"readonly"}}},
+			result: map[string]spec.PgUser{"foo": {Name: "foo", Password: "bar", Flags: []string{"LOGIN"},
+				MemberOf: []string{"readonly", "monitoring"}, ExclusiveMemberOf: true}},
+			err: nil,
+		},
 		{
 			manifestUsers: map[string]spec.UserFlags{"admin": {"superuser"}, superUserName: {"createdb"}},
 			infraRoles:    map[string]spec.PgUser{},
@@ -66,6 +99,7 @@ func TestInitRobotUsers(t *testing.T) {
 	}
 	for _, tt := range tests {
 		cl.Spec.Users = tt.manifestUsers
+		cl.Spec.UserRoles = tt.userRoles
 		cl.pgUsers = tt.infraRoles
 		if err := cl.initRobotUsers(); err != nil {
 			if tt.err == nil {
@@ -145,6 +179,90 @@ func TestInitHumanUsers(t *testing.T) {
 	}
 }
 
+type mockTeamsAPIClientByTeam struct {
+	members map[string][]string
+}
+
+func (m *mockTeamsAPIClientByTeam) TeamInfo(teamID, token string) (tm *teams.Team, err error) {
+	return &teams.Team{Members: m.members[teamID]}, nil
+}
+
+func TestInitSuperuserTeamMembers(t *testing.T) {
+	testName := "TestInitSuperuserTeamMembers"
+	c := New(Config{OpConfig: config.Config{ProtectedRoles: []string{"admin"},
+		Auth: config.Auth{SuperUsername: superUserName, ReplicationUsername: replicationUserName,
+			PamRoleName: "zalandos"},
+		EnableTeamsAPI: true, TeamAdminRole: "admin", SuperuserTeams: []string{"dba"}}},
+		k8sutil.KubernetesClient{}, spec.Postgresql{}, logger)
+	c.oauthTokenGetter = &mockOAuthTokenGetter{}
+	c.teamsAPIClient = &mockTeamsAPIClientByTeam{members: map[string][]string{
+		"test": {"foo", "bar"},
+		"dba":  {"bar", "baz", superUserName},
+	}}
+	c.Spec.TeamID = "test"
+
+	tests := []struct {
+		memberOf []string
+		result   map[string]spec.PgUser
+	}{
+		{
+			result: map[string]spec.PgUser{
+				"foo": {Name: "foo", Flags: []string{"LOGIN"}, MemberOf: []string{"zalandos", "admin"}},
+				"bar": {Name: "bar", Flags: []string{"LOGIN", "SUPERUSER"}, MemberOf: []string{"zalandos"}},
+				"baz": {Name: "baz", Flags: []string{"LOGIN", "SUPERUSER"}, MemberOf: []string{"zalandos"}},
+			},
+		},
+		{
+			memberOf: []string{"oncall"},
+			result: map[string]spec.PgUser{
+				"foo": {Name: "foo", Flags: []string{"LOGIN"}, MemberOf: []string{"zalandos", "admin"}},
+				"bar": {Name: "bar", Flags: []string{"LOGIN"}, MemberOf: []string{"zalandos", "oncall"}},
+				"baz": {Name: "baz", Flags: []string{"LOGIN"}, MemberOf: []string{"zalandos", "oncall"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		c.pgUsers = map[string]spec.PgUser{}
+		c.OpConfig.SuperuserTeamsMemberOf = tt.memberOf
+		if err := c.initHumanUsers(); err != nil {
+			t.Errorf("%s got an unexpected error %v", testName, err)
+		}
+		if !reflect.DeepEqual(c.pgUsers, tt.result) {
+			t.Errorf("%s with member of %v expects %#v, got %#v", testName, tt.memberOf, tt.result, c.pgUsers)
+		}
+	}
+}
+
+func TestFormerSuperuserPrivileges(t *testing.T) {
+	testName := "TestFormerSuperuserPrivileges"
+	c := New(Config{OpConfig: config.Config{ProtectedRoles: []string{"admin"}, SuperuserTeamsMemberOf: []string{"oncall"}}},
+		k8sutil.KubernetesClient{}, spec.Postgresql{}, logger)
+	c.pgUsers = map[string]spec.PgUser{
+		"foo": {Name: "foo", Flags: []string{"LOGIN"}, MemberOf: []string{"zalandos"}},
+		"bar": {Name: "bar", Flags: []string{"LOGIN", "SUPERUSER"}, MemberOf: []string{"zalandos", "oncall"}},
+	}
+	roles := []humanRole{
+		{name: "foo", superuser: true, memberOf: []string{"zalandos", "oncall"}},
+		{name: "bar", superuser: true, memberOf: []string{"zalandos", "oncall"}},
+		{name: "baz", superuser: true, memberOf: []string{"zalandos", "oncall", "other"}},
+		{name: "qux", memberOf: []string{"zalandos"}},
+		{name: "admin", superuser: true, memberOf: []string{"zalandos"}},
+	}
+
+	nosuperuser, revoke := c.formerSuperuserPrivileges(roles)
+	if expected := []string{"foo", "baz"}; !reflect.DeepEqual(nosuperuser, expected) {
+		t.Errorf("%s expected to revoke the superuser flag of %v, got %v", testName, expected, nosuperuser)
+	}
+	expected := []spec.PgSyncUserRequest{
+		{Kind: spec.PGSyncUserRevoke, User: spec.PgUser{Name: "foo", MemberOf: []string{"oncall"}}},
+		{Kind: spec.PGSyncUserRevoke, User: spec.PgUser{Name: "baz", MemberOf: []string{"oncall"}}},
+	}
+	if !reflect.DeepEqual(revoke, expected) {
+		t.Errorf("%s expected to revoke %#v, got %#v", testName, expected, revoke)
+	}
+}
+
 func TestShouldDeleteSecret(t *testing.T) {
 	testName := "TestShouldDeleteSecret"
 
@@ -174,3 +292,90 @@ func TestShouldDeleteSecret(t *testing.T) {
 		}
 	}
 }
+
+func TestInitDatabaseAccessRoles(t *testing.T) {
+	testName := "TestInitDatabaseAccessRoles"
+	c := New(Config{OpConfig: config.Config{EnableDefaultPrivileges: true,
+		Auth: config.Auth{SuperUsername: superUserName, ReplicationUsername: replicationUserName}}},
+		k8sutil.KubernetesClient{}, spec.Postgresql{}, logger)
+	c.Spec.Databases = map[string]string{"foo": "zalando", "bar": "zalando"}
+	c.Spec.PreparedDatabases = map[string]spec.PreparedDatabase{"bar": {}}
+	c.pgUsers = map[string]spec.PgUser{"foo_reader": {Name: "foo_reader", Flags: []string{"LOGIN"}}}
+
+	if err := c.initDatabaseAccessRoles(); err != nil {
+		t.Fatalf("%s got an unexpected error: %v", testName, err)
+	}
+	expected := map[string]spec.PgUser{
+		"foo_reader": {Name: "foo_reader", Flags: []string{"LOGIN"}},
+		"foo_writer": {Name: "foo_writer", Flags: []string{}, MemberOf: []string{"foo_reader"}},
+	}
+	if !reflect.DeepEqual(c.pgUsers, expected) {
+		t.Errorf("%s expected: %#v, got %#v", testName, expected, c.pgUsers)
+	}
+}
+
+func TestInitOwnerReaderRoles(t *testing.T) {
+	testName := "TestInitOwnerReaderRoles"
+	c := New(Config{OpConfig: config.Config{EnableDefaultPrivileges: true, EnableOwnerReaderRoles: true,
+		Auth: config.Auth{SuperUsername: superUserName, ReplicationUsername: replicationUserName}}},
+		k8sutil.KubernetesClient{}, spec.Postgresql{}, logger)
+	c.Spec.Databases = map[string]string{"foo": "foo", "bar": "zalando", "baz": "zalando", "qux": "acid"}
+	c.Spec.Users = map[string]spec.UserFlags{"acid_reader": {}}
+	c.pgUsers = map[string]spec.PgUser{
+		"foo_reader":  {Name: "foo_reader", Flags: []string{}},
+		"acid_reader": {Name: "acid_reader", Password: "secret", Flags: []string{"LOGIN"}},
+	}
+
+	if err := c.initOwnerReaderRoles(); err != nil {
+		t.Fatalf("%s got an unexpected error: %v", testName, err)
+	}
+	for _, role := range []string{"foo_reader", "zalando_reader"} {
+		user, ok := c.pgUsers[role]
+		if !ok {
+			t.Errorf("%s expected the reader role %q", testName, role)
+			continue
+		}
+		if user.Password == "" || !reflect.DeepEqual(user.Flags, []string{"LOGIN"}) {
+			t.Errorf("%s expected the reader role %q to be a login role with a password, got %#v", testName, role, user)
+		}
+	}
+	if user := c.pgUsers["acid_reader"]; user.Password != "secret" {
+		t.Errorf("%s expected the manifest user acid_reader to be kept, got %#v", testName, user)
+	}
+
+	c.Spec.EnableOwnerReaderRoles = new(bool)
+	c.pgUsers = map[string]spec.PgUser{}
+	if err := c.initOwnerReaderRoles(); err != nil {
+		t.Fatalf("%s got an unexpected error: %v", testName, err)
+	}
+	if len(c.pgUsers) != 0 {
+		t.Errorf("%s expected no reader roles when disabled in the manifest, got %#v", testName, c.pgUsers)
+	}
+}
+
+func TestUserSpecChanged(t *testing.T) {
+	base := spec.PostgresSpec{
+		Users:             map[string]spec.UserFlags{"foo": {}},
+		Databases:         map[string]string{"foo": "foo"},
+		PreparedDatabases: map[string]spec.PreparedDatabase{"bar": {}},
+	}
+	tests := []struct {
+		name    string
+		newSpec spec.PostgresSpec
+		changed bool
+	}{
+		{"unchanged", base, false},
+		{"added user", spec.PostgresSpec{Users: map[string]spec.UserFlags{"foo": {}, "baz": {}},
+			Databases: base.Databases, PreparedDatabases: base.PreparedDatabases}, true},
+		{"added database", spec.PostgresSpec{Users: base.Users, Databases: map[string]string{"foo": "foo", "baz": "baz"},
+			PreparedDatabases: base.PreparedDatabases}, true},
+		{"added prepared database", spec.PostgresSpec{Users: base.Users, Databases: base.Databases,
+			PreparedDatabases: map[string]spec.PreparedDatabase{"bar": {}, "baz": {}}}, true},
+		{"removed prepared databases", spec.PostgresSpec{Users: base.Users, Databases: base.Databases}, true},
+	}
+	for _, tt := range tests {
+		if changed := userSpecChanged(&base, &tt.newSpec); changed != tt.changed {
+			t.Errorf("%s: expected userSpecChanged to return %t, got %t", tt.name, tt.changed, changed)
+		}
+	}
+}
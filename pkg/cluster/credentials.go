@@ -0,0 +1,102 @@
+package cluster
+
+import (
+	"fmt"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+)
+
+// credentialsInKubernetes tells if the credentials of the users are stored in Kubernetes secrets. The secrets of the
+// system users are always created, as the pods read them.
+func (c *Cluster) credentialsInKubernetes() bool {
+	return len(c.OpConfig.CredentialsBackends) == 0 ||
+		util.SliceContains(c.OpConfig.CredentialsBackends, constants.CredentialsBackendKubernetes)
+}
+
+// externalCredentialsBackends returns the names of the backends besides Kubernetes the credentials are stored in, in
+// the order of the configuration.
+func (c *Cluster) externalCredentialsBackends() []string {
+	names := make([]string, 0)
+	for _, name := range c.OpConfig.CredentialsBackends {
+		if _, ok := c.credentialsBackends[name]; ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// credentialsPath returns where the backend stores the credentials of the user, unique per cluster.
+func (c *Cluster) credentialsPath(backend, username string) string {
+	template := c.OpConfig.VaultPathTemplate
+	if backend == constants.CredentialsBackendAWSSecretsManager {
+		template = c.OpConfig.SecretsManagerTemplate
+	}
+	return template.Format(
+		"namespace", c.Namespace,
+		"cluster", c.Name,
+		"username", username)
+}
+
+// syncExternalCredentials writes the credentials of the users into the backends besides Kubernetes. With Kubernetes
+// secrets as well, they hold the passwords and the other backends get their copies; otherwise the passwords already
+// stored in the first backend are kept and only the new users get theirs written. The system users always take their
+// passwords from the Kubernetes secrets. Only the errors of the backend holding the passwords fail the sync, the
+// copies in the other ones are written again by the next sync.
+func (c *Cluster) syncExternalCredentials() error {
+	c.setProcessName("syncing credentials in the external backends")
+
+	for i, backend := range c.externalCredentialsBackends() {
+		primary := i == 0 && !c.credentialsInKubernetes()
+		if err := c.syncBackendCredentials(backend, primary); err != nil {
+			if primary {
+				return err
+			}
+			c.logger.Warningf("could not sync credentials in %s: %v", backend, err)
+		}
+	}
+
+	return nil
+}
+
+// syncBackendCredentials writes the credentials of the users into the backend, or takes the passwords from it if it
+// is the one holding them.
+func (c *Cluster) syncBackendCredentials(backend string, primary bool) error {
+	for _, users := range []map[string]spec.PgUser{c.pgUsers, c.systemUsers} {
+		for key, user := range users {
+			if user.Password == "" {
+				continue
+			}
+			data, err := c.credentialsBackends[backend].Read(c.credentialsPath(backend, user.Name))
+			if err != nil {
+				return fmt.Errorf("could not read credentials of %q from %s: %v", user.Name, backend, err)
+			}
+			systemUser := key == constants.SuperuserKeyName || key == constants.ReplicationUserKeyName
+			if primary && !systemUser && data["password"] != "" {
+				user.Password = data["password"]
+				users[key] = user
+				continue
+			}
+			if data["username"] == user.Name && data["password"] == user.Password {
+				continue
+			}
+			if err := c.writeExternalCredentials(backend, user); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeExternalCredentials stores the credentials of the user in the backend.
+func (c *Cluster) writeExternalCredentials(backend string, user spec.PgUser) error {
+	data := map[string]string{"username": user.Name, "password": user.Password}
+	if err := c.credentialsBackends[backend].Write(c.credentialsPath(backend, user.Name), data); err != nil {
+		return fmt.Errorf("could not write credentials of %q to %s: %v", user.Name, backend, err)
+	}
+	c.logger.Debugf("credentials of %q have been written to %s", user.Name, backend)
+
+	return nil
+}
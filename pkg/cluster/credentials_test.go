@@ -0,0 +1,46 @@
+package cluster
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/config"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/secretbackend"
+)
+
+type unreachableBackend struct{}
+
+func (unreachableBackend) Read(path string) (map[string]string, error) {
+	return nil, fmt.Errorf("connection refused")
+}
+
+func (unreachableBackend) Write(path string, data map[string]string) error {
+	return fmt.Errorf("connection refused")
+}
+
+func TestSyncExternalCredentialsBackendErrors(t *testing.T) {
+	tests := []struct {
+		backends []string
+		fails    bool
+	}{
+		{[]string{constants.CredentialsBackendKubernetes, constants.CredentialsBackendVault}, false},
+		{[]string{constants.CredentialsBackendAWSSecretsManager, constants.CredentialsBackendVault}, true},
+		{[]string{constants.CredentialsBackendVault, constants.CredentialsBackendAWSSecretsManager}, true},
+	}
+	for _, tt := range tests {
+		c := New(Config{OpConfig: config.Config{Auth: config.Auth{CredentialsBackends: tt.backends}}},
+			k8sutil.KubernetesClient{}, spec.Postgresql{}, logger)
+		c.credentialsBackends = map[string]secretbackend.Interface{
+			constants.CredentialsBackendVault:             unreachableBackend{},
+			constants.CredentialsBackendAWSSecretsManager: unreachableBackend{},
+		}
+		c.pgUsers = map[string]spec.PgUser{"foo": {Name: "foo", Password: "secret"}}
+
+		if err := c.syncExternalCredentials(); (err != nil) != tt.fails {
+			t.Errorf("backends %v: expected the sync to fail: %t, got: %v", tt.backends, tt.fails, err)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package cluster
+
+import (
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+)
+
+// objectReference returns the reference to the postgresql object of the cluster.
+func (c *Cluster) objectReference() v1.ObjectReference {
+	return v1.ObjectReference{
+		Kind:            constants.CRDKind,
+		APIVersion:      constants.CRDGroup + "/" + constants.CRDApiVersion,
+		Namespace:       c.Namespace,
+		Name:            c.Name,
+		UID:             c.UID,
+		ResourceVersion: c.ResourceVersion,
+	}
+}
+
+// recordEvent emits a Kubernetes event on the postgresql object, so that it shows up in kubectl describe.
+func (c *Cluster) recordEvent(eventType, reason, format string, args ...interface{}) {
+	c.createEvent(c.objectReference(), eventType, reason, fmt.Sprintf(format, args...))
+}
+
+// recordVolumeEvent emits the event both on the postgresql object and on the claim bound to the persistent volume.
+func (c *Cluster) recordVolumeEvent(pv *v1.PersistentVolume, eventType, reason, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	c.createEvent(c.objectReference(), eventType, reason, message)
+	if pv.Spec.ClaimRef == nil {
+		return
+	}
+	claimRef := *pv.Spec.ClaimRef
+	if claimRef.Kind == "" {
+		claimRef.Kind = "PersistentVolumeClaim"
+	}
+	c.createEvent(claimRef, eventType, reason, message)
+}
+
+// createEvent posts the event; failing to do so is only logged, as events are informational.
+func (c *Cluster) createEvent(object v1.ObjectReference, eventType, reason, message string) {
+	if c.KubeClient.EventsGetter == nil {
+		return
+	}
+	now := metav1.NewTime(time.Now())
+	event := &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: object.Name + ".",
+			Namespace:    object.Namespace,
+		},
+		InvolvedObject: object,
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Source:         v1.EventSource{Component: constants.EventSourceComponent},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	if _, err := c.KubeClient.Events(object.Namespace).Create(event); err != nil {
+		c.logger.Warningf("could not create %s event for %s %q: %v", reason, object.Kind, object.Name, err)
+	}
+}
@@ -28,7 +28,14 @@ func (c *Cluster) ExecCommand(podName *spec.NamespacedName, command ...string) (
 		return "", fmt.Errorf("could not get pod info: %v", err)
 	}
 
-	if len(pod.Spec.Containers) != 1 {
+	// the pod may run sidecars next to postgres
+	container := ""
+	for _, podContainer := range pod.Spec.Containers {
+		if podContainer.Name == c.containerName() {
+			container = podContainer.Name
+		}
+	}
+	if container == "" {
 		return "", fmt.Errorf("could not determine which container to use")
 	}
 
@@ -38,7 +45,7 @@ func (c *Cluster) ExecCommand(podName *spec.NamespacedName, command ...string) (
 		Namespace(podName.Namespace).
 		SubResource("exec")
 	req.VersionedParams(&v1.PodExecOptions{
-		Container: pod.Spec.Containers[0].Name,
+		Container: container,
 		Command:   command,
 		Stdout:    true,
 		Stderr:    true,
@@ -2,15 +2,15 @@ package cluster
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/zalando-incubator/postgres-operator/pkg/spec"
-	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
 	"github.com/zalando-incubator/postgres-operator/pkg/util/filesystems"
 )
 
-func (c *Cluster) getPostgresFilesystemInfo(podName *spec.NamespacedName) (device, fstype string, err error) {
-	out, err := c.ExecCommand(podName, "bash", "-c", fmt.Sprintf("df -T %s|tail -1", constants.PostgresDataMount))
+func (c *Cluster) getPostgresFilesystemInfo(podName *spec.NamespacedName, mountPath string) (device, fstype string, err error) {
+	out, err := c.ExecCommand(podName, "bash", "-c", fmt.Sprintf("df -T %s|tail -1", mountPath))
 	if err != nil {
 		return "", "", err
 	}
@@ -22,10 +22,25 @@ func (c *Cluster) getPostgresFilesystemInfo(podName *spec.NamespacedName) (devic
 	return fields[0], fields[1], nil
 }
 
-func (c *Cluster) resizePostgresFilesystem(podName *spec.NamespacedName, resizers []filesystems.FilesystemResizer) error {
+// getPostgresFilesystemBytes returns the value of the df field ("size", "used" or "avail") in bytes for
+// the filesystem mounted at the given path.
+func (c *Cluster) getPostgresFilesystemBytes(podName *spec.NamespacedName, mountPath, field string) (int64, error) {
+	out, err := c.ExecCommand(podName, "bash", "-c", fmt.Sprintf("df -B1 --output=%s %s|tail -1", field, mountPath))
+	if err != nil {
+		return 0, err
+	}
+	used, err := strconv.ParseInt(strings.TrimSpace(out), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse the df output: %v", err)
+	}
+
+	return used, nil
+}
+
+func (c *Cluster) resizePostgresFilesystem(podName *spec.NamespacedName, mountPath string, resizers []filesystems.FilesystemResizer) error {
 	// resize2fs always writes to stderr, and ExecCommand considers a non-empty stderr an error
 	// first, determine the device and the filesystem
-	deviceName, fsType, err := c.getPostgresFilesystemInfo(podName)
+	deviceName, fsType, err := c.getPostgresFilesystemInfo(podName, mountPath)
 	if err != nil {
 		return fmt.Errorf("could not get device and type for the postgres filesystem: %v", err)
 	}
@@ -41,3 +56,13 @@ func (c *Cluster) resizePostgresFilesystem(podName *spec.NamespacedName, resizer
 	}
 	return fmt.Errorf("could not resize filesystem: no compatible resizers for the filesystem of type %q", fsType)
 }
+
+// isVolumeMounted checks whether a separate filesystem is mounted at the given path in the postgres container of the pod.
+func (c *Cluster) isVolumeMounted(podName *spec.NamespacedName, mountPath string) (bool, error) {
+	out, err := c.ExecCommand(podName, "bash", "-c", fmt.Sprintf("awk '$2 == \"%s\" {print $2}' /proc/mounts", mountPath))
+	if err != nil {
+		return false, err
+	}
+
+	return strings.TrimSpace(out) != "", nil
+}
@@ -0,0 +1,84 @@
+package cluster
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/util"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+)
+
+// FinalBackup pushes a base backup of the master to the WAL archive of the cluster, so that the deleted cluster can
+// be cloned from S3 afterwards. The deletion has to wait for it, which is bounded by the final_backup_timeout.
+func (c *Cluster) FinalBackup() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.OpConfig.EnableFinalBackup {
+		return nil
+	}
+	c.setProcessName("taking the final backup")
+	c.logger.Infof("taking the final backup of the cluster")
+
+	if err := c.pushBaseBackup(c.OpConfig.FinalBackupTimeout); err != nil {
+		c.recordEvent(v1.EventTypeWarning, constants.EventReasonFinalBackupFailed, "could not take the final backup: %v", err)
+		return fmt.Errorf("could not take the final backup: %v", err)
+	}
+	c.recordEvent(v1.EventTypeNormal, constants.EventReasonFinalBackupTaken, "final backup has been pushed to the WAL archive")
+	c.logger.Infof("final backup has been taken")
+
+	return nil
+}
+
+// pushBaseBackup takes a base backup of the master with the WAL tool of the cluster, waiting for it at most until
+// the timeout. The backup is killed in the pod when the timeout is exceeded, and no other one is started as long as
+// the exec of the previous one hasn't returned.
+func (c *Cluster) pushBaseBackup(timeout time.Duration) error {
+	if !c.walArchiveEnabled(&c.Spec) {
+		return fmt.Errorf("no WAL bucket is configured")
+	}
+	masterPods, err := c.getRolePods(Master)
+	if err != nil {
+		return fmt.Errorf("could not get master pod: %v", err)
+	}
+	if len(masterPods) == 0 {
+		return fmt.Errorf("no master pod is running")
+	}
+
+	c.backupPushRunningMu.Lock()
+	if c.backupPushRunning {
+		c.backupPushRunningMu.Unlock()
+		return fmt.Errorf("the previous base backup is still being pushed")
+	}
+	c.backupPushRunning = true
+	c.backupPushRunningMu.Unlock()
+
+	podName := util.NameFromMeta(masterPods[0].ObjectMeta)
+	command := c.walArchiveCommand("backup-push " + constants.PostgresDataPath + "/data")
+	if c.walTool(&c.Spec) == constants.WALToolPgBackRest {
+		command = pgBackRestBackupCommand("full")
+	}
+	result := make(chan error, 1)
+	go func() {
+		defer func() {
+			c.backupPushRunningMu.Lock()
+			c.backupPushRunning = false
+			c.backupPushRunningMu.Unlock()
+		}()
+		out, err := c.ExecCommand(&podName, "timeout", fmt.Sprintf("--kill-after=%d", int(constants.BackupPushKillGrace.Seconds())),
+			fmt.Sprintf("%d", int(timeout.Seconds())), "/bin/su", "postgres", "-c", command)
+		if err != nil {
+			err = fmt.Errorf("%v: %s", err, out)
+		}
+		result <- err
+	}()
+
+	select {
+	case err = <-result:
+		return err
+	case <-time.After(timeout + constants.BackupPushKillGrace):
+		return fmt.Errorf("timeout of %v exceeded", timeout)
+	}
+}
@@ -0,0 +1,137 @@
+package cluster
+
+import (
+	"fmt"
+	"reflect"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+// iamRole returns the AWS IAM role of the pods of the cluster, the manifest overriding the kube_iam_role of the
+// operator configuration.
+func (c *Cluster) iamRole(pgSpec *spec.PostgresSpec) string {
+	if pgSpec.IAMRole != "" {
+		return pgSpec.IAMRole
+	}
+	return c.OpConfig.KubeIAMRole
+}
+
+// usesIAMServiceAccount checks if the pods get the IAM role from a service account of their own, as required by
+// IAM roles for service accounts.
+func (c *Cluster) usesIAMServiceAccount(iamRole string) bool {
+	return iamRole != "" && c.OpConfig.IAMRoleInjection == constants.IAMRoleInjectionServiceAccount
+}
+
+func (c *Cluster) iamServiceAccountName() string {
+	return fmt.Sprintf("%s-%s", c.Name, c.OpConfig.ServiceAccountName)
+}
+
+// podServiceAccountName returns the service account of the pods of the cluster and of its jobs.
+func (c *Cluster) podServiceAccountName(iamRole string) string {
+	if c.usesIAMServiceAccount(iamRole) {
+		return c.iamServiceAccountName()
+	}
+	return c.OpConfig.ServiceAccountName
+}
+
+// podIAMAnnotations returns the annotation kube2iam and kiam assign the IAM role to the pods by, or nil when the
+// role comes from the service account.
+func (c *Cluster) podIAMAnnotations(iamRole string) map[string]string {
+	if iamRole == "" || c.usesIAMServiceAccount(iamRole) {
+		return nil
+	}
+	return map[string]string{constants.KubeIAmAnnotation: iamRole}
+}
+
+// generateIAMServiceAccount returns the service account of the cluster with its IAM role, pulling the images with
+// the secrets of the service_account_name.
+func (c *Cluster) generateIAMServiceAccount(iamRole string, imagePullSecrets []v1.LocalObjectReference) *v1.ServiceAccount {
+	return &v1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        c.iamServiceAccountName(),
+			Namespace:   c.Namespace,
+			Labels:      c.labelsSet(),
+			Annotations: map[string]string{constants.IRSARoleAnnotation: iamRole},
+		},
+		ImagePullSecrets: imagePullSecrets,
+	}
+}
+
+// syncIAMServiceAccount creates or updates the service account of the cluster with IAM roles for service accounts,
+// and deletes it once the cluster has no IAM role of its own anymore. The pods switch with the next rolling update.
+// The operator doesn't need the permissions for the service accounts when injecting the IAM roles with annotations.
+func (c *Cluster) syncIAMServiceAccount() error {
+	if c.OpConfig.IAMRoleInjection != constants.IAMRoleInjectionServiceAccount {
+		return nil
+	}
+	c.setProcessName("syncing IAM service account")
+
+	iamRole := c.iamRole(&c.Spec)
+	serviceAccount, err := c.KubeClient.ServiceAccounts(c.Namespace).Get(c.iamServiceAccountName(), metav1.GetOptions{})
+	if err != nil && !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not get IAM service account: %v", err)
+	}
+	if err != nil {
+		serviceAccount = nil
+	}
+
+	if !c.usesIAMServiceAccount(iamRole) {
+		if serviceAccount == nil {
+			return nil
+		}
+		return c.deleteIAMServiceAccount()
+	}
+
+	var imagePullSecrets []v1.LocalObjectReference
+	template, err := c.KubeClient.ServiceAccounts(c.Namespace).Get(c.OpConfig.ServiceAccountName, metav1.GetOptions{})
+	if err == nil {
+		imagePullSecrets = template.ImagePullSecrets
+	} else if !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not get service account %q: %v", c.OpConfig.ServiceAccountName, err)
+	}
+
+	desired := c.generateIAMServiceAccount(iamRole, imagePullSecrets)
+	if serviceAccount == nil {
+		if _, err = c.KubeClient.ServiceAccounts(c.Namespace).Create(desired); err != nil {
+			return fmt.Errorf("could not create IAM service account: %v", err)
+		}
+		c.logger.Infof("service account %q with the IAM role %q has been created", desired.Name, iamRole)
+		return nil
+	}
+	if serviceAccount.Annotations[constants.IRSARoleAnnotation] == iamRole &&
+		reflect.DeepEqual(serviceAccount.ImagePullSecrets, desired.ImagePullSecrets) {
+		return nil
+	}
+	if serviceAccount.Annotations == nil {
+		serviceAccount.Annotations = make(map[string]string)
+	}
+	serviceAccount.Annotations[constants.IRSARoleAnnotation] = iamRole
+	serviceAccount.ImagePullSecrets = desired.ImagePullSecrets
+	if _, err = c.KubeClient.ServiceAccounts(c.Namespace).Update(serviceAccount); err != nil {
+		return fmt.Errorf("could not update IAM service account: %v", err)
+	}
+	c.logger.Infof("IAM role of the service account %q has been set to %q", serviceAccount.Name, iamRole)
+
+	return nil
+}
+
+// deleteIAMServiceAccount removes the service account of the cluster, if any.
+func (c *Cluster) deleteIAMServiceAccount() error {
+	if c.OpConfig.IAMRoleInjection != constants.IAMRoleInjectionServiceAccount {
+		return nil
+	}
+	err := c.KubeClient.ServiceAccounts(c.Namespace).Delete(c.iamServiceAccountName(), c.deleteOptions)
+	if err != nil && !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not delete IAM service account: %v", err)
+	}
+	if err == nil {
+		c.logger.Infof("service account %q has been deleted", c.iamServiceAccountName())
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/config"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+func TestPodIAMRole(t *testing.T) {
+	const (
+		operatorRole = "arn:aws:iam::123456789012:role/postgres-pods"
+		clusterRole  = "arn:aws:iam::123456789012:role/acid-test"
+	)
+	tests := []struct {
+		name           string
+		injection      string
+		spec           spec.PostgresSpec
+		serviceAccount string
+		annotations    map[string]string
+	}{
+		{"operator role", constants.IAMRoleInjectionAnnotation, spec.PostgresSpec{},
+			"operator", map[string]string{constants.KubeIAmAnnotation: operatorRole}},
+		{"cluster role", constants.IAMRoleInjectionAnnotation, spec.PostgresSpec{IAMRole: clusterRole},
+			"operator", map[string]string{constants.KubeIAmAnnotation: clusterRole}},
+		{"cluster role with IRSA", constants.IAMRoleInjectionServiceAccount, spec.PostgresSpec{IAMRole: clusterRole},
+			"acid-test-operator", nil},
+	}
+	for _, tt := range tests {
+		c := New(Config{OpConfig: config.Config{ServiceAccountName: "operator", KubeIAMRole: operatorRole,
+			IAMRoleInjection: tt.injection}}, k8sutil.KubernetesClient{}, spec.Postgresql{}, logger)
+		c.Name = "acid-test"
+
+		iamRole := c.iamRole(&tt.spec)
+		if serviceAccount := c.podServiceAccountName(iamRole); serviceAccount != tt.serviceAccount {
+			t.Errorf("%s: expected the service account %q, got: %q", tt.name, tt.serviceAccount, serviceAccount)
+		}
+		if annotations := c.podIAMAnnotations(iamRole); !reflect.DeepEqual(annotations, tt.annotations) {
+			t.Errorf("%s: expected the annotations %v, got: %v", tt.name, tt.annotations, annotations)
+		}
+		if c.usesIAMServiceAccount(iamRole) {
+			serviceAccount := c.generateIAMServiceAccount(iamRole, nil)
+			if serviceAccount.Annotations[constants.IRSARoleAnnotation] != clusterRole {
+				t.Errorf("%s: expected the IAM role on the service account, got: %v", tt.name, serviceAccount.Annotations)
+			}
+			continue
+		}
+		// without a client for the service accounts, the calls would panic
+		if err := c.syncIAMServiceAccount(); err != nil {
+			t.Errorf("%s: unexpected error syncing the service account: %v", tt.name, err)
+		}
+		if err := c.deleteIAMServiceAccount(); err != nil {
+			t.Errorf("%s: unexpected error deleting the service account: %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+// sizeForClaim returns the size the manifest requests for the volume held by the claim with the given name,
+// taking the per-instance overrides into account. Claim names end with the ordinal of the pod.
+func sizeForClaim(volume spec.Volume, claimName string) (resource.Quantity, error) {
+	size := volume.Size
+	if idx := strings.LastIndex(claimName, "-"); idx >= 0 {
+		size = instanceSize(volume, claimName[idx+1:])
+	}
+	quantity, err := resource.ParseQuantity(size)
+	if err != nil {
+		return quantity, fmt.Errorf("could not parse size %q of the persistent volume claim %q: %v", size, claimName, err)
+	}
+	return quantity, nil
+}
+
+// validateInstanceSizes checks that the overrides are keyed by pod ordinals.
+func validateInstanceSizes(volumeName string, volume spec.Volume) error {
+	for ordinal := range volume.InstanceSizes {
+		// the claims are named after the canonical ordinal, so "01" or "+1" would never match any of them
+		if n, err := strconv.Atoi(ordinal); err != nil || n < 0 || strconv.Itoa(n) != ordinal {
+			return fmt.Errorf("instance size of the %q volume is defined for %q, which is not a pod ordinal", volumeName, ordinal)
+		}
+	}
+	return nil
+}
+
+// ensureInstanceVolumeClaims creates the claims of the pods with a per-instance volume size before the statefulset
+// gets to them: the statefulset can only provision claims of the same size from its template, but it uses the
+// claims that already exist.
+func (c *Cluster) ensureInstanceVolumeClaims() error {
+	for _, volume := range persistentClusterVolumes(&c.Spec) {
+		for ordinal := range volume.volume.InstanceSizes {
+			n, err := strconv.Atoi(ordinal)
+			if err != nil || int32(n) >= c.getNumberOfInstances(&c.Spec) {
+				continue
+			}
+			claimName := fmt.Sprintf("%s-%s-%d", volume.name, c.statefulSetName(), n)
+			_, err = c.KubeClient.PersistentVolumeClaims(c.Namespace).Get(claimName, metav1.GetOptions{})
+			if err == nil {
+				continue
+			}
+			if !k8sutil.ResourceNotFound(err) {
+				return fmt.Errorf("could not get persistent volume claim %q: %v", claimName, err)
+			}
+
+			pvc, err := generatePersistentVolumeClaimTemplate(volume.name, volume.volume)
+			if err != nil {
+				return fmt.Errorf("could not generate persistent volume claim: %v", err)
+			}
+			size, err := sizeForClaim(volume.volume, claimName)
+			if err != nil {
+				return err
+			}
+			pvc.Name = claimName
+			pvc.Namespace = c.Namespace
+			pvc.Labels = c.labelsSet()
+			for key, value := range volume.volume.Labels {
+				pvc.Labels[key] = value
+			}
+			pvc.Spec.Resources.Requests[v1.ResourceStorage] = size
+			if _, err := c.KubeClient.PersistentVolumeClaims(c.Namespace).Create(pvc); err != nil {
+				return fmt.Errorf("could not create persistent volume claim %q: %v", claimName, err)
+			}
+			c.logger.Infof("created persistent volume claim %q of %s for the pod with ordinal %d",
+				util.NameFromMeta(pvc.ObjectMeta), size.String(), n)
+		}
+	}
+
+	return nil
+}
+
+// instanceSize returns the size of the volume for the pod with the given ordinal, or the default size
+// for an empty ordinal.
+func instanceSize(volume spec.Volume, ordinal string) string {
+	if size, ok := volume.InstanceSizes[ordinal]; ok && ordinal != "" {
+		return size
+	}
+	return volume.Size
+}
+
+// instanceOrdinals returns the ordinals overridden in either of the volumes, preceded by the empty ordinal of
+// the default size.
+func instanceOrdinals(volume, oldVolume spec.Volume) []string {
+	ordinals := make([]string, 0, len(volume.InstanceSizes)+len(oldVolume.InstanceSizes))
+	for ordinal := range volume.InstanceSizes {
+		ordinals = append(ordinals, ordinal)
+	}
+	for ordinal := range oldVolume.InstanceSizes {
+		if _, ok := volume.InstanceSizes[ordinal]; !ok {
+			ordinals = append(ordinals, ordinal)
+		}
+	}
+	sort.Strings(ordinals)
+
+	return append([]string{""}, ordinals...)
+}
+
+// sizeForPersistentVolume returns the size the manifest requests for the persistent volume, based on its claim.
+func sizeForPersistentVolume(volume spec.Volume, pv *v1.PersistentVolume) (resource.Quantity, error) {
+	if pv.Spec.ClaimRef == nil {
+		return sizeForClaim(volume, "")
+	}
+	return sizeForClaim(volume, pv.Spec.ClaimRef.Name)
+}
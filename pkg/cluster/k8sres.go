@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"sort"
+	"strconv"
+	"strings"
 
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -21,7 +23,11 @@ const (
 	pgBinariesLocationTemplate       = "/usr/lib/postgresql/%s/bin"
 	patroniPGBinariesParameterName   = "bin_dir"
 	patroniPGParametersParameterName = "parameters"
+	patroniPGBasebackupParameterName = "basebackup"
 	localHost                        = "127.0.0.1/32"
+	podAntiAffinityPreferred         = "preferred"
+	maxMaintenanceWorkMem            = 2048 // MB
+	minWorkerProcesses               = 8
 )
 
 type pgUser struct {
@@ -30,10 +36,39 @@ type pgUser struct {
 }
 
 type patroniDCS struct {
-	TTL                  uint32  `json:"ttl,omitempty"`
-	LoopWait             uint32  `json:"loop_wait,omitempty"`
-	RetryTimeout         uint32  `json:"retry_timeout,omitempty"`
-	MaximumLagOnFailover float32 `json:"maximum_lag_on_failover,omitempty"`
+	TTL                  uint32                `json:"ttl,omitempty"`
+	LoopWait             uint32                `json:"loop_wait,omitempty"`
+	RetryTimeout         uint32                `json:"retry_timeout,omitempty"`
+	MaximumLagOnFailover float32               `json:"maximum_lag_on_failover,omitempty"`
+	PostgreSQL           *patroniDCSPostgreSQL `json:"postgresql,omitempty"`
+
+	SynchronousMode       bool   `json:"synchronous_mode,omitempty"`
+	SynchronousModeStrict bool   `json:"synchronous_mode_strict,omitempty"`
+	SynchronousNodeCount  uint32 `json:"synchronous_node_count,omitempty"`
+
+	// Settings are passed through from the dcs section of the manifest
+	Settings map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON adds the settings passed through from the manifest to the ones known to the operator.
+func (dcs patroniDCS) MarshalJSON() ([]byte, error) {
+	type known patroniDCS
+	data, err := json.Marshal(known(dcs))
+	if err != nil || len(dcs.Settings) == 0 {
+		return data, err
+	}
+	merged := make(map[string]interface{})
+	if err := json.Unmarshal(data, &merged); err != nil {
+		return nil, err
+	}
+	for key, value := range dcs.Settings {
+		merged[key] = value
+	}
+	return json.Marshal(merged)
+}
+
+type patroniDCSPostgreSQL struct {
+	PgHBA []string `json:"pg_hba,omitempty"`
 }
 
 type pgBootstrap struct {
@@ -41,6 +76,15 @@ type pgBootstrap struct {
 	Users  map[string]pgUser `json:"users"`
 	PgHBA  []string          `json:"pg_hba"`
 	DCS    patroniDCS        `json:"dcs,omitempty"`
+	// Method selects a custom bootstrap method of Patroni instead of initdb, i.e. the restore with pgBackRest
+	Method     string                  `json:"method,omitempty"`
+	PgBackRest *patroniBootstrapMethod `json:"pgbackrest,omitempty"`
+}
+
+type patroniBootstrapMethod struct {
+	Command                  string `json:"command"`
+	KeepExistingRecoveryConf bool   `json:"keep_existing_recovery_conf,omitempty"`
+	NoParams                 bool   `json:"no_params,omitempty"`
 }
 
 type spiloConfiguration struct {
@@ -134,7 +178,8 @@ func fillResourceList(spec spec.ResourceDescription, defaults spec.ResourceDescr
 	return requests, nil
 }
 
-func (c *Cluster) generateSpiloJSONConfiguration(pg *spec.PostgresqlParam, patroni *spec.Patroni) string {
+func (c *Cluster) generateSpiloJSONConfiguration(pg *spec.PostgresqlParam, patroni *spec.Patroni, walDirectory string,
+	pgBackRest *spec.PgBackRest, cloneDescription *spec.CloneDescription) string {
 	config := spiloConfiguration{}
 
 	config.Bootstrap = pgBootstrap{}
@@ -150,6 +195,14 @@ func (c *Cluster) generateSpiloJSONConfiguration(pg *spec.PostgresqlParam, patro
 	/* We need to sort the user-defined options to more easily compare the resulting specs */
 	sort.Strings(initdbOptionNames)
 
+	// a separate WAL volume is set up at initdb time, unless the manifest explicitly overrides the WAL location
+	walDirOption := walDirectoryOption(pg.PgVersion)
+	if walDirectory != "" {
+		if _, ok := patroni.InitDB[walDirOption]; !ok {
+			config.Bootstrap.Initdb = append(config.Bootstrap.Initdb, map[string]string{walDirOption: walDirectory})
+		}
+	}
+
 	// Initdb parameters in the manifest take priority over the default ones
 	// The whole type switch dance is caused by the ability to specify both
 	// maps and normal string items in the array of initdb options. We need
@@ -192,18 +245,9 @@ PatroniInitDBParams:
 		config.Bootstrap.Initdb = append(config.Bootstrap.Initdb, map[string]string{k: v})
 	}
 
-	// pg_hba parameters in the manifest replace the default ones. We cannot
-	// reasonably merge them automatically, because pg_hba parsing stops on
-	// a first successfully matched rule.
-	if len(patroni.PgHba) > 0 {
-		config.Bootstrap.PgHBA = patroni.PgHba
-	} else {
-		config.Bootstrap.PgHBA = []string{
-			"hostnossl all all all reject",
-			fmt.Sprintf("hostssl   all +%s all pam", c.OpConfig.PamRoleName),
-			"hostssl   all all all md5",
-		}
-	}
+	// the rules in the DCS are applied by Patroni to the running clusters as well, see syncPgHba
+	config.Bootstrap.PgHBA = c.pgHbaRules(patroni)
+	config.Bootstrap.DCS.PostgreSQL = &patroniDCSPostgreSQL{PgHBA: config.Bootstrap.PgHBA}
 
 	if patroni.MaximumLagOnFailover >= 0 {
 		config.Bootstrap.DCS.MaximumLagOnFailover = patroni.MaximumLagOnFailover
@@ -217,12 +261,31 @@ PatroniInitDBParams:
 	if patroni.TTL != 0 {
 		config.Bootstrap.DCS.TTL = patroni.TTL
 	}
+	// like the pg_hba rules, synchronous replication of the running clusters is set in the DCS, see syncSynchronousMode
+	config.Bootstrap.DCS.SynchronousMode = patroni.SynchronousMode
+	config.Bootstrap.DCS.SynchronousModeStrict = patroni.SynchronousModeStrict
+	config.Bootstrap.DCS.SynchronousNodeCount = patroni.SynchronousNodeCount
+	// the passed through settings are set in the DCS of the running clusters as well, see syncPatroniDCS
+	if settings, err := spec.PatroniDCSSettings(patroni.DCS); err != nil {
+		c.logger.Warningf("could not pass the dcs settings through to Patroni: %v", err)
+	} else {
+		config.Bootstrap.DCS.Settings = settings
+	}
 
 	config.PgLocalConfiguration = make(map[string]interface{})
 	config.PgLocalConfiguration[patroniPGBinariesParameterName] = fmt.Sprintf(pgBinariesLocationTemplate, pg.PgVersion)
 	if len(pg.Parameters) > 0 {
 		config.PgLocalConfiguration[patroniPGParametersParameterName] = pg.Parameters
 	}
+	if walDirectory != "" {
+		// replicas should also keep their WAL on the separate volume
+		config.PgLocalConfiguration[patroniPGBasebackupParameterName] = []interface{}{
+			map[string]string{walDirOption: walDirectory},
+		}
+	}
+	if pgBackRest != nil {
+		addPgBackRestConfiguration(&config, pgBackRestStanza(pgBackRest, c.Name), cloneDescription)
+	}
 	config.Bootstrap.Users = map[string]pgUser{
 		c.OpConfig.PamRoleName: {
 			Password: "",
@@ -237,11 +300,19 @@ PatroniInitDBParams:
 	return string(result)
 }
 
-func (c *Cluster) nodeAffinity() *v1.Affinity {
-	matchExpressions := make([]v1.NodeSelectorRequirement, 0)
-	if len(c.OpConfig.NodeReadinessLabel) == 0 {
-		return nil
+// walDirectoryOption returns the name of the initdb and pg_basebackup option for the WAL location,
+// which has been renamed in PostgreSQL 10.
+func walDirectoryOption(pgVersion string) string {
+	if strings.HasPrefix(pgVersion, "9.") {
+		return "xlogdir"
 	}
+	return "waldir"
+}
+
+// nodeAffinity combines the node affinity of the manifest with the node readiness label of the operator: the label
+// is required in addition to every node selector term of the manifest.
+func (c *Cluster) nodeAffinity(nodeAffinitySpec *v1.NodeAffinity) *v1.Affinity {
+	matchExpressions := make([]v1.NodeSelectorRequirement, 0)
 	for k, v := range c.OpConfig.NodeReadinessLabel {
 		matchExpressions = append(matchExpressions, v1.NodeSelectorRequirement{
 			Key:      k,
@@ -249,14 +320,303 @@ func (c *Cluster) nodeAffinity() *v1.Affinity {
 			Values:   []string{v},
 		})
 	}
+	// the map has no order, but the statefulset is compared with reflect.DeepEqual
+	sort.Slice(matchExpressions, func(i, j int) bool { return matchExpressions[i].Key < matchExpressions[j].Key })
 
-	return &v1.Affinity{
-		NodeAffinity: &v1.NodeAffinity{
-			RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
-				NodeSelectorTerms: []v1.NodeSelectorTerm{{MatchExpressions: matchExpressions}},
+	if nodeAffinitySpec == nil {
+		if len(matchExpressions) == 0 {
+			return nil
+		}
+		return &v1.Affinity{
+			NodeAffinity: &v1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+					NodeSelectorTerms: []v1.NodeSelectorTerm{{MatchExpressions: matchExpressions}},
+				},
+			},
+		}
+	}
+
+	nodeAffinity := &v1.NodeAffinity{
+		PreferredDuringSchedulingIgnoredDuringExecution: nodeAffinitySpec.PreferredDuringSchedulingIgnoredDuringExecution,
+	}
+	required := nodeAffinitySpec.RequiredDuringSchedulingIgnoredDuringExecution
+	if required != nil && len(required.NodeSelectorTerms) > 0 {
+		terms := make([]v1.NodeSelectorTerm, 0, len(required.NodeSelectorTerms))
+		for _, term := range required.NodeSelectorTerms {
+			expressions := append([]v1.NodeSelectorRequirement{}, term.MatchExpressions...)
+			terms = append(terms, v1.NodeSelectorTerm{MatchExpressions: append(expressions, matchExpressions...)})
+		}
+		nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &v1.NodeSelector{NodeSelectorTerms: terms}
+	} else if len(matchExpressions) > 0 {
+		nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &v1.NodeSelector{
+			NodeSelectorTerms: []v1.NodeSelectorTerm{{MatchExpressions: matchExpressions}},
+		}
+	}
+
+	return &v1.Affinity{NodeAffinity: nodeAffinity}
+}
+
+// podAntiAffinity keeps the pods of the cluster off the nodes or zones, depending on the topology key, that already
+// run a pod of the same cluster. In the preferred mode the scheduler may still put them together if no other node fits.
+func (c *Cluster) podAntiAffinity(enableSpec *bool) *v1.PodAntiAffinity {
+	enabled := c.OpConfig.EnablePodAntiAffinity
+	if enableSpec != nil {
+		enabled = *enableSpec
+	}
+	if !enabled {
+		return nil
+	}
+
+	term := v1.PodAffinityTerm{
+		LabelSelector: &metav1.LabelSelector{MatchLabels: c.labelsSet()},
+		TopologyKey:   c.OpConfig.PodAntiAffinityTopology,
+	}
+	if c.OpConfig.PodAntiAffinityMode == podAntiAffinityPreferred {
+		return &v1.PodAntiAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []v1.WeightedPodAffinityTerm{{Weight: 1, PodAffinityTerm: term}},
+		}
+	}
+
+	return &v1.PodAntiAffinity{RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{term}}
+}
+
+// podPriorityClassName returns the priority class of the pods. The pod spec of the client library predates the
+// priorityClassName field, so the statefulset only carries it in an annotation and the pod template gets it from
+// patchPodSpecExtensions.
+func (c *Cluster) podPriorityClassName(spec *spec.PostgresSpec) string {
+	if spec.PodPriorityClassName != "" {
+		return spec.PodPriorityClassName
+	}
+	return c.OpConfig.PodPriorityClassName
+}
+
+// generateSidecarContainers merges the sidecars of the operator configuration with the ones of the manifest, which take
+// precedence. Sidecars get the name of the pod, the namespace and the superuser credentials in the environment.
+func (c *Cluster) generateSidecarContainers(specSidecars []spec.Sidecar) ([]v1.Container, error) {
+	sidecars := make([]spec.Sidecar, 0, len(c.OpConfig.SidecarImages)+len(specSidecars))
+	names := make([]string, 0, len(c.OpConfig.SidecarImages))
+	for name := range c.OpConfig.SidecarImages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		overridden := false
+		for _, sidecar := range specSidecars {
+			if sidecar.Name == name {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			sidecars = append(sidecars, spec.Sidecar{Name: name, DockerImage: c.OpConfig.SidecarImages[name]})
+		}
+	}
+	sidecars = append(sidecars, specSidecars...)
+
+	result := make([]v1.Container, 0, len(sidecars))
+	for _, sidecar := range sidecars {
+		resources, err := c.resourceRequirements(sidecar.Resources)
+		if err != nil {
+			return nil, fmt.Errorf("could not generate resource requirements of the sidecar %q: %v", sidecar.Name, err)
+		}
+		result = append(result, v1.Container{
+			Name:            sidecar.Name,
+			Image:           sidecar.DockerImage,
+			ImagePullPolicy: v1.PullIfNotPresent,
+			Resources:       *resources,
+			Env:             c.sidecarEnvironment(sidecar.Env),
+			Ports:           sidecar.Ports,
+			VolumeMounts:    sidecar.VolumeMounts,
+		})
+	}
+
+	return result, nil
+}
+
+func (c *Cluster) sidecarEnvironment(specEnv []v1.EnvVar) []v1.EnvVar {
+	envVars := []v1.EnvVar{
+		{
+			Name: "POD_NAME",
+			ValueFrom: &v1.EnvVarSource{
+				FieldRef: &v1.ObjectFieldSelector{
+					APIVersion: "v1",
+					FieldPath:  "metadata.name",
+				},
 			},
 		},
+		{
+			Name: "POD_NAMESPACE",
+			ValueFrom: &v1.EnvVarSource{
+				FieldRef: &v1.ObjectFieldSelector{
+					APIVersion: "v1",
+					FieldPath:  "metadata.namespace",
+				},
+			},
+		},
+		{
+			Name:  "POSTGRES_USER",
+			Value: c.OpConfig.SuperUsername,
+		},
+		{
+			Name: "POSTGRES_PASSWORD",
+			ValueFrom: &v1.EnvVarSource{
+				SecretKeyRef: &v1.SecretKeySelector{
+					LocalObjectReference: v1.LocalObjectReference{
+						Name: c.credentialSecretName(c.OpConfig.SuperUsername),
+					},
+					Key: "password",
+				},
+			},
+		},
+	}
+	// variables of the manifest replace the ones of the operator
+	result := make([]v1.EnvVar, 0, len(envVars)+len(specEnv))
+	for _, envVar := range envVars {
+		overridden := false
+		for _, specVar := range specEnv {
+			if specVar.Name == envVar.Name {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			result = append(result, envVar)
+		}
+	}
+
+	return append(result, specEnv...)
+}
+
+// generatePodAnnotations merges the annotations of the operator configuration, the IAM role and the annotations of the
+// manifest, in the order of precedence.
+func (c *Cluster) generatePodAnnotations(specAnnotations map[string]string, iamRole string) map[string]string {
+	annotations := make(map[string]string)
+	for k, v := range c.OpConfig.PodAnnotations {
+		annotations[k] = v
 	}
+	for k, v := range c.podIAMAnnotations(iamRole) {
+		annotations[k] = v
+	}
+	for k, v := range specAnnotations {
+		annotations[k] = v
+	}
+	if len(annotations) == 0 {
+		return nil
+	}
+
+	return annotations
+}
+
+// passwordEncryption returns the hashing of the passwords of the cluster: the password_encryption parameter of the
+// manifest, or the one of the operator. SCRAM-SHA-256 requires Postgres 10, older versions stay with MD5.
+func (c *Cluster) passwordEncryption(spec *spec.PostgresSpec) string {
+	encryption := c.OpConfig.PasswordEncryption
+	if value, ok := spec.Parameters["password_encryption"]; ok {
+		encryption = value
+	}
+	if encryption != constants.PasswordEncryptionSCRAM || strings.HasPrefix(spec.PgVersion, "9.") {
+		return constants.PasswordEncryptionMD5
+	}
+	return constants.PasswordEncryptionSCRAM
+}
+
+func (c *Cluster) parameterTuningEnabled(spec *spec.PostgresSpec) bool {
+	if spec.EnableParameterTuning != nil {
+		return *spec.EnableParameterTuning
+	}
+	return c.OpConfig.EnableParameterTuning
+}
+
+// tunedParameters derives the memory parameters of Postgres from the memory request of the container, and the number
+// of background workers from the CPU request, following the usual rules of thumb: a quarter of the memory for the
+// shared buffers, three quarters as the cache of the operating system.
+func tunedParameters(resourceRequirements *v1.ResourceRequirements) map[string]string {
+	parameters := make(map[string]string)
+	if memory, ok := resourceRequirements.Requests[v1.ResourceMemory]; ok && memory.Value() > 0 {
+		megabytes := memory.Value() / (1024 * 1024)
+		maintenanceWorkMem := megabytes / 16
+		if maintenanceWorkMem > maxMaintenanceWorkMem {
+			maintenanceWorkMem = maxMaintenanceWorkMem
+		}
+		parameters["shared_buffers"] = fmt.Sprintf("%dMB", maxInt64(megabytes/4, 1))
+		parameters["effective_cache_size"] = fmt.Sprintf("%dMB", maxInt64(megabytes*3/4, 1))
+		parameters["maintenance_work_mem"] = fmt.Sprintf("%dMB", maxInt64(maintenanceWorkMem, 1))
+	}
+	if cpu, ok := resourceRequirements.Requests[v1.ResourceCPU]; ok && cpu.MilliValue() > 0 {
+		cores := (cpu.MilliValue() + 999) / 1000
+		parameters["max_worker_processes"] = strconv.FormatInt(maxInt64(cores, minWorkerProcesses), 10)
+	}
+
+	return parameters
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// mergeTunedParameters adds the derived parameters to the ones of the manifest, which take precedence.
+func mergeTunedParameters(tuned, manifest map[string]string) map[string]string {
+	result := make(map[string]string, len(tuned)+len(manifest))
+	for k, v := range tuned {
+		result[k] = v
+	}
+	for k, v := range manifest {
+		result[k] = v
+	}
+
+	return result
+}
+
+func (c *Cluster) shmVolumeEnabled(spec *spec.PostgresSpec) bool {
+	if spec.EnableShmVolume != nil {
+		return *spec.EnableShmVolume
+	}
+	return c.OpConfig.EnableShmVolume
+}
+
+// addShmVolume mounts a memory volume at /dev/shm of the postgres container, since the 64MB of the container runtime
+// are not enough for the shared memory of parallel queries. The volume is limited to the memory limit of the container.
+func addShmVolume(podTemplate *v1.PodTemplateSpec, resourceRequirements *v1.ResourceRequirements) {
+	emptyDir := &v1.EmptyDirVolumeSource{Medium: v1.StorageMediumMemory}
+	if memoryLimit, ok := resourceRequirements.Limits[v1.ResourceMemory]; ok {
+		emptyDir.SizeLimit = memoryLimit
+	}
+	podTemplate.Spec.Volumes = append(podTemplate.Spec.Volumes, v1.Volume{
+		Name:         constants.ShmVolumeName,
+		VolumeSource: v1.VolumeSource{EmptyDir: emptyDir},
+	})
+	// the postgres container comes first
+	postgresContainer := &podTemplate.Spec.Containers[0]
+	postgresContainer.VolumeMounts = append(postgresContainer.VolumeMounts, v1.VolumeMount{
+		Name:      constants.ShmVolumeName,
+		MountPath: constants.ShmVolumePath,
+	})
+}
+
+// topologySpreadConstraints returns the constraints of the manifest, or the zone constraint of the operator
+// configuration. Constraints without a label selector apply to the pods of the cluster.
+func (c *Cluster) topologySpreadConstraints(pgSpec *spec.PostgresSpec) []spec.TopologySpreadConstraint {
+	constraints := pgSpec.TopologySpreadConstraints
+	if len(constraints) == 0 && c.OpConfig.TopologySpreadMaxSkew > 0 {
+		constraints = []spec.TopologySpreadConstraint{{
+			MaxSkew:           c.OpConfig.TopologySpreadMaxSkew,
+			TopologyKey:       c.OpConfig.TopologySpreadKey,
+			WhenUnsatisfiable: spec.ScheduleAnyway,
+		}}
+	}
+
+	result := make([]spec.TopologySpreadConstraint, 0, len(constraints))
+	for _, constraint := range constraints {
+		if constraint.LabelSelector == nil {
+			constraint.LabelSelector = &metav1.LabelSelector{MatchLabels: c.labelsSet()}
+		}
+		result = append(result, constraint)
+	}
+
+	return result
 }
 
 func (c *Cluster) tolerations(tolerationsSpec *[]v1.Toleration) []v1.Toleration {
@@ -288,10 +648,32 @@ func (c *Cluster) generatePodTemplate(
 	pgParameters *spec.PostgresqlParam,
 	patroniParameters *spec.Patroni,
 	cloneDescription *spec.CloneDescription,
+	standbyDescription *spec.StandbyDescription,
+	nodeAffinity *v1.NodeAffinity,
+	nodeSelector map[string]string,
+	enablePodAntiAffinity *bool,
+	initContainers []v1.Container,
+	sidecars []v1.Container,
+	podAnnotations map[string]string,
 	dockerImage *string,
 	customPodEnvVars map[string]string,
+	podVolumes []clusterVolume,
+	walTool string,
+	gcsArchive *spec.GCSArchive,
+	azureArchive *spec.AzureArchive,
+	s3Endpoint *spec.S3Endpoint,
+	pgBackRest *spec.PgBackRest,
+	backupEncryption *spec.BackupEncryption,
+	iamRole string,
 ) *v1.PodTemplateSpec {
-	spiloConfiguration := c.generateSpiloJSONConfiguration(pgParameters, patroniParameters)
+	walDirectory := ""
+	for _, volume := range podVolumes {
+		if volume.name == constants.WALVolumeName {
+			walDirectory = constants.PostgresWALPath
+		}
+	}
+	spiloConfiguration := c.generateSpiloJSONConfiguration(pgParameters, patroniParameters, walDirectory, pgBackRest,
+		cloneDescription)
 
 	envVars := []v1.EnvVar{
 		{
@@ -358,9 +740,18 @@ func (c *Cluster) generatePodTemplate(
 	if spiloConfiguration != "" {
 		envVars = append(envVars, v1.EnvVar{Name: "SPILO_CONFIGURATION", Value: spiloConfiguration})
 	}
-	if c.OpConfig.WALES3Bucket != "" {
+	if pgBackRest != nil {
+		envVars = append(envVars, generatePgBackRestEnvironment(pgBackRest, pgBackRestStanza(pgBackRest, c.Name))...)
+	} else if azureArchive != nil {
+		envVars = append(envVars, generateAzureArchiveEnvironment(azureArchive, c.Name, string(uid))...)
+	} else if gcsArchive != nil {
+		envVars = append(envVars, generateGCSArchiveEnvironment(gcsArchive, string(uid))...)
+	} else if c.OpConfig.WALES3Bucket != "" {
 		envVars = append(envVars, v1.EnvVar{Name: "WAL_S3_BUCKET", Value: c.OpConfig.WALES3Bucket})
 		envVars = append(envVars, v1.EnvVar{Name: "WAL_BUCKET_SCOPE_SUFFIX", Value: getWALBucketScopeSuffix(string(uid))})
+		if s3Endpoint != nil {
+			envVars = append(envVars, generateS3EndpointEnvironment(s3Endpoint, "")...)
+		}
 	}
 
 	if c.patroniUsesKubernetes() {
@@ -370,7 +761,18 @@ func (c *Cluster) generatePodTemplate(
 	}
 
 	if cloneDescription.ClusterName != "" {
-		envVars = append(envVars, c.generateCloneEnvironment(cloneDescription)...)
+		envVars = append(envVars, c.generateCloneEnvironment(cloneDescription, gcsArchive, azureArchive, s3Endpoint)...)
+	}
+
+	if standbyDescription != nil {
+		envVars = append(envVars, c.generateStandbyEnvironment(standbyDescription, gcsArchive, s3Endpoint)...)
+	}
+	envVars = append(envVars, generateWALToolEnvironment(walTool, cloneDescription, standbyDescription)...)
+	envVars = append(envVars, generateBackupEncryptionEnvironment(backupEncryption, walTool, "")...)
+	// the clones from an archive expect it to be encrypted with the keys of the clone
+	if cloneDescription.ClusterName != "" && cloneDescription.Snapshot == "" && !cloneDescription.PgBackRest &&
+		!cloneWithBasebackup(cloneDescription) {
+		envVars = append(envVars, generateBackupEncryptionEnvironment(backupEncryption, walTool, "CLONE_")...)
 	}
 
 	var names []string
@@ -400,11 +802,12 @@ func (c *Cluster) generatePodTemplate(
 	if dockerImage != nil && *dockerImage != "" {
 		containerImage = *dockerImage
 	}
-	volumeMounts := []v1.VolumeMount{
-		{
-			Name:      constants.DataVolumeName,
-			MountPath: constants.PostgresDataMount, //TODO: fetch from manifest
-		},
+	volumeMounts := make([]v1.VolumeMount, 0, len(podVolumes))
+	for _, volume := range podVolumes {
+		volumeMounts = append(volumeMounts, v1.VolumeMount{
+			Name:      volume.name,
+			MountPath: volume.mountPath,
+		})
 	}
 	container := v1.Container{
 		Name:            c.containerName(),
@@ -434,15 +837,25 @@ func (c *Cluster) generatePodTemplate(
 	terminateGracePeriodSeconds := int64(c.OpConfig.PodTerminateGracePeriod.Seconds())
 
 	podSpec := v1.PodSpec{
-		ServiceAccountName:            c.OpConfig.ServiceAccountName,
+		ServiceAccountName:            c.podServiceAccountName(iamRole),
 		TerminationGracePeriodSeconds: &terminateGracePeriodSeconds,
 		Containers:                    []v1.Container{container},
 		Tolerations:                   c.tolerations(tolerationsSpec),
+		InitContainers:                initContainers,
+	}
+	if len(nodeSelector) > 0 {
+		podSpec.NodeSelector = nodeSelector
 	}
 
-	if affinity := c.nodeAffinity(); affinity != nil {
+	if affinity := c.nodeAffinity(nodeAffinity); affinity != nil {
 		podSpec.Affinity = affinity
 	}
+	if antiAffinity := c.podAntiAffinity(enablePodAntiAffinity); antiAffinity != nil {
+		if podSpec.Affinity == nil {
+			podSpec.Affinity = &v1.Affinity{}
+		}
+		podSpec.Affinity.PodAntiAffinity = antiAffinity
+	}
 
 	if c.OpConfig.ScalyrAPIKey != "" && c.OpConfig.ScalyrImage != "" {
 		podSpec.Containers = append(
@@ -488,6 +901,7 @@ func (c *Cluster) generatePodTemplate(
 			},
 		)
 	}
+	podSpec.Containers = append(podSpec.Containers, sidecars...)
 
 	template := v1.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
@@ -496,9 +910,7 @@ func (c *Cluster) generatePodTemplate(
 		},
 		Spec: podSpec,
 	}
-	if c.OpConfig.KubeIAMRole != "" {
-		template.Annotations = map[string]string{constants.KubeIAmAnnotation: c.OpConfig.KubeIAMRole}
-	}
+	template.Annotations = c.generatePodAnnotations(podAnnotations, iamRole)
 
 	return &template
 }
@@ -547,10 +959,53 @@ func (c *Cluster) generateStatefulSet(spec *spec.PostgresSpec) (*v1beta1.Statefu
 			customPodEnvVars = cm.Data
 		}
 	}
-	podTemplate := c.generatePodTemplate(c.Postgresql.GetUID(), resourceRequirements, resourceRequirementsScalyrSidecar, &spec.Tolerations, &spec.PostgresqlParam, &spec.Patroni, &spec.Clone, &spec.DockerImage, customPodEnvVars)
-	volumeClaimTemplate, err := generatePersistentVolumeClaimTemplate(spec.Volume.Size, spec.Volume.StorageClass)
+	sidecars, err := c.generateSidecarContainers(spec.Sidecars)
 	if err != nil {
-		return nil, fmt.Errorf("could not generate volume claim template: %v", err)
+		return nil, fmt.Errorf("could not generate sidecar containers: %v", err)
+	}
+	pgParameters := spec.PostgresqlParam
+	if c.parameterTuningEnabled(spec) {
+		pgParameters.Parameters = mergeTunedParameters(tunedParameters(resourceRequirements), spec.Parameters)
+	}
+	// the passwords users set themselves get the same hashes as the ones set by the operator
+	if encryption := c.passwordEncryption(spec); encryption != constants.PasswordEncryptionMD5 {
+		pgParameters.Parameters = mergeTunedParameters(map[string]string{"password_encryption": encryption},
+			pgParameters.Parameters)
+	}
+	podVolumes := clusterVolumes(spec)
+	podTemplate := c.generatePodTemplate(c.Postgresql.GetUID(), resourceRequirements, resourceRequirementsScalyrSidecar, &spec.Tolerations, &pgParameters, &spec.Patroni, c.cloneDescription(spec), spec.StandbyCluster, spec.NodeAffinity, spec.NodeSelector, spec.EnablePodAntiAffinity, spec.InitContainers, sidecars, spec.PodAnnotations, &spec.DockerImage, customPodEnvVars, podVolumes, c.walTool(spec), c.gcsArchive(spec), c.azureArchive(spec), c.s3Endpoint(spec), spec.PgBackRest, spec.BackupEncryption, c.iamRole(spec))
+	volumeClaimTemplates := make([]v1.PersistentVolumeClaim, 0, len(podVolumes))
+	for _, volume := range podVolumes {
+		if volume.volume.Ephemeral {
+			sizeLimit, err := resource.ParseQuantity(volume.volume.Size)
+			if err != nil {
+				return nil, fmt.Errorf("could not parse size of the ephemeral volume %q: %v", volume.name, err)
+			}
+			podTemplate.Spec.Volumes = append(podTemplate.Spec.Volumes, v1.Volume{
+				Name:         volume.name,
+				VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{SizeLimit: sizeLimit}},
+			})
+			continue
+		}
+		volumeClaimTemplate, err := generatePersistentVolumeClaimTemplate(volume.name, volume.volume)
+		if err != nil {
+			return nil, fmt.Errorf("could not generate volume claim template for volume %q: %v", volume.name, err)
+		}
+		volumeClaimTemplates = append(volumeClaimTemplates, *volumeClaimTemplate)
+	}
+	if c.shmVolumeEnabled(spec) {
+		addShmVolume(podTemplate, resourceRequirements)
+	}
+	if gcsArchive := c.gcsArchive(spec); gcsArchive != nil && gcsArchive.CredentialsSecret != "" {
+		addSecretVolume(&podTemplate.Spec, constants.GCPCredentialsVolumeName, gcsArchive.CredentialsSecret,
+			constants.GCPCredentialsMount)
+	}
+	if s3Endpoint := c.s3Endpoint(spec); s3Endpoint != nil && s3Endpoint.CACertSecret != "" {
+		addSecretVolume(&podTemplate.Spec, constants.S3CACertVolumeName, s3Endpoint.CACertSecret, constants.S3CACertMount)
+	}
+	if spec.PgBackRest != nil && spec.PgBackRest.Repo.Host != nil {
+		addSecretVolume(&podTemplate.Spec, constants.PgBackRestTLSVolumeName, spec.PgBackRest.Repo.Host.TLSSecret,
+			constants.PgBackRestTLSMount)
 	}
 
 	numberOfInstances := c.getNumberOfInstances(spec)
@@ -565,9 +1020,23 @@ func (c *Cluster) generateStatefulSet(spec *spec.PostgresSpec) (*v1beta1.Statefu
 			Replicas:             &numberOfInstances,
 			ServiceName:          c.serviceName(Master),
 			Template:             *podTemplate,
-			VolumeClaimTemplates: []v1.PersistentVolumeClaim{*volumeClaimTemplate},
+			VolumeClaimTemplates: volumeClaimTemplates,
 		},
 	}
+	annotations := make(map[string]string)
+	if priorityClassName := c.podPriorityClassName(spec); priorityClassName != "" {
+		annotations[constants.PriorityClassNameAnnotation] = priorityClassName
+	}
+	if constraints := c.topologySpreadConstraints(spec); len(constraints) > 0 {
+		value, err := json.Marshal(constraints)
+		if err != nil {
+			return nil, fmt.Errorf("could not marshal topology spread constraints: %v", err)
+		}
+		annotations[constants.TopologySpreadConstraintsAnnotation] = string(value)
+	}
+	if len(annotations) > 0 {
+		statefulSet.Annotations = annotations
+	}
 
 	return statefulSet, nil
 }
@@ -578,6 +1047,10 @@ func (c *Cluster) getNumberOfInstances(spec *spec.PostgresSpec) (newcur int32) {
 	cur := spec.NumberOfInstances
 	newcur = cur
 
+	if spec.Hibernated {
+		return 0
+	}
+
 	if max >= 0 && newcur > max {
 		newcur = max
 	}
@@ -591,18 +1064,23 @@ func (c *Cluster) getNumberOfInstances(spec *spec.PostgresSpec) (newcur int32) {
 	return
 }
 
-func generatePersistentVolumeClaimTemplate(volumeSize, volumeStorageClass string) (*v1.PersistentVolumeClaim, error) {
+func generatePersistentVolumeClaimTemplate(volumeName string, volume spec.Volume) (*v1.PersistentVolumeClaim, error) {
 	metadata := metav1.ObjectMeta{
-		Name: constants.DataVolumeName,
+		Name:        volumeName,
+		Labels:      volume.Labels,
+		Annotations: make(map[string]string, len(volume.Annotations)+1),
 	}
-	if volumeStorageClass != "" {
+	for key, value := range volume.Annotations {
+		metadata.Annotations[key] = value
+	}
+	if volume.StorageClass != "" {
 		// TODO: check if storage class exists
-		metadata.Annotations = map[string]string{"volume.beta.kubernetes.io/storage-class": volumeStorageClass}
+		metadata.Annotations["volume.beta.kubernetes.io/storage-class"] = volume.StorageClass
 	} else {
-		metadata.Annotations = map[string]string{"volume.alpha.kubernetes.io/storage-class": "default"}
+		metadata.Annotations["volume.alpha.kubernetes.io/storage-class"] = "default"
 	}
 
-	quantity, err := resource.ParseQuantity(volumeSize)
+	quantity, err := resource.ParseQuantity(volume.Size)
 	if err != nil {
 		return nil, fmt.Errorf("could not parse volume size: %v", err)
 	}
@@ -626,6 +1104,9 @@ func (c *Cluster) generateUserSecrets() (secrets map[string]*v1.Secret) {
 	secrets = make(map[string]*v1.Secret, len(c.pgUsers))
 	namespace := c.Namespace
 	for username, pgUser := range c.pgUsers {
+		if !c.credentialsInKubernetes() {
+			break
+		}
 		//Skip users with no password i.e. human users (they'll be authenticated using pam)
 		secret := c.generateSingleUserSecret(namespace, pgUser)
 		if secret != nil {
@@ -651,9 +1132,10 @@ func (c *Cluster) generateSingleUserSecret(namespace string, pgUser spec.PgUser)
 	username := pgUser.Name
 	secret := v1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      c.credentialSecretName(username),
-			Namespace: namespace,
-			Labels:    c.labelsSet(),
+			Name:        c.credentialSecretName(username),
+			Namespace:   namespace,
+			Labels:      c.secretLabelsSet(),
+			Annotations: c.secretAnnotations(),
 		},
 		Type: v1.SecretTypeOpaque,
 		Data: map[string][]byte{
@@ -684,9 +1166,14 @@ func (c *Cluster) generateService(role PostgresRole, spec *spec.PostgresSpec) *v
 
 	var annotations map[string]string
 
-	// Examine the per-cluster load balancer setting, if it is not defined - check the operator configuration.
-	if (spec.UseLoadBalancer != nil && *spec.UseLoadBalancer) ||
-		(spec.UseLoadBalancer == nil && c.OpConfig.EnableLoadBalancer) {
+	// After the switchover of the blue/green upgrade the clients of the master reach the new cluster. Otherwise,
+	// examine the per-cluster load balancer setting, if it is not defined - check the operator configuration.
+	// Hibernated clusters don't pay for load balancers.
+	if role == Master && c.greenSwitchedOver() {
+		serviceSpec.Type = v1.ServiceTypeExternalName
+		serviceSpec.ExternalName = fmt.Sprintf("%s.%s.svc.cluster.local", c.lastVersionUpgrade().GreenCluster, c.Namespace)
+	} else if !spec.Hibernated && ((spec.UseLoadBalancer != nil && *spec.UseLoadBalancer) ||
+		(spec.UseLoadBalancer == nil && c.OpConfig.EnableLoadBalancer)) {
 
 		// safe default value: lock load balancer to only local address unless overridden explicitly.
 		sourceRanges := []string{localHost}
@@ -732,42 +1219,125 @@ func (c *Cluster) generateEndpoint(role PostgresRole, subsets []v1.EndpointSubse
 	return endpoints
 }
 
-func (c *Cluster) generateCloneEnvironment(description *spec.CloneDescription) []v1.EnvVar {
+// generateRecoveryTargetEnvironment passes the recovery target options of the clone to the Spilo templates of the
+// recovery configuration.
+func generateRecoveryTargetEnvironment(options *spec.RecoveryTargetOptions) []v1.EnvVar {
 	result := make([]v1.EnvVar, 0)
+	if options.TargetTimeline != "" {
+		result = append(result, v1.EnvVar{Name: "CLONE_TARGET_TIMELINE", Value: options.TargetTimeline})
+	}
+	if options.TargetInclusive != nil {
+		result = append(result, v1.EnvVar{Name: "CLONE_TARGET_INCLUSIVE", Value: strconv.FormatBool(*options.TargetInclusive)})
+	}
+	if options.TargetAction == spec.RecoveryTargetActionPause {
+		result = append(result, v1.EnvVar{Name: "USE_PAUSE_AT_RECOVERY_TARGET", Value: "true"})
+	}
+	return result
+}
 
-	if description.ClusterName == "" {
+func (c *Cluster) generateCloneEnvironment(description *spec.CloneDescription, gcsArchive *spec.GCSArchive,
+	azureArchive *spec.AzureArchive, s3Endpoint *spec.S3Endpoint) []v1.EnvVar {
+	result := make([]v1.EnvVar, 0)
+
+	// the volumes of the clone from a snapshot backup already contain the data, pgBackRest restores the clones
+	// by the bootstrap method in the Spilo configuration
+	if description.ClusterName == "" || description.Snapshot != "" || description.PgBackRest {
 		return result
 	}
 
 	cluster := description.ClusterName
 	result = append(result, v1.EnvVar{Name: "CLONE_SCOPE", Value: cluster})
-	if description.EndTimestamp == "" {
+	if cloneWithBasebackup(description) {
 		// cloning with basebackup, make a connection string to the cluster to clone from
 		host, port := c.getClusterServiceConnectionParameters(cluster)
 		// TODO: make some/all of those constants
 		result = append(result, v1.EnvVar{Name: "CLONE_METHOD", Value: "CLONE_WITH_BASEBACKUP"})
 		result = append(result, v1.EnvVar{Name: "CLONE_HOST", Value: host})
 		result = append(result, v1.EnvVar{Name: "CLONE_PORT", Value: port})
-		// TODO: assume replication user name is the same for all clusters, fetch it from secrets otherwise
-		result = append(result, v1.EnvVar{Name: "CLONE_USER", Value: c.OpConfig.ReplicationUsername})
-		result = append(result,
-			v1.EnvVar{Name: "CLONE_PASSWORD",
-				ValueFrom: &v1.EnvVarSource{
-					SecretKeyRef: &v1.SecretKeySelector{
-						LocalObjectReference: v1.LocalObjectReference{
-							Name: c.credentialSecretNameForCluster(c.OpConfig.ReplicationUsername,
-								description.ClusterName),
-						},
-						Key: "password",
-					},
-				},
-			})
+		result = append(result, c.cloneUserEnvironment(description)...)
 	} else {
-		// cloning with S3, find out the bucket to clone
+		// cloning with S3, GCS or Azure, find out the bucket to clone
 		result = append(result, v1.EnvVar{Name: "CLONE_METHOD", Value: "CLONE_WITH_WALE"})
-		result = append(result, v1.EnvVar{Name: "CLONE_WAL_S3_BUCKET", Value: c.OpConfig.WALES3Bucket})
-		result = append(result, v1.EnvVar{Name: "CLONE_TARGET_TIME", Value: description.EndTimestamp})
-		result = append(result, v1.EnvVar{Name: "CLONE_WAL_BUCKET_SCOPE_SUFFIX", Value: getWALBucketScopeSuffix(description.Uid)})
+		if description.AzWalPath != "" || (description.S3WalPath == "" && description.GSWalPath == "" && azureArchive != nil) {
+			// the original cluster is expected in the storage account of the clone
+			prefix := description.AzWalPath
+			if prefix == "" {
+				prefix = azureArchivePrefix(azureArchive.Container, cluster, description.Uid)
+			}
+			result = append(result, v1.EnvVar{Name: "CLONE_WALG_AZ_PREFIX", Value: prefix})
+			if azureArchive != nil {
+				result = append(result, v1.EnvVar{Name: "CLONE_AZURE_STORAGE_ACCOUNT", Value: azureArchive.StorageAccount})
+				// the SAS token of the clone section grants access to the container of another team
+				credentials := *azureArchive
+				if description.CredentialsSecret != "" {
+					credentials.CredentialsSecret = description.CredentialsSecret
+				}
+				result = append(result, generateAzureCredentialsEnvironment(&credentials, "CLONE_")...)
+			}
+		} else if description.S3WalPath != "" {
+			result = append(result, v1.EnvVar{Name: "CLONE_WALE_S3_PREFIX", Value: description.S3WalPath})
+			if s3Endpoint != nil {
+				result = append(result, generateS3EndpointEnvironment(s3Endpoint, "CLONE_")...)
+			}
+			result = append(result, generateCloneCredentialsEnvironment(description)...)
+		} else if description.GSWalPath != "" {
+			result = append(result, v1.EnvVar{Name: "CLONE_WALE_GS_PREFIX", Value: description.GSWalPath})
+		} else if gcsArchive != nil {
+			// the original cluster is expected in the bucket of the clone
+			result = append(result, v1.EnvVar{Name: "CLONE_WAL_GS_BUCKET", Value: gcsArchive.Bucket})
+			result = append(result, v1.EnvVar{Name: "CLONE_WAL_BUCKET_SCOPE_SUFFIX", Value: getWALBucketScopeSuffix(description.Uid)})
+			if prefix := gcsArchiveScopePrefix(gcsArchive); prefix != "" {
+				result = append(result, v1.EnvVar{Name: "CLONE_WAL_BUCKET_SCOPE_PREFIX", Value: prefix})
+			}
+		} else {
+			result = append(result, v1.EnvVar{Name: "CLONE_WAL_S3_BUCKET", Value: c.OpConfig.WALES3Bucket})
+			result = append(result, v1.EnvVar{Name: "CLONE_WAL_BUCKET_SCOPE_SUFFIX", Value: getWALBucketScopeSuffix(description.Uid)})
+			if s3Endpoint != nil {
+				result = append(result, generateS3EndpointEnvironment(s3Endpoint, "CLONE_")...)
+			}
+			result = append(result, generateCloneCredentialsEnvironment(description)...)
+		}
+		// without the target time the clone recovers until the end of the archived WAL
+		if description.EndTimestamp != "" {
+			result = append(result, v1.EnvVar{Name: "CLONE_TARGET_TIME", Value: description.EndTimestamp})
+		}
+		result = append(result, generateRecoveryTargetEnvironment(&description.RecoveryTargetOptions)...)
+		if description.S3WalPath == "" && gcsArchive != nil && gcsArchive.CredentialsSecret != "" {
+			result = append(result, v1.EnvVar{Name: "CLONE_GOOGLE_APPLICATION_CREDENTIALS", Value: gcpCredentialsFile})
+		}
+	}
+
+	return result
+}
+
+// generateStandbyEnvironment makes Spilo bootstrap the cluster as a standby: Patroni runs a standby leader
+// that replays the WAL of the source cluster instead of accepting writes.
+func (c *Cluster) generateStandbyEnvironment(description *spec.StandbyDescription, gcsArchive *spec.GCSArchive,
+	s3Endpoint *spec.S3Endpoint) []v1.EnvVar {
+	result := make([]v1.EnvVar, 0)
+
+	if description.S3WalPath != "" {
+		result = append(result, v1.EnvVar{Name: "STANDBY_METHOD", Value: "STANDBY_WITH_WALE"})
+		result = append(result, v1.EnvVar{Name: "STANDBY_WALE_S3_PREFIX", Value: description.S3WalPath})
+		// the path already points to the archive of the source cluster
+		result = append(result, v1.EnvVar{Name: "STANDBY_WAL_BUCKET_SCOPE_PREFIX", Value: ""})
+		if s3Endpoint != nil {
+			result = append(result, generateS3EndpointEnvironment(s3Endpoint, "STANDBY_")...)
+		}
+	} else if description.GSWalPath != "" {
+		result = append(result, v1.EnvVar{Name: "STANDBY_METHOD", Value: "STANDBY_WITH_WALE"})
+		result = append(result, v1.EnvVar{Name: "STANDBY_WALE_GS_PREFIX", Value: description.GSWalPath})
+		result = append(result, v1.EnvVar{Name: "STANDBY_WAL_BUCKET_SCOPE_PREFIX", Value: ""})
+		if gcsArchive != nil && gcsArchive.CredentialsSecret != "" {
+			result = append(result, v1.EnvVar{Name: "STANDBY_GOOGLE_APPLICATION_CREDENTIALS", Value: gcpCredentialsFile})
+		}
+	} else {
+		port := description.StandbyPort
+		if port == "" {
+			port = "5432"
+		}
+		result = append(result, v1.EnvVar{Name: "STANDBY_HOST", Value: description.StandbyHost})
+		result = append(result, v1.EnvVar{Name: "STANDBY_PORT", Value: port})
 	}
 
 	return result
@@ -775,6 +1345,10 @@ func (c *Cluster) generateCloneEnvironment(description *spec.CloneDescription) [
 
 func (c *Cluster) generatePodDisruptionBudget() *policybeta1.PodDisruptionBudget {
 	minAvailable := intstr.FromInt(1)
+	// a stopped cluster must not block the eviction of pods on the nodes being drained
+	if c.getNumberOfInstances(&c.Spec) <= 0 {
+		minAvailable = intstr.FromInt(0)
+	}
 
 	return &policybeta1.PodDisruptionBudget{
 		ObjectMeta: metav1.ObjectMeta{
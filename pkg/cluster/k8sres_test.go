@@ -0,0 +1,430 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/pkg/api/v1"
+	batchv2alpha1 "k8s.io/client-go/pkg/apis/batch/v2alpha1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/config"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+func TestNodeAffinity(t *testing.T) {
+	readiness := v1.NodeSelectorRequirement{Key: "lifecycle-status", Operator: v1.NodeSelectorOpIn, Values: []string{"ready"}}
+	pool := v1.NodeSelectorRequirement{Key: "pool", Operator: v1.NodeSelectorOpIn, Values: []string{"storage"}}
+	preferred := []v1.PreferredSchedulingTerm{{Weight: 1, Preference: v1.NodeSelectorTerm{MatchExpressions: []v1.NodeSelectorRequirement{pool}}}}
+	tests := []struct {
+		readinessLabel map[string]string
+		nodeAffinity   *v1.NodeAffinity
+		result         *v1.Affinity
+	}{
+		{nil, nil, nil},
+		{
+			readinessLabel: map[string]string{"lifecycle-status": "ready"},
+			result: &v1.Affinity{NodeAffinity: &v1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+					NodeSelectorTerms: []v1.NodeSelectorTerm{{MatchExpressions: []v1.NodeSelectorRequirement{readiness}}},
+				},
+			}},
+		},
+		{
+			readinessLabel: map[string]string{"lifecycle-status": "ready"},
+			nodeAffinity: &v1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+					NodeSelectorTerms: []v1.NodeSelectorTerm{{MatchExpressions: []v1.NodeSelectorRequirement{pool}}},
+				},
+			},
+			result: &v1.Affinity{NodeAffinity: &v1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+					NodeSelectorTerms: []v1.NodeSelectorTerm{{MatchExpressions: []v1.NodeSelectorRequirement{pool, readiness}}},
+				},
+			}},
+		},
+		{
+			nodeAffinity: &v1.NodeAffinity{PreferredDuringSchedulingIgnoredDuringExecution: preferred},
+			result:       &v1.Affinity{NodeAffinity: &v1.NodeAffinity{PreferredDuringSchedulingIgnoredDuringExecution: preferred}},
+		},
+	}
+	for _, tt := range tests {
+		c := New(Config{OpConfig: config.Config{Resources: config.Resources{NodeReadinessLabel: tt.readinessLabel}}},
+			k8sutil.KubernetesClient{}, spec.Postgresql{}, logger)
+		if result := c.nodeAffinity(tt.nodeAffinity); !reflect.DeepEqual(result, tt.result) {
+			t.Errorf("nodeAffinity(%+v) with the readiness label %v expected: %+v, got: %+v",
+				tt.nodeAffinity, tt.readinessLabel, tt.result, result)
+		}
+	}
+}
+
+func TestGenerateSidecarContainers(t *testing.T) {
+	c := New(Config{OpConfig: config.Config{Resources: config.Resources{
+		SidecarImages:        map[string]string{"exporter": "exporter:v1", "logs": "logs:v1"},
+		DefaultCPURequest:    "100m",
+		DefaultMemoryRequest: "100Mi",
+		DefaultCPULimit:      "1",
+		DefaultMemoryLimit:   "1Gi",
+	}}}, k8sutil.KubernetesClient{}, spec.Postgresql{}, logger)
+
+	sidecars, err := c.generateSidecarContainers([]spec.Sidecar{
+		{Name: "exporter", DockerImage: "exporter:v2", Env: []v1.EnvVar{{Name: "POSTGRES_USER", Value: "monitor"}}},
+	})
+	if err != nil {
+		t.Fatalf("could not generate sidecars: %v", err)
+	}
+	images := make(map[string]string)
+	names := make([]string, 0)
+	for _, sidecar := range sidecars {
+		images[sidecar.Name] = sidecar.Image
+		names = append(names, sidecar.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"logs", "exporter"}) {
+		t.Errorf("expected sidecars [logs exporter], got: %v", names)
+	}
+	if images["exporter"] != "exporter:v2" {
+		t.Errorf("expected the image of the manifest for the exporter, got: %q", images["exporter"])
+	}
+	users := 0
+	for _, envVar := range sidecars[1].Env {
+		if envVar.Name == "POSTGRES_USER" {
+			users++
+			if envVar.Value != "monitor" {
+				t.Errorf("expected POSTGRES_USER from the manifest, got: %q", envVar.Value)
+			}
+		}
+	}
+	if users != 1 {
+		t.Errorf("expected one POSTGRES_USER variable, got: %d", users)
+	}
+}
+
+func TestTunedParameters(t *testing.T) {
+	tests := []struct {
+		requests v1.ResourceList
+		result   map[string]string
+	}{
+		{v1.ResourceList{}, map[string]string{}},
+		{
+			v1.ResourceList{v1.ResourceMemory: resource.MustParse("4Gi"), v1.ResourceCPU: resource.MustParse("100m")},
+			map[string]string{"shared_buffers": "1024MB", "effective_cache_size": "3072MB",
+				"maintenance_work_mem": "256MB", "max_worker_processes": "8"},
+		},
+		{
+			v1.ResourceList{v1.ResourceMemory: resource.MustParse("64Gi"), v1.ResourceCPU: resource.MustParse("15500m")},
+			map[string]string{"shared_buffers": "16384MB", "effective_cache_size": "49152MB",
+				"maintenance_work_mem": "2048MB", "max_worker_processes": "16"},
+		},
+	}
+	for _, tt := range tests {
+		if result := tunedParameters(&v1.ResourceRequirements{Requests: tt.requests}); !reflect.DeepEqual(result, tt.result) {
+			t.Errorf("tunedParameters(%v) expected: %v, got: %v", tt.requests, tt.result, result)
+		}
+	}
+}
+
+func TestGenerateSingleUserSecret(t *testing.T) {
+	tests := []struct {
+		auth   config.Auth
+		name   string
+		labels map[string]string
+	}{
+		{
+			auth:   config.Auth{SecretNameTemplate: "{username}.{cluster}.credentials"},
+			name:   "foo-bar.acid-test.credentials",
+			labels: map[string]string{"application": "spilo", "cluster-name": "acid-test"},
+		},
+		{
+			auth: config.Auth{
+				SecretNameTemplate: "{namespace}-{team}-{cluster}-{username}",
+				SecretLabels:       map[string]string{"scanner": "ignore", "application": "other"},
+				SecretAnnotations:  map[string]string{"owner": "acid"},
+			},
+			name:   "default-acid-acid-test-foo-bar",
+			labels: map[string]string{"application": "spilo", "cluster-name": "acid-test", "scanner": "ignore"},
+		},
+	}
+	for _, tt := range tests {
+		c := New(Config{OpConfig: config.Config{
+			Resources: config.Resources{
+				ClusterLabels:    map[string]string{"application": "spilo"},
+				ClusterNameLabel: "cluster-name",
+			},
+			Auth: tt.auth}},
+			k8sutil.KubernetesClient{}, spec.Postgresql{}, logger)
+		c.Name = "acid-test"
+		c.Namespace = "default"
+		c.Spec.TeamID = "ACID"
+		secret := c.generateSingleUserSecret(c.Namespace, spec.PgUser{Name: "foo_bar", Password: "secret"})
+		if secret.Name != tt.name {
+			t.Errorf("secret name with the template %q expected: %q, got: %q", tt.auth.SecretNameTemplate, tt.name, secret.Name)
+		}
+		if !reflect.DeepEqual(map[string]string(secret.Labels), tt.labels) {
+			t.Errorf("secret labels expected: %v, got: %v", tt.labels, secret.Labels)
+		}
+		if !reflect.DeepEqual(secret.Annotations, tt.auth.SecretAnnotations) {
+			t.Errorf("secret annotations expected: %v, got: %v", tt.auth.SecretAnnotations, secret.Annotations)
+		}
+	}
+}
+
+func TestCredentialSecretNameForCluster(t *testing.T) {
+	tests := []struct {
+		clusterName string
+		clone       spec.CloneDescription
+		name        string
+	}{
+		{"acid-test", spec.CloneDescription{}, "acid-acid-test-foo-bar"},
+		{"acid-test-10", spec.CloneDescription{}, "acid-acid-test-10-foo-bar"},
+		{"batman-source", spec.CloneDescription{ClusterName: "batman-source"}, "batman-batman-source-foo-bar"},
+		{"data-eng-source", spec.CloneDescription{ClusterName: "data-eng-source", TeamID: "data-eng"},
+			"data-eng-data-eng-source-foo-bar"},
+	}
+	for _, tt := range tests {
+		c := New(Config{OpConfig: config.Config{Auth: config.Auth{SecretNameTemplate: "{team}-{cluster}-{username}"}}},
+			k8sutil.KubernetesClient{}, spec.Postgresql{}, logger)
+		c.Name = "acid-test"
+		c.Spec.TeamID = "ACID"
+		c.Spec.Clone = tt.clone
+		if name := c.credentialSecretNameForCluster("foo_bar", tt.clusterName); name != tt.name {
+			t.Errorf("secret name of the cluster %q expected: %q, got: %q", tt.clusterName, tt.name, name)
+		}
+	}
+}
+
+func TestGenerateLogicalBackupJob(t *testing.T) {
+	c := New(Config{OpConfig: config.Config{
+		Resources: config.Resources{
+			ClusterLabels:    map[string]string{"application": "spilo"},
+			ClusterNameLabel: "cluster-name",
+		},
+		Auth:                  config.Auth{SecretNameTemplate: "{username}.{cluster}.credentials", SuperUsername: superUserName},
+		LogicalBackupSchedule: "30 00 * * *",
+		LogicalBackupS3Bucket: "backups"}},
+		k8sutil.KubernetesClient{}, spec.Postgresql{}, logger)
+	c.Name = "acid-test"
+	c.Namespace = "default"
+	c.UID = "1234"
+	c.initSystemUsers()
+
+	env := func(job *batchv2alpha1.CronJob) map[string]string {
+		result := make(map[string]string)
+		for _, envVar := range job.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Env {
+			result[envVar.Name] = envVar.Value
+		}
+		return result
+	}
+
+	job := c.generateLogicalBackupJob()
+	if job.Spec.Schedule != "30 00 * * *" {
+		t.Errorf("expected the schedule of the operator configuration, got %q", job.Spec.Schedule)
+	}
+	if c.labelsSet().AsSelector().Matches(labels.Set(job.Spec.JobTemplate.Spec.Template.Labels)) {
+		t.Errorf("expected the pods of the job not to match the selector of the cluster, got labels %v",
+			job.Spec.JobTemplate.Spec.Template.Labels)
+	}
+	if prefix := env(job)["LOGICAL_BACKUP_S3_PREFIX"]; prefix != "spilo/acid-test/1234/logical_backups" {
+		t.Errorf("expected the prefix of the cluster, got %q", prefix)
+	}
+	if _, ok := env(job)["LOGICAL_BACKUP_DATABASES"]; ok {
+		t.Errorf("expected pg_dumpall without databases")
+	}
+
+	c.Spec.LogicalBackupSchedule = "0 3 * * 0"
+	c.Spec.LogicalBackupDatabases = []string{"foo", "bar"}
+	job = c.generateLogicalBackupJob()
+	if job.Spec.Schedule != "0 3 * * 0" {
+		t.Errorf("expected the schedule of the manifest, got %q", job.Spec.Schedule)
+	}
+	if databases := env(job)["LOGICAL_BACKUP_DATABASES"]; databases != "foo bar" {
+		t.Errorf("expected the databases of the manifest, got %q", databases)
+	}
+}
+
+func TestParseBackupList(t *testing.T) {
+	walE := "name\tlast_modified\texpanded_size_bytes\twal_segment_backup_start\twal_segment_offset_backup_start\n" +
+		"base_000000010000000000000004_00000040\t2017-12-19T12:40:33.000Z\t\t000000010000000000000004\t00000040\n" +
+		"base_000000010000000000000009_00000040\t2017-12-20T12:40:33.000Z\t25165824\t000000010000000000000009\t00000040\n"
+	walG := `[{"backup_name":"base_000000010000000000000004","time":"2017-12-19T12:40:33Z",` +
+		`"wal_file_name":"000000010000000000000004","compressed_size":4194304}]`
+	modified := time.Date(2017, 12, 19, 12, 40, 33, 0, time.UTC)
+
+	backups, err := parseWALEBackupList(walE)
+	if err != nil {
+		t.Fatalf("unexpected error parsing the WAL-E backup list: %v", err)
+	}
+	expected := []spec.BaseBackup{{Name: "base_000000010000000000000004_00000040", Time: modified,
+		WALSegment: "000000010000000000000004"}, {Name: "base_000000010000000000000009_00000040",
+		Time: modified.AddDate(0, 0, 1), WALSegment: "000000010000000000000009", Size: 25165824}}
+	if !reflect.DeepEqual(backups, expected) {
+		t.Errorf("WAL-E backup list expected: %#v, got: %#v", expected, backups)
+	}
+
+	backups, err = parseWALGBackupList(walG)
+	if err != nil {
+		t.Fatalf("unexpected error parsing the WAL-G backup list: %v", err)
+	}
+	expected[0].Name = "base_000000010000000000000004"
+	if len(backups) != 1 || backups[0].Name != expected[0].Name || !backups[0].Time.Equal(modified) ||
+		backups[0].WALSegment != expected[0].WALSegment || backups[0].Size != 4194304 {
+		t.Errorf("WAL-G backup list expected: %#v, got: %#v", expected[:1], backups)
+	}
+
+	if _, err := parseWALEBackupList("name\tlast_modified\n"); err == nil {
+		t.Errorf("expected an error for a WAL-E backup list without the WAL segments")
+	}
+
+	walELog := "wal_e.main   INFO     MSG: starting WAL-E\n        DETAIL: The subcommand is \"backup-list\".\n"
+	backups, err = parseWALEBackupList(walELog + walE)
+	if err != nil {
+		t.Fatalf("unexpected error parsing the WAL-E backup list with log lines: %v", err)
+	}
+	if len(backups) != 2 || backups[1].Name != "base_000000010000000000000009_00000040" {
+		t.Errorf("WAL-E backup list with log lines expected: %#v, got: %#v", expected, backups)
+	}
+	if _, err := parseWALEBackupList(walELog); err == nil {
+		t.Errorf("expected an error for a WAL-E backup list without the header")
+	}
+
+	walGLog := "INFO: 2017/12/20 12:40:33.000000 List backups\n"
+	backups, err = parseWALGBackupList(walGLog + walG + "\n" + walGLog)
+	if err != nil {
+		t.Fatalf("unexpected error parsing the WAL-G backup list with log lines: %v", err)
+	}
+	if len(backups) != 1 || backups[0].Name != expected[0].Name {
+		t.Errorf("WAL-G backup list with log lines expected: %#v, got: %#v", expected[:1], backups)
+	}
+}
+
+func TestGCSArchiveEnvironment(t *testing.T) {
+	c := New(Config{OpConfig: config.Config{WALES3Bucket: "s3-backups", GCPCredentialsSecret: "gcp-key"}},
+		k8sutil.KubernetesClient{}, spec.Postgresql{}, logger)
+	env := func(envVars []v1.EnvVar) map[string]string {
+		result := make(map[string]string)
+		for _, envVar := range envVars {
+			result[envVar.Name] = envVar.Value
+		}
+		return result
+	}
+
+	if archive := c.gcsArchive(&c.Spec); archive != nil {
+		t.Errorf("expected the S3 archive without a GCS bucket, got %#v", archive)
+	}
+	c.Spec.GCSArchive = &spec.GCSArchive{Bucket: "gs-backups", Prefix: "/team-a/"}
+	archive := c.gcsArchive(&c.Spec)
+	if archive == nil || archive.CredentialsSecret != "gcp-key" {
+		t.Fatalf("expected the GCS archive of the manifest with the credentials of the operator, got %#v", archive)
+	}
+
+	expected := map[string]string{
+		"WAL_GS_BUCKET":                  "gs-backups",
+		"WAL_BUCKET_SCOPE_SUFFIX":        "/1234",
+		"WAL_BUCKET_SCOPE_PREFIX":        "team-a/",
+		"GOOGLE_APPLICATION_CREDENTIALS": "/var/secrets/google/key.json",
+	}
+	if result := env(generateGCSArchiveEnvironment(archive, "1234")); !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected the archive environment %v, got %v", expected, result)
+	}
+
+	clone := env(c.generateCloneEnvironment(&spec.CloneDescription{ClusterName: "acid-batman", Uid: "5678",
+		EndTimestamp: "2017-12-19T12:40:33+01:00"}, archive, nil, nil))
+	if clone["CLONE_WAL_GS_BUCKET"] != "gs-backups" || clone["CLONE_WAL_BUCKET_SCOPE_SUFFIX"] != "/5678" ||
+		clone["CLONE_WAL_BUCKET_SCOPE_PREFIX"] != "team-a/" || clone["CLONE_GOOGLE_APPLICATION_CREDENTIALS"] == "" {
+		t.Errorf("expected the clone from the GCS bucket of the cluster, got %v", clone)
+	}
+	prefix := c.cloneArchivePrefix(&spec.CloneDescription{ClusterName: "acid-batman", Uid: "5678"})
+	if prefix != "gs://gs-backups/spilo/team-a/acid-batman/5678/wal" {
+		t.Errorf("expected the clone archive under the prefix of the GCS archive, got %q", prefix)
+	}
+	if _, ok := clone["CLONE_WAL_S3_BUCKET"]; ok {
+		t.Errorf("expected no S3 bucket for the clone from GCS, got %v", clone)
+	}
+
+	standby := env(c.generateStandbyEnvironment(&spec.StandbyDescription{
+		GSWalPath: "gs://gs-backups/spilo/acid-batman/5678/wal"}, archive, nil))
+	if standby["STANDBY_WALE_GS_PREFIX"] != "gs://gs-backups/spilo/acid-batman/5678/wal" ||
+		standby["STANDBY_GOOGLE_APPLICATION_CREDENTIALS"] == "" {
+		t.Errorf("expected the standby of the GCS archive, got %v", standby)
+	}
+}
+
+func TestAzureArchiveEnvironment(t *testing.T) {
+	c := New(Config{OpConfig: config.Config{
+		WALES3Bucket:           "s3-backups",
+		WALTool:                "wal-e",
+		WALAZStorageAccount:    "acidbackups",
+		WALAZContainer:         "spilo",
+		AzureCredentialsSecret: "azure-sas"}},
+		k8sutil.KubernetesClient{}, spec.Postgresql{}, logger)
+	c.Name = "acid-test"
+
+	archive := c.azureArchive(&c.Spec)
+	if archive == nil || archive.CredentialsSecret != "azure-sas" {
+		t.Fatalf("expected the Azure archive of the operator configuration, got %#v", archive)
+	}
+	if tool := c.walTool(&c.Spec); tool != "wal-g" {
+		t.Errorf("expected WAL-G for the Azure archive, got %q", tool)
+	}
+	c.Spec.GCSArchive = &spec.GCSArchive{Bucket: "gs-backups"}
+	if archive := c.azureArchive(&c.Spec); archive != nil {
+		t.Errorf("expected the GCS archive of the manifest to take precedence, got %#v", archive)
+	}
+	c.Spec.GCSArchive = nil
+
+	envVars := generateAzureArchiveEnvironment(archive, c.Name, "1234")
+	if len(envVars) != 3 || envVars[1].Value != "azure://spilo/spilo/acid-test/1234/wal" ||
+		envVars[2].Name != "AZURE_STORAGE_SAS_TOKEN" || envVars[2].ValueFrom.SecretKeyRef.Name != "azure-sas" {
+		t.Errorf("expected the prefix and the SAS token of the archive, got %#v", envVars)
+	}
+
+	clone := make(map[string]string)
+	for _, envVar := range c.generateCloneEnvironment(&spec.CloneDescription{ClusterName: "acid-batman", Uid: "5678",
+		EndTimestamp: "2017-12-19T12:40:33+01:00"}, nil, archive, nil) {
+		clone[envVar.Name] = envVar.Value
+	}
+	if clone["CLONE_WALG_AZ_PREFIX"] != "azure://spilo/spilo/acid-batman/5678/wal" ||
+		clone["CLONE_AZURE_STORAGE_ACCOUNT"] != "acidbackups" {
+		t.Errorf("expected the clone from the Azure container of the cluster, got %v", clone)
+	}
+	if _, ok := clone["CLONE_AZURE_STORAGE_SAS_TOKEN"]; !ok {
+		t.Errorf("expected the SAS token for the clone, got %v", clone)
+	}
+}
+
+func TestS3EndpointEnvironment(t *testing.T) {
+	c := New(Config{OpConfig: config.Config{
+		WALES3Bucket:     "backups",
+		S3Endpoint:       "https://minio.example.com:9000",
+		S3ForcePathStyle: true}},
+		k8sutil.KubernetesClient{}, spec.Postgresql{}, logger)
+
+	region := "us-east-1"
+	c.Spec.S3Endpoint = &spec.S3Endpoint{Region: region, CACertSecret: "minio-ca"}
+	endpoint := c.s3Endpoint(&c.Spec)
+	if endpoint == nil || endpoint.Endpoint != "https://minio.example.com:9000" || endpoint.Region != region ||
+		!*endpoint.ForcePathStyle {
+		t.Fatalf("expected the endpoint of the operator with the region of the manifest, got %#v", endpoint)
+	}
+
+	result := make(map[string]string)
+	for _, envVar := range generateS3EndpointEnvironment(endpoint, "CLONE_") {
+		result[envVar.Name] = envVar.Value
+	}
+	expected := map[string]string{
+		"CLONE_AWS_REGION":              region,
+		"CLONE_AWS_ENDPOINT":            "https://minio.example.com:9000",
+		"CLONE_WALE_S3_ENDPOINT":        "https+path://minio.example.com:9000",
+		"CLONE_AWS_S3_FORCE_PATH_STYLE": "true",
+		"CLONE_WALG_S3_CA_CERT_FILE":    "/var/secrets/s3-ca/ca.crt",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected the environment %v, got %v", expected, result)
+	}
+
+	if endpoint := waleS3Endpoint("http://rgw.storage:7480", false); endpoint != "http+virtualhost://rgw.storage:7480" {
+		t.Errorf("expected the WAL-E endpoint without TLS, got %q", endpoint)
+	}
+}
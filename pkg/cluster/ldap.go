@@ -0,0 +1,106 @@
+package cluster
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+)
+
+// ldapRole returns the role whose members authenticate against the directory.
+func ldapRole(ldap *spec.LDAP) string {
+	if ldap.Role == "" {
+		return constants.DefaultLDAPRoleName
+	}
+	return ldap.Role
+}
+
+// ldapPgHbaRule returns the pg_hba rule authenticating the members of the LDAP role over SSL connections only, as
+// Postgres receives the passwords in clear text. Without bind credentials the server is searched anonymously.
+func ldapPgHbaRule(ldap *spec.LDAP, bindDN, bindPassword string) string {
+	addresses := ldap.AllowedAddresses
+	if addresses == "" {
+		addresses = "all"
+	}
+	options := []string{fmt.Sprintf(`ldapserver="%s"`, ldap.Server)}
+	if ldap.Port > 0 {
+		options = append(options, fmt.Sprintf("ldapport=%d", ldap.Port))
+	}
+	if ldap.Scheme != "" {
+		options = append(options, fmt.Sprintf("ldapscheme=%s", ldap.Scheme))
+	}
+	if ldap.StartTLS {
+		options = append(options, "ldaptls=1")
+	}
+	options = append(options, fmt.Sprintf(`ldapbasedn="%s"`, ldap.BaseDN))
+	if ldap.SearchFilter != "" {
+		options = append(options, fmt.Sprintf(`ldapsearchfilter="%s"`, ldap.SearchFilter))
+	} else if ldap.SearchAttribute != "" {
+		options = append(options, fmt.Sprintf(`ldapsearchattribute="%s"`, ldap.SearchAttribute))
+	}
+	if bindDN != "" {
+		options = append(options, fmt.Sprintf(`ldapbinddn="%s"`, bindDN), fmt.Sprintf(`ldapbindpasswd="%s"`, bindPassword))
+	}
+
+	return fmt.Sprintf("hostssl all +%s %s ldap %s", ldapRole(ldap), addresses, strings.Join(options, " "))
+}
+
+// ldapPgHbaRules returns the pg_hba rules of the LDAP authentication, with the bind credentials from their secret.
+// They come first, as Postgres uses the first matching rule.
+func (c *Cluster) ldapPgHbaRules() ([]string, error) {
+	ldap := c.Spec.LDAP
+	if ldap == nil {
+		return nil, nil
+	}
+	var bindDN, bindPassword string
+	if ldap.BindSecret != "" {
+		secret, err := c.KubeClient.Secrets(c.Namespace).Get(ldap.BindSecret, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("could not get LDAP bind secret %q: %v", ldap.BindSecret, err)
+		}
+		bindDN, bindPassword = string(secret.Data["username"]), string(secret.Data["password"])
+		if bindDN == "" || strings.ContainsAny(bindDN+bindPassword, "\"\n") {
+			return nil, fmt.Errorf("LDAP bind secret %q must hold a username and a password without double quotes or line breaks", ldap.BindSecret)
+		}
+	}
+
+	return []string{ldapPgHbaRule(ldap, bindDN, bindPassword)}, nil
+}
+
+// initLDAPRoles adds the NOLOGIN role of the LDAP authentication and its login users, which have no password of
+// their own and therefore no secret. Roles defined elsewhere with the same names join the LDAP role.
+func (c *Cluster) initLDAPRoles() error {
+	if c.Spec.LDAP == nil {
+		return nil
+	}
+	role := ldapRole(c.Spec.LDAP)
+	if _, present := c.pgUsers[role]; !present {
+		c.addPreparedRole(role, nil)
+	}
+	for _, username := range c.Spec.LDAP.Users {
+		if !isValidUsername(username) {
+			return fmt.Errorf("invalid LDAP username: %q", username)
+		}
+		if c.shouldAvoidProtectedOrSystemRole(username, "LDAP user") {
+			continue
+		}
+		if user, present := c.pgUsers[username]; present {
+			if !util.SliceContains(user.MemberOf, role) {
+				user.MemberOf = append(user.MemberOf, role)
+				c.pgUsers[username] = user
+			}
+			continue
+		}
+		c.pgUsers[username] = spec.PgUser{
+			Name:     username,
+			Flags:    []string{constants.RoleFlagLogin},
+			MemberOf: []string{role},
+		}
+	}
+
+	return nil
+}
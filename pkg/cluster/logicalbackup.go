@@ -0,0 +1,285 @@
+package cluster
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+	batchv1 "k8s.io/client-go/pkg/apis/batch/v1"
+	batchv2alpha1 "k8s.io/client-go/pkg/apis/batch/v2alpha1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+// the image provides bash, pg_dumpall, pg_dump, the AWS CLI and the Azure CLI; the dumps are streamed into the S3
+// bucket or uploaded into the Azure container, one directory per run, and the oldest runs beyond the
+// LOGICAL_BACKUP_RETAIN are deleted afterwards
+const logicalBackupCommand = `set -euo pipefail
+run=$(date -u +%Y%m%dT%H%M%SZ)
+if [ -n "${LOGICAL_BACKUP_AZ_CONTAINER:-}" ]; then
+    auth_mode=key
+    if [ -z "${AZURE_STORAGE_SAS_TOKEN:-}" ]; then
+        az login --identity ${AZURE_CLIENT_ID:+--username "$AZURE_CLIENT_ID"} > /dev/null
+        auth_mode=login
+    fi
+    upload() {
+        local file
+        file=$(mktemp)
+        cat > "$file"
+        az storage blob upload --only-show-errors --auth-mode "$auth_mode" --container-name "$LOGICAL_BACKUP_AZ_CONTAINER" \
+            --name "$LOGICAL_BACKUP_AZ_PREFIX/$run/$1" --file "$file" > /dev/null
+        rm -f "$file"
+    }
+    runs() {
+        az storage blob list --only-show-errors --auth-mode "$auth_mode" --container-name "$LOGICAL_BACKUP_AZ_CONTAINER" \
+            --prefix "$LOGICAL_BACKUP_AZ_PREFIX/" --query "[].name" --output tsv | sed "s|^$LOGICAL_BACKUP_AZ_PREFIX/||" |
+            cut -d/ -f1 | sort -u
+    }
+    remove() {
+        az storage blob delete-batch --only-show-errors --auth-mode "$auth_mode" --source "$LOGICAL_BACKUP_AZ_CONTAINER" \
+            --pattern "$LOGICAL_BACKUP_AZ_PREFIX/$1/*"
+    }
+else
+    if [ "${LOGICAL_BACKUP_S3_FORCE_PATH_STYLE:-}" = true ]; then
+        aws configure set default.s3.addressing_style path
+    fi
+    upload() {
+        aws s3 cp ${LOGICAL_BACKUP_S3_ENDPOINT:+--endpoint-url "$LOGICAL_BACKUP_S3_ENDPOINT"} - \
+            "s3://$LOGICAL_BACKUP_S3_BUCKET/$LOGICAL_BACKUP_S3_PREFIX/$run/$1"
+    }
+    runs() {
+        aws s3 ls ${LOGICAL_BACKUP_S3_ENDPOINT:+--endpoint-url "$LOGICAL_BACKUP_S3_ENDPOINT"} \
+            "s3://$LOGICAL_BACKUP_S3_BUCKET/$LOGICAL_BACKUP_S3_PREFIX/" | awk '$1 == "PRE" { sub("/$", "", $2); print $2 }' | sort
+    }
+    remove() {
+        aws s3 rm --only-show-errors --recursive ${LOGICAL_BACKUP_S3_ENDPOINT:+--endpoint-url "$LOGICAL_BACKUP_S3_ENDPOINT"} \
+            "s3://$LOGICAL_BACKUP_S3_BUCKET/$LOGICAL_BACKUP_S3_PREFIX/$1/"
+    }
+fi
+if [ -z "${LOGICAL_BACKUP_DATABASES:-}" ]; then
+    pg_dumpall | gzip | upload dumpall.sql.gz
+else
+    for database in $LOGICAL_BACKUP_DATABASES; do
+        pg_dump --format=custom "$database" | upload "$database.dump"
+    done
+fi
+if [ "${LOGICAL_BACKUP_RETAIN:-0}" -gt 0 ]; then
+    runs | head -n -"$LOGICAL_BACKUP_RETAIN" | while read -r old; do
+        echo "deleting the logical backup $old"
+        remove "$old"
+    done
+fi`
+
+// the pods of the jobs must not carry the labels of the cluster, as those select the Postgres pods
+const logicalBackupApplication = "spilo-logical-backup"
+
+func (c *Cluster) logicalBackupJobName() string {
+	return "logical-backup-" + c.Name
+}
+
+// logicalBackupBucketConfigured checks if the dumps can be uploaded, either to the logical backup bucket or to the
+// Azure container of the WAL archive.
+func (c *Cluster) logicalBackupBucketConfigured() bool {
+	return c.OpConfig.LogicalBackupS3Bucket != "" || c.azureArchive(&c.Spec) != nil
+}
+
+// logicalBackupSchedule returns the schedule of the manifest or the default one of the operator configuration.
+func (c *Cluster) logicalBackupSchedule() string {
+	if c.Spec.LogicalBackupSchedule != "" {
+		return c.Spec.LogicalBackupSchedule
+	}
+	return c.OpConfig.LogicalBackupSchedule
+}
+
+// logicalBackupPrefix returns the per-cluster prefix of the dumps in the bucket, next to the WAL archive.
+func (c *Cluster) logicalBackupPrefix() string {
+	return fmt.Sprintf("spilo/%s%s/logical_backups", c.Name, getWALBucketScopeSuffix(string(c.Postgresql.GetUID())))
+}
+
+// generateLogicalBackupS3EndpointEnvironment makes the AWS CLI of the job upload to the S3-compatible storage.
+func generateLogicalBackupS3EndpointEnvironment(endpoint *spec.S3Endpoint) []v1.EnvVar {
+	result := make([]v1.EnvVar, 0)
+	if endpoint.Region != "" {
+		result = append(result, v1.EnvVar{Name: "AWS_DEFAULT_REGION", Value: endpoint.Region})
+	}
+	if endpoint.Endpoint != "" {
+		result = append(result, v1.EnvVar{Name: "LOGICAL_BACKUP_S3_ENDPOINT", Value: endpoint.Endpoint})
+		if endpoint.ForcePathStyle != nil && *endpoint.ForcePathStyle {
+			result = append(result, v1.EnvVar{Name: "LOGICAL_BACKUP_S3_FORCE_PATH_STYLE", Value: "true"})
+		}
+	}
+	if endpoint.CACertSecret != "" {
+		result = append(result, v1.EnvVar{Name: "AWS_CA_BUNDLE", Value: s3CACertFile})
+	}
+	return result
+}
+
+// generateLogicalBackupJob returns the CronJob dumping the databases of the cluster from its master service. The
+// runs don't overlap and the failed ones are not retried, the next run takes a new dump anyway.
+func (c *Cluster) generateLogicalBackupJob() *batchv2alpha1.CronJob {
+	superuser := c.systemUsers[constants.SuperuserKeyName].Name
+	envVars := []v1.EnvVar{
+		{Name: "PGHOST", Value: c.serviceName(Master)},
+		{Name: "PGPORT", Value: "5432"},
+		{Name: "PGDATABASE", Value: "postgres"},
+		{Name: "PGSSLMODE", Value: "require"},
+		{Name: "PGUSER", Value: superuser},
+		{
+			Name: "PGPASSWORD",
+			ValueFrom: &v1.EnvVarSource{
+				SecretKeyRef: &v1.SecretKeySelector{
+					LocalObjectReference: v1.LocalObjectReference{
+						Name: c.credentialSecretName(superuser),
+					},
+					Key: "password",
+				},
+			},
+		},
+	}
+	// the clusters archiving to Azure keep the dumps in the container of the archive
+	if azureArchive := c.azureArchive(&c.Spec); azureArchive != nil {
+		envVars = append(envVars,
+			v1.EnvVar{Name: "AZURE_STORAGE_ACCOUNT", Value: azureArchive.StorageAccount},
+			v1.EnvVar{Name: "LOGICAL_BACKUP_AZ_CONTAINER", Value: azureArchive.Container},
+			v1.EnvVar{Name: "LOGICAL_BACKUP_AZ_PREFIX", Value: c.logicalBackupPrefix()})
+		envVars = append(envVars, generateAzureCredentialsEnvironment(azureArchive, "")...)
+	} else {
+		envVars = append(envVars,
+			v1.EnvVar{Name: "LOGICAL_BACKUP_S3_BUCKET", Value: c.OpConfig.LogicalBackupS3Bucket},
+			v1.EnvVar{Name: "LOGICAL_BACKUP_S3_PREFIX", Value: c.logicalBackupPrefix()})
+		if s3Endpoint := c.s3Endpoint(&c.Spec); s3Endpoint != nil {
+			envVars = append(envVars, generateLogicalBackupS3EndpointEnvironment(s3Endpoint)...)
+		}
+	}
+	if _, _, retain := c.backupRetention(&c.Spec); retain > 0 {
+		envVars = append(envVars, v1.EnvVar{Name: "LOGICAL_BACKUP_RETAIN", Value: strconv.Itoa(retain)})
+	}
+	if len(c.Spec.LogicalBackupDatabases) > 0 {
+		envVars = append(envVars, v1.EnvVar{Name: "LOGICAL_BACKUP_DATABASES",
+			Value: strings.Join(c.Spec.LogicalBackupDatabases, " ")})
+	}
+
+	historyLimit := int32(3)
+
+	job := &batchv2alpha1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      c.logicalBackupJobName(),
+			Namespace: c.Namespace,
+			Labels:    c.labelsSet(),
+		},
+		Spec: batchv2alpha1.CronJobSpec{
+			Schedule:                   c.logicalBackupSchedule(),
+			ConcurrencyPolicy:          batchv2alpha1.ForbidConcurrent,
+			SuccessfulJobsHistoryLimit: &historyLimit,
+			FailedJobsHistoryLimit:     &historyLimit,
+			JobTemplate: batchv2alpha1.JobTemplateSpec{
+				Spec: batchv1.JobSpec{
+					Template: v1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: map[string]string{
+								"application":       logicalBackupApplication,
+								"logical-backup-of": c.Name,
+							},
+							Annotations: c.podIAMAnnotations(c.iamRole(&c.Spec)),
+						},
+						Spec: v1.PodSpec{
+							ServiceAccountName: c.podServiceAccountName(c.iamRole(&c.Spec)),
+							RestartPolicy:      v1.RestartPolicyNever,
+							Containers: []v1.Container{
+								{
+									Name:    "logical-backup",
+									Image:   c.OpConfig.LogicalBackupDockerImage,
+									Command: []string{"/bin/bash", "-c", logicalBackupCommand},
+									Env:     envVars,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if s3Endpoint := c.s3Endpoint(&c.Spec); s3Endpoint != nil && s3Endpoint.CACertSecret != "" && c.azureArchive(&c.Spec) == nil {
+		addSecretVolume(&job.Spec.JobTemplate.Spec.Template.Spec, constants.S3CACertVolumeName, s3Endpoint.CACertSecret,
+			constants.S3CACertMount)
+	}
+
+	return job
+}
+
+// syncLogicalBackupJob creates, updates or deletes the CronJob of the logical backups according to the manifest.
+func (c *Cluster) syncLogicalBackupJob() error {
+	c.setProcessName("syncing logical backup job")
+
+	job, err := c.KubeClient.CronJobs(c.Namespace).Get(c.logicalBackupJobName(), metav1.GetOptions{})
+	if err != nil && !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not get logical backup job: %v", err)
+	}
+	if err != nil {
+		job = nil
+	}
+
+	if !c.Spec.EnableLogicalBackup {
+		if job == nil {
+			return nil
+		}
+		c.LogicalBackupJob = job
+		return c.deleteLogicalBackupJob()
+	}
+	if !c.logicalBackupBucketConfigured() {
+		return fmt.Errorf("could not sync logical backup job: no logical backup bucket is configured")
+	}
+
+	desired := c.generateLogicalBackupJob()
+	if job == nil {
+		if job, err = c.KubeClient.CronJobs(c.Namespace).Create(desired); err != nil {
+			return fmt.Errorf("could not create logical backup job: %v", err)
+		}
+		c.logger.Infof("logical backup job %q has been created", util.NameFromMeta(job.ObjectMeta))
+		c.LogicalBackupJob = job
+		return nil
+	}
+	current, wanted := &job.Spec.JobTemplate.Spec.Template, &desired.Spec.JobTemplate.Spec.Template
+	if job.Spec.Schedule == desired.Spec.Schedule &&
+		reflect.DeepEqual(current.Spec.Containers[0].Env, wanted.Spec.Containers[0].Env) &&
+		reflect.DeepEqual(current.Spec.Containers[0].Command, wanted.Spec.Containers[0].Command) &&
+		current.Spec.Containers[0].Image == wanted.Spec.Containers[0].Image &&
+		current.Spec.ServiceAccountName == wanted.Spec.ServiceAccountName &&
+		reflect.DeepEqual(current.Annotations, wanted.Annotations) {
+		c.LogicalBackupJob = job
+		return nil
+	}
+	desired.ResourceVersion = job.ResourceVersion
+	if job, err = c.KubeClient.CronJobs(c.Namespace).Update(desired); err != nil {
+		return fmt.Errorf("could not update logical backup job: %v", err)
+	}
+	c.logger.Infof("logical backup job %q has been updated", util.NameFromMeta(job.ObjectMeta))
+	c.LogicalBackupJob = job
+
+	return nil
+}
+
+// deleteLogicalBackupJob removes the CronJob together with its jobs and their pods.
+func (c *Cluster) deleteLogicalBackupJob() error {
+	if c.LogicalBackupJob == nil {
+		return nil
+	}
+	c.setProcessName("deleting logical backup job")
+
+	propagationPolicy := metav1.DeletePropagationForeground
+	err := c.KubeClient.CronJobs(c.Namespace).Delete(c.LogicalBackupJob.Name,
+		&metav1.DeleteOptions{PropagationPolicy: &propagationPolicy})
+	if err != nil && !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not delete logical backup job: %v", err)
+	}
+	c.logger.Infof("logical backup job %q has been deleted", util.NameFromMeta(c.LogicalBackupJob.ObjectMeta))
+	c.LogicalBackupJob = nil
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package cluster
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+)
+
+// isInMaintenanceWindow checks if the time falls into one of the maintenance windows. Clusters without maintenance
+// windows can be disrupted at any time.
+func isInMaintenanceWindow(windows []spec.MaintenanceWindow, now time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+	now = now.UTC()
+	// the windows only have the time of the day, parsed as of the year 0
+	clock := time.Date(0, time.January, 1, now.Hour(), now.Minute(), 0, 0, time.UTC)
+	for _, window := range windows {
+		if !window.Everyday && window.Weekday != now.Weekday() {
+			continue
+		}
+		if !clock.Before(window.StartTime) && !clock.After(window.EndTime) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// inMaintenanceWindow checks if the disruptive actions, i.e. rolling updates, volume resizes and switchovers, can
+// run now. They are deferred until the next maintenance window otherwise.
+func (c *Cluster) inMaintenanceWindow() bool {
+	return isInMaintenanceWindow(c.Spec.MaintenanceWindows, time.Now())
+}
+
+// rollingUpdatePending checks if the pods still run an outdated template of the statefulset, because the rolling
+// update has been deferred.
+func (c *Cluster) rollingUpdatePending() bool {
+	return c.Statefulset != nil && c.Statefulset.Annotations[constants.RollingUpdateRequiredAnnotation] == "true"
+}
+
+// setRollingUpdatePending flags the statefulset, so that the deferred rolling update is not forgotten once the
+// statefulset matches the manifest.
+func (c *Cluster) setRollingUpdatePending(pending bool) error {
+	value := "null"
+	if pending {
+		value = `"true"`
+	}
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%s}}}`, constants.RollingUpdateRequiredAnnotation, value)
+	statefulSet, err := c.KubeClient.StatefulSets(c.Namespace).Patch(c.statefulSetName(), types.MergePatchType, []byte(patch))
+	if err != nil {
+		return fmt.Errorf("could not flag the statefulset: %v", err)
+	}
+	c.Statefulset = statefulSet
+
+	return nil
+}
+
+// scaleDownNeedsSwitchover checks if the master would be removed by scaling the cluster down.
+func (c *Cluster) scaleDownNeedsSwitchover(replicas int32) (bool, error) {
+	masterPods, err := c.getRolePods(Master)
+	if err != nil {
+		return false, fmt.Errorf("could not get master pod: %v", err)
+	}
+	if len(masterPods) == 0 || replicas == 0 {
+		return false, nil
+	}
+	index, err := getPodIndex(masterPods[0].Name)
+	if err != nil {
+		return false, fmt.Errorf("could not get pod number: %v", err)
+	}
+
+	return index >= replicas, nil
+}
@@ -0,0 +1,42 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+)
+
+func mustParseTime(s string) time.Time {
+	v, err := time.Parse("15:04", s)
+	if err != nil {
+		panic(err)
+	}
+
+	return v.UTC()
+}
+
+func TestIsInMaintenanceWindow(t *testing.T) {
+	// 2017-12-16 is a Saturday
+	saturday := time.Date(2017, time.December, 16, 2, 30, 0, 0, time.UTC)
+	tests := []struct {
+		windows []spec.MaintenanceWindow
+		now     time.Time
+		in      bool
+	}{
+		{nil, saturday, true},
+		{[]spec.MaintenanceWindow{{Everyday: true, StartTime: mustParseTime("01:00"), EndTime: mustParseTime("06:00")}}, saturday, true},
+		{[]spec.MaintenanceWindow{{Everyday: true, StartTime: mustParseTime("03:00"), EndTime: mustParseTime("06:00")}}, saturday, false},
+		{[]spec.MaintenanceWindow{{Weekday: time.Saturday, StartTime: mustParseTime("00:00"), EndTime: mustParseTime("04:00")}}, saturday, true},
+		{[]spec.MaintenanceWindow{{Weekday: time.Sunday, StartTime: mustParseTime("00:00"), EndTime: mustParseTime("04:00")}}, saturday, false},
+		{[]spec.MaintenanceWindow{
+			{Weekday: time.Sunday, StartTime: mustParseTime("00:00"), EndTime: mustParseTime("04:00")},
+			{Everyday: true, StartTime: mustParseTime("02:00"), EndTime: mustParseTime("02:30")},
+		}, saturday, true},
+	}
+	for _, tt := range tests {
+		if in := isInMaintenanceWindow(tt.windows, tt.now); in != tt.in {
+			t.Errorf("isInMaintenanceWindow(%+v, %v) expected: %t, got: %t", tt.windows, tt.now, tt.in, in)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+const (
+	// Spilo upgrades the master with pg_upgrade and rsyncs the result to the replicas
+	majorVersionUpgradeCommand = `PGVERSION=%s /usr/bin/python3 /scripts/inplace_upgrade.py %d 2>&1`
+
+	upgradePhaseUpgrading = "Upgrading"
+	upgradePhaseSucceeded = "Succeeded"
+	upgradePhaseFailed    = "Failed"
+)
+
+// pgVersionNumber converts the major version from the manifest, i.e. 9.6 or 10, to the format of
+// server_version_num, i.e. 90600 or 100000.
+func pgVersionNumber(version string) (int, error) {
+	parts := strings.Split(version, ".")
+	major, err := strconv.Atoi(parts[0])
+	if err != nil || len(parts) > 2 {
+		return 0, fmt.Errorf("could not parse postgresql version %q", version)
+	}
+	if major >= 10 {
+		if len(parts) > 1 {
+			return 0, fmt.Errorf("postgresql version %q has a minor version", version)
+		}
+		return major * 10000, nil
+	}
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("postgresql version %q has no minor version", version)
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, fmt.Errorf("could not parse postgresql version %q", version)
+	}
+	return major*10000 + minor*100, nil
+}
+
+// pgMajorVersion converts server_version_num to the major version as it is written in the manifest.
+func pgMajorVersion(versionNumber int) string {
+	if versionNumber >= 100000 {
+		return strconv.Itoa(versionNumber / 10000)
+	}
+	return fmt.Sprintf("%d.%d", versionNumber/10000, versionNumber/100%100)
+}
+
+// syncMajorVersion upgrades the running cluster to the major version of the manifest before the statefulset is
+// changed: the binaries of the new version can't run the old data directory. As long as the upgrade is not possible,
+// disabled or failed, the statefulset keeps the running version.
+func (c *Cluster) syncMajorVersion() error {
+	masterPods, err := c.getRolePods(Master)
+	if err != nil {
+		return fmt.Errorf("could not get master pod: %v", err)
+	}
+	if len(masterPods) == 0 {
+		c.logger.Debugf("no master pod to check the running postgresql version")
+		return nil
+	}
+	member, err := c.patroni.GetMemberData(&masterPods[0])
+	if err != nil {
+		// patroni is unavailable i.e. while the master restarts, the statefulset is safe with the binaries it has
+		running := c.statefulSetPgVersion()
+		if running == "" {
+			return fmt.Errorf("could not get the running postgresql version: %v", err)
+		}
+		c.logger.Warningf("could not get the running postgresql version, keeping the version %q of the statefulset: %v",
+			running, err)
+		c.pinPgVersion(running)
+		return nil
+	}
+	running := pgMajorVersion(member.ServerVersion)
+	c.finishInterruptedUpgrade(running)
+	if running == c.Spec.PgVersion {
+		return nil
+	}
+	target, err := pgVersionNumber(c.Spec.PgVersion)
+	if err != nil {
+		c.pinPgVersion(running)
+		return err
+	}
+
+	switch {
+	case target < member.ServerVersion:
+		c.logger.Warningf("postgresql version change (%q -> %q) has no effect: downgrades are not supported",
+			running, c.Spec.PgVersion)
+	case !c.OpConfig.EnableVersionUpgrade:
+		c.logger.Warningf("postgresql version change (%q -> %q) has no effect: major version upgrades are disabled",
+			running, c.Spec.PgVersion)
+	case c.lastVersionUpgrade() != nil && c.lastVersionUpgrade().Mode != spec.MajorUpgradeModeBlueGreen &&
+		c.lastVersionUpgrade().Phase == upgradePhaseFailed && c.lastVersionUpgrade().ToVersion == c.Spec.PgVersion:
+		c.logger.Warningf("not retrying the failed upgrade to postgresql %q, update the manifest to try again",
+			c.Spec.PgVersion)
+	case c.blueGreenUpgrade():
+		// the blue cluster keeps running the old version
+		err := c.syncGreenCluster(running, member.ServerVersion)
+		c.pinPgVersion(running)
+		return err
+	case !c.inMaintenanceWindow():
+		c.logger.Infof("upgrade to postgresql %q deferred until the next maintenance window", c.Spec.PgVersion)
+	default:
+		if err := c.majorVersionUpgrade(&masterPods[0], running); err != nil {
+			c.pinPgVersion(running)
+			return err
+		}
+		return nil
+	}
+	c.pinPgVersion(running)
+
+	return nil
+}
+
+// finishInterruptedUpgrade completes the status of the in-place upgrade the operator has been restarted in the middle of.
+// The upgrade is not resumed: it has either succeeded, or it is marked as failed to be retried after the manifest
+// has been updated, as running the upgrade script again on a partially upgraded cluster is not safe.
+func (c *Cluster) finishInterruptedUpgrade(running string) {
+	status := c.lastVersionUpgrade()
+	if c.versionUpgrade != nil || status == nil || status.Mode == spec.MajorUpgradeModeBlueGreen ||
+		status.Phase != upgradePhaseUpgrading {
+		return
+	}
+	finished := *status
+	endTime := metav1.Now()
+	finished.EndTime = &endTime
+	if running == status.ToVersion {
+		finished.Phase = upgradePhaseSucceeded
+		c.logger.Infof("postgresql has been upgraded from %q to %q while the operator was restarted",
+			status.FromVersion, status.ToVersion)
+	} else {
+		finished.Phase = upgradePhaseFailed
+		finished.Error = "the upgrade has been interrupted by the restart of the operator"
+		c.logger.Warningf("upgrade of postgresql from %q to %q has been interrupted by the restart of the operator",
+			status.FromVersion, status.ToVersion)
+	}
+	if err := c.setVersionUpgradeStatus(&finished); err != nil {
+		c.logger.Warningf("%v", err)
+	}
+}
+
+// clearVersionUpgradeStatus forgets the failed in-place upgrade, so that it is retried with the updated manifest.
+func (c *Cluster) clearVersionUpgradeStatus() {
+	status := c.lastVersionUpgrade()
+	if status == nil || status.Mode == spec.MajorUpgradeModeBlueGreen {
+		return
+	}
+	if err := c.setVersionUpgradeStatus(nil); err != nil {
+		c.logger.Warningf("%v", err)
+	}
+	c.Postgresql.MajorVersionUpgrade = nil
+}
+
+// statefulSetPgVersion returns the major version of the binaries the current statefulset runs, read from the Spilo
+// configuration of its pods, or an empty string if it can't be determined.
+func (c *Cluster) statefulSetPgVersion() string {
+	if c.Statefulset == nil {
+		return ""
+	}
+	binDirParts := strings.SplitN(pgBinariesLocationTemplate, "%s", 2)
+	for _, container := range c.Statefulset.Spec.Template.Spec.Containers {
+		for _, env := range container.Env {
+			if env.Name != "SPILO_CONFIGURATION" {
+				continue
+			}
+			var config struct {
+				PostgreSQL map[string]interface{} `json:"postgresql"`
+			}
+			if err := json.Unmarshal([]byte(env.Value), &config); err != nil {
+				return ""
+			}
+			binDir, _ := config.PostgreSQL[patroniPGBinariesParameterName].(string)
+			if !strings.HasPrefix(binDir, binDirParts[0]) || !strings.HasSuffix(binDir, binDirParts[1]) {
+				return ""
+			}
+			return strings.TrimSuffix(strings.TrimPrefix(binDir, binDirParts[0]), binDirParts[1])
+		}
+	}
+	return ""
+}
+
+// pinPgVersion makes the statefulset keep the running major version.
+func (c *Cluster) pinPgVersion(version string) {
+	c.specMu.Lock()
+	c.Spec.PgVersion = version
+	c.specMu.Unlock()
+}
+
+// majorVersionUpgrade runs the upgrade script of Spilo in the master pod. All pods must be running, as the replicas
+// are upgraded along with the master.
+func (c *Cluster) majorVersionUpgrade(masterPod *v1.Pod, fromVersion string) error {
+	toVersion := c.Spec.PgVersion
+	c.setProcessName("upgrading postgresql from %q to %q", fromVersion, toVersion)
+
+	pods, err := c.listPods()
+	if err != nil {
+		return err
+	}
+	instances := c.getNumberOfInstances(&c.Spec)
+	for i := range pods {
+		if !podIsReady(&pods[i]) {
+			return fmt.Errorf("could not upgrade postgresql: pod %q is not ready", pods[i].Name)
+		}
+	}
+	if int32(len(pods)) != instances {
+		return fmt.Errorf("could not upgrade postgresql: %d pods are running instead of %d", len(pods), instances)
+	}
+
+	// without the persisted progress a restart of the operator during the upgrade would go unnoticed
+	err = c.setVersionUpgradeStatus(&spec.MajorVersionUpgradeStatus{
+		FromVersion: fromVersion,
+		ToVersion:   toVersion,
+		Mode:        spec.MajorUpgradeModeInPlace,
+		Phase:       upgradePhaseUpgrading,
+		StartTime:   metav1.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("could not start the upgrade: %v", err)
+	}
+	c.logger.Infof("upgrading postgresql from %q to %q", fromVersion, toVersion)
+	c.setStatus(spec.ClusterStatusUpgrading)
+	c.recordEvent(v1.EventTypeNormal, constants.EventReasonUpgradeStarted, "upgrading postgresql from %q to %q",
+		fromVersion, toVersion)
+
+	podName := util.NameFromMeta(masterPod.ObjectMeta)
+	command := fmt.Sprintf(majorVersionUpgradeCommand, toVersion, instances)
+	_, err = c.ExecCommand(&podName, "/bin/su", "postgres", "-c", command)
+
+	status := *c.versionUpgrade
+	endTime := metav1.Now()
+	status.EndTime = &endTime
+	if err != nil {
+		status.Phase = upgradePhaseFailed
+		status.Error = err.Error()
+		if err := c.setVersionUpgradeStatus(&status); err != nil {
+			c.logger.Warningf("%v", err)
+		}
+		c.setStatus(spec.ClusterStatusUpgradeFailed)
+		c.recordEvent(v1.EventTypeWarning, constants.EventReasonUpgradeFailed, "could not upgrade postgresql to %q: %s",
+			toVersion, status.Error)
+		return fmt.Errorf("could not upgrade postgresql to %q: %s", toVersion, status.Error)
+	}
+	status.Phase = upgradePhaseSucceeded
+	if err := c.setVersionUpgradeStatus(&status); err != nil {
+		c.logger.Warningf("%v", err)
+	}
+	c.recordEvent(v1.EventTypeNormal, constants.EventReasonUpgraded, "upgraded postgresql from %q to %q",
+		fromVersion, toVersion)
+	c.logger.Infof("postgresql has been upgraded from %q to %q", fromVersion, toVersion)
+
+	return nil
+}
+
+// setVersionUpgradeStatus writes the progress of the upgrade to the majorVersionUpgrade section of the
+// postgresql object, where it is picked up after a restart of the operator. A nil status removes the section.
+func (c *Cluster) setVersionUpgradeStatus(status *spec.MajorVersionUpgradeStatus) error {
+	c.versionUpgrade = status
+
+	patch, err := json.Marshal(map[string]interface{}{"majorVersionUpgrade": status})
+	if err != nil {
+		return fmt.Errorf("could not marshal status of the upgrade: %v", err)
+	}
+	_, err = c.KubeClient.CRDREST.Patch(types.MergePatchType).
+		Namespace(c.Namespace).
+		Resource(constants.CRDResource).
+		Name(c.Name).
+		Body(patch).
+		DoRaw()
+	if err != nil && !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not set the upgrade status of the cluster: %v", err)
+	}
+	return nil
+}
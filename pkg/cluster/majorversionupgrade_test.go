@@ -0,0 +1,63 @@
+package cluster
+
+import (
+	"testing"
+
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/apps/v1beta1"
+)
+
+func TestPgVersionNumber(t *testing.T) {
+	tests := []struct {
+		version string
+		number  int
+		valid   bool
+	}{
+		{"9.5", 90500, true},
+		{"9.6", 90600, true},
+		{"10", 100000, true},
+		{"11", 110000, true},
+		{"9", 0, false},
+		{"10.1", 0, false},
+		{"9.6.3", 0, false},
+		{"latest", 0, false},
+	}
+	for _, tt := range tests {
+		number, err := pgVersionNumber(tt.version)
+		if (err == nil) != tt.valid {
+			t.Errorf("expected valid %t for %q, got error: %v", tt.valid, tt.version, err)
+			continue
+		}
+		if number != tt.number {
+			t.Errorf("expected %d for %q, got %d", tt.number, tt.version, number)
+		}
+		if tt.valid && pgMajorVersion(number+4) != tt.version {
+			t.Errorf("expected major version %q for %d, got %q", tt.version, number+4, pgMajorVersion(number+4))
+		}
+	}
+}
+
+func TestStatefulSetPgVersion(t *testing.T) {
+	tests := []struct {
+		configuration string
+		version       string
+	}{
+		{`{"postgresql": {"bin_dir": "/usr/lib/postgresql/10/bin"}, "bootstrap": {}}`, "10"},
+		{`{"postgresql": {"bin_dir": "/usr/lib/postgresql/9.6/bin"}}`, "9.6"},
+		{`{"postgresql": {"bin_dir": "/opt/pg/bin"}}`, ""},
+		{`{"postgresql": {}}`, ""},
+		{`not json`, ""},
+	}
+	for _, tt := range tests {
+		c := &Cluster{Statefulset: &v1beta1.StatefulSet{}}
+		c.Statefulset.Spec.Template.Spec.Containers = []v1.Container{
+			{Name: "postgres", Env: []v1.EnvVar{{Name: "SPILO_CONFIGURATION", Value: tt.configuration}}},
+		}
+		if version := c.statefulSetPgVersion(); version != tt.version {
+			t.Errorf("expected version %q for %s, got %q", tt.version, tt.configuration, version)
+		}
+	}
+	if version := (&Cluster{}).statefulSetPgVersion(); version != "" {
+		t.Errorf("expected no version without a statefulset, got %q", version)
+	}
+}
@@ -0,0 +1,98 @@
+package cluster
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/util/config"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+// CollectOrphanedVolumeClaims applies the orphaned PVC policy of the operator to the given claims. The claims are
+// flagged with the time they have been found orphaned first; with the delete policy they are removed once the grace
+// period has passed since then. Claims retained on purpose when their cluster has been deleted are never touched.
+func CollectOrphanedVolumeClaims(client k8sutil.KubernetesClient, opConfig *config.Config, pvcs []v1.PersistentVolumeClaim, logger *logrus.Entry) error {
+	if opConfig.OrphanedPVCPolicy == constants.OrphanedPVCPolicyIgnore {
+		return nil
+	}
+	now := time.Now()
+	for _, pvc := range pvcs {
+		if _, ok := pvc.Annotations[constants.RetainedVolumeAnnotation]; ok {
+			continue
+		}
+		if _, ok := pvc.Annotations[constants.RetainedMasterVolumeAnnotation]; ok {
+			continue
+		}
+		orphanedSince, err := time.Parse(time.RFC3339, pvc.Annotations[constants.OrphanedVolumeAnnotation])
+		if err != nil {
+			patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, constants.OrphanedVolumeAnnotation, now.UTC().Format(time.RFC3339))
+			if _, err := client.PersistentVolumeClaims(pvc.Namespace).Patch(pvc.Name, types.MergePatchType, []byte(patch)); err != nil {
+				return fmt.Errorf("could not flag persistent volume claim %q as orphaned: %v", pvc.Name, err)
+			}
+			logger.Warningf("persistent volume claim %q is orphaned", pvc.Name)
+			continue
+		}
+		if opConfig.OrphanedPVCPolicy != constants.OrphanedPVCPolicyDelete || now.Sub(orphanedSince) < opConfig.OrphanedPVCGracePeriod {
+			continue
+		}
+		if err := client.PersistentVolumeClaims(pvc.Namespace).Delete(pvc.Name, &metav1.DeleteOptions{}); err != nil && !k8sutil.ResourceNotFound(err) {
+			return fmt.Errorf("could not delete orphaned persistent volume claim %q: %v", pvc.Name, err)
+		}
+		logger.Infof("deleted persistent volume claim %q orphaned since %s", pvc.Name, orphanedSince)
+	}
+
+	return nil
+}
+
+// syncOrphanedVolumeClaims collects the claims left behind by the pods removed when the cluster has been scaled down,
+// and clears the flag of the orphaned claims that are used again after scaling up.
+func (c *Cluster) syncOrphanedVolumeClaims() error {
+	// the claims of the hibernated or stopped cluster are used again when it is resumed
+	if c.OpConfig.OrphanedPVCPolicy == constants.OrphanedPVCPolicyIgnore || c.statefulSetReplicas() == 0 || c.Spec.Hibernated {
+		return nil
+	}
+	pvcs, err := c.listPersistentVolumeClaims()
+	if err != nil {
+		return fmt.Errorf("could not list persistent volume claims: %v", err)
+	}
+	replicas := c.statefulSetReplicas()
+	orphaned := make([]v1.PersistentVolumeClaim, 0)
+	for _, pvc := range pvcs {
+		index, ok := c.claimPodIndex(&pvc)
+		if !ok {
+			continue
+		}
+		if int32(index) >= replicas {
+			orphaned = append(orphaned, pvc)
+			continue
+		}
+		if _, ok := pvc.Annotations[constants.OrphanedVolumeAnnotation]; ok {
+			patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:null}}}`, constants.OrphanedVolumeAnnotation)
+			if _, err := c.KubeClient.PersistentVolumeClaims(pvc.Namespace).Patch(pvc.Name, types.MergePatchType, []byte(patch)); err != nil {
+				return fmt.Errorf("could not clear orphaned flag of the persistent volume claim %q: %v", pvc.Name, err)
+			}
+			c.logger.Infof("persistent volume claim %q is used again", pvc.Name)
+		}
+	}
+
+	return CollectOrphanedVolumeClaims(c.KubeClient, &c.OpConfig, orphaned, c.logger)
+}
+
+// claimPodIndex returns the index of the pod the claim of one of the cluster volumes has been created for.
+func (c *Cluster) claimPodIndex(pvc *v1.PersistentVolumeClaim) (int, bool) {
+	for _, volume := range persistentClusterVolumes(&c.Spec) {
+		if !c.claimBelongsToVolume(pvc, volume.name) {
+			continue
+		}
+		index, err := strconv.Atoi(pvc.Name[len(volume.name)+len(c.statefulSetName())+2:])
+		return index, err == nil
+	}
+	return 0, false
+}
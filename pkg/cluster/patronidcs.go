@@ -0,0 +1,58 @@
+package cluster
+
+import (
+	"fmt"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+)
+
+// patroniDCSConfig returns the settings of the dcs section of the manifest as keys of the dynamic configuration of
+// Patroni, removing the supported keys missing from the manifest.
+func patroniDCSConfig(patroni *spec.Patroni) (map[string]interface{}, error) {
+	settings, err := spec.PatroniDCSSettings(patroni.DCS)
+	if err != nil {
+		return nil, err
+	}
+	config := make(map[string]interface{})
+	for _, key := range spec.PatroniDCSKeys() {
+		config[key] = nil
+	}
+	for key, value := range settings {
+		config[key] = value
+	}
+	return config, nil
+}
+
+// syncPatroniDCS sets the settings of the dcs section of the manifest in the dynamic configuration of the cluster,
+// from where Patroni applies them to all members. The bootstrap configuration only applies to the new clusters.
+func (c *Cluster) syncPatroniDCS() error {
+	c.setProcessName("syncing Patroni settings")
+
+	desired, err := patroniDCSConfig(&c.Spec.Patroni)
+	if err != nil {
+		return fmt.Errorf("invalid dcs settings: %v", err)
+	}
+	masterPods, err := c.getRolePods(Master)
+	if err != nil {
+		return fmt.Errorf("could not get master pod: %v", err)
+	}
+	if len(masterPods) == 0 || !podIsReady(&masterPods[0]) {
+		c.logger.Debugf("no running master pod, not syncing Patroni settings")
+		return nil
+	}
+
+	config, err := c.patroni.GetConfig(&masterPods[0])
+	if err != nil {
+		return fmt.Errorf("could not get dynamic configuration: %v", err)
+	}
+	changes := dynamicConfigChanges(desired, config)
+	if len(changes) == 0 {
+		return nil
+	}
+	if err := c.patroni.SetConfig(&masterPods[0], changes); err != nil {
+		return fmt.Errorf("could not set Patroni settings: %v", err)
+	}
+	c.logger.Infof("Patroni settings have been updated: %v", changes)
+
+	return nil
+}
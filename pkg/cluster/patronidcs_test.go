@@ -0,0 +1,36 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+)
+
+func TestPatroniDCSConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		dcs     map[string]string
+		current map[string]interface{}
+		changes map[string]interface{}
+	}{
+		{"nothing set", nil, map[string]interface{}{"ttl": 30.0}, map[string]interface{}{}},
+		{"added", map[string]string{"master_start_timeout": "300"}, map[string]interface{}{},
+			map[string]interface{}{"master_start_timeout": 300}},
+		{"unchanged", map[string]string{"master_start_timeout": "300", "check_timeline": "true"},
+			map[string]interface{}{"master_start_timeout": 300.0, "check_timeline": true}, map[string]interface{}{}},
+		{"removed", map[string]string{"check_timeline": "true"},
+			map[string]interface{}{"master_start_timeout": 300.0, "check_timeline": true},
+			map[string]interface{}{"master_start_timeout": nil}},
+	}
+	for _, tt := range tests {
+		desired, err := patroniDCSConfig(&spec.Patroni{DCS: tt.dcs})
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if changes := dynamicConfigChanges(desired, tt.current); !reflect.DeepEqual(changes, tt.changes) {
+			t.Errorf("%s: expected the changes %v, got: %v", tt.name, tt.changes, changes)
+		}
+	}
+}
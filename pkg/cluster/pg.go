@@ -16,7 +16,10 @@ import (
 
 const (
 	getUserSQL = `SELECT a.rolname, COALESCE(a.rolpassword, ''), a.rolsuper, a.rolinherit,
-	        a.rolcreaterole, a.rolcreatedb, a.rolcanlogin, s.setconfig,
+	        a.rolcreaterole, a.rolcreatedb, a.rolcanlogin, a.rolreplication, a.rolbypassrls, a.rolconnlimit,
+	        CASE WHEN a.rolvaliduntil IS NULL OR a.rolvaliduntil = 'infinity' THEN 'infinity'
+	             ELSE to_char(a.rolvaliduntil AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"') END,
+	        s.setconfig,
 	        ARRAY(SELECT b.rolname
 	              FROM pg_catalog.pg_auth_members m
 	              JOIN pg_catalog.pg_authid b ON (m.roleid = b.oid)
@@ -28,16 +31,36 @@ const (
 	getDatabasesSQL       = `SELECT datname, pg_get_userbyid(datdba) AS owner FROM pg_database;`
 	createDatabaseSQL     = `CREATE DATABASE "%s" OWNER "%s";`
 	alterDatabaseOwnerSQL = `ALTER DATABASE "%s" OWNER TO "%s";`
+	dropDatabaseSQL       = `DROP DATABASE "%s";`
+	terminateBackendsSQL  = `SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = $1 AND pid <> pg_backend_pid();`
+	getTablespacesSQL     = `SELECT spcname, pg_tablespace_location(oid) FROM pg_tablespace;`
+	createTablespaceSQL   = `CREATE TABLESPACE "%s" LOCATION '%s';`
+	checkpointSQL         = `CHECKPOINT;`
 )
 
 func (c *Cluster) pgConnectionString() string {
-	password := c.systemUsers[constants.SuperuserKeyName].Password
-
-	return fmt.Sprintf("host='%s' dbname=postgres sslmode=require user='%s' password='%s' connect_timeout='%d'",
-		fmt.Sprintf("%s.%s.svc.cluster.local", c.Name, c.Namespace),
+	return connectionString(fmt.Sprintf("%s.%s.svc.cluster.local", c.Name, c.Namespace), "postgres",
 		c.systemUsers[constants.SuperuserKeyName].Name,
-		strings.Replace(password, "$", "\\$", -1),
-		constants.PostgresConnectTimeout/time.Second)
+		c.systemUsers[constants.SuperuserKeyName].Password)
+}
+
+func connectionString(host, dbname, user, password string) string {
+	return fmt.Sprintf("host='%s' dbname='%s' sslmode=require user='%s' password='%s' connect_timeout='%d'",
+		host, dbname, user, strings.Replace(password, "$", "\\$", -1), constants.PostgresConnectTimeout/time.Second)
+}
+
+// openConnection connects to a database other than the one behind c.pgDb, i.e. of another cluster.
+func openConnection(host, dbname, user, password string) (*sql.DB, error) {
+	conn, err := sql.Open("postgres", connectionString(host, dbname, user, password))
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
 }
 
 func (c *Cluster) databaseAccessDisabled() bool {
@@ -124,16 +147,22 @@ func (c *Cluster) readPgUsersFromDatabase(userNames []string) (users spec.PgUser
 
 	for rows.Next() {
 		var (
-			rolname, rolpassword                                          string
+			rolname, rolpassword, rolvaliduntil                           string
 			rolsuper, rolinherit, rolcreaterole, rolcreatedb, rolcanlogin bool
+			rolreplication, rolbypassrls                                  bool
+			rolconnlimit                                                  int
 			roloptions, memberof                                          []string
 		)
 		err := rows.Scan(&rolname, &rolpassword, &rolsuper, &rolinherit,
-			&rolcreaterole, &rolcreatedb, &rolcanlogin, pq.Array(&roloptions), pq.Array(&memberof))
+			&rolcreaterole, &rolcreatedb, &rolcanlogin, &rolreplication, &rolbypassrls, &rolconnlimit, &rolvaliduntil,
+			pq.Array(&roloptions), pq.Array(&memberof))
 		if err != nil {
 			return nil, fmt.Errorf("error when processing user rows: %v", err)
 		}
-		flags := makeUserFlags(rolsuper, rolinherit, rolcreaterole, rolcreatedb, rolcanlogin)
+		flags := makeUserFlags(rolsuper, rolinherit, rolcreaterole, rolcreatedb, rolcanlogin, rolreplication, rolbypassrls)
+		flags = append(flags,
+			fmt.Sprintf("%s %d", constants.RoleConnectionLimit, rolconnlimit),
+			fmt.Sprintf("%s '%s'", constants.RoleValidUntil, rolvaliduntil))
 		// XXX: the code assumes the password we get from pg_authid is always MD5
 		parameters := make(map[string]string)
 		for _, option := range roloptions {
@@ -210,6 +239,61 @@ func (c *Cluster) executeAlterDatabaseOwner(datname string, owner string) error
 	return nil
 }
 
+// executeDropDatabase drops the given database, disconnecting its clients first.
+// The caller is responsible for opening and closing the database connection.
+func (c *Cluster) executeDropDatabase(datname string) error {
+	if !databaseNameRegexp.MatchString(datname) {
+		c.logger.Infof("database %q has invalid name", datname)
+		return nil
+	}
+	c.logger.Infof("dropping database %q", datname)
+	if _, err := c.pgDb.Exec(terminateBackendsSQL, datname); err != nil {
+		return fmt.Errorf("could not terminate connections to the database: %v", err)
+	}
+	if _, err := c.pgDb.Exec(fmt.Sprintf(dropDatabaseSQL, datname)); err != nil {
+		return fmt.Errorf("could not execute drop database: %v", err)
+	}
+	return nil
+}
+
+// getTablespaces returns the map of current tablespaces with their locations
+// The caller is responsible for opening and closing the database connection
+func (c *Cluster) getTablespaces() (tablespaces map[string]string, err error) {
+	var rows *sql.Rows
+	tablespaces = make(map[string]string)
+
+	if rows, err = c.pgDb.Query(getTablespacesSQL); err != nil {
+		return nil, fmt.Errorf("could not query tablespaces: %v", err)
+	}
+
+	defer func() {
+		if err2 := rows.Close(); err2 != nil {
+			err = fmt.Errorf("error when closing query cursor: %v", err2)
+		}
+	}()
+
+	for rows.Next() {
+		var spcname, location string
+
+		if err := rows.Scan(&spcname, &location); err != nil {
+			return nil, fmt.Errorf("error when processing row: %v", err)
+		}
+		tablespaces[spcname] = location
+	}
+
+	return tablespaces, err
+}
+
+// executeCreateTablespace creates new tablespace in the given location.
+// The caller is responsible for opening and closing the database connection.
+func (c *Cluster) executeCreateTablespace(spcname, location string) error {
+	c.logger.Infof("creating tablespace %q in %q", spcname, location)
+	if _, err := c.pgDb.Exec(fmt.Sprintf(createTablespaceSQL, spcname, location)); err != nil {
+		return fmt.Errorf("could not execute create tablespace: %v", err)
+	}
+	return nil
+}
+
 func (c *Cluster) databaseNameOwnerValid(datname, owner string) bool {
 	if _, ok := c.pgUsers[owner]; !ok {
 		c.logger.Infof("skipping creation of the %q database, user %q does not exist", datname, owner)
@@ -223,18 +307,30 @@ func (c *Cluster) databaseNameOwnerValid(datname, owner string) bool {
 	return true
 }
 
-func makeUserFlags(rolsuper, rolinherit, rolcreaterole, rolcreatedb, rolcanlogin bool) (result []string) {
-	if rolsuper {
-		result = append(result, constants.RoleFlagSuperuser)
-	}
-	if rolinherit {
-		result = append(result, constants.RoleFlagInherit)
-	}
-	if rolcreaterole {
-		result = append(result, constants.RoleFlagCreateRole)
-	}
-	if rolcreatedb {
-		result = append(result, constants.RoleFlagCreateDB)
+// isSystemDatabase checks if the database is created by initdb and must never be dropped.
+func isSystemDatabase(datname string) bool {
+	return datname == "postgres" || datname == "template0" || datname == "template1"
+}
+
+// makeUserFlags returns the flags of the role, including the negated ones, so that the flags removed in the manifest
+// with a NO flag are revoked. NOLOGIN is never returned, see normalizeUserFlags.
+func makeUserFlags(rolsuper, rolinherit, rolcreaterole, rolcreatedb, rolcanlogin, rolreplication, rolbypassrls bool) (result []string) {
+	for _, f := range []struct {
+		flag string
+		set  bool
+	}{
+		{constants.RoleFlagSuperuser, rolsuper},
+		{constants.RoleFlagInherit, rolinherit},
+		{constants.RoleFlagCreateRole, rolcreaterole},
+		{constants.RoleFlagCreateDB, rolcreatedb},
+		{constants.RoleFlagReplication, rolreplication},
+		{constants.RoleFlagByPassRLS, rolbypassrls},
+	} {
+		if f.set {
+			result = append(result, f.flag)
+		} else {
+			result = append(result, "NO"+f.flag)
+		}
 	}
 	if rolcanlogin {
 		result = append(result, constants.RoleFlagLogin)
@@ -0,0 +1,306 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/cron"
+)
+
+const (
+	pgBackRestInfoCommand  = "pgbackrest info --output=json"
+	pgBackRestStanzaCreate = "pgbackrest stanza-create 2>&1"
+	// the scheduled backups outlive the exec session, their output is kept for troubleshooting
+	pgBackRestScheduledBackup = "nohup setsid pgbackrest --type=%s backup > /tmp/pgbackrest-backup.log 2>&1 < /dev/null &"
+
+	pgBackRestDefaultS3Endpoint = "s3.amazonaws.com"
+	pgBackRestDefaultS3Path     = "/pgbackrest"
+)
+
+// the backup types from the most to the least comprehensive one, each one covers the ones after it
+var pgBackRestBackupTypes = []string{"full", "diff", "incr"}
+
+// pgBackRestStanza returns the stanza of the cluster in its pgBackRest repository.
+func pgBackRestStanza(pgBackRest *spec.PgBackRest, clusterName string) string {
+	if pgBackRest.Stanza != "" {
+		return pgBackRest.Stanza
+	}
+	return clusterName
+}
+
+// pgBackRestBackupCommand returns the shell command taking a backup of the given type in the pod.
+func pgBackRestBackupCommand(backupType string) string {
+	return fmt.Sprintf("pgbackrest --type=%s backup 2>&1", backupType)
+}
+
+// generatePgBackRestEnvironment configures pgBackRest in the pods through its PGBACKREST_* variables, so that
+// Patroni, the operator and the users in the pod run it without a configuration file.
+func generatePgBackRestEnvironment(pgBackRest *spec.PgBackRest, stanza string) []v1.EnvVar {
+	result := []v1.EnvVar{
+		{Name: "PGBACKREST_STANZA", Value: stanza},
+		{Name: "PGBACKREST_PG1_PATH", Value: constants.PostgresDataPath + "/data"},
+		{Name: "PGBACKREST_LOG_LEVEL_FILE", Value: "off"},
+	}
+	if s3 := pgBackRest.Repo.S3; s3 != nil {
+		endpoint, path := s3.Endpoint, s3.Path
+		if endpoint == "" {
+			endpoint = pgBackRestDefaultS3Endpoint
+		}
+		if path == "" {
+			path = pgBackRestDefaultS3Path
+		}
+		result = append(result,
+			v1.EnvVar{Name: "PGBACKREST_REPO1_TYPE", Value: "s3"},
+			v1.EnvVar{Name: "PGBACKREST_REPO1_PATH", Value: path},
+			v1.EnvVar{Name: "PGBACKREST_REPO1_S3_BUCKET", Value: s3.Bucket},
+			v1.EnvVar{Name: "PGBACKREST_REPO1_S3_REGION", Value: s3.Region},
+			v1.EnvVar{Name: "PGBACKREST_REPO1_S3_ENDPOINT", Value: endpoint})
+		if s3.CredentialsSecret == "" {
+			result = append(result, v1.EnvVar{Name: "PGBACKREST_REPO1_S3_KEY_TYPE", Value: "auto"})
+		} else {
+			for _, variable := range [][2]string{
+				{"PGBACKREST_REPO1_S3_KEY", constants.PgBackRestS3KeyKey},
+				{"PGBACKREST_REPO1_S3_KEY_SECRET", constants.PgBackRestS3SecretKey},
+			} {
+				result = append(result, v1.EnvVar{
+					Name: variable[0],
+					ValueFrom: &v1.EnvVarSource{
+						SecretKeyRef: &v1.SecretKeySelector{
+							LocalObjectReference: v1.LocalObjectReference{Name: s3.CredentialsSecret},
+							Key:                  variable[1],
+						},
+					},
+				})
+			}
+		}
+	}
+	if host := pgBackRest.Repo.Host; host != nil {
+		result = append(result,
+			v1.EnvVar{Name: "PGBACKREST_REPO1_HOST", Value: host.Host},
+			v1.EnvVar{Name: "PGBACKREST_REPO1_HOST_TYPE", Value: "tls"},
+			v1.EnvVar{Name: "PGBACKREST_REPO1_HOST_CA_FILE", Value: constants.PgBackRestTLSMount + "/ca.crt"},
+			v1.EnvVar{Name: "PGBACKREST_REPO1_HOST_CERT_FILE", Value: constants.PgBackRestTLSMount + "/tls.crt"},
+			v1.EnvVar{Name: "PGBACKREST_REPO1_HOST_KEY_FILE", Value: constants.PgBackRestTLSMount + "/tls.key"})
+		if host.Port != 0 {
+			result = append(result, v1.EnvVar{Name: "PGBACKREST_REPO1_HOST_PORT", Value: fmt.Sprintf("%d", host.Port)})
+		}
+	}
+
+	// the options of the manifest can't override the repository and the stanza set above
+	names := make(map[string]bool, len(result))
+	for _, envVar := range result {
+		names[envVar.Name] = true
+	}
+	options := make([]string, 0, len(pgBackRest.Options))
+	for option := range pgBackRest.Options {
+		options = append(options, option)
+	}
+	sort.Strings(options)
+	for _, option := range options {
+		name := "PGBACKREST_" + strings.ToUpper(strings.Replace(option, "-", "_", -1))
+		if !names[name] {
+			result = append(result, v1.EnvVar{Name: name, Value: pgBackRest.Options[option]})
+		}
+	}
+	return result
+}
+
+// addPgBackRestConfiguration makes Patroni archive the WAL and create the replicas with pgBackRest, falling back to
+// pg_basebackup for the replicas while the repository has no backup yet. The clones restore the stanza of the
+// cluster they are cloned from, named after it, with the point-in-time recovery to the timestamp and along the
+// timeline if any.
+func addPgBackRestConfiguration(config *spiloConfiguration, stanza string, clone *spec.CloneDescription) {
+	parameters := map[string]string{
+		"archive_mode":    "on",
+		"archive_command": fmt.Sprintf(`pgbackrest --stanza=%s archive-push "%%p"`, stanza),
+	}
+	if manifest, ok := config.PgLocalConfiguration[patroniPGParametersParameterName].(map[string]string); ok {
+		parameters = mergeTunedParameters(parameters, manifest)
+	}
+	config.PgLocalConfiguration[patroniPGParametersParameterName] = parameters
+	config.PgLocalConfiguration["recovery_conf"] = map[string]string{
+		"restore_command": fmt.Sprintf(`pgbackrest --stanza=%s archive-get %%f "%%p"`, stanza),
+	}
+	config.PgLocalConfiguration["create_replica_method"] = []string{"pgbackrest", "basebackup"}
+	config.PgLocalConfiguration["pgbackrest"] = map[string]interface{}{
+		"command":   fmt.Sprintf("pgbackrest --stanza=%s --delta restore --type=standby", stanza),
+		"keep_data": true,
+		"no_params": true,
+	}
+
+	if clone == nil || !clone.PgBackRest || clone.ClusterName == "" {
+		return
+	}
+	command := fmt.Sprintf("pgbackrest --stanza=%s --delta restore", clone.ClusterName)
+	if clone.EndTimestamp != "" {
+		action := clone.TargetAction
+		if action == "" {
+			action = spec.RecoveryTargetActionPromote
+		}
+		command += fmt.Sprintf(` --type=time "--target=%s" --target-action=%s`, clone.EndTimestamp, action)
+		if clone.TargetInclusive != nil && !*clone.TargetInclusive {
+			command += " --target-exclusive"
+		}
+	}
+	if clone.TargetTimeline != "" {
+		command += " --target-timeline=" + clone.TargetTimeline
+	}
+	config.Bootstrap.Method = constants.WALToolPgBackRest
+	config.Bootstrap.PgBackRest = &patroniBootstrapMethod{
+		Command:                  command,
+		KeepExistingRecoveryConf: true,
+		NoParams:                 true,
+	}
+}
+
+type pgBackRestInfo struct {
+	Name   string `json:"name"`
+	Backup []struct {
+		Label     string `json:"label"`
+		Type      string `json:"type"`
+		Timestamp struct {
+			Start int64 `json:"start"`
+			Stop  int64 `json:"stop"`
+		} `json:"timestamp"`
+		Archive struct {
+			Start string `json:"start"`
+		} `json:"archive"`
+		Info struct {
+			Repository struct {
+				Delta int64 `json:"delta"`
+			} `json:"repository"`
+		} `json:"info"`
+	} `json:"backup"`
+	Status struct {
+		Lock struct {
+			Backup struct {
+				Held bool `json:"held"`
+			} `json:"backup"`
+		} `json:"lock"`
+	} `json:"status"`
+}
+
+// parsePgBackRestInfo reads the backups of the stanza from the output of pgbackrest info --output=json, and
+// whether a backup of it is running.
+func parsePgBackRestInfo(output, stanza string) ([]spec.BaseBackup, bool, error) {
+	var stanzas []pgBackRestInfo
+	if err := json.Unmarshal([]byte(output), &stanzas); err != nil {
+		return nil, false, fmt.Errorf("could not parse pgBackRest info: %v", err)
+	}
+	result := make([]spec.BaseBackup, 0)
+	for _, info := range stanzas {
+		if info.Name != stanza {
+			continue
+		}
+		for _, backup := range info.Backup {
+			result = append(result, spec.BaseBackup{
+				Name:       backup.Label,
+				Time:       time.Unix(backup.Timestamp.Stop, 0).UTC(),
+				WALSegment: backup.Archive.Start,
+				Size:       backup.Info.Repository.Delta,
+				Type:       backup.Type,
+				StartTime:  time.Unix(backup.Timestamp.Start, 0).UTC(),
+			})
+		}
+		return result, info.Status.Lock.Backup.Held, nil
+	}
+	return result, false, nil
+}
+
+// dueBackupType returns the most comprehensive type of backup whose schedule has fired since the last backup of that
+// type or a more comprehensive one, or since the given time without such a backup. An empty type means no backup is
+// due.
+func dueBackupType(pgBackRest *spec.PgBackRest, backups []spec.BaseBackup, since, now time.Time) (string, error) {
+	schedules := map[string]string{
+		"full": pgBackRest.FullSchedule,
+		"diff": pgBackRest.DiffSchedule,
+		"incr": pgBackRest.IncrSchedule,
+	}
+	for i, backupType := range pgBackRestBackupTypes {
+		if schedules[backupType] == "" {
+			continue
+		}
+		schedule, err := cron.Parse(schedules[backupType])
+		if err != nil {
+			return "", fmt.Errorf("could not parse the schedule of the %s backups: %v", backupType, err)
+		}
+		last := since
+		for _, backup := range backups {
+			if util.SliceContains(pgBackRestBackupTypes[:i+1], backup.Type) && backup.Time.After(last) {
+				last = backup.Time
+			}
+		}
+		if next := schedule.Next(last.UTC()); !next.IsZero() && !next.After(now) {
+			return backupType, nil
+		}
+	}
+	return "", nil
+}
+
+// syncPgBackRest creates the stanza of the cluster in its S3 repository and starts the backups due according to the
+// schedules of the manifest in the master pod. The backups run detached from the sync, the running ones are found by
+// the lock pgBackRest holds. The repository hosts create the stanzas and run the backups themselves, the standby
+// clusters archive to the repository of their source cluster.
+func (c *Cluster) syncPgBackRest() error {
+	pgBackRest := c.Spec.PgBackRest
+	if pgBackRest == nil || pgBackRest.Repo.S3 == nil || c.isStandbyCluster() {
+		return nil
+	}
+	c.setProcessName("syncing pgBackRest backups")
+
+	masterPods, err := c.getRolePods(Master)
+	if err != nil {
+		return fmt.Errorf("could not get master pod: %v", err)
+	}
+	if len(masterPods) == 0 || !podIsReady(&masterPods[0]) {
+		c.logger.Debugf("no running master pod, not syncing pgBackRest backups")
+		return nil
+	}
+	podName := util.NameFromMeta(masterPods[0].ObjectMeta)
+
+	stanza := pgBackRestStanza(pgBackRest, c.Name)
+	if c.createdStanza != stanza {
+		if out, err := c.ExecCommand(&podName, "/bin/su", "postgres", "-c", pgBackRestStanzaCreate); err != nil {
+			return fmt.Errorf("could not create the pgBackRest stanza %q: %v: %s", stanza, err, out)
+		}
+		c.createdStanza = stanza
+		c.logger.Infof("pgBackRest stanza %q has been created", stanza)
+	}
+	if pgBackRest.FullSchedule == "" && pgBackRest.DiffSchedule == "" && pgBackRest.IncrSchedule == "" {
+		return nil
+	}
+
+	out, err := c.ExecCommand(&podName, "/bin/su", "postgres", "-c", pgBackRestInfoCommand)
+	if err != nil {
+		return fmt.Errorf("could not get pgBackRest info: %v: %s", err, out)
+	}
+	backups, running, err := parsePgBackRestInfo(out, stanza)
+	if err != nil {
+		return err
+	}
+	if running {
+		c.logger.Debugf("pgBackRest backup of the stanza %q is running", stanza)
+		return nil
+	}
+	backupType, err := dueBackupType(pgBackRest, backups, c.Statefulset.CreationTimestamp.Time, time.Now().UTC())
+	if err != nil || backupType == "" {
+		return err
+	}
+
+	command := fmt.Sprintf(pgBackRestScheduledBackup, backupType)
+	if out, err := c.ExecCommand(&podName, "/bin/su", "postgres", "-c", command); err != nil {
+		return fmt.Errorf("could not start the %s backup: %v: %s", backupType, err, out)
+	}
+	c.recordEvent(v1.EventTypeNormal, constants.EventReasonScheduledBackupStarted,
+		"started the scheduled %s backup of the stanza %q", backupType, stanza)
+
+	return nil
+}
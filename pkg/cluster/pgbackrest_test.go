@@ -0,0 +1,130 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+)
+
+const pgBackRestInfoOutput = `[{"name":"acid-test","backup":[` +
+	`{"label":"20171201-010000F","type":"full","timestamp":{"start":1512090000,"stop":1512090300},` +
+	`"archive":{"start":"000000010000000000000002"},"info":{"repository":{"delta":1000}}},` +
+	`{"label":"20171201-010000F_20171202-010000I","type":"incr","timestamp":{"start":1512176400,"stop":1512176460},` +
+	`"archive":{"start":"000000010000000000000005"},"info":{"repository":{"delta":100}}}],` +
+	`"status":{"code":0,"lock":{"backup":{"held":true}}}},` +
+	`{"name":"acid-other","backup":[],"status":{"code":0,"lock":{"backup":{"held":false}}}}]`
+
+func TestParsePgBackRestInfo(t *testing.T) {
+	backups, running, err := parsePgBackRestInfo(pgBackRestInfoOutput, "acid-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !running {
+		t.Errorf("expected a running backup")
+	}
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 backups, got: %d", len(backups))
+	}
+	if b := backups[1]; b.Name != "20171201-010000F_20171202-010000I" || b.Type != "incr" || b.Size != 100 ||
+		b.WALSegment != "000000010000000000000005" || !b.Time.Equal(time.Unix(1512176460, 0)) {
+		t.Errorf("unexpected incremental backup: %#v", b)
+	}
+
+	if backups, running, err := parsePgBackRestInfo(pgBackRestInfoOutput, "acid-missing"); err != nil ||
+		running || len(backups) != 0 {
+		t.Errorf("expected no backups of a missing stanza, got: %v %t %v", backups, running, err)
+	}
+	if _, _, err := parsePgBackRestInfo("ERROR: [055]: unable to load info file", "acid-test"); err == nil {
+		t.Errorf("expected an error for the output of a failed command")
+	}
+}
+
+func TestDueBackupType(t *testing.T) {
+	day := func(d, h int) time.Time { return time.Date(2017, 12, d, h, 0, 0, 0, time.UTC) }
+	pgBackRest := &spec.PgBackRest{FullSchedule: "0 1 * * 0", DiffSchedule: "0 1 * * 3", IncrSchedule: "0 1 * * *"}
+	full := spec.BaseBackup{Type: "full", Time: day(3, 1)}
+	diff := spec.BaseBackup{Type: "diff", Time: day(6, 1)}
+
+	tests := []struct {
+		name     string
+		backups  []spec.BaseBackup
+		now      time.Time
+		expected string
+	}{
+		{"not yet scheduled", nil, day(1, 0), ""},
+		{"first incremental", nil, day(1, 2), "incr"},
+		{"full on sunday", []spec.BaseBackup{full}, day(10, 2), "full"},
+		{"full covers the incremental", []spec.BaseBackup{full}, day(3, 2), ""},
+		{"diff on wednesday", []spec.BaseBackup{full}, day(6, 2), "diff"},
+		{"diff covers the incremental", []spec.BaseBackup{full, diff}, day(6, 3), ""},
+		{"incremental after the diff", []spec.BaseBackup{full, diff}, day(7, 2), "incr"},
+	}
+	for _, tt := range tests {
+		backupType, err := dueBackupType(pgBackRest, tt.backups, day(1, 0), tt.now)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		}
+		if backupType != tt.expected {
+			t.Errorf("%s: expected the backup type %q, got: %q", tt.name, tt.expected, backupType)
+		}
+	}
+}
+
+func TestPgBackRestEnvironment(t *testing.T) {
+	pgBackRest := &spec.PgBackRest{
+		Repo:    spec.PgBackRestRepo{S3: &spec.PgBackRestS3Repo{Bucket: "backups", Region: "eu-central-1"}},
+		Options: map[string]string{"repo1-retention-full": "2", "repo1-s3-bucket": "other"},
+	}
+	env := make(map[string]string)
+	for _, envVar := range generatePgBackRestEnvironment(pgBackRest, "acid-test") {
+		if _, ok := env[envVar.Name]; ok {
+			t.Errorf("duplicate variable %q", envVar.Name)
+		}
+		env[envVar.Name] = envVar.Value
+	}
+	for name, expected := range map[string]string{
+		"PGBACKREST_STANZA":               "acid-test",
+		"PGBACKREST_REPO1_S3_BUCKET":      "backups",
+		"PGBACKREST_REPO1_S3_ENDPOINT":    pgBackRestDefaultS3Endpoint,
+		"PGBACKREST_REPO1_S3_KEY_TYPE":    "auto",
+		"PGBACKREST_REPO1_RETENTION_FULL": "2",
+	} {
+		if env[name] != expected {
+			t.Errorf("expected %s=%q, got: %q", name, expected, env[name])
+		}
+	}
+}
+
+func TestPgBackRestClone(t *testing.T) {
+	config := spiloConfiguration{PgLocalConfiguration: map[string]interface{}{
+		patroniPGParametersParameterName: map[string]string{"work_mem": "8MB"},
+	}}
+	clone := &spec.CloneDescription{ClusterName: "acid-source", EndTimestamp: "2017-12-01T01:00:00+00:00", PgBackRest: true}
+	addPgBackRestConfiguration(&config, "acid-test", clone)
+
+	parameters := config.PgLocalConfiguration[patroniPGParametersParameterName].(map[string]string)
+	if parameters["work_mem"] != "8MB" || parameters["archive_command"] != `pgbackrest --stanza=acid-test archive-push "%p"` {
+		t.Errorf("unexpected parameters: %v", parameters)
+	}
+	if config.Bootstrap.Method != "pgbackrest" || config.Bootstrap.PgBackRest == nil {
+		t.Fatalf("expected the clone to bootstrap with pgBackRest")
+	}
+	expected := `pgbackrest --stanza=acid-source --delta restore --type=time "--target=2017-12-01T01:00:00+00:00" --target-action=promote`
+	if command := config.Bootstrap.PgBackRest.Command; command != expected {
+		t.Errorf("expected the restore command %q, got: %q", expected, command)
+	}
+}
+
+func TestPgBackRestCloneRecoveryTarget(t *testing.T) {
+	config := spiloConfiguration{PgLocalConfiguration: map[string]interface{}{}}
+	clone := &spec.CloneDescription{ClusterName: "acid-source", EndTimestamp: "2017-12-01T01:00:00+00:00", PgBackRest: true,
+		RecoveryTargetOptions: spec.RecoveryTargetOptions{TargetTimeline: "2", TargetInclusive: new(bool), TargetAction: "pause"}}
+	addPgBackRestConfiguration(&config, "acid-test", clone)
+
+	expected := `pgbackrest --stanza=acid-source --delta restore --type=time "--target=2017-12-01T01:00:00+00:00" ` +
+		`--target-action=pause --target-exclusive --target-timeline=2`
+	if command := config.Bootstrap.PgBackRest.Command; command != expected {
+		t.Errorf("expected the restore command %q, got: %q", expected, command)
+	}
+}
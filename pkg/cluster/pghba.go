@@ -0,0 +1,106 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+)
+
+// pgHbaRules returns the pg_hba rules of the cluster. The rules in the manifest replace the default ones. We cannot
+// reasonably merge them automatically, because pg_hba parsing stops on a first successfully matched rule.
+func (c *Cluster) pgHbaRules(patroni *spec.Patroni) []string {
+	if len(patroni.PgHba) > 0 {
+		return patroni.PgHba
+	}
+	return []string{
+		"hostnossl all all all reject",
+		fmt.Sprintf("hostssl   all +%s all pam", c.OpConfig.PamRoleName),
+		"hostssl   all all all md5",
+	}
+}
+
+// envWithoutDynamicConfig returns the environment with the pg_hba rules, the synchronous replication settings and the
+// settings passed through to the DCS removed from the Spilo configuration, so that changing them, applied via the DCS,
+// doesn't recreate the pods.
+func envWithoutDynamicConfig(env []v1.EnvVar) []v1.EnvVar {
+	result := make([]v1.EnvVar, len(env))
+	for i, envVar := range env {
+		result[i] = envVar
+		if envVar.Name != "SPILO_CONFIGURATION" || envVar.ValueFrom != nil {
+			continue
+		}
+		var config map[string]interface{}
+		if err := json.Unmarshal([]byte(envVar.Value), &config); err != nil {
+			continue
+		}
+		if bootstrap, ok := config["bootstrap"].(map[string]interface{}); ok {
+			delete(bootstrap, "pg_hba")
+			if dcs, ok := bootstrap["dcs"].(map[string]interface{}); ok {
+				for _, key := range append([]string{"synchronous_mode", "synchronous_mode_strict", "synchronous_node_count"},
+					spec.PatroniDCSKeys()...) {
+					delete(dcs, key)
+				}
+				if postgresql, ok := dcs["postgresql"].(map[string]interface{}); ok {
+					delete(postgresql, "pg_hba")
+					if len(postgresql) == 0 {
+						delete(dcs, "postgresql")
+					}
+				}
+			}
+		}
+		if value, err := json.Marshal(config); err == nil {
+			result[i].Value = string(value)
+		}
+	}
+	return result
+}
+
+// syncPgHba sets the pg_hba rules of the manifest in the dynamic configuration of the cluster, from where Patroni
+// applies them to all members and reloads Postgres. The rules in the statefulset only apply to the new clusters. The
+// LDAP rule is only set here, keeping its bind password out of the statefulset.
+func (c *Cluster) syncPgHba() error {
+	c.setProcessName("syncing pg_hba rules")
+
+	masterPods, err := c.getRolePods(Master)
+	if err != nil {
+		return fmt.Errorf("could not get master pod: %v", err)
+	}
+	if len(masterPods) == 0 || !podIsReady(&masterPods[0]) {
+		c.logger.Debugf("no running master pod, not syncing pg_hba rules")
+		return nil
+	}
+
+	config, err := c.patroni.GetConfig(&masterPods[0])
+	if err != nil {
+		return fmt.Errorf("could not get dynamic configuration: %v", err)
+	}
+	rules, err := c.ldapPgHbaRules()
+	if err != nil {
+		return err
+	}
+	rules = append(rules, c.pgHbaRules(&c.Spec.Patroni)...)
+	current := make([]string, 0)
+	if postgresql, ok := config["postgresql"].(map[string]interface{}); ok {
+		if currentRules, ok := postgresql["pg_hba"].([]interface{}); ok {
+			for _, rule := range currentRules {
+				current = append(current, fmt.Sprint(rule))
+			}
+		}
+	}
+	if reflect.DeepEqual(current, rules) {
+		return nil
+	}
+
+	if err := c.patroni.SetConfig(&masterPods[0], map[string]interface{}{
+		"postgresql": map[string]interface{}{"pg_hba": rules},
+	}); err != nil {
+		return fmt.Errorf("could not set pg_hba rules: %v", err)
+	}
+	c.logger.Infof("pg_hba rules have been updated")
+
+	return nil
+}
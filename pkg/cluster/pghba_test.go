@@ -0,0 +1,79 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/config"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+func TestEnvWithoutDynamicConfig(t *testing.T) {
+	c := New(Config{OpConfig: config.Config{Auth: config.Auth{PamRoleName: "zalandos"}}},
+		k8sutil.KubernetesClient{}, spec.Postgresql{}, logger)
+	spiloEnv := func(patroni spec.Patroni, parameters map[string]string) []v1.EnvVar {
+		return []v1.EnvVar{
+			{Name: "SCOPE", Value: "acid-test"},
+			{Name: "SPILO_CONFIGURATION", Value: c.generateSpiloJSONConfiguration(
+				&spec.PostgresqlParam{PgVersion: "10", Parameters: parameters}, &patroni, "", nil, &spec.CloneDescription{})},
+		}
+	}
+	custom := spec.Patroni{PgHba: []string{"hostssl all all 10.0.0.0/8 md5"}}
+
+	tests := []struct {
+		a, b  []v1.EnvVar
+		equal bool
+	}{
+		{spiloEnv(spec.Patroni{}, nil), spiloEnv(spec.Patroni{}, nil), true},
+		{spiloEnv(spec.Patroni{}, nil), spiloEnv(custom, nil), true},
+		{spiloEnv(spec.Patroni{}, nil), spiloEnv(custom, map[string]string{"work_mem": "8MB"}), false},
+		{spiloEnv(custom, nil), spiloEnv(spec.Patroni{TTL: 20, PgHba: custom.PgHba}, nil), false},
+		{spiloEnv(custom, nil), spiloEnv(spec.Patroni{SynchronousMode: true, SynchronousNodeCount: 2, PgHba: custom.PgHba}, nil), true},
+		{spiloEnv(custom, nil), spiloEnv(spec.Patroni{DCS: map[string]string{"check_timeline": "true"}, PgHba: custom.PgHba}, nil), true},
+	}
+	for i, tt := range tests {
+		if equal := reflect.DeepEqual(envWithoutDynamicConfig(tt.a), envWithoutDynamicConfig(tt.b)); equal != tt.equal {
+			t.Errorf("test %d: expected environments without pg_hba rules to be equal: %t, got: %t", i, tt.equal, equal)
+		}
+	}
+	if env := spiloEnv(custom, nil); reflect.DeepEqual(env, envWithoutDynamicConfig(env)) {
+		t.Errorf("expected pg_hba rules to be removed from %v", env)
+	}
+}
+
+func TestLDAPPgHbaRule(t *testing.T) {
+	tests := []struct {
+		ldap           spec.LDAP
+		bindDN, bindPW string
+		rule           string
+	}{
+		{
+			spec.LDAP{Server: "ldap.example.com", BaseDN: "dc=example,dc=com"},
+			"", "",
+			`hostssl all +ldap all ldap ldapserver="ldap.example.com" ldapbasedn="dc=example,dc=com"`,
+		},
+		{
+			spec.LDAP{Server: "ad.example.com", Port: 636, Scheme: "ldaps", BaseDN: "ou=people,dc=example,dc=com",
+				SearchAttribute: "sAMAccountName", Role: "ad_users", AllowedAddresses: "10.0.0.0/8"},
+			"cn=postgres,dc=example,dc=com", "secret",
+			`hostssl all +ad_users 10.0.0.0/8 ldap ldapserver="ad.example.com" ldapport=636 ldapscheme=ldaps ` +
+				`ldapbasedn="ou=people,dc=example,dc=com" ldapsearchattribute="sAMAccountName" ` +
+				`ldapbinddn="cn=postgres,dc=example,dc=com" ldapbindpasswd="secret"`,
+		},
+		{
+			spec.LDAP{Server: "ldap.example.com", StartTLS: true, BaseDN: "dc=example,dc=com",
+				SearchFilter: "(&(uid=$username)(memberOf=cn=dba,dc=example,dc=com))"},
+			"", "",
+			`hostssl all +ldap all ldap ldapserver="ldap.example.com" ldaptls=1 ldapbasedn="dc=example,dc=com" ` +
+				`ldapsearchfilter="(&(uid=$username)(memberOf=cn=dba,dc=example,dc=com))"`,
+		},
+	}
+	for i, tt := range tests {
+		if rule := ldapPgHbaRule(&tt.ldap, tt.bindDN, tt.bindPW); rule != tt.rule {
+			t.Errorf("test %d: expected rule %q, got %q", i, tt.rule, rule)
+		}
+	}
+}
@@ -1,14 +1,17 @@
 package cluster
 
 import (
+	"encoding/json"
 	"fmt"
 	"math/rand"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/pkg/api/v1"
 
 	"github.com/zalando-incubator/postgres-operator/pkg/spec"
 	"github.com/zalando-incubator/postgres-operator/pkg/util"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
 )
 
 func (c *Cluster) listPods() ([]v1.Pod, error) {
@@ -159,21 +162,33 @@ func (c *Cluster) masterCandidate(oldNodeName string) (*v1.Pod, error) {
 		return nil, nil
 	}
 
+	var liveSpotReplica *v1.Pod
 	for i, pod := range replicas {
-		// look for replicas running on live nodes. Ignore errors when querying the nodes.
+		// look for replicas running on live nodes, preferring the on-demand ones. Ignore errors when querying the nodes.
 		if pod.Spec.NodeName != oldNodeName {
 			eol, err := c.podIsEndOfLife(&pod)
-			if err == nil && !eol {
-				return &replicas[i], nil
+			if err != nil || eol {
+				continue
 			}
+			if spot, err := c.podIsOnSpotNode(&pod); err == nil && spot {
+				if liveSpotReplica == nil {
+					liveSpotReplica = &replicas[i]
+				}
+				continue
+			}
+			return &replicas[i], nil
 		}
 	}
+	if liveSpotReplica != nil {
+		return liveSpotReplica, nil
+	}
 	c.logger.Debug("no available master candidates on live nodes")
 	return &replicas[rand.Intn(len(replicas))], nil
 }
 
-// MigrateMasterPod migrates master pod via failover to a replica
-func (c *Cluster) MigrateMasterPod(podName spec.NamespacedName) error {
+// MigrateMasterPod migrates master pod via failover to a replica. The master is only moved off an end-of-life node,
+// unless its node is about to be interrupted regardless of its state.
+func (c *Cluster) MigrateMasterPod(podName spec.NamespacedName, interrupted bool) error {
 	oldMaster, err := c.KubeClient.Pods(podName.Namespace).Get(podName.Name, metav1.GetOptions{})
 
 	if err != nil {
@@ -184,7 +199,7 @@ func (c *Cluster) MigrateMasterPod(podName spec.NamespacedName) error {
 
 	if eol, err := c.podIsEndOfLife(oldMaster); err != nil {
 		return fmt.Errorf("could not get node %q: %v", oldMaster.Spec.NodeName, err)
-	} else if !eol {
+	} else if !eol && !interrupted {
 		c.logger.Debugf("pod is already on a live node")
 		return nil
 	}
@@ -328,6 +343,40 @@ func (c *Cluster) podIsEndOfLife(pod *v1.Pod) (bool, error) {
 	if err != nil {
 		return false, err
 	}
+	if c.OpConfig.MasterSwitchoverOnDrain && k8sutil.NodeIsDrained(node, c.OpConfig.NodeDrainTaints) {
+		return true, nil
+	}
 	return node.Spec.Unschedulable || !util.MapContains(node.Labels, c.OpConfig.NodeReadinessLabel), nil
 
 }
+
+// patchPodAnnotations applies the changed annotations of the pod template to the running pods, removing the ones
+// that are not in the template anymore.
+func (c *Cluster) patchPodAnnotations(oldAnnotations, newAnnotations map[string]string) error {
+	annotations := make(map[string]interface{})
+	for k := range oldAnnotations {
+		if _, ok := newAnnotations[k]; !ok {
+			annotations[k] = nil
+		}
+	}
+	for k, v := range newAnnotations {
+		annotations[k] = v
+	}
+	patch, err := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"annotations": annotations}})
+	if err != nil {
+		return fmt.Errorf("could not form patch for the pod annotations: %v", err)
+	}
+
+	pods, err := c.listPods()
+	if err != nil {
+		return err
+	}
+	for _, pod := range pods {
+		if _, err := c.KubeClient.Pods(pod.Namespace).Patch(pod.Name, types.MergePatchType, patch); err != nil {
+			return fmt.Errorf("could not patch annotations of the pod %q: %v", util.NameFromMeta(pod.ObjectMeta), err)
+		}
+	}
+	c.logger.Infof("annotations of the pods have been updated")
+
+	return nil
+}
@@ -0,0 +1,404 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+// the directory of the base backups under the prefix of the WAL-E and WAL-G archives
+const baseBackupsDirectory = "/basebackups_005/"
+
+// backupObjectName returns the name of the PostgresBackup of the base backup, which must be a DNS subdomain.
+func backupObjectName(clusterName, backupName string) string {
+	return strings.ToLower(clusterName + "-" + strings.Replace(backupName, "_", "-", -1))
+}
+
+// baseBackupLocation returns the path of the base backup in the WAL archive or in the pgBackRest repository.
+func (c *Cluster) baseBackupLocation(name string) string {
+	if pgBackRest := c.Spec.PgBackRest; pgBackRest != nil {
+		stanza := pgBackRestStanza(pgBackRest, c.Name)
+		if s3 := pgBackRest.Repo.S3; s3 != nil {
+			path := s3.Path
+			if path == "" {
+				path = pgBackRestDefaultS3Path
+			}
+			return fmt.Sprintf("s3://%s%s/backup/%s/%s", s3.Bucket, path, stanza, name)
+		}
+		return fmt.Sprintf("pgbackrest://%s/backup/%s/%s", pgBackRest.Repo.Host.Host, stanza, name)
+	}
+	prefix := c.cloneArchivePrefix(&spec.CloneDescription{ClusterName: c.Name, Uid: string(c.Postgresql.GetUID())})
+	return prefix + baseBackupsDirectory + name
+}
+
+// logicalBackupLocation returns the prefix of the runs of the logical backups of the cluster.
+func (c *Cluster) logicalBackupLocation() string {
+	if azureArchive := c.azureArchive(&c.Spec); azureArchive != nil {
+		return fmt.Sprintf("azure://%s/%s/", azureArchive.Container, c.logicalBackupPrefix())
+	}
+	return fmt.Sprintf("s3://%s/%s/", c.OpConfig.LogicalBackupS3Bucket, c.logicalBackupPrefix())
+}
+
+func (c *Cluster) backupObjectMeta(name string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:      name,
+		Namespace: c.Namespace,
+		Labels:    c.labelsSet(),
+	}
+}
+
+// generateBaseBackupObject returns the PostgresBackup of a base backup found in the archive of the cluster. The
+// finalizer makes the operator delete the backup before the object goes away.
+func (c *Cluster) generateBaseBackupObject(backup spec.BaseBackup) *spec.PostgresBackup {
+	result := &spec.PostgresBackup{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       constants.BackupCRDKind,
+			APIVersion: constants.CRDGroup + "/" + constants.CRDApiVersion,
+		},
+		ObjectMeta: c.backupObjectMeta(backupObjectName(c.Name, backup.Name)),
+		Spec: spec.PostgresBackupSpec{
+			ClusterName: c.Name,
+			ClusterUID:  string(c.Postgresql.GetUID()),
+			Type:        spec.BackupTypeBase,
+			Tool:        c.walTool(&c.Spec),
+			BackupName:  backup.Name,
+		},
+		Status: spec.PostgresBackupStatus{
+			Phase:          spec.BackupRequestSucceeded,
+			Location:       c.baseBackupLocation(backup.Name),
+			SizeBytes:      backup.Size,
+			CompletionTime: &metav1.Time{Time: backup.Time},
+			WALSegment:     backup.WALSegment,
+		},
+	}
+	result.Finalizers = []string{constants.BackupFinalizer}
+	if !backup.StartTime.IsZero() {
+		result.Status.StartTime = &metav1.Time{Time: backup.StartTime}
+		result.Status.Duration = backup.Time.Sub(backup.StartTime).String()
+	}
+	return result
+}
+
+// listBackupObjects returns the PostgresBackups of the cluster.
+func (c *Cluster) listBackupObjects() ([]spec.PostgresBackup, error) {
+	body, err := c.KubeClient.CRDREST.Get().
+		Namespace(c.Namespace).
+		Resource(constants.BackupCRDResource).
+		VersionedParams(&metav1.ListOptions{LabelSelector: c.labelsSet().String()}, metav1.ParameterCodec).
+		DoRaw()
+	if err != nil {
+		return nil, fmt.Errorf("could not list backup objects: %v", err)
+	}
+	var list spec.PostgresBackupList
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("could not unmarshal the list of backup objects: %v", err)
+	}
+	return list.Items, nil
+}
+
+func (c *Cluster) createBackupObject(backup *spec.PostgresBackup) error {
+	body, err := json.Marshal(backup)
+	if err != nil {
+		return fmt.Errorf("could not marshal the backup object: %v", err)
+	}
+	_, err = c.KubeClient.CRDREST.Post().
+		Namespace(c.Namespace).
+		Resource(constants.BackupCRDResource).
+		Body(body).
+		DoRaw()
+	if err != nil && !k8sutil.ResourceAlreadyExists(err) {
+		return fmt.Errorf("could not create the backup object %q: %v", backup.Name, err)
+	}
+	return nil
+}
+
+func (c *Cluster) patchBackupObject(name string, patch interface{}) error {
+	body, err := json.Marshal(patch)
+	if err != nil {
+		return fmt.Errorf("could not marshal the patch of the backup object: %v", err)
+	}
+	_, err = c.KubeClient.CRDREST.Patch(types.MergePatchType).
+		Namespace(c.Namespace).
+		Resource(constants.BackupCRDResource).
+		Name(name).
+		Body(body).
+		DoRaw()
+	if err != nil && !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not patch the backup object %q: %v", name, err)
+	}
+	return nil
+}
+
+// releaseBackupObject removes the finalizer of the operator, which lets the API server delete the object once its
+// deletion has been requested.
+func (c *Cluster) releaseBackupObject(backup *spec.PostgresBackup) error {
+	finalizers := make([]string, 0)
+	for _, finalizer := range backup.Finalizers {
+		if finalizer != constants.BackupFinalizer {
+			finalizers = append(finalizers, finalizer)
+		}
+	}
+	return c.patchBackupObject(backup.Name, map[string]interface{}{
+		"metadata": map[string]interface{}{"finalizers": finalizers},
+	})
+}
+
+// syncBackupObjects keeps a PostgresBackup for every base backup in the archive of the cluster: it creates the ones
+// of the new backups, removes the ones of the backups deleted from the archive, i.e. by the retention, and deletes the
+// backups whose objects are being deleted.
+func (c *Cluster) syncBackupObjects() error {
+	if !c.walArchiveEnabled(&c.Spec) {
+		return nil
+	}
+	c.baseBackupsMu.RLock()
+	listed := c.baseBackups != nil
+	c.baseBackupsMu.RUnlock()
+	if !listed {
+		return nil
+	}
+	c.setProcessName("syncing backup objects")
+
+	objects, err := c.listBackupObjects()
+	if err != nil {
+		return err
+	}
+	backups := c.GetBaseBackups()
+	archived := make(map[string]bool, len(backups))
+	for _, backup := range backups {
+		archived[backup.Name] = true
+	}
+
+	existing := make(map[string]bool, len(objects))
+	for i := range objects {
+		object := &objects[i]
+		if object.Spec.Type != spec.BackupTypeBase {
+			continue
+		}
+		existing[object.Spec.BackupName] = true
+		switch {
+		case object.DeletionTimestamp != nil:
+			if archived[object.Spec.BackupName] {
+				if err := c.deleteBaseBackup(object.Spec.BackupName, backups); err != nil {
+					c.recordEvent(v1.EventTypeWarning, constants.EventReasonBackupCleanupFailed,
+						"could not delete the base backup %q: %v", object.Spec.BackupName, err)
+					if err := c.patchBackupObject(object.Name, map[string]interface{}{
+						"status": map[string]string{"error": err.Error()},
+					}); err != nil {
+						c.logger.Warningf("%v", err)
+					}
+					continue
+				}
+				c.recordEvent(v1.EventTypeNormal, constants.EventReasonBackupsDeleted,
+					"deleted the base backup %q of the deleted backup object", object.Spec.BackupName)
+			}
+			if err := c.releaseBackupObject(object); err != nil {
+				c.logger.Warningf("%v", err)
+			}
+		case !archived[object.Spec.BackupName]:
+			if err := c.releaseBackupObject(object); err != nil {
+				c.logger.Warningf("%v", err)
+				continue
+			}
+			err := c.KubeClient.CRDREST.Delete().
+				Namespace(c.Namespace).
+				Resource(constants.BackupCRDResource).
+				Name(object.Name).
+				Do().
+				Error()
+			if err != nil && !k8sutil.ResourceNotFound(err) {
+				c.logger.Warningf("could not delete the backup object %q: %v", object.Name, err)
+				continue
+			}
+			c.logger.Infof("backup object %q of the removed base backup has been deleted", object.Name)
+		}
+	}
+
+	for _, backup := range backups {
+		if existing[backup.Name] {
+			continue
+		}
+		if err := c.createBackupObject(c.generateBaseBackupObject(backup)); err != nil {
+			return err
+		}
+		c.logger.Debugf("backup object of the base backup %q has been created", backup.Name)
+	}
+
+	return nil
+}
+
+// deleteBaseBackup deletes the single base backup from the archive. WAL-E only deletes the backups before a given
+// one, so only its oldest backup can be deleted, together with the WAL before the next one.
+func (c *Cluster) deleteBaseBackup(name string, backups []spec.BaseBackup) error {
+	switch c.walTool(&c.Spec) {
+	case constants.WALToolWALG:
+		return c.execInMaster(c.walArchiveCommand("delete target " + name + " --confirm"))
+	case constants.WALToolPgBackRest:
+		return c.execInMaster(fmt.Sprintf("pgbackrest expire --set=%s 2>&1", name))
+	}
+	if len(backups) < 2 || backups[0].Name != name {
+		return fmt.Errorf("WAL-E deletes only the oldest of several base backups")
+	}
+	return c.deleteBaseBackupsBefore(backups[1].Name)
+}
+
+// releaseBackupObjects removes the finalizers from the PostgresBackups of the deleted cluster: the objects stay as
+// the references to the backups to clone from, and deleting them doesn't touch the archive anymore.
+func (c *Cluster) releaseBackupObjects() error {
+	objects, err := c.listBackupObjects()
+	if err != nil {
+		return err
+	}
+	for i := range objects {
+		if !util.SliceContains(objects[i].Finalizers, constants.BackupFinalizer) {
+			continue
+		}
+		if err := c.releaseBackupObject(&objects[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createLogicalBackupObject creates the PostgresBackup of the requested logical backup, named after its job.
+func (c *Cluster) createLogicalBackupObject(status *spec.BackupRequestStatus) error {
+	return c.createBackupObject(&spec.PostgresBackup{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       constants.BackupCRDKind,
+			APIVersion: constants.CRDGroup + "/" + constants.CRDApiVersion,
+		},
+		ObjectMeta: c.backupObjectMeta(status.JobName),
+		Spec: spec.PostgresBackupSpec{
+			ClusterName: c.Name,
+			ClusterUID:  string(c.Postgresql.GetUID()),
+			Type:        spec.BackupTypeLogical,
+		},
+		Status: spec.PostgresBackupStatus{
+			Phase:     status.Phase,
+			Location:  c.logicalBackupLocation(),
+			StartTime: status.StartTime,
+			JobName:   status.JobName,
+		},
+	})
+}
+
+// updateLogicalBackupObject writes the result of the requested logical backup to its PostgresBackup.
+func (c *Cluster) updateLogicalBackupObject(status *spec.BackupRequestStatus) error {
+	result := spec.PostgresBackupStatus{
+		Phase:          status.Phase,
+		Location:       c.logicalBackupLocation(),
+		StartTime:      status.StartTime,
+		CompletionTime: status.CompletionTime,
+		JobName:        status.JobName,
+		Error:          status.Error,
+	}
+	if status.StartTime != nil && status.CompletionTime != nil {
+		result.Duration = status.CompletionTime.Sub(status.StartTime.Time).String()
+	}
+	return c.patchBackupObject(status.JobName, map[string]interface{}{"status": result})
+}
+
+// cloneDescription returns the clone section of the manifest, or the one its backup has been resolved into. Once
+// an in-place restore stopped the cluster, its pods bootstrap from its own archive instead.
+func (c *Cluster) cloneDescription(pgSpec *spec.PostgresSpec) *spec.CloneDescription {
+	if c.Restore != nil && c.Restore.StartTime != nil {
+		return c.restoreCloneDescription(pgSpec, c.Restore)
+	}
+	if pgSpec.Clone.Backup != "" && c.CloneSource != nil {
+		return c.CloneSource
+	}
+	return &pgSpec.Clone
+}
+
+// cloneSourceFromBackup returns the clone description recovering the cluster of the base backup up to the end of it.
+func cloneSourceFromBackup(backup *spec.PostgresBackup) (*spec.CloneDescription, error) {
+	if backup.Spec.Type != spec.BackupTypeBase {
+		return nil, fmt.Errorf("backup %q is not a base backup", backup.Name)
+	}
+	if backup.Status.Phase != spec.BackupRequestSucceeded || backup.Status.CompletionTime == nil {
+		return nil, fmt.Errorf("backup %q is not completed", backup.Name)
+	}
+	if backup.DeletionTimestamp != nil {
+		return nil, fmt.Errorf("backup %q is being deleted", backup.Name)
+	}
+	result := &spec.CloneDescription{
+		ClusterName:  backup.Spec.ClusterName,
+		Uid:          backup.Spec.ClusterUID,
+		EndTimestamp: backup.Status.CompletionTime.UTC().Format(time.RFC3339),
+	}
+	if backup.Spec.Tool == constants.WALToolPgBackRest {
+		result.PgBackRest = true
+		return result, nil
+	}
+
+	location := backup.Status.Location
+	i := strings.Index(location, baseBackupsDirectory)
+	if i < 0 {
+		return nil, fmt.Errorf("could not find the archive of the backup %q in its location %q", backup.Name, location)
+	}
+	switch prefix := location[:i]; {
+	case strings.HasPrefix(prefix, "s3://"):
+		result.S3WalPath = prefix
+	case strings.HasPrefix(prefix, "gs://"):
+		result.GSWalPath = prefix
+	case strings.HasPrefix(prefix, "azure://"):
+		result.AzWalPath = prefix
+	default:
+		return nil, fmt.Errorf("unknown archive of the backup %q in its location %q", backup.Name, location)
+	}
+	return result, nil
+}
+
+// resolveCloneBackup resolves the PostgresBackup of the clone section into the cluster, the archive and the end time
+// of the backup, and keeps the result in the cloneSource section of the postgresql object for the following syncs.
+func (c *Cluster) resolveCloneBackup() error {
+	if c.Spec.Clone.Backup == "" || c.CloneSource != nil {
+		return nil
+	}
+	body, err := c.KubeClient.CRDREST.Get().
+		Namespace(c.Namespace).
+		Resource(constants.BackupCRDResource).
+		Name(c.Spec.Clone.Backup).
+		DoRaw()
+	if err != nil {
+		return fmt.Errorf("could not get the backup %q: %v", c.Spec.Clone.Backup, err)
+	}
+	var backup spec.PostgresBackup
+	if err := json.Unmarshal(body, &backup); err != nil {
+		return fmt.Errorf("could not unmarshal the backup %q: %v", c.Spec.Clone.Backup, err)
+	}
+	source, err := cloneSourceFromBackup(&backup)
+	if err != nil {
+		return err
+	}
+	if source.PgBackRest && c.Spec.PgBackRest == nil {
+		return fmt.Errorf("clone from the pgBackRest backup %q requires the pgbackrest section", backup.Name)
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{"cloneSource": source})
+	if err != nil {
+		return fmt.Errorf("could not marshal the clone source: %v", err)
+	}
+	_, err = c.KubeClient.CRDREST.Patch(types.MergePatchType).
+		Namespace(c.Namespace).
+		Resource(constants.CRDResource).
+		Name(c.Name).
+		Body(patch).
+		DoRaw()
+	if err != nil {
+		return fmt.Errorf("could not set the clone source: %v", err)
+	}
+	c.CloneSource = source
+	c.logger.Infof("cloning the cluster %q from its backup %q", source.ClusterName, backup.Name)
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/config"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+func TestGenerateBaseBackupObject(t *testing.T) {
+	c := New(Config{OpConfig: config.Config{WALES3Bucket: "backups", WALTool: constants.WALToolWALG}},
+		k8sutil.KubernetesClient{}, spec.Postgresql{}, logger)
+	c.Name = "acid-test"
+	c.Namespace = "default"
+
+	finished := time.Date(2017, 12, 10, 1, 14, 36, 0, time.UTC)
+	backup := c.generateBaseBackupObject(spec.BaseBackup{
+		Name:       "base_000000010000000000000002_00000040",
+		Time:       finished,
+		StartTime:  finished.Add(-14 * time.Minute),
+		WALSegment: "000000010000000000000002",
+		Size:       4194304,
+	})
+	if backup.Name != "acid-test-base-000000010000000000000002-00000040" {
+		t.Errorf("unexpected name of the backup object: %q", backup.Name)
+	}
+	if expected := "s3://backups/spilo/acid-test/wal/basebackups_005/base_000000010000000000000002_00000040"; backup.Status.Location != expected {
+		t.Errorf("expected the location %q, got: %q", expected, backup.Status.Location)
+	}
+	if backup.Status.Duration != "14m0s" || backup.Spec.Tool != constants.WALToolWALG ||
+		!reflect.DeepEqual(backup.Finalizers, []string{constants.BackupFinalizer}) {
+		t.Errorf("unexpected backup object: %#v", backup)
+	}
+
+	source, err := cloneSourceFromBackup(backup)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := &spec.CloneDescription{ClusterName: "acid-test", EndTimestamp: "2017-12-10T01:14:36Z",
+		S3WalPath: "s3://backups/spilo/acid-test/wal"}
+	if !reflect.DeepEqual(source, expected) {
+		t.Errorf("expected the clone source %#v, got: %#v", expected, source)
+	}
+}
+
+func TestCloneSourceFromBackup(t *testing.T) {
+	completed := &metav1.Time{Time: time.Date(2017, 12, 10, 1, 0, 0, 0, time.UTC)}
+	backup := func(backupType spec.BackupType, tool, location string, phase spec.BackupRequestPhase) *spec.PostgresBackup {
+		return &spec.PostgresBackup{
+			ObjectMeta: metav1.ObjectMeta{Name: "backup"},
+			Spec:       spec.PostgresBackupSpec{ClusterName: "acid-test", Type: backupType, Tool: tool},
+			Status:     spec.PostgresBackupStatus{Phase: phase, Location: location, CompletionTime: completed},
+		}
+	}
+	tests := []struct {
+		name     string
+		backup   *spec.PostgresBackup
+		expected *spec.CloneDescription
+	}{
+		{"gcs", backup(spec.BackupTypeBase, constants.WALToolWALG, "gs://b/spilo/acid-test/uid/wal/basebackups_005/base_1", spec.BackupRequestSucceeded),
+			&spec.CloneDescription{ClusterName: "acid-test", EndTimestamp: "2017-12-10T01:00:00Z", GSWalPath: "gs://b/spilo/acid-test/uid/wal"}},
+		{"pgbackrest", backup(spec.BackupTypeBase, constants.WALToolPgBackRest, "s3://b/pgbackrest/backup/acid-test/20171210-010000F", spec.BackupRequestSucceeded),
+			&spec.CloneDescription{ClusterName: "acid-test", EndTimestamp: "2017-12-10T01:00:00Z", PgBackRest: true}},
+		{"logical", backup(spec.BackupTypeLogical, "", "s3://b/spilo/acid-test/logical_backups/", spec.BackupRequestSucceeded), nil},
+		{"running", backup(spec.BackupTypeBase, constants.WALToolWALG, "", spec.BackupRequestRunning), nil},
+		{"unknown location", backup(spec.BackupTypeBase, constants.WALToolWALE, "s3://b/elsewhere/base_1", spec.BackupRequestSucceeded), nil},
+	}
+	for _, tt := range tests {
+		source, err := cloneSourceFromBackup(tt.backup)
+		if tt.expected == nil {
+			if err == nil {
+				t.Errorf("%s: expected an error, got: %#v", tt.name, source)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		} else if !reflect.DeepEqual(source, tt.expected) {
+			t.Errorf("%s: expected the clone source %#v, got: %#v", tt.name, tt.expected, source)
+		}
+	}
+}
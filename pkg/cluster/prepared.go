@@ -0,0 +1,143 @@
+package cluster
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+)
+
+const (
+	defaultPreparedSchema = "data"
+
+	ownerRoleSuffix  = "_owner"
+	readerRoleSuffix = "_reader"
+	writerRoleSuffix = "_writer"
+	loginUserSuffix  = "_user"
+)
+
+// the privileges are granted on every sync, so that the objects created before are covered as well
+var preparedSchemaSQL = []string{
+	`CREATE SCHEMA IF NOT EXISTS "{schema}" AUTHORIZATION "{owner}";`,
+	`GRANT USAGE ON SCHEMA "{schema}" TO "{reader}";`,
+	`GRANT SELECT ON ALL TABLES IN SCHEMA "{schema}" TO "{reader}";`,
+	`GRANT SELECT ON ALL SEQUENCES IN SCHEMA "{schema}" TO "{reader}";`,
+	`GRANT INSERT, UPDATE, DELETE, TRUNCATE ON ALL TABLES IN SCHEMA "{schema}" TO "{writer}";`,
+	`GRANT USAGE ON ALL SEQUENCES IN SCHEMA "{schema}" TO "{writer}";`,
+}
+
+// the objects are created either by the owner role of the schema or by the one of the database
+var preparedDefaultPrivilegesSQL = []string{
+	`ALTER DEFAULT PRIVILEGES FOR ROLE "{creator}" IN SCHEMA "{schema}" GRANT SELECT ON TABLES TO "{reader}";`,
+	`ALTER DEFAULT PRIVILEGES FOR ROLE "{creator}" IN SCHEMA "{schema}" GRANT SELECT ON SEQUENCES TO "{reader}";`,
+	`ALTER DEFAULT PRIVILEGES FOR ROLE "{creator}" IN SCHEMA "{schema}" GRANT INSERT, UPDATE, DELETE, TRUNCATE ON TABLES TO "{writer}";`,
+	`ALTER DEFAULT PRIVILEGES FOR ROLE "{creator}" IN SCHEMA "{schema}" GRANT USAGE ON SEQUENCES TO "{writer}";`,
+}
+
+// preparedSchemas returns the schemas of the prepared database.
+func preparedSchemas(database spec.PreparedDatabase) []string {
+	if len(database.Schemas) == 0 {
+		return []string{defaultPreparedSchema}
+	}
+	return database.Schemas
+}
+
+// preparedDatabaseOwner returns the NOLOGIN role owning the prepared database.
+func preparedDatabaseOwner(datname string) string {
+	return datname + ownerRoleSuffix
+}
+
+// initPreparedDatabaseRoles adds the roles of the prepared databases. Every database and schema gets NOLOGIN owner,
+// writer and reader roles, each including the next one, and the roles of the database include the ones of its
+// schemas. The roles of the database get login users with generated passwords, which act as their role.
+func (c *Cluster) initPreparedDatabaseRoles() error {
+	for datname, database := range c.Spec.PreparedDatabases {
+		databaseRoles := map[string][]string{
+			readerRoleSuffix: {},
+			writerRoleSuffix: {datname + readerRoleSuffix},
+			ownerRoleSuffix:  {datname + writerRoleSuffix},
+		}
+		for _, schema := range preparedSchemas(database) {
+			prefix := fmt.Sprintf("%s_%s", datname, schema)
+			c.addPreparedRole(prefix+readerRoleSuffix, nil)
+			c.addPreparedRole(prefix+writerRoleSuffix, []string{prefix + readerRoleSuffix})
+			c.addPreparedRole(prefix+ownerRoleSuffix, []string{prefix + writerRoleSuffix})
+			for suffix := range databaseRoles {
+				databaseRoles[suffix] = append(databaseRoles[suffix], prefix+suffix)
+			}
+		}
+		for suffix, memberOf := range databaseRoles {
+			role := datname + suffix
+			c.addPreparedRole(role, memberOf)
+			if c.shouldAvoidProtectedOrSystemRole(role+loginUserSuffix, "prepared database user") {
+				continue
+			}
+			c.pgUsers[role+loginUserSuffix] = spec.PgUser{
+				Name:       role + loginUserSuffix,
+				Password:   util.RandomPassword(constants.PasswordLength),
+				Flags:      []string{constants.RoleFlagLogin},
+				MemberOf:   []string{role},
+				Parameters: map[string]string{"role": role},
+			}
+		}
+	}
+
+	return nil
+}
+
+// addPreparedRole adds the NOLOGIN role member of the given roles.
+func (c *Cluster) addPreparedRole(name string, memberOf []string) {
+	if c.shouldAvoidProtectedOrSystemRole(name, "prepared database role") {
+		return
+	}
+	c.pgUsers[name] = spec.PgUser{
+		Name:     name,
+		Flags:    []string{},
+		MemberOf: memberOf,
+	}
+}
+
+// syncPreparedSchemas creates the schemas of the prepared databases and grants their roles the privileges on them.
+// The databases themselves are created by syncDatabases.
+func (c *Cluster) syncPreparedSchemas() error {
+	for datname, database := range c.Spec.PreparedDatabases {
+		c.setProcessName("syncing schemas of the database %q", datname)
+
+		conn, err := openConnection(fmt.Sprintf("%s.%s.svc.cluster.local", c.Name, c.Namespace), datname,
+			c.systemUsers[constants.SuperuserKeyName].Name, c.systemUsers[constants.SuperuserKeyName].Password)
+		if err != nil {
+			return fmt.Errorf("could not connect to the database %q: %v", datname, err)
+		}
+
+		for _, schema := range preparedSchemas(database) {
+			prefix := fmt.Sprintf("%s_%s", datname, schema)
+			roles := []string{"{schema}", schema, "{owner}", prefix + ownerRoleSuffix,
+				"{reader}", prefix + readerRoleSuffix, "{writer}", prefix + writerRoleSuffix}
+			statements := make([]string, 0)
+			for _, statement := range preparedSchemaSQL {
+				statements = append(statements, strings.NewReplacer(roles...).Replace(statement))
+			}
+			for _, creator := range []string{prefix + ownerRoleSuffix, preparedDatabaseOwner(datname)} {
+				replacer := strings.NewReplacer(append(roles, "{creator}", creator)...)
+				for _, statement := range preparedDefaultPrivilegesSQL {
+					statements = append(statements, replacer.Replace(statement))
+				}
+			}
+			for _, statement := range statements {
+				if _, err := conn.Exec(statement); err != nil {
+					conn.Close()
+					return fmt.Errorf("could not prepare schema %q of the database %q: %v", schema, datname, err)
+				}
+			}
+			c.logger.Debugf("schema %q of the database %q has been prepared", schema, datname)
+		}
+
+		if err := conn.Close(); err != nil {
+			c.logger.Errorf("could not close connection to the database %q: %v", datname, err)
+		}
+	}
+
+	return nil
+}
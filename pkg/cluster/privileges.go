@@ -0,0 +1,228 @@
+package cluster
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+)
+
+// the objects created by the owner of the database afterwards, i.e. by the migrations, are accessible to its roles
+var databaseDefaultPrivilegesSQL = []string{
+	`ALTER DEFAULT PRIVILEGES FOR ROLE "{owner}" GRANT SELECT ON TABLES TO "{reader}";`,
+	`ALTER DEFAULT PRIVILEGES FOR ROLE "{owner}" GRANT SELECT ON SEQUENCES TO "{reader}";`,
+	`ALTER DEFAULT PRIVILEGES FOR ROLE "{owner}" GRANT INSERT, UPDATE, DELETE, TRUNCATE ON TABLES TO "{writer}";`,
+	`ALTER DEFAULT PRIVILEGES FOR ROLE "{owner}" GRANT USAGE ON SEQUENCES TO "{writer}";`,
+	`GRANT USAGE ON SCHEMA public TO "{reader}";`,
+}
+
+// default privileges on schemas are supported since Postgres 10
+const databaseSchemaDefaultPrivilegesSQL = `ALTER DEFAULT PRIVILEGES FOR ROLE "{owner}" GRANT USAGE ON SCHEMAS TO "{reader}";`
+
+// the reader roles of the owners get the privileges on the existing objects on every sync as well, so that they don't
+// drift from the ones of the owner
+var ownerReaderDatabaseSQL = []string{
+	`GRANT CONNECT ON DATABASE "{database}" TO "{reader}";`,
+	`ALTER DEFAULT PRIVILEGES FOR ROLE "{owner}" GRANT SELECT ON TABLES TO "{reader}";`,
+	`ALTER DEFAULT PRIVILEGES FOR ROLE "{owner}" GRANT SELECT ON SEQUENCES TO "{reader}";`,
+}
+
+var ownerReaderSchemaSQL = []string{
+	`GRANT USAGE ON SCHEMA "{schema}" TO "{reader}";`,
+	`GRANT SELECT ON ALL TABLES IN SCHEMA "{schema}" TO "{reader}";`,
+	`GRANT SELECT ON ALL SEQUENCES IN SCHEMA "{schema}" TO "{reader}";`,
+}
+
+const ownerSchemasSQL = `SELECT nspname FROM pg_namespace WHERE pg_get_userbyid(nspowner) = $1 OR nspname = 'public';`
+
+// accessRoleDatabases returns the manifest databases getting reader and writer roles, the prepared databases have
+// their own roles.
+func (c *Cluster) accessRoleDatabases() map[string]string {
+	databases := make(map[string]string)
+	if !c.OpConfig.EnableDefaultPrivileges {
+		return databases
+	}
+	for datname, owner := range c.Spec.Databases {
+		if _, prepared := c.Spec.PreparedDatabases[datname]; !prepared {
+			databases[datname] = owner
+		}
+	}
+	return databases
+}
+
+// initDatabaseAccessRoles adds the NOLOGIN reader and writer roles of the manifest databases, the writer including
+// the reader. Roles defined elsewhere with the same names are kept.
+func (c *Cluster) initDatabaseAccessRoles() error {
+	for datname := range c.accessRoleDatabases() {
+		roles := map[string][]string{
+			datname + readerRoleSuffix: nil,
+			datname + writerRoleSuffix: {datname + readerRoleSuffix},
+		}
+		for role, memberOf := range roles {
+			if _, present := c.pgUsers[role]; present {
+				c.logger.Warningf("role %q of the database %q is already defined, not overriding it", role, datname)
+				continue
+			}
+			c.addPreparedRole(role, memberOf)
+		}
+	}
+
+	return nil
+}
+
+// syncDatabaseDefaultPrivileges grants the reader and writer roles of the manifest databases the privileges on the
+// objects their owners create.
+func (c *Cluster) syncDatabaseDefaultPrivileges() error {
+	schemaPrivileges := false
+	if version, err := pgVersionNumber(c.Spec.PgVersion); err == nil && version >= 100000 {
+		schemaPrivileges = true
+	}
+
+	for datname, owner := range c.accessRoleDatabases() {
+		c.setProcessName("syncing default privileges of the database %q", datname)
+
+		replacer := strings.NewReplacer("{owner}", owner,
+			"{reader}", datname+readerRoleSuffix, "{writer}", datname+writerRoleSuffix)
+		statements := make([]string, 0)
+		for _, statement := range databaseDefaultPrivilegesSQL {
+			statements = append(statements, replacer.Replace(statement))
+		}
+		if schemaPrivileges {
+			statements = append(statements, replacer.Replace(databaseSchemaDefaultPrivilegesSQL))
+		}
+
+		conn, err := openConnection(fmt.Sprintf("%s.%s.svc.cluster.local", c.Name, c.Namespace), datname,
+			c.systemUsers[constants.SuperuserKeyName].Name, c.systemUsers[constants.SuperuserKeyName].Password)
+		if err != nil {
+			return fmt.Errorf("could not connect to the database %q: %v", datname, err)
+		}
+		for _, statement := range statements {
+			if _, err := conn.Exec(statement); err != nil {
+				conn.Close()
+				return fmt.Errorf("could not set default privileges of the database %q: %v", datname, err)
+			}
+		}
+		if err := conn.Close(); err != nil {
+			c.logger.Errorf("could not close connection to the database %q: %v", datname, err)
+		}
+		c.logger.Debugf("default privileges of the database %q have been set", datname)
+	}
+
+	return nil
+}
+
+// ownerReaderRolesEnabled tells if the database owners of the manifest get read-only companion roles.
+func (c *Cluster) ownerReaderRolesEnabled() bool {
+	if c.Spec.EnableOwnerReaderRoles != nil {
+		return *c.Spec.EnableOwnerReaderRoles
+	}
+	return c.OpConfig.EnableOwnerReaderRoles
+}
+
+// ownerReaderRole returns the name of the read-only companion role of the database owner.
+func ownerReaderRole(owner string) string {
+	return owner + readerRoleSuffix
+}
+
+// initOwnerReaderRoles adds the read-only login roles of the owners of the manifest databases, with their own
+// passwords and secrets. The reader role of a database named after its owner becomes the login role of the owner
+// as well, other roles defined elsewhere with the same names are kept.
+func (c *Cluster) initOwnerReaderRoles() error {
+	if !c.ownerReaderRolesEnabled() {
+		return nil
+	}
+	owners := make(map[string]bool)
+	for _, owner := range c.Spec.Databases {
+		owners[owner] = true
+	}
+	accessRoleDatabases := c.accessRoleDatabases()
+	for owner := range owners {
+		role := ownerReaderRole(owner)
+		if existing, present := c.pgUsers[role]; present {
+			_, manifestUser := c.Spec.Users[role]
+			if _, accessRole := accessRoleDatabases[owner]; !accessRole || manifestUser || existing.Password != "" {
+				c.logger.Warningf("reader role %q of the owner %q is already defined, not overriding it", role, owner)
+				continue
+			}
+			existing.Password = util.RandomPassword(constants.PasswordLength)
+			existing.Flags = []string{constants.RoleFlagLogin}
+			c.pgUsers[role] = existing
+			continue
+		}
+		if c.shouldAvoidProtectedOrSystemRole(role, "reader role") {
+			continue
+		}
+		c.pgUsers[role] = spec.PgUser{
+			Name:     role,
+			Password: util.RandomPassword(constants.PasswordLength),
+			Flags:    []string{constants.RoleFlagLogin},
+		}
+	}
+
+	return nil
+}
+
+// syncOwnerReaderPrivileges grants the reader roles of the owners SELECT on the tables and sequences in the public
+// schema and the schemas of the owner in its databases, including the ones created later by the owner.
+func (c *Cluster) syncOwnerReaderPrivileges() error {
+	if !c.ownerReaderRolesEnabled() {
+		return nil
+	}
+	for datname, owner := range c.Spec.Databases {
+		reader := ownerReaderRole(owner)
+		if user, ok := c.pgUsers[reader]; !ok || !util.SliceContains(user.Flags, constants.RoleFlagLogin) {
+			continue
+		}
+		c.setProcessName("syncing privileges of the reader role of the database %q", datname)
+
+		conn, err := openConnection(fmt.Sprintf("%s.%s.svc.cluster.local", c.Name, c.Namespace), datname,
+			c.systemUsers[constants.SuperuserKeyName].Name, c.systemUsers[constants.SuperuserKeyName].Password)
+		if err != nil {
+			return fmt.Errorf("could not connect to the database %q: %v", datname, err)
+		}
+		err = func() error {
+			rows, err := conn.Query(ownerSchemasSQL, owner)
+			if err != nil {
+				return fmt.Errorf("could not query schemas: %v", err)
+			}
+			schemas := make([]string, 0)
+			for rows.Next() {
+				var schema string
+				if err := rows.Scan(&schema); err != nil {
+					rows.Close()
+					return fmt.Errorf("error when processing row: %v", err)
+				}
+				schemas = append(schemas, schema)
+			}
+			rows.Close()
+
+			replacer := strings.NewReplacer("{database}", datname, "{owner}", owner, "{reader}", reader)
+			statements := make([]string, 0)
+			for _, statement := range ownerReaderDatabaseSQL {
+				statements = append(statements, replacer.Replace(statement))
+			}
+			for _, schema := range schemas {
+				for _, statement := range ownerReaderSchemaSQL {
+					statements = append(statements, strings.Replace(replacer.Replace(statement), "{schema}", schema, -1))
+				}
+			}
+			for _, statement := range statements {
+				if _, err := conn.Exec(statement); err != nil {
+					return fmt.Errorf("could not grant privileges: %v", err)
+				}
+			}
+			return nil
+		}()
+		if closeErr := conn.Close(); closeErr != nil {
+			c.logger.Errorf("could not close connection to the database %q: %v", datname, closeErr)
+		}
+		if err != nil {
+			return fmt.Errorf("could not sync privileges of the reader role %q in the database %q: %v", reader, datname, err)
+		}
+		c.logger.Debugf("privileges of the reader role %q in the database %q have been synced", reader, datname)
+	}
+
+	return nil
+}
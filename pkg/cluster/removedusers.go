@@ -0,0 +1,269 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/lib/pq"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+const (
+	disableLoginSQL         = `ALTER ROLE "%s" NOLOGIN;`
+	connectableDatabasesSQL = `SELECT datname FROM pg_database WHERE datallowconn;`
+	reassignOwnedSQL        = `REASSIGN OWNED BY "%s" TO "%s"; DROP OWNED BY "%s";`
+	dropRoleSQL             = `DROP ROLE IF EXISTS "%s";`
+	existingRolesSQL        = `SELECT rolname FROM pg_roles WHERE rolname = ANY($1);`
+)
+
+// removedUsersPolicy returns the policy for the removed users of the cluster manifest, falling back to the operator
+// configuration.
+func (c *Cluster) removedUsersPolicy() spec.RemovedUsersPolicy {
+	if c.Spec.RemovedUsersPolicy != "" {
+		return c.Spec.RemovedUsersPolicy
+	}
+	return spec.RemovedUsersPolicy(c.OpConfig.RemovedUsersPolicy)
+}
+
+// removedManifestUsers returns the users of the old manifest missing in the new one. The roles still defined by other
+// sources, i.e. the infrastructure roles or the teams API, are left alone.
+func (c *Cluster) removedManifestUsers(oldUsers, newUsers map[string]spec.UserFlags) []string {
+	removed := make([]string, 0)
+	for username := range oldUsers {
+		if _, ok := newUsers[username]; ok {
+			continue
+		}
+		if _, ok := c.pgUsers[username]; ok {
+			continue
+		}
+		if c.isProtectedUsername(username) || c.isSystemUsername(username) {
+			continue
+		}
+		removed = append(removed, username)
+	}
+	sort.Strings(removed)
+	return removed
+}
+
+// removedUsersStatuses returns the statuses of the removed users with the newly removed ones pending under the
+// policy, except for the keep policy, which needs no action. The users added to the manifest again are left out.
+func removedUsersStatuses(statuses []spec.RemovedUserStatus, removed []string, newUsers map[string]spec.UserFlags,
+	policy spec.RemovedUsersPolicy, now metav1.Time) []spec.RemovedUserStatus {
+	result := make([]spec.RemovedUserStatus, 0)
+	for _, status := range statuses {
+		if _, ok := newUsers[status.Name]; ok || util.SliceContains(removed, status.Name) {
+			continue
+		}
+		result = append(result, status)
+	}
+	for _, username := range removed {
+		result = append(result, spec.RemovedUserStatus{Name: username, Action: policy, Time: now,
+			Pending: policy != spec.RemovedUsersPolicyKeep})
+	}
+	return result
+}
+
+// recordRemovedUsers adds the users of the old manifest missing in the new one to the status of the cluster, where
+// they stay pending until the policy has been applied to them, even while the database is not accessible. The users
+// added to the manifest again are removed from the status.
+func (c *Cluster) recordRemovedUsers(oldUsers, newUsers map[string]spec.UserFlags) {
+	removed := c.removedManifestUsers(oldUsers, newUsers)
+	statuses := removedUsersStatuses(c.RemovedUsers, removed, newUsers, c.removedUsersPolicy(), metav1.Now())
+	if len(removed) > 0 || len(statuses) != len(c.RemovedUsers) {
+		c.setRemovedUsersStatus(statuses)
+	}
+}
+
+// syncRemovedUsers applies the policy to the pending removed users and reports the outcome in the status of the
+// cluster. Failed attempts stay pending and are retried by the next sync.
+func (c *Cluster) syncRemovedUsers() error {
+	statuses := make([]spec.RemovedUserStatus, len(c.RemovedUsers))
+	copy(statuses, c.RemovedUsers)
+
+	changed := false
+	var lastErr error
+	for i := range statuses {
+		status := &statuses[i]
+		if !status.Pending {
+			continue
+		}
+		changed = true
+		status.Time = metav1.Now()
+		// defined again by other sources, i.e. the infrastructure roles or the teams API
+		if _, ok := c.pgUsers[status.Name]; ok {
+			status.Action = spec.RemovedUsersPolicyKeep
+			status.Error = ""
+			status.Pending = false
+			continue
+		}
+		c.setProcessName("applying the %s policy to the removed user %q", status.Action, status.Name)
+		if err := c.applyRemovedUsersPolicy(status.Name, status.Action); err != nil {
+			status.Error = err.Error()
+			lastErr = fmt.Errorf("could not apply the %s policy to the removed user %q: %v", status.Action, status.Name, err)
+			continue
+		}
+		status.Error = ""
+		status.Pending = false
+		c.logger.Infof("applied the %s policy to the removed user %q", status.Action, status.Name)
+	}
+	if changed {
+		c.setRemovedUsersStatus(statuses)
+	}
+
+	return lastErr
+}
+
+// applyRemovedUsersPolicy keeps the role of the removed user, revokes its LOGIN or drops it. The objects of the
+// dropped roles are reassigned to the superuser in every database and the privileges granted to them are revoked,
+// as Postgres refuses to drop roles with dependent objects. The secrets of the dropped roles are deleted.
+func (c *Cluster) applyRemovedUsersPolicy(username string, policy spec.RemovedUsersPolicy) error {
+	if policy == spec.RemovedUsersPolicyKeep {
+		return nil
+	}
+
+	if err := c.initDbConn(); err != nil {
+		return fmt.Errorf("could not init db connection: %v", err)
+	}
+	defer func() {
+		if err := c.closeDbConn(); err != nil {
+			c.logger.Errorf("could not close db connection: %v", err)
+		}
+	}()
+
+	// the role of the previous password exists only during the grace period of a password rotation, and a retry
+	// after a partial success finds some of the roles dropped already
+	roles, err := c.existingRoles([]string{username, username + constants.PreviousUserSuffix})
+	if err != nil {
+		return err
+	}
+	if policy == spec.RemovedUsersPolicyNoLogin {
+		if !util.SliceContains(roles, username) {
+			c.logger.Debugf("role %q does not exist anymore", username)
+			return nil
+		}
+		if _, err := c.pgDb.Exec(fmt.Sprintf(disableLoginSQL, username)); err != nil {
+			return fmt.Errorf("could not revoke login: %v", err)
+		}
+		return nil
+	}
+	if len(roles) > 0 {
+		if err := c.dropRemovedRoles(roles); err != nil {
+			return err
+		}
+	}
+
+	secret, err := c.KubeClient.Secrets(c.Namespace).Get(c.credentialSecretName(username), metav1.GetOptions{})
+	if err != nil {
+		if k8sutil.ResourceNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("could not get secret: %v", err)
+	}
+	if err := c.deleteSecret(secret); err != nil {
+		return fmt.Errorf("could not delete secret: %v", err)
+	}
+
+	return nil
+}
+
+// existingRoles returns the roles of the list that exist in the cluster, in the order of the list.
+func (c *Cluster) existingRoles(roles []string) ([]string, error) {
+	rows, err := c.pgDb.Query(existingRolesSQL, pq.Array(roles))
+	if err != nil {
+		return nil, fmt.Errorf("could not query roles: %v", err)
+	}
+	defer rows.Close()
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var rolname string
+		if err := rows.Scan(&rolname); err != nil {
+			return nil, fmt.Errorf("error when processing row: %v", err)
+		}
+		existing[rolname] = true
+	}
+
+	result := make([]string, 0)
+	for _, role := range roles {
+		if existing[role] {
+			result = append(result, role)
+		}
+	}
+	return result, nil
+}
+
+// dropRemovedRoles reassigns the objects of the existing roles to the superuser in every database and drops them.
+func (c *Cluster) dropRemovedRoles(roles []string) error {
+	rows, err := c.pgDb.Query(connectableDatabasesSQL)
+	if err != nil {
+		return fmt.Errorf("could not query databases: %v", err)
+	}
+	databases := make([]string, 0)
+	for rows.Next() {
+		var datname string
+		if err := rows.Scan(&datname); err != nil {
+			rows.Close()
+			return fmt.Errorf("error when processing row: %v", err)
+		}
+		databases = append(databases, datname)
+	}
+	rows.Close()
+
+	superuser := c.systemUsers[constants.SuperuserKeyName]
+	for _, datname := range databases {
+		conn, err := openConnection(fmt.Sprintf("%s.%s.svc.cluster.local", c.Name, c.Namespace), datname,
+			superuser.Name, superuser.Password)
+		if err != nil {
+			return fmt.Errorf("could not connect to the database %q: %v", datname, err)
+		}
+		for _, role := range roles {
+			if _, err := conn.Exec(fmt.Sprintf(reassignOwnedSQL, role, superuser.Name, role)); err != nil {
+				conn.Close()
+				return fmt.Errorf("could not reassign the objects in the database %q: %v", datname, err)
+			}
+		}
+		if err := conn.Close(); err != nil {
+			c.logger.Errorf("could not close connection to the database %q: %v", datname, err)
+		}
+	}
+	// the role of the previous password acts as the user and goes first
+	for i := len(roles) - 1; i >= 0; i-- {
+		if _, err := c.pgDb.Exec(fmt.Sprintf(dropRoleSQL, roles[i])); err != nil {
+			return fmt.Errorf("could not drop role %q: %v", roles[i], err)
+		}
+	}
+
+	return nil
+}
+
+// setRemovedUsersStatus writes the actions taken for the removed users to the removedUsers section of the postgresql
+// object.
+func (c *Cluster) setRemovedUsersStatus(statuses []spec.RemovedUserStatus) {
+	c.RemovedUsers = statuses
+
+	var value interface{} = statuses
+	if len(statuses) == 0 {
+		// removes the section with the merge patch
+		value = nil
+	}
+	patch, err := json.Marshal(map[string]interface{}{"removedUsers": value})
+	if err != nil {
+		c.logger.Warningf("could not marshal status of the removed users: %v", err)
+		return
+	}
+	_, err = c.KubeClient.CRDREST.Patch(types.MergePatchType).
+		Namespace(c.Namespace).
+		Resource(constants.CRDResource).
+		Name(c.Name).
+		Body(patch).
+		DoRaw()
+	if err != nil && !k8sutil.ResourceNotFound(err) {
+		c.logger.Warningf("could not set the status of the removed users: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/config"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+func TestRemovedManifestUsers(t *testing.T) {
+	c := New(Config{OpConfig: config.Config{ProtectedRoles: []string{"admin"},
+		Auth: config.Auth{SuperUsername: superUserName, ReplicationUsername: replicationUserName}}},
+		k8sutil.KubernetesClient{}, spec.Postgresql{}, logger)
+	c.pgUsers = map[string]spec.PgUser{"foo": {Name: "foo"}, "robot": {Name: "robot"}}
+
+	tests := []struct {
+		oldUsers map[string]spec.UserFlags
+		newUsers map[string]spec.UserFlags
+		removed  []string
+	}{
+		{
+			oldUsers: map[string]spec.UserFlags{"foo": {}, "bar": {}},
+			newUsers: map[string]spec.UserFlags{"foo": {}, "bar": {}},
+			removed:  []string{},
+		},
+		{
+			oldUsers: map[string]spec.UserFlags{"foo": {}, "bar": {}, "baz": {}},
+			newUsers: map[string]spec.UserFlags{"foo": {}},
+			removed:  []string{"bar", "baz"},
+		},
+		{
+			// still an infrastructure role or a team member, a protected or a system role
+			oldUsers: map[string]spec.UserFlags{"robot": {}, "admin": {}, superUserName: {}},
+			newUsers: nil,
+			removed:  []string{},
+		},
+	}
+	for _, tt := range tests {
+		if removed := c.removedManifestUsers(tt.oldUsers, tt.newUsers); !reflect.DeepEqual(removed, tt.removed) {
+			t.Errorf("removed users of %v and %v expected: %v, got: %v", tt.oldUsers, tt.newUsers, tt.removed, removed)
+		}
+	}
+
+	c.OpConfig.RemovedUsersPolicy = "nologin"
+	if policy := c.removedUsersPolicy(); policy != spec.RemovedUsersPolicyNoLogin {
+		t.Errorf("expected the policy of the operator, got: %q", policy)
+	}
+	c.Spec.RemovedUsersPolicy = spec.RemovedUsersPolicyDrop
+	if policy := c.removedUsersPolicy(); policy != spec.RemovedUsersPolicyDrop {
+		t.Errorf("expected the policy of the manifest, got: %q", policy)
+	}
+}
+
+func TestRemovedUsersStatuses(t *testing.T) {
+	earlier := metav1.NewTime(time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC))
+	now := metav1.NewTime(time.Date(2018, 1, 2, 0, 0, 0, 0, time.UTC))
+	statuses := []spec.RemovedUserStatus{
+		{Name: "foo", Action: spec.RemovedUsersPolicyDrop, Time: earlier},
+		{Name: "bar", Action: spec.RemovedUsersPolicyDrop, Time: earlier, Error: "failed", Pending: true},
+		{Name: "baz", Action: spec.RemovedUsersPolicyNoLogin, Time: earlier},
+	}
+	newUsers := map[string]spec.UserFlags{"baz": {}}
+
+	tests := []struct {
+		removed []string
+		policy  spec.RemovedUsersPolicy
+		result  []spec.RemovedUserStatus
+	}{
+		{
+			removed: []string{},
+			policy:  spec.RemovedUsersPolicyDrop,
+			result:  statuses[:2],
+		},
+		{
+			removed: []string{"qux"},
+			policy:  spec.RemovedUsersPolicyNoLogin,
+			result: append(statuses[:2:2],
+				spec.RemovedUserStatus{Name: "qux", Action: spec.RemovedUsersPolicyNoLogin, Time: now, Pending: true}),
+		},
+		{
+			removed: []string{"foo"},
+			policy:  spec.RemovedUsersPolicyKeep,
+			result: []spec.RemovedUserStatus{statuses[1],
+				{Name: "foo", Action: spec.RemovedUsersPolicyKeep, Time: now}},
+		},
+	}
+	for _, tt := range tests {
+		result := removedUsersStatuses(statuses, tt.removed, newUsers, tt.policy, now)
+		if !reflect.DeepEqual(result, tt.result) {
+			t.Errorf("statuses with the removed users %v expected: %+v, got: %+v", tt.removed, tt.result, result)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package cluster
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+// renamedFrom returns the cluster the manifest takes over the volumes and passwords from, given as name or
+// namespace/name in the renamed-from annotation, or nil if the cluster is not renamed.
+func (c *Cluster) renamedFrom() (*spec.NamespacedName, error) {
+	value, ok := c.ObjectMeta.Annotations[constants.RenamedFromAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	name := spec.NamespacedName{Namespace: c.Namespace, Name: value}
+	if parts := strings.SplitN(value, "/", 2); len(parts) == 2 {
+		name = spec.NamespacedName{Namespace: parts[0], Name: parts[1]}
+	}
+	if name.Namespace == "" || name.Name == "" {
+		return nil, fmt.Errorf("incorrect name of the renamed cluster: %q", value)
+	}
+	if name.Namespace == c.Namespace && name.Name == c.Name {
+		return nil, fmt.Errorf("cluster can't be renamed from itself")
+	}
+	return &name, nil
+}
+
+// clusterLabelsFor returns the labels the operator gives the objects of the cluster with the given name.
+func (c *Cluster) clusterLabelsFor(clusterName string) labels.Set {
+	lbls := make(map[string]string)
+	for k, v := range c.OpConfig.ClusterLabels {
+		lbls[k] = v
+	}
+	lbls[c.OpConfig.ClusterNameLabel] = clusterName
+
+	return labels.Set(lbls)
+}
+
+// migrateRenamedCluster moves the persistent volumes of the renamed cluster to the claims of this one and takes over
+// the passwords of its system users, which the data on the volumes expects. The manifest of the old cluster must
+// have been deleted with its volumes retained, as the old cluster would run on them otherwise.
+func (c *Cluster) migrateRenamedCluster(oldName spec.NamespacedName) error {
+	c.setProcessName("migrating the renamed cluster %q", oldName)
+
+	_, err := c.KubeClient.CRDREST.Get().
+		Namespace(oldName.Namespace).
+		Resource(constants.CRDResource).
+		Name(oldName.Name).
+		DoRaw()
+	if err == nil {
+		return fmt.Errorf("the manifest of the cluster %q still exists", oldName)
+	}
+	if !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not get the cluster %q: %v", oldName, err)
+	}
+
+	pvcs, err := c.KubeClient.PersistentVolumeClaims(oldName.Namespace).List(
+		metav1.ListOptions{LabelSelector: c.clusterLabelsFor(oldName.Name).String()})
+	if err != nil {
+		return fmt.Errorf("could not list persistent volume claims of the cluster %q: %v", oldName, err)
+	}
+	for i, pvc := range pvcs.Items {
+		newName := c.renamedClaimName(pvc.Name, oldName.Name)
+		if newName == "" {
+			c.logger.Warningf("persistent volume claim %q doesn't belong to a volume of the cluster, leaving it", pvc.Name)
+			continue
+		}
+		// the markers of the retained claims tell which one to start the first pod on
+		annotations := make(map[string]string)
+		for _, key := range []string{constants.VolumeStorageClassAnnotation, constants.RetainedVolumeAnnotation,
+			constants.RetainedMasterVolumeAnnotation} {
+			if value, ok := pvc.Annotations[key]; ok {
+				annotations[key] = value
+			}
+		}
+		err := c.movePersistentVolumeClaim(&pvcs.Items[i], metav1.ObjectMeta{
+			Name:        newName,
+			Namespace:   c.Namespace,
+			Labels:      c.labelsSet(),
+			Annotations: annotations,
+		})
+		if err != nil {
+			return fmt.Errorf("could not move persistent volume claim %q: %v", pvc.Name, err)
+		}
+	}
+
+	for key, user := range c.systemUsers {
+		secretName := c.credentialSecretNameForCluster(user.Name, oldName.Name)
+		secret, err := c.KubeClient.Secrets(oldName.Namespace).Get(secretName, metav1.GetOptions{})
+		if err != nil {
+			c.logger.Warningf("could not get password of the user %q of the renamed cluster: %v", user.Name, err)
+			continue
+		}
+		user.Password = string(secret.Data["password"])
+		c.systemUsers[key] = user
+	}
+
+	return nil
+}
+
+// renamedClaimName returns the name of the claim of this cluster corresponding to the claim of the renamed cluster,
+// or an empty string if the claim is not one of a cluster volume.
+func (c *Cluster) renamedClaimName(claimName, oldClusterName string) string {
+	for _, volume := range persistentClusterVolumes(&c.Spec) {
+		prefix := fmt.Sprintf("%s-%s-", volume.name, oldClusterName)
+		if !strings.HasPrefix(claimName, prefix) {
+			continue
+		}
+		if _, err := strconv.Atoi(claimName[len(prefix):]); err != nil {
+			continue
+		}
+		return fmt.Sprintf("%s-%s-%s", volume.name, c.statefulSetName(), claimName[len(prefix):])
+	}
+	return ""
+}
+
+// deleteRenamedClusterSecrets removes the secrets the deletion of the renamed cluster has left behind, once their
+// passwords are stored in the secrets of this cluster.
+func (c *Cluster) deleteRenamedClusterSecrets(oldName spec.NamespacedName) error {
+	secrets, err := c.KubeClient.Secrets(oldName.Namespace).List(
+		metav1.ListOptions{LabelSelector: c.clusterLabelsFor(oldName.Name).String()})
+	if err != nil {
+		return fmt.Errorf("could not list secrets of the cluster %q: %v", oldName, err)
+	}
+	for _, secret := range secrets.Items {
+		if err := c.KubeClient.Secrets(oldName.Namespace).Delete(secret.Name, c.deleteOptions); err != nil && !k8sutil.ResourceNotFound(err) {
+			return fmt.Errorf("could not delete secret %q: %v", secret.Name, err)
+		}
+		c.logger.Infof("secret %q of the renamed cluster has been deleted", secret.Name)
+	}
+	return nil
+}
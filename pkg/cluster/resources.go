@@ -1,6 +1,7 @@
 package cluster
 
 import (
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -71,8 +72,64 @@ func (c *Cluster) createStatefulSet() (*v1beta1.StatefulSet, error) {
 	}
 	c.Statefulset = statefulSet
 	c.logger.Debugf("created new statefulset %q, uid: %q", util.NameFromMeta(statefulSet.ObjectMeta), statefulSet.UID)
+	if err := c.patchPodSpecExtensions(statefulSetSpec, true); err != nil {
+		return nil, err
+	}
+
+	return c.Statefulset, nil
+}
 
-	return statefulSet, nil
+// podSpecExtensions are the fields of the pod spec missing in the client library. The statefulset carries them in
+// annotations, as JSON except for the plain priority class name, and patchPodSpecExtensions copies them to the pod
+// template.
+var podSpecExtensions = []struct {
+	annotation string
+	field      string
+	isJSON     bool
+}{
+	{constants.PriorityClassNameAnnotation, "priorityClassName", false},
+	{constants.TopologySpreadConstraintsAnnotation, "topologySpreadConstraints", true},
+}
+
+// patchPodSpecExtensions sets the fields of the pod template from the annotations of the statefulset that have been
+// changed, or all of them if the statefulset has just been created.
+func (c *Cluster) patchPodSpecExtensions(newStatefulSet *v1beta1.StatefulSet, created bool) error {
+	annotations := make(map[string]interface{})
+	fields := make(map[string]interface{})
+	for _, extension := range podSpecExtensions {
+		value := newStatefulSet.Annotations[extension.annotation]
+		if created && value == "" || !created && c.Statefulset.Annotations[extension.annotation] == value {
+			continue
+		}
+		if value == "" {
+			annotations[extension.annotation] = nil
+			fields[extension.field] = nil
+		} else if extension.isJSON {
+			annotations[extension.annotation] = value
+			fields[extension.field] = json.RawMessage(value)
+		} else {
+			annotations[extension.annotation] = value
+			fields[extension.field] = value
+		}
+	}
+	if len(annotations) == 0 {
+		return nil
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": annotations},
+		"spec":     map[string]interface{}{"template": map[string]interface{}{"spec": fields}},
+	})
+	if err != nil {
+		return fmt.Errorf("could not form patch for the pod template: %v", err)
+	}
+
+	statefulSet, err := c.KubeClient.StatefulSets(c.Statefulset.Namespace).Patch(c.Statefulset.Name, types.MergePatchType, patch)
+	if err != nil {
+		return fmt.Errorf("could not patch the pod template of the statefulset %q: %v", c.Statefulset.Name, err)
+	}
+	c.Statefulset = statefulSet
+
+	return nil
 }
 
 func getPodIndex(podName string) (int32, error) {
@@ -104,8 +161,8 @@ func (c *Cluster) preScaleDown(newStatefulSet *v1beta1.StatefulSet) error {
 		return fmt.Errorf("could not get pod number: %v", err)
 	}
 
-	//Check if scale down affects current master pod
-	if *newStatefulSet.Spec.Replicas >= podNum+1 {
+	//Check if scale down affects current master pod, there is no one to take over when scaling to zero
+	if *newStatefulSet.Spec.Replicas >= podNum+1 || *newStatefulSet.Spec.Replicas == 0 {
 		return nil
 	}
 
@@ -157,7 +214,7 @@ func (c *Cluster) updateStatefulSet(newStatefulSet *v1beta1.StatefulSet) error {
 	}
 	c.Statefulset = statefulSet
 
-	return nil
+	return c.patchPodSpecExtensions(newStatefulSet, false)
 }
 
 // replaceStatefulSet deletes an old StatefulSet and creates the new using spec in the PostgreSQL CRD.
@@ -205,7 +262,7 @@ func (c *Cluster) replaceStatefulSet(newStatefulSet *v1beta1.StatefulSet) error
 	}
 
 	c.Statefulset = createdStatefulset
-	return nil
+	return c.patchPodSpecExtensions(newStatefulSet, true)
 }
 
 func (c *Cluster) deleteStatefulSet() error {
@@ -222,11 +279,19 @@ func (c *Cluster) deleteStatefulSet() error {
 	c.logger.Infof("statefulset %q has been deleted", util.NameFromMeta(c.Statefulset.ObjectMeta))
 	c.Statefulset = nil
 
+	// remember the master before the pods are gone, its volumes may need to be retained
+	masterPodName := ""
+	if masterPods, err := c.getRolePods(Master); err != nil {
+		c.logger.Warningf("could not get master pod: %v", err)
+	} else if len(masterPods) > 0 {
+		masterPodName = masterPods[0].Name
+	}
+
 	if err := c.deletePods(); err != nil {
 		return fmt.Errorf("could not delete pods: %v", err)
 	}
 
-	if err := c.deletePersistenVolumeClaims(); err != nil {
+	if err := c.deleteOrRetainPersistentVolumeClaims(masterPodName); err != nil {
 		return fmt.Errorf("could not delete PersistentVolumeClaims: %v", err)
 	}
 
@@ -0,0 +1,66 @@
+package cluster
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/cron"
+)
+
+// syncScheduledRestart recreates the pods of the cluster, replicas first, when the restart schedule of the manifest
+// is due since the last scheduled restart. A cluster seen with a schedule for the first time counts as restarted now,
+// so that it isn't restarted right away. A restart due outside of the maintenance windows waits for the next one.
+// The schedule is in UTC, like the maintenance windows.
+func (c *Cluster) syncScheduledRestart() error {
+	if c.Spec.RestartSchedule == "" || c.statefulSetReplicas() == 0 {
+		return nil
+	}
+	schedule, err := cron.Parse(c.Spec.RestartSchedule)
+	if err != nil {
+		return fmt.Errorf("could not parse restart schedule: %v", err)
+	}
+
+	now := time.Now().UTC()
+	value, ok := c.Statefulset.Annotations[constants.LastScheduledRestartAnnotation]
+	if !ok {
+		c.logger.Infof("starting the restart schedule %q", c.Spec.RestartSchedule)
+		return c.recordScheduledRestart(now)
+	}
+	lastRestart, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return fmt.Errorf("could not parse the time of the last scheduled restart: %v", err)
+	}
+	if next := schedule.Next(lastRestart.UTC()); next.IsZero() || next.After(now) {
+		return nil
+	}
+	if !c.inMaintenanceWindow() {
+		c.logger.Debugf("scheduled restart deferred until the next maintenance window")
+		return nil
+	}
+
+	c.logger.Infof("performing the scheduled restart of the pods")
+	if err := c.recreatePods(); err != nil {
+		return fmt.Errorf("could not recreate pods: %v", err)
+	}
+	if err := c.recordScheduledRestart(now); err != nil {
+		return err
+	}
+	c.logger.Infof("pods have been restarted as scheduled")
+
+	return nil
+}
+
+func (c *Cluster) recordScheduledRestart(restartTime time.Time) error {
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, constants.LastScheduledRestartAnnotation,
+		restartTime.Format(time.RFC3339))
+	statefulSet, err := c.KubeClient.StatefulSets(c.Namespace).Patch(c.statefulSetName(), types.MergePatchType, []byte(patch))
+	if err != nil {
+		return fmt.Errorf("could not record the scheduled restart: %v", err)
+	}
+	c.Statefulset = statefulSet
+
+	return nil
+}
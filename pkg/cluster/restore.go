@@ -0,0 +1,238 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+// restoreCloneDescription returns the clone of the cluster from its own archive up to the target of the restore. The
+// WAL tool depends on the clone description, so the pgBackRest repository is checked on the manifest directly.
+func (c *Cluster) restoreCloneDescription(pgSpec *spec.PostgresSpec, restore *spec.RestoreStatus) *spec.CloneDescription {
+	var options spec.RecoveryTargetOptions
+	if restore.Options != nil {
+		options = *restore.Options
+	}
+	if pgSpec.PgBackRest != nil {
+		return &spec.CloneDescription{
+			ClusterName:           pgBackRestStanza(pgSpec.PgBackRest, c.Name),
+			PgBackRest:            true,
+			EndTimestamp:          restore.Target,
+			RecoveryTargetOptions: options,
+		}
+	}
+	return &spec.CloneDescription{
+		ClusterName:           c.Name,
+		Uid:                   string(c.Postgresql.GetUID()),
+		EndTimestamp:          restore.Target,
+		RecoveryTargetOptions: options,
+	}
+}
+
+// syncRestore restores the cluster in place to the time of the restore-to annotation, once the restore-confirm
+// annotation repeats the name of the cluster. The running restore, including one interrupted by a restart of the
+// operator, is checked by the following syncs until the restored master is up.
+func (c *Cluster) syncRestore() error {
+	if c.startedRestore != nil && (c.Restore == nil || c.Restore.Target != c.startedRestore.Target) {
+		// the postgresql object hasn't caught up with the status of the restore started by this operator yet
+		c.Restore = c.startedRestore
+	}
+	target := c.Annotations[constants.RestoreTargetAnnotation]
+	if target != "" && (c.Restore == nil || c.Restore.Target != target) {
+		if confirm := c.Annotations[constants.RestoreConfirmAnnotation]; confirm != c.Name {
+			c.recordEvent(v1.EventTypeWarning, constants.EventReasonRestoreFailed,
+				"restore to %s requires the annotation %s set to %q", target, constants.RestoreConfirmAnnotation, c.Name)
+			return nil
+		}
+		return c.restoreInPlace(target)
+	}
+	if c.restoreRunning() {
+		return c.checkRestore()
+	}
+
+	return nil
+}
+
+func (c *Cluster) restoreInPlace(target string) error {
+	c.setProcessName("restoring the cluster to %s", target)
+	c.logger.Infof("restoring the cluster to %s", target)
+
+	status := &spec.RestoreStatus{Target: target, Phase: spec.BackupRequestRunning, Options: c.Spec.RestoreOptions}
+	c.Restore = status
+	if err := c.patchRestoreStatus(status); err != nil {
+		return err
+	}
+
+	if err := c.checkRestoreTarget(target); err != nil {
+		return c.finishRestore(status, err)
+	}
+
+	// a restart of the operator must not repeat the restore once the cluster is being stopped
+	status.StartTime = &metav1.Time{Time: time.Now()}
+	if err := c.patchRestoreStatus(status); err != nil {
+		status.StartTime = nil
+		return fmt.Errorf("not stopping the cluster: %v", err)
+	}
+	c.startedRestore = status
+	c.recordEvent(v1.EventTypeNormal, constants.EventReasonRestoreStarted,
+		"stopping the cluster to restore it to %s", target)
+
+	if err := c.stopForRestore(); err != nil {
+		return c.finishRestore(status, err)
+	}
+	if err := c.ensureInstanceVolumeClaims(); err != nil {
+		return c.finishRestore(status, fmt.Errorf("could not create persistent volume claims: %v", err))
+	}
+	if _, err := c.createStatefulSet(); err != nil {
+		return c.finishRestore(status, fmt.Errorf("could not create statefulset: %v", err))
+	}
+	c.logger.Infof("cluster has been stopped, waiting for the restored master")
+
+	return nil
+}
+
+// restoreRunning checks if the cluster is being restored in place, so that the rest of the sync has to wait for the
+// restored master.
+func (c *Cluster) restoreRunning() bool {
+	return c.Restore != nil && c.Restore.Phase == spec.BackupRequestRunning
+}
+
+// checkRestoreTarget refuses the restore before anything is stopped when the archive cannot reach the target.
+func (c *Cluster) checkRestoreTarget(target string) error {
+	targetTime, err := time.Parse(time.RFC3339, target)
+	if err != nil {
+		return fmt.Errorf("could not parse the restore target: %v", err)
+	}
+	if !c.walArchiveEnabled(&c.Spec) {
+		return fmt.Errorf("the cluster has no WAL archive to restore from")
+	}
+	if !c.patroniUsesKubernetes() {
+		return fmt.Errorf("restore in place requires Patroni to keep its state in Kubernetes")
+	}
+	if err := c.syncBaseBackups(); err != nil {
+		return fmt.Errorf("could not list base backups: %v", err)
+	}
+
+	return restoreTargetCovered(c.GetBaseBackups(), targetTime, time.Now())
+}
+
+// restoreTargetCovered checks that the target lies in the past and after one of the base backups. Without the list
+// of the base backups, i.e. when the master isn't ready to list them, nothing guarantees the restore can succeed.
+func restoreTargetCovered(backups []spec.BaseBackup, target, now time.Time) error {
+	if !target.Before(now) {
+		return fmt.Errorf("restore target %s is not in the past", target.Format(time.RFC3339))
+	}
+	if backups == nil {
+		return fmt.Errorf("the base backups could not be listed")
+	}
+	for _, backup := range backups {
+		if !backup.Time.After(target) {
+			return nil
+		}
+	}
+	return fmt.Errorf("no base backup finished before %s", target.Format(time.RFC3339))
+}
+
+// stopForRestore removes the statefulset, the pods, their volumes and the Patroni state, so that the new pods
+// bootstrap a new cluster instead of joining the old one.
+func (c *Cluster) stopForRestore() error {
+	if c.Statefulset != nil {
+		err := c.KubeClient.StatefulSets(c.Namespace).Delete(c.Statefulset.Name, c.deleteOptions)
+		if err != nil && !k8sutil.ResourceNotFound(err) {
+			return fmt.Errorf("could not delete statefulset: %v", err)
+		}
+		c.Statefulset = nil
+	}
+	if err := c.deletePods(); err != nil {
+		return fmt.Errorf("could not delete pods: %v", err)
+	}
+
+	pvcs, err := c.listPersistentVolumeClaims()
+	if err != nil {
+		return fmt.Errorf("could not list persistent volume claims: %v", err)
+	}
+	for _, pvc := range pvcs {
+		if err := c.deletePersistentVolumeClaimAndWait(pvc.Namespace, pvc.Name); err != nil {
+			return err
+		}
+	}
+
+	if err := c.deletePatroniClusterObjects(); err != nil {
+		return fmt.Errorf("could not delete Patroni objects: %v", err)
+	}
+	return nil
+}
+
+func (c *Cluster) restoredMasterReady() (bool, error) {
+	masterPods, err := c.getRolePods(Master)
+	if err != nil {
+		return false, err
+	}
+	return len(masterPods) == 1 && podIsReady(&masterPods[0]), nil
+}
+
+// checkRestore finishes the restore once the restored master is ready, or after the restore_timeout.
+func (c *Cluster) checkRestore() error {
+	status := c.Restore
+	if status.StartTime == nil {
+		return c.finishRestore(status, fmt.Errorf("restore has been interrupted before the cluster was stopped"))
+	}
+	ready, err := c.restoredMasterReady()
+	if err != nil {
+		return fmt.Errorf("could not check the restored master: %v", err)
+	}
+	if ready {
+		return c.finishRestore(status, nil)
+	}
+	if time.Since(status.StartTime.Time) > c.OpConfig.RestoreTimeout {
+		return c.finishRestore(status, fmt.Errorf("restored master is not ready after %v", c.OpConfig.RestoreTimeout))
+	}
+
+	return nil
+}
+
+func (c *Cluster) finishRestore(status *spec.RestoreStatus, err error) error {
+	status.CompletionTime = &metav1.Time{Time: time.Now()}
+	if err != nil {
+		status.Phase = spec.BackupRequestFailed
+		status.Error = err.Error()
+		c.recordEvent(v1.EventTypeWarning, constants.EventReasonRestoreFailed,
+			"restore to %s failed: %v", status.Target, err)
+		err = fmt.Errorf("could not restore the cluster to %s: %v", status.Target, err)
+	} else {
+		status.Phase = spec.BackupRequestSucceeded
+		c.recordEvent(v1.EventTypeNormal, constants.EventReasonRestored,
+			"cluster has been restored to %s", status.Target)
+	}
+	if patchErr := c.patchRestoreStatus(status); patchErr != nil {
+		c.logger.Warningf("%v", patchErr)
+	}
+
+	return err
+}
+
+func (c *Cluster) patchRestoreStatus(status *spec.RestoreStatus) error {
+	patch, err := json.Marshal(map[string]interface{}{"restore": status})
+	if err != nil {
+		return fmt.Errorf("could not marshal the status of the restore: %v", err)
+	}
+	_, err = c.KubeClient.CRDREST.Patch(types.MergePatchType).
+		Namespace(c.Namespace).
+		Resource(constants.CRDResource).
+		Name(c.Name).
+		Body(patch).
+		DoRaw()
+	if err != nil && !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not set the status of the restore: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/config"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+func TestRestoreTargetCovered(t *testing.T) {
+	now := time.Date(2017, 12, 10, 12, 0, 0, 0, time.UTC)
+	backups := []spec.BaseBackup{{Name: "base_1", Time: now.Add(-24 * time.Hour)}, {Name: "base_2", Time: now.Add(-time.Hour)}}
+	tests := []struct {
+		name    string
+		backups []spec.BaseBackup
+		target  time.Time
+		valid   bool
+	}{
+		{"after the last backup", backups, now.Add(-time.Minute), true},
+		{"between the backups", backups, now.Add(-2 * time.Hour), true},
+		{"before the first backup", backups, now.Add(-48 * time.Hour), false},
+		{"in the future", backups, now.Add(time.Minute), false},
+		{"no backups", []spec.BaseBackup{}, now.Add(-time.Minute), false},
+		{"backups not listed", nil, now.Add(-time.Minute), false},
+	}
+	for _, tt := range tests {
+		if err := restoreTargetCovered(tt.backups, tt.target, now); (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid %t, got error: %v", tt.name, tt.valid, err)
+		}
+	}
+}
+
+func TestRestoreCloneDescription(t *testing.T) {
+	c := New(Config{OpConfig: config.Config{WALES3Bucket: "backups", WALTool: constants.WALToolWALG}},
+		k8sutil.KubernetesClient{}, spec.Postgresql{ObjectMeta: metav1.ObjectMeta{Name: "acid-test", UID: "uid"}}, logger)
+
+	pgSpec := &spec.PostgresSpec{Clone: spec.CloneDescription{ClusterName: "acid-source"}}
+	c.Restore = &spec.RestoreStatus{Target: "2017-12-10T01:00:00Z", Phase: spec.BackupRequestRunning}
+	if description := c.cloneDescription(pgSpec); description.ClusterName != "acid-source" {
+		t.Errorf("expected the clone of the manifest before the cluster is stopped, got: %#v", description)
+	}
+
+	c.Restore.StartTime = &metav1.Time{Time: time.Date(2017, 12, 10, 2, 0, 0, 0, time.UTC)}
+	expected := &spec.CloneDescription{ClusterName: "acid-test", Uid: "uid", EndTimestamp: "2017-12-10T01:00:00Z"}
+	if description := c.cloneDescription(pgSpec); !reflect.DeepEqual(description, expected) {
+		t.Errorf("expected the clone description %#v, got: %#v", expected, description)
+	}
+}
@@ -0,0 +1,295 @@
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/retryutil"
+)
+
+// pvcRetentionPolicy returns the retention policy of the cluster manifest, falling back to the operator configuration.
+func (c *Cluster) pvcRetentionPolicy() spec.PVCRetentionPolicy {
+	if c.Spec.PVCRetentionPolicy != "" {
+		return c.Spec.PVCRetentionPolicy
+	}
+	return spec.PVCRetentionPolicy(c.OpConfig.PVCRetentionPolicy)
+}
+
+// deleteOrRetainPersistentVolumeClaims applies the retention policy to the claims of the deleted cluster.
+// Retained claims are marked, so that the garbage collection of orphaned claims leaves them alone, and the claims
+// of the last master are marked in addition, so that they are picked for the first pod when the cluster is recreated.
+func (c *Cluster) deleteOrRetainPersistentVolumeClaims(masterPodName string) error {
+	if len(persistentClusterVolumes(&c.Spec)) == 0 {
+		c.logger.Debugln("cluster has only ephemeral volumes, no PVCs to delete")
+		return nil
+	}
+	policy := c.pvcRetentionPolicy()
+	switch policy {
+	case spec.PVCRetentionPolicyRetain, spec.PVCRetentionPolicyRetainLast:
+		if masterPodName == "" {
+			c.logger.Warningf("could not determine the master pod, retaining all PVCs")
+			return c.markRetainedClaims("")
+		}
+		if err := c.markRetainedMasterClaims(masterPodName); err != nil {
+			return err
+		}
+		if policy == spec.PVCRetentionPolicyRetain {
+			if err := c.markRetainedClaims(masterPodName); err != nil {
+				return err
+			}
+			c.logger.Infof("retaining PVCs of the cluster")
+			return nil
+		}
+		return c.deletePersistenVolumeClaims(masterPodName)
+	default:
+		return c.deletePersistenVolumeClaims("")
+	}
+}
+
+func (c *Cluster) markRetainedMasterClaims(masterPodName string) error {
+	patch := []byte(fmt.Sprintf(`{"metadata":{"annotations":{%q:"true",%q:"true"}}}`,
+		constants.RetainedMasterVolumeAnnotation, constants.RetainedVolumeAnnotation))
+	for _, volume := range persistentClusterVolumes(&c.Spec) {
+		claimName := fmt.Sprintf("%s-%s", volume.name, masterPodName)
+		_, err := c.KubeClient.PersistentVolumeClaims(c.Namespace).Patch(claimName, types.MergePatchType, patch)
+		if err != nil && !k8sutil.ResourceNotFound(err) {
+			return fmt.Errorf("could not mark persistent volume claim %q of the master: %v", claimName, err)
+		}
+	}
+	return nil
+}
+
+// markRetainedClaims marks the claims of all pods except the one of the master, which are marked separately.
+func (c *Cluster) markRetainedClaims(masterPodName string) error {
+	pvcs, err := c.listPersistentVolumeClaims()
+	if err != nil {
+		return err
+	}
+	patch := []byte(fmt.Sprintf(`{"metadata":{"annotations":{%q:"true"}}}`, constants.RetainedVolumeAnnotation))
+	for _, pvc := range pvcs {
+		if masterPodName != "" && c.claimBelongsToPod(&pvc, masterPodName) {
+			continue
+		}
+		if _, err := c.KubeClient.PersistentVolumeClaims(pvc.Namespace).Patch(pvc.Name, types.MergePatchType, patch); err != nil {
+			return fmt.Errorf("could not mark persistent volume claim %q as retained: %v", pvc.Name, err)
+		}
+	}
+	return nil
+}
+
+func (c *Cluster) unmarkRetainedClaim(pvc *v1.PersistentVolumeClaim) error {
+	_, master := pvc.Annotations[constants.RetainedMasterVolumeAnnotation]
+	_, retained := pvc.Annotations[constants.RetainedVolumeAnnotation]
+	if !master && !retained {
+		return nil
+	}
+	patch := []byte(fmt.Sprintf(`{"metadata":{"annotations":{%q:null,%q:null}}}`,
+		constants.RetainedMasterVolumeAnnotation, constants.RetainedVolumeAnnotation))
+	if _, err := c.KubeClient.PersistentVolumeClaims(pvc.Namespace).Patch(pvc.Name, types.MergePatchType, patch); err != nil {
+		return fmt.Errorf("could not unmark persistent volume claim %q: %v", pvc.Name, err)
+	}
+	return nil
+}
+
+// adoptRetainedVolumeClaims prepares the claims retained from the previous incarnation of the cluster, so that the
+// first pod of the new statefulset starts on the volumes of the last master. When those belong to another pod,
+// their persistent volumes are rebound to the claims of the first pod. The stale claims of the first pod are deleted,
+// unless the policy is to retain all claims, in which case they take the place of the claims of the last master.
+// Claims not marked as retained, i.e. left over by a failed attempt to create the cluster, are not touched.
+func (c *Cluster) adoptRetainedVolumeClaims() error {
+	if len(persistentClusterVolumes(&c.Spec)) == 0 {
+		return nil
+	}
+	pvcs, err := c.listPersistentVolumeClaims()
+	if err != nil {
+		return fmt.Errorf("could not list persistent volume claims: %v", err)
+	}
+	if len(pvcs) == 0 {
+		return nil
+	}
+	c.setProcessName("adopting retained persistent volume claims")
+
+	for _, volume := range persistentClusterVolumes(&c.Spec) {
+		claims := make(map[int]*v1.PersistentVolumeClaim)
+		for i := range pvcs {
+			if !c.claimBelongsToVolume(&pvcs[i], volume.name) || !claimRetained(&pvcs[i]) {
+				continue
+			}
+			// claimBelongsToVolume guarantees the pod index at the end of the name
+			index, _ := strconv.Atoi(pvcs[i].Name[len(volume.name)+len(c.statefulSetName())+2:])
+			claims[index] = &pvcs[i]
+		}
+		source := retainedMasterClaimIndex(claims)
+		if source < 0 {
+			continue
+		}
+		for index, claim := range claims {
+			// claims to be replaced or moved below are left as they are
+			if source > 0 && (index == 0 || index == source) {
+				continue
+			}
+			if err := c.unmarkRetainedClaim(claim); err != nil {
+				return err
+			}
+		}
+		if source == 0 {
+			c.logger.Infof("adopting retained persistent volume claim %q", claims[0].Name)
+			continue
+		}
+		stale, ok := claims[0]
+		if ok && c.pvcRetentionPolicy() == spec.PVCRetentionPolicyRetain {
+			if err := c.swapRetainedVolumeClaims(stale, claims[source]); err != nil {
+				return err
+			}
+			continue
+		}
+		if ok {
+			c.logger.Infof("deleting persistent volume claim %q of the former replica", stale.Name)
+			if err := c.deletePersistentVolumeClaimAndWait(stale.Namespace, stale.Name); err != nil {
+				return err
+			}
+		}
+		if err := c.rebindPersistentVolumeClaim(claims[source], fmt.Sprintf("%s-%s-0", volume.name, c.statefulSetName())); err != nil {
+			return fmt.Errorf("could not adopt persistent volume claim %q: %v", claims[source].Name, err)
+		}
+	}
+
+	return nil
+}
+
+// claimRetained checks if the claim has been marked as retained when the previous incarnation of the cluster was deleted.
+func claimRetained(pvc *v1.PersistentVolumeClaim) bool {
+	_, master := pvc.Annotations[constants.RetainedMasterVolumeAnnotation]
+	_, retained := pvc.Annotations[constants.RetainedVolumeAnnotation]
+	return master || retained
+}
+
+// swapRetainedVolumeClaims exchanges the persistent volumes of the stale claim of the first pod and the claim of the
+// last master, so that none of the retained volumes is released. The volume of the first pod is parked on a
+// temporary claim, still marked as retained, while the volume of the master is moved.
+func (c *Cluster) swapRetainedVolumeClaims(stale, master *v1.PersistentVolumeClaim) error {
+	c.logger.Infof("swapping persistent volumes of the claims %q and %q", stale.Name, master.Name)
+	parked := *stale
+	parked.ObjectMeta = metav1.ObjectMeta{
+		Name:        stale.Name + "-swap",
+		Namespace:   stale.Namespace,
+		Labels:      stale.Labels,
+		Annotations: map[string]string{constants.RetainedVolumeAnnotation: "true"},
+	}
+	if storageClass, ok := stale.Annotations[constants.VolumeStorageClassAnnotation]; ok {
+		parked.Annotations[constants.VolumeStorageClassAnnotation] = storageClass
+	}
+	if err := c.movePersistentVolumeClaim(stale, parked.ObjectMeta); err != nil {
+		return fmt.Errorf("could not park persistent volume claim %q: %v", stale.Name, err)
+	}
+	if err := c.rebindPersistentVolumeClaim(master, stale.Name); err != nil {
+		return fmt.Errorf("could not adopt persistent volume claim %q: %v", master.Name, err)
+	}
+	if err := c.rebindPersistentVolumeClaim(&parked, master.Name); err != nil {
+		return fmt.Errorf("could not move persistent volume claim %q: %v", parked.Name, err)
+	}
+	return nil
+}
+
+// retainedMasterClaimIndex returns the pod index of the claim marked as the one of the master, or the lowest
+// index if none is marked, or -1 if there are no claims at all.
+func retainedMasterClaimIndex(claims map[int]*v1.PersistentVolumeClaim) int {
+	indexes := make([]int, 0, len(claims))
+	for index, claim := range claims {
+		if claim.Annotations[constants.RetainedMasterVolumeAnnotation] == "true" {
+			return index
+		}
+		indexes = append(indexes, index)
+	}
+	if len(indexes) == 0 {
+		return -1
+	}
+	sort.Ints(indexes)
+	return indexes[0]
+}
+
+// rebindPersistentVolumeClaim moves the persistent volume of the claim to the new claim with the given name.
+func (c *Cluster) rebindPersistentVolumeClaim(pvc *v1.PersistentVolumeClaim, newName string) error {
+	annotations := make(map[string]string)
+	if storageClass, ok := pvc.Annotations[constants.VolumeStorageClassAnnotation]; ok {
+		annotations[constants.VolumeStorageClassAnnotation] = storageClass
+	}
+	return c.movePersistentVolumeClaim(pvc, metav1.ObjectMeta{
+		Name:        newName,
+		Namespace:   pvc.Namespace,
+		Labels:      pvc.Labels,
+		Annotations: annotations,
+	})
+}
+
+// movePersistentVolumeClaim moves the persistent volume of the claim to a new claim with the given metadata, which
+// may be in another namespace. The volume is retained while the old claim is deleted, and released for the new claim
+// afterwards.
+func (c *Cluster) movePersistentVolumeClaim(pvc *v1.PersistentVolumeClaim, newMeta metav1.ObjectMeta) error {
+	pvName := pvc.Spec.VolumeName
+	if pvName == "" {
+		return fmt.Errorf("persistent volume claim is not bound")
+	}
+	pv, err := c.KubeClient.PersistentVolumes().Get(pvName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("could not get persistent volume %q: %v", pvName, err)
+	}
+	reclaimPolicy := pv.Spec.PersistentVolumeReclaimPolicy
+	if err := c.patchPersistentVolume(pvName, fmt.Sprintf(`{"spec":{"persistentVolumeReclaimPolicy":%q}}`, v1.PersistentVolumeReclaimRetain)); err != nil {
+		return err
+	}
+	if err := c.deletePersistentVolumeClaimAndWait(pvc.Namespace, pvc.Name); err != nil {
+		return err
+	}
+	if err := c.patchPersistentVolume(pvName, `{"spec":{"claimRef":null}}`); err != nil {
+		return err
+	}
+
+	newClaim := &v1.PersistentVolumeClaim{
+		ObjectMeta: newMeta,
+		Spec:       pvc.Spec,
+	}
+	if _, err := c.KubeClient.PersistentVolumeClaims(newMeta.Namespace).Create(newClaim); err != nil {
+		return fmt.Errorf("could not create persistent volume claim %q: %v", newMeta.Name, err)
+	}
+	if err := c.patchPersistentVolume(pvName, fmt.Sprintf(`{"spec":{"persistentVolumeReclaimPolicy":%q}}`, reclaimPolicy)); err != nil {
+		return err
+	}
+	c.logger.Infof("persistent volume %q has been moved from the claim %q to %q", pvName,
+		util.NameFromMeta(pvc.ObjectMeta), util.NameFromMeta(newMeta))
+
+	return nil
+}
+
+func (c *Cluster) patchPersistentVolume(name, patch string) error {
+	if _, err := c.KubeClient.PersistentVolumes().Patch(name, types.MergePatchType, []byte(patch)); err != nil {
+		return fmt.Errorf("could not patch persistent volume %q: %v", name, err)
+	}
+	return nil
+}
+
+func (c *Cluster) deletePersistentVolumeClaimAndWait(namespace, name string) error {
+	if err := c.KubeClient.PersistentVolumeClaims(namespace).Delete(name, c.deleteOptions); err != nil && !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not delete persistent volume claim %q: %v", name, err)
+	}
+	return retryutil.Retry(c.OpConfig.ResourceCheckInterval, c.OpConfig.ResourceCheckTimeout,
+		func() (bool, error) {
+			_, err := c.KubeClient.PersistentVolumeClaims(namespace).Get(name, metav1.GetOptions{})
+			if k8sutil.ResourceNotFound(err) {
+				return true, nil
+			}
+			if err != nil {
+				return false, fmt.Errorf("could not get persistent volume claim %q: %v", name, err)
+			}
+			return false, nil
+		})
+}
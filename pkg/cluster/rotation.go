@@ -0,0 +1,352 @@
+package cluster
+
+import (
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+)
+
+const (
+	rotatePasswordSQL      = `ALTER ROLE "%s" ENCRYPTED PASSWORD '%s';`
+	dropPreviousUserSQL    = `DROP ROLE IF EXISTS "%s";`
+	createPreviousUserSQL  = `CREATE ROLE "%s" LOGIN IN ROLE "%s" ENCRYPTED PASSWORD '%s' VALID UNTIL '%s';`
+	setPreviousUserRoleSQL = `ALTER ROLE "%s" SET role TO "%s";`
+)
+
+// passwordRotationInterval returns how often the password of the manifest user is rotated, or 0 if it is not.
+func (c *Cluster) passwordRotationInterval(username string) time.Duration {
+	days := int32(c.OpConfig.PasswordRotationDays)
+	if userDays, ok := c.Spec.PasswordRotation[username]; ok {
+		days = userDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// passwordRotationDue checks if the password stored in the secret is older than the rotation interval. The secrets
+// without a valid time of the last rotation are not due, the rotation starts from the time recorded for them instead.
+func passwordRotationDue(secret *v1.Secret, interval time.Duration, now time.Time) bool {
+	if interval <= 0 {
+		return false
+	}
+	rotatedAt, ok := passwordRotatedAt(secret)
+	return ok && !now.Before(rotatedAt.Add(interval))
+}
+
+func passwordRotatedAt(secret *v1.Secret) (time.Time, bool) {
+	value, ok := secret.Annotations[constants.PasswordRotatedAnnotation]
+	if !ok {
+		return time.Time{}, false
+	}
+	rotatedAt, err := time.Parse(time.RFC3339, value)
+	return rotatedAt, err == nil
+}
+
+// startPasswordRotation records the current time as the last rotation of the password in the secret, so that the
+// existing passwords are rotated one interval after the rotation has been enabled, instead of all at once.
+func (c *Cluster) startPasswordRotation(secret *v1.Secret, now time.Time) error {
+	if _, ok := passwordRotatedAt(secret); ok {
+		return nil
+	}
+	if secret.Annotations == nil {
+		secret.Annotations = make(map[string]string)
+	}
+	secret.Annotations[constants.PasswordRotatedAnnotation] = now.UTC().Format(time.RFC3339)
+	updated, err := c.KubeClient.Secrets(secret.Namespace).Update(secret)
+	if err != nil {
+		return fmt.Errorf("could not record the start of the password rotation: %v", err)
+	}
+	*secret = *updated
+
+	return nil
+}
+
+// syncPasswordRotation regenerates the passwords of the manifest users that are due for rotation and removes the
+// previous credentials once their grace period is over.
+func (c *Cluster) syncPasswordRotation() error {
+	c.setProcessName("rotating passwords")
+
+	if !c.credentialsInKubernetes() {
+		if len(c.Spec.PasswordRotation) > 0 || c.OpConfig.PasswordRotationDays > 0 {
+			c.logger.Warningf("password rotation requires the %q credentials backend", constants.CredentialsBackendKubernetes)
+		}
+		return nil
+	}
+
+	if err := c.initDbConn(); err != nil {
+		return fmt.Errorf("could not init db connection: %v", err)
+	}
+	defer func() {
+		if err := c.closeDbConn(); err != nil {
+			c.logger.Errorf("could not close db connection: %v", err)
+		}
+	}()
+
+	now := time.Now()
+	for username := range c.Spec.Users {
+		if _, ok := c.pgUsers[username]; !ok {
+			continue
+		}
+		secret, err := c.KubeClient.Secrets(c.Namespace).Get(c.credentialSecretName(username), metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("could not get secret of the user %q: %v", username, err)
+		}
+		if err := c.expirePreviousPassword(secret, now); err != nil {
+			return fmt.Errorf("could not remove the previous password of the user %q: %v", username, err)
+		}
+		interval := c.passwordRotationInterval(username)
+		if interval <= 0 {
+			continue
+		}
+		if err := c.startPasswordRotation(secret, now); err != nil {
+			return fmt.Errorf("could not start the password rotation of the user %q: %v", username, err)
+		}
+		if !passwordRotationDue(secret, interval, now) {
+			continue
+		}
+		if err := c.rotatePassword(username, secret, now); err != nil {
+			return fmt.Errorf("could not rotate the password of the user %q: %v", username, err)
+		}
+	}
+
+	return nil
+}
+
+// rotatePassword changes the password of the user in the database and the secret together: the change is committed
+// only after the secret has been updated, and the secret is restored if the commit fails. With a grace period, the
+// previous password stays valid for a separate login role acting as the user, stored in the secret as well.
+func (c *Cluster) rotatePassword(username string, secret *v1.Secret, now time.Time) error {
+	user := c.pgUsers[username]
+	newPassword := util.RandomPassword(constants.PasswordLength)
+	previousUser := username + constants.PreviousUserSuffix
+	validUntil := now.Add(c.OpConfig.PasswordRotationGrace)
+
+	// the new passwords are hashed with the current password_encryption, converting MD5 hashes to SCRAM
+	encryption := c.passwordEncryption(&c.Spec)
+	encryptedPassword, err := util.EncryptedPassword(spec.PgUser{Name: username, Password: newPassword}, encryption)
+	if err != nil {
+		return fmt.Errorf("could not encrypt password: %v", err)
+	}
+	statements := make([]string, 0)
+	if c.OpConfig.PasswordRotationGrace > 0 {
+		previousPassword, err := util.EncryptedPassword(spec.PgUser{Name: previousUser, Password: user.Password}, encryption)
+		if err != nil {
+			return fmt.Errorf("could not encrypt previous password: %v", err)
+		}
+		statements = append(statements,
+			fmt.Sprintf(dropPreviousUserSQL, previousUser),
+			fmt.Sprintf(createPreviousUserSQL, previousUser, username, previousPassword, validUntil.UTC().Format(time.RFC3339)),
+			fmt.Sprintf(setPreviousUserRoleSQL, previousUser, username))
+	}
+	statements = append(statements,
+		fmt.Sprintf(rotatePasswordSQL, username, encryptedPassword))
+
+	err = c.changePassword(statements, secret, now, func(secret *v1.Secret) {
+		secret.Data["password"] = []byte(newPassword)
+		if c.OpConfig.PasswordRotationGrace > 0 {
+			secret.Annotations[constants.PreviousPasswordValidUntilAnnotation] = validUntil.UTC().Format(time.RFC3339)
+			secret.Data[constants.PreviousUsernameKey] = []byte(previousUser)
+			secret.Data[constants.PreviousPasswordKey] = []byte(user.Password)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	user.Password = newPassword
+	c.pgUsers[username] = user
+	c.logger.Infof("password of the user %q has been rotated", username)
+	for _, backend := range c.externalCredentialsBackends() {
+		if err := c.writeExternalCredentials(backend, user); err != nil {
+			c.logger.Warningf("could not store the rotated password: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// changePassword runs the statements changing the password in a transaction committed only after the secret has been
+// updated, and restores the secret if the commit fails.
+func (c *Cluster) changePassword(statements []string, secret *v1.Secret, now time.Time, update func(*v1.Secret)) error {
+	tx, err := c.pgDb.Begin()
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %v", err)
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("could not change the password: %v", err)
+		}
+	}
+
+	oldData := make(map[string][]byte)
+	for key, value := range secret.Data {
+		oldData[key] = value
+	}
+	oldAnnotations := make(map[string]string)
+	for key, value := range secret.Annotations {
+		oldAnnotations[key] = value
+	}
+	if secret.Annotations == nil {
+		secret.Annotations = make(map[string]string)
+	}
+	secret.Annotations[constants.PasswordRotatedAnnotation] = now.UTC().Format(time.RFC3339)
+	update(secret)
+	updated, err := c.KubeClient.Secrets(secret.Namespace).Update(secret)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("could not update secret: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		updated.Data = oldData
+		updated.Annotations = oldAnnotations
+		if _, err2 := c.KubeClient.Secrets(updated.Namespace).Update(updated); err2 != nil {
+			c.logger.Errorf("could not restore secret %q, it holds a password not set in the database: %v", updated.Name, err2)
+		}
+		return fmt.Errorf("could not commit the password change: %v", err)
+	}
+
+	return nil
+}
+
+// syncSystemPasswordRotation regenerates the passwords of the replication user and the superuser when they are due.
+// The pods read them from their environment at start, so the passwords are changed in the database and the secrets
+// first and the pods are recreated afterwards, replicas first: the replicas keep streaming over their established
+// connections and reconnect with the new password once restarted, and the master is switched over before its own
+// restart. As the pods are restarted, the rotation waits for the maintenance windows.
+func (c *Cluster) syncSystemPasswordRotation() error {
+	interval := time.Duration(c.OpConfig.SystemRotationDays) * 24 * time.Hour
+	if interval <= 0 {
+		return nil
+	}
+	c.setProcessName("rotating passwords of the system users")
+
+	now := time.Now()
+	keys := []string{constants.ReplicationUserKeyName, constants.SuperuserKeyName}
+	secrets := make(map[string]*v1.Secret)
+	for _, key := range keys {
+		username := c.systemUsers[key].Name
+		secret, err := c.KubeClient.Secrets(c.Namespace).Get(c.credentialSecretName(username), metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("could not get secret of the user %q: %v", username, err)
+		}
+		if err := c.startPasswordRotation(secret, now); err != nil {
+			return fmt.Errorf("could not start the password rotation of the user %q: %v", username, err)
+		}
+		if passwordRotationDue(secret, interval, now) {
+			secrets[key] = secret
+		}
+	}
+	if len(secrets) == 0 {
+		return nil
+	}
+	if !c.inMaintenanceWindow() {
+		c.logger.Debugf("rotation of the passwords of the system users deferred until the next maintenance window")
+		return nil
+	}
+
+	if err := c.initDbConn(); err != nil {
+		return fmt.Errorf("could not init db connection: %v", err)
+	}
+	defer func() {
+		if err := c.closeDbConn(); err != nil {
+			c.logger.Errorf("could not close db connection: %v", err)
+		}
+	}()
+
+	var rotateErr error
+	rotated := false
+	for _, key := range keys {
+		secret, ok := secrets[key]
+		if !ok {
+			continue
+		}
+		if rotateErr = c.rotateSystemPassword(key, secret, now); rotateErr != nil {
+			break
+		}
+		rotated = true
+	}
+	if !rotated {
+		return rotateErr
+	}
+
+	// the flag makes the next sync recreate the pods if the operator fails to do it now
+	if err := c.setRollingUpdatePending(true); err != nil {
+		return err
+	}
+	if err := c.recreatePods(); err != nil {
+		return fmt.Errorf("could not recreate pods with the new passwords: %v", err)
+	}
+	if err := c.setRollingUpdatePending(false); err != nil {
+		return err
+	}
+	c.logger.Infof("pods have been recreated with the new passwords of the system users")
+
+	return rotateErr
+}
+
+// rotateSystemPassword changes the password of the system user in the database and its secret. There is no previous
+// password, as the roles can't be replaced by other ones acting as them.
+func (c *Cluster) rotateSystemPassword(key string, secret *v1.Secret, now time.Time) error {
+	user := c.systemUsers[key]
+	newPassword := util.RandomPassword(constants.PasswordLength)
+	encryptedPassword, err := util.EncryptedPassword(spec.PgUser{Name: user.Name, Password: newPassword},
+		c.passwordEncryption(&c.Spec))
+	if err != nil {
+		return fmt.Errorf("could not encrypt password: %v", err)
+	}
+
+	statements := []string{fmt.Sprintf(rotatePasswordSQL, user.Name, encryptedPassword)}
+	err = c.changePassword(statements, secret, now, func(secret *v1.Secret) {
+		secret.Data["password"] = []byte(newPassword)
+	})
+	if err != nil {
+		return fmt.Errorf("could not rotate the password of the user %q: %v", user.Name, err)
+	}
+
+	user.Password = newPassword
+	c.systemUsers[key] = user
+	c.logger.Infof("password of the user %q has been rotated", user.Name)
+	for _, backend := range c.externalCredentialsBackends() {
+		if err := c.writeExternalCredentials(backend, user); err != nil {
+			c.logger.Warningf("could not store the rotated password: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// expirePreviousPassword drops the role of the previous password after its grace period, Postgres rejects it already,
+// and removes it from the secret.
+func (c *Cluster) expirePreviousPassword(secret *v1.Secret, now time.Time) error {
+	value, ok := secret.Annotations[constants.PreviousPasswordValidUntilAnnotation]
+	if !ok {
+		return nil
+	}
+	if validUntil, err := time.Parse(time.RFC3339, value); err == nil && now.Before(validUntil) {
+		return nil
+	}
+
+	if previousUser, ok := secret.Data[constants.PreviousUsernameKey]; ok {
+		if _, err := c.pgDb.Exec(fmt.Sprintf(dropPreviousUserSQL, string(previousUser))); err != nil {
+			return fmt.Errorf("could not drop the role of the previous password: %v", err)
+		}
+	}
+	delete(secret.Annotations, constants.PreviousPasswordValidUntilAnnotation)
+	delete(secret.Data, constants.PreviousUsernameKey)
+	delete(secret.Data, constants.PreviousPasswordKey)
+	updated, err := c.KubeClient.Secrets(secret.Namespace).Update(secret)
+	if err != nil {
+		return fmt.Errorf("could not update secret: %v", err)
+	}
+	*secret = *updated
+	c.logger.Infof("previous password in the secret %q has expired", secret.Name)
+
+	return nil
+}
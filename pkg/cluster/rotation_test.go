@@ -0,0 +1,43 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+)
+
+func TestPasswordRotationDue(t *testing.T) {
+	created := time.Date(2018, time.March, 1, 12, 0, 0, 0, time.UTC)
+	now := time.Date(2018, time.March, 31, 12, 0, 0, 0, time.UTC)
+	secret := func(rotatedAt string) *v1.Secret {
+		s := &v1.Secret{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(created)}}
+		if rotatedAt != "" {
+			s.Annotations = map[string]string{constants.PasswordRotatedAnnotation: rotatedAt}
+		}
+		return s
+	}
+	tests := []struct {
+		secret   *v1.Secret
+		interval time.Duration
+		due      bool
+	}{
+		{secret(""), 0, false},
+		{secret(""), 30 * 24 * time.Hour, false},
+		{secret(""), 31 * 24 * time.Hour, false},
+		{secret("2018-03-20T12:00:00Z"), 30 * 24 * time.Hour, false},
+		{secret("2018-03-20T12:00:00Z"), 12 * 24 * time.Hour, false},
+		{secret("2018-03-20T12:00:00Z"), 11 * 24 * time.Hour, true},
+		{secret("invalid"), 30 * 24 * time.Hour, false},
+		{secret("2018-03-01T12:00:00Z"), 30 * 24 * time.Hour, true},
+	}
+	for _, tt := range tests {
+		if due := passwordRotationDue(tt.secret, tt.interval, now); due != tt.due {
+			t.Errorf("rotation due with the interval %s and the annotations %v expected: %t, got: %t",
+				tt.interval, tt.secret.Annotations, tt.due, due)
+		}
+	}
+}
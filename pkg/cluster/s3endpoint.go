@@ -0,0 +1,76 @@
+package cluster
+
+import (
+	"net/url"
+
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+)
+
+var s3CACertFile = constants.S3CACertMount + "/" + constants.S3CACertKey
+
+// s3Endpoint returns the S3-compatible storage of the cluster, the manifest overriding the operator configuration
+// setting by setting, or nil for AWS S3 in the default region.
+func (c *Cluster) s3Endpoint(pgSpec *spec.PostgresSpec) *spec.S3Endpoint {
+	forcePathStyle := c.OpConfig.S3ForcePathStyle
+	result := spec.S3Endpoint{
+		Endpoint:       c.OpConfig.S3Endpoint,
+		Region:         c.OpConfig.S3Region,
+		ForcePathStyle: &forcePathStyle,
+		CACertSecret:   c.OpConfig.S3CACertSecret,
+	}
+	if endpoint := pgSpec.S3Endpoint; endpoint != nil {
+		if endpoint.Endpoint != "" {
+			result.Endpoint = endpoint.Endpoint
+		}
+		if endpoint.Region != "" {
+			result.Region = endpoint.Region
+		}
+		if endpoint.ForcePathStyle != nil {
+			result.ForcePathStyle = endpoint.ForcePathStyle
+		}
+		if endpoint.CACertSecret != "" {
+			result.CACertSecret = endpoint.CACertSecret
+		}
+	}
+	if result.Endpoint == "" && result.Region == "" {
+		return nil
+	}
+	return &result
+}
+
+// waleS3Endpoint converts the URL of the endpoint into the format of WAL-E, i.e. https+path://minio.example.com:9000
+func waleS3Endpoint(endpoint string, forcePathStyle bool) string {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint
+	}
+	style := "virtualhost"
+	if forcePathStyle {
+		style = "path"
+	}
+	return parsed.Scheme + "+" + style + "://" + parsed.Host
+}
+
+// generateS3EndpointEnvironment makes WAL-E and WAL-G use the S3-compatible storage, the prefix selecting the
+// archive of the cluster or the one it is cloned from or replays as a standby.
+func generateS3EndpointEnvironment(endpoint *spec.S3Endpoint, prefix string) []v1.EnvVar {
+	result := make([]v1.EnvVar, 0)
+	if endpoint.Region != "" {
+		result = append(result, v1.EnvVar{Name: prefix + "AWS_REGION", Value: endpoint.Region})
+	}
+	if endpoint.Endpoint != "" {
+		forcePathStyle := endpoint.ForcePathStyle != nil && *endpoint.ForcePathStyle
+		result = append(result, v1.EnvVar{Name: prefix + "AWS_ENDPOINT", Value: endpoint.Endpoint})
+		result = append(result, v1.EnvVar{Name: prefix + "WALE_S3_ENDPOINT", Value: waleS3Endpoint(endpoint.Endpoint, forcePathStyle)})
+		if forcePathStyle {
+			result = append(result, v1.EnvVar{Name: prefix + "AWS_S3_FORCE_PATH_STYLE", Value: "true"})
+		}
+	}
+	if endpoint.CACertSecret != "" {
+		result = append(result, v1.EnvVar{Name: prefix + "WALG_S3_CA_CERT_FILE", Value: s3CACertFile})
+	}
+	return result
+}
@@ -0,0 +1,149 @@
+package cluster
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util"
+)
+
+const (
+	inactivePhysicalSlotsSQL = `SELECT slot_name FROM pg_replication_slots WHERE slot_type = 'physical' AND NOT active;`
+	dropReplicationSlotsSQL  = `SELECT slot_name, pg_drop_replication_slot(slot_name) FROM pg_replication_slots
+	 WHERE slot_name = ANY($1) AND NOT active;`
+)
+
+var slotNameInvalidChars = regexp.MustCompile("[^a-z0-9_]")
+
+// replicationSlotName returns the name of the physical replication slot Patroni creates for the member.
+func replicationSlotName(podName string) string {
+	return slotNameInvalidChars.ReplaceAllString(strings.ToLower(podName), "_")
+}
+
+// statefulSetReplicas returns the number of pods of the current statefulset, or 0 if there is none.
+func (c *Cluster) statefulSetReplicas() int32 {
+	if c.Statefulset == nil || c.Statefulset.Spec.Replicas == nil {
+		return 0
+	}
+	return *c.Statefulset.Spec.Replicas
+}
+
+// switchoverBeforeScaleDown moves the master to one of the pods kept by scaling the statefulset down to the given
+// number of replicas, as the statefulset removes the pods with the highest numbers regardless of their role.
+func (c *Cluster) switchoverBeforeScaleDown(replicas int32) error {
+	masterPods, err := c.getRolePods(Master)
+	if err != nil {
+		return fmt.Errorf("could not get master pod: %v", err)
+	}
+	if len(masterPods) == 0 {
+		return nil
+	}
+	replicaPods, err := c.getRolePods(Replica)
+	if err != nil {
+		return fmt.Errorf("could not get replica pods: %v", err)
+	}
+	candidates := make([]spec.NamespacedName, 0)
+	for i := range replicaPods {
+		index, err := getPodIndex(replicaPods[i].Name)
+		if err != nil || index >= replicas || !podIsReady(&replicaPods[i]) {
+			continue
+		}
+		candidates = append(candidates, util.NameFromMeta(replicaPods[i].ObjectMeta))
+	}
+	if len(candidates) == 0 {
+		return fmt.Errorf("no running replica among the remaining pods")
+	}
+
+	candidate := masterCandidate(candidates)
+	c.logger.Infof("switching over from %q to %q before scaling down to %d pods", masterPods[0].Name, candidate, replicas)
+	return c.ManualFailover(&masterPods[0], candidate)
+}
+
+// removedMemberSlots returns the slots among the given ones that belong to pods of the statefulset with ordinals
+// of at least the number of its replicas, i.e. pods removed by scaling it down.
+func removedMemberSlots(slots []string, statefulSetName string, replicas int32) []string {
+	prefix := replicationSlotName(statefulSetName) + "_"
+	removed := make([]string, 0)
+	for _, slot := range slots {
+		if !strings.HasPrefix(slot, prefix) {
+			continue
+		}
+		ordinal := strings.TrimPrefix(slot, prefix)
+		index, err := strconv.Atoi(ordinal)
+		if err != nil || strconv.Itoa(index) != ordinal || int32(index) < replicas {
+			continue
+		}
+		removed = append(removed, slot)
+	}
+	return removed
+}
+
+// dropRemovedMemberSlots drops the replication slots of the pods removed by scaling the statefulset down, so that
+// the master doesn't keep the WAL for them until Patroni notices they are gone. Slots still in use by a terminating
+// pod are dropped by one of the next syncs.
+func (c *Cluster) dropRemovedMemberSlots() error {
+	replicas := c.statefulSetReplicas()
+	if replicas <= 0 {
+		return nil
+	}
+
+	if err := c.initDbConn(); err != nil {
+		return fmt.Errorf("could not init db connection: %v", err)
+	}
+	defer func() {
+		if err := c.closeDbConn(); err != nil {
+			c.logger.Errorf("could not close db connection: %v", err)
+		}
+	}()
+
+	slots, err := c.inactivePhysicalSlots()
+	if err != nil {
+		return err
+	}
+	removed := removedMemberSlots(slots, c.statefulSetName(), replicas)
+	if len(removed) == 0 {
+		return nil
+	}
+
+	rows, err := c.pgDb.Query(dropReplicationSlotsSQL, pq.Array(removed))
+	if err != nil {
+		return fmt.Errorf("could not drop replication slots: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			slotName string
+			dropped  interface{}
+		)
+		if err := rows.Scan(&slotName, &dropped); err != nil {
+			return fmt.Errorf("error when processing replication slots: %v", err)
+		}
+		c.logger.Infof("dropped replication slot %q of the removed pod", slotName)
+	}
+
+	return rows.Err()
+}
+
+func (c *Cluster) inactivePhysicalSlots() ([]string, error) {
+	rows, err := c.pgDb.Query(inactivePhysicalSlotsSQL)
+	if err != nil {
+		return nil, fmt.Errorf("could not query replication slots: %v", err)
+	}
+	defer rows.Close()
+
+	slots := make([]string, 0)
+	for rows.Next() {
+		var slot string
+		if err := rows.Scan(&slot); err != nil {
+			return nil, fmt.Errorf("error when processing replication slots: %v", err)
+		}
+		slots = append(slots, slot)
+	}
+
+	return slots, rows.Err()
+}
@@ -0,0 +1,60 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+)
+
+func TestReplicationSlotName(t *testing.T) {
+	tests := []struct {
+		podName string
+		slot    string
+	}{
+		{"acid-minimal-cluster-1", "acid_minimal_cluster_1"},
+		{"Acid.Test-0", "acid_test_0"},
+	}
+	for _, tt := range tests {
+		if slot := replicationSlotName(tt.podName); slot != tt.slot {
+			t.Errorf("replicationSlotName(%q) expected: %q, got: %q", tt.podName, tt.slot, slot)
+		}
+	}
+}
+
+func TestRemovedMemberSlots(t *testing.T) {
+	slots := []string{"acid_test_0", "acid_test_1", "acid_test_2", "acid_test_03", "acid_test_4", "acid_test_x",
+		"acid_test_2_5", "logical_slot"}
+	tests := []struct {
+		replicas int32
+		removed  []string
+	}{
+		{5, []string{}},
+		{2, []string{"acid_test_2", "acid_test_4"}},
+		{1, []string{"acid_test_1", "acid_test_2", "acid_test_4"}},
+	}
+	for _, tt := range tests {
+		if removed := removedMemberSlots(slots, "acid-test", tt.replicas); !reflect.DeepEqual(removed, tt.removed) {
+			t.Errorf("removedMemberSlots(%v, %d) expected: %v, got: %v", slots, tt.replicas, tt.removed, removed)
+		}
+	}
+}
+
+func TestAutoscaledInstances(t *testing.T) {
+	autoscaling := &spec.Autoscaling{MinInstances: 2, MaxInstances: 5, TargetConnections: 100}
+	tests := []struct {
+		connections int
+		instances   int32
+	}{
+		{0, 2},
+		{250, 3},
+		{300, 3},
+		{301, 4},
+		{10000, 5},
+	}
+	for _, tt := range tests {
+		if instances := autoscaledInstances(autoscaling, tt.connections); instances != tt.instances {
+			t.Errorf("autoscaledInstances(%+v, %d) expected: %d, got: %d", autoscaling, tt.connections, tt.instances, instances)
+		}
+	}
+}
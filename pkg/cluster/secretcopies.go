@@ -0,0 +1,132 @@
+package cluster
+
+import (
+	"fmt"
+	"reflect"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/util"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+// secretNamespaceAllowed checks if the operator configuration allows copying the secrets into the namespace.
+func (c *Cluster) secretNamespaceAllowed(namespace string) bool {
+	for _, allowed := range c.OpConfig.AllowedSecretNamespaces {
+		if allowed == "*" || allowed == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// syncSecretCopies creates and updates the copies of the credential secrets in the namespaces of the manifest. The
+// copies follow the secrets of the cluster, so that the rotated passwords reach them on the next sync.
+func (c *Cluster) syncSecretCopies() error {
+	c.setProcessName("syncing copies of the secrets")
+
+	if len(c.Spec.SecretNamespaces) > 0 && !c.credentialsInKubernetes() {
+		c.logger.Warningf("not copying the secrets, as the credentials are not stored in kubernetes secrets")
+		return nil
+	}
+
+	for username, namespaces := range c.Spec.SecretNamespaces {
+		if _, ok := c.pgUsers[username]; !ok {
+			c.logger.Warningf("not copying the secret of %q, which is not a user of the cluster", username)
+			continue
+		}
+		secret, err := c.KubeClient.Secrets(c.Namespace).Get(c.credentialSecretName(username), metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("could not get secret of the user %q: %v", username, err)
+		}
+		for _, namespace := range namespaces {
+			if namespace == c.Namespace {
+				continue
+			}
+			if !c.secretNamespaceAllowed(namespace) {
+				c.logger.Warningf("not copying the secret of %q into the namespace %q, which is not allowed", username, namespace)
+				continue
+			}
+			if err := c.syncSecretCopy(secret, namespace); err != nil {
+				return fmt.Errorf("could not sync the copy of the secret of %q in the namespace %q: %v", username, namespace, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// syncSecretCopy creates the copy of the secret in the namespace or updates its data. A secret with the same name
+// that is not a copy of this one is never overwritten.
+func (c *Cluster) syncSecretCopy(secret *v1.Secret, namespace string) error {
+	source := util.NameFromMeta(secret.ObjectMeta).String()
+	data := make(map[string][]byte, len(secret.Data))
+	for key, value := range secret.Data {
+		data[key] = value
+	}
+
+	current, err := c.KubeClient.Secrets(namespace).Get(secret.Name, metav1.GetOptions{})
+	if k8sutil.ResourceNotFound(err) {
+		secretCopy := &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        secret.Name,
+				Namespace:   namespace,
+				Labels:      c.labelsSet(),
+				Annotations: map[string]string{constants.SecretCopySourceAnnotation: source},
+			},
+			Type: secret.Type,
+			Data: data,
+		}
+		if _, err := c.KubeClient.Secrets(namespace).Create(secretCopy); err != nil {
+			return fmt.Errorf("could not create secret: %v", err)
+		}
+		c.logger.Infof("secret %q has been copied into the namespace %q", source, namespace)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("could not get secret: %v", err)
+	}
+
+	if current.Annotations[constants.SecretCopySourceAnnotation] != source {
+		return fmt.Errorf("secret %q already exists and is not a copy of %q", util.NameFromMeta(current.ObjectMeta), source)
+	}
+	if reflect.DeepEqual(current.Data, data) {
+		return nil
+	}
+	current.Data = data
+	if _, err := c.KubeClient.Secrets(namespace).Update(current); err != nil {
+		return fmt.Errorf("could not update secret: %v", err)
+	}
+	c.logger.Infof("copy of the secret %q in the namespace %q has been updated", source, namespace)
+
+	return nil
+}
+
+// deleteSecretCopies deletes the copies of the secrets in the namespaces the new mapping doesn't have anymore.
+func (c *Cluster) deleteSecretCopies(oldNamespaces, newNamespaces map[string][]string) error {
+	for username, namespaces := range oldNamespaces {
+		for _, namespace := range namespaces {
+			if namespace == c.Namespace || util.SliceContains(newNamespaces[username], namespace) {
+				continue
+			}
+			name := c.credentialSecretName(username)
+			current, err := c.KubeClient.Secrets(namespace).Get(name, metav1.GetOptions{})
+			if k8sutil.ResourceNotFound(err) {
+				continue
+			} else if err != nil {
+				return fmt.Errorf("could not get the copy of the secret of %q in the namespace %q: %v", username, namespace, err)
+			}
+			source := fmt.Sprintf("%s/%s", c.Namespace, name)
+			if current.Annotations[constants.SecretCopySourceAnnotation] != source {
+				continue
+			}
+			if err := c.KubeClient.Secrets(namespace).Delete(name, c.deleteOptions); err != nil {
+				return fmt.Errorf("could not delete the copy of the secret of %q in the namespace %q: %v", username, namespace, err)
+			}
+			c.logger.Infof("copy of the secret %q in the namespace %q has been deleted", source, namespace)
+		}
+	}
+
+	return nil
+}
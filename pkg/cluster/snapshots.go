@@ -0,0 +1,241 @@
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+// syncSnapshotBackups takes a new snapshot-based backup of the master volumes once the interval
+// from the manifest has passed since the latest one, and removes the backups exceeding the retention.
+func (c *Cluster) syncSnapshotBackups() error {
+	if c.Spec.SnapshotBackup == nil {
+		return nil
+	}
+	c.setProcessName("syncing snapshot backups")
+
+	interval, err := time.ParseDuration(c.Spec.SnapshotBackup.Interval)
+	if err != nil {
+		return fmt.Errorf("could not parse snapshot backup interval: %v", err)
+	}
+	backups, err := c.listSnapshotBackups()
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 || time.Since(backups[len(backups)-1].CreationTime) >= interval {
+		if err := c.createSnapshotBackup(); err != nil {
+			return fmt.Errorf("could not create snapshot backup: %v", err)
+		}
+		if backups, err = c.listSnapshotBackups(); err != nil {
+			return err
+		}
+	}
+	if retain := c.Spec.SnapshotBackup.Retain; retain > 0 && len(backups) > retain {
+		for _, backup := range backups[:len(backups)-retain] {
+			if err := c.deleteSnapshotBackup(backup); err != nil {
+				return err
+			}
+		}
+		backups = backups[len(backups)-retain:]
+	}
+	c.setSnapshotBackups(backups)
+
+	return nil
+}
+
+// listSnapshotBackups groups the volume snapshots of the cluster into backups, ordered from the oldest to the newest one.
+func (c *Cluster) listSnapshotBackups() ([]spec.VolumeSnapshotBackup, error) {
+	snapshots, err := k8sutil.ListVolumeSnapshots(c.KubeClient.VolumeSnapshotREST, c.Namespace,
+		metav1.ListOptions{LabelSelector: c.labelsSet().String()})
+	if err != nil {
+		return nil, fmt.Errorf("could not list volume snapshots: %v", err)
+	}
+
+	backups := make(map[string]*spec.VolumeSnapshotBackup)
+	for _, snapshot := range snapshots {
+		name, ok := snapshot.Labels[constants.SnapshotBackupLabel]
+		if !ok {
+			continue
+		}
+		backup, ok := backups[name]
+		if !ok {
+			backup = &spec.VolumeSnapshotBackup{Name: name, CreationTime: snapshot.CreationTimestamp.Time, ReadyToUse: true}
+			backups[name] = backup
+		}
+		if snapshot.CreationTimestamp.Time.Before(backup.CreationTime) {
+			backup.CreationTime = snapshot.CreationTimestamp.Time
+		}
+		backup.ReadyToUse = backup.ReadyToUse && snapshot.IsReady()
+		backup.Snapshots = append(backup.Snapshots, snapshot.Name)
+	}
+
+	result := make([]spec.VolumeSnapshotBackup, 0, len(backups))
+	for _, backup := range backups {
+		sort.Strings(backup.Snapshots)
+		result = append(result, *backup)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreationTime.Before(result[j].CreationTime) })
+
+	return result, nil
+}
+
+// createSnapshotBackup issues a checkpoint on the master and takes snapshots of all its volumes.
+// The write-ahead log volume goes last, so that it contains every change made after the snapshots of the data.
+func (c *Cluster) createSnapshotBackup() error {
+	masterPods, err := c.getRolePods(Master)
+	if err != nil {
+		return fmt.Errorf("could not get master pod: %v", err)
+	}
+	if len(masterPods) == 0 {
+		return fmt.Errorf("no master pod is running")
+	}
+	masterPod := masterPods[0]
+
+	if err := c.checkpoint(); err != nil {
+		return err
+	}
+
+	backupName := fmt.Sprintf("%s-%s", c.Name, time.Now().UTC().Format(constants.SnapshotBackupNameTimeFormat))
+	volumes := persistentClusterVolumes(&c.Spec)
+	sort.SliceStable(volumes, func(i, j int) bool {
+		return volumes[i].name != constants.WALVolumeName && volumes[j].name == constants.WALVolumeName
+	})
+	for _, volume := range volumes {
+		claimName := fmt.Sprintf("%s-%s", volume.name, masterPod.Name)
+		snapshot := &k8sutil.VolumeSnapshot{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s-%s", backupName, volume.name),
+				Namespace: c.Namespace,
+				Labels:    c.labelsSet(),
+			},
+			Spec: k8sutil.VolumeSnapshotSpec{
+				Source: k8sutil.VolumeSnapshotSource{PersistentVolumeClaimName: &claimName},
+			},
+		}
+		snapshot.Labels[constants.SnapshotBackupLabel] = backupName
+		snapshot.Labels[constants.SnapshotBackupVolumeLabel] = volume.name
+		if class := c.Spec.SnapshotBackup.VolumeSnapshotClass; class != "" {
+			snapshot.Spec.VolumeSnapshotClassName = &class
+		}
+		if err := k8sutil.CreateVolumeSnapshot(c.KubeClient.VolumeSnapshotREST, snapshot); err != nil {
+			return fmt.Errorf("could not create snapshot of the persistent volume claim %q: %v", claimName, err)
+		}
+	}
+	c.logger.Infof("created snapshot backup %q of the pod %q", backupName, masterPod.Name)
+
+	return nil
+}
+
+// checkpoint flushes the dirty buffers on the master, reducing the amount of WAL to replay when starting from a snapshot.
+func (c *Cluster) checkpoint() error {
+	if err := c.initDbConn(); err != nil {
+		return fmt.Errorf("could not init database connection: %v", err)
+	}
+	defer func() {
+		if err := c.closeDbConn(); err != nil {
+			c.logger.Errorf("could not close database connection: %v", err)
+		}
+	}()
+
+	if _, err := c.pgDb.Exec(checkpointSQL); err != nil {
+		return fmt.Errorf("could not execute checkpoint: %v", err)
+	}
+
+	return nil
+}
+
+func (c *Cluster) deleteSnapshotBackup(backup spec.VolumeSnapshotBackup) error {
+	for _, name := range backup.Snapshots {
+		if err := k8sutil.DeleteVolumeSnapshot(c.KubeClient.VolumeSnapshotREST, c.Namespace, name); err != nil && !k8sutil.ResourceNotFound(err) {
+			return fmt.Errorf("could not delete volume snapshot %q: %v", name, err)
+		}
+	}
+	c.logger.Infof("deleted snapshot backup %q", backup.Name)
+
+	return nil
+}
+
+// createVolumesFromSnapshotBackup creates the claims of the first pod from the snapshots of the backup to clone,
+// so that the statefulset picks them up instead of provisioning empty volumes. The remaining pods are
+// bootstrapped by Patroni as replicas of the first one.
+func (c *Cluster) createVolumesFromSnapshotBackup() error {
+	c.setProcessName("creating volumes from the snapshot backup %q", c.Spec.Clone.Snapshot)
+
+	for _, volume := range persistentClusterVolumes(&c.Spec) {
+		snapshotName := fmt.Sprintf("%s-%s", c.Spec.Clone.Snapshot, volume.name)
+		snapshot, err := k8sutil.GetVolumeSnapshot(c.KubeClient.VolumeSnapshotREST, c.Namespace, snapshotName)
+		if k8sutil.ResourceNotFound(err) && volume.name != constants.DataVolumeName {
+			c.logger.Warningf("snapshot backup %q has no snapshot of the %s volume, creating an empty one",
+				c.Spec.Clone.Snapshot, volume.name)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("could not get volume snapshot %q: %v", snapshotName, err)
+		}
+		if !snapshot.IsReady() {
+			return fmt.Errorf("volume snapshot %q is not ready to use", snapshotName)
+		}
+
+		pvc, err := generatePersistentVolumeClaimTemplate(volume.name, volume.volume)
+		if err != nil {
+			return fmt.Errorf("could not generate persistent volume claim for the %s volume: %v", volume.name, err)
+		}
+		pvc.Name = fmt.Sprintf("%s-%s-0", volume.name, c.statefulSetName())
+		pvc.Namespace = c.Namespace
+		pvc.Labels = make(map[string]string)
+		for key, value := range volume.volume.Labels {
+			pvc.Labels[key] = value
+		}
+		for key, value := range c.labelsSet() {
+			pvc.Labels[key] = value
+		}
+		err = k8sutil.CreatePersistentVolumeClaimFromSnapshot(c.KubeClient.RESTClient, pvc, snapshotName)
+		if k8sutil.ResourceAlreadyExists(err) {
+			c.logger.Warningf("persistent volume claim %q already exists, not restoring it from the snapshot", pvc.Name)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("could not create persistent volume claim %q: %v", pvc.Name, err)
+		}
+		c.logger.Infof("created persistent volume claim %q from the volume snapshot %q", pvc.Name, snapshotName)
+	}
+
+	return nil
+}
+
+// initSystemUsersFromClone takes the passwords of the system users from the cluster the snapshot backup belongs to,
+// as the data restored from the snapshot contains the roles of that cluster.
+func (c *Cluster) initSystemUsersFromClone() {
+	for key, user := range c.systemUsers {
+		secretName := c.credentialSecretNameForCluster(user.Name, c.Spec.Clone.ClusterName)
+		secret, err := c.KubeClient.Secrets(c.Namespace).Get(secretName, metav1.GetOptions{})
+		if err != nil {
+			c.logger.Warningf("could not get password of the user %q of the cluster to clone: %v", user.Name, err)
+			continue
+		}
+		user.Password = string(secret.Data["password"])
+		c.systemUsers[key] = user
+	}
+}
+
+func (c *Cluster) setSnapshotBackups(backups []spec.VolumeSnapshotBackup) {
+	c.volumeSnapshotsMu.Lock()
+	defer c.volumeSnapshotsMu.Unlock()
+	c.snapshotBackups = backups
+}
+
+// GetSnapshotBackups returns the snapshot-based backups of the cluster found during the last sync
+func (c *Cluster) GetSnapshotBackups() []spec.VolumeSnapshotBackup {
+	c.volumeSnapshotsMu.RLock()
+	defer c.volumeSnapshotsMu.RUnlock()
+
+	result := make([]spec.VolumeSnapshotBackup, len(c.snapshotBackups))
+	copy(result, c.snapshotBackups)
+	return result
+}
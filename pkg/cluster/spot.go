@@ -0,0 +1,75 @@
+package cluster
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util"
+)
+
+// podIsOnSpotNode checks if the pod runs on a spot or preemptible node, as marked by the spot_node_label.
+func (c *Cluster) podIsOnSpotNode(pod *v1.Pod) (bool, error) {
+	if len(c.OpConfig.SpotNodeLabel) == 0 {
+		return false, nil
+	}
+	node, err := c.KubeClient.Nodes().Get(pod.Spec.NodeName, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	return util.MapContains(node.Labels, c.OpConfig.SpotNodeLabel), nil
+}
+
+// syncMasterPlacement switches the master running on a spot node over to a replica on an on-demand node, so that a
+// spot interruption only takes replicas down. The switchover waits for the maintenance window.
+func (c *Cluster) syncMasterPlacement() error {
+	if len(c.OpConfig.SpotNodeLabel) == 0 {
+		return nil
+	}
+	masterPods, err := c.getRolePods(Master)
+	if err != nil {
+		return fmt.Errorf("could not get master pod: %v", err)
+	}
+	if len(masterPods) == 0 {
+		return nil
+	}
+	if spot, err := c.podIsOnSpotNode(&masterPods[0]); err != nil {
+		return fmt.Errorf("could not get node %q: %v", masterPods[0].Spec.NodeName, err)
+	} else if !spot {
+		return nil
+	}
+
+	replicaPods, err := c.getRolePods(Replica)
+	if err != nil {
+		return fmt.Errorf("could not get replica pods: %v", err)
+	}
+	candidates := make([]spec.NamespacedName, 0)
+	for i := range replicaPods {
+		if !podIsReady(&replicaPods[i]) {
+			continue
+		}
+		spot, err := c.podIsOnSpotNode(&replicaPods[i])
+		if err != nil || spot {
+			continue
+		}
+		if eol, err := c.podIsEndOfLife(&replicaPods[i]); err != nil || eol {
+			continue
+		}
+		candidates = append(candidates, util.NameFromMeta(replicaPods[i].ObjectMeta))
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	if !c.inMaintenanceWindow() {
+		c.logger.Infof("master pod %q runs on the spot node %q, switchover deferred until the maintenance window",
+			masterPods[0].Name, masterPods[0].Spec.NodeName)
+		return nil
+	}
+
+	candidate := masterCandidate(candidates)
+	c.logger.Infof("switching over from %q on the spot node %q to %q on an on-demand node",
+		masterPods[0].Name, masterPods[0].Spec.NodeName, candidate)
+	return c.ManualFailover(&masterPods[0], candidate)
+}
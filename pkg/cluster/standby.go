@@ -0,0 +1,152 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+// isStandbyCluster checks if the cluster replays the WAL of another cluster. Roles and databases of a standby
+// come from its source, so the operator doesn't manage them until the standby is promoted.
+func (c *Cluster) isStandbyCluster() bool {
+	return c.Spec.StandbyCluster != nil
+}
+
+// checkStandbyChange keeps the standby section of the running cluster unless it is removed: the standby source is
+// only read by Spilo when bootstrapping, and a primary can't be turned into a standby. It returns true when the
+// standby has to be promoted.
+func (c *Cluster) checkStandbyChange(oldSpec, newSpec *spec.PostgresSpec) (promote bool) {
+	if oldSpec.StandbyCluster != nil && newSpec.StandbyCluster == nil {
+		return true
+	}
+	if !reflect.DeepEqual(oldSpec.StandbyCluster, newSpec.StandbyCluster) {
+		c.logger.Warningf("standby cluster change (%+v -> %+v) has no effect; remove the standby section to promote the cluster",
+			oldSpec.StandbyCluster, newSpec.StandbyCluster)
+		newSpec.StandbyCluster = oldSpec.StandbyCluster
+	}
+	return false
+}
+
+// promoteStandbyCluster removes the standby configuration from the DCS, making the standby leader of the cluster
+// promote itself.
+func (c *Cluster) promoteStandbyCluster() error {
+	c.setProcessName("promoting the standby cluster")
+
+	pods, err := c.listPods()
+	if err != nil {
+		return err
+	}
+	for i := range pods {
+		if !podIsReady(&pods[i]) {
+			continue
+		}
+		if err := c.patroni.SetConfig(&pods[i], map[string]interface{}{"standby_cluster": nil}); err != nil {
+			return fmt.Errorf("could not remove the standby configuration via the pod %q: %v", pods[i].Name, err)
+		}
+		c.logger.Infof("standby cluster is being promoted")
+		return nil
+	}
+
+	return fmt.Errorf("no running pods to promote the standby cluster with")
+}
+
+// promotionPending checks if the standby section has been removed while the leader of the cluster still replays the
+// WAL of its source, so that roles and databases can't be written yet.
+func (c *Cluster) promotionPending() bool {
+	return c.Promotion != nil && c.Promotion.Phase == spec.BackupRequestRunning
+}
+
+// startPromotion records the promotion of the standby cluster in the status of the postgresql object and asks
+// Patroni to promote it.
+func (c *Cluster) startPromotion(standby *spec.StandbyDescription) error {
+	status := &spec.PromotionStatus{
+		Phase:     spec.BackupRequestRunning,
+		Standby:   standby,
+		StartTime: &metav1.Time{Time: time.Now()},
+	}
+	c.Promotion = status
+	c.recordEvent(v1.EventTypeNormal, constants.EventReasonStandbyPromotionStarted, "promoting the standby cluster")
+
+	return c.promote(status)
+}
+
+func (c *Cluster) promote(status *spec.PromotionStatus) error {
+	err := c.promoteStandbyCluster()
+	if err != nil {
+		status.Error = err.Error()
+		c.recordEvent(v1.EventTypeWarning, constants.EventReasonStandbyPromotionFailed,
+			"could not promote the standby cluster: %v", err)
+	} else {
+		status.Error = ""
+	}
+	c.patchPromotionStatus(status)
+
+	return err
+}
+
+// syncPromotion finishes the promotion once the leader of the cluster runs as a master, and asks Patroni to promote
+// it again otherwise, i.e. when the operator has been restarted in the middle of the promotion.
+func (c *Cluster) syncPromotion() error {
+	if !c.promotionPending() {
+		return nil
+	}
+	promoted, err := c.standbyPromoted()
+	if err != nil {
+		return fmt.Errorf("could not check the promotion of the standby cluster: %v", err)
+	}
+	if !promoted {
+		return c.promote(c.Promotion)
+	}
+
+	status := c.Promotion
+	status.Phase = spec.BackupRequestSucceeded
+	status.CompletionTime = &metav1.Time{Time: time.Now()}
+	status.Error = ""
+	c.logger.Infof("standby cluster has been promoted")
+	c.recordEvent(v1.EventTypeNormal, constants.EventReasonStandbyPromoted, "standby cluster has been promoted")
+	c.patchPromotionStatus(status)
+
+	return nil
+}
+
+// standbyPromoted checks that the pod behind the master service is a master for Patroni, not a standby leader.
+func (c *Cluster) standbyPromoted() (bool, error) {
+	masterPods, err := c.getRolePods(Master)
+	if err != nil {
+		return false, err
+	}
+	if len(masterPods) != 1 {
+		return false, nil
+	}
+	member, err := c.patroni.GetMemberData(&masterPods[0])
+	if err != nil {
+		return false, err
+	}
+	return member.Role == string(Master), nil
+}
+
+func (c *Cluster) patchPromotionStatus(status *spec.PromotionStatus) {
+	patch, err := json.Marshal(map[string]interface{}{"promotion": status})
+	if err != nil {
+		c.logger.Warningf("could not marshal the status of the promotion: %v", err)
+		return
+	}
+	_, err = c.KubeClient.CRDREST.Patch(types.MergePatchType).
+		Namespace(c.Namespace).
+		Resource(constants.CRDResource).
+		Name(c.Name).
+		Body(patch).
+		DoRaw()
+	if err != nil && !k8sutil.ResourceNotFound(err) {
+		c.logger.Warningf("could not set the status of the promotion: %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package cluster
+
+import (
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+)
+
+const (
+	getHumanRolesSQL = `SELECT r.rolname, r.rolsuper, ARRAY(SELECT g.rolname FROM pg_auth_members m
+	  JOIN pg_roles g ON g.oid = m.roleid WHERE m.member = r.oid)
+	  FROM pg_roles r
+	 WHERE EXISTS (SELECT 1 FROM pg_auth_members m JOIN pg_roles p ON p.oid = m.roleid
+	                WHERE m.member = r.oid AND p.rolname = $1);`
+	revokeSuperuserSQL = `ALTER ROLE "%s" NOSUPERUSER;`
+)
+
+// humanRole is a role of the database with the membership of the pam role, i.e. of a team member.
+type humanRole struct {
+	name      string
+	superuser bool
+	memberOf  []string
+}
+
+// formerSuperuserPrivileges returns the human roles to revoke the superuser flag from and the roles of the superuser
+// teams to revoke from them, as far as the users of the cluster don't have them anymore, i.e. when a member left one
+// of the superuser teams.
+func (c *Cluster) formerSuperuserPrivileges(roles []humanRole) ([]string, []spec.PgSyncUserRequest) {
+	nosuperuser := make([]string, 0)
+	revoke := make([]spec.PgSyncUserRequest, 0)
+	for _, role := range roles {
+		if util.SliceContains(c.OpConfig.ProtectedRoles, role.name) {
+			continue
+		}
+		user, ok := c.pgUsers[role.name]
+		if role.superuser && !(ok && util.SliceContains(user.Flags, constants.RoleFlagSuperuser)) {
+			nosuperuser = append(nosuperuser, role.name)
+		}
+		memberOf := make([]string, 0)
+		for _, teamRole := range c.OpConfig.SuperuserTeamsMemberOf {
+			if util.SliceContains(role.memberOf, teamRole) && !(ok && util.SliceContains(user.MemberOf, teamRole)) {
+				memberOf = append(memberOf, teamRole)
+			}
+		}
+		if len(memberOf) > 0 {
+			revoke = append(revoke, spec.PgSyncUserRequest{Kind: spec.PGSyncUserRevoke,
+				User: spec.PgUser{Name: role.name, MemberOf: memberOf}})
+		}
+	}
+
+	return nosuperuser, revoke
+}
+
+// revokeFormerSuperuserPrivileges takes the superuser flag and the roles of the superuser teams from the human roles
+// the users of the cluster don't grant them anymore. Without the teams API, the team members are unknown and keep
+// their roles. The caller holds the database connection.
+func (c *Cluster) revokeFormerSuperuserPrivileges() error {
+	if !c.OpConfig.EnableTeamsAPI || c.teamsAPIClient == nil || c.OpConfig.PamRoleName == "" {
+		return nil
+	}
+	roles, err := c.readHumanRoles()
+	if err != nil {
+		return err
+	}
+
+	nosuperuser, revoke := c.formerSuperuserPrivileges(roles)
+	for _, name := range nosuperuser {
+		if _, err := c.pgDb.Exec(fmt.Sprintf(revokeSuperuserSQL, name)); err != nil {
+			return fmt.Errorf("could not revoke the superuser flag of %q: %v", name, err)
+		}
+		c.logger.Infof("revoked the superuser flag of %q", name)
+	}
+	if err := c.userSyncStrategy.ExecuteSyncRequests(revoke, c.pgDb); err != nil {
+		return err
+	}
+	for _, r := range revoke {
+		c.logger.Infof("revoked the roles %v of the superuser teams from %q", r.User.MemberOf, r.User.Name)
+	}
+
+	return nil
+}
+
+func (c *Cluster) readHumanRoles() ([]humanRole, error) {
+	rows, err := c.pgDb.Query(getHumanRolesSQL, c.OpConfig.PamRoleName)
+	if err != nil {
+		return nil, fmt.Errorf("could not query the roles of the team members: %v", err)
+	}
+	defer rows.Close()
+
+	roles := make([]humanRole, 0)
+	for rows.Next() {
+		var role humanRole
+		if err := rows.Scan(&role.name, &role.superuser, pq.Array(&role.memberOf)); err != nil {
+			return nil, fmt.Errorf("error when processing role rows: %v", err)
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
@@ -0,0 +1,160 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/retryutil"
+)
+
+// syncSwitchoverRequest moves the master role to the pod of the switchover-candidate annotation, or to any ready
+// replica, when the switchover-requested-at annotation has changed since the last switchover.
+func (c *Cluster) syncSwitchoverRequest() error {
+	requestedAt := c.Annotations[constants.SwitchoverRequestAnnotation]
+	if requestedAt == "" || c.SwitchoverRequest != nil && c.SwitchoverRequest.RequestedAt == requestedAt {
+		return nil
+	}
+	c.setProcessName("switching over as requested at %s", requestedAt)
+
+	status := &spec.SwitchoverStatus{
+		RequestedAt: requestedAt,
+		Phase:       spec.BackupRequestRunning,
+		Candidate:   c.Annotations[constants.SwitchoverCandidateAnnotation],
+		StartTime:   &metav1.Time{Time: time.Now()},
+	}
+	c.SwitchoverRequest = status
+	c.patchSwitchoverStatus(status)
+
+	return c.finishSwitchover(status, c.switchover(status))
+}
+
+func (c *Cluster) switchover(status *spec.SwitchoverStatus) error {
+	pods, err := c.listPods()
+	if err != nil {
+		return err
+	}
+	var master *v1.Pod
+	for i := range pods {
+		if PostgresRole(pods[i].Labels[c.OpConfig.PodRoleLabel]) == Master {
+			master = &pods[i]
+		}
+	}
+	if master != nil {
+		status.From = master.Name
+	}
+
+	candidate, err := switchoverCandidate(pods, status.From, status.Candidate)
+	if err != nil {
+		return err
+	}
+	status.To = candidate.Name
+	c.patchSwitchoverStatus(status)
+
+	if master != nil {
+		c.logger.Infof("switching over from %q to %q as requested at %s", master.Name, candidate.Name,
+			status.RequestedAt)
+		return c.ManualFailover(master, util.NameFromMeta(candidate.ObjectMeta))
+	}
+	c.logger.Infof("failing over to %q without a master as requested at %s", candidate.Name, status.RequestedAt)
+	return c.failoverWithoutMaster(candidate)
+}
+
+// switchoverCandidate returns the requested pod, which must be a ready replica, or any ready replica. Without a
+// master the candidate has to be requested, as the replicas might lag behind the lost master.
+func switchoverCandidate(pods []v1.Pod, master, requested string) (*v1.Pod, error) {
+	if master == "" && requested == "" {
+		return nil, fmt.Errorf("no master pod, the candidate to fail over to must be requested")
+	}
+	if requested != "" {
+		if requested == master {
+			return nil, fmt.Errorf("pod %q is already the master", requested)
+		}
+		for i := range pods {
+			if pods[i].Name != requested {
+				continue
+			}
+			if !podIsReady(&pods[i]) {
+				return nil, fmt.Errorf("pod %q is not ready", requested)
+			}
+			return &pods[i], nil
+		}
+		return nil, fmt.Errorf("pod %q is not a member of the cluster", requested)
+	}
+
+	replicas := make([]spec.NamespacedName, 0)
+	for i := range pods {
+		if pods[i].Name != master && podIsReady(&pods[i]) {
+			replicas = append(replicas, util.NameFromMeta(pods[i].ObjectMeta))
+		}
+	}
+	if len(replicas) == 0 {
+		return nil, fmt.Errorf("no ready replica to switch over to")
+	}
+	candidate := masterCandidate(replicas)
+	for i := range pods {
+		if pods[i].Name == candidate.Name {
+			return &pods[i], nil
+		}
+	}
+	return nil, fmt.Errorf("could not find the pod %q", candidate.Name)
+}
+
+// failoverWithoutMaster asks Patroni to promote the candidate when no pod holds the master role, and waits until
+// the candidate is labeled as the master.
+func (c *Cluster) failoverWithoutMaster(candidate *v1.Pod) error {
+	if err := c.patroni.FailoverWithoutLeader(candidate); err != nil {
+		return fmt.Errorf("could not failover: %v", err)
+	}
+	return retryutil.Retry(c.OpConfig.ResourceCheckInterval, c.OpConfig.PodLabelWaitTimeout,
+		func() (bool, error) {
+			masterPods, err := c.getRolePods(Master)
+			if err != nil {
+				return false, err
+			}
+			return len(masterPods) == 1 && masterPods[0].Name == candidate.Name, nil
+		})
+}
+
+func (c *Cluster) finishSwitchover(status *spec.SwitchoverStatus, err error) error {
+	status.CompletionTime = &metav1.Time{Time: time.Now()}
+	if err != nil {
+		status.Phase = spec.BackupRequestFailed
+		status.Error = err.Error()
+		c.recordEvent(v1.EventTypeWarning, constants.EventReasonSwitchoverFailed,
+			"switchover requested at %s failed: %v", status.RequestedAt, err)
+		err = fmt.Errorf("could not switch over as requested at %s: %v", status.RequestedAt, err)
+	} else {
+		status.Phase = spec.BackupRequestSucceeded
+		c.recordEvent(v1.EventTypeNormal, constants.EventReasonSwitchover,
+			"master role has been moved from %q to %q as requested at %s", status.From, status.To, status.RequestedAt)
+	}
+	c.patchSwitchoverStatus(status)
+
+	return err
+}
+
+func (c *Cluster) patchSwitchoverStatus(status *spec.SwitchoverStatus) {
+	patch, err := json.Marshal(map[string]interface{}{"switchoverRequest": status})
+	if err != nil {
+		c.logger.Warningf("could not marshal the status of the switchover: %v", err)
+		return
+	}
+	_, err = c.KubeClient.CRDREST.Patch(types.MergePatchType).
+		Namespace(c.Namespace).
+		Resource(constants.CRDResource).
+		Name(c.Name).
+		Body(patch).
+		DoRaw()
+	if err != nil && !k8sutil.ResourceNotFound(err) {
+		c.logger.Warningf("could not set the status of the switchover: %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package cluster
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+func TestSwitchoverCandidate(t *testing.T) {
+	pod := func(name string, ready bool) v1.Pod {
+		status := v1.ConditionFalse
+		if ready {
+			status = v1.ConditionTrue
+		}
+		return v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Status: v1.PodStatus{
+				Phase:      v1.PodRunning,
+				Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: status}},
+			},
+		}
+	}
+	pods := []v1.Pod{pod("acid-test-0", true), pod("acid-test-1", true), pod("acid-test-2", false)}
+
+	tests := []struct {
+		name      string
+		master    string
+		requested string
+		candidate string
+		err       bool
+	}{
+		{"requested replica", "acid-test-0", "acid-test-1", "acid-test-1", false},
+		{"any ready replica", "acid-test-0", "", "acid-test-1", false},
+		{"requested master", "acid-test-0", "acid-test-0", "", true},
+		{"requested replica not ready", "acid-test-0", "acid-test-2", "", true},
+		{"unknown pod", "acid-test-0", "acid-test-3", "", true},
+		{"failover without master", "", "acid-test-0", "acid-test-0", false},
+		{"failover without master and candidate", "", "", "", true},
+		{"only ready replica", "acid-test-1", "", "acid-test-0", false},
+	}
+	for _, tt := range tests {
+		candidate, err := switchoverCandidate(pods, tt.master, tt.requested)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: expected error %t, got: %v", tt.name, tt.err, err)
+			continue
+		}
+		if err == nil && candidate.Name != tt.candidate {
+			t.Errorf("%s: expected the candidate %q, got %q", tt.name, tt.candidate, candidate.Name)
+		}
+	}
+	if _, err := switchoverCandidate(pods[:1], "acid-test-0", ""); err == nil {
+		t.Errorf("expected an error without replicas")
+	}
+}
@@ -5,32 +5,56 @@ import (
 	"reflect"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
 	policybeta1 "k8s.io/client-go/pkg/apis/policy/v1beta1"
 
 	"github.com/zalando-incubator/postgres-operator/pkg/spec"
 	"github.com/zalando-incubator/postgres-operator/pkg/util"
 	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
 	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
-	"github.com/zalando-incubator/postgres-operator/pkg/util/volumes"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/users"
 )
 
 // Sync syncs the cluster, making sure the actual Kubernetes objects correspond to what is defined in the manifest.
 // Unlike the update, sync does not error out if some objects do not exist and takes care of creating them.
-func (c *Cluster) Sync(newSpec *spec.Postgresql) (err error) {
+func (c *Cluster) Sync(newSpec *spec.Postgresql) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	return c.sync(newSpec)
+}
+
+func (c *Cluster) sync(newSpec *spec.Postgresql) (err error) {
 	c.setSpec(newSpec)
 
 	defer func() {
+		if statusErr := c.syncVolumesStatus(); statusErr != nil {
+			c.logger.Warningf("could not update status of the volumes: %v", statusErr)
+		}
 		if err != nil {
 			c.logger.Warningf("error while syncing cluster state: %v", err)
 			c.setStatus(spec.ClusterStatusSyncFailed)
-		} else if c.Status != spec.ClusterStatusRunning {
-			c.setStatus(spec.ClusterStatusRunning)
+		} else if len(c.GetEncryptionViolations()) > 0 {
+			if c.Status != spec.ClusterStatusEncryptionViolation {
+				c.setStatus(spec.ClusterStatusEncryptionViolation)
+			}
+		} else if c.Status != c.runningStatus() {
+			c.setStatus(c.runningStatus())
 		}
 	}()
 
+	if err = c.validateVolumeSpec(nil, &c.Spec); err != nil {
+		c.recordEvent(v1.EventTypeWarning, constants.EventReasonInvalidVolumeSpec, "%v", err)
+		err = fmt.Errorf("invalid volume specification: %v", err)
+		return
+	}
+
+	if err = c.validateBackupEncryption(&c.Spec); err != nil {
+		c.recordEvent(v1.EventTypeWarning, constants.EventReasonInvalidBackupEncryption, "%v", err)
+		err = fmt.Errorf("invalid backup encryption: %v", err)
+		return
+	}
+
 	if err = c.initUsers(); err != nil {
 		err = fmt.Errorf("could not init users: %v", err)
 		return
@@ -50,6 +74,35 @@ func (c *Cluster) Sync(newSpec *spec.Postgresql) (err error) {
 		return
 	}
 
+	// claims with instance sizes must exist before the statefulset creates pods for new ordinals
+	if err = c.ensureInstanceVolumeClaims(); err != nil {
+		err = fmt.Errorf("could not sync persistent volume claims with instance sizes: %v", err)
+		return
+	}
+
+	// the statefulset can switch to the binaries of the new major version only once the data has been upgraded
+	c.logger.Debugf("syncing postgresql version")
+	if err = c.syncMajorVersion(); err != nil {
+		err = fmt.Errorf("could not upgrade postgresql version: %v", err)
+		return
+	}
+
+	c.logger.Debugf("syncing the IAM service account")
+	if err = c.syncIAMServiceAccount(); err != nil {
+		err = fmt.Errorf("could not sync the service account with the IAM role: %v", err)
+		return
+	}
+
+	// the restore replaces the statefulset and the volumes before the statefulset is synced
+	c.logger.Debugf("syncing the restore")
+	if err = c.syncRestore(); err != nil {
+		return
+	}
+	if c.restoreRunning() {
+		c.logger.Infof("cluster is being restored, skipping the rest of the sync")
+		return
+	}
+
 	c.logger.Debugf("syncing statefulsets")
 	if err = c.syncStatefulSet(); err != nil {
 		if !k8sutil.ResourceAlreadyExists(err) {
@@ -58,18 +111,118 @@ func (c *Cluster) Sync(newSpec *spec.Postgresql) (err error) {
 		}
 	}
 
+	// the promoted standby accepts roles and databases once Patroni runs its leader as a master
+	c.logger.Debugf("syncing the promotion of the standby cluster")
+	if err := c.syncPromotion(); err != nil {
+		c.logger.Warningf("could not promote the standby cluster: %v", err)
+	}
+
+	c.logger.Debugf("syncing pg_hba rules")
+	if err := c.syncPgHba(); err != nil {
+		c.logger.Warningf("could not sync pg_hba rules: %v", err)
+	}
+
+	c.logger.Debugf("syncing synchronous replication")
+	if err := c.syncSynchronousMode(); err != nil {
+		c.logger.Warningf("could not sync synchronous replication: %v", err)
+	}
+
+	c.logger.Debugf("syncing Patroni settings")
+	if err := c.syncPatroniDCS(); err != nil {
+		c.logger.Warningf("could not sync Patroni settings: %v", err)
+	}
+
+	c.logger.Debugf("syncing scheduled restarts")
+	if err = c.syncScheduledRestart(); err != nil {
+		err = fmt.Errorf("could not restart pods as scheduled: %v", err)
+		return
+	}
+
+	c.logger.Debugf("syncing the placement of the master")
+	if err := c.syncMasterPlacement(); err != nil {
+		c.logger.Warningf("could not move the master off the spot node: %v", err)
+	}
+
+	c.logger.Debugf("syncing the requested switchover")
+	if err := c.syncSwitchoverRequest(); err != nil {
+		c.logger.Warningf("%v", err)
+	}
+
 	// create database objects unless we are running without pods or disabled that feature explicitely
-	if !(c.databaseAccessDisabled() || c.getNumberOfInstances(&newSpec.Spec) <= 0) {
+	if !(c.databaseAccessDisabled() || c.getNumberOfInstances(&newSpec.Spec) <= 0 || c.isStandbyCluster() ||
+		c.promotionPending()) {
 		c.logger.Debugf("syncing roles")
 		if err = c.syncRoles(); err != nil {
 			err = fmt.Errorf("could not sync roles: %v", err)
 			return
 		}
+		c.logger.Debugf("syncing removed users")
+		if err := c.syncRemovedUsers(); err != nil {
+			c.logger.Warningf("could not handle removed users: %v", err)
+		}
+		c.logger.Debugf("syncing password rotation")
+		if err := c.syncPasswordRotation(); err != nil {
+			c.logger.Warningf("could not rotate passwords: %v", err)
+		}
+		if err := c.syncSystemPasswordRotation(); err != nil {
+			c.logger.Warningf("could not rotate passwords of the system users: %v", err)
+		}
 		c.logger.Debugf("syncing databases")
 		if err = c.syncDatabases(); err != nil {
 			err = fmt.Errorf("could not sync databases: %v", err)
 			return
 		}
+		// the removed pods may still hold their slots right after scaling down
+		c.logger.Debugf("dropping replication slots of removed pods")
+		if err := c.dropRemovedMemberSlots(); err != nil {
+			c.logger.Warningf("could not drop replication slots of the removed pods: %v", err)
+		}
+		c.logger.Debugf("syncing tablespaces")
+		if err = c.syncTablespaces(); err != nil {
+			err = fmt.Errorf("could not sync tablespaces: %v", err)
+			return
+		}
+		c.logger.Debugf("syncing snapshot backups")
+		if err = c.syncSnapshotBackups(); err != nil {
+			err = fmt.Errorf("could not sync snapshot backups: %v", err)
+			return
+		}
+		c.logger.Debugf("syncing pgBackRest backups")
+		if err := c.syncPgBackRest(); err != nil {
+			c.logger.Warningf("could not sync pgBackRest backups: %v", err)
+		}
+		c.logger.Debugf("listing base backups")
+		if err := c.syncBaseBackups(); err != nil {
+			c.logger.Warningf("could not list base backups: %v", err)
+		}
+		c.logger.Debugf("deleting expired base backups")
+		if err := c.syncBackupRetention(); err != nil {
+			c.logger.Warningf("could not delete expired base backups: %v", err)
+		}
+		c.logger.Debugf("syncing backup objects")
+		if err := c.syncBackupObjects(); err != nil {
+			c.logger.Warningf("could not sync backup objects: %v", err)
+		}
+		c.logger.Debugf("checking the backup health")
+		if err := c.syncBackupHealth(); err != nil {
+			c.logger.Warningf("could not check the backup health: %v", err)
+		}
+		c.logger.Debugf("syncing the number of instances")
+		if err := c.syncAutoscaling(); err != nil {
+			c.logger.Warningf("could not autoscale the cluster: %v", err)
+		}
+	}
+
+	// after the password rotation, so that the copies get the new passwords
+	c.logger.Debugf("syncing copies of the secrets")
+	if err := c.syncSecretCopies(); err != nil {
+		c.logger.Warningf("could not sync copies of the secrets: %v", err)
+	}
+
+	c.logger.Debugf("syncing the clone user")
+	if err = c.syncCloneUser(); err != nil {
+		err = fmt.Errorf("could not remove the clone user: %v", err)
+		return
 	}
 
 	c.logger.Debugf("syncing persistent volumes")
@@ -78,12 +231,67 @@ func (c *Cluster) Sync(newSpec *spec.Postgresql) (err error) {
 		return
 	}
 
+	c.logger.Debugf("syncing tags of persistent volumes")
+	if err = c.syncVolumeTags(); err != nil {
+		err = fmt.Errorf("could not sync tags of persistent volumes: %v", err)
+		return
+	}
+
+	c.logger.Debugf("syncing labels and annotations of persistent volume claims")
+	if err = c.syncVolumeClaimMetadata(); err != nil {
+		err = fmt.Errorf("could not sync labels and annotations of persistent volume claims: %v", err)
+		return
+	}
+
+	c.logger.Debugf("syncing storage classes of persistent volumes")
+	if err = c.syncVolumeStorageClasses(); err != nil {
+		err = fmt.Errorf("could not migrate persistent volumes to the new storage class: %v", err)
+		return
+	}
+
+	c.logger.Debugf("collecting orphaned persistent volume claims")
+	if err = c.syncOrphanedVolumeClaims(); err != nil {
+		err = fmt.Errorf("could not collect orphaned persistent volume claims: %v", err)
+		return
+	}
+
+	c.logger.Debugf("shrinking persistent volumes")
+	if err = c.syncVolumeShrink(); err != nil {
+		err = fmt.Errorf("could not shrink persistent volumes: %v", err)
+		return
+	}
+
+	if c.OpConfig.RequireVolumeEncryption {
+		c.logger.Debugf("checking encryption of persistent volumes")
+		if err = c.syncVolumeEncryption(); err != nil {
+			err = fmt.Errorf("could not check encryption of persistent volumes: %v", err)
+			return
+		}
+	}
+
 	c.logger.Debug("syncing pod disruption budgets")
 	if err = c.syncPodDisruptionBudget(false); err != nil {
 		err = fmt.Errorf("could not sync pod disruption budget: %v", err)
 		return
 	}
 
+	c.logger.Debug("syncing logical backup job")
+	if err := c.syncLogicalBackupJob(); err != nil {
+		c.logger.Warningf("could not sync logical backup job: %v", err)
+	}
+
+	c.logger.Debug("syncing backup verification job")
+	if err := c.syncBackupVerificationJob(); err != nil {
+		c.logger.Warningf("could not sync backup verification job: %v", err)
+	} else if err := c.syncBackupVerification(); err != nil {
+		c.logger.Warningf("could not check the backup verification: %v", err)
+	}
+
+	c.logger.Debug("syncing requested backups")
+	if err := c.syncBackupRequests(); err != nil {
+		c.logger.Warningf("could not take the requested backups: %v", err)
+	}
+
 	return
 }
 
@@ -108,7 +316,7 @@ func (c *Cluster) syncService(role PostgresRole) error {
 
 	svc, err := c.KubeClient.Services(c.Namespace).Get(c.serviceName(role), metav1.GetOptions{})
 	if err == nil {
-		if role == Replica && !c.Spec.ReplicaLoadBalancer {
+		if role == Replica && !c.replicaServiceEnabled() {
 			if err := c.deleteService(role); err != nil {
 				return fmt.Errorf("could not delete %s service", role)
 			}
@@ -134,7 +342,7 @@ func (c *Cluster) syncService(role PostgresRole) error {
 	c.Services[role] = nil
 
 	// Service does not exist
-	if role == Replica && !c.Spec.ReplicaLoadBalancer {
+	if role == Replica && !c.replicaServiceEnabled() {
 		return nil
 	}
 
@@ -165,7 +373,7 @@ func (c *Cluster) syncEndpoint(role PostgresRole) error {
 
 	ep, err := c.KubeClient.Endpoints(c.Namespace).Get(c.endpointName(role), metav1.GetOptions{})
 	if err == nil {
-		if role == Replica && !c.Spec.ReplicaLoadBalancer {
+		if role == Replica && !c.replicaServiceEnabled() {
 			if err := c.deleteEndpoint(role); err != nil {
 				return fmt.Errorf("could not delete %s endpoint", role)
 			}
@@ -178,7 +386,7 @@ func (c *Cluster) syncEndpoint(role PostgresRole) error {
 	}
 	c.Endpoints[role] = nil
 
-	if role == Replica && !c.Spec.ReplicaLoadBalancer {
+	if role == Replica && !c.replicaServiceEnabled() {
 		return nil
 	}
 
@@ -277,14 +485,34 @@ func (c *Cluster) syncStatefulSet() error {
 		if err != nil {
 			return fmt.Errorf("could not generate statefulset: %v", err)
 		}
+		if *desiredSS.Spec.Replicas < *sset.Spec.Replicas {
+			switchover, err := c.scaleDownNeedsSwitchover(*desiredSS.Spec.Replicas)
+			if err != nil {
+				return err
+			}
+			if switchover && !c.inMaintenanceWindow() {
+				c.logger.Infof("scaling down requires a switchover, deferred until the next maintenance window")
+				desiredSS.Spec.Replicas = sset.Spec.Replicas
+			} else if switchover {
+				if err := c.switchoverBeforeScaleDown(*desiredSS.Spec.Replicas); err != nil {
+					return fmt.Errorf("could not switch over before scaling down: %v", err)
+				}
+			}
+		}
 
+		pending := c.rollingUpdatePending()
 		cmp := c.compareStatefulSetWith(desiredSS)
-		if cmp.match {
+		if cmp.match && !(pending && c.inMaintenanceWindow()) {
 			return nil
 		}
-		c.logStatefulSetChanges(c.Statefulset, desiredSS, false, cmp.reasons)
+		if !cmp.match {
+			c.logStatefulSetChanges(c.Statefulset, desiredSS, false, cmp.reasons)
+		}
 
-		if !cmp.replace {
+		oldPodAnnotations := sset.Spec.Template.Annotations
+		if cmp.match {
+			c.logger.Infof("performing the rolling update deferred until the maintenance window")
+		} else if !cmp.replace {
 			if err := c.updateStatefulSet(desiredSS); err != nil {
 				return fmt.Errorf("could not update statefulset: %v", err)
 			}
@@ -293,11 +521,20 @@ func (c *Cluster) syncStatefulSet() error {
 				return fmt.Errorf("could not replace statefulset: %v", err)
 			}
 		}
+		if !reflect.DeepEqual(oldPodAnnotations, desiredSS.Spec.Template.Annotations) {
+			if err := c.patchPodAnnotations(oldPodAnnotations, desiredSS.Spec.Template.Annotations); err != nil {
+				return err
+			}
+		}
 
-		if !cmp.rollingUpdate {
+		if !cmp.rollingUpdate && !pending {
 			c.logger.Debugln("no rolling update is needed")
 			return nil
 		}
+		if !c.inMaintenanceWindow() {
+			c.logger.Infof("rolling update deferred until the next maintenance window")
+			return c.setRollingUpdatePending(true)
+		}
 	}
 	// if we get here we also need to re-create the pods (either leftovers from the old
 	// statefulset or those that got their configuration from the outdated statefulset)
@@ -306,6 +543,11 @@ func (c *Cluster) syncStatefulSet() error {
 		return fmt.Errorf("could not recreate pods: %v", err)
 	}
 	c.logger.Infof("pods have been recreated")
+	if c.rollingUpdatePending() {
+		if err := c.setRollingUpdatePending(false); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -323,6 +565,12 @@ func (c *Cluster) syncSecrets() error {
 				return fmt.Errorf("could not get current secret: %v", err2)
 			}
 			c.logger.Debugf("secret %q already exists, fetching its password", util.NameFromMeta(curSecret.ObjectMeta))
+			if syncSecretMetadata(curSecret, secretSpec) {
+				if curSecret, err2 = c.KubeClient.Secrets(curSecret.Namespace).Update(curSecret); err2 != nil {
+					return fmt.Errorf("could not update labels and annotations of the secret %q: %v",
+						util.NameFromMeta(secretSpec.ObjectMeta), err2)
+				}
+			}
 			if secretUsername == c.systemUsers[constants.SuperuserKeyName].Name {
 				secretUsername = constants.SuperuserKeyName
 				userMap = c.systemUsers
@@ -346,6 +594,10 @@ func (c *Cluster) syncSecrets() error {
 		}
 	}
 
+	if len(c.externalCredentialsBackends()) > 0 {
+		return c.syncExternalCredentials()
+	}
+
 	return nil
 }
 
@@ -376,30 +628,115 @@ func (c *Cluster) syncRoles() error {
 		return fmt.Errorf("error getting users from the database: %v", err)
 	}
 
+	c.userSyncStrategy = users.DefaultUserSyncStrategy{PasswordEncryption: c.passwordEncryption(&c.Spec)}
 	pgSyncRequests := c.userSyncStrategy.ProduceSyncRequests(dbUsers, c.pgUsers)
 	if err = c.userSyncStrategy.ExecuteSyncRequests(pgSyncRequests, c.pgDb); err != nil {
 		return fmt.Errorf("error executing sync statements: %v", err)
 	}
+	if err = c.revokeFormerSuperuserPrivileges(); err != nil {
+		return fmt.Errorf("could not revoke the privileges of former superuser team members: %v", err)
+	}
 
 	return nil
 }
 
 // syncVolumes reads all persistent volumes and checks that their size matches the one declared in the statefulset.
 func (c *Cluster) syncVolumes() error {
-	c.setProcessName("syncing volumes")
+	for _, volume := range persistentClusterVolumes(&c.Spec) {
+		if err := c.syncVolume(volume); err != nil {
+			return fmt.Errorf("could not sync %s volumes: %v", volume.name, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Cluster) syncVolume(volume clusterVolume) error {
+	c.setProcessName("syncing %s volumes", volume.name)
 
-	act, err := c.volumesNeedResizing(c.Spec.Volume)
+	resizers, err := c.volumeResizers()
+	if err != nil {
+		return err
+	}
+
+	act, err := c.volumesNeedResizing(volume)
 	if err != nil {
 		return fmt.Errorf("could not compare size of the volumes: %v", err)
 	}
-	if !act {
+	modify, err := c.volumesNeedModification(volume, resizers)
+	if err != nil {
+		return fmt.Errorf("could not compare type and performance of the volumes: %v", err)
+	}
+	if !act && !modify {
+		return nil
+	}
+	if !c.inMaintenanceWindow() {
+		c.logger.Infof("resizing %s volumes deferred until the next maintenance window", volume.name)
+		return nil
+	}
+	if act && c.OpConfig.EnableVolumeShrink {
+		shrink, err := c.volumesNeedShrinking(volume)
+		if err != nil {
+			return fmt.Errorf("could not compare size of the volumes: %v", err)
+		}
+		if shrink {
+			c.logger.Infof("%s volumes are larger than in the manifest, the pods will be rebuilt on smaller volumes", volume.name)
+			return nil
+		}
+	}
+
+	pvcs, err := c.listPersistentVolumeClaims()
+	if err != nil {
+		return fmt.Errorf("could not list persistent volume claims: %v", err)
+	}
+	expandable, err := c.volumeClaimsExpandable(pvcs, volume.name)
+	if err != nil {
+		return fmt.Errorf("could not check if persistent volume claims are expandable: %v", err)
+	}
+	// type and performance changes are only possible via the provider API, which also takes care of the size
+	expand := expandable && !modify
+	if !expand {
+		resizable, err := c.providerVolumesResizable(volume.name, resizers)
+		if err != nil {
+			return fmt.Errorf("could not check if the volumes are resizable: %v", err)
+		}
+		if !resizable && !expandable {
+			c.recordEvent(v1.EventTypeWarning, constants.EventReasonVolumeResizeFailed,
+				"%s volumes can't be resized by the volume provider while they are attached and their claims are not "+
+					"expandable", volume.name)
+			return nil
+		}
+		if !resizable {
+			c.logger.Warningf("%s volumes can't be modified by the volume provider while they are attached, "+
+				"only expanding their claims", volume.name)
+			expand = true
+		}
+	}
+
+	// the expanded volumes might not belong to any provider the snapshots are taken with, i.e. CSI volumes
+	if c.OpConfig.SnapshotBeforeResize && expand {
+		c.logger.Infof("not taking snapshots of %s volumes resized by Kubernetes", volume.name)
+	} else if c.OpConfig.SnapshotBeforeResize {
+		if err := c.snapshotVolumes(volume, resizers); err != nil {
+			return fmt.Errorf("could not take snapshots before resizing volumes: %v", err)
+		}
+	}
+
+	if expand {
+		if err := c.expandPersistentVolumeClaims(pvcs, volume); err != nil {
+			return fmt.Errorf("could not sync volumes: %v", err)
+		}
+		c.logger.Infof("persistent volume claims of %s volumes have been expanded, volumes will be resized by Kubernetes", volume.name)
+
 		return nil
 	}
-	if err := c.resizeVolumes(c.Spec.Volume, []volumes.VolumeResizer{&volumes.EBSVolumeResizer{}}); err != nil {
+
+	// fall back to resizing volumes directly via the cloud provider API
+	if err := c.resizeVolumes(volume, resizers); err != nil {
 		return fmt.Errorf("could not sync volumes: %v", err)
 	}
 
-	c.logger.Infof("volumes have been synced successfully")
+	c.logger.Infof("%s volumes have been synced successfully", volume.name)
 
 	return nil
 }
@@ -433,7 +770,15 @@ func (c *Cluster) syncDatabases() error {
 		return fmt.Errorf("could not get current databases: %v", err)
 	}
 
-	for datname, newOwner := range c.Spec.Databases {
+	databases := make(map[string]string)
+	for datname, owner := range c.Spec.Databases {
+		databases[datname] = owner
+	}
+	for datname := range c.Spec.PreparedDatabases {
+		databases[datname] = preparedDatabaseOwner(datname)
+	}
+
+	for datname, newOwner := range databases {
 		currentOwner, exists := currentDatabases[datname]
 		if !exists {
 			createDatabases[datname] = newOwner
@@ -442,10 +787,6 @@ func (c *Cluster) syncDatabases() error {
 		}
 	}
 
-	if len(createDatabases)+len(alterOwnerDatabases) == 0 {
-		return nil
-	}
-
 	for datname, owner := range createDatabases {
 		if err = c.executeCreateDatabase(datname, owner); err != nil {
 			return err
@@ -457,5 +798,135 @@ func (c *Cluster) syncDatabases() error {
 		}
 	}
 
+	if err := c.syncDatabaseDefaultPrivileges(); err != nil {
+		return err
+	}
+	if err := c.syncOwnerReaderPrivileges(); err != nil {
+		return err
+	}
+
+	return c.syncPreparedSchemas()
+}
+
+// dropRemovedDatabases drops the databases removed from the manifest, if the operator is allowed to. Only the
+// databases the previous manifest declared are dropped, the ones created by hand stay untouched.
+func (c *Cluster) dropRemovedDatabases(oldDatabases, newDatabases map[string]string) error {
+	if !c.OpConfig.EnableDatabaseDrop {
+		return nil
+	}
+	removed := make([]string, 0)
+	for datname := range oldDatabases {
+		if _, ok := newDatabases[datname]; !ok && !isSystemDatabase(datname) {
+			removed = append(removed, datname)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	c.setProcessName("dropping databases")
+
+	if err := c.initDbConn(); err != nil {
+		return fmt.Errorf("could not init database connection")
+	}
+	defer func() {
+		if err := c.closeDbConn(); err != nil {
+			c.logger.Errorf("could not close database connection: %v", err)
+		}
+	}()
+
+	currentDatabases, err := c.getDatabases()
+	if err != nil {
+		return fmt.Errorf("could not get current databases: %v", err)
+	}
+	for _, datname := range removed {
+		if _, exists := currentDatabases[datname]; !exists {
+			continue
+		}
+		if err := c.executeDropDatabase(datname); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// syncTablespaces prepares the directories for the tablespaces declared in the manifest on every pod
+// and creates the tablespaces that do not exist yet. Existing tablespaces are never dropped.
+func (c *Cluster) syncTablespaces() error {
+	c.setProcessName("syncing tablespaces")
+
+	tablespaceVolumes := make([]clusterVolume, 0)
+	for _, volume := range clusterVolumes(&c.Spec) {
+		if volume.tablespace != "" {
+			tablespaceVolumes = append(tablespaceVolumes, volume)
+		}
+	}
+	if len(tablespaceVolumes) == 0 {
+		return nil
+	}
+
+	// the directories must exist on replicas as well, otherwise they cannot replay the creation of the tablespace
+	pods, err := c.listPods()
+	if err != nil {
+		return fmt.Errorf("could not list pods of the cluster: %v", err)
+	}
+	// a volume added to the manifest is mounted only after the pods have been rolled; creating the directory
+	// before that would place the tablespace on the data volume, so such tablespaces are left for the next sync
+	pending := make(map[string]bool)
+	for _, pod := range pods {
+		podName := util.NameFromMeta(pod.ObjectMeta)
+		for _, volume := range tablespaceVolumes {
+			mounted, err := c.isVolumeMounted(&podName, volume.mountPath)
+			if err != nil {
+				return fmt.Errorf("could not check the volume of the tablespace %q on pod %q: %v", volume.tablespace, podName, err)
+			}
+			if !mounted {
+				c.logger.Warningf("volume of the tablespace %q is not mounted on pod %q yet, postponing its creation", volume.tablespace, podName)
+				pending[volume.tablespace] = true
+			}
+		}
+	}
+	for _, pod := range pods {
+		podName := util.NameFromMeta(pod.ObjectMeta)
+		for _, volume := range tablespaceVolumes {
+			if pending[volume.tablespace] {
+				continue
+			}
+			cmd := fmt.Sprintf("mkdir -p %[1]s && chown postgres:postgres %[1]s && chmod 700 %[1]s", volume.tablespaceLocation())
+			if _, err := c.ExecCommand(&podName, "bash", "-c", cmd); err != nil {
+				return fmt.Errorf("could not prepare directory for the tablespace %q on pod %q: %v", volume.tablespace, podName, err)
+			}
+		}
+	}
+
+	if err := c.initDbConn(); err != nil {
+		return fmt.Errorf("could not init database connection")
+	}
+	defer func() {
+		if err := c.closeDbConn(); err != nil {
+			c.logger.Errorf("could not close database connection: %v", err)
+		}
+	}()
+
+	currentTablespaces, err := c.getTablespaces()
+	if err != nil {
+		return fmt.Errorf("could not get current tablespaces: %v", err)
+	}
+	for _, volume := range tablespaceVolumes {
+		location, exists := currentTablespaces[volume.tablespace]
+		if exists {
+			if location != volume.tablespaceLocation() {
+				c.logger.Warningf("tablespace %q is located in %q instead of %q", volume.tablespace, location, volume.tablespaceLocation())
+			}
+			continue
+		}
+		if pending[volume.tablespace] {
+			continue
+		}
+		if err := c.executeCreateTablespace(volume.tablespace, volume.tablespaceLocation()); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
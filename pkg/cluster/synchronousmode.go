@@ -0,0 +1,134 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/patroni"
+)
+
+const (
+	patroniRoleReplica     = "replica"
+	patroniRoleSyncStandby = "sync_standby"
+
+	patroniStateRunning   = "running"
+	patroniStateStreaming = "streaming"
+)
+
+// synchronousModeConfig returns the synchronous replication settings of the manifest as keys of the dynamic
+// configuration of Patroni. The number of synchronous standbys is removed from it when not set, Patroni defaults to 1.
+func synchronousModeConfig(patroni *spec.Patroni) map[string]interface{} {
+	config := map[string]interface{}{
+		"synchronous_mode":        patroni.SynchronousMode,
+		"synchronous_mode_strict": patroni.SynchronousModeStrict,
+		"synchronous_node_count":  nil,
+	}
+	if patroni.SynchronousNodeCount > 0 {
+		config["synchronous_node_count"] = patroni.SynchronousNodeCount
+	}
+	return config
+}
+
+// dynamicConfigChanges returns the settings differing from the dynamic configuration. The configuration only
+// contains the keys set before, missing ones are the same as disabled or removed.
+func dynamicConfigChanges(desired, current map[string]interface{}) map[string]interface{} {
+	changes := make(map[string]interface{})
+	for key, value := range desired {
+		currentValue, ok := current[key]
+		if !ok && (value == nil || value == false) {
+			continue
+		}
+		if fmt.Sprint(value) != fmt.Sprint(currentValue) {
+			changes[key] = value
+		}
+	}
+	return changes
+}
+
+// synchronousStandbys returns the names of the members Patroni replicates to synchronously.
+func synchronousStandbys(members []patroni.ClusterMember) []string {
+	result := make([]string, 0)
+	for _, member := range members {
+		if member.Role == patroniRoleSyncStandby {
+			result = append(result, member.Name)
+		}
+	}
+	return result
+}
+
+// syncSynchronousMode sets the synchronous replication settings of the manifest in the dynamic configuration of the
+// cluster, and reports the current synchronous standbys in the status of the postgresql object.
+func (c *Cluster) syncSynchronousMode() error {
+	c.setProcessName("syncing synchronous replication")
+
+	masterPods, err := c.getRolePods(Master)
+	if err != nil {
+		return fmt.Errorf("could not get master pod: %v", err)
+	}
+	if len(masterPods) == 0 || !podIsReady(&masterPods[0]) {
+		c.logger.Debugf("no running master pod, not syncing synchronous replication")
+		return nil
+	}
+
+	settings := &c.Spec.Patroni
+	if nodeCount := settings.SynchronousNodeCount; settings.SynchronousModeStrict &&
+		int32(nodeCount) >= c.getNumberOfInstances(&c.Spec) {
+		c.logger.Warningf("strict synchronous mode with %d synchronous standbys blocks writes with %d instances",
+			nodeCount, c.getNumberOfInstances(&c.Spec))
+	}
+
+	config, err := c.patroni.GetConfig(&masterPods[0])
+	if err != nil {
+		return fmt.Errorf("could not get dynamic configuration: %v", err)
+	}
+	if changes := dynamicConfigChanges(synchronousModeConfig(settings), config); len(changes) > 0 {
+		if err := c.patroni.SetConfig(&masterPods[0], changes); err != nil {
+			return fmt.Errorf("could not set synchronous replication: %v", err)
+		}
+		c.logger.Infof("synchronous replication settings have been updated: %v", changes)
+	}
+
+	return c.syncSynchronousStandbys(&masterPods[0])
+}
+
+func (c *Cluster) syncSynchronousStandbys(master *v1.Pod) error {
+	standbys := make([]string, 0)
+	if c.Spec.Patroni.SynchronousMode {
+		members, err := c.patroni.GetClusterMembers(master)
+		if err != nil {
+			return fmt.Errorf("could not get the members of the cluster: %v", err)
+		}
+		standbys = synchronousStandbys(members)
+	}
+	if len(standbys) == 0 && len(c.SynchronousStandbys) == 0 || reflect.DeepEqual(standbys, c.SynchronousStandbys) {
+		return nil
+	}
+
+	var value interface{}
+	if len(standbys) > 0 {
+		value = standbys
+	}
+	patch, err := json.Marshal(map[string]interface{}{"synchronousStandbys": value})
+	if err != nil {
+		return fmt.Errorf("could not marshal the synchronous standbys: %v", err)
+	}
+	_, err = c.KubeClient.CRDREST.Patch(types.MergePatchType).
+		Namespace(c.Namespace).
+		Resource(constants.CRDResource).
+		Name(c.Name).
+		Body(patch).
+		DoRaw()
+	if err != nil {
+		return fmt.Errorf("could not set the synchronous standbys: %v", err)
+	}
+	c.logger.Infof("synchronous standbys: %v", standbys)
+	c.SynchronousStandbys = standbys
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/patroni"
+)
+
+func TestSynchronousModeChanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings spec.Patroni
+		current  map[string]interface{}
+		changes  map[string]interface{}
+	}{
+		{"disabled", spec.Patroni{}, map[string]interface{}{"ttl": 30.0}, map[string]interface{}{}},
+		{"enabled", spec.Patroni{SynchronousMode: true}, map[string]interface{}{},
+			map[string]interface{}{"synchronous_mode": true}},
+		{"unchanged", spec.Patroni{SynchronousMode: true, SynchronousNodeCount: 2},
+			map[string]interface{}{"synchronous_mode": true, "synchronous_mode_strict": false, "synchronous_node_count": 2.0},
+			map[string]interface{}{}},
+		{"strict", spec.Patroni{SynchronousMode: true, SynchronousModeStrict: true},
+			map[string]interface{}{"synchronous_mode": true},
+			map[string]interface{}{"synchronous_mode_strict": true}},
+		{"node count removed", spec.Patroni{SynchronousMode: true},
+			map[string]interface{}{"synchronous_mode": true, "synchronous_node_count": 2.0},
+			map[string]interface{}{"synchronous_node_count": nil}},
+		{"turned off", spec.Patroni{},
+			map[string]interface{}{"synchronous_mode": true, "synchronous_mode_strict": true},
+			map[string]interface{}{"synchronous_mode": false, "synchronous_mode_strict": false}},
+	}
+	for _, tt := range tests {
+		if changes := dynamicConfigChanges(synchronousModeConfig(&tt.settings), tt.current); !reflect.DeepEqual(changes, tt.changes) {
+			t.Errorf("%s: expected the changes %v, got: %v", tt.name, tt.changes, changes)
+		}
+	}
+}
+
+func TestSynchronousStandbys(t *testing.T) {
+	members := []patroni.ClusterMember{
+		{Name: "acid-test-0", Role: "leader", State: "running"},
+		{Name: "acid-test-1", Role: "sync_standby", State: "running"},
+		{Name: "acid-test-2", Role: "replica", State: "running"},
+	}
+	if standbys := synchronousStandbys(members); !reflect.DeepEqual(standbys, []string{"acid-test-1"}) {
+		t.Errorf("expected acid-test-1 as the synchronous standby, got: %v", standbys)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"math/rand"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -21,6 +22,7 @@ import (
 	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
 	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
 	"github.com/zalando-incubator/postgres-operator/pkg/util/retryutil"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/teams"
 )
 
 // OAuthTokenGetter provides the method for fetching OAuth tokens
@@ -92,11 +94,47 @@ func invertFlag(flag string) string {
 	return "NO" + flag
 }
 
+// normalizeRoleAttribute converts the role attribute with a value, i.e. "connection limit 10" or
+// "valid until 2030-01-01", into the form used in CREATE ROLE and read from the database. It returns false for flags.
+func normalizeRoleAttribute(flag string) (attribute string, value string, ok bool, err error) {
+	if m := connectionLimitRegexp.FindStringSubmatch(flag); m != nil {
+		limit, err := strconv.Atoi(m[1])
+		if err != nil || limit < -1 {
+			return "", "", true, fmt.Errorf("invalid connection limit %q", m[1])
+		}
+		return constants.RoleConnectionLimit, strconv.Itoa(limit), true, nil
+	}
+	if m := validUntilRegexp.FindStringSubmatch(flag); m != nil {
+		if strings.ToLower(m[1]) == constants.RoleValidUntilInfinity {
+			return constants.RoleValidUntil, fmt.Sprintf("'%s'", constants.RoleValidUntilInfinity), true, nil
+		}
+		for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+			if t, err := time.Parse(layout, m[1]); err == nil {
+				return constants.RoleValidUntil, fmt.Sprintf("'%s'", t.UTC().Format(time.RFC3339)), true, nil
+			}
+		}
+		return "", "", true, fmt.Errorf("invalid expiration time %q, expected RFC 3339 or YYYY-MM-DD", m[1])
+	}
+	return "", "", false, nil
+}
+
 func normalizeUserFlags(userFlags []string) ([]string, error) {
 	uniqueFlags := make(map[string]bool)
+	attributes := make(map[string]string)
 	addLogin := true
 
 	for _, flag := range userFlags {
+		attribute, value, ok, err := normalizeRoleAttribute(flag)
+		if err != nil {
+			return nil, fmt.Errorf("user flag %q is not valid: %v", flag, err)
+		}
+		if ok {
+			if previous, present := attributes[attribute]; present && previous != value {
+				return nil, fmt.Errorf("conflicting user flags: %q and %q", attribute+" "+previous, attribute+" "+value)
+			}
+			attributes[attribute] = value
+			continue
+		}
 		if !alphaNumericRegexp.MatchString(flag) {
 			return nil, fmt.Errorf("user flag %q is not alphanumeric", flag)
 		}
@@ -129,6 +167,9 @@ func normalizeUserFlags(userFlags []string) ([]string, error) {
 	if addLogin {
 		flags = append(flags, constants.RoleFlagLogin)
 	}
+	for attribute, value := range attributes {
+		flags = append(flags, attribute+" "+value)
+	}
 	sort.Strings(flags)
 	return flags, nil
 }
@@ -160,6 +201,9 @@ func (c *Cluster) logPDBChanges(old, new *policybeta1.PodDisruptionBudget, isUpd
 	}
 
 	c.logger.Debugf("diff\n%s\n", util.PrettyDiff(old.Spec, new.Spec))
+	if reason != "" {
+		c.logger.Infof("reason: %s", reason)
+	}
 }
 
 func (c *Cluster) logStatefulSetChanges(old, new *v1beta1.StatefulSet, isUpdate bool, reasons []string) {
@@ -196,26 +240,29 @@ func (c *Cluster) logServiceChanges(role PostgresRole, old, new *v1.Service, isU
 	}
 }
 
-func (c *Cluster) logVolumeChanges(old, new spec.Volume) {
+func (c *Cluster) logVolumeChanges(old, new interface{}) {
 	c.logger.Infof("volume specification has been changed")
 	c.logger.Debugf("diff\n%s\n", util.PrettyDiff(old, new))
 }
 
-func (c *Cluster) getTeamMembers() ([]string, error) {
-	if c.Spec.TeamID == "" {
+func (c *Cluster) getTeamMembers(teamID string) ([]string, error) {
+	if teamID == "" {
 		return nil, fmt.Errorf("no teamId specified")
 	}
-	if !c.OpConfig.EnableTeamsAPI {
+	if !c.OpConfig.EnableTeamsAPI || c.teamsAPIClient == nil {
 		c.logger.Debug("team API is disabled, returning empty list of members")
 		return []string{}, nil
 	}
 
-	token, err := c.oauthTokenGetter.getOAuthToken()
-	if err != nil {
-		return []string{}, fmt.Errorf("could not get oauth token: %v", err)
+	var token string
+	if teams.RequiresToken(&c.OpConfig) {
+		var err error
+		if token, err = c.oauthTokenGetter.getOAuthToken(); err != nil {
+			return []string{}, fmt.Errorf("could not get oauth token: %v", err)
+		}
 	}
 
-	teamInfo, err := c.teamsAPIClient.TeamInfo(c.Spec.TeamID, token)
+	teamInfo, err := c.teamsAPIClient.TeamInfo(teamID, token)
 	if err != nil {
 		return nil, fmt.Errorf("could not get team info: %v", err)
 	}
@@ -338,13 +385,7 @@ func (c *Cluster) waitStatefulsetPodsReady() error {
 }
 
 func (c *Cluster) labelsSet() labels.Set {
-	lbls := make(map[string]string)
-	for k, v := range c.OpConfig.ClusterLabels {
-		lbls[k] = v
-	}
-	lbls[c.OpConfig.ClusterNameLabel] = c.Name
-
-	return labels.Set(lbls)
+	return c.clusterLabelsFor(c.Name)
 }
 
 func (c *Cluster) roleLabelsSet(role PostgresRole) labels.Set {
@@ -378,10 +419,78 @@ func (c *Cluster) credentialSecretNameForCluster(username string, clusterName st
 	return c.OpConfig.SecretNameTemplate.Format(
 		"username", strings.Replace(username, "_", "-", -1),
 		"cluster", clusterName,
+		"team", strings.ToLower(c.clusterTeamName(clusterName)),
+		"namespace", c.Namespace,
 		"tprkind", constants.CRDKind,
 		"tprgroup", constants.CRDGroup)
 }
 
+// clusterTeamName returns the team of a cluster in the namespace, which may be the source of a clone of another team:
+// the team of the clone section for its source, the team of this cluster for the names starting with it, and the
+// name up to the first dash otherwise.
+func (c *Cluster) clusterTeamName(clusterName string) string {
+	if clusterName == c.Spec.Clone.ClusterName && c.Spec.Clone.TeamID != "" {
+		return c.Spec.Clone.TeamID
+	}
+	if strings.HasPrefix(strings.ToLower(clusterName), strings.ToLower(c.teamName())+"-") {
+		return c.teamName()
+	}
+	if i := strings.Index(clusterName, "-"); i > 0 {
+		return clusterName[:i]
+	}
+	return c.teamName()
+}
+
+// secretLabelsSet returns the labels of the credential secrets: the configured extra labels, overridden by the ones of
+// the cluster, as the secrets are selected by them.
+func (c *Cluster) secretLabelsSet() labels.Set {
+	lbls := labels.Set{}
+	for k, v := range c.OpConfig.SecretLabels {
+		lbls[k] = v
+	}
+	for k, v := range c.labelsSet() {
+		lbls[k] = v
+	}
+	return lbls
+}
+
+// secretAnnotations returns the configured extra annotations of the credential secrets.
+func (c *Cluster) secretAnnotations() map[string]string {
+	if len(c.OpConfig.SecretAnnotations) == 0 {
+		return nil
+	}
+	annotations := make(map[string]string, len(c.OpConfig.SecretAnnotations))
+	for k, v := range c.OpConfig.SecretAnnotations {
+		annotations[k] = v
+	}
+	return annotations
+}
+
+// syncSecretMetadata sets the labels and annotations of the generated secret on the current one, keeping the ones
+// added by others. It returns true if the current secret has been changed.
+func syncSecretMetadata(cur, generated *v1.Secret) bool {
+	changed := false
+	if cur.Labels == nil {
+		cur.Labels = make(map[string]string)
+	}
+	for k, v := range generated.Labels {
+		if cur.Labels[k] != v {
+			cur.Labels[k] = v
+			changed = true
+		}
+	}
+	if len(generated.Annotations) > 0 && cur.Annotations == nil {
+		cur.Annotations = make(map[string]string)
+	}
+	for k, v := range generated.Annotations {
+		if cur.Annotations[k] != v {
+			cur.Annotations[k] = v
+			changed = true
+		}
+	}
+	return changed
+}
+
 func masterCandidate(replicas []spec.NamespacedName) spec.NamespacedName {
 	return replicas[rand.Intn(len(replicas))]
 }
@@ -418,3 +527,16 @@ func (c *Cluster) GetSpec() (*spec.Postgresql, error) {
 func (c *Cluster) patroniUsesKubernetes() bool {
 	return c.OpConfig.EtcdHost == ""
 }
+
+// replicaServiceEnabled checks if the cluster has the load balancer for the replicas, which hibernated clusters don't.
+func (c *Cluster) replicaServiceEnabled() bool {
+	return c.Spec.ReplicaLoadBalancer && !c.Spec.Hibernated
+}
+
+// runningStatus returns the status of the cluster when there is nothing left to do.
+func (c *Cluster) runningStatus() spec.PostgresStatus {
+	if c.Spec.Hibernated {
+		return spec.ClusterStatusHibernated
+	}
+	return spec.ClusterStatusRunning
+}
@@ -1,21 +1,155 @@
 package cluster
 
 import (
+	"encoding/json"
 	"fmt"
+	"path"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/pkg/api/v1"
 
 	"github.com/zalando-incubator/postgres-operator/pkg/spec"
 	"github.com/zalando-incubator/postgres-operator/pkg/util"
 	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
 	"github.com/zalando-incubator/postgres-operator/pkg/util/filesystems"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/patroni"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/retryutil"
 	"github.com/zalando-incubator/postgres-operator/pkg/util/volumes"
 )
 
+// clusterVolume describes a persistent volume attached to every pod of the cluster
+type clusterVolume struct {
+	name       string
+	mountPath  string
+	volume     spec.Volume
+	tablespace string
+}
+
+// clusterVolumes returns persistent volumes of the cluster pods defined by the manifest, starting with the data volume.
+func clusterVolumes(pgSpec *spec.PostgresSpec) []clusterVolume {
+	result := []clusterVolume{{name: constants.DataVolumeName, mountPath: constants.PostgresDataMount, volume: pgSpec.Volume}}
+	if pgSpec.WALVolume != nil {
+		result = append(result, clusterVolume{name: constants.WALVolumeName, mountPath: constants.PostgresWALMount, volume: *pgSpec.WALVolume})
+	}
+
+	tablespaces := make([]string, 0, len(pgSpec.Tablespaces))
+	for name := range pgSpec.Tablespaces {
+		tablespaces = append(tablespaces, name)
+	}
+	// sort tablespaces to get the same order of volumes in the statefulset every time
+	sort.Strings(tablespaces)
+	for _, name := range tablespaces {
+		result = append(result, clusterVolume{
+			name:       constants.TablespaceVolumeNamePrefix + strings.Replace(name, "_", "-", -1),
+			mountPath:  path.Join(constants.PostgresTablespacesMount, name),
+			volume:     pgSpec.Tablespaces[name],
+			tablespace: name,
+		})
+	}
+
+	return result
+}
+
+// persistentClusterVolumes returns the cluster volumes backed by persistent volume claims, skipping the ephemeral ones.
+func persistentClusterVolumes(pgSpec *spec.PostgresSpec) []clusterVolume {
+	result := make([]clusterVolume, 0)
+	for _, volume := range clusterVolumes(pgSpec) {
+		if !volume.volume.Ephemeral {
+			result = append(result, volume)
+		}
+	}
+
+	return result
+}
+
+// validateVolumeSpec checks the sizes of the persistent volumes in the manifest before any of them is touched:
+// every size must parse to a positive quantity and stay within the configured maximum, and, when oldSpec is
+// given, no volume may shrink unless shrinking is enabled in the operator configuration.
+func (c *Cluster) validateVolumeSpec(oldSpec, newSpec *spec.PostgresSpec) error {
+	var maxSize resource.Quantity
+	if c.OpConfig.MaxVolumeSize != "" {
+		q, err := resource.ParseQuantity(c.OpConfig.MaxVolumeSize)
+		if err != nil {
+			return fmt.Errorf("could not parse maximum volume size: %v", err)
+		}
+		maxSize = q
+	}
+
+	oldVolumes := make(map[string]spec.Volume)
+	if oldSpec != nil {
+		for _, volume := range persistentClusterVolumes(oldSpec) {
+			oldVolumes[volume.name] = volume.volume
+		}
+	}
+
+	for _, volume := range persistentClusterVolumes(newSpec) {
+		if err := validateInstanceSizes(volume.name, volume.volume); err != nil {
+			return err
+		}
+		oldVolume, hasOldVolume := oldVolumes[volume.name]
+		// an empty ordinal stands for the size of the pods without an override
+		for _, ordinal := range instanceOrdinals(volume.volume, oldVolume) {
+			sizeString := instanceSize(volume.volume, ordinal)
+			size, err := resource.ParseQuantity(sizeString)
+			if err != nil {
+				return fmt.Errorf("could not parse size %q of the %q volume: %v", sizeString, volume.name, err)
+			}
+			if size.Sign() <= 0 {
+				return fmt.Errorf("size %q of the %q volume is not positive", sizeString, volume.name)
+			}
+			if !maxSize.IsZero() && size.Cmp(maxSize) > 0 {
+				return fmt.Errorf("size %q of the %q volume exceeds the maximum volume size %q",
+					sizeString, volume.name, c.OpConfig.MaxVolumeSize)
+			}
+			if !hasOldVolume || c.OpConfig.EnableVolumeShrink {
+				continue
+			}
+			oldSize, err := resource.ParseQuantity(instanceSize(oldVolume, ordinal))
+			if err == nil && size.Cmp(oldSize) < 0 {
+				return fmt.Errorf("cannot shrink the %q volume from %q to %q: volume shrinking is disabled",
+					volume.name, oldSize.String(), sizeString)
+			}
+		}
+	}
+
+	return nil
+}
+
+// tablespaceLocation returns the directory of the tablespace inside the volume, as the root of the volume is
+// neither empty nor owned by the postgres user.
+func (v *clusterVolume) tablespaceLocation() string {
+	return path.Join(v.mountPath, constants.TablespaceDataDirectory)
+}
+
+// claimBelongsToVolume checks if the claim has been created by the statefulset from the template with the given volume name.
+func (c *Cluster) claimBelongsToVolume(pvc *v1.PersistentVolumeClaim, volumeName string) bool {
+	prefix := fmt.Sprintf("%s-%s-", volumeName, c.statefulSetName())
+	if !strings.HasPrefix(pvc.Name, prefix) {
+		return false
+	}
+	_, err := strconv.Atoi(pvc.Name[len(prefix):])
+
+	return err == nil
+}
+
+// claimBelongsToPod checks if the claim holds one of the cluster volumes of the given pod.
+func (c *Cluster) claimBelongsToPod(pvc *v1.PersistentVolumeClaim, podName string) bool {
+	for _, volume := range persistentClusterVolumes(&c.Spec) {
+		if pvc.Name == fmt.Sprintf("%s-%s", volume.name, podName) {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *Cluster) listPersistentVolumeClaims() ([]v1.PersistentVolumeClaim, error) {
 	ns := c.Namespace
 	listOptions := metav1.ListOptions{
@@ -29,13 +163,18 @@ func (c *Cluster) listPersistentVolumeClaims() ([]v1.PersistentVolumeClaim, erro
 	return pvcs.Items, nil
 }
 
-func (c *Cluster) deletePersistenVolumeClaims() error {
+// deletePersistenVolumeClaims deletes the claims of the cluster except for the ones of the pod to keep, if any.
+func (c *Cluster) deletePersistenVolumeClaims(keepPodName string) error {
 	c.logger.Debugln("deleting PVCs")
 	pvcs, err := c.listPersistentVolumeClaims()
 	if err != nil {
 		return err
 	}
 	for _, pvc := range pvcs {
+		if keepPodName != "" && c.claimBelongsToPod(&pvc, keepPodName) {
+			c.logger.Infof("retaining PVC %q", util.NameFromMeta(pvc.ObjectMeta))
+			continue
+		}
 		c.logger.Debugf("deleting PVC %q", util.NameFromMeta(pvc.ObjectMeta))
 		if err := c.KubeClient.PersistentVolumeClaims(pvc.Namespace).Delete(pvc.Name, c.deleteOptions); err != nil {
 			c.logger.Warningf("could not delete PersistentVolumeClaim: %v", err)
@@ -50,15 +189,18 @@ func (c *Cluster) deletePersistenVolumeClaims() error {
 	return nil
 }
 
-func (c *Cluster) listPersistentVolumes() ([]*v1.PersistentVolume, error) {
+func (c *Cluster) listPersistentVolumes(volumeName string) ([]*v1.PersistentVolume, error) {
 	result := make([]*v1.PersistentVolume, 0)
 
 	pvcs, err := c.listPersistentVolumeClaims()
 	if err != nil {
 		return nil, fmt.Errorf("could not list cluster's PersistentVolumeClaims: %v", err)
 	}
-	lastPodIndex := *c.Statefulset.Spec.Replicas - 1
+	lastPodIndex := c.statefulSetReplicas() - 1
 	for _, pvc := range pvcs {
+		if !c.claimBelongsToVolume(&pvc, volumeName) {
+			continue
+		}
 		lastDash := strings.LastIndex(pvc.Name, "-")
 		if lastDash > 0 && lastDash < len(pvc.Name)-1 {
 			pvcNumber, err := strconv.Atoi(pvc.Name[lastDash+1:])
@@ -80,105 +222,1187 @@ func (c *Cluster) listPersistentVolumes() ([]*v1.PersistentVolume, error) {
 	return result, nil
 }
 
-// resizeVolumes resize persistent volumes compatible with the given resizer interface
-func (c *Cluster) resizeVolumes(newVolume spec.Volume, resizers []volumes.VolumeResizer) error {
-	c.setProcessName("resizing volumes")
+// volumeResizeTask describes a single persistent volume to be resized or modified via its provider.
+type volumeResizeTask struct {
+	pv      *v1.PersistentVolume
+	resizer volumes.VolumeResizer
+	size    resource.Quantity // the target size of this volume, which may differ per instance
+	resize  bool
+}
 
-	totalCompatible := 0
-	newQuantity, err := resource.ParseQuantity(newVolume.Size)
-	if err != nil {
-		return fmt.Errorf("could not parse volume size: %v", err)
-	}
-	pvs, newSize, err := c.listVolumesWithManifestSize(newVolume)
+// resizeVolumes resize persistent volumes compatible with the given resizer interface. When the manifest
+// defines the type or the performance of the volume, those are changed together with the size.
+func (c *Cluster) resizeVolumes(newVolume clusterVolume, resizers []volumes.VolumeResizer) error {
+	c.setProcessName("resizing %s volumes", newVolume.name)
+
+	pvs, err := c.listPersistentVolumes(newVolume.name)
 	if err != nil {
 		return fmt.Errorf("could not list persistent volumes: %v", err)
 	}
+	modify := volumeModificationRequested(newVolume.volume)
+	tasks := make([]volumeResizeTask, 0, len(pvs))
+	incompatible := make([]string, 0)
 	for _, pv := range pvs {
-		volumeSize := quantityToGigabyte(pv.Spec.Capacity[v1.ResourceStorage])
-		if volumeSize > newSize {
-			return fmt.Errorf("cannot shrink persistent volume")
+		newSize, err := sizeForPersistentVolume(newVolume.volume, pv)
+		if err != nil {
+			return err
 		}
-		if volumeSize == newSize {
+		// provisioners round the size up, so a volume at least as large as requested needs no resize
+		volumeSize := pv.Spec.Capacity[v1.ResourceStorage]
+		resize := volumeSize.Cmp(newSize) < 0
+		if !resize && !modify {
 			continue
 		}
+		if !resize {
+			newSize = volumeSize
+		}
+		compatible := false
 		for _, resizer := range resizers {
 			if !resizer.VolumeBelongsToProvider(pv) {
 				continue
 			}
-			totalCompatible++
+			compatible = true
 			if !resizer.IsConnectedToProvider() {
 				err := resizer.ConnectToProvider()
 				if err != nil {
 					return fmt.Errorf("could not connect to the volume provider: %v", err)
 				}
-				defer func() {
+				defer func(resizer volumes.VolumeResizer) {
 					if err := resizer.DisconnectFromProvider(); err != nil {
 						c.logger.Errorf("%v", err)
 					}
-				}()
+				}(resizer)
 			}
-			awsVolumeID, err := resizer.GetProviderVolumeID(pv)
-			if err != nil {
-				return err
-			}
-			c.logger.Debugf("updating persistent volume %q to %d", pv.Name, newSize)
-			if err := resizer.ResizeVolume(awsVolumeID, newSize); err != nil {
-				return fmt.Errorf("could not resize EBS volume %q: %v", awsVolumeID, err)
+			tasks = append(tasks, volumeResizeTask{pv: pv, resizer: resizer, size: newSize, resize: resize})
+		}
+		if !compatible {
+			incompatible = append(incompatible, pv.Name)
+		}
+	}
+	// volumes that already have the requested size don't need a provider, so they never make the sync fail
+	if len(incompatible) > 0 {
+		c.recordEvent(v1.EventTypeWarning, constants.EventReasonIncompatibleVolumeProvider,
+			"persistent volumes %s can't be resized by any of the supported volume providers", strings.Join(incompatible, ", "))
+		return fmt.Errorf("could not resize volumes: persistent volumes %s are not compatible with existing resizing providers",
+			strings.Join(incompatible, ", "))
+	}
+
+	resize := func(task volumeResizeTask) error {
+		err := c.resizeVolume(task, newVolume)
+		c.setVolumeResizeError(task.pv.Name, err)
+		return err
+	}
+	masterTasks, replicaTasks, err := c.splitVolumeResizeTasks(tasks, newVolume.name)
+	if err != nil {
+		return err
+	}
+
+	// volumes of the replicas are independent from each other, so slow provider operations run concurrently;
+	// a failed resize stops before it reaches the master
+	if err := runVolumeResizeTasks(replicaTasks, int(c.OpConfig.VolumeResizeWorkers), resize); err != nil {
+		return err
+	}
+	if len(masterTasks) == 0 {
+		return nil
+	}
+	if len(replicaTasks) > 0 {
+		if err := c.waitForResizedPodsReady(replicaTasks, newVolume.name); err != nil {
+			return err
+		}
+	}
+	if c.OpConfig.MasterResizeSwitchover {
+		if err := c.switchoverBeforeResize(); err != nil {
+			return err
+		}
+	}
+
+	return runVolumeResizeTasks(masterTasks, int(c.OpConfig.VolumeResizeWorkers), resize)
+}
+
+// splitVolumeResizeTasks separates the volumes of the master from the volumes of the replicas. Without a running
+// master all volumes are treated as replica ones.
+func (c *Cluster) splitVolumeResizeTasks(tasks []volumeResizeTask, volumeName string) (masterTasks, replicaTasks []volumeResizeTask, err error) {
+	masterPods, err := c.getRolePods(Master)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not get master pod: %v", err)
+	}
+	for _, task := range tasks {
+		podName := getPodNameFromPersistentVolume(task.pv, volumeName)
+		if len(masterPods) > 0 && podName.Name == masterPods[0].Name {
+			masterTasks = append(masterTasks, task)
+		} else {
+			replicaTasks = append(replicaTasks, task)
+		}
+	}
+
+	return masterTasks, replicaTasks, nil
+}
+
+// waitForResizedPodsReady makes sure the pods with the resized volumes are running and ready before touching the master.
+func (c *Cluster) waitForResizedPodsReady(tasks []volumeResizeTask, volumeName string) error {
+	return retryutil.Retry(c.OpConfig.ResourceCheckInterval, c.OpConfig.PodLabelWaitTimeout,
+		func() (bool, error) {
+			for _, task := range tasks {
+				podName := getPodNameFromPersistentVolume(task.pv, volumeName)
+				pod, err := c.KubeClient.Pods(podName.Namespace).Get(podName.Name, metav1.GetOptions{})
+				if err != nil {
+					return false, fmt.Errorf("could not get pod %q: %v", podName, err)
+				}
+				if !podIsReady(pod) {
+					c.logger.Debugf("waiting for the pod %q to become ready after the volume resize", podName)
+					return false, nil
+				}
 			}
+			return true, nil
+		})
+}
+
+// podIsReady checks if the pod is running and passes its readiness checks.
+func podIsReady(pod *v1.Pod) bool {
+	if pod.Status.Phase != v1.PodRunning {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// switchoverBeforeResize moves the master role to one of the replicas, so that the volumes of the former
+// master are resized while it is a replica.
+func (c *Cluster) switchoverBeforeResize() error {
+	masterPods, err := c.getRolePods(Master)
+	if err != nil {
+		return fmt.Errorf("could not get master pod: %v", err)
+	}
+	replicaPods, err := c.getRolePods(Replica)
+	if err != nil {
+		return fmt.Errorf("could not get replica pods: %v", err)
+	}
+	if len(masterPods) == 0 || len(replicaPods) == 0 {
+		c.logger.Warningf("no replica to switch over to, resizing the volumes of the master in place")
+		return nil
+	}
+	candidates := make([]spec.NamespacedName, 0)
+	for _, pod := range replicaPods {
+		if podIsReady(&pod) {
+			candidates = append(candidates, util.NameFromMeta(pod.ObjectMeta))
+		}
+	}
+	if len(candidates) == 0 {
+		return fmt.Errorf("could not switch over before resizing the volumes of the master: no replica is ready")
+	}
+	if err := c.ManualFailover(&masterPods[0], masterCandidate(candidates)); err != nil {
+		return fmt.Errorf("could not switch over before resizing the volumes of the master: %v", err)
+	}
+
+	return nil
+}
+
+// resizeVolume changes a single volume via the provider API and grows the filesystem on it. Every completed step is
+// recorded in the annotations of the persistent volume, so that a resize interrupted by the operator restart is
+// resumed from the step that hasn't been done yet.
+func (c *Cluster) resizeVolume(task volumeResizeTask, newVolume clusterVolume) error {
+	var err error
+	pv := task.pv
+	newSize := task.size
+	phase := volumeResizePhase(pv, newSize)
+	if phase != "" {
+		c.logger.Infof("resuming resize of the persistent volume %q after the %s phase", pv.Name, phase)
+	} else {
+		c.recordVolumeEvent(pv, v1.EventTypeNormal, constants.EventReasonVolumeResizeStarted,
+			"resizing persistent volume %q to %s", pv.Name, newSize.String())
+		if err := c.resizeProviderVolume(task, newVolume); err != nil {
+			c.recordVolumeEvent(pv, v1.EventTypeWarning, constants.EventReasonVolumeResizeFailed,
+				"could not resize persistent volume %q: %v", pv.Name, err)
+			return err
+		}
+		if !task.resize {
+			return nil
+		}
+		if pv, err = c.setVolumeResizePhase(pv, newSize, constants.VolumeResizePhaseProviderResized); err != nil {
+			return err
+		}
+	}
+
+	if phase != constants.VolumeResizePhaseFilesystemResized {
+		podName := getPodNameFromPersistentVolume(pv, newVolume.name)
+		// local volumes often share the filesystem of the node, which might be large enough already
+		fsSize, err := c.getPostgresFilesystemBytes(podName, newVolume.mountPath, "size")
+		if err != nil {
+			return fmt.Errorf("could not get size of the filesystem on pod %q: %v", podName, err)
+		}
+		if fsSize >= newSize.Value() {
+			c.logger.Debugf("filesystem on the volume %q is large enough, not resizing it", pv.Name)
+		} else {
 			c.logger.Debugf("resizing the filesystem on the volume %q", pv.Name)
-			podName := getPodNameFromPersistentVolume(pv)
-			if err := c.resizePostgresFilesystem(podName, []filesystems.FilesystemResizer{&filesystems.Ext234Resize{}}); err != nil {
+			if err := c.resizePostgresFilesystem(podName, newVolume.mountPath, []filesystems.FilesystemResizer{&filesystems.Ext234Resize{}}); err != nil {
+				c.recordVolumeEvent(pv, v1.EventTypeWarning, constants.EventReasonFilesystemResizeFailed,
+					"could not grow the filesystem on the persistent volume %q in pod %q: %v", pv.Name, podName, err)
 				return fmt.Errorf("could not resize the filesystem on pod %q: %v", podName, err)
 			}
 			c.logger.Debugf("filesystem resize successful on volume %q", pv.Name)
-			pv.Spec.Capacity[v1.ResourceStorage] = newQuantity
-			c.logger.Debugf("updating persistent volume definition for volume %q", pv.Name)
-			if _, err := c.KubeClient.PersistentVolumes().Update(pv); err != nil {
-				return fmt.Errorf("could not update persistent volume: %q", err)
+		}
+		if pv, err = c.setVolumeResizePhase(pv, newSize, constants.VolumeResizePhaseFilesystemResized); err != nil {
+			return err
+		}
+	}
+
+	pv.Spec.Capacity[v1.ResourceStorage] = newSize
+	delete(pv.Annotations, constants.VolumeResizeTargetSizeAnnotation)
+	delete(pv.Annotations, constants.VolumeResizePhaseAnnotation)
+	if pv.Annotations == nil {
+		pv.Annotations = make(map[string]string)
+	}
+	pv.Annotations[constants.VolumeLastResizeTimeAnnotation] = time.Now().UTC().Format(time.RFC3339)
+	c.logger.Debugf("updating persistent volume definition for volume %q", pv.Name)
+	if _, err := c.KubeClient.PersistentVolumes().Update(pv); err != nil {
+		return fmt.Errorf("could not update persistent volume: %q", err)
+	}
+	c.logger.Debugf("successfully updated persistent volume %q", pv.Name)
+	c.recordVolumeEvent(pv, v1.EventTypeNormal, constants.EventReasonVolumeResized,
+		"persistent volume %q has been resized to %s", pv.Name, newSize.String())
+
+	return nil
+}
+
+// resizeProviderVolume resizes or modifies the volume via the provider API.
+func (c *Cluster) resizeProviderVolume(task volumeResizeTask, newVolume clusterVolume) error {
+	pv := task.pv
+	newSize := task.size
+	providerVolumeID, err := task.resizer.GetProviderVolumeID(pv)
+	if err != nil {
+		return err
+	}
+	if volumeModificationRequested(newVolume.volume) {
+		modifier, ok := task.resizer.(volumes.VolumeModifier)
+		if !ok {
+			return fmt.Errorf("volume provider of the persistent volume %q does not support changing the volume type or performance", pv.Name)
+		}
+		c.logger.Debugf("modifying persistent volume %q", pv.Name)
+		if err := modifier.ModifyVolume(providerVolumeID, newSize.Value(), newVolume.volume); err != nil {
+			return fmt.Errorf("could not modify volume %q: %v", providerVolumeID, err)
+		}
+		return nil
+	}
+	c.logger.Debugf("updating persistent volume %q to %s", pv.Name, newSize.String())
+	if err := task.resizer.ResizeVolume(providerVolumeID, newSize.Value()); err != nil {
+		return fmt.Errorf("could not resize volume %q: %v", providerVolumeID, err)
+	}
+
+	return nil
+}
+
+// volumeResizePhase returns the last completed phase of the interrupted resize of the volume to the given size.
+func volumeResizePhase(pv *v1.PersistentVolume, newSize resource.Quantity) string {
+	if pv.Annotations[constants.VolumeResizeTargetSizeAnnotation] != strconv.FormatInt(newSize.Value(), 10) {
+		return ""
+	}
+	return pv.Annotations[constants.VolumeResizePhaseAnnotation]
+}
+
+func (c *Cluster) setVolumeResizePhase(pv *v1.PersistentVolume, newSize resource.Quantity, phase string) (*v1.PersistentVolume, error) {
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q,%q:%q}}}`,
+		constants.VolumeResizeTargetSizeAnnotation, strconv.FormatInt(newSize.Value(), 10),
+		constants.VolumeResizePhaseAnnotation, phase)
+	result, err := c.KubeClient.PersistentVolumes().Patch(pv.Name, types.MergePatchType, []byte(patch))
+	if err != nil {
+		return nil, fmt.Errorf("could not save the resize phase of the persistent volume %q: %v", pv.Name, err)
+	}
+	return result, nil
+}
+
+// runVolumeResizeTasks runs the tasks on at most the given number of workers. Failures don't stop the remaining
+// tasks; the errors of all failed ones are combined into the returned error.
+func runVolumeResizeTasks(tasks []volumeResizeTask, workers int, run func(volumeResizeTask) error) error {
+	if workers <= 0 || workers > len(tasks) {
+		workers = len(tasks)
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed []string
+	)
+	taskCh := make(chan volumeResizeTask)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range taskCh {
+				if err := run(task); err != nil {
+					mu.Lock()
+					failed = append(failed, fmt.Sprintf("%s: %v", task.pv.Name, err))
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, task := range tasks {
+		taskCh <- task
+	}
+	close(taskCh)
+	wg.Wait()
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("could not resize %d of %d volumes: %s", len(failed), len(tasks), strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// volumeClaimsExpandable checks if the storage classes of all claims for the given volume allow volume expansion.
+func (c *Cluster) volumeClaimsExpandable(pvcs []v1.PersistentVolumeClaim, volumeName string) (bool, error) {
+	checked := make(map[string]bool)
+	for _, pvc := range pvcs {
+		if !c.claimBelongsToVolume(&pvc, volumeName) {
+			continue
+		}
+		storageClass := getStorageClassName(&pvc)
+		if storageClass == "" {
+			return false, nil
+		}
+		expandable, ok := checked[storageClass]
+		if !ok {
+			var err error
+			if expandable, err = k8sutil.StorageClassAllowsExpansion(c.KubeClient.StorageRESTClient, storageClass); err != nil {
+				return false, err
 			}
-			c.logger.Debugf("successfully updated persistent volume %q", pv.Name)
+			checked[storageClass] = expandable
+		}
+		if !expandable {
+			return false, nil
+		}
+	}
+	return len(checked) > 0, nil
+}
+
+// providerVolumesResizable checks if the volume providers can resize the persistent volumes of the given volume right
+// now, i.e. Azure refuses to resize the managed disks attached to the nodes.
+func (c *Cluster) providerVolumesResizable(volumeName string, resizers []volumes.VolumeResizer) (bool, error) {
+	pvs, err := c.listPersistentVolumes(volumeName)
+	if err != nil {
+		return false, fmt.Errorf("could not list persistent volumes: %v", err)
+	}
+	for _, pv := range pvs {
+		for _, resizer := range resizers {
+			if !resizer.VolumeBelongsToProvider(pv) {
+				continue
+			}
+			checker, ok := resizer.(volumes.VolumeResizabilityChecker)
+			if !ok {
+				break
+			}
+			if !resizer.IsConnectedToProvider() {
+				if err := resizer.ConnectToProvider(); err != nil {
+					return false, fmt.Errorf("could not connect to the volume provider: %v", err)
+				}
+				defer func(resizer volumes.VolumeResizer) {
+					if err := resizer.DisconnectFromProvider(); err != nil {
+						c.logger.Errorf("%v", err)
+					}
+				}(resizer)
+			}
+			providerVolumeID, err := resizer.GetProviderVolumeID(pv)
+			if err != nil {
+				return false, err
+			}
+			resizable, err := checker.VolumeResizable(providerVolumeID)
+			if err != nil {
+				return false, fmt.Errorf("could not check if the volume %q is resizable: %v", providerVolumeID, err)
+			}
+			if !resizable {
+				c.logger.Debugf("persistent volume %q can't be resized by the volume provider", pv.Name)
+				return false, nil
+			}
+			break
+		}
+	}
+	return true, nil
+}
+
+// expandPersistentVolumeClaims requests the new size in the persistent volume claims, leaving
+// resizing of the volumes and filesystems to Kubernetes.
+func (c *Cluster) expandPersistentVolumeClaims(pvcs []v1.PersistentVolumeClaim, newVolume clusterVolume) error {
+	c.setProcessName("expanding persistent volume claims of %s volumes", newVolume.name)
+
+	for _, pvc := range pvcs {
+		if !c.claimBelongsToVolume(&pvc, newVolume.name) {
+			continue
+		}
+		newQuantity, err := sizeForClaim(newVolume.volume, pvc.Name)
+		if err != nil {
+			return err
+		}
+		currentQuantity := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+		switch currentQuantity.Cmp(newQuantity) {
+		case 1:
+			return fmt.Errorf("cannot shrink persistent volume claim %q", util.NameFromMeta(pvc.ObjectMeta))
+		case 0:
+			continue
+		}
+		patchData, err := specPatch(v1.PersistentVolumeClaimSpec{
+			Resources: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceStorage: newQuantity}},
+		})
+		if err != nil {
+			return fmt.Errorf("could not form patch for the persistent volume claims: %v", err)
+		}
+		c.logger.Debugf("updating persistent volume claim %q to %s", util.NameFromMeta(pvc.ObjectMeta), newQuantity.String())
+		if _, err := c.KubeClient.PersistentVolumeClaims(pvc.Namespace).Patch(pvc.Name, types.MergePatchType, patchData); err != nil {
+			return fmt.Errorf("could not patch persistent volume claim %q: %v", util.NameFromMeta(pvc.ObjectMeta), err)
 		}
 	}
-	if len(pvs) > 0 && totalCompatible == 0 {
-		return fmt.Errorf("could not resize EBS volumes: persistent volumes are not compatible with existing resizing providers")
+	return nil
+}
+
+// snapshotVolumes takes provider snapshots of the volumes that are about to be resized,
+// so that a failed resize could be rolled back manually. The snapshot is recorded in the annotations
+// of the persistent volume, so that it is taken only once per target size, and replaces the previous one.
+func (c *Cluster) snapshotVolumes(newVolume clusterVolume, resizers []volumes.VolumeResizer) error {
+	c.setProcessName("taking snapshots of %s volumes", newVolume.name)
+
+	pvs, err := c.listPersistentVolumes(newVolume.name)
+	if err != nil {
+		return fmt.Errorf("could not list persistent volumes: %v", err)
+	}
+	for _, pv := range pvs {
+		newSize, err := sizeForPersistentVolume(newVolume.volume, pv)
+		if err != nil {
+			return err
+		}
+		if volumeSize := pv.Spec.Capacity[v1.ResourceStorage]; volumeSize.Cmp(newSize) >= 0 {
+			continue
+		}
+		if volumeResizePhase(pv, newSize) != "" ||
+			pv.Annotations[constants.PreResizeSnapshotSizeAnnotation] == strconv.FormatInt(newSize.Value(), 10) {
+			// the snapshot has been taken before the pending resize started
+			continue
+		}
+		snapshotID := ""
+		previousSnapshotID := pv.Annotations[constants.PreResizeSnapshotAnnotation]
+		for _, resizer := range resizers {
+			if !resizer.VolumeBelongsToProvider(pv) {
+				continue
+			}
+			snapshotter, ok := resizer.(volumes.VolumeSnapshotter)
+			if !ok {
+				return fmt.Errorf("volume provider of the persistent volume %q does not support snapshots", pv.Name)
+			}
+			if !resizer.IsConnectedToProvider() {
+				if err := resizer.ConnectToProvider(); err != nil {
+					return fmt.Errorf("could not connect to the volume provider: %v", err)
+				}
+				defer func(resizer volumes.VolumeResizer) {
+					if err := resizer.DisconnectFromProvider(); err != nil {
+						c.logger.Errorf("%v", err)
+					}
+				}(resizer)
+			}
+			providerVolumeID, err := resizer.GetProviderVolumeID(pv)
+			if err != nil {
+				return err
+			}
+			description := fmt.Sprintf("snapshot of %s taken before resizing it to %s", pv.Name, newSize.String())
+			if snapshotID, err = snapshotter.SnapshotVolume(providerVolumeID, description); err != nil {
+				return fmt.Errorf("could not take snapshot of the volume %q: %v", providerVolumeID, err)
+			}
+			if _, err := c.setPreResizeSnapshot(pv, newSize, snapshotID); err != nil {
+				return err
+			}
+			if previousSnapshotID != "" && previousSnapshotID != snapshotID {
+				if err := snapshotter.DeleteSnapshot(previousSnapshotID); err != nil {
+					c.logger.Warningf("could not delete previous snapshot of the persistent volume %q: %v", pv.Name, err)
+				} else {
+					c.logger.Infof("deleted previous snapshot %q of the persistent volume %q", previousSnapshotID, pv.Name)
+				}
+			}
+			break
+		}
+		if snapshotID == "" {
+			return fmt.Errorf("could not take snapshot of the persistent volume %q: no compatible volume provider", pv.Name)
+		}
+		c.logger.Infof("took snapshot %q of the persistent volume %q", snapshotID, pv.Name)
+		c.recordVolumeEvent(pv, v1.EventTypeNormal, constants.EventReasonVolumeSnapshotTaken,
+			"took snapshot %q of the persistent volume %q before resizing it", snapshotID, pv.Name)
+		c.setVolumeSnapshot(pv.Name, snapshotID)
 	}
+
 	return nil
 }
 
-func (c *Cluster) volumesNeedResizing(newVolume spec.Volume) (bool, error) {
-	vols, manifestSize, err := c.listVolumesWithManifestSize(newVolume)
+func (c *Cluster) setPreResizeSnapshot(pv *v1.PersistentVolume, newSize resource.Quantity, snapshotID string) (*v1.PersistentVolume, error) {
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q,%q:%q,%q:%q}}}`,
+		constants.PreResizeSnapshotAnnotation, snapshotID,
+		constants.PreResizeSnapshotSizeAnnotation, strconv.FormatInt(newSize.Value(), 10),
+		constants.PreResizeSnapshotTimeAnnotation, time.Now().UTC().Format(time.RFC3339))
+	result, err := c.KubeClient.PersistentVolumes().Patch(pv.Name, types.MergePatchType, []byte(patch))
 	if err != nil {
-		return false, err
+		return nil, fmt.Errorf("could not record snapshot %q of the persistent volume %q: %v", snapshotID, pv.Name, err)
+	}
+	return result, nil
+}
+
+func (c *Cluster) setVolumeSnapshot(pvName, snapshotID string) {
+	c.volumeSnapshotsMu.Lock()
+	defer c.volumeSnapshotsMu.Unlock()
+	c.volumeSnapshots[pvName] = snapshotID
+}
+
+// GetVolumeSnapshots returns the latest snapshots taken before resizing persistent volumes of the cluster
+func (c *Cluster) GetVolumeSnapshots() map[string]string {
+	c.volumeSnapshotsMu.RLock()
+	defer c.volumeSnapshotsMu.RUnlock()
+
+	result := make(map[string]string, len(c.volumeSnapshots))
+	for pvName, snapshotID := range c.volumeSnapshots {
+		result[pvName] = snapshotID
+	}
+	return result
+}
+
+// volumeModificationRequested checks if the manifest defines the type or the performance of the volume.
+func volumeModificationRequested(volume spec.Volume) bool {
+	return volume.StorageType != "" || volume.Iops != nil || volume.Throughput != nil
+}
+
+// volumesNeedModification asks the volume provider if the type or the performance of any volume differs from the manifest.
+func (c *Cluster) volumesNeedModification(newVolume clusterVolume, resizers []volumes.VolumeResizer) (bool, error) {
+	if !volumeModificationRequested(newVolume.volume) {
+		return false, nil
+	}
+	pvs, err := c.listPersistentVolumes(newVolume.name)
+	if err != nil {
+		return false, fmt.Errorf("could not list persistent volumes: %v", err)
+	}
+	for _, pv := range pvs {
+		for _, resizer := range resizers {
+			if !resizer.VolumeBelongsToProvider(pv) {
+				continue
+			}
+			modifier, ok := resizer.(volumes.VolumeModifier)
+			if !ok {
+				return false, fmt.Errorf("volume provider of the persistent volume %q does not support changing the volume type or performance", pv.Name)
+			}
+			if !resizer.IsConnectedToProvider() {
+				if err := resizer.ConnectToProvider(); err != nil {
+					return false, fmt.Errorf("could not connect to the volume provider: %v", err)
+				}
+				defer func(resizer volumes.VolumeResizer) {
+					if err := resizer.DisconnectFromProvider(); err != nil {
+						c.logger.Errorf("%v", err)
+					}
+				}(resizer)
+			}
+			providerVolumeID, err := resizer.GetProviderVolumeID(pv)
+			if err != nil {
+				return false, err
+			}
+			needsModification, err := modifier.VolumeNeedsModification(providerVolumeID, newVolume.volume)
+			if err != nil {
+				return false, fmt.Errorf("could not check volume %q: %v", providerVolumeID, err)
+			}
+			if needsModification {
+				return true, nil
+			}
+			break
+		}
+	}
+	return false, nil
+}
+
+func (c *Cluster) volumesNeedResizing(newVolume clusterVolume) (bool, error) {
+	vols, err := c.listPersistentVolumes(newVolume.name)
+	if err != nil {
+		return false, fmt.Errorf("could not list persistent volumes: %v", err)
 	}
 	for _, pv := range vols {
-		currentSize := quantityToGigabyte(pv.Spec.Capacity[v1.ResourceStorage])
-		if currentSize != manifestSize {
+		// the snapshots recorded on the volumes survive restarts of the operator
+		if snapshotID := pv.Annotations[constants.PreResizeSnapshotAnnotation]; snapshotID != "" {
+			c.setVolumeSnapshot(pv.Name, snapshotID)
+		}
+		manifestSize, err := sizeForPersistentVolume(newVolume.volume, pv)
+		if err != nil {
+			return false, err
+		}
+		// provisioners round the size up, so only volumes smaller than in the manifest need resizing
+		currentSize := pv.Spec.Capacity[v1.ResourceStorage]
+		if currentSize.Cmp(manifestSize) < 0 {
 			return true, nil
 		}
 	}
 	return false, nil
 }
 
-func (c *Cluster) listVolumesWithManifestSize(newVolume spec.Volume) ([]*v1.PersistentVolume, int64, error) {
-	newSize, err := resource.ParseQuantity(newVolume.Size)
+// volumesNeedShrinking checks if any of the claims requests more than the size in the manifest. The capacity of the
+// volumes is not compared, as it is often rounded up by the provisioner.
+func (c *Cluster) volumesNeedShrinking(newVolume clusterVolume) (bool, error) {
+	pvcs, err := c.listPersistentVolumeClaims()
 	if err != nil {
-		return nil, 0, fmt.Errorf("could not parse volume size from the manifest: %v", err)
+		return false, fmt.Errorf("could not list persistent volume claims: %v", err)
 	}
-	manifestSize := quantityToGigabyte(newSize)
-	vols, err := c.listPersistentVolumes()
-	if err != nil {
-		return nil, 0, fmt.Errorf("could not list persistent volumes: %v", err)
+	for _, pvc := range pvcs {
+		if !c.claimBelongsToVolume(&pvc, newVolume.name) {
+			continue
+		}
+		manifestSize, err := sizeForClaim(newVolume.volume, pvc.Name)
+		if err != nil {
+			return false, err
+		}
+		if currentSize := pvc.Spec.Resources.Requests[v1.ResourceStorage]; currentSize.Cmp(manifestSize) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// getStorageClassName returns the storage class of the persistent volume claim, preferring the beta annotation.
+func getStorageClassName(pvc *v1.PersistentVolumeClaim) string {
+	if storageClass, ok := pvc.Annotations[constants.VolumeStorageClassAnnotation]; ok {
+		return storageClass
+	}
+	if pvc.Spec.StorageClassName != nil {
+		return *pvc.Spec.StorageClassName
 	}
-	return vols, manifestSize, nil
+	return ""
 }
 
 // getPodNameFromPersistentVolume returns a pod name that it extracts from the volume claim ref.
-func getPodNameFromPersistentVolume(pv *v1.PersistentVolume) *spec.NamespacedName {
+func getPodNameFromPersistentVolume(pv *v1.PersistentVolume, volumeName string) *spec.NamespacedName {
 	namespace := pv.Spec.ClaimRef.Namespace
-	name := pv.Spec.ClaimRef.Name[len(constants.DataVolumeName)+1:]
+	name := pv.Spec.ClaimRef.Name[len(volumeName)+1:]
 	return &spec.NamespacedName{Namespace: namespace, Name: name}
 }
 
-func quantityToGigabyte(q resource.Quantity) int64 {
-	return q.ScaledValue(0) / (1 * constants.Gigabyte)
+// volumeResizers returns the resizers enabled in the operator configuration, in the configured order
+func (c *Cluster) volumeResizers() ([]volumes.VolumeResizer, error) {
+	resizers, err := volumes.NewResizers(c.OpConfig.VolumeResizers, volumes.ResizerOptions{
+		SecretsGetter: c.KubeClient,
+		Config:        &c.OpConfig,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create volume resizers (registered are %s): %v",
+			strings.Join(volumes.RegisteredResizers(), ", "), err)
+	}
+	return resizers, nil
+}
+
+// checkStorageClassEncryption makes sure the storage classes of all cluster volumes provision encrypted volumes,
+// with the key from the operator configuration if one is set.
+func (c *Cluster) checkStorageClassEncryption() error {
+	for _, volume := range persistentClusterVolumes(&c.Spec) {
+		var (
+			storageClass *k8sutil.StorageClass
+			err          error
+		)
+		if volume.volume.StorageClass != "" {
+			storageClass, err = k8sutil.GetStorageClass(c.KubeClient.StorageRESTClient, volume.volume.StorageClass)
+		} else {
+			storageClass, err = k8sutil.GetDefaultStorageClass(c.KubeClient.StorageRESTClient)
+		}
+		if err != nil {
+			return err
+		}
+		if storageClass == nil {
+			return fmt.Errorf("%s volume has no storage class and there is no default storage class", volume.name)
+		}
+		encrypted, keyID := volumes.StorageClassEncryption(storageClass.Provisioner, storageClass.Parameters)
+		if !encrypted {
+			return fmt.Errorf("storage class %q of the %s volume does not provision encrypted volumes", storageClass.Name, volume.name)
+		}
+		if c.OpConfig.VolumeEncryptionKey != "" && keyID == "" {
+			return fmt.Errorf("storage class %q of the %s volume does not set the encryption key", storageClass.Name, volume.name)
+		}
+		if !volumes.KeyMatches(c.OpConfig.VolumeEncryptionKey, keyID) {
+			return fmt.Errorf("storage class %q of the %s volume uses the encryption key %q instead of %q",
+				storageClass.Name, volume.name, keyID, c.OpConfig.VolumeEncryptionKey)
+		}
+	}
+
+	return nil
+}
+
+// syncVolumeEncryption asks the volume providers if the persistent volumes of the cluster are encrypted
+// with the expected key and remembers the ones that are not.
+func (c *Cluster) syncVolumeEncryption() error {
+	c.setProcessName("checking encryption of persistent volumes")
+
+	violations := make([]string, 0)
+	resizers, err := c.volumeResizers()
+	if err != nil {
+		return err
+	}
+	for _, volume := range persistentClusterVolumes(&c.Spec) {
+		pvs, err := c.listPersistentVolumes(volume.name)
+		if err != nil {
+			return fmt.Errorf("could not list persistent volumes: %v", err)
+		}
+		for _, pv := range pvs {
+			for _, resizer := range resizers {
+				if !resizer.VolumeBelongsToProvider(pv) {
+					continue
+				}
+				checker, ok := resizer.(volumes.VolumeEncryptionChecker)
+				if !ok {
+					c.logger.Debugf("cannot check encryption of the persistent volume %q: not supported by the volume provider", pv.Name)
+					break
+				}
+				if !resizer.IsConnectedToProvider() {
+					if err := resizer.ConnectToProvider(); err != nil {
+						return fmt.Errorf("could not connect to the volume provider: %v", err)
+					}
+					defer func(resizer volumes.VolumeResizer) {
+						if err := resizer.DisconnectFromProvider(); err != nil {
+							c.logger.Errorf("%v", err)
+						}
+					}(resizer)
+				}
+				providerVolumeID, err := resizer.GetProviderVolumeID(pv)
+				if err != nil {
+					return err
+				}
+				encrypted, keyID, err := checker.VolumeEncryption(providerVolumeID)
+				if err != nil {
+					return fmt.Errorf("could not get encryption of the volume %q: %v", providerVolumeID, err)
+				}
+				if !encrypted {
+					violations = append(violations, fmt.Sprintf("persistent volume %q is not encrypted", pv.Name))
+				} else if keyID == "" && c.OpConfig.VolumeEncryptionKey != "" {
+					violations = append(violations, fmt.Sprintf("persistent volume %q is not encrypted with a customer-managed key", pv.Name))
+				} else if !volumes.KeyMatches(c.OpConfig.VolumeEncryptionKey, keyID) {
+					violations = append(violations, fmt.Sprintf("persistent volume %q is encrypted with the key %q", pv.Name, keyID))
+				}
+				break
+			}
+		}
+	}
+	for _, violation := range violations {
+		c.logger.Warningf("volume encryption policy violated: %s", violation)
+	}
+	c.setEncryptionViolations(violations)
+
+	return nil
+}
+
+// volumeTags returns the tags of the provider volumes: the ones from the operator configuration, the cluster and the
+// team names, and the ones from the manifest, the latter taking precedence.
+func (c *Cluster) volumeTags(volume spec.Volume) map[string]string {
+	tags := make(map[string]string, len(c.OpConfig.VolumeTags)+len(volume.Tags)+2)
+	for key, value := range c.OpConfig.VolumeTags {
+		tags[key] = value
+	}
+	tags[constants.VolumeTagCluster] = c.Name
+	if c.Spec.TeamID != "" {
+		tags[constants.VolumeTagTeam] = c.Spec.TeamID
+	}
+	for key, value := range volume.Tags {
+		tags[key] = value
+	}
+	return tags
+}
+
+// syncVolumeTags applies the tags to the provider volumes, so that the cost of the storage can be attributed to
+// the cluster. Tagging is only done when tags are defined in the operator configuration or in the manifest.
+func (c *Cluster) syncVolumeTags() error {
+	c.setProcessName("tagging persistent volumes")
+
+	resizers, err := c.volumeResizers()
+	if err != nil {
+		return err
+	}
+	for _, volume := range persistentClusterVolumes(&c.Spec) {
+		if len(c.OpConfig.VolumeTags) == 0 && len(volume.volume.Tags) == 0 {
+			continue
+		}
+		tags := c.volumeTags(volume.volume)
+		pvs, err := c.listPersistentVolumes(volume.name)
+		if err != nil {
+			return fmt.Errorf("could not list persistent volumes: %v", err)
+		}
+		for _, pv := range pvs {
+			for _, resizer := range resizers {
+				if !resizer.VolumeBelongsToProvider(pv) {
+					continue
+				}
+				tagger, ok := resizer.(volumes.VolumeTagger)
+				if !ok {
+					c.logger.Debugf("cannot tag the persistent volume %q: not supported by the volume provider", pv.Name)
+					break
+				}
+				if !resizer.IsConnectedToProvider() {
+					if err := resizer.ConnectToProvider(); err != nil {
+						return fmt.Errorf("could not connect to the volume provider: %v", err)
+					}
+					defer func(resizer volumes.VolumeResizer) {
+						if err := resizer.DisconnectFromProvider(); err != nil {
+							c.logger.Errorf("%v", err)
+						}
+					}(resizer)
+				}
+				providerVolumeID, err := resizer.GetProviderVolumeID(pv)
+				if err != nil {
+					return err
+				}
+				if err := tagger.TagVolume(providerVolumeID, tags); err != nil {
+					return fmt.Errorf("could not tag the persistent volume %q: %v", pv.Name, err)
+				}
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *Cluster) setEncryptionViolations(violations []string) {
+	c.encryptionViolationsMu.Lock()
+	defer c.encryptionViolationsMu.Unlock()
+	c.encryptionViolations = violations
+}
+
+// GetEncryptionViolations returns the persistent volumes found violating the encryption policy during the last sync
+func (c *Cluster) GetEncryptionViolations() []string {
+	c.encryptionViolationsMu.RLock()
+	defer c.encryptionViolationsMu.RUnlock()
+
+	result := make([]string, len(c.encryptionViolations))
+	copy(result, c.encryptionViolations)
+	return result
+}
+
+// syncVolumeStorageClasses moves the volumes of the pods onto the storage class from the manifest, one pod per sync.
+// The claims of the pod are deleted together with the pod, so that the statefulset provisions new ones from the
+// updated templates and Patroni rebuilds the instance as a replica. Replicas are migrated first, then the master
+// switches over to a migrated replica and is rebuilt as well.
+func (c *Cluster) syncVolumeStorageClasses() error {
+	pvcs, err := c.listPersistentVolumeClaims()
+	if err != nil {
+		return fmt.Errorf("could not list persistent volume claims: %v", err)
+	}
+	podsToMigrate := make(map[string]bool)
+	for _, volume := range persistentClusterVolumes(&c.Spec) {
+		if volume.volume.StorageClass == "" {
+			continue
+		}
+		if !c.volumeClaimTemplateHasStorageClass(volume.name, volume.volume.StorageClass) {
+			c.logger.Debugf("statefulset has not been updated with the new storage class of the %s volume yet", volume.name)
+			return nil
+		}
+		for _, pvc := range pvcs {
+			if !c.claimBelongsToVolume(&pvc, volume.name) || getStorageClassName(&pvc) == volume.volume.StorageClass {
+				continue
+			}
+			podsToMigrate[pvc.Name[len(volume.name)+1:]] = true
+		}
+	}
+	if len(podsToMigrate) == 0 {
+		return nil
+	}
+	c.setProcessName("migrating volumes to the new storage class")
+
+	return c.rebuildPodsOnNewVolumes(podsToMigrate)
+}
+
+// syncVolumeClaimMetadata adds the labels and annotations from the manifest to the existing persistent volume claims.
+// The statefulset stamps them only on the claims it creates, so the claims of the running pods are patched here.
+// Labels and annotations removed from the manifest are left on the claims.
+func (c *Cluster) syncVolumeClaimMetadata() error {
+	pvcs, err := c.listPersistentVolumeClaims()
+	if err != nil {
+		return fmt.Errorf("could not list persistent volume claims: %v", err)
+	}
+	for _, volume := range persistentClusterVolumes(&c.Spec) {
+		if len(volume.volume.Labels) == 0 && len(volume.volume.Annotations) == 0 {
+			continue
+		}
+		for _, pvc := range pvcs {
+			if !c.claimBelongsToVolume(&pvc, volume.name) {
+				continue
+			}
+			labels := missingMetadata(pvc.Labels, volume.volume.Labels)
+			annotations := missingMetadata(pvc.Annotations, volume.volume.Annotations)
+			if len(labels) == 0 && len(annotations) == 0 {
+				continue
+			}
+			patch, err := json.Marshal(map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": labels, "annotations": annotations},
+			})
+			if err != nil {
+				return fmt.Errorf("could not marshal metadata of the persistent volume claim %q: %v", pvc.Name, err)
+			}
+			if _, err := c.KubeClient.PersistentVolumeClaims(pvc.Namespace).Patch(pvc.Name, types.MergePatchType, patch); err != nil {
+				return fmt.Errorf("could not patch persistent volume claim %q: %v", pvc.Name, err)
+			}
+			c.logger.Infof("labels and annotations of the persistent volume claim %q have been updated", pvc.Name)
+		}
+	}
+
+	return nil
+}
+
+// missingMetadata returns the entries of the desired map that are absent or different in the current one.
+func missingMetadata(current, desired map[string]string) map[string]string {
+	result := make(map[string]string)
+	for key, value := range desired {
+		if current[key] != value {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+// syncVolumeShrink rebuilds the pods whose claims request more storage than the manifest, so that they come back
+// on smaller volumes provisioned from the claim templates of the statefulset. Replicas are reinitialized by Patroni
+// from the master; the master is rebuilt last, after switching over to a rebuilt replica.
+func (c *Cluster) syncVolumeShrink() error {
+	if !c.OpConfig.EnableVolumeShrink || !c.inMaintenanceWindow() {
+		return nil
+	}
+	pvcs, err := c.listPersistentVolumeClaims()
+	if err != nil {
+		return fmt.Errorf("could not list persistent volume claims: %v", err)
+	}
+	podsToShrink := make(map[string]bool)
+	shrunkVolumes := make([]clusterVolume, 0)
+	// the smallest new size among the shrunk claims of every volume
+	shrunkSizes := make(map[string]resource.Quantity)
+	for _, volume := range persistentClusterVolumes(&c.Spec) {
+		templateSize, err := resource.ParseQuantity(volume.volume.Size)
+		if err != nil {
+			return fmt.Errorf("could not parse size of the %s volume: %v", volume.name, err)
+		}
+		if !c.volumeClaimTemplateHasSize(volume.name, templateSize) {
+			c.logger.Debugf("statefulset has not been updated with the new size of the %s volume yet", volume.name)
+			return nil
+		}
+		for _, pvc := range pvcs {
+			if !c.claimBelongsToVolume(&pvc, volume.name) {
+				continue
+			}
+			newSize, err := sizeForClaim(volume.volume, pvc.Name)
+			if err != nil {
+				return err
+			}
+			size := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+			if size.Cmp(newSize) <= 0 {
+				continue
+			}
+			podsToShrink[pvc.Name[len(volume.name)+1:]] = true
+			smallest, shrunk := shrunkSizes[volume.name]
+			if !shrunk {
+				shrunkVolumes = append(shrunkVolumes, volume)
+			}
+			if !shrunk || newSize.Cmp(smallest) < 0 {
+				shrunkSizes[volume.name] = newSize
+			}
+		}
+	}
+	if len(podsToShrink) == 0 {
+		return nil
+	}
+	c.setProcessName("shrinking volumes")
+
+	if err := c.checkShrunkVolumesFit(shrunkVolumes, shrunkSizes); err != nil {
+		return err
+	}
+
+	return c.rebuildPodsOnNewVolumes(podsToShrink)
+}
+
+// checkShrunkVolumesFit makes sure the data on the master fits into the smaller volumes, otherwise
+// the rebuilt replicas would never finish the base backup.
+func (c *Cluster) checkShrunkVolumesFit(shrunkVolumes []clusterVolume, newSizes map[string]resource.Quantity) error {
+	masterPods, err := c.getRolePods(Master)
+	if err != nil {
+		return fmt.Errorf("could not get master pod: %v", err)
+	}
+	if len(masterPods) == 0 {
+		return fmt.Errorf("could not shrink volumes: no master pod is running")
+	}
+	podName := util.NameFromMeta(masterPods[0].ObjectMeta)
+	for _, volume := range shrunkVolumes {
+		newSize := newSizes[volume.name]
+		used, err := c.getPostgresFilesystemBytes(&podName, volume.mountPath, "used")
+		if err != nil {
+			return fmt.Errorf("could not get used space of the %s volume: %v", volume.name, err)
+		}
+		if used >= newSize.Value() {
+			return fmt.Errorf("could not shrink the %s volume: %d bytes are in use, more than the new size %s",
+				volume.name, used, newSize.String())
+		}
+	}
+
+	return nil
+}
+
+// volumeClaimTemplateHasSize checks if the claim template of the current statefulset requests the given size.
+func (c *Cluster) volumeClaimTemplateHasSize(volumeName string, size resource.Quantity) bool {
+	if c.Statefulset == nil {
+		return false
+	}
+	for i := range c.Statefulset.Spec.VolumeClaimTemplates {
+		template := &c.Statefulset.Spec.VolumeClaimTemplates[i]
+		if template.Name == volumeName {
+			templateSize := template.Spec.Resources.Requests[v1.ResourceStorage]
+			return templateSize.Cmp(size) == 0
+		}
+	}
+	return false
+}
+
+// rebuildPodsOnNewVolumes rebuilds one of the given pods on new volumes per call: replicas go first, then
+// the operator switches over to a healthy replica and rebuilds the former master.
+func (c *Cluster) rebuildPodsOnNewVolumes(podsToRebuild map[string]bool) error {
+	masterPods, err := c.getRolePods(Master)
+	if err != nil {
+		return fmt.Errorf("could not get master pod: %v", err)
+	}
+	replicaPods, err := c.getRolePods(Replica)
+	if err != nil {
+		return fmt.Errorf("could not get replica pods: %v", err)
+	}
+	if len(masterPods) == 0 {
+		return fmt.Errorf("could not rebuild pods: no master pod is running")
+	}
+	if len(replicaPods) == 0 {
+		c.logger.Warningf("cannot move the single-instance cluster to new volumes without losing data")
+		return nil
+	}
+
+	for _, pod := range replicaPods {
+		if podsToRebuild[pod.Name] {
+			return c.migratePodVolumes(util.NameFromMeta(pod.ObjectMeta))
+		}
+	}
+
+	masterPod := &masterPods[0]
+	if !podsToRebuild[masterPod.Name] {
+		return nil
+	}
+	members, err := c.patroni.GetClusterMembers(masterPod)
+	if err != nil {
+		return fmt.Errorf("could not get the members of the cluster: %v", err)
+	}
+	healthy := healthyReplicas(members, c.maximumLagOnFailover())
+	candidates := make([]spec.NamespacedName, 0)
+	for _, pod := range replicaPods {
+		if healthy[pod.Name] {
+			candidates = append(candidates, util.NameFromMeta(pod.ObjectMeta))
+		}
+	}
+	if len(candidates) == 0 {
+		return fmt.Errorf("could not switch over before rebuilding the master: no replica is running with the lag below %d bytes",
+			c.maximumLagOnFailover())
+	}
+	if err := c.ManualFailover(masterPod, masterCandidate(candidates)); err != nil {
+		return fmt.Errorf("could not switch over before rebuilding the master: %v", err)
+	}
+
+	return c.migratePodVolumes(util.NameFromMeta(masterPod.ObjectMeta))
+}
+
+// healthyReplicas returns the names of the replicas safe to switch over to: running and lagging behind the master
+// by no more than the given number of bytes.
+func healthyReplicas(members []patroni.ClusterMember, maxLag int64) map[string]bool {
+	result := make(map[string]bool)
+	for _, member := range members {
+		if member.Role != patroniRoleReplica && member.Role != patroniRoleSyncStandby {
+			continue
+		}
+		if member.State != patroniStateRunning && member.State != patroniStateStreaming {
+			continue
+		}
+		if member.Lag < 0 || int64(member.Lag) > maxLag {
+			continue
+		}
+		result[member.Name] = true
+	}
+	return result
+}
+
+// maximumLagOnFailover returns the lag in bytes above which patroni refuses to promote a replica.
+func (c *Cluster) maximumLagOnFailover() int64 {
+	if c.Spec.Patroni.MaximumLagOnFailover > 0 {
+		return int64(c.Spec.Patroni.MaximumLagOnFailover)
+	}
+	return constants.PatroniDefaultMaximumLagOnFailover
+}
+
+// volumeClaimTemplateHasStorageClass checks if the claim template of the current statefulset uses the given storage class.
+func (c *Cluster) volumeClaimTemplateHasStorageClass(volumeName, storageClass string) bool {
+	if c.Statefulset == nil {
+		return false
+	}
+	for i := range c.Statefulset.Spec.VolumeClaimTemplates {
+		template := &c.Statefulset.Spec.VolumeClaimTemplates[i]
+		if template.Name == volumeName {
+			return getStorageClassName(template) == storageClass
+		}
+	}
+	return false
+}
+
+// migratePodVolumes deletes the replica pod together with its persistent volume claims and waits until the pod
+// comes back on new volumes provisioned from the claim templates of the statefulset.
+func (c *Cluster) migratePodVolumes(podName spec.NamespacedName) error {
+	c.setProcessName("migrating volumes of the pod %q", podName)
+	c.logger.Infof("rebuilding pod %q on new volumes", podName)
+
+	claimNames := make([]string, 0)
+	for _, volume := range persistentClusterVolumes(&c.Spec) {
+		claimNames = append(claimNames, fmt.Sprintf("%s-%s", volume.name, podName.Name))
+	}
+	for _, claimName := range claimNames {
+		c.logger.Debugf("deleting persistent volume claim %q", claimName)
+		err := c.KubeClient.PersistentVolumeClaims(podName.Namespace).Delete(claimName, c.deleteOptions)
+		if err != nil && !k8sutil.ResourceNotFound(err) {
+			return fmt.Errorf("could not delete persistent volume claim %q: %v", claimName, err)
+		}
+	}
+
+	// the claims are not removed while a pod uses them, and the statefulset recreates the pod right away,
+	// therefore keep deleting the pod until the claims are gone
+	err := retryutil.Retry(c.OpConfig.ResourceCheckInterval, c.OpConfig.PodDeletionWaitTimeout,
+		func() (bool, error) {
+			for _, claimName := range claimNames {
+				_, err := c.KubeClient.PersistentVolumeClaims(podName.Namespace).Get(claimName, metav1.GetOptions{})
+				if k8sutil.ResourceNotFound(err) {
+					continue
+				}
+				if err != nil {
+					return false, fmt.Errorf("could not get persistent volume claim %q: %v", claimName, err)
+				}
+				err = c.KubeClient.Pods(podName.Namespace).Delete(podName.Name, c.deleteOptions)
+				if err != nil && !k8sutil.ResourceNotFound(err) {
+					return false, fmt.Errorf("could not delete pod: %v", err)
+				}
+				return false, nil
+			}
+			return true, nil
+		})
+	if err != nil {
+		return fmt.Errorf("could not delete persistent volume claims of the pod %q: %v", podName, err)
+	}
+	if err := c.ensureInstanceVolumeClaims(); err != nil {
+		return fmt.Errorf("could not create persistent volume claims with instance sizes: %v", err)
+	}
+
+	// the pod created while the old claims were still terminating would never start, recreate it
+	ch := c.registerPodSubscriber(podName)
+	defer c.unregisterPodSubscriber(podName)
+	err = c.KubeClient.Pods(podName.Namespace).Delete(podName.Name, c.deleteOptions)
+	if err == nil {
+		if err := c.waitForPodDeletion(ch); err != nil {
+			return err
+		}
+	} else if !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not delete pod: %v", err)
+	}
+	if _, err := c.waitForPodLabel(ch, nil); err != nil {
+		return fmt.Errorf("pod %q has not been rebuilt: %v", podName, err)
+	}
+	c.logger.Infof("pod %q has been rebuilt on the new volumes", podName)
+
+	return nil
 }
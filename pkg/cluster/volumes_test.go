@@ -0,0 +1,208 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/apps/v1beta1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/config"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/patroni"
+)
+
+func TestRunVolumeResizeTasks(t *testing.T) {
+	tasks := make([]volumeResizeTask, 0)
+	for _, name := range []string{"pv-0", "pv-1", "pv-2", "pv-3", "pv-4"} {
+		tasks = append(tasks, volumeResizeTask{pv: &v1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: name}}})
+	}
+
+	var (
+		mu              sync.Mutex
+		running, maxRun int
+		done            []string
+	)
+	err := runVolumeResizeTasks(tasks, 2, func(task volumeResizeTask) error {
+		mu.Lock()
+		running++
+		if running > maxRun {
+			maxRun = running
+		}
+		done = append(done, task.pv.Name)
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+		if task.pv.Name == "pv-1" || task.pv.Name == "pv-3" {
+			return fmt.Errorf("failed")
+		}
+		return nil
+	})
+
+	if len(done) != len(tasks) {
+		t.Errorf("expected all %d tasks to run, got %d", len(tasks), len(done))
+	}
+	if maxRun > 2 {
+		t.Errorf("expected at most 2 concurrent tasks, got %d", maxRun)
+	}
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	expected := "could not resize 2 of 5 volumes: pv-1: failed; pv-3: failed"
+	if err.Error() != expected {
+		t.Errorf("expected error %q, got %q", expected, err.Error())
+	}
+	if err := runVolumeResizeTasks(nil, 4, nil); err != nil {
+		t.Errorf("expected no error without tasks, got %v", err)
+	}
+}
+
+func TestValidateVolumeSpec(t *testing.T) {
+	c := &Cluster{}
+	c.OpConfig.MaxVolumeSize = "100Gi"
+
+	tests := []struct {
+		oldSize string
+		newSize string
+		shrink  bool
+		valid   bool
+	}{
+		{"", "10Gi", false, true},
+		{"", "100Gi", false, true},
+		{"", "500Mi", false, true},
+		{"", "0", false, false},
+		{"", "1536Mi", false, true},
+		{"", "ten", false, false},
+		{"", "200Gi", false, false},
+		{"10Gi", "20Gi", false, true},
+		{"20Gi", "10Gi", false, false},
+		{"20Gi", "10Gi", true, true},
+	}
+	for _, tt := range tests {
+		c.OpConfig.EnableVolumeShrink = tt.shrink
+		var oldSpec *spec.PostgresSpec
+		if tt.oldSize != "" {
+			oldSpec = &spec.PostgresSpec{Volume: spec.Volume{Size: tt.oldSize}}
+		}
+		err := c.validateVolumeSpec(oldSpec, &spec.PostgresSpec{Volume: spec.Volume{Size: tt.newSize}})
+		if (err == nil) != tt.valid {
+			t.Errorf("%q -> %q (shrink %t): expected valid %t, got error %v", tt.oldSize, tt.newSize, tt.shrink, tt.valid, err)
+		}
+	}
+}
+
+func TestSizeForClaim(t *testing.T) {
+	volume := spec.Volume{Size: "10Gi", InstanceSizes: map[string]string{"1": "50Gi"}}
+	tests := []struct {
+		claimName string
+		expected  string
+	}{
+		{"pgdata-acid-test-0", "10Gi"},
+		{"pgdata-acid-test-1", "50Gi"},
+		{"pgdata-acid-test-11", "10Gi"},
+		{"", "10Gi"},
+	}
+	for _, tt := range tests {
+		size, err := sizeForClaim(volume, tt.claimName)
+		if err != nil {
+			t.Errorf("unexpected error for claim %q: %v", tt.claimName, err)
+			continue
+		}
+		if size.String() != tt.expected {
+			t.Errorf("expected size %s for claim %q, got %s", tt.expected, tt.claimName, size.String())
+		}
+	}
+
+	for _, ordinal := range []string{"first", "01", "+1", "-1"} {
+		if err := validateInstanceSizes("pgdata", spec.Volume{InstanceSizes: map[string]string{ordinal: "1Gi"}}); err == nil {
+			t.Errorf("expected an error for the override keyed by %q, which is not an ordinal", ordinal)
+		}
+	}
+	if err := validateInstanceSizes("pgdata", volume); err != nil {
+		t.Errorf("unexpected error for the override keyed by an ordinal: %v", err)
+	}
+}
+
+func TestHealthyReplicas(t *testing.T) {
+	// as returned by the /cluster endpoint of patroni
+	response := `[
+		{"name": "acid-test-0", "role": "leader", "state": "running", "lag": 0},
+		{"name": "acid-test-1", "role": "replica", "state": "running", "lag": 0},
+		{"name": "acid-test-2", "role": "sync_standby", "state": "streaming", "lag": 1024},
+		{"name": "acid-test-3", "role": "replica", "state": "running", "lag": 2097152},
+		{"name": "acid-test-4", "role": "replica", "state": "running", "lag": "unknown"},
+		{"name": "acid-test-5", "role": "replica", "state": "starting", "lag": 0}
+	]`
+	var members []patroni.ClusterMember
+	if err := json.Unmarshal([]byte(response), &members); err != nil {
+		t.Fatalf("could not decode the members: %v", err)
+	}
+	expected := map[string]bool{"acid-test-1": true, "acid-test-2": true}
+	if healthy := healthyReplicas(members, 1048576); !reflect.DeepEqual(healthy, expected) {
+		t.Errorf("expected healthy replicas %v, got: %v", expected, healthy)
+	}
+}
+
+func TestVolumesNeedResizing(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested string
+		capacity  string
+		manifest  string
+		resize    bool
+		shrink    bool
+	}{
+		{"same size", "10Gi", "10Gi", "10Gi", false, false},
+		{"rounded up by the provisioner", "10G", "10Gi", "10G", false, false},
+		{"grown in the manifest", "10Gi", "10Gi", "20Gi", true, false},
+		{"grown within the rounding", "10G", "10Gi", "10Gi", false, false},
+		{"shrunk in the manifest", "20Gi", "20Gi", "10Gi", false, true},
+	}
+	for _, tt := range tests {
+		labels := map[string]string{"cluster-name": "acid-test"}
+		client := fake.NewSimpleClientset(
+			&v1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{Name: "pgdata-acid-test-0", Namespace: "default", Labels: labels},
+				Spec: v1.PersistentVolumeClaimSpec{
+					VolumeName: "pv-1",
+					Resources:  v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse(tt.requested)}},
+				},
+			},
+			&v1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{Name: "pv-1"},
+				Spec:       v1.PersistentVolumeSpec{Capacity: v1.ResourceList{v1.ResourceStorage: resource.MustParse(tt.capacity)}},
+			})
+		cluster := New(Config{OpConfig: config.Config{Resources: config.Resources{ClusterNameLabel: "cluster-name"}}},
+			k8sutil.KubernetesClient{PersistentVolumesGetter: client.CoreV1(), PersistentVolumeClaimsGetter: client.CoreV1()},
+			spec.Postgresql{
+				ObjectMeta: metav1.ObjectMeta{Name: "acid-test", Namespace: "default"},
+				Spec:       spec.PostgresSpec{Volume: spec.Volume{Size: tt.manifest}},
+			}, logger)
+		replicas := int32(1)
+		cluster.Statefulset = &v1beta1.StatefulSet{Spec: v1beta1.StatefulSetSpec{Replicas: &replicas}}
+		volume := clusterVolume{name: "pgdata", volume: cluster.Spec.Volume}
+
+		resize, err := cluster.volumesNeedResizing(volume)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		} else if resize != tt.resize {
+			t.Errorf("%s: expected the volume to need resizing: %t, got: %t", tt.name, tt.resize, resize)
+		}
+		shrink, err := cluster.volumesNeedShrinking(volume)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		} else if shrink != tt.shrink {
+			t.Errorf("%s: expected the volume to need shrinking: %t, got: %t", tt.name, tt.shrink, shrink)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+// syncVolumesStatus collects the capacity, the filesystem usage and the resize state of every persistent volume
+// claim of the cluster and writes them to the volumesStatus section of the postgresql object.
+func (c *Cluster) syncVolumesStatus() error {
+	pvcs, err := c.listPersistentVolumeClaims()
+	if err != nil {
+		return err
+	}
+	pods, err := c.listPods()
+	if err != nil {
+		return fmt.Errorf("could not list pods: %v", err)
+	}
+	runningPods := make(map[string]bool)
+	for _, pod := range pods {
+		runningPods[pod.Name] = pod.Status.Phase == v1.PodRunning
+	}
+
+	result := make([]spec.VolumeStatus, 0, len(pvcs))
+	for _, volume := range persistentClusterVolumes(&c.Spec) {
+		for _, pvc := range pvcs {
+			if !c.claimBelongsToVolume(&pvc, volume.name) {
+				continue
+			}
+			result = append(result, c.volumeStatus(&pvc, volume, runningPods[pvc.Name[len(volume.name)+1:]]))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ClaimName < result[j].ClaimName })
+	c.setVolumesStatus(result)
+
+	patch, err := json.Marshal(map[string]interface{}{"volumesStatus": result})
+	if err != nil {
+		return fmt.Errorf("could not marshal status of the volumes: %v", err)
+	}
+	_, err = c.KubeClient.CRDREST.Patch(types.MergePatchType).
+		Namespace(c.Namespace).
+		Resource(constants.CRDResource).
+		Name(c.Name).
+		Body(patch).
+		DoRaw()
+	if err != nil && !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not patch the postgresql object: %v", err)
+	}
+
+	return nil
+}
+
+func (c *Cluster) volumeStatus(pvc *v1.PersistentVolumeClaim, volume clusterVolume, podRunning bool) spec.VolumeStatus {
+	status := spec.VolumeStatus{ClaimName: pvc.Name, VolumeName: pvc.Spec.VolumeName}
+	if capacity, ok := pvc.Status.Capacity[v1.ResourceStorage]; ok {
+		status.Capacity = capacity.String()
+	}
+	if pvc.Spec.VolumeName != "" {
+		pv, err := c.KubeClient.PersistentVolumes().Get(pvc.Spec.VolumeName, metav1.GetOptions{})
+		if err != nil {
+			c.logger.Debugf("could not get persistent volume %q: %v", pvc.Spec.VolumeName, err)
+		} else if resizeTime, err := time.Parse(time.RFC3339, pv.Annotations[constants.VolumeLastResizeTimeAnnotation]); err == nil {
+			status.LastResizeTime = &metav1.Time{Time: resizeTime}
+		}
+		status.ResizeError = c.getVolumeResizeError(pvc.Spec.VolumeName)
+	}
+	if podRunning {
+		podName := spec.NamespacedName{Namespace: pvc.Namespace, Name: pvc.Name[len(volume.name)+1:]}
+		used, err := c.getPostgresFilesystemBytes(&podName, volume.mountPath, "used")
+		if err != nil {
+			c.logger.Debugf("could not get usage of the volume %q: %v", pvc.Name, err)
+		} else {
+			status.UsedBytes = &used
+		}
+	}
+
+	return status
+}
+
+func (c *Cluster) setVolumeResizeError(pvName string, err error) {
+	c.volumesStatusMu.Lock()
+	defer c.volumesStatusMu.Unlock()
+	if c.volumeResizeErrors == nil {
+		c.volumeResizeErrors = make(map[string]string)
+	}
+	if err == nil {
+		delete(c.volumeResizeErrors, pvName)
+	} else {
+		c.volumeResizeErrors[pvName] = err.Error()
+	}
+}
+
+func (c *Cluster) getVolumeResizeError(pvName string) string {
+	c.volumesStatusMu.RLock()
+	defer c.volumesStatusMu.RUnlock()
+	return c.volumeResizeErrors[pvName]
+}
+
+func (c *Cluster) setVolumesStatus(status []spec.VolumeStatus) {
+	c.volumesStatusMu.Lock()
+	defer c.volumesStatusMu.Unlock()
+	c.volumesStatus = status
+}
+
+// GetVolumesStatus returns the state of the persistent volume claims found during the last sync
+func (c *Cluster) GetVolumesStatus() []spec.VolumeStatus {
+	c.volumesStatusMu.RLock()
+	defer c.volumesStatusMu.RUnlock()
+
+	result := make([]spec.VolumeStatus, len(c.volumesStatus))
+	copy(result, c.volumesStatus)
+	return result
+}
@@ -0,0 +1,406 @@
+package cluster
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/walarchive"
+)
+
+// Spilo keeps the configuration of both tools for the bucket of the cluster in the same envdir. The log lines of the
+// tools go to stdout as well, otherwise the command fails on them, so the parsers of the output skip them.
+const walArchiveCommand = "envdir /home/postgres/etc/wal-e.d/env %s %s 2>&1"
+
+var gcpCredentialsFile = constants.GCPCredentialsMount + "/" + constants.GCPCredentialsKey
+
+// walTool returns the tool archiving and restoring the WAL of the cluster, the manifest overrides the operator
+// configuration during the migration from WAL-E to WAL-G. Only WAL-G supports Azure Blob Storage, the clusters with
+// a pgBackRest repository archive to it instead of the bucket of the operator.
+func (c *Cluster) walTool(spec *spec.PostgresSpec) string {
+	if spec.PgBackRest != nil {
+		return constants.WALToolPgBackRest
+	}
+	if c.azureArchive(spec) != nil || c.cloneDescription(spec).AzWalPath != "" {
+		return constants.WALToolWALG
+	}
+	if spec.WALTool != "" {
+		return spec.WALTool
+	}
+	return c.OpConfig.WALTool
+}
+
+// gcsArchive returns the Google Cloud Storage bucket of the WAL archive of the cluster, the manifest overriding the
+// operator configuration, or nil when the cluster archives to S3.
+func (c *Cluster) gcsArchive(pgSpec *spec.PostgresSpec) *spec.GCSArchive {
+	var result spec.GCSArchive
+	if pgSpec.AzureArchive != nil {
+		return nil
+	} else if pgSpec.GCSArchive != nil {
+		result = *pgSpec.GCSArchive
+	} else if c.OpConfig.WALGSBucket != "" {
+		result.Bucket = c.OpConfig.WALGSBucket
+	} else {
+		return nil
+	}
+	if result.CredentialsSecret == "" {
+		result.CredentialsSecret = c.OpConfig.GCPCredentialsSecret
+	}
+	return &result
+}
+
+// azureArchive returns the Azure Blob Storage container of the WAL archive of the cluster, the manifest overriding
+// the operator configuration, or nil when the cluster archives to S3 or Google Cloud Storage.
+func (c *Cluster) azureArchive(pgSpec *spec.PostgresSpec) *spec.AzureArchive {
+	var result spec.AzureArchive
+	if pgSpec.AzureArchive != nil {
+		result = *pgSpec.AzureArchive
+	} else if pgSpec.GCSArchive == nil && c.OpConfig.WALGSBucket == "" && c.OpConfig.WALAZStorageAccount != "" &&
+		c.OpConfig.WALAZContainer != "" {
+		result.StorageAccount = c.OpConfig.WALAZStorageAccount
+		result.Container = c.OpConfig.WALAZContainer
+	} else {
+		return nil
+	}
+	if result.CredentialsSecret == "" {
+		result.CredentialsSecret = c.OpConfig.AzureCredentialsSecret
+	}
+	if result.ClientID == "" {
+		result.ClientID = c.OpConfig.AzureClientID
+	}
+	return &result
+}
+
+// walArchiveEnabled checks if the cluster archives its WAL to S3, Google Cloud Storage, Azure Blob Storage or a
+// pgBackRest repository.
+func (c *Cluster) walArchiveEnabled(pgSpec *spec.PostgresSpec) bool {
+	return pgSpec.PgBackRest != nil || c.OpConfig.WALES3Bucket != "" || c.gcsArchive(pgSpec) != nil || c.azureArchive(pgSpec) != nil
+}
+
+// azureArchivePrefix returns the WAL-G prefix of the archive of the cluster in the container, laid out as in S3.
+func azureArchivePrefix(container, clusterName, uid string) string {
+	return fmt.Sprintf("azure://%s/spilo/%s%s/wal", container, clusterName, getWALBucketScopeSuffix(uid))
+}
+
+// generateAzureArchiveEnvironment makes Spilo archive to the container in Azure Blob Storage.
+func generateAzureArchiveEnvironment(azureArchive *spec.AzureArchive, clusterName, uid string) []v1.EnvVar {
+	result := []v1.EnvVar{
+		{Name: "AZURE_STORAGE_ACCOUNT", Value: azureArchive.StorageAccount},
+		{Name: "WALG_AZ_PREFIX", Value: azureArchivePrefix(azureArchive.Container, clusterName, uid)},
+	}
+	return append(result, generateAzureCredentialsEnvironment(azureArchive, "")...)
+}
+
+// generateAzureCredentialsEnvironment passes the SAS token from the secret, otherwise WAL-G and the Azure CLI
+// authenticate with the managed identity of the pod, the user-assigned one selected with the client id.
+func generateAzureCredentialsEnvironment(azureArchive *spec.AzureArchive, prefix string) []v1.EnvVar {
+	result := make([]v1.EnvVar, 0)
+	if azureArchive.CredentialsSecret != "" {
+		result = append(result, v1.EnvVar{
+			Name: prefix + "AZURE_STORAGE_SAS_TOKEN",
+			ValueFrom: &v1.EnvVarSource{
+				SecretKeyRef: &v1.SecretKeySelector{
+					LocalObjectReference: v1.LocalObjectReference{Name: azureArchive.CredentialsSecret},
+					Key:                  constants.AzureSASTokenKey,
+				},
+			},
+		})
+	}
+	if azureArchive.ClientID != "" {
+		result = append(result, v1.EnvVar{Name: prefix + "AZURE_CLIENT_ID", Value: azureArchive.ClientID})
+	}
+	return result
+}
+
+// generateGCSArchiveEnvironment makes Spilo archive to the bucket in Google Cloud Storage. Without the key file of
+// a GCP service account the tools use the credentials of the pod, i.e. from Workload Identity.
+func generateGCSArchiveEnvironment(gcsArchive *spec.GCSArchive, uid string) []v1.EnvVar {
+	result := []v1.EnvVar{
+		{Name: "WAL_GS_BUCKET", Value: gcsArchive.Bucket},
+		{Name: "WAL_BUCKET_SCOPE_SUFFIX", Value: getWALBucketScopeSuffix(uid)},
+	}
+	if prefix := gcsArchiveScopePrefix(gcsArchive); prefix != "" {
+		result = append(result, v1.EnvVar{Name: "WAL_BUCKET_SCOPE_PREFIX", Value: prefix})
+	}
+	if gcsArchive.CredentialsSecret != "" {
+		result = append(result, v1.EnvVar{Name: "GOOGLE_APPLICATION_CREDENTIALS", Value: gcpCredentialsFile})
+	}
+	return result
+}
+
+// gcsArchiveScopePrefix returns the prefix Spilo puts in front of the name of the cluster in the bucket, with the
+// trailing slash, or an empty string without one.
+func gcsArchiveScopePrefix(gcsArchive *spec.GCSArchive) string {
+	if prefix := strings.Trim(gcsArchive.Prefix, "/"); prefix != "" {
+		return prefix + "/"
+	}
+	return ""
+}
+
+// addSecretVolume mounts the secret, i.e. with the credentials of the archive, read-only into the first container.
+func addSecretVolume(podSpec *v1.PodSpec, volumeName, secretName, mountPath string) {
+	podSpec.Volumes = append(podSpec.Volumes, v1.Volume{
+		Name:         volumeName,
+		VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: secretName}},
+	})
+	container := &podSpec.Containers[0]
+	container.VolumeMounts = append(container.VolumeMounts, v1.VolumeMount{
+		Name:      volumeName,
+		MountPath: mountPath,
+		ReadOnly:  true,
+	})
+}
+
+// walArchiveCommand returns the shell command running the WAL tool of the cluster in the pod.
+func (c *Cluster) walArchiveCommand(arguments string) string {
+	return fmt.Sprintf(walArchiveCommand, c.walTool(&c.Spec), arguments)
+}
+
+// generateWALToolEnvironment makes Spilo archive and restore with WAL-G instead of WAL-E, including the clones and
+// standby clusters bootstrapped from an archive. WAL-G restores the base backups and the WAL archived by WAL-E as
+// well, so the clusters keep their archive when they switch.
+func generateWALToolEnvironment(walTool string, cloneDescription *spec.CloneDescription,
+	standbyDescription *spec.StandbyDescription) []v1.EnvVar {
+	if walTool != constants.WALToolWALG {
+		return nil
+	}
+	result := []v1.EnvVar{
+		{Name: "USE_WALG_BACKUP", Value: "true"},
+		{Name: "USE_WALG_RESTORE", Value: "true"},
+	}
+	if cloneDescription.ClusterName != "" && cloneDescription.Snapshot == "" && !cloneWithBasebackup(cloneDescription) {
+		result = append(result, v1.EnvVar{Name: "CLONE_USE_WALG_RESTORE", Value: "true"})
+	}
+	if standbyDescription != nil && (standbyDescription.S3WalPath != "" || standbyDescription.GSWalPath != "") {
+		result = append(result, v1.EnvVar{Name: "STANDBY_USE_WALG_RESTORE", Value: "true"})
+	}
+	return result
+}
+
+// walgBackup is a base backup in the JSON output of wal-g backup-list
+type walgBackup struct {
+	BackupName  string    `json:"backup_name"`
+	Time        time.Time `json:"time"`
+	WALFileName string    `json:"wal_file_name"`
+	// only with --detail
+	CompressedSize int64     `json:"compressed_size"`
+	StartTime      time.Time `json:"start_time"`
+}
+
+// parseWALGBackupList parses the output of wal-g backup-list --detail --json, skipping the log lines around the list.
+func parseWALGBackupList(output string) ([]spec.BaseBackup, error) {
+	start := strings.Index(output, "\n[")
+	if strings.HasPrefix(output, "[") {
+		start = 0
+	} else if start < 0 {
+		return nil, fmt.Errorf("could not parse backup list: no list of backups in the output")
+	}
+	var backups []walgBackup
+	if err := json.NewDecoder(strings.NewReader(output[start:])).Decode(&backups); err != nil {
+		return nil, fmt.Errorf("could not parse backup list: %v", err)
+	}
+	result := make([]spec.BaseBackup, 0, len(backups))
+	for _, backup := range backups {
+		result = append(result, spec.BaseBackup{Name: backup.BackupName, Time: backup.Time, WALSegment: backup.WALFileName,
+			Size: backup.CompressedSize, StartTime: backup.StartTime})
+	}
+	return result, nil
+}
+
+// parseWALEBackupList parses the tab-separated output of wal-e backup-list, skipping the log lines up to the header.
+func parseWALEBackupList(output string) ([]spec.BaseBackup, error) {
+	result := make([]spec.BaseBackup, 0)
+	columns := make(map[string]int)
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(columns) == 0 {
+			if strings.TrimSpace(fields[0]) != "name" {
+				continue
+			}
+			for i, name := range fields {
+				columns[strings.TrimSpace(name)] = i
+			}
+			for _, name := range []string{"name", "last_modified", "wal_segment_backup_start"} {
+				if _, ok := columns[name]; !ok {
+					return nil, fmt.Errorf("could not parse backup list: no %q column", name)
+				}
+			}
+			continue
+		}
+		if len(fields) < len(columns) {
+			continue
+		}
+		modified, err := time.Parse(time.RFC3339Nano, fields[columns["last_modified"]])
+		if err != nil {
+			return nil, fmt.Errorf("could not parse the time of the backup %q: %v", fields[columns["name"]], err)
+		}
+		backup := spec.BaseBackup{
+			Name:       fields[columns["name"]],
+			Time:       modified,
+			WALSegment: fields[columns["wal_segment_backup_start"]],
+		}
+		if i, ok := columns["expanded_size_bytes"]; ok && fields[i] != "" {
+			if backup.Size, err = strconv.ParseInt(fields[i], 10, 64); err != nil {
+				return nil, fmt.Errorf("could not parse the size of the backup %q: %v", backup.Name, err)
+			}
+		}
+		result = append(result, backup)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read backup list: %v", err)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("could not parse backup list: no header in the output")
+	}
+	return result, nil
+}
+
+// syncBaseBackups lists the base backups in the WAL archive of the cluster with its WAL tool, for the status of the
+// cluster in the operator API. The list is reset until the listing succeeds, so that the checks relying on it don't
+// take a failed listing for an empty archive.
+func (c *Cluster) syncBaseBackups() error {
+	if !c.walArchiveEnabled(&c.Spec) {
+		return nil
+	}
+	c.setProcessName("listing base backups")
+	c.setBaseBackups(nil)
+
+	masterPods, err := c.getRolePods(Master)
+	if err != nil {
+		return fmt.Errorf("could not get master pod: %v", err)
+	}
+	if len(masterPods) == 0 || !podIsReady(&masterPods[0]) {
+		c.logger.Debugf("no running master pod, not listing base backups")
+		return nil
+	}
+
+	podName := util.NameFromMeta(masterPods[0].ObjectMeta)
+	parse := parseWALEBackupList
+	command := c.walArchiveCommand("backup-list --detail")
+	switch c.walTool(&c.Spec) {
+	case constants.WALToolWALG:
+		parse = parseWALGBackupList
+		command = c.walArchiveCommand("backup-list --detail --json")
+	case constants.WALToolPgBackRest:
+		stanza := pgBackRestStanza(c.Spec.PgBackRest, c.Name)
+		parse = func(output string) ([]spec.BaseBackup, error) {
+			backups, _, err := parsePgBackRestInfo(output, stanza)
+			return backups, err
+		}
+		command = pgBackRestInfoCommand
+	}
+	out, err := c.ExecCommand(&podName, "/bin/su", "postgres", "-c", command)
+	if err != nil {
+		return fmt.Errorf("could not list base backups: %v: %s", err, out)
+	}
+	backups, err := parse(out)
+	if err != nil {
+		return err
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Time.Before(backups[j].Time) })
+	c.setBaseBackups(backups)
+
+	return nil
+}
+
+func (c *Cluster) setBaseBackups(backups []spec.BaseBackup) {
+	c.baseBackupsMu.Lock()
+	defer c.baseBackupsMu.Unlock()
+	c.baseBackups = backups
+}
+
+// GetBaseBackups returns the base backups in the WAL archive of the cluster found during the last sync, or nil if
+// they could not be listed
+func (c *Cluster) GetBaseBackups() []spec.BaseBackup {
+	c.baseBackupsMu.RLock()
+	defer c.baseBackupsMu.RUnlock()
+
+	if c.baseBackups == nil {
+		return nil
+	}
+	result := make([]spec.BaseBackup, len(c.baseBackups))
+	copy(result, c.baseBackups)
+	return result
+}
+
+// cloneArchivePrefix returns the path of the WAL archive the cluster is cloned from, in S3 or Google Cloud Storage.
+func (c *Cluster) cloneArchivePrefix(description *spec.CloneDescription) string {
+	if description.S3WalPath != "" {
+		return description.S3WalPath
+	}
+	if description.GSWalPath != "" {
+		return description.GSWalPath
+	}
+	if description.AzWalPath != "" {
+		return description.AzWalPath
+	}
+	return c.archiveRoot() + description.ClusterName + getWALBucketScopeSuffix(description.Uid) + "/wal"
+}
+
+// archiveRoot returns the path the archives of the clusters are kept under in the bucket of the cluster, i.e.
+// s3://bucket/spilo/, followed by the name of each cluster.
+func (c *Cluster) archiveRoot() string {
+	if azureArchive := c.azureArchive(&c.Spec); azureArchive != nil {
+		return fmt.Sprintf("azure://%s/spilo/", azureArchive.Container)
+	}
+	if gcsArchive := c.gcsArchive(&c.Spec); gcsArchive != nil {
+		return fmt.Sprintf("gs://%s/spilo/%s", gcsArchive.Bucket, gcsArchiveScopePrefix(gcsArchive))
+	}
+	return fmt.Sprintf("s3://%s/spilo/", c.OpConfig.WALES3Bucket)
+}
+
+// checkCloneTarget makes sure the archive the cluster is cloned from covers the target time of the point-in-time
+// recovery, instead of leaving the pods failing to bootstrap. Only a target outside of the archive fails the clone,
+// the operator might not have the permissions to list the bucket.
+func (c *Cluster) checkCloneTarget() error {
+	description := c.cloneDescription(&c.Spec)
+	if description.ClusterName == "" || description.EndTimestamp == "" || description.Snapshot != "" ||
+		description.PgBackRest {
+		return nil
+	}
+	target, err := time.Parse(time.RFC3339, description.EndTimestamp)
+	if err != nil {
+		return fmt.Errorf("could not parse clone timestamp: %v", err)
+	}
+	prefix := c.cloneArchivePrefix(description)
+	if !strings.HasPrefix(prefix, "s3://") {
+		c.logger.Debugf("not checking the clone target against the archive %q outside of S3", prefix)
+		return nil
+	}
+
+	region, endpoint, forcePathStyle := constants.AWSRegion, "", false
+	if s3Endpoint := c.s3Endpoint(&c.Spec); s3Endpoint != nil {
+		if s3Endpoint.Region != "" {
+			region = s3Endpoint.Region
+		}
+		endpoint, forcePathStyle = s3Endpoint.Endpoint, *s3Endpoint.ForcePathStyle
+	}
+	archive, err := walarchive.NewS3Archive(region, endpoint, forcePathStyle)
+	if err != nil {
+		c.logger.Warningf("could not check the clone target against the archive %q: %v", prefix, err)
+		return nil
+	}
+	archiveRange, err := archive.Range(prefix)
+	if err != nil {
+		c.logger.Warningf("could not check the clone target against the archive %q: %v", prefix, err)
+		return nil
+	}
+	if !archiveRange.Contains(target) {
+		return fmt.Errorf("clone timestamp %s is outside of the archive %q, which covers %s to %s",
+			description.EndTimestamp, prefix, archiveRange.Start.Format(time.RFC3339),
+			archiveRange.End.Format(time.RFC3339))
+	}
+	c.logger.Debugf("clone timestamp %s is within the archive %q", description.EndTimestamp, prefix)
+
+	return nil
+}
@@ -44,6 +44,7 @@ type Controller struct {
 	postgresqlInformer cache.SharedIndexInformer
 	podInformer        cache.SharedIndexInformer
 	nodesInformer      cache.SharedIndexInformer
+	nodeEventsInformer cache.SharedIndexInformer
 	podCh              chan spec.PodEvent
 
 	clusterEventQueues  []*cache.FIFO // [workerID]Queue
@@ -127,16 +128,15 @@ func (c *Controller) initController() {
 		c.logger.Logger.Level = logrus.DebugLevel
 	}
 
-	if err := c.createCRD(); err != nil {
+	if err := c.createCRD(constants.CRDKind, constants.CRDResource, constants.CRDShort); err != nil {
 		c.logger.Fatalf("could not register CustomResourceDefinition: %v", err)
 	}
-
-	if infraRoles, err := c.getInfrastructureRoles(&c.opConfig.InfrastructureRolesSecretName); err != nil {
-		c.logger.Warningf("could not get infrastructure roles: %v", err)
-	} else {
-		c.config.InfrastructureRoles = infraRoles
+	if err := c.createCRD(constants.BackupCRDKind, constants.BackupCRDResource, constants.BackupCRDShort); err != nil {
+		c.logger.Fatalf("could not register CustomResourceDefinition: %v", err)
 	}
 
+	c.config.InfrastructureRoles = c.getAllInfrastructureRoles()
+
 	c.clusterEventQueues = make([]*cache.FIFO, c.opConfig.Workers)
 	c.workerLogs = make(map[uint32]ringlog.RingLogger, c.opConfig.Workers)
 	for i := range c.clusterEventQueues {
@@ -205,18 +205,36 @@ func (c *Controller) initSharedInformers() {
 		UpdateFunc: c.nodeUpdate,
 		DeleteFunc: c.nodeDelete,
 	})
+
+	// Termination notices of the spot nodes
+	nodeEventLw := &cache.ListWatch{
+		ListFunc:  c.nodeEventListFunc,
+		WatchFunc: c.nodeEventWatchFunc,
+	}
+
+	c.nodeEventsInformer = cache.NewSharedIndexInformer(
+		nodeEventLw,
+		&v1.Event{},
+		constants.QueueResyncPeriodNode,
+		cache.Indexers{})
+
+	c.nodeEventsInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.nodeEventAdd,
+		UpdateFunc: c.nodeEventUpdate,
+	})
 }
 
 // Run starts background controller processes
 func (c *Controller) Run(stopCh <-chan struct{}, wg *sync.WaitGroup) {
 	c.initController()
 
-	wg.Add(5)
+	wg.Add(6)
 	go c.runPodInformer(stopCh, wg)
 	go c.runPostgresqlInformer(stopCh, wg)
 	go c.clusterResync(stopCh, wg)
 	go c.apiserver.Run(stopCh, wg)
 	go c.kubeNodesInformer(stopCh, wg)
+	go c.kubeNodeEventsInformer(stopCh, wg)
 
 	for i := range c.clusterEventQueues {
 		wg.Add(1)
@@ -249,6 +267,12 @@ func (c *Controller) kubeNodesInformer(stopCh <-chan struct{}, wg *sync.WaitGrou
 	c.nodesInformer.Run(stopCh)
 }
 
+func (c *Controller) kubeNodeEventsInformer(stopCh <-chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	c.nodeEventsInformer.Run(stopCh)
+}
+
 func (c *Controller) getEffectiveNamespace(namespaceFromEnvironment, namespaceFromConfigMap string) string {
 
 	namespace := util.Coalesce(namespaceFromEnvironment, util.Coalesce(namespaceFromConfigMap, spec.GetOperatorNamespace()))
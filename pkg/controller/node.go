@@ -1,7 +1,10 @@
 package controller
 
 import (
+	"time"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
@@ -9,6 +12,8 @@ import (
 
 	"github.com/zalando-incubator/postgres-operator/pkg/cluster"
 	"github.com/zalando-incubator/postgres-operator/pkg/util"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
 )
 
 func (c *Controller) nodeListFunc(options metav1.ListOptions) (runtime.Object, error) {
@@ -40,7 +45,7 @@ func (c *Controller) nodeAdd(obj interface{}) {
 	c.logger.Debugf("new node has been added: %q (%s)", util.NameFromMeta(node.ObjectMeta), node.Spec.ProviderID)
 	// check if the node became not ready while the operator was down (otherwise we would have caught it in nodeUpdate)
 	if !c.nodeIsReady(node) {
-		c.moveMasterPodsOffNode(node)
+		c.moveMasterPodsOffNode(node, false)
 	}
 }
 
@@ -64,18 +69,29 @@ func (c *Controller) nodeUpdate(prev, cur interface{}) {
 	if !c.nodeIsReady(nodePrev) || c.nodeIsReady(nodeCur) {
 		return
 	}
-	c.moveMasterPodsOffNode(nodeCur)
+	c.moveMasterPodsOffNode(nodeCur, false)
 }
 
+// nodeIsReady checks if the node may keep running master pods. A node being drained is not, even with the ready
+// label, as the master must be switched over before the drain can evict it.
 func (c *Controller) nodeIsReady(node *v1.Node) bool {
-	return (!node.Spec.Unschedulable || util.MapContains(node.Labels, c.opConfig.NodeReadinessLabel) ||
-		util.MapContains(node.Labels, map[string]string{"master": "true"}))
+	if util.MapContains(node.Labels, map[string]string{"master": "true"}) {
+		return true
+	}
+	if c.opConfig.MasterSwitchoverOnDrain && k8sutil.NodeIsDrained(node, c.opConfig.NodeDrainTaints) {
+		return false
+	}
+	return !node.Spec.Unschedulable || util.MapContains(node.Labels, c.opConfig.NodeReadinessLabel)
 }
 
-func (c *Controller) moveMasterPodsOffNode(node *v1.Node) {
+func (c *Controller) moveMasterPodsOffNode(node *v1.Node, interrupted bool) {
 	nodeName := util.NameFromMeta(node.ObjectMeta)
-	c.logger.Infof("moving pods: node %q became unschedulable and does not have a ready label: %q",
-		nodeName, c.opConfig.NodeReadinessLabel)
+	if interrupted {
+		c.logger.Infof("moving pods: node %q is about to be interrupted", nodeName)
+	} else {
+		c.logger.Infof("moving pods: node %q is being drained or does not have a ready label: %q",
+			nodeName, c.opConfig.NodeReadinessLabel)
+	}
 
 	opts := metav1.ListOptions{
 		LabelSelector: labels.Set(c.opConfig.ClusterLabels).String(),
@@ -117,6 +133,11 @@ func (c *Controller) moveMasterPodsOffNode(node *v1.Node) {
 			continue
 		}
 
+		if cl.Spec.Paused {
+			c.logger.Warningf("not moving pod %q of the paused cluster", podName)
+			continue
+		}
+
 		if !clusters[cl] {
 			clusters[cl] = true
 		}
@@ -131,7 +152,7 @@ func (c *Controller) moveMasterPodsOffNode(node *v1.Node) {
 	for pod, cl := range masterPods {
 		podName := util.NameFromMeta(pod.ObjectMeta)
 
-		if err := cl.MigrateMasterPod(podName); err != nil {
+		if err := cl.MigrateMasterPod(podName, interrupted); err != nil {
 			c.logger.Errorf("could not move master pod %q: %v", podName, err)
 		} else {
 			movedPods++
@@ -153,6 +174,64 @@ func (c *Controller) moveMasterPodsOffNode(node *v1.Node) {
 	}
 }
 
+func (c *Controller) nodeEventListFunc(options metav1.ListOptions) (runtime.Object, error) {
+	opts := metav1.ListOptions{
+		FieldSelector:   fields.OneTermEqualSelector("involvedObject.kind", "Node").String(),
+		Watch:           options.Watch,
+		ResourceVersion: options.ResourceVersion,
+		TimeoutSeconds:  options.TimeoutSeconds,
+	}
+
+	return c.KubeClient.Events(v1.NamespaceAll).List(opts)
+}
+
+func (c *Controller) nodeEventWatchFunc(options metav1.ListOptions) (watch.Interface, error) {
+	opts := metav1.ListOptions{
+		FieldSelector:   fields.OneTermEqualSelector("involvedObject.kind", "Node").String(),
+		Watch:           options.Watch,
+		ResourceVersion: options.ResourceVersion,
+		TimeoutSeconds:  options.TimeoutSeconds,
+	}
+
+	return c.KubeClient.Events(v1.NamespaceAll).Watch(opts)
+}
+
+func (c *Controller) nodeEventAdd(obj interface{}) {
+	event, ok := obj.(*v1.Event)
+	if !ok {
+		return
+	}
+	c.nodeEventReceived(event)
+}
+
+func (c *Controller) nodeEventUpdate(prev, cur interface{}) {
+	event, ok := cur.(*v1.Event)
+	if !ok {
+		return
+	}
+	c.nodeEventReceived(event)
+}
+
+// nodeEventReceived switches the masters over off the node a termination notice of a spot or preemptible instance
+// has been reported for, as the node goes away before it could be drained.
+func (c *Controller) nodeEventReceived(event *v1.Event) {
+	if !util.SliceContains(c.opConfig.SpotInterruptionReasons, event.Reason) {
+		return
+	}
+	// the list of the events on startup contains the notices of the nodes long gone
+	if time.Since(event.LastTimestamp.Time) > constants.SpotInterruptionEventMaxAge {
+		return
+	}
+
+	node, err := c.KubeClient.Nodes().Get(event.InvolvedObject.Name, metav1.GetOptions{})
+	if err != nil {
+		c.logger.Errorf("could not get the interrupted node %q: %v", event.InvolvedObject.Name, err)
+		return
+	}
+	c.logger.Infof("node %q is being interrupted: %s", node.Name, event.Message)
+	c.moveMasterPodsOffNode(node, true)
+}
+
 func (c *Controller) nodeDelete(obj interface{}) {
 	node, ok := obj.(*v1.Node)
 	if !ok {
@@ -63,3 +63,47 @@ func TestNodeIsReady(t *testing.T) {
 		}
 	}
 }
+
+func TestNodeIsReadyWhenDrained(t *testing.T) {
+	testName := "TestNodeIsReadyWhenDrained"
+	drainController := initializeController()
+	drainController.opConfig.MasterSwitchoverOnDrain = true
+	drainController.opConfig.NodeDrainTaints = []string{"ToBeDeletedByClusterAutoscaler"}
+
+	tainted := func(effect v1.TaintEffect) *v1.Node {
+		node := makeNode(map[string]string{readyLabel: readyValue}, true)
+		node.Spec.Taints = []v1.Taint{{Key: "ToBeDeletedByClusterAutoscaler", Effect: effect}}
+		return node
+	}
+	var testTable = []struct {
+		in  *v1.Node
+		out bool
+	}{
+		{
+			in:  makeNode(map[string]string{readyLabel: readyValue}, true),
+			out: true,
+		},
+		{
+			in:  makeNode(map[string]string{readyLabel: readyValue}, false),
+			out: false,
+		},
+		{
+			in:  tainted(v1.TaintEffectNoSchedule),
+			out: false,
+		},
+		{
+			in:  tainted(v1.TaintEffectPreferNoSchedule),
+			out: true,
+		},
+		{
+			in:  makeNode(map[string]string{"foo": "bar", "master": "true"}, false),
+			out: true,
+		},
+	}
+	for _, tt := range testTable {
+		if isReady := drainController.nodeIsReady(tt.in); isReady != tt.out {
+			t.Errorf("%s: expected response %t doesn't match the actual %t for the node %#v",
+				testName, tt.out, isReady, tt.in)
+		}
+	}
+}
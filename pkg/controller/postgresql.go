@@ -81,6 +81,11 @@ func (c *Controller) clusterListFunc(options metav1.ListOptions) (runtime.Object
 	} else {
 		c.logger.Infof("no clusters running")
 	}
+	if err == nil {
+		if err := c.collectOrphanedVolumeClaims(list.Items); err != nil {
+			c.logger.Errorf("could not collect orphaned persistent volume claims: %v", err)
+		}
+	}
 
 	atomic.StoreInt64(&c.lastClusterSyncTime, time.Now().Unix())
 
@@ -169,7 +174,21 @@ func (c *Controller) processEvent(event spec.ClusterEvent) {
 	switch event.EventType {
 	case spec.EventAdd:
 		if clusterFound {
-			lg.Debugf("cluster already exists")
+			// the manifest has been recreated after its deletion has been refused, the cluster is still running
+			lg.Infof("cluster already exists, resuming its management")
+			c.curWorkerCluster.Store(event.WorkerID, cl)
+			if event.NewSpec.Spec.Paused {
+				lg.Infof("cluster is paused, skipping the sync")
+				cl.MarkPaused()
+				return
+			}
+			if err := cl.Sync(event.NewSpec); err != nil {
+				cl.Error = fmt.Errorf("could not sync cluster: %v", err)
+				lg.Error(cl.Error)
+				return
+			}
+			cl.Error = nil
+			lg.Infof("cluster has been synced")
 			return
 		}
 
@@ -195,14 +214,30 @@ func (c *Controller) processEvent(event spec.ClusterEvent) {
 			return
 		}
 		c.curWorkerCluster.Store(event.WorkerID, cl)
-		if err := cl.Update(event.OldSpec, event.NewSpec); err != nil {
-			cl.Error = fmt.Errorf("could not update cluster: %v", err)
-			lg.Error(cl.Error)
+		switch {
+		case event.NewSpec.Spec.Paused:
+			lg.Infof("cluster is paused, not applying the changes")
+			cl.MarkPaused()
+		case event.OldSpec.Spec.Paused:
+			// the changes made while the cluster was paused are not in the diff of the manifests
+			if err := cl.Sync(event.NewSpec); err != nil {
+				cl.Error = fmt.Errorf("could not sync cluster: %v", err)
+				lg.Error(cl.Error)
 
-			return
+				return
+			}
+			cl.Error = nil
+			lg.Infoln("cluster has been resumed")
+		default:
+			if err := cl.Update(event.OldSpec, event.NewSpec); err != nil {
+				cl.Error = fmt.Errorf("could not update cluster: %v", err)
+				lg.Error(cl.Error)
+
+				return
+			}
+			cl.Error = nil
+			lg.Infoln("cluster has been updated")
 		}
-		cl.Error = nil
-		lg.Infoln("cluster has been updated")
 
 		clHistory.Insert(&spec.Diff{
 			EventTime:   event.EventTime,
@@ -214,11 +249,23 @@ func (c *Controller) processEvent(event spec.ClusterEvent) {
 			lg.Errorf("unknown cluster: %q", clusterName)
 			return
 		}
+		// the cluster keeps running without the manifest, so that it can be recreated to resume the management
+		if err := c.checkDeletionConfirmation(event.OldSpec, event.EventTime); err != nil {
+			lg.Errorf("refusing to delete the cluster: %v; recreate the manifest to keep the cluster, or annotate it and delete it again", err)
+			return
+		}
 		lg.Infoln("deletion of the cluster started")
 
 		teamName := strings.ToLower(cl.Spec.TeamID)
 
 		c.curWorkerCluster.Store(event.WorkerID, cl)
+		if event.OldSpec.Annotations[constants.SkipFinalBackupAnnotation] == "true" {
+			lg.Warningf("deleting the cluster without the final backup")
+		} else if err := cl.FinalBackup(); err != nil {
+			lg.Errorf("refusing to delete the cluster: %v; recreate the manifest to keep the cluster, or annotate it with %q and delete it again",
+				err, constants.SkipFinalBackupAnnotation)
+			return
+		}
 		if err := cl.Delete(); err != nil {
 			lg.Errorf("could not delete cluster: %v", err)
 		}
@@ -250,6 +297,11 @@ func (c *Controller) processEvent(event spec.ClusterEvent) {
 		}
 
 		c.curWorkerCluster.Store(event.WorkerID, cl)
+		if event.NewSpec.Spec.Paused {
+			lg.Infof("cluster is paused, skipping the sync")
+			cl.MarkPaused()
+			return
+		}
 		if err := cl.Sync(event.NewSpec); err != nil {
 			cl.Error = fmt.Errorf("could not sync cluster: %v", err)
 			lg.Error(cl.Error)
@@ -363,7 +415,8 @@ func (c *Controller) postgresqlAdd(obj interface{}) {
 		return
 	}
 
-	// We will not get multiple Add events for the same cluster
+	// We will not get multiple Add events for the same cluster, unless its manifest is recreated after the deletion
+	// has been refused
 	c.queueClusterEvent(nil, pg, spec.EventAdd)
 }
 
@@ -377,12 +430,138 @@ func (c *Controller) postgresqlUpdate(prev, cur interface{}) {
 		c.logger.Errorf("could not cast to postgresql spec")
 	}
 	if reflect.DeepEqual(pgOld.Spec, pgNew.Spec) {
+		// changing the annotations asks for a sync, a backup, a restore or a switchover without changing the manifest
+		for _, annotation := range []string{constants.SyncRequestAnnotation, constants.BaseBackupRequestAnnotation,
+			constants.LogicalBackupRequestAnnotation, constants.RestoreTargetAnnotation,
+			constants.RestoreConfirmAnnotation, constants.SwitchoverRequestAnnotation} {
+			if pgOld.Annotations[annotation] != pgNew.Annotations[annotation] {
+				c.queueClusterEvent(nil, pgNew, spec.EventSync)
+				break
+			}
+		}
 		return
 	}
 
 	c.queueClusterEvent(pgOld, pgNew, spec.EventUpdate)
 }
 
+// SyncCluster queues the sync of the cluster with its current manifest, without waiting for the resync period.
+func (c *Controller) SyncCluster(team, namespace, name string) error {
+	clusterName := spec.NamespacedName{
+		Namespace: namespace,
+		Name:      team + "-" + name,
+	}
+
+	c.clustersMu.RLock()
+	_, ok := c.clusters[clusterName]
+	c.clustersMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("could not find cluster")
+	}
+
+	body, err := c.KubeClient.CRDREST.Get().
+		Namespace(clusterName.Namespace).
+		Resource(constants.CRDResource).
+		Name(clusterName.Name).
+		DoRaw()
+	if err != nil {
+		return fmt.Errorf("could not get the manifest of the cluster: %v", err)
+	}
+	var pg spec.Postgresql
+	if err := json.Unmarshal(body, &pg); err != nil {
+		return fmt.Errorf("could not unmarshal the manifest of the cluster: %v", err)
+	}
+	c.queueClusterEvent(nil, &pg, spec.EventSync)
+
+	return nil
+}
+
+// RequestBackup sets the annotation requesting a base or a logical backup of the cluster, which queues its sync.
+func (c *Controller) RequestBackup(team, namespace, name, kind string) error {
+	annotations := map[string]string{
+		"base":    constants.BaseBackupRequestAnnotation,
+		"logical": constants.LogicalBackupRequestAnnotation,
+	}
+	annotation, ok := annotations[kind]
+	if !ok {
+		return fmt.Errorf("unknown kind of backup %q", kind)
+	}
+	clusterName := spec.NamespacedName{
+		Namespace: namespace,
+		Name:      team + "-" + name,
+	}
+
+	c.clustersMu.RLock()
+	_, ok = c.clusters[clusterName]
+	c.clustersMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("could not find cluster")
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{annotation: time.Now().UTC().Format(time.RFC3339)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("could not marshal the annotation: %v", err)
+	}
+	_, err = c.KubeClient.CRDREST.Patch(types.MergePatchType).
+		Namespace(clusterName.Namespace).
+		Resource(constants.CRDResource).
+		Name(clusterName.Name).
+		Body(patch).
+		DoRaw()
+	if err != nil {
+		return fmt.Errorf("could not annotate the manifest of the cluster: %v", err)
+	}
+
+	return nil
+}
+
+// RequestSwitchover sets the annotations requesting the switchover of the cluster to the candidate pod, or to any
+// ready replica when it is empty, which queues its sync.
+func (c *Controller) RequestSwitchover(team, namespace, name, candidate string) error {
+	clusterName := spec.NamespacedName{
+		Namespace: namespace,
+		Name:      team + "-" + name,
+	}
+
+	c.clustersMu.RLock()
+	_, ok := c.clusters[clusterName]
+	c.clustersMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("could not find cluster")
+	}
+
+	var candidateAnnotation interface{}
+	if candidate != "" {
+		candidateAnnotation = candidate
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				constants.SwitchoverRequestAnnotation:   time.Now().UTC().Format(time.RFC3339),
+				constants.SwitchoverCandidateAnnotation: candidateAnnotation,
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("could not marshal the annotations: %v", err)
+	}
+	_, err = c.KubeClient.CRDREST.Patch(types.MergePatchType).
+		Namespace(clusterName.Namespace).
+		Resource(constants.CRDResource).
+		Name(clusterName.Name).
+		Body(patch).
+		DoRaw()
+	if err != nil {
+		return fmt.Errorf("could not annotate the manifest of the cluster: %v", err)
+	}
+
+	return nil
+}
+
 func (c *Controller) postgresqlDelete(obj interface{}) {
 	pg, ok := obj.(*spec.Postgresql)
 	if !ok {
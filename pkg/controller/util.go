@@ -2,6 +2,8 @@ package controller
 
 import (
 	"fmt"
+	"path"
+	"time"
 
 	apiextv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -13,6 +15,7 @@ import (
 	"github.com/zalando-incubator/postgres-operator/pkg/util/config"
 	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
 	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/secretbackend"
 )
 
 func (c *Controller) makeClusterConfig() cluster.Config {
@@ -45,20 +48,21 @@ func (c *Controller) clusterWorkerID(clusterName spec.NamespacedName) uint32 {
 	return c.clusterWorkers[clusterName]
 }
 
-func (c *Controller) createCRD() error {
+// createCRD registers the resource in the API group of the operator, i.e. the postgresql and postgresbackup ones.
+func (c *Controller) createCRD(kind, plural, short string) error {
 	crd := &apiextv1beta1.CustomResourceDefinition{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: constants.CRDResource + "." + constants.CRDGroup,
+			Name: plural + "." + constants.CRDGroup,
 		},
 		Spec: apiextv1beta1.CustomResourceDefinitionSpec{
 			Group:   constants.CRDGroup,
 			Version: constants.CRDApiVersion,
 			Names: apiextv1beta1.CustomResourceDefinitionNames{
-				Plural:     constants.CRDResource,
-				Singular:   constants.CRDKind,
-				ShortNames: []string{constants.CRDShort},
-				Kind:       constants.CRDKind,
-				ListKind:   constants.CRDKind + "List",
+				Plural:     plural,
+				Singular:   kind,
+				ShortNames: []string{short},
+				Kind:       kind,
+				ListKind:   kind + "List",
 			},
 			Scope: apiextv1beta1.NamespaceScoped,
 		},
@@ -110,11 +114,105 @@ func (c *Controller) getInfrastructureRoles(rolesSecret *spec.NamespacedName) (r
 		return nil, fmt.Errorf("could not get infrastructure roles secret: %v", err)
 	}
 
-	data := infraRolesSecret.Data
-	result = make(map[string]spec.PgUser)
+	return c.infrastructureRolesFromData(infraRolesSecret.Data, "secret"), nil
+}
+
+// getInfrastructureRolesFromConfigMap reads the infrastructure roles from the config map, in the same format as the
+// one of the secret.
+func (c *Controller) getInfrastructureRolesFromConfigMap(rolesConfigMap *spec.NamespacedName) (map[string]spec.PgUser, error) {
+	configMap, err := c.KubeClient.
+		ConfigMaps(rolesConfigMap.Namespace).
+		Get(rolesConfigMap.Name, metav1.GetOptions{})
+	if err != nil {
+		c.logger.Debugf("infrastructure roles config map name: %q", *rolesConfigMap)
+		return nil, fmt.Errorf("could not get infrastructure roles config map: %v", err)
+	}
+
+	data := make(map[string][]byte, len(configMap.Data))
+	for key, value := range configMap.Data {
+		data[key] = []byte(value)
+	}
+
+	return c.infrastructureRolesFromData(data, "config map"), nil
+}
+
+// getAllInfrastructureRoles merges the roles of the infrastructure roles secret and of the infrastructure roles
+// sources, in that order. A role defined in several sources is taken from the last one as a whole; a source that
+// cannot be read is skipped.
+func (c *Controller) getAllInfrastructureRoles() map[string]spec.PgUser {
+	sources := make([]spec.InfrastructureRolesSource, 0)
+	if c.opConfig.InfrastructureRolesSecretName != (spec.NamespacedName{}) {
+		sources = append(sources, spec.InfrastructureRolesSource{
+			Kind: spec.InfrastructureRolesSecret,
+			Name: c.opConfig.InfrastructureRolesSecretName,
+		})
+	}
+	sources = append(sources, c.opConfig.InfrastructureRolesSources...)
+	if len(sources) == 0 {
+		return nil
+	}
+
+	result := make(map[string]spec.PgUser)
+	for _, source := range sources {
+		var (
+			roles map[string]spec.PgUser
+			err   error
+		)
+		if source.Kind == spec.InfrastructureRolesConfigMap {
+			roles, err = c.getInfrastructureRolesFromConfigMap(&source.Name)
+		} else {
+			roles, err = c.getInfrastructureRoles(&source.Name)
+		}
+		if err != nil {
+			c.logger.Warningf("could not get infrastructure roles from the %s: %v", source, err)
+			continue
+		}
+		for name, role := range roles {
+			if _, ok := result[name]; ok {
+				c.logger.Debugf("infrastructure role %q is overridden by the %s", name, source)
+			}
+			result[name] = role
+		}
+	}
+
+	if c.opConfig.VaultInfraRolesPath != "" {
+		c.readInfrastructureRolePasswords(result, secretbackend.NewVaultFromConfig(c.opConfig, c.KubeClient, c.logger))
+	}
+
+	return result
+}
+
+// readInfrastructureRolePasswords reads the passwords missing in the infrastructure roles sources from Vault, at the
+// path of the role below vault_infrastructure_roles_path. The roles without a password there stay without one.
+func (c *Controller) readInfrastructureRolePasswords(roles map[string]spec.PgUser, backend secretbackend.Interface) {
+	if backend == nil {
+		c.logger.Warningf("could not read the passwords of the infrastructure roles: vault address is not set")
+		return
+	}
+	for name, role := range roles {
+		if role.Password != "" {
+			continue
+		}
+		data, err := backend.Read(path.Join(c.opConfig.VaultInfraRolesPath, name))
+		if err != nil {
+			c.logger.Warningf("could not read the password of the infrastructure role %q: %v", name, err)
+			continue
+		}
+		if data["password"] != "" {
+			role.Password = data["password"]
+			roles[name] = role
+		}
+	}
+}
+
+// infrastructureRolesFromData parses the infrastructure roles in the {key}{id} format.
+func (c *Controller) infrastructureRolesFromData(data map[string][]byte, kind string) map[string]spec.PgUser {
+	result := make(map[string]spec.PgUser)
+	// the processed entries are removed from the data as we go
+	entries := len(data)
 Users:
 	// in worst case we would have one line per user
-	for i := 1; i <= len(data); i++ {
+	for i := 1; i <= entries; i++ {
 		properties := []string{"user", "password", "inrole"}
 		t := spec.PgUser{}
 		for _, p := range properties {
@@ -147,12 +245,12 @@ Users:
 	}
 
 	if len(data) != 0 {
-		c.logger.Warningf("%d unprocessed entries in the infrastructure roles' secret", len(data))
+		c.logger.Warningf("%d unprocessed entries in the infrastructure roles' %s", len(data), kind)
 		c.logger.Info(`infrastructure role entries should be in the {key}{id} format, where {key} can be either of "user", "password", "inrole" and the {id} a monotonically increasing integer starting with 1`)
 		c.logger.Debugf("unprocessed entries: %#v", data)
 	}
 
-	return result, nil
+	return result
 }
 
 func (c *Controller) podClusterName(pod *v1.Pod) spec.NamespacedName {
@@ -165,3 +263,21 @@ func (c *Controller) podClusterName(pod *v1.Pod) spec.NamespacedName {
 
 	return spec.NamespacedName{}
 }
+
+// checkDeletionConfirmation checks that the manifest of the deleted cluster has been annotated with the date of the
+// deletion and the name of the cluster, if the operator is configured to require the annotations.
+func (c *Controller) checkDeletionConfirmation(pg *spec.Postgresql, now time.Time) error {
+	if dateKey := c.opConfig.DeleteAnnotationDateKey; dateKey != "" {
+		today := now.Format("2006-01-02")
+		if date := pg.Annotations[dateKey]; date != today {
+			return fmt.Errorf("annotation %q must be set to the date of the deletion %q, got %q", dateKey, today, date)
+		}
+	}
+	if nameKey := c.opConfig.DeleteAnnotationNameKey; nameKey != "" {
+		if name := pg.Annotations[nameKey]; name != pg.Name {
+			return fmt.Errorf("annotation %q must be set to the name of the cluster %q, got %q", nameKey, pg.Name, name)
+		}
+	}
+
+	return nil
+}
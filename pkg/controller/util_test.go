@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
@@ -14,7 +15,8 @@ import (
 )
 
 const (
-	testInfrastructureRolesSecretName = "infrastructureroles-test"
+	testInfrastructureRolesSecretName    = "infrastructureroles-test"
+	testInfrastructureRolesConfigMapName = "infrastructureroles-configmap-test"
 )
 
 type mockSecret struct {
@@ -43,8 +45,32 @@ func (c *MockSecretGetter) Secrets(namespace string) v1core.SecretInterface {
 	return &mockSecret{}
 }
 
+type mockConfigMap struct {
+	v1core.ConfigMapInterface
+}
+
+func (c *mockConfigMap) Get(name string, options metav1.GetOptions) (*v1.ConfigMap, error) {
+	if name != testInfrastructureRolesConfigMapName {
+		return nil, fmt.Errorf("NotFound")
+	}
+	configmap := &v1.ConfigMap{}
+	configmap.Data = map[string]string{
+		"user1":   "testrole",
+		"inrole1": "testteamrole",
+		"user2":   "testgrouprole",
+	}
+	return configmap, nil
+}
+
+type MockConfigMapsGetter struct {
+}
+
+func (c *MockConfigMapsGetter) ConfigMaps(namespace string) v1core.ConfigMapInterface {
+	return &mockConfigMap{}
+}
+
 func newMockKubernetesClient() k8sutil.KubernetesClient {
-	return k8sutil.KubernetesClient{SecretsGetter: &MockSecretGetter{}}
+	return k8sutil.KubernetesClient{SecretsGetter: &MockSecretGetter{}, ConfigMapsGetter: &MockConfigMapsGetter{}}
 }
 
 func newMockController() *Controller {
@@ -151,3 +177,98 @@ func TestGetInfrastructureRoles(t *testing.T) {
 		}
 	}
 }
+
+func TestGetAllInfrastructureRoles(t *testing.T) {
+	controller := newMockController()
+	controller.opConfig.InfrastructureRolesSources = []spec.InfrastructureRolesSource{
+		{
+			Kind: spec.InfrastructureRolesSecret,
+			Name: spec.NamespacedName{Namespace: v1.NamespaceDefault, Name: "null"},
+		},
+		{
+			Kind: spec.InfrastructureRolesConfigMap,
+			Name: spec.NamespacedName{Namespace: v1.NamespaceDefault, Name: testInfrastructureRolesConfigMapName},
+		},
+	}
+	expected := map[string]spec.PgUser{
+		"testrole": {
+			Name:     "testrole",
+			MemberOf: []string{"testteamrole"},
+		},
+		"testgrouprole": {
+			Name: "testgrouprole",
+		},
+	}
+
+	roles := controller.getAllInfrastructureRoles()
+	if !reflect.DeepEqual(roles, expected) {
+		t.Errorf("expected roles output %v does not match the actual %v", expected, roles)
+	}
+}
+
+type mockCredentialsBackend struct {
+	data map[string]map[string]string
+}
+
+func (b *mockCredentialsBackend) Read(path string) (map[string]string, error) {
+	if path == "infrastructure-roles/broken" {
+		return nil, fmt.Errorf("permission denied")
+	}
+	return b.data[path], nil
+}
+
+func (b *mockCredentialsBackend) Write(path string, data map[string]string) error {
+	b.data[path] = data
+	return nil
+}
+
+func TestReadInfrastructureRolePasswords(t *testing.T) {
+	controller := newMockController()
+	controller.opConfig.VaultInfraRolesPath = "infrastructure-roles/"
+	backend := &mockCredentialsBackend{data: map[string]map[string]string{
+		"infrastructure-roles/robot_zmon": {"password": "vaultpassword"},
+		"infrastructure-roles/testrole":   {"password": "ignored"},
+	}}
+	roles := map[string]spec.PgUser{
+		"robot_zmon": {Name: "robot_zmon"},
+		"testrole":   {Name: "testrole", Password: "testpassword"},
+		"teamrole":   {Name: "teamrole"},
+		"broken":     {Name: "broken"},
+	}
+	expected := map[string]spec.PgUser{
+		"robot_zmon": {Name: "robot_zmon", Password: "vaultpassword"},
+		"testrole":   {Name: "testrole", Password: "testpassword"},
+		"teamrole":   {Name: "teamrole"},
+		"broken":     {Name: "broken"},
+	}
+
+	controller.readInfrastructureRolePasswords(roles, backend)
+	if !reflect.DeepEqual(roles, expected) {
+		t.Errorf("expected roles %v, got %v", expected, roles)
+	}
+}
+
+func TestCheckDeletionConfirmation(t *testing.T) {
+	controller := newMockController()
+	controller.opConfig.DeleteAnnotationDateKey = "delete-date"
+	controller.opConfig.DeleteAnnotationNameKey = "delete-clustername"
+	now := time.Date(2017, time.December, 19, 12, 0, 0, 0, time.Local)
+
+	var testTable = []struct {
+		annotations map[string]string
+		confirmed   bool
+	}{
+		{nil, false},
+		{map[string]string{"delete-date": "2017-12-19"}, false},
+		{map[string]string{"delete-date": "2017-12-18", "delete-clustername": "acid-test"}, false},
+		{map[string]string{"delete-date": "2017-12-19", "delete-clustername": "acid-other"}, false},
+		{map[string]string{"delete-date": "2017-12-19", "delete-clustername": "acid-test"}, true},
+	}
+	for _, test := range testTable {
+		pg := &spec.Postgresql{ObjectMeta: metav1.ObjectMeta{Name: "acid-test", Annotations: test.annotations}}
+		err := controller.checkDeletionConfirmation(pg, now)
+		if (err == nil) != test.confirmed {
+			t.Errorf("expected confirmed %t for the annotations %v, got error: %v", test.confirmed, test.annotations, err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/cluster"
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+)
+
+// collectOrphanedVolumeClaims finds the persistent volume claims created for the clusters that don't exist anymore,
+// i.e. when the operator was not running at the time the cluster has been deleted.
+func (c *Controller) collectOrphanedVolumeClaims(clusters []spec.Postgresql) error {
+	if c.opConfig.OrphanedPVCPolicy == constants.OrphanedPVCPolicyIgnore {
+		return nil
+	}
+	orphaned, err := c.orphanedVolumeClaims(clusters)
+	if err != nil {
+		return err
+	}
+
+	return cluster.CollectOrphanedVolumeClaims(c.KubeClient, c.opConfig, orphaned, c.logger)
+}
+
+// orphanedVolumeClaims returns the persistent volume claims of the clusters that neither have a manifest, nor are
+// still managed by the operator, nor run a statefulset. The clusters whose deletion has been refused keep running
+// without their manifest, also after a restart of the operator, and their volumes must not be collected.
+func (c *Controller) orphanedVolumeClaims(clusters []spec.Postgresql) ([]v1.PersistentVolumeClaim, error) {
+	existing := make(map[spec.NamespacedName]bool)
+	for _, pg := range clusters {
+		existing[spec.NamespacedName{Namespace: pg.Namespace, Name: pg.Name}] = true
+	}
+	c.clustersMu.RLock()
+	for name := range c.clusters {
+		existing[name] = true
+	}
+	c.clustersMu.RUnlock()
+
+	listOptions := metav1.ListOptions{LabelSelector: labels.Set(c.opConfig.ClusterLabels).String()}
+	statefulSets, err := c.KubeClient.StatefulSets(c.opConfig.WatchedNamespace).List(listOptions)
+	if err != nil {
+		return nil, fmt.Errorf("could not list statefulsets: %v", err)
+	}
+	for _, statefulSet := range statefulSets.Items {
+		if clusterName, ok := statefulSet.Labels[c.opConfig.ClusterNameLabel]; ok {
+			existing[spec.NamespacedName{Namespace: statefulSet.Namespace, Name: clusterName}] = true
+		}
+	}
+
+	pvcs, err := c.KubeClient.PersistentVolumeClaims(c.opConfig.WatchedNamespace).List(listOptions)
+	if err != nil {
+		return nil, fmt.Errorf("could not list persistent volume claims: %v", err)
+	}
+	orphaned := make([]v1.PersistentVolumeClaim, 0)
+	for _, pvc := range pvcs.Items {
+		clusterName, ok := pvc.Labels[c.opConfig.ClusterNameLabel]
+		if !ok || existing[spec.NamespacedName{Namespace: pvc.Namespace, Name: clusterName}] {
+			continue
+		}
+		orphaned = append(orphaned, pvc)
+	}
+
+	return orphaned, nil
+}
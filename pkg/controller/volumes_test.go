@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appsv1beta1 "k8s.io/client-go/kubernetes/typed/apps/v1beta1"
+	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/apps/v1beta1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/cluster"
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+type mockPersistentVolumeClaims struct {
+	v1core.PersistentVolumeClaimInterface
+	clusters []string
+}
+
+func (m *mockPersistentVolumeClaims) List(opts metav1.ListOptions) (*v1.PersistentVolumeClaimList, error) {
+	result := &v1.PersistentVolumeClaimList{}
+	for _, name := range m.clusters {
+		result.Items = append(result.Items, v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+			Name: "pgdata-" + name + "-0", Namespace: "default", Labels: map[string]string{"cluster-name": name}}})
+	}
+	return result, nil
+}
+
+type mockStatefulSets struct {
+	appsv1beta1.StatefulSetInterface
+	clusters []string
+}
+
+func (m *mockStatefulSets) List(opts metav1.ListOptions) (*v1beta1.StatefulSetList, error) {
+	result := &v1beta1.StatefulSetList{}
+	for _, name := range m.clusters {
+		result.Items = append(result.Items, v1beta1.StatefulSet{ObjectMeta: metav1.ObjectMeta{
+			Name: name, Namespace: "default", Labels: map[string]string{"cluster-name": name}}})
+	}
+	return result, nil
+}
+
+type mockVolumeClient struct {
+	pvcs         *mockPersistentVolumeClaims
+	statefulSets *mockStatefulSets
+}
+
+func (m *mockVolumeClient) PersistentVolumeClaims(namespace string) v1core.PersistentVolumeClaimInterface {
+	return m.pvcs
+}
+
+func (m *mockVolumeClient) StatefulSets(namespace string) appsv1beta1.StatefulSetInterface {
+	return m.statefulSets
+}
+
+func TestOrphanedVolumeClaims(t *testing.T) {
+	client := &mockVolumeClient{
+		pvcs: &mockPersistentVolumeClaims{clusters: []string{"acid-listed", "acid-refused-delete", "acid-running",
+			"acid-deleted"}},
+		statefulSets: &mockStatefulSets{clusters: []string{"acid-running"}},
+	}
+	c := newMockController()
+	c.KubeClient = k8sutil.KubernetesClient{PersistentVolumeClaimsGetter: client, StatefulSetsGetter: client}
+	// the deletion of the cluster has been refused, it keeps running without its manifest
+	c.clusters[spec.NamespacedName{Namespace: "default", Name: "acid-refused-delete"}] = &cluster.Cluster{}
+
+	manifests := []spec.Postgresql{{ObjectMeta: metav1.ObjectMeta{Name: "acid-listed", Namespace: "default"}}}
+	orphaned, err := c.orphanedVolumeClaims(manifests)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(orphaned) != 1 || orphaned[0].Labels["cluster-name"] != "acid-deleted" {
+		t.Errorf("expected only the claim of the deleted cluster to be orphaned, got: %v", orphaned)
+	}
+}
@@ -0,0 +1,57 @@
+package spec
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BackupType is the kind of the backup described by a PostgresBackup
+type BackupType string
+
+// possible types of a PostgresBackup
+const (
+	BackupTypeBase    BackupType = "base"
+	BackupTypeLogical BackupType = "logical"
+)
+
+// PostgresBackup describes a backup of a cluster. The operator writes one for every base backup in the WAL archive
+// of the cluster and for every requested logical backup, the deletion of the object deletes the base backup.
+type PostgresBackup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+
+	Spec   PostgresBackupSpec   `json:"spec"`
+	Status PostgresBackupStatus `json:"status,omitempty"`
+}
+
+// PostgresBackupSpec identifies the backup in the archive of the cluster
+type PostgresBackupSpec struct {
+	ClusterName string     `json:"clusterName"`
+	ClusterUID  string     `json:"clusterUid,omitempty"`
+	Type        BackupType `json:"type"`
+	// Tool is the WAL tool of the base backups: wal-e, wal-g or pgbackrest
+	Tool string `json:"tool,omitempty"`
+	// BackupName is the name of the base backup in the archive, or the label of the pgBackRest backup
+	BackupName string `json:"backupName,omitempty"`
+}
+
+// PostgresBackupStatus is written by the operator
+type PostgresBackupStatus struct {
+	Phase BackupRequestPhase `json:"phase"`
+	// Location is the path of the base backup in the archive, or the prefix of the runs of the logical backups
+	Location       string       `json:"location,omitempty"`
+	SizeBytes      int64        `json:"sizeBytes,omitempty"`
+	StartTime      *metav1.Time `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	Duration       string       `json:"duration,omitempty"`
+	WALSegment     string       `json:"walSegment,omitempty"`
+	JobName        string       `json:"jobName,omitempty"`
+	Error          string       `json:"error,omitempty"`
+}
+
+// PostgresBackupList is a list of backups
+type PostgresBackupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []PostgresBackup `json:"items"`
+}
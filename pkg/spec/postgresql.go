@@ -3,11 +3,18 @@ package spec
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/util/cron"
 )
 
 // MaintenanceWindow describes the time window when the operator is allowed to do maintenance on a cluster.
@@ -22,6 +29,19 @@ type MaintenanceWindow struct {
 type Volume struct {
 	Size         string `json:"size"`
 	StorageClass string `json:"storageClass"`
+	// StorageType, Iops and Throughput are applied to the provider volumes (only EBS at the moment) by the operator
+	StorageType string `json:"storageType,omitempty"`
+	Iops        *int64 `json:"iops,omitempty"`
+	Throughput  *int64 `json:"throughput,omitempty"`
+	// Ephemeral volumes are emptyDir volumes of the pod, their data is lost together with the pod
+	Ephemeral bool `json:"ephemeral,omitempty"`
+	// Labels and Annotations are added to the persistent volume claims of the volume
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Tags are applied to the provider volumes (only EBS at the moment), on top of the ones from the operator configuration
+	Tags map[string]string `json:"tags,omitempty"`
+	// InstanceSizes overrides Size for the pods with the given ordinals, e.g. {"0": "200Gi"}
+	InstanceSizes map[string]string `json:"instanceSizes,omitempty"`
 }
 
 // PostgresqlParam describes PostgreSQL version and pairs of configuration parameter name - values.
@@ -42,6 +62,60 @@ type Resources struct {
 	ResourceLimits  ResourceDescription `json:"limits,omitempty"`
 }
 
+// Sidecar describes a container running next to Postgres in every pod of the cluster.
+type Sidecar struct {
+	Resources    `json:"resources,omitempty"`
+	Name         string             `json:"name"`
+	DockerImage  string             `json:"image"`
+	Env          []v1.EnvVar        `json:"env,omitempty"`
+	Ports        []v1.ContainerPort `json:"ports,omitempty"`
+	VolumeMounts []v1.VolumeMount   `json:"volumeMounts,omitempty"`
+}
+
+// TopologySpreadConstraint spreads the pods across the topology domains, i.e. zones. It mirrors the pod spec field of
+// Kubernetes 1.16, which the client library doesn't know.
+type TopologySpreadConstraint struct {
+	MaxSkew           int32                 `json:"maxSkew"`
+	TopologyKey       string                `json:"topologyKey"`
+	WhenUnsatisfiable string                `json:"whenUnsatisfiable"`
+	LabelSelector     *metav1.LabelSelector `json:"labelSelector,omitempty"`
+}
+
+// Values of WhenUnsatisfiable in the topology spread constraints
+const (
+	DoNotSchedule  = "DoNotSchedule"
+	ScheduleAnyway = "ScheduleAnyway"
+)
+
+// Autoscaling lets the operator pick the number of instances from the range based on the client connections.
+type Autoscaling struct {
+	MinInstances      int32 `json:"minInstances"`
+	MaxInstances      int32 `json:"maxInstances"`
+	TargetConnections int32 `json:"targetConnectionsPerInstance"`
+}
+
+// PreparedDatabase is a database created with the standard layout: schemas owned by NOLOGIN owner roles, reader and
+// writer roles for them, and login users for the roles of the database. The "data" schema is created if none is given.
+type PreparedDatabase struct {
+	Schemas []string `json:"schemas,omitempty"`
+}
+
+// LDAP makes the members of a role authenticate against an LDAP or Active Directory server in the search+bind mode.
+// The bind credentials are read from the username and password keys of a secret in the namespace of the cluster.
+type LDAP struct {
+	Server           string   `json:"server"`
+	Port             int32    `json:"port,omitempty"`
+	Scheme           string   `json:"scheme,omitempty"`
+	StartTLS         bool     `json:"startTLS,omitempty"`
+	BaseDN           string   `json:"baseDN"`
+	SearchAttribute  string   `json:"searchAttribute,omitempty"`
+	SearchFilter     string   `json:"searchFilter,omitempty"`
+	BindSecret       string   `json:"bindSecret,omitempty"`
+	Role             string   `json:"role,omitempty"`
+	Users            []string `json:"users,omitempty"`
+	AllowedAddresses string   `json:"allowedAddresses,omitempty"`
+}
+
 // Patroni contains Patroni-specific configuration
 type Patroni struct {
 	InitDB               map[string]string `json:"initdb"`
@@ -50,6 +124,57 @@ type Patroni struct {
 	LoopWait             uint32            `json:"loop_wait"`
 	RetryTimeout         uint32            `json:"retry_timeout"`
 	MaximumLagOnFailover float32           `json:"maximum_lag_on_failover"` // float32 because https://github.com/kubernetes/kubernetes/issues/30213
+	// synchronous replication, applied to the running clusters via the DCS
+	SynchronousMode       bool   `json:"synchronous_mode,omitempty"`
+	SynchronousModeStrict bool   `json:"synchronous_mode_strict,omitempty"`
+	SynchronousNodeCount  uint32 `json:"synchronous_node_count,omitempty"`
+	// DCS passes the other settings of the dynamic configuration through to Patroni, see PatroniDCSSettings
+	DCS map[string]string `json:"dcs,omitempty"`
+}
+
+// patroniDCSSettings are the keys of the dcs section of the patroni section with the types of their values. The
+// settings with fields of their own and the ones Spilo relies on are not passed through.
+var patroniDCSSettings = map[string]string{
+	"check_timeline":        "bool",
+	"master_start_timeout":  "int",
+	"master_stop_timeout":   "int",
+	"max_timelines_history": "int",
+}
+
+// PatroniDCSKeys returns the keys of the dynamic configuration the dcs section of the manifest may set, sorted.
+func PatroniDCSKeys() []string {
+	keys := make([]string, 0, len(patroniDCSSettings))
+	for key := range patroniDCSSettings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// PatroniDCSSettings converts the string values of the dcs section of the manifest into the values of the dynamic
+// configuration of Patroni.
+func PatroniDCSSettings(dcs map[string]string) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(dcs))
+	for key, value := range dcs {
+		switch patroniDCSSettings[key] {
+		case "bool":
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("Patroni setting %q must be true or false, not %q", key, value)
+			}
+			result[key] = enabled
+		case "int":
+			number, err := strconv.Atoi(value)
+			if err != nil || number < 0 {
+				return nil, fmt.Errorf("Patroni setting %q must be a non-negative integer, not %q", key, value)
+			}
+			result[key] = number
+		default:
+			return nil, fmt.Errorf("Patroni setting %q is not supported in the dcs section, supported are: %s", key,
+				strings.Join(PatroniDCSKeys(), ", "))
+		}
+	}
+	return result, nil
 }
 
 // CloneDescription describes which cluster the new should clone and up to which point in time
@@ -57,10 +182,167 @@ type CloneDescription struct {
 	ClusterName  string `json:"cluster,omitempty"`
 	Uid          string `json:"uid,omitempty"`
 	EndTimestamp string `json:"timestamp,omitempty"`
+	// S3WalPath is the WAL-E prefix of the cluster to clone, i.e. s3://bucket/spilo/acid-batman/<uid>/wal,
+	// overriding the one derived from the bucket of the operator and the uid
+	S3WalPath string `json:"s3WalPath,omitempty"`
+	// Snapshot is the name of the snapshot-based backup of the cluster to create the volumes from
+	Snapshot string `json:"snapshot,omitempty"`
+	// GSWalPath is the prefix of the cluster to clone in Google Cloud Storage, i.e. gs://bucket/spilo/acid-batman/<uid>/wal
+	GSWalPath string `json:"gsWalPath,omitempty"`
+	// AzWalPath is the prefix of the cluster to clone in Azure Blob Storage, i.e. azure://container/spilo/acid-batman/<uid>/wal,
+	// in the storage account of the archive of the new cluster
+	AzWalPath string `json:"azWalPath,omitempty"`
+	// PgBackRest restores the clone from the stanza of the cluster to clone in the pgBackRest repository of the new
+	// cluster
+	PgBackRest bool `json:"pgbackrest,omitempty"`
+	// Backup is the name of the PostgresBackup of a base backup in the namespace of the new cluster, which the
+	// operator resolves into the other fields when creating the clone
+	Backup string `json:"backup,omitempty"`
+	// TeamID is the team of the cluster to clone, if it isn't the team of the new cluster
+	TeamID string `json:"team,omitempty"`
+	// Namespace is the namespace of the cluster to clone, if it isn't the namespace of the new cluster
+	Namespace string `json:"namespace,omitempty"`
+	// CredentialsSecret is the secret in the namespace of the new cluster with the credentials for reading the
+	// archive of the cluster to clone in S3 or Azure Blob Storage
+	CredentialsSecret string `json:"credentialsSecret,omitempty"`
+	RecoveryTargetOptions
+}
+
+// RecoveryTargetOptions refine the point-in-time recovery of a clone or a restore beyond its timestamp
+type RecoveryTargetOptions struct {
+	// TargetTimeline is latest, current or the number of the timeline to recover along
+	TargetTimeline string `json:"targetTimeline,omitempty"`
+	// TargetInclusive set to false stops the recovery just before the timestamp instead of just after it
+	TargetInclusive *bool `json:"targetInclusive,omitempty"`
+	// TargetAction is promote, the default, or pause to inspect the data before promoting by hand
+	TargetAction string `json:"targetAction,omitempty"`
+}
+
+// recovery target actions
+const (
+	RecoveryTargetActionPromote = "promote"
+	RecoveryTargetActionPause   = "pause"
+)
+
+// CloneAudit records what the cluster has been cloned from and what allowed it
+type CloneAudit struct {
+	SourceCluster   string `json:"sourceCluster"`
+	SourceNamespace string `json:"sourceNamespace"`
+	SourceTeam      string `json:"sourceTeam"`
+	// Method is one of basebackup, archive, snapshot and pgbackrest
+	Method    string `json:"method"`
+	Location  string `json:"location,omitempty"`
+	Timestamp string `json:"timestamp,omitempty"`
+	Backup    string `json:"backup,omitempty"`
+	// AllowedBy is the rule of the clone_allowed_sources the clone matched, or "same team"
+	AllowedBy string      `json:"allowedBy"`
+	Time      metav1.Time `json:"time"`
+}
+
+// StandbyDescription describes where the standby cluster replays the WAL of its source cluster from: either the
+// WAL archive in S3 or Google Cloud Storage, or the master of the source cluster via streaming replication.
+type StandbyDescription struct {
+	// S3WalPath is the WAL-E prefix of the source cluster, i.e. s3://bucket/spilo/acid-batman/<uid>/wal
+	S3WalPath   string `json:"s3WalPath,omitempty"`
+	StandbyHost string `json:"standbyHost,omitempty"`
+	StandbyPort string `json:"standbyPort,omitempty"`
+	// GSWalPath is the prefix of the source cluster in Google Cloud Storage, i.e. gs://bucket/spilo/acid-batman/<uid>/wal
+	GSWalPath string `json:"gsWalPath,omitempty"`
+}
+
+// GCSArchive describes the Google Cloud Storage bucket the cluster archives its WAL and base backups to
+type GCSArchive struct {
+	Bucket string `json:"bucket"`
+	// Prefix is put in front of the name of the cluster in the paths of the archive, i.e. spilo/<prefix>/acid-batman
+	Prefix string `json:"prefix,omitempty"`
+	// CredentialsSecret is the secret with the key file of the GCP service account under key.json, overriding
+	// the gcp_credentials_secret of the operator
+	CredentialsSecret string `json:"credentialsSecret,omitempty"`
+}
+
+// S3Endpoint describes an S3-compatible storage, i.e. MinIO or Ceph RGW, the cluster uses instead of AWS S3
+type S3Endpoint struct {
+	// Endpoint is the URL of the storage, i.e. https://minio.example.com:9000, http disables TLS
+	Endpoint string `json:"endpoint,omitempty"`
+	Region   string `json:"region,omitempty"`
+	// ForcePathStyle addresses the buckets in the path of the URL instead of the host name
+	ForcePathStyle *bool `json:"forcePathStyle,omitempty"`
+	// CACertSecret is the secret with the certificate of the authority signing the one of the endpoint, under ca.crt
+	CACertSecret string `json:"caCertSecret,omitempty"`
+}
+
+// ValidateS3Endpoint checks that the endpoint is an http or https URL of the storage.
+func ValidateS3Endpoint(endpoint string) error {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("could not parse S3 endpoint %q: %v", endpoint, err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("S3 endpoint %q must be an http or https URL", endpoint)
+	}
+	return nil
+}
+
+// AzureArchive describes the Azure Blob Storage container the cluster archives its WAL and base backups to
+type AzureArchive struct {
+	StorageAccount string `json:"storageAccount"`
+	Container      string `json:"container"`
+	// CredentialsSecret is the secret with the SAS token of the container under sas-token, without it the pods
+	// authenticate with a managed identity
+	CredentialsSecret string `json:"credentialsSecret,omitempty"`
+	// ClientID selects the user-assigned managed identity of the pods
+	ClientID string `json:"clientId,omitempty"`
+}
+
+// SnapshotBackupDescription describes how often to take snapshots of the cluster volumes and how many of them to keep
+type SnapshotBackupDescription struct {
+	Interval            string `json:"interval"`
+	VolumeSnapshotClass string `json:"volumeSnapshotClass,omitempty"`
+	Retain              int    `json:"retain,omitempty"`
 }
 
 type UserFlags []string
 
+// PVCRetentionPolicy tells what happens to the persistent volume claims of the cluster when it is deleted
+type PVCRetentionPolicy string
+
+// possible PVC retention policies
+const (
+	PVCRetentionPolicyDelete     PVCRetentionPolicy = "delete"
+	PVCRetentionPolicyRetain     PVCRetentionPolicy = "retain"
+	PVCRetentionPolicyRetainLast PVCRetentionPolicy = "retain-last" // keep only the volumes of the master
+)
+
+// Valid checks if the retention policy is one of the known ones
+func (p PVCRetentionPolicy) Valid() bool {
+	return p == PVCRetentionPolicyDelete || p == PVCRetentionPolicyRetain || p == PVCRetentionPolicyRetainLast
+}
+
+// RemovedUsersPolicy tells what happens to the roles of the users removed from the manifest
+type RemovedUsersPolicy string
+
+// possible policies for the removed users
+const (
+	RemovedUsersPolicyKeep    RemovedUsersPolicy = "keep"
+	RemovedUsersPolicyNoLogin RemovedUsersPolicy = "nologin"
+	RemovedUsersPolicyDrop    RemovedUsersPolicy = "drop" // after reassigning the objects of the role
+)
+
+// Valid checks if the policy for the removed users is one of the known ones
+func (p RemovedUsersPolicy) Valid() bool {
+	return p == RemovedUsersPolicyKeep || p == RemovedUsersPolicyNoLogin || p == RemovedUsersPolicyDrop
+}
+
+// RemovedUserStatus describes what the operator did with the role of a user removed from the manifest
+type RemovedUserStatus struct {
+	Name   string             `json:"name"`
+	Action RemovedUsersPolicy `json:"action"`
+	Time   metav1.Time        `json:"time"`
+	Error  string             `json:"error,omitempty"`
+	// Pending is set until the action has been applied, which the next syncs retry
+	Pending bool `json:"pending,omitempty"`
+}
+
 // PostgresStatus contains status of the PostgreSQL cluster (running, creation failed etc.)
 type PostgresStatus string
 
@@ -74,6 +356,15 @@ const (
 	ClusterStatusAddFailed    PostgresStatus = "CreateFailed"
 	ClusterStatusRunning      PostgresStatus = "Running"
 	ClusterStatusInvalid      PostgresStatus = "Invalid"
+	// ClusterStatusHibernated is set instead of running for the clusters scaled to zero by hibernation
+	ClusterStatusHibernated PostgresStatus = "Hibernated"
+	// ClusterStatusUpgrading is set while the major version of the cluster is being upgraded
+	ClusterStatusUpgrading     PostgresStatus = "Upgrading"
+	ClusterStatusUpgradeFailed PostgresStatus = "UpgradeFailed"
+	// ClusterStatusEncryptionViolation is set when volumes of the running cluster are not encrypted as required
+	ClusterStatusEncryptionViolation PostgresStatus = "EncryptionViolation"
+	// ClusterStatusPaused is set while the operator doesn't apply the changes of the manifest
+	ClusterStatusPaused PostgresStatus = "Paused"
 )
 
 // Postgresql defines PostgreSQL Custom Resource Definition Object.
@@ -84,6 +375,178 @@ type Postgresql struct {
 	Spec   PostgresSpec   `json:"spec"`
 	Status PostgresStatus `json:"status,omitempty"`
 	Error  error          `json:"-"`
+	// VolumesStatus is written by the operator on every sync
+	VolumesStatus []VolumeStatus `json:"volumesStatus,omitempty"`
+	// MajorVersionUpgrade is written by the operator when upgrading the major version of the cluster
+	MajorVersionUpgrade *MajorVersionUpgradeStatus `json:"majorVersionUpgrade,omitempty"`
+	// RemovedUsers is written by the operator when it handles the users removed from the manifest
+	RemovedUsers []RemovedUserStatus `json:"removedUsers,omitempty"`
+	// BackupStatus is written by the operator on every sync of a cluster with a WAL archive
+	BackupStatus *BackupStatus `json:"backupStatus,omitempty"`
+	// Conditions are written by the operator, i.e. BackupsHealthy
+	Conditions []ClusterCondition `json:"conditions,omitempty"`
+	// results of the last backups requested with an annotation or the operator API
+	BaseBackupRequest    *BackupRequestStatus `json:"baseBackupRequest,omitempty"`
+	LogicalBackupRequest *BackupRequestStatus `json:"logicalBackupRequest,omitempty"`
+	// BackupCleanup is the result of the last removal of the base backups falling out of the retention
+	BackupCleanup *BackupCleanupStatus `json:"backupCleanup,omitempty"`
+	// CloneSource is the clone description the backup of the clone section has been resolved into
+	CloneSource *CloneDescription `json:"cloneSource,omitempty"`
+	// CloneAudit is written when the cluster is created as a clone
+	CloneAudit *CloneAudit `json:"cloneAudit,omitempty"`
+	// LastBackupVerification is the result of the last run of the backup verification job
+	LastBackupVerification *BackupVerificationStatus `json:"lastBackupVerification,omitempty"`
+	// Restore is the last in-place point-in-time restore requested with the annotations of the cluster
+	Restore *RestoreStatus `json:"restore,omitempty"`
+	// Promotion is the promotion of the standby cluster started by removing its standby section
+	Promotion *PromotionStatus `json:"promotion,omitempty"`
+	// SynchronousStandbys are the members Patroni currently replicates to synchronously
+	SynchronousStandbys []string `json:"synchronousStandbys,omitempty"`
+	// SwitchoverRequest is the result of the last switchover requested with the annotations or the operator API
+	SwitchoverRequest *SwitchoverStatus `json:"switchoverRequest,omitempty"`
+}
+
+// RestoreStatus describes the in-place point-in-time restore of the cluster to its Target
+type RestoreStatus struct {
+	Target string             `json:"target"`
+	Phase  BackupRequestPhase `json:"phase"`
+	// Options are the restoreOptions of the manifest when the restore started
+	Options *RecoveryTargetOptions `json:"options,omitempty"`
+	// StartTime is set once the cluster has been stopped, its pods bootstrap from the archive from then on
+	StartTime      *metav1.Time `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	Error          string       `json:"error,omitempty"`
+}
+
+// PromotionStatus describes the promotion of a standby cluster to a primary accepting writes
+type PromotionStatus struct {
+	Phase BackupRequestPhase `json:"phase"`
+	// Standby is the standby section removed from the manifest
+	Standby        *StandbyDescription `json:"standby,omitempty"`
+	StartTime      *metav1.Time        `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time        `json:"completionTime,omitempty"`
+	// Error is the last failed attempt to promote the cluster, the operator retries on every sync
+	Error string `json:"error,omitempty"`
+}
+
+// SwitchoverStatus describes the move of the master role requested by setting the annotation to RequestedAt
+type SwitchoverStatus struct {
+	RequestedAt string             `json:"requestedAt"`
+	Phase       BackupRequestPhase `json:"phase"`
+	// Candidate is the pod requested to become the master, any ready replica when empty
+	Candidate string `json:"candidate,omitempty"`
+	// From is empty when there was no master to switch over from and Patroni has been asked to fail over
+	From           string       `json:"from,omitempty"`
+	To             string       `json:"to,omitempty"`
+	StartTime      *metav1.Time `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	Error          string       `json:"error,omitempty"`
+}
+
+// BackupVerificationStatus describes the last job restoring the latest base backup of the cluster
+type BackupVerificationStatus struct {
+	JobName        string             `json:"jobName"`
+	Phase          BackupRequestPhase `json:"phase"`
+	StartTime      *metav1.Time       `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time       `json:"completionTime,omitempty"`
+	Error          string             `json:"error,omitempty"`
+}
+
+// BackupCleanupStatus describes the base backups removed from the WAL archive, together with the WAL older than them
+type BackupCleanupStatus struct {
+	Time           metav1.Time `json:"time"`
+	DeletedBackups []string    `json:"deletedBackups,omitempty"`
+	// ReclaimedBytes is the size of the deleted base backups reported by the WAL tool, without the WAL
+	ReclaimedBytes int64  `json:"reclaimedBytes"`
+	Error          string `json:"error,omitempty"`
+	// DeferredBy lists the standbys and the recent clones still reading the archive, which defer the cleanup
+	DeferredBy []string `json:"deferredBy,omitempty"`
+}
+
+// BackupRequestPhase is the state of a requested backup
+type BackupRequestPhase string
+
+// possible phases of a requested backup
+const (
+	BackupRequestRunning   BackupRequestPhase = "Running"
+	BackupRequestSucceeded BackupRequestPhase = "Succeeded"
+	BackupRequestFailed    BackupRequestPhase = "Failed"
+)
+
+// BackupRequestStatus is the result of the backup requested by setting the annotation to RequestedAt
+type BackupRequestStatus struct {
+	RequestedAt    string             `json:"requestedAt"`
+	Phase          BackupRequestPhase `json:"phase"`
+	StartTime      *metav1.Time       `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time       `json:"completionTime,omitempty"`
+	// JobName is the job dumping the databases for the logical backups
+	JobName string `json:"jobName,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BackupStatus describes the last base backup of the cluster and the state of its WAL archiving
+type BackupStatus struct {
+	LastBaseBackupTime *metav1.Time `json:"lastBaseBackupTime,omitempty"`
+	LastArchivedWAL    string       `json:"lastArchivedWal,omitempty"`
+	LastArchivedTime   *metav1.Time `json:"lastArchivedTime,omitempty"`
+	LastFailedWAL      string       `json:"lastFailedWal,omitempty"`
+	LastFailedTime     *metav1.Time `json:"lastFailedTime,omitempty"`
+	// ArchiveLagSeconds is the time since the last WAL segment was archived
+	ArchiveLagSeconds *int64      `json:"archiveLagSeconds,omitempty"`
+	CheckTime         metav1.Time `json:"checkTime"`
+}
+
+// ClusterCondition describes an aspect of the state of the cluster, in the format of the Kubernetes conditions
+type ClusterCondition struct {
+	Type               string             `json:"type"`
+	Status             v1.ConditionStatus `json:"status"`
+	Reason             string             `json:"reason,omitempty"`
+	Message            string             `json:"message,omitempty"`
+	LastTransitionTime metav1.Time        `json:"lastTransitionTime"`
+}
+
+// types of the conditions of the cluster
+const (
+	ConditionBackupsHealthy    = "BackupsHealthy"
+	ConditionBackupVerified    = "BackupVerified"
+	ConditionWALArchiveHealthy = "WALArchiveHealthy"
+)
+
+// MajorVersionUpgradeStatus describes the progress of the last major version upgrade of the cluster
+type MajorVersionUpgradeStatus struct {
+	FromVersion string       `json:"fromVersion"`
+	ToVersion   string       `json:"toVersion"`
+	Mode        string       `json:"mode,omitempty"`
+	Phase       string       `json:"phase"`
+	StartTime   metav1.Time  `json:"startTime"`
+	EndTime     *metav1.Time `json:"endTime,omitempty"`
+	Error       string       `json:"error,omitempty"`
+	// GreenCluster is the cluster running the new version in the bluegreen mode
+	GreenCluster string `json:"greenCluster,omitempty"`
+}
+
+// possible modes of the major version upgrade
+const (
+	MajorUpgradeModeInPlace   = "inplace"
+	MajorUpgradeModeBlueGreen = "bluegreen"
+)
+
+// MajorUpgradeDescription describes how the major version of the cluster is upgraded
+type MajorUpgradeDescription struct {
+	// Mode is either inplace, the default, or bluegreen
+	Mode string `json:"mode,omitempty"`
+	// Switchover approves pointing the master service to the cluster running the new version in the bluegreen mode
+	Switchover bool `json:"switchover,omitempty"`
+}
+
+// VolumeStatus describes the state of a persistent volume claim of the cluster
+type VolumeStatus struct {
+	ClaimName      string       `json:"claimName"`
+	VolumeName     string       `json:"volumeName,omitempty"`
+	Capacity       string       `json:"capacity,omitempty"`
+	UsedBytes      *int64       `json:"usedBytes,omitempty"`
+	LastResizeTime *metav1.Time `json:"lastResizeTime,omitempty"`
+	ResizeError    string       `json:"resizeError,omitempty"`
 }
 
 // PostgresSpec defines the specification for the PostgreSQL TPR.
@@ -106,6 +569,160 @@ type PostgresSpec struct {
 	ClusterName         string               `json:"-"`
 	Databases           map[string]string    `json:"databases,omitempty"`
 	Tolerations         []v1.Toleration      `json:"tolerations,omitempty"`
+	// StandbyCluster makes the cluster a standby of another one, replaying its WAL until promoted
+	StandbyCluster *StandbyDescription `json:"standby,omitempty"`
+	// Hibernated scales the cluster to zero pods, keeping its volumes, secrets and endpoints
+	Hibernated bool `json:"hibernated,omitempty"`
+	// MajorUpgrade chooses how to upgrade to a new major version
+	MajorUpgrade *MajorUpgradeDescription `json:"majorUpgrade,omitempty"`
+	// WALVolume is an optional separate volume for the write-ahead log
+	WALVolume *Volume `json:"walVolume,omitempty"`
+	// Tablespaces maps names of the tablespaces to the volumes that hold them
+	Tablespaces map[string]Volume `json:"tablespaces,omitempty"`
+	// SnapshotBackup enables scheduled snapshots of the master volumes
+	SnapshotBackup *SnapshotBackupDescription `json:"snapshotBackup,omitempty"`
+	// PVCRetentionPolicy overrides the operator-wide policy for the persistent volume claims of the deleted cluster
+	PVCRetentionPolicy PVCRetentionPolicy `json:"pvcRetentionPolicy,omitempty"`
+	// NodeAffinity and NodeSelector restrict the nodes the pods of the cluster run on
+	NodeAffinity *v1.NodeAffinity  `json:"nodeAffinity,omitempty"`
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// EnablePodAntiAffinity overrides the operator configuration for spreading the pods across nodes or zones
+	EnablePodAntiAffinity *bool `json:"enablePodAntiAffinity,omitempty"`
+	// PodPriorityClassName overrides the priority class of the pods from the operator configuration
+	PodPriorityClassName string `json:"podPriorityClassName,omitempty"`
+	// InitContainers run in every pod before Postgres starts, with access to the volumes of the pod
+	InitContainers []v1.Container `json:"initContainers,omitempty"`
+	// Sidecars run next to Postgres in every pod, replacing the sidecars of the operator configuration with the same name
+	Sidecars []Sidecar `json:"sidecars,omitempty"`
+	// PodAnnotations are added to the pods on top of the ones from the operator configuration
+	PodAnnotations map[string]string `json:"podAnnotations,omitempty"`
+	// EnableShmVolume overrides the operator configuration for mounting a memory volume at /dev/shm
+	EnableShmVolume *bool `json:"enableShmVolume,omitempty"`
+	// EnableParameterTuning overrides the operator configuration for deriving the memory and worker parameters of
+	// Postgres from the resource requests
+	EnableParameterTuning *bool `json:"enableParameterTuning,omitempty"`
+	// TopologySpreadConstraints replace the zone constraint of the operator configuration
+	TopologySpreadConstraints []TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+	// Autoscaling makes the operator manage numberOfInstances
+	Autoscaling *Autoscaling `json:"autoscaling,omitempty"`
+	// RestartSchedule is a cron expression in UTC telling when to roll the pods of the cluster
+	RestartSchedule string `json:"restartSchedule,omitempty"`
+	// Paused stops the operator from changing the cluster until it is unset
+	Paused bool `json:"paused,omitempty"`
+	// PreparedDatabases are created together with their schemas and roles, see PreparedDatabase
+	PreparedDatabases map[string]PreparedDatabase `json:"preparedDatabases,omitempty"`
+	// PasswordRotation overrides the password_rotation_interval_days of the operator for the users, 0 disables it
+	PasswordRotation map[string]int32 `json:"passwordRotationDays,omitempty"`
+	// SecretNamespaces maps the users to the namespaces that get copies of their credential secrets
+	SecretNamespaces map[string][]string `json:"secretNamespaces,omitempty"`
+	// RemovedUsersPolicy overrides the operator-wide policy for the roles of the users removed from the manifest
+	RemovedUsersPolicy RemovedUsersPolicy `json:"removedUsersPolicy,omitempty"`
+	// EnableOwnerReaderRoles overrides the operator configuration for the read-only login roles of the database owners
+	EnableOwnerReaderRoles *bool `json:"enableOwnerReaderRoles,omitempty"`
+	// UserRoles lists the roles the users of the manifest are members of, the other memberships of those users are revoked
+	UserRoles map[string][]string `json:"userRoles,omitempty"`
+	// LDAP adds the pg_hba rule authenticating the members of its role against the directory
+	LDAP *LDAP `json:"ldap,omitempty"`
+	// EnableLogicalBackup makes the operator run a CronJob dumping the databases into the logical backup bucket
+	EnableLogicalBackup bool `json:"enableLogicalBackup,omitempty"`
+	// LogicalBackupSchedule overrides the logical_backup_schedule of the operator, in UTC
+	LogicalBackupSchedule string `json:"logicalBackupSchedule,omitempty"`
+	// LogicalBackupDatabases are dumped one by one instead of the whole cluster with pg_dumpall
+	LogicalBackupDatabases []string `json:"logicalBackupDatabases,omitempty"`
+	// WALTool overrides the wal_tool of the operator, wal-e or wal-g, i.e. to migrate the clusters one by one
+	WALTool string `json:"walTool,omitempty"`
+	// GCSArchive makes the cluster archive to Google Cloud Storage instead of the wal_gs_bucket of the operator
+	GCSArchive *GCSArchive `json:"gcsArchive,omitempty"`
+	// AzureArchive makes the cluster archive to Azure Blob Storage with WAL-G
+	AzureArchive *AzureArchive `json:"azureArchive,omitempty"`
+	// S3Endpoint overrides the S3 endpoint settings of the operator for the WAL archive and the logical backups
+	S3Endpoint *S3Endpoint `json:"s3Endpoint,omitempty"`
+	// BackupRetention overrides the retention of the base backups, the WAL and the logical backups of the operator
+	BackupRetention *BackupRetention `json:"backupRetention,omitempty"`
+	// PgBackRest makes the cluster archive and back up with pgBackRest instead of WAL-E or WAL-G
+	PgBackRest *PgBackRest `json:"pgbackrest,omitempty"`
+	// BackupVerification schedules the restore of the latest base backup into a throwaway pod
+	BackupVerification *BackupVerification `json:"backupVerification,omitempty"`
+	// BackupEncryption encrypts the WAL and the base backups uploaded by WAL-G or pgBackRest
+	BackupEncryption *BackupEncryption `json:"backupEncryption,omitempty"`
+	// IAMRole is the ARN of the AWS IAM role of the pods, overriding the kube_iam_role of the operator
+	IAMRole string `json:"iamRole,omitempty"`
+	// RestoreOptions refine the point-in-time recovery of the in-place restores of the cluster
+	RestoreOptions *RecoveryTargetOptions `json:"restoreOptions,omitempty"`
+}
+
+// BackupEncryption names the KMS key of the server-side encryption in S3 and the secret with the key of the
+// client-side encryption, either one or both
+type BackupEncryption struct {
+	KMSKeyID string `json:"kmsKeyId,omitempty"`
+	// KeySecret is a secret in the namespace of the cluster with the key under encryption-key
+	KeySecret string `json:"keySecret,omitempty"`
+}
+
+// BackupVerification describes when the latest base backup is restored and which queries it has to pass
+type BackupVerification struct {
+	// Schedule is a cron expression in UTC, defaults to the backup_verification_schedule of the operator
+	Schedule string              `json:"schedule,omitempty"`
+	Queries  []VerificationQuery `json:"queries,omitempty"`
+}
+
+// VerificationQuery fails the verification when it fails or returns false
+type VerificationQuery struct {
+	// Database defaults to postgres
+	Database string `json:"database,omitempty"`
+	Query    string `json:"query"`
+}
+
+// PgBackRest describes the pgBackRest repository of the cluster and the schedules of its backups
+type PgBackRest struct {
+	// Stanza defaults to the name of the cluster
+	Stanza string         `json:"stanza,omitempty"`
+	Repo   PgBackRestRepo `json:"repo"`
+	// FullSchedule, DiffSchedule and IncrSchedule are cron expressions in UTC of the backups of each type
+	FullSchedule string `json:"fullSchedule,omitempty"`
+	DiffSchedule string `json:"diffSchedule,omitempty"`
+	IncrSchedule string `json:"incrSchedule,omitempty"`
+	// Options are further options of pgBackRest, i.e. repo1-retention-full: "2"
+	Options map[string]string `json:"options,omitempty"`
+}
+
+// PgBackRestRepo is either a repository in S3 or a repository host, exactly one of them must be set
+type PgBackRestRepo struct {
+	S3   *PgBackRestS3Repo   `json:"s3,omitempty"`
+	Host *PgBackRestRepoHost `json:"host,omitempty"`
+}
+
+// PgBackRestS3Repo describes a pgBackRest repository in S3 or an S3-compatible storage
+type PgBackRestS3Repo struct {
+	Bucket string `json:"bucket"`
+	Region string `json:"region"`
+	// Endpoint defaults to s3.amazonaws.com
+	Endpoint string `json:"endpoint,omitempty"`
+	// Path of the repository in the bucket, defaults to /pgbackrest
+	Path string `json:"path,omitempty"`
+	// CredentialsSecret holds the access key under key and the secret key under key-secret, the pods use their IAM
+	// role otherwise
+	CredentialsSecret string `json:"credentialsSecret,omitempty"`
+}
+
+// PgBackRestRepoHost describes a repository host running the pgBackRest TLS server
+type PgBackRestRepoHost struct {
+	Host string `json:"host"`
+	Port int32  `json:"port,omitempty"`
+	// TLSSecret holds the client certificate under tls.crt and tls.key, and the certificate of the authority under
+	// ca.crt
+	TLSSecret string `json:"tlsSecret"`
+}
+
+// BackupRetention describes how many backups the operator keeps, zero disables the cleanup
+type BackupRetention struct {
+	// BaseBackups is the number of the newest base backups to keep
+	BaseBackups *int32 `json:"baseBackups,omitempty"`
+	// Days is the number of days the cluster can be recovered to any point in time of, keeping the WAL and the base
+	// backups needed for it
+	Days *int32 `json:"days,omitempty"`
+	// LogicalBackups is the number of the newest logical backups to keep
+	LogicalBackups *int32 `json:"logicalBackups,omitempty"`
 }
 
 // PostgresqlList defines a list of PostgreSQL clusters.
@@ -116,6 +733,12 @@ type PostgresqlList struct {
 	Items []Postgresql `json:"items"`
 }
 
+var tablespaceNameRegexp = regexp.MustCompile("^[a-z][a-z0-9_]*$")
+
+var preparedNameRegexp = regexp.MustCompile("^[a-z][a-z0-9_]*$")
+
+var iamRoleARNRegexp = regexp.MustCompile(`^arn:aws[a-z-]*:iam::[0-9]{12}:role/.+$`)
+
 var weekdays = map[string]int{"Sun": 0, "Mon": 1, "Tue": 2, "Wed": 3, "Thu": 4, "Fri": 5, "Sat": 6}
 
 func parseTime(s string) (time.Time, error) {
@@ -219,6 +842,264 @@ func extractClusterName(clusterName string, teamName string) (string, error) {
 	return clusterName[teamNameLen+1:], nil
 }
 
+// validateCloneDescription checks the parameters of the clone from the WAL archive: the target time has to be an
+// RFC 3339 timestamp with the timezone and the archive path an S3 URL. Snapshots can't be combined with either.
+func validateCloneDescription(clone *CloneDescription) error {
+	if clone.EndTimestamp != "" {
+		if _, err := time.Parse(time.RFC3339, clone.EndTimestamp); err != nil {
+			return fmt.Errorf("clone timestamp %q is not an RFC 3339 timestamp with the timezone", clone.EndTimestamp)
+		}
+	}
+	if clone.S3WalPath != "" && !strings.HasPrefix(clone.S3WalPath, "s3://") {
+		return fmt.Errorf("clone WAL path %q must start with s3://", clone.S3WalPath)
+	}
+	if clone.GSWalPath != "" && !strings.HasPrefix(clone.GSWalPath, "gs://") {
+		return fmt.Errorf("clone WAL path %q must start with gs://", clone.GSWalPath)
+	}
+	if clone.AzWalPath != "" && !strings.HasPrefix(clone.AzWalPath, "azure://") {
+		return fmt.Errorf("clone WAL path %q must start with azure://", clone.AzWalPath)
+	}
+	paths := 0
+	for _, path := range []string{clone.S3WalPath, clone.GSWalPath, clone.AzWalPath} {
+		if path != "" {
+			paths++
+		}
+	}
+	if paths > 1 {
+		return fmt.Errorf("clone can't have more than one of s3WalPath, gsWalPath and azWalPath")
+	}
+	if clone.Snapshot != "" && (clone.EndTimestamp != "" || paths > 0) {
+		return fmt.Errorf("clone from a snapshot can't have a timestamp or a WAL path")
+	}
+	if clone.PgBackRest && (clone.Snapshot != "" || paths > 0) {
+		return fmt.Errorf("clone from pgBackRest can't have a snapshot or a WAL path")
+	}
+	// the credentials of the source cluster are in its own namespace, out of reach of the pods of the clone
+	archiveClone := clone.EndTimestamp != "" || paths > 0
+	if clone.RecoveryTargetOptions != (RecoveryTargetOptions{}) {
+		if !archiveClone && !clone.PgBackRest {
+			return fmt.Errorf("recovery target options require a clone from the archive")
+		}
+		if err := validateRecoveryTargetOptions(&clone.RecoveryTargetOptions, clone.EndTimestamp != ""); err != nil {
+			return err
+		}
+	}
+	if clone.Namespace != "" && !archiveClone {
+		return fmt.Errorf("clone from another namespace requires a timestamp or a WAL path")
+	}
+	if clone.CredentialsSecret != "" && (!archiveClone || clone.PgBackRest || clone.GSWalPath != "") {
+		return fmt.Errorf("clone credentials are only supported for archives in S3 and Azure Blob Storage")
+	}
+	return nil
+}
+
+// validateRecoveryTargetOptions checks the timeline and the action, and that the options refining the timestamp
+// come with one.
+func validateRecoveryTargetOptions(options *RecoveryTargetOptions, withTimestamp bool) error {
+	if options.TargetTimeline != "" && options.TargetTimeline != "latest" && options.TargetTimeline != "current" {
+		if timeline, err := strconv.ParseUint(options.TargetTimeline, 10, 32); err != nil || timeline == 0 {
+			return fmt.Errorf("recovery target timeline %q must be latest, current or a timeline number",
+				options.TargetTimeline)
+		}
+	}
+	switch options.TargetAction {
+	case "", RecoveryTargetActionPromote, RecoveryTargetActionPause:
+	default:
+		return fmt.Errorf("recovery target action %q must be %s or %s", options.TargetAction,
+			RecoveryTargetActionPromote, RecoveryTargetActionPause)
+	}
+	if !withTimestamp && (options.TargetInclusive != nil || options.TargetAction != "") {
+		return fmt.Errorf("recovery target inclusive and action require a timestamp")
+	}
+	return nil
+}
+
+// validatePgBackRest checks that the repository is either in S3 or on a repository host and that the schedules
+// parse. Only the S3 repositories are backed up by the operator, the repository hosts run their backups themselves.
+func validatePgBackRest(pgBackRest *PgBackRest) error {
+	repo := pgBackRest.Repo
+	if (repo.S3 == nil) == (repo.Host == nil) {
+		return fmt.Errorf("pgBackRest requires exactly one of the s3 and host repositories")
+	}
+	if repo.S3 != nil && (repo.S3.Bucket == "" || repo.S3.Region == "") {
+		return fmt.Errorf("pgBackRest S3 repository requires a bucket and a region")
+	}
+	if repo.Host != nil && (repo.Host.Host == "" || repo.Host.TLSSecret == "") {
+		return fmt.Errorf("pgBackRest repository host requires a host and a TLS secret")
+	}
+	for _, schedule := range []string{pgBackRest.FullSchedule, pgBackRest.DiffSchedule, pgBackRest.IncrSchedule} {
+		if schedule == "" {
+			continue
+		}
+		if repo.S3 == nil {
+			return fmt.Errorf("pgBackRest backups of a repository host can't be scheduled by the operator")
+		}
+		if _, err := cron.Parse(schedule); err != nil {
+			return fmt.Errorf("could not parse pgBackRest schedule: %v", err)
+		}
+	}
+	return nil
+}
+
+// validateStandbyDescription checks that the standby has exactly one source of the WAL: an S3 or GCS URL of the
+// archive or the host of the source cluster.
+func validateStandbyDescription(standby *StandbyDescription) error {
+	sources := 0
+	for _, source := range []string{standby.S3WalPath, standby.GSWalPath, standby.StandbyHost} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("standby cluster requires exactly one of s3WalPath, gsWalPath or standbyHost")
+	}
+	if standby.S3WalPath != "" && !strings.HasPrefix(standby.S3WalPath, "s3://") {
+		return fmt.Errorf("standby WAL path %q must start with s3://", standby.S3WalPath)
+	}
+	if standby.GSWalPath != "" && !strings.HasPrefix(standby.GSWalPath, "gs://") {
+		return fmt.Errorf("standby WAL path %q must start with gs://", standby.GSWalPath)
+	}
+	if standby.StandbyPort != "" {
+		if port, err := strconv.Atoi(standby.StandbyPort); err != nil || port <= 0 || port > 65535 {
+			return fmt.Errorf("standby port %q is not a valid port number", standby.StandbyPort)
+		}
+	}
+	return nil
+}
+
+// validateInitContainers checks that the init containers have unique names and an image.
+func validateInitContainers(containers []v1.Container) error {
+	names := make(map[string]bool)
+	for _, container := range containers {
+		if container.Name == "" || container.Image == "" {
+			return fmt.Errorf("init containers require a name and an image")
+		}
+		if names[container.Name] {
+			return fmt.Errorf("duplicate init container name %q", container.Name)
+		}
+		names[container.Name] = true
+	}
+	return nil
+}
+
+// validateSidecars checks that the sidecars have unique names, different from the containers of the operator, and an image.
+func validateSidecars(sidecars []Sidecar) error {
+	names := map[string]bool{"postgres": true, "scalyr-sidecar": true}
+	for _, sidecar := range sidecars {
+		if sidecar.Name == "" || sidecar.DockerImage == "" {
+			return fmt.Errorf("sidecars require a name and an image")
+		}
+		if names[sidecar.Name] {
+			return fmt.Errorf("duplicate or reserved sidecar name %q", sidecar.Name)
+		}
+		names[sidecar.Name] = true
+	}
+	return nil
+}
+
+// validateTopologySpreadConstraints checks the constraints the API server would reject only when the pods are created.
+func validateTopologySpreadConstraints(constraints []TopologySpreadConstraint) error {
+	for _, constraint := range constraints {
+		if constraint.MaxSkew <= 0 {
+			return fmt.Errorf("maxSkew of the topology spread constraint must be positive")
+		}
+		if constraint.TopologyKey == "" {
+			return fmt.Errorf("topology spread constraint requires a topologyKey")
+		}
+		if constraint.WhenUnsatisfiable != DoNotSchedule && constraint.WhenUnsatisfiable != ScheduleAnyway {
+			return fmt.Errorf("whenUnsatisfiable of the topology spread constraint must be %s or %s", DoNotSchedule, ScheduleAnyway)
+		}
+	}
+	return nil
+}
+
+func validateAutoscaling(autoscaling *Autoscaling) error {
+	if autoscaling == nil {
+		return nil
+	}
+	if autoscaling.MinInstances < 1 || autoscaling.MaxInstances < autoscaling.MinInstances {
+		return fmt.Errorf("autoscaling requires 1 <= minInstances <= maxInstances")
+	}
+	if autoscaling.TargetConnections <= 0 {
+		return fmt.Errorf("targetConnectionsPerInstance of the autoscaling must be positive")
+	}
+	return nil
+}
+
+// validatePreparedDatabases checks the names the roles of the prepared databases are derived from.
+func validatePreparedDatabases(databases map[string]PreparedDatabase, declared map[string]string) error {
+	for datname, database := range databases {
+		if !preparedNameRegexp.MatchString(datname) {
+			return fmt.Errorf("prepared database name %q must start with a lowercase letter and contain only lowercase letters, digits and underscores", datname)
+		}
+		if _, ok := declared[datname]; ok {
+			return fmt.Errorf("database %q is both in databases and preparedDatabases", datname)
+		}
+		for _, schema := range database.Schemas {
+			if !preparedNameRegexp.MatchString(schema) {
+				return fmt.Errorf("schema name %q of the prepared database %q must start with a lowercase letter and contain only lowercase letters, digits and underscores", schema, datname)
+			}
+		}
+	}
+	return nil
+}
+
+// validatePgHba checks the connection types of the pg_hba rules, as Postgres keeps the previous rules when it can't
+// load the new ones.
+func validatePgHba(rules []string) error {
+	for _, rule := range rules {
+		fields := strings.Fields(rule)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			return fmt.Errorf("pg_hba rule %q must not be empty", rule)
+		}
+		switch fields[0] {
+		case "local", "host", "hostssl", "hostnossl", "hostgssenc", "hostnogssenc":
+		default:
+			return fmt.Errorf("pg_hba rule %q has unknown connection type %q", rule, fields[0])
+		}
+		// type, database, user, the address except for local connections, and the method
+		minFields := 5
+		if fields[0] == "local" {
+			minFields = 4
+		}
+		if len(fields) < minFields {
+			return fmt.Errorf("pg_hba rule %q has too few fields", rule)
+		}
+	}
+	return nil
+}
+
+// validateLDAP checks the LDAP settings, the values must not break the quoting of the options in the pg_hba rule.
+func validateLDAP(ldap *LDAP) error {
+	if ldap.Server == "" || ldap.BaseDN == "" {
+		return fmt.Errorf("LDAP server and base DN must be set")
+	}
+	if ldap.Scheme != "" && ldap.Scheme != "ldap" && ldap.Scheme != "ldaps" {
+		return fmt.Errorf("LDAP scheme %q must be either ldap or ldaps", ldap.Scheme)
+	}
+	if ldap.Port < 0 || ldap.Port > 65535 {
+		return fmt.Errorf("LDAP port %d is out of range", ldap.Port)
+	}
+	if ldap.SearchAttribute != "" && ldap.SearchFilter != "" {
+		return fmt.Errorf("LDAP search attribute and search filter are mutually exclusive")
+	}
+	for _, value := range []string{ldap.Server, ldap.BaseDN, ldap.SearchAttribute, ldap.SearchFilter, ldap.Role,
+		ldap.AllowedAddresses} {
+		if strings.ContainsAny(value, "\"\n") {
+			return fmt.Errorf("LDAP setting %q must not contain double quotes or line breaks", value)
+		}
+	}
+	if strings.ContainsAny(ldap.Role+ldap.AllowedAddresses, " \t") {
+		return fmt.Errorf("LDAP role and allowed addresses must not contain whitespace")
+	}
+	for _, user := range ldap.Users {
+		if user == "" || user == ldap.Role {
+			return fmt.Errorf("invalid LDAP user %q", user)
+		}
+	}
+	return nil
+}
+
 type postgresqlListCopy PostgresqlList
 type postgresqlCopy Postgresql
 
@@ -249,13 +1130,219 @@ func (p *Postgresql) UnmarshalJSON(data []byte) error {
 		tmp2.Error = err
 		tmp2.Status = ClusterStatusInvalid
 	}
-	// The assumption below is that a cluster to clone, if any, belongs to the same team
+	// The cluster to clone, if any, belongs to the same team unless the clone names its team
 	if tmp2.Spec.Clone.ClusterName != "" {
-		_, err := extractClusterName(tmp2.Spec.Clone.ClusterName, tmp2.Spec.TeamID)
+		cloneTeamID := tmp2.Spec.TeamID
+		if tmp2.Spec.Clone.TeamID != "" {
+			cloneTeamID = tmp2.Spec.Clone.TeamID
+		}
+		_, err := extractClusterName(tmp2.Spec.Clone.ClusterName, cloneTeamID)
 		if err != nil {
 			tmp2.Error = fmt.Errorf("%s for the cluster to clone", err)
 			tmp2.Spec.Clone = CloneDescription{}
 			tmp2.Status = ClusterStatusInvalid
+		} else if err := validateCloneDescription(&tmp2.Spec.Clone); err != nil {
+			tmp2.Error = err
+			tmp2.Spec.Clone = CloneDescription{}
+			tmp2.Status = ClusterStatusInvalid
+		}
+	} else if tmp2.Spec.Clone.Snapshot != "" {
+		tmp2.Error = fmt.Errorf("cluster to clone is required when cloning from a snapshot")
+		tmp2.Status = ClusterStatusInvalid
+	}
+	if tmp2.Spec.Clone.Backup != "" && tmp2.Spec.Clone != (CloneDescription{Backup: tmp2.Spec.Clone.Backup}) {
+		tmp2.Error = fmt.Errorf("clone from a backup can't have other clone parameters")
+		tmp2.Spec.Clone = CloneDescription{}
+		tmp2.Status = ClusterStatusInvalid
+	}
+	if tmp2.Spec.StandbyCluster != nil {
+		if err := validateStandbyDescription(tmp2.Spec.StandbyCluster); err != nil {
+			tmp2.Error = err
+			tmp2.Status = ClusterStatusInvalid
+		} else if tmp2.Spec.Clone.ClusterName != "" {
+			tmp2.Error = fmt.Errorf("standby cluster can't be a clone")
+			tmp2.Status = ClusterStatusInvalid
+		}
+	}
+	if patroni := tmp2.Spec.Patroni; !patroni.SynchronousMode && (patroni.SynchronousModeStrict || patroni.SynchronousNodeCount > 0) {
+		tmp2.Error = fmt.Errorf("synchronous_mode_strict and synchronous_node_count require synchronous_mode")
+		tmp2.Status = ClusterStatusInvalid
+	}
+	if upgrade := tmp2.Spec.MajorUpgrade; upgrade != nil && upgrade.Mode != "" &&
+		upgrade.Mode != MajorUpgradeModeInPlace && upgrade.Mode != MajorUpgradeModeBlueGreen {
+		tmp2.Error = fmt.Errorf("unknown major upgrade mode %q", upgrade.Mode)
+		tmp2.Status = ClusterStatusInvalid
+	}
+	if tmp2.Spec.SnapshotBackup != nil {
+		if interval, err := time.ParseDuration(tmp2.Spec.SnapshotBackup.Interval); err != nil || interval <= 0 {
+			tmp2.Error = fmt.Errorf("snapshot backup interval %q must be a positive duration", tmp2.Spec.SnapshotBackup.Interval)
+			tmp2.Status = ClusterStatusInvalid
+		}
+	}
+	if tmp2.Spec.Volume.Ephemeral && (tmp2.Spec.SnapshotBackup != nil || tmp2.Spec.Clone.Snapshot != "") {
+		tmp2.Error = fmt.Errorf("snapshot backups and cloning from a snapshot require a persistent data volume")
+		tmp2.Status = ClusterStatusInvalid
+	}
+	if policy := tmp2.Spec.PVCRetentionPolicy; policy != "" && !policy.Valid() {
+		tmp2.Error = fmt.Errorf("unknown pvc retention policy %q", policy)
+		tmp2.Status = ClusterStatusInvalid
+	}
+	if policy := tmp2.Spec.RemovedUsersPolicy; policy != "" && !policy.Valid() {
+		tmp2.Error = fmt.Errorf("unknown removed users policy %q", policy)
+		tmp2.Status = ClusterStatusInvalid
+	}
+	if err := validateInitContainers(tmp2.Spec.InitContainers); err != nil {
+		tmp2.Error = err
+		tmp2.Status = ClusterStatusInvalid
+	}
+	if err := validateSidecars(tmp2.Spec.Sidecars); err != nil {
+		tmp2.Error = err
+		tmp2.Status = ClusterStatusInvalid
+	}
+	if err := validateTopologySpreadConstraints(tmp2.Spec.TopologySpreadConstraints); err != nil {
+		tmp2.Error = err
+		tmp2.Status = ClusterStatusInvalid
+	}
+	if err := validateAutoscaling(tmp2.Spec.Autoscaling); err != nil {
+		tmp2.Error = err
+		tmp2.Status = ClusterStatusInvalid
+	}
+	if tmp2.Spec.WALTool != "" && tmp2.Spec.WALTool != "wal-e" && tmp2.Spec.WALTool != "wal-g" {
+		tmp2.Error = fmt.Errorf("unknown WAL tool %q", tmp2.Spec.WALTool)
+		tmp2.Status = ClusterStatusInvalid
+	}
+	if tmp2.Spec.PgBackRest != nil {
+		if err := validatePgBackRest(tmp2.Spec.PgBackRest); err != nil {
+			tmp2.Error = err
+			tmp2.Status = ClusterStatusInvalid
+		} else if tmp2.Spec.GCSArchive != nil || tmp2.Spec.AzureArchive != nil || tmp2.Spec.WALTool != "" {
+			tmp2.Error = fmt.Errorf("cluster archiving with pgBackRest can't have a WAL tool or another archive")
+			tmp2.Status = ClusterStatusInvalid
+		}
+	} else if tmp2.Spec.Clone.PgBackRest {
+		tmp2.Error = fmt.Errorf("clone from pgBackRest requires the pgbackrest section")
+		tmp2.Status = ClusterStatusInvalid
+	}
+	if tmp2.Spec.IAMRole != "" && !iamRoleARNRegexp.MatchString(tmp2.Spec.IAMRole) {
+		tmp2.Error = fmt.Errorf("IAM role %q is not the ARN of a role", tmp2.Spec.IAMRole)
+		tmp2.Status = ClusterStatusInvalid
+	}
+	if options := tmp2.Spec.RestoreOptions; options != nil {
+		// the restores always have a timestamp
+		if err := validateRecoveryTargetOptions(options, true); err != nil {
+			tmp2.Error = fmt.Errorf("invalid restore options: %v", err)
+			tmp2.Status = ClusterStatusInvalid
+		}
+	}
+	if encryption := tmp2.Spec.BackupEncryption; encryption != nil && encryption.KMSKeyID == "" &&
+		encryption.KeySecret == "" {
+		tmp2.Error = fmt.Errorf("backup encryption requires a KMS key or a key secret")
+		tmp2.Status = ClusterStatusInvalid
+	}
+	if tmp2.Spec.GCSArchive != nil && tmp2.Spec.GCSArchive.Bucket == "" {
+		tmp2.Error = fmt.Errorf("GCS archive requires a bucket")
+		tmp2.Status = ClusterStatusInvalid
+	}
+	if endpoint := tmp2.Spec.S3Endpoint; endpoint != nil && endpoint.Endpoint != "" {
+		if err := ValidateS3Endpoint(endpoint.Endpoint); err != nil {
+			tmp2.Error = err
+			tmp2.Status = ClusterStatusInvalid
+		}
+	}
+	if azure := tmp2.Spec.AzureArchive; azure != nil {
+		if azure.StorageAccount == "" || azure.Container == "" {
+			tmp2.Error = fmt.Errorf("Azure archive requires a storage account and a container")
+			tmp2.Status = ClusterStatusInvalid
+		} else if tmp2.Spec.GCSArchive != nil {
+			tmp2.Error = fmt.Errorf("cluster can't archive to both GCS and Azure")
+			tmp2.Status = ClusterStatusInvalid
+		}
+	}
+	if retention := tmp2.Spec.BackupRetention; retention != nil {
+		for _, value := range []*int32{retention.BaseBackups, retention.Days, retention.LogicalBackups} {
+			if value != nil && *value < 0 {
+				tmp2.Error = fmt.Errorf("backup retention must not be negative")
+				tmp2.Status = ClusterStatusInvalid
+			}
+		}
+	}
+	if verification := tmp2.Spec.BackupVerification; verification != nil {
+		if verification.Schedule != "" {
+			if _, err := cron.Parse(verification.Schedule); err != nil {
+				tmp2.Error = fmt.Errorf("could not parse backup verification schedule: %v", err)
+				tmp2.Status = ClusterStatusInvalid
+			}
+		}
+		for _, query := range verification.Queries {
+			if query.Query == "" {
+				tmp2.Error = fmt.Errorf("backup verification query must not be empty")
+				tmp2.Status = ClusterStatusInvalid
+			}
+		}
+	}
+	if tmp2.Spec.LogicalBackupSchedule != "" {
+		if _, err := cron.Parse(tmp2.Spec.LogicalBackupSchedule); err != nil {
+			tmp2.Error = fmt.Errorf("could not parse logical backup schedule: %v", err)
+			tmp2.Status = ClusterStatusInvalid
+		}
+	}
+	if tmp2.Spec.RestartSchedule != "" {
+		if _, err := cron.Parse(tmp2.Spec.RestartSchedule); err != nil {
+			tmp2.Error = err
+			tmp2.Status = ClusterStatusInvalid
+		}
+	}
+	if err := validatePreparedDatabases(tmp2.Spec.PreparedDatabases, tmp2.Spec.Databases); err != nil {
+		tmp2.Error = err
+		tmp2.Status = ClusterStatusInvalid
+	}
+	if err := validatePgHba(tmp2.Spec.Patroni.PgHba); err != nil {
+		tmp2.Error = err
+		tmp2.Status = ClusterStatusInvalid
+	}
+	if _, err := PatroniDCSSettings(tmp2.Spec.Patroni.DCS); err != nil {
+		tmp2.Error = err
+		tmp2.Status = ClusterStatusInvalid
+	}
+	for username, days := range tmp2.Spec.PasswordRotation {
+		if _, ok := tmp2.Spec.Users[username]; !ok {
+			tmp2.Error = fmt.Errorf("password rotation of %q which is not a user of the manifest", username)
+			tmp2.Status = ClusterStatusInvalid
+		} else if days < 0 {
+			tmp2.Error = fmt.Errorf("password rotation interval of %q must not be negative", username)
+			tmp2.Status = ClusterStatusInvalid
+		}
+	}
+	if tmp2.Spec.LDAP != nil {
+		if err := validateLDAP(tmp2.Spec.LDAP); err != nil {
+			tmp2.Error = err
+			tmp2.Status = ClusterStatusInvalid
+		}
+	}
+	for username, roles := range tmp2.Spec.UserRoles {
+		if _, ok := tmp2.Spec.Users[username]; !ok {
+			tmp2.Error = fmt.Errorf("roles of %q which is not a user of the manifest", username)
+			tmp2.Status = ClusterStatusInvalid
+		}
+		for _, role := range roles {
+			if role == "" || role == username {
+				tmp2.Error = fmt.Errorf("invalid role %q of the user %q", role, username)
+				tmp2.Status = ClusterStatusInvalid
+			}
+		}
+	}
+	for username, namespaces := range tmp2.Spec.SecretNamespaces {
+		for _, namespace := range namespaces {
+			if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+				tmp2.Error = fmt.Errorf("invalid namespace %q for the secret of %q: %s", namespace, username, strings.Join(errs, ", "))
+				tmp2.Status = ClusterStatusInvalid
+			}
+		}
+	}
+	for name := range tmp2.Spec.Tablespaces {
+		if !tablespaceNameRegexp.MatchString(name) {
+			tmp2.Error = fmt.Errorf("tablespace name %q must start with a lowercase letter and contain only lowercase letters, digits and underscores", name)
+			tmp2.Status = ClusterStatusInvalid
 		}
 	}
 	*p = tmp2
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
 )
 
 var parseTimeTests = []struct {
@@ -393,6 +394,131 @@ func TestClusterName(t *testing.T) {
 	}
 }
 
+var cloneDescriptions = []struct {
+	in    CloneDescription
+	valid bool
+}{
+	{CloneDescription{ClusterName: "acid-batman"}, true},
+	{CloneDescription{ClusterName: "acid-batman", EndTimestamp: "2017-12-19T12:40:33+01:00"}, true},
+	{CloneDescription{ClusterName: "acid-batman", EndTimestamp: "2017-12-19 12:40:33"}, false},
+	{CloneDescription{ClusterName: "acid-batman", S3WalPath: "s3://acid-backups/spilo/acid-batman/wal"}, true},
+	{CloneDescription{ClusterName: "acid-batman", S3WalPath: "acid-backups/spilo/acid-batman/wal"}, false},
+	{CloneDescription{ClusterName: "acid-batman", Snapshot: "acid-batman-20171219-114033"}, true},
+	{CloneDescription{ClusterName: "acid-batman", Snapshot: "acid-batman-20171219-114033",
+		EndTimestamp: "2017-12-19T12:40:33+01:00"}, false},
+	{CloneDescription{ClusterName: "acid-batman", Namespace: "batman", EndTimestamp: "2017-12-19T12:40:33+01:00",
+		CredentialsSecret: "batman-archive-reader"}, true},
+	{CloneDescription{ClusterName: "acid-batman", Namespace: "batman"}, false},
+	{CloneDescription{ClusterName: "acid-batman", GSWalPath: "gs://acid-backups/spilo/acid-batman/wal",
+		CredentialsSecret: "batman-archive-reader"}, false},
+	{CloneDescription{ClusterName: "acid-batman", EndTimestamp: "2017-12-19T12:40:33+01:00",
+		RecoveryTargetOptions: RecoveryTargetOptions{TargetTimeline: "3", TargetInclusive: new(bool), TargetAction: "pause"}}, true},
+	{CloneDescription{ClusterName: "acid-batman", S3WalPath: "s3://acid-backups/spilo/acid-batman/wal",
+		RecoveryTargetOptions: RecoveryTargetOptions{TargetTimeline: "latest"}}, true},
+	{CloneDescription{ClusterName: "acid-batman", S3WalPath: "s3://acid-backups/spilo/acid-batman/wal",
+		RecoveryTargetOptions: RecoveryTargetOptions{TargetAction: "pause"}}, false},
+	{CloneDescription{ClusterName: "acid-batman", EndTimestamp: "2017-12-19T12:40:33+01:00",
+		RecoveryTargetOptions: RecoveryTargetOptions{TargetTimeline: "newest"}}, false},
+	{CloneDescription{ClusterName: "acid-batman", EndTimestamp: "2017-12-19T12:40:33+01:00",
+		RecoveryTargetOptions: RecoveryTargetOptions{TargetAction: "shutdown"}}, false},
+	{CloneDescription{ClusterName: "acid-batman", RecoveryTargetOptions: RecoveryTargetOptions{TargetTimeline: "2"}}, false},
+}
+
+func TestValidateCloneDescription(t *testing.T) {
+	for _, tt := range cloneDescriptions {
+		err := validateCloneDescription(&tt.in)
+		if (err == nil) != tt.valid {
+			t.Errorf("expected valid %t for %+v, got error: %v", tt.valid, tt.in, err)
+		}
+	}
+}
+
+var standbyDescriptions = []struct {
+	in    StandbyDescription
+	valid bool
+}{
+	{StandbyDescription{S3WalPath: "s3://acid-backups/spilo/acid-batman/wal"}, true},
+	{StandbyDescription{S3WalPath: "acid-backups/spilo/acid-batman/wal"}, false},
+	{StandbyDescription{StandbyHost: "acid-batman.default.svc.cluster.local"}, true},
+	{StandbyDescription{StandbyHost: "acid-batman.default.svc.cluster.local", StandbyPort: "5433"}, true},
+	{StandbyDescription{StandbyHost: "acid-batman.default.svc.cluster.local", StandbyPort: "postgres"}, false},
+	{StandbyDescription{S3WalPath: "s3://acid-backups/spilo/acid-batman/wal", StandbyHost: "acid-batman"}, false},
+	{StandbyDescription{}, false},
+}
+
+func TestValidateStandbyDescription(t *testing.T) {
+	for _, tt := range standbyDescriptions {
+		err := validateStandbyDescription(&tt.in)
+		if (err == nil) != tt.valid {
+			t.Errorf("expected valid %t for %+v, got error: %v", tt.valid, tt.in, err)
+		}
+	}
+}
+
+var initContainers = []struct {
+	in    []v1.Container
+	valid bool
+}{
+	{nil, true},
+	{[]v1.Container{{Name: "seed", Image: "busybox"}, {Name: "warmup", Image: "busybox"}}, true},
+	{[]v1.Container{{Name: "seed"}}, false},
+	{[]v1.Container{{Image: "busybox"}}, false},
+	{[]v1.Container{{Name: "seed", Image: "busybox"}, {Name: "seed", Image: "alpine"}}, false},
+}
+
+func TestValidateInitContainers(t *testing.T) {
+	for _, tt := range initContainers {
+		err := validateInitContainers(tt.in)
+		if (err == nil) != tt.valid {
+			t.Errorf("expected valid %t for %+v, got error: %v", tt.valid, tt.in, err)
+		}
+	}
+}
+
+func TestValidatePgHba(t *testing.T) {
+	tests := []struct {
+		rules []string
+		valid bool
+	}{
+		{nil, true},
+		{[]string{"hostssl all all 10.0.0.0/8 md5", "local all all trust", "hostssl all all all cert clientcert=1"}, true},
+		{[]string{"host all all md5"}, false},
+		{[]string{"local all trust"}, false},
+		{[]string{"hots all all all md5"}, false},
+		{[]string{""}, false},
+		{[]string{"# hostssl all all all md5"}, false},
+	}
+	for _, tt := range tests {
+		if err := validatePgHba(tt.rules); (err == nil) != tt.valid {
+			t.Errorf("expected valid %t for %q, got error: %v", tt.valid, tt.rules, err)
+		}
+	}
+}
+
+func TestPatroniDCSSettings(t *testing.T) {
+	tests := []struct {
+		dcs      map[string]string
+		settings map[string]interface{}
+		valid    bool
+	}{
+		{nil, map[string]interface{}{}, true},
+		{map[string]string{"check_timeline": "true", "master_start_timeout": "300"},
+			map[string]interface{}{"check_timeline": true, "master_start_timeout": 300}, true},
+		{map[string]string{"check_timeline": "yes"}, nil, false},
+		{map[string]string{"master_stop_timeout": "-1"}, nil, false},
+		{map[string]string{"ttl": "30"}, nil, false},
+		{map[string]string{"post_init": "/scripts/post_init.sh"}, nil, false},
+	}
+	for _, tt := range tests {
+		settings, err := PatroniDCSSettings(tt.dcs)
+		if (err == nil) != tt.valid {
+			t.Errorf("expected valid %t for %v, got error: %v", tt.valid, tt.dcs, err)
+		} else if err == nil && !reflect.DeepEqual(settings, tt.settings) {
+			t.Errorf("expected the settings %v for %v, got: %v", tt.settings, tt.dcs, settings)
+		}
+	}
+}
+
 func TestUnmarshalMaintenanceWindow(t *testing.T) {
 	for _, tt := range maintenanceWindows {
 		var m MaintenanceWindow
@@ -48,7 +48,8 @@ type syncUserOperation int
 const (
 	PGSyncUserAdd = iota
 	PGsyncUserAlter
-	PGSyncAlterSet // handle ALTER ROLE SET parameter = value
+	PGSyncAlterSet   // handle ALTER ROLE SET parameter = value
+	PGSyncUserRevoke // revoke the memberships of the roles in MemberOf
 )
 
 // PodEvent describes the event for a single Pod
@@ -67,6 +68,8 @@ type PgUser struct {
 	Flags      []string
 	MemberOf   []string
 	Parameters map[string]string
+	// ExclusiveMemberOf revokes the memberships of the role not listed in MemberOf
+	ExclusiveMemberOf bool
 }
 
 // PgUserMap maps user names to the definitions.
@@ -110,11 +113,39 @@ type ClusterStatus struct {
 	StatefulSet         *v1beta1.StatefulSet
 	PodDisruptionBudget *policyv1beta1.PodDisruptionBudget
 
-	CurrentProcess Process
-	Worker         uint32
-	Status         PostgresStatus
-	Spec           PostgresSpec
-	Error          error
+	CurrentProcess  Process
+	Worker          uint32
+	Status          PostgresStatus
+	Spec            PostgresSpec
+	VolumeSnapshots map[string]string
+	SnapshotBackups []VolumeSnapshotBackup
+	BaseBackups     []BaseBackup
+	// EncryptionViolations lists the volumes that are not encrypted as required by the operator configuration
+	EncryptionViolations []string
+	Volumes              []VolumeStatus
+	Error                error
+}
+
+// VolumeSnapshotBackup describes a snapshot-based backup consisting of snapshots of all volumes of the master pod
+type VolumeSnapshotBackup struct {
+	Name         string
+	CreationTime time.Time
+	ReadyToUse   bool
+	Snapshots    []string
+}
+
+// BaseBackup describes a base backup in the WAL archive of the cluster
+type BaseBackup struct {
+	Name       string
+	Time       time.Time
+	WALSegment string
+	// Size is the compressed size of the WAL-G backups and the expanded size of the WAL-E ones, if known, or the
+	// size the pgBackRest backups add to the repository
+	Size int64
+	// Type is the type of the pgBackRest backups: full, diff or incr
+	Type string
+	// StartTime is known for the WAL-G and pgBackRest backups only
+	StartTime time.Time
 }
 
 // WorkerStatus describes status of the worker
@@ -192,6 +223,52 @@ func (n *NamespacedName) DecodeWorker(value, operatorNamespace string) error {
 	return nil
 }
 
+// Possible kinds of the infrastructure roles sources
+const (
+	InfrastructureRolesSecret    = "secret"
+	InfrastructureRolesConfigMap = "configmap"
+)
+
+// InfrastructureRolesSource describes a secret or a config map with infrastructure roles.
+type InfrastructureRolesSource struct {
+	Kind string
+	Name NamespacedName
+}
+
+func (s InfrastructureRolesSource) String() string {
+	return fmt.Sprintf("%s %s", s.Kind, s.Name)
+}
+
+// MarshalJSON defines marshaling rule for the infrastructure roles source type.
+func (s InfrastructureRolesSource) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf("%q", s.Kind+":"+s.Name.String())), nil
+}
+
+// Decode converts a string in the [kind:]namespace/name format into the infrastructure roles source, the kind is
+// either "secret" (the default) or "configmap".
+func (s *InfrastructureRolesSource) Decode(value string) error {
+	return s.DecodeWorker(value, GetOperatorNamespace())
+}
+
+// DecodeWorker separates the decode logic to (unit) test from obtaining the operator namespace
+func (s *InfrastructureRolesSource) DecodeWorker(value, operatorNamespace string) error {
+	kind := InfrastructureRolesSecret
+	if parts := strings.SplitN(value, ":", 2); len(parts) == 2 {
+		kind, value = strings.ToLower(strings.TrimSpace(parts[0])), parts[1]
+	}
+	if kind != InfrastructureRolesSecret && kind != InfrastructureRolesConfigMap {
+		return fmt.Errorf("unknown kind of the infrastructure roles source: %q", kind)
+	}
+
+	var name NamespacedName
+	if err := name.DecodeWorker(strings.TrimSpace(value), operatorNamespace); err != nil {
+		return err
+	}
+	*s = InfrastructureRolesSource{Kind: kind, Name: name}
+
+	return nil
+}
+
 // GetOperatorNamespace assumes serviceaccount secret is mounted by kubernetes
 // Placing this func here instead of pgk/util avoids circular import
 func GetOperatorNamespace() string {
@@ -50,6 +50,31 @@ func TestNamespacedNameMarshal(t *testing.T) {
 	}
 }
 
+func TestInfrastructureRolesSourceDecode(t *testing.T) {
+	var tests = []struct {
+		s        string
+		expected InfrastructureRolesSource
+		err      bool
+	}{
+		{`roles`, InfrastructureRolesSource{InfrastructureRolesSecret, NamespacedName{Namespace: mockOperatorNamespace, Name: "roles"}}, false},
+		{`secret:team/roles`, InfrastructureRolesSource{InfrastructureRolesSecret, NamespacedName{Namespace: "team", Name: "roles"}}, false},
+		{`configmap:roles`, InfrastructureRolesSource{InfrastructureRolesConfigMap, NamespacedName{Namespace: mockOperatorNamespace, Name: "roles"}}, false},
+		{`ConfigMap: env/roles`, InfrastructureRolesSource{InfrastructureRolesConfigMap, NamespacedName{Namespace: "env", Name: "roles"}}, false},
+		{`volume:roles`, InfrastructureRolesSource{}, true},
+		{`configmap:`, InfrastructureRolesSource{}, true},
+	}
+	for _, tt := range tests {
+		var actual InfrastructureRolesSource
+		err := actual.DecodeWorker(tt.s, mockOperatorNamespace)
+		if (err != nil) != tt.err {
+			t.Errorf("%q: expected error %t, got: %v", tt.s, tt.err, err)
+		}
+		if actual != tt.expected {
+			t.Errorf("%q: expected: %#v, got %#v", tt.s, tt.expected, actual)
+		}
+	}
+}
+
 func TestNamespacedNameError(t *testing.T) {
 	for _, tt := range nnErr {
 		var actual NamespacedName
@@ -0,0 +1,75 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const timeout = 10 * time.Second
+
+// Alert is the payload posted to the webhook when an alert of a cluster starts or stops firing
+type Alert struct {
+	Cluster   string            `json:"cluster"`
+	Namespace string            `json:"namespace"`
+	Reason    string            `json:"reason"`
+	Message   string            `json:"message"`
+	Firing    bool              `json:"firing"`
+	Time      time.Time         `json:"time"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+// Interface describes the alert receivers
+type Interface interface {
+	Send(alert Alert) error
+}
+
+// Webhook posts the alerts as JSON to a URL
+type Webhook struct {
+	url        string
+	httpClient *http.Client
+	logger     *logrus.Entry
+}
+
+// New creates the webhook client, which drops the alerts when the URL is empty
+func New(url string, logger *logrus.Entry) *Webhook {
+	return &Webhook{
+		url:        url,
+		httpClient: &http.Client{Timeout: timeout},
+		logger:     logger,
+	}
+}
+
+// Send posts the alert to the webhook, any 2xx response counts as delivered
+func (w *Webhook) Send(alert Alert) error {
+	if w.url == "" {
+		return nil
+	}
+	buf := &bytes.Buffer{}
+	if err := json.NewEncoder(buf).Encode(alert); err != nil {
+		return fmt.Errorf("could not encode json: %v", err)
+	}
+
+	w.logger.Debugf("posting the alert %q to the webhook", alert.Reason)
+	resp, err := w.httpClient.Post(w.url, "application/json", buf)
+	if err != nil {
+		return fmt.Errorf("could not make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		bodyBytes, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("could not read response: %v", err)
+		}
+
+		return fmt.Errorf("webhook returned %d: '%s'", resp.StatusCode, string(bodyBytes))
+	}
+
+	return nil
+}
@@ -2,12 +2,17 @@ package config
 
 import (
 	"encoding/json"
+	"path"
 	"strings"
 	"time"
 
 	"fmt"
 
+	"k8s.io/apimachinery/pkg/api/resource"
+
 	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/cron"
 )
 
 // CRD describes CustomResourceDefinition specific configuration parameters
@@ -34,20 +39,59 @@ type Resources struct {
 	DefaultMemoryLimit      string            `name:"default_memory_limit" default:"1Gi"`
 	PodEnvironmentConfigMap string            `name:"pod_environment_configmap" default:""`
 	NodeReadinessLabel      map[string]string `name:"node_readiness_label" default:""`
+	MasterSwitchoverOnDrain bool              `name:"enable_master_switchover_on_drain" default:"true"`
+	NodeDrainTaints         []string          `name:"node_drain_taints" default:"node.kubernetes.io/unschedulable,ToBeDeletedByClusterAutoscaler,aws-node-termination-handler/spot-itn,cloud.google.com/impending-node-termination"`
+	SpotNodeLabel           map[string]string `name:"spot_node_label" default:""`
+	SpotInterruptionReasons []string          `name:"spot_interruption_event_reasons" default:"SpotInterruption,PreemptScheduled"`
+	EnablePodAntiAffinity   bool              `name:"enable_pod_antiaffinity" default:"false"`
+	PodAntiAffinityTopology string            `name:"pod_antiaffinity_topology_key" default:"kubernetes.io/hostname"`
+	PodAntiAffinityMode     string            `name:"pod_antiaffinity_mode" default:"required"`
+	PodPriorityClassName    string            `name:"pod_priority_class_name"`
+	SidecarImages           map[string]string `name:"sidecar_docker_images"`
+	PodAnnotations          map[string]string `name:"pod_annotations"`
+	EnableShmVolume         bool              `name:"enable_shm_volume" default:"true"`
+	EnableParameterTuning   bool              `name:"enable_parameter_tuning" default:"false"`
+	TopologySpreadMaxSkew   int32             `name:"topology_spread_max_skew" default:"0"`
+	TopologySpreadKey       string            `name:"topology_spread_key" default:"topology.kubernetes.io/zone"`
 	MaxInstances            int32             `name:"max_instances" default:"-1"`
 	MinInstances            int32             `name:"min_instances" default:"-1"`
 }
 
 // Auth describes authentication specific configuration parameters
 type Auth struct {
-	SecretNameTemplate            stringTemplate      `name:"secret_name_template" default:"{username}.{cluster}.credentials.{tprkind}.{tprgroup}"`
-	PamRoleName                   string              `name:"pam_role_name" default:"zalandos"`
-	PamConfiguration              string              `name:"pam_configuration" default:"https://info.example.com/oauth2/tokeninfo?access_token= uid realm=/employees"`
-	TeamsAPIUrl                   string              `name:"teams_api_url" default:"https://teams.example.com/api/"`
-	OAuthTokenSecretName          spec.NamespacedName `name:"oauth_token_secret_name" default:"postgresql-operator"`
-	InfrastructureRolesSecretName spec.NamespacedName `name:"infrastructure_roles_secret_name"`
-	SuperUsername                 string              `name:"super_username" default:"postgres"`
-	ReplicationUsername           string              `name:"replication_username" default:"standby"`
+	SecretNameTemplate            stringTemplate                   `name:"secret_name_template" default:"{username}.{cluster}.credentials.{tprkind}.{tprgroup}"`
+	SecretLabels                  map[string]string                `name:"secret_labels"`
+	SecretAnnotations             map[string]string                `name:"secret_annotations"`
+	PamRoleName                   string                           `name:"pam_role_name" default:"zalandos"`
+	PamConfiguration              string                           `name:"pam_configuration" default:"https://info.example.com/oauth2/tokeninfo?access_token= uid realm=/employees"`
+	TeamsAPIUrl                   string                           `name:"teams_api_url" default:"https://teams.example.com/api/"`
+	TeamsConfigMapName            spec.NamespacedName              `name:"teams_config_map_name"`
+	OAuthTokenSecretName          spec.NamespacedName              `name:"oauth_token_secret_name" default:"postgresql-operator"`
+	InfrastructureRolesSecretName spec.NamespacedName              `name:"infrastructure_roles_secret_name"`
+	InfrastructureRolesSources    []spec.InfrastructureRolesSource `name:"infrastructure_roles_sources"`
+	AzureCredentialsSecretName    spec.NamespacedName              `name:"azure_credentials_secret_name"`
+	CephCredentialsSecretName     spec.NamespacedName              `name:"ceph_credentials_secret_name"`
+	SuperUsername                 string                           `name:"super_username" default:"postgres"`
+	ReplicationUsername           string                           `name:"replication_username" default:"standby"`
+	CredentialsBackends           []string                         `name:"credentials_backends" default:"kubernetes"`
+}
+
+// Vault holds the configuration of the HashiCorp Vault backend for the credentials
+type Vault struct {
+	VaultAddress         string              `name:"vault_address"`
+	VaultKVMount         string              `name:"vault_kv_mount" default:"secret"`
+	VaultPathTemplate    stringTemplate      `name:"vault_path_template" default:"postgres/{namespace}/{cluster}/{username}"`
+	VaultAuthPath        string              `name:"vault_auth_path" default:"kubernetes"`
+	VaultAuthRole        string              `name:"vault_auth_role" default:"postgres-operator"`
+	VaultTokenSecretName spec.NamespacedName `name:"vault_token_secret_name"`
+	VaultInfraRolesPath  string              `name:"vault_infrastructure_roles_path"`
+}
+
+// SecretsManager holds the configuration of the AWS Secrets Manager backend for the credentials
+type SecretsManager struct {
+	SecretsManagerRegion   string         `name:"aws_secrets_manager_region" default:"eu-central-1"`
+	SecretsManagerTemplate stringTemplate `name:"aws_secrets_manager_name_template" default:"postgres/{namespace}/{cluster}/{username}"`
+	SecretsManagerKMSKeyID string         `name:"aws_secrets_manager_kms_key_id"`
 }
 
 // Scalyr holds the configuration for the Scalyr Agent sidecar for log shipping:
@@ -67,6 +111,8 @@ type Config struct {
 	Resources
 	Auth
 	Scalyr
+	Vault
+	SecretsManager
 	WatchedNamespace         string            `name:"watched_namespace"` // special values: "*" means 'watch all namespaces', the empty string "" means 'watch a namespace where operator is deployed to'
 	EtcdHost                 string            `name:"etcd_host" default:"etcd-client.default.svc.cluster.local:2379"`
 	DockerImage              string            `name:"docker_image" default:"registry.opensource.zalan.do/acid/spiloprivate-9.6:1.2-p4"`
@@ -74,23 +120,85 @@ type Config struct {
 	DbHostedZone             string            `name:"db_hosted_zone" default:"db.example.com"`
 	EtcdScope                string            `name:"etcd_scope" default:"service"`
 	WALES3Bucket             string            `name:"wal_s3_bucket"`
+	WALTool                  string            `name:"wal_tool" default:"wal-e"`
+	WALGSBucket              string            `name:"wal_gs_bucket"`
+	GCPCredentialsSecret     string            `name:"gcp_credentials_secret"`
+	WALAZStorageAccount      string            `name:"wal_az_storage_account"`
+	WALAZContainer           string            `name:"wal_az_container"`
+	AzureCredentialsSecret   string            `name:"azure_credentials_secret"`
+	AzureClientID            string            `name:"azure_client_id"`
+	S3Endpoint               string            `name:"s3_endpoint"`
+	S3Region                 string            `name:"s3_region"`
+	S3ForcePathStyle         bool              `name:"s3_force_path_style" default:"false"`
+	S3CACertSecret           string            `name:"s3_ca_cert_secret"`
+	BackupMaxAge             time.Duration     `name:"backup_max_age" default:"26h"`
+	WALArchiveMaxLag         time.Duration     `name:"wal_archive_max_lag" default:"1h"`
+	WALArchiveAlertWebhook   string            `name:"wal_archive_alert_webhook"`
 	KubeIAMRole              string            `name:"kube_iam_role"`
+	IAMRoleInjection         string            `name:"iam_role_injection" default:"annotation"`
 	DebugLogging             bool              `name:"debug_logging" default:"true"`
 	EnableDBAccess           bool              `name:"enable_database_access" default:"true"`
 	EnableTeamsAPI           bool              `name:"enable_teams_api" default:"true"`
+	TeamsAPIType             string            `name:"teams_api_type" default:"api"`
 	EnableTeamSuperuser      bool              `name:"enable_team_superuser" default:"false"`
 	TeamAdminRole            string            `name:"team_admin_role" default:"admin"`
+	SuperuserTeams           []string          `name:"postgres_superuser_teams"`
+	SuperuserTeamsMemberOf   []string          `name:"postgres_superuser_teams_member_of"`
 	EnableLoadBalancer       bool              `name:"enable_load_balancer" default:"true"`
 	MasterDNSNameFormat      stringTemplate    `name:"master_dns_name_format" default:"{cluster}.{team}.{hostedzone}"`
 	ReplicaDNSNameFormat     stringTemplate    `name:"replica_dns_name_format" default:"{cluster}-repl.{team}.{hostedzone}"`
 	PDBNameFormat            stringTemplate    `name:"pdb_name_format" default:"postgres-{cluster}-pdb"`
 	Workers                  uint32            `name:"workers" default:"4"`
 	APIPort                  int               `name:"api_port" default:"8080"`
+	EnableAPITriggers        bool              `name:"enable_api_triggers" default:"false"`
 	RingLogLines             int               `name:"ring_log_lines" default:"100"`
 	ClusterHistoryEntries    int               `name:"cluster_history_entries" default:"1000"`
 	TeamAPIRoleConfiguration map[string]string `name:"team_api_role_configuration" default:"log_statement:all"`
 	PodTerminateGracePeriod  time.Duration     `name:"pod_terminate_grace_period" default:"5m"`
 	ProtectedRoles           []string          `name:"protected_role_names" default:"admin"`
+	SnapshotBeforeResize     bool              `name:"snapshot_volumes_before_resize" default:"false"`
+	RequireVolumeEncryption  bool              `name:"require_volume_encryption" default:"false"`
+	VolumeEncryptionKey      string            `name:"volume_encryption_key"`
+	PVCRetentionPolicy       string            `name:"pvc_retention_policy" default:"delete"`
+	RemovedUsersPolicy       string            `name:"removed_users_policy" default:"keep"`
+	VolumeResizeWorkers      uint32            `name:"volume_resize_workers" default:"4"`
+	EnableVolumeShrink       bool              `name:"enable_volume_shrink" default:"false"`
+	MaxVolumeSize            string            `name:"max_volume_size"`
+	VolumeTags               map[string]string `name:"volume_tags"`
+	EnableCloneUser          bool              `name:"enable_clone_user" default:"false"`
+	CloneAllowedSources      []string          `name:"clone_allowed_sources"`
+	CloneArchiveGrace        time.Duration     `name:"clone_archive_grace" default:"24h"`
+	EnableVersionUpgrade     bool              `name:"enable_major_version_upgrade" default:"false"`
+	DeleteAnnotationDateKey  string            `name:"delete_annotation_date_key"`
+	DeleteAnnotationNameKey  string            `name:"delete_annotation_name_key"`
+	EnableFinalBackup        bool              `name:"enable_final_backup" default:"false"`
+	LogicalBackupSchedule    string            `name:"logical_backup_schedule" default:"30 00 * * *"`
+	LogicalBackupDockerImage string            `name:"logical_backup_docker_image" default:"registry.opensource.zalan.do/acid/logical-backup"`
+	LogicalBackupS3Bucket    string            `name:"logical_backup_s3_bucket"`
+	FinalBackupTimeout       time.Duration     `name:"final_backup_timeout" default:"1h"`
+	OnDemandBackupTimeout    time.Duration     `name:"on_demand_backup_timeout" default:"2h"`
+	BackupRetentionCount     int               `name:"backup_retention_count" default:"0"`
+	BackupRetentionDays      int               `name:"backup_retention_days" default:"0"`
+	LogicalBackupRetention   int               `name:"logical_backup_retention" default:"0"`
+	VerificationSchedule     string            `name:"backup_verification_schedule" default:"0 4 * * 0"`
+	VerificationTimeout      time.Duration     `name:"backup_verification_timeout" default:"4h"`
+	RestoreTimeout           time.Duration     `name:"restore_timeout" default:"6h"`
+	AWSRoleARN               string            `name:"aws_role_arn"`
+	AWSWebIdentityTokenFile  string            `name:"aws_web_identity_token_file"`
+	VolumeResizers           []string          `name:"volume_resizers" default:"ebs,gce,azure,ceph-rbd,local"`
+	MasterResizeSwitchover   bool              `name:"master_resize_switchover" default:"false"`
+	CephAPIURL               string            `name:"ceph_api_url"`
+	OrphanedPVCPolicy        string            `name:"orphaned_pvc_policy" default:"ignore"`
+	OrphanedPVCGracePeriod   time.Duration     `name:"orphaned_pvc_grace_period" default:"24h"`
+	AutoscalingCooldown      time.Duration     `name:"autoscaling_cooldown" default:"10m"`
+	EnableDatabaseDrop       bool              `name:"enable_database_drop" default:"false"`
+	EnableDefaultPrivileges  bool              `name:"enable_default_privileges" default:"true"`
+	EnableOwnerReaderRoles   bool              `name:"enable_owner_reader_roles" default:"false"`
+	PasswordRotationDays     int               `name:"password_rotation_interval_days" default:"0"`
+	PasswordRotationGrace    time.Duration     `name:"password_rotation_grace_period" default:"0"`
+	SystemRotationDays       int               `name:"system_password_rotation_interval_days" default:"0"`
+	PasswordEncryption       string            `name:"password_encryption" default:"md5"`
+	AllowedSecretNamespaces  []string          `name:"allowed_secret_namespaces"`
 }
 
 // MustMarshal marshals the config or panics
@@ -150,5 +258,76 @@ func validate(cfg *Config) (err error) {
 	if cfg.Workers == 0 {
 		err = fmt.Errorf("number of workers should be higher than 0")
 	}
+	if !spec.PVCRetentionPolicy(cfg.PVCRetentionPolicy).Valid() {
+		err = fmt.Errorf("unknown pvc retention policy %q", cfg.PVCRetentionPolicy)
+	}
+	if !spec.RemovedUsersPolicy(cfg.RemovedUsersPolicy).Valid() {
+		err = fmt.Errorf("unknown removed users policy %q", cfg.RemovedUsersPolicy)
+	}
+	switch cfg.OrphanedPVCPolicy {
+	case constants.OrphanedPVCPolicyIgnore, constants.OrphanedPVCPolicyFlag, constants.OrphanedPVCPolicyDelete:
+	default:
+		err = fmt.Errorf("unknown orphaned pvc policy %q", cfg.OrphanedPVCPolicy)
+	}
+	if cfg.MaxVolumeSize != "" {
+		if _, parseErr := resource.ParseQuantity(cfg.MaxVolumeSize); parseErr != nil {
+			err = fmt.Errorf("could not parse maximum volume size %q: %v", cfg.MaxVolumeSize, parseErr)
+		}
+	}
+	if cfg.WALTool != constants.WALToolWALE && cfg.WALTool != constants.WALToolWALG {
+		err = fmt.Errorf("unknown WAL tool %q", cfg.WALTool)
+	}
+	if cfg.S3Endpoint != "" {
+		if endpointErr := spec.ValidateS3Endpoint(cfg.S3Endpoint); endpointErr != nil {
+			err = endpointErr
+		}
+	}
+	if cfg.BackupRetentionCount < 0 || cfg.BackupRetentionDays < 0 || cfg.LogicalBackupRetention < 0 {
+		err = fmt.Errorf("backup retention must not be negative")
+	}
+	if _, cronErr := cron.Parse(cfg.LogicalBackupSchedule); cronErr != nil {
+		err = fmt.Errorf("could not parse logical backup schedule: %v", cronErr)
+	}
+	if _, cronErr := cron.Parse(cfg.VerificationSchedule); cronErr != nil {
+		err = fmt.Errorf("could not parse backup verification schedule: %v", cronErr)
+	}
+	switch cfg.IAMRoleInjection {
+	case constants.IAMRoleInjectionAnnotation, constants.IAMRoleInjectionServiceAccount:
+	default:
+		err = fmt.Errorf("unknown IAM role injection %q", cfg.IAMRoleInjection)
+	}
+	for _, rule := range cfg.CloneAllowedSources {
+		if _, matchErr := path.Match(rule, ""); matchErr != nil || !strings.Contains(rule, "/") {
+			err = fmt.Errorf("clone allowed source %q must be a <namespace>/<cluster> pattern", rule)
+		}
+	}
+	switch cfg.TeamsAPIType {
+	case constants.TeamsAPITypeAPI, constants.TeamsAPITypeSCIM, constants.TeamsAPITypeDisabled:
+	case constants.TeamsAPITypeConfigMap:
+		if cfg.TeamsConfigMapName == (spec.NamespacedName{}) {
+			err = fmt.Errorf("teams api type %q requires the teams config map name", cfg.TeamsAPIType)
+		}
+	default:
+		err = fmt.Errorf("unknown teams api type %q", cfg.TeamsAPIType)
+	}
+	for _, placeholder := range []string{"{username}", "{cluster}"} {
+		if !strings.Contains(string(cfg.SecretNameTemplate), placeholder) {
+			err = fmt.Errorf("secret name template %q must contain the %s placeholder", cfg.SecretNameTemplate, placeholder)
+		}
+	}
+	if len(cfg.CredentialsBackends) == 0 {
+		err = fmt.Errorf("at least one credentials backend is required")
+	}
+	for _, backend := range cfg.CredentialsBackends {
+		switch backend {
+		case constants.CredentialsBackendKubernetes, constants.CredentialsBackendAWSSecretsManager:
+		case constants.CredentialsBackendVault:
+			if cfg.VaultAddress == "" {
+				err = fmt.Errorf("vault credentials backend requires the vault address")
+			}
+		default:
+			err = fmt.Errorf("unknown credentials backend %q", backend)
+		}
+	}
 	return
 }
@@ -147,7 +147,8 @@ func processField(value string, field reflect.Value) error {
 		}
 		mp := reflect.MakeMap(typ)
 		for _, pair := range pairs {
-			kvpair := strings.Split(pair, ":")
+			// values may contain colons, i.e. the tag of a docker image
+			kvpair := strings.SplitN(pair, ":", 2)
 			if len(kvpair) != 2 {
 				return fmt.Errorf("invalid map item: %q", pair)
 			}
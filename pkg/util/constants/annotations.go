@@ -6,6 +6,43 @@ const (
 	ElbTimeoutAnnotationName               = "service.beta.kubernetes.io/aws-load-balancer-connection-idle-timeout"
 	ElbTimeoutAnnotationValue              = "3600"
 	KubeIAmAnnotation                      = "iam.amazonaws.com/role"
+	IRSARoleAnnotation                     = "eks.amazonaws.com/role-arn"
 	VolumeStorateProvisionerAnnotation     = "pv.kubernetes.io/provisioned-by"
+	VolumeStorageClassAnnotation           = "volume.beta.kubernetes.io/storage-class"
+	DefaultStorageClassAnnotation          = "storageclass.kubernetes.io/is-default-class"
+	DefaultStorageClassBetaAnnotation      = "storageclass.beta.kubernetes.io/is-default-class"
+	RetainedMasterVolumeAnnotation         = "acid.zalan.do/retained-master-volume"
+	RetainedVolumeAnnotation               = "acid.zalan.do/retained-volume"
+	OrphanedVolumeAnnotation               = "acid.zalan.do/orphaned-since"
+	VolumeResizeTargetSizeAnnotation       = "acid.zalan.do/resize-target-size"
+	VolumeResizePhaseAnnotation            = "acid.zalan.do/resize-phase"
+	VolumeLastResizeTimeAnnotation         = "acid.zalan.do/last-resize-time"
+	PreResizeSnapshotAnnotation            = "acid.zalan.do/pre-resize-snapshot"
+	PreResizeSnapshotSizeAnnotation        = "acid.zalan.do/pre-resize-snapshot-size"
+	PreResizeSnapshotTimeAnnotation        = "acid.zalan.do/pre-resize-snapshot-time"
+	BlueClusterAnnotation                  = "acid.zalan.do/blue-cluster"
+	RollingUpdateRequiredAnnotation        = "acid.zalan.do/rolling-update-required"
+	PriorityClassNameAnnotation            = "acid.zalan.do/priority-class-name"
+	SkipFinalBackupAnnotation              = "acid.zalan.do/skip-final-backup"
+	TopologySpreadConstraintsAnnotation    = "acid.zalan.do/topology-spread-constraints"
+	LastScheduledRestartAnnotation         = "acid.zalan.do/last-scheduled-restart"
+	AdoptExistingAnnotation                = "acid.zalan.do/adopt-existing"
+	RenamedFromAnnotation                  = "acid.zalan.do/renamed-from"
+	SyncRequestAnnotation                  = "acid.zalan.do/sync-requested-at"
+	PasswordRotatedAnnotation              = "acid.zalan.do/password-rotated-at"
+	PreviousPasswordValidUntilAnnotation   = "acid.zalan.do/previous-password-valid-until"
+	SecretCopySourceAnnotation             = "acid.zalan.do/secret-copy-of"
+	BaseBackupRequestAnnotation            = "acid.zalan.do/basebackup-requested-at"
+	LogicalBackupRequestAnnotation         = "acid.zalan.do/logical-backup-requested-at"
+	RestoreTargetAnnotation                = "acid.zalan.do/restore-to"
+	RestoreConfirmAnnotation               = "acid.zalan.do/restore-confirm"
+	SwitchoverRequestAnnotation            = "acid.zalan.do/switchover-requested-at"
+	SwitchoverCandidateAnnotation          = "acid.zalan.do/switchover-candidate"
 	ServiceMetadataAnnotationReplaceFormat = `{"metadata":{"annotations": {"$patch":"replace", %s}}}`
 )
+
+// Phases of the volume resize stored in the VolumeResizePhaseAnnotation
+const (
+	VolumeResizePhaseProviderResized   = "provider-resized"
+	VolumeResizePhaseFilesystemResized = "filesystem-resized"
+)
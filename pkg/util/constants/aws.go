@@ -9,6 +9,10 @@ const (
 	// EBS related constants
 	EBSVolumeIDStart = "/vol-"
 	EBSProvisioner   = "kubernetes.io/aws-ebs"
+	// storage class parameters of the in-tree and the CSI EBS provisioners
+	EBSCSIProvisioner     = "ebs.csi.aws.com"
+	EBSEncryptedParameter = "encrypted"
+	EBSKMSKeyParameter    = "kmsKeyId"
 	//https://docs.aws.amazon.com/AWSEC2/latest/APIReference/API_VolumeModification.html
 	EBSVolumeStateModifying     = "modifying"
 	EBSVolumeStateOptimizing    = "optimizing"
@@ -16,4 +20,13 @@ const (
 	EBSVolumeStateCompleted     = "completed"
 	EBSVolumeResizeWaitInterval = 2 * time.Second
 	EBSVolumeResizeWaitTimeout  = 30 * time.Second
+	//https://docs.aws.amazon.com/AWSEC2/latest/APIReference/API_Snapshot.html
+	EBSSnapshotStateError = "error"
+	// session name and refresh margin of the temporary credentials of the assumed IAM role
+	AWSRoleSessionName         = "postgres-operator"
+	AWSCredentialsExpiryWindow = 5 * time.Minute
+	// ways to pass the IAM role of a cluster to its pods: the annotation of kube2iam and kiam, or the service
+	// account of IAM roles for service accounts (IRSA)
+	IAMRoleInjectionAnnotation     = "annotation"
+	IAMRoleInjectionServiceAccount = "service_account"
 )
@@ -0,0 +1,14 @@
+package constants
+
+// Azure specific constants used by other modules
+const (
+	// Azure managed disk related constants
+	AzureDiskProvisioner            = "kubernetes.io/azure-disk"
+	AzureDiskCSIProvisioner         = "disk.csi.azure.com"
+	AzureDiskEncryptionSetParameter = "diskEncryptionSetID"
+	// keys of the secret holding the service principal credentials
+	AzureSubscriptionIDKey = "subscription-id"
+	AzureTenantIDKey       = "tenant-id"
+	AzureClientIDKey       = "client-id"
+	AzureClientSecretKey   = "client-secret"
+)
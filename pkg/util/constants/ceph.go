@@ -0,0 +1,15 @@
+package constants
+
+import "time"
+
+// Ceph specific constants used by other modules
+const (
+	// RBD related constants
+	CephRBDImageSeparator  = "/"
+	CephAPIContentType     = "application/vnd.ceph.api.v1.0+json"
+	CephResizeWaitInterval = 2 * time.Second
+	CephResizeWaitTimeout  = 2 * time.Minute
+	// keys of the secret holding the credentials of the Ceph dashboard user
+	CephUsernameKey = "username"
+	CephPasswordKey = "password"
+)
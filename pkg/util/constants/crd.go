@@ -7,4 +7,10 @@ const (
 	CRDShort      = "pg"
 	CRDGroup      = "acid.zalan.do"
 	CRDApiVersion = "v1"
+
+	BackupCRDKind     = "postgresbackup"
+	BackupCRDResource = "postgresbackups"
+	BackupCRDShort    = "pgbackup"
+	// BackupFinalizer keeps the PostgresBackup of a base backup until the operator deleted the backup
+	BackupFinalizer = "acid.zalan.do/delete-backup"
 )
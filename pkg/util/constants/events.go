@@ -0,0 +1,41 @@
+package constants
+
+// Reasons of the Kubernetes events emitted by the operator
+const (
+	EventReasonVolumeResizeStarted        = "VolumeResizeStarted"
+	EventReasonVolumeResized              = "VolumeResized"
+	EventReasonVolumeResizeFailed         = "VolumeResizeFailed"
+	EventReasonFilesystemResizeFailed     = "FilesystemResizeFailed"
+	EventReasonIncompatibleVolumeProvider = "IncompatibleVolumeProvider"
+	EventReasonVolumeSnapshotTaken        = "VolumeSnapshotTaken"
+	EventReasonInvalidVolumeSpec          = "InvalidVolumeSpec"
+	EventReasonUpgradeStarted             = "UpgradeStarted"
+	EventReasonUpgraded                   = "Upgraded"
+	EventReasonUpgradeFailed              = "UpgradeFailed"
+	EventReasonUpgradeRollbackRefused     = "UpgradeRollbackRefused"
+	EventReasonFinalBackupTaken           = "FinalBackupTaken"
+	EventReasonFinalBackupFailed          = "FinalBackupFailed"
+	EventReasonAutoscaled                 = "Autoscaled"
+	EventReasonInvalidCloneTarget         = "InvalidCloneTarget"
+	EventReasonCloneDenied                = "CloneDenied"
+	EventReasonInvalidBackupEncryption    = "InvalidBackupEncryption"
+	EventReasonBackupsUnhealthy           = "BackupsUnhealthy"
+	EventReasonWALArchiveLagging          = "WALArchiveLagging"
+	EventReasonWALArchiveRecovered        = "WALArchiveRecovered"
+	EventReasonBackupRequestSucceeded     = "BackupRequestSucceeded"
+	EventReasonBackupRequestFailed        = "BackupRequestFailed"
+	EventReasonBackupsDeleted             = "BackupsDeleted"
+	EventReasonBackupCleanupFailed        = "BackupCleanupFailed"
+	EventReasonBackupCleanupDeferred      = "BackupCleanupDeferred"
+	EventReasonScheduledBackupStarted     = "ScheduledBackupStarted"
+	EventReasonBackupVerified             = "BackupVerified"
+	EventReasonBackupVerificationFailed   = "BackupVerificationFailed"
+	EventReasonRestoreStarted             = "RestoreStarted"
+	EventReasonRestored                   = "Restored"
+	EventReasonRestoreFailed              = "RestoreFailed"
+	EventReasonStandbyPromotionStarted    = "StandbyPromotionStarted"
+	EventReasonStandbyPromoted            = "StandbyPromoted"
+	EventReasonStandbyPromotionFailed     = "StandbyPromotionFailed"
+	EventReasonSwitchover                 = "Switchover"
+	EventReasonSwitchoverFailed           = "SwitchoverFailed"
+)
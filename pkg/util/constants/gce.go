@@ -0,0 +1,17 @@
+package constants
+
+import "time"
+
+// GCE specific constants used by other modules
+const (
+	// GCE PD related constants
+	GCEProvisioner               = "kubernetes.io/gce-pd"
+	GCEZoneLabel                 = "failure-domain.beta.kubernetes.io/zone"
+	GCEOperationStatusDone       = "DONE"
+	GCEVolumeResizeWaitInterval  = 2 * time.Second
+	GCEVolumeResizeWaitTimeout   = 30 * time.Second
+	GCEVolumeIDZoneDiskSeparator = "/"
+	GCEResourceNameMaxLength     = 63
+	GCECSIProvisioner            = "pd.csi.storage.gke.io"
+	GCEKMSKeyParameter           = "disk-encryption-kms-key"
+)
@@ -11,4 +11,21 @@ const (
 	QueueResyncPeriodPod  = 5 * time.Minute
 	QueueResyncPeriodTPR  = 5 * time.Minute
 	QueueResyncPeriodNode = 5 * time.Minute
+
+	SpotInterruptionEventMaxAge = 5 * time.Minute
+
+	EventSourceComponent = "postgres-operator"
+)
+
+// Tags added to the provider volumes of the cluster
+const (
+	VolumeTagCluster = "acid.zalan.do/cluster"
+	VolumeTagTeam    = "acid.zalan.do/team"
+)
+
+// Handling of the persistent volume claims that don't belong to any pod of a running cluster
+const (
+	OrphanedPVCPolicyIgnore = "ignore"
+	OrphanedPVCPolicyFlag   = "flag"
+	OrphanedPVCPolicyDelete = "delete"
 )
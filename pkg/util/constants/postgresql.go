@@ -7,7 +7,45 @@ const (
 	DataVolumeName    = "pgdata"
 	PostgresDataMount = "/home/postgres/pgdata"
 	PostgresDataPath  = PostgresDataMount + "/pgroot"
+	WALVolumeName     = "pgwal"
+	PostgresWALMount  = "/home/postgres/pgwal"
+	PostgresWALPath   = PostgresWALMount + "/pg_wal"
+
+	TablespaceVolumeNamePrefix = "tablespace-"
+	PostgresTablespacesMount   = "/home/postgres/tablespaces"
+	TablespaceDataDirectory    = "data"
+
+	ShmVolumeName = "dshm"
+	ShmVolumePath = "/dev/shm"
+
+	GCPCredentialsVolumeName = "gcp-credentials"
+	GCPCredentialsMount      = "/var/secrets/google"
+	GCPCredentialsKey        = "key.json"
+
+	AzureSASTokenKey = "sas-token"
+
+	CloneAWSAccessKeyIDKey     = "aws-access-key-id"
+	CloneAWSSecretAccessKeyKey = "aws-secret-access-key"
+
+	S3CACertVolumeName = "s3-ca-cert"
+	S3CACertMount      = "/var/secrets/s3-ca"
+	S3CACertKey        = "ca.crt"
 
 	PostgresConnectRetryTimeout = 2 * time.Minute
 	PostgresConnectTimeout      = 15 * time.Second
+
+	PatroniDefaultMaximumLagOnFailover = 1048576
+
+	WALToolWALE       = "wal-e"
+	WALToolWALG       = "wal-g"
+	WALToolPgBackRest = "pgbackrest"
+
+	BackupPushKillGrace = 1 * time.Minute // how long a timed out base backup may take to exit after it is terminated
+
+	PgBackRestTLSVolumeName = "pgbackrest-tls"
+	PgBackRestTLSMount      = "/var/secrets/pgbackrest"
+	PgBackRestS3KeyKey      = "key"
+	PgBackRestS3SecretKey   = "key-secret"
+
+	BackupEncryptionKeyKey = "encryption-key"
 )
@@ -3,6 +3,8 @@ package constants
 // Roles specific constants
 const (
 	PasswordLength         = 64
+	RoleNameMaxLength      = 63
+	CloneUserPrefix        = "clone_"
 	SuperuserKeyName       = "superuser"
 	ReplicationUserKeyName = "replication"
 	RoleFlagSuperuser      = "SUPERUSER"
@@ -13,4 +15,27 @@ const (
 	RoleFlagCreateDB       = "CREATEDB"
 	RoleFlagReplication    = "REPLICATION"
 	RoleFlagByPassRLS      = "BYPASSRLS"
+	RoleConnectionLimit    = "CONNECTION LIMIT"
+	RoleValidUntil         = "VALID UNTIL"
+	RoleValidUntilInfinity = "infinity"
+	PreviousUserSuffix     = "_previous"
+	PreviousUsernameKey    = "previous-username"
+	PreviousPasswordKey    = "previous-password"
+	DefaultLDAPRoleName    = "ldap"
+
+	PasswordEncryptionMD5   = "md5"
+	PasswordEncryptionSCRAM = "scram-sha-256"
+
+	CredentialsBackendKubernetes = "kubernetes"
+	CredentialsBackendVault      = "vault"
+
+	CredentialsBackendAWSSecretsManager = "aws-secrets-manager"
+)
+
+// sources of the members of the teams
+const (
+	TeamsAPITypeAPI       = "api"
+	TeamsAPITypeConfigMap = "configmap"
+	TeamsAPITypeSCIM      = "scim"
+	TeamsAPITypeDisabled  = "disabled"
 )
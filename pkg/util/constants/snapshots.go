@@ -0,0 +1,13 @@
+package constants
+
+// Properties of the CSI VolumeSnapshot API used for snapshot-based backups
+const (
+	VolumeSnapshotGroup      = "snapshot.storage.k8s.io"
+	VolumeSnapshotAPIVersion = "v1"
+	VolumeSnapshotKind       = "VolumeSnapshot"
+	VolumeSnapshotResource   = "volumesnapshots"
+
+	SnapshotBackupLabel          = "snapshot-backup"
+	SnapshotBackupVolumeLabel    = "snapshot-backup-volume"
+	SnapshotBackupNameTimeFormat = "20060102-150405"
+)
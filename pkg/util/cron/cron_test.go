@@ -0,0 +1,41 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	after := time.Date(2018, time.March, 14, 10, 30, 0, 0, time.UTC) // Wednesday
+	tests := []struct {
+		expression string
+		next       time.Time
+	}{
+		{"* * * * *", time.Date(2018, time.March, 14, 10, 31, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2018, time.March, 15, 3, 0, 0, 0, time.UTC)},
+		{"*/20 10 * * *", time.Date(2018, time.March, 14, 10, 40, 0, 0, time.UTC)},
+		{"0 2 * * 0", time.Date(2018, time.March, 18, 2, 0, 0, 0, time.UTC)},
+		{"0 2 * * 7", time.Date(2018, time.March, 18, 2, 0, 0, 0, time.UTC)},
+		{"0 4 1 * *", time.Date(2018, time.April, 1, 4, 0, 0, 0, time.UTC)},
+		{"0 0 1 1-2 *", time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"15 9,11 14 * 1", time.Date(2018, time.March, 14, 11, 15, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		schedule, err := Parse(tt.expression)
+		if err != nil {
+			t.Errorf("could not parse %q: %v", tt.expression, err)
+			continue
+		}
+		if next := schedule.Next(after); !next.Equal(tt.next) {
+			t.Errorf("next time of %q after %s expected: %s, got: %s", tt.expression, after, tt.next, next)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, expression := range []string{"", "* * * *", "60 * * * *", "* 5-1 * * *", "*/0 * * * *", "a * * * *"} {
+		if _, err := Parse(expression); err == nil {
+			t.Errorf("expected an error parsing %q", expression)
+		}
+	}
+}
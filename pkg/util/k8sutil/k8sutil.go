@@ -1,16 +1,20 @@
 package k8sutil
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
 	apiextclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	apiextbeta1 "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/typed/apiextensions/v1beta1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/typed/apps/v1beta1"
+	batchv1 "k8s.io/client-go/kubernetes/typed/batch/v1"
+	batchv2alpha1 "k8s.io/client-go/kubernetes/typed/batch/v2alpha1"
 	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
 	policyv1beta1 "k8s.io/client-go/kubernetes/typed/policy/v1beta1"
 	"k8s.io/client-go/pkg/api"
@@ -19,6 +23,7 @@ import (
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 
+	"github.com/zalando-incubator/postgres-operator/pkg/util"
 	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
 )
 
@@ -34,12 +39,17 @@ type KubernetesClient struct {
 	v1core.NodesGetter
 	v1core.NamespacesGetter
 	v1core.ServiceAccountsGetter
+	v1core.EventsGetter
 	v1beta1.StatefulSetsGetter
 	policyv1beta1.PodDisruptionBudgetsGetter
+	batchv1.JobsGetter
+	batchv2alpha1.CronJobsGetter
 	apiextbeta1.CustomResourceDefinitionsGetter
 
-	RESTClient rest.Interface
-	CRDREST    rest.Interface
+	RESTClient         rest.Interface
+	CRDREST            rest.Interface
+	StorageRESTClient  rest.Interface
+	VolumeSnapshotREST rest.Interface
 }
 
 // RestConfig creates REST config
@@ -61,6 +71,67 @@ func ResourceNotFound(err error) bool {
 	return apierrors.IsNotFound(err)
 }
 
+// StorageClass describes the fields of the storage class used by the operator. The typed client doesn't know about
+// allowVolumeExpansion yet, therefore we read the raw object.
+type StorageClass struct {
+	metav1.ObjectMeta `json:"metadata"`
+
+	Provisioner          string            `json:"provisioner"`
+	Parameters           map[string]string `json:"parameters,omitempty"`
+	AllowVolumeExpansion *bool             `json:"allowVolumeExpansion,omitempty"`
+}
+
+// GetStorageClass fetches the storage class by its name.
+func GetStorageClass(client rest.Interface, name string) (*StorageClass, error) {
+	body, err := client.Get().Resource("storageclasses").Name(name).DoRaw()
+	if err != nil {
+		return nil, fmt.Errorf("could not get storage class %q: %v", name, err)
+	}
+	var storageClass StorageClass
+	if err := json.Unmarshal(body, &storageClass); err != nil {
+		return nil, fmt.Errorf("could not unmarshal storage class %q: %v", name, err)
+	}
+
+	return &storageClass, nil
+}
+
+// GetDefaultStorageClass returns the storage class used for the claims that don't specify one, or nil if there is none.
+func GetDefaultStorageClass(client rest.Interface) (*StorageClass, error) {
+	body, err := client.Get().Resource("storageclasses").DoRaw()
+	if err != nil {
+		return nil, fmt.Errorf("could not list storage classes: %v", err)
+	}
+	var list struct {
+		Items []StorageClass `json:"items"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("could not unmarshal list of storage classes: %v", err)
+	}
+	for i := range list.Items {
+		annotations := list.Items[i].Annotations
+		if annotations[constants.DefaultStorageClassAnnotation] == "true" ||
+			annotations[constants.DefaultStorageClassBetaAnnotation] == "true" {
+			return &list.Items[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// StorageClassAllowsExpansion checks if the storage class permits resizing its volumes by changing the size of
+// the persistent volume claim.
+func StorageClassAllowsExpansion(client rest.Interface, name string) (bool, error) {
+	if client == nil {
+		return false, nil
+	}
+	storageClass, err := GetStorageClass(client, name)
+	if err != nil {
+		return false, err
+	}
+
+	return storageClass.AllowVolumeExpansion != nil && *storageClass.AllowVolumeExpansion, nil
+}
+
 // NewFromConfig create Kubernets Interface using REST config
 func NewFromConfig(cfg *rest.Config) (KubernetesClient, error) {
 	kubeClient := KubernetesClient{}
@@ -80,9 +151,13 @@ func NewFromConfig(cfg *rest.Config) (KubernetesClient, error) {
 	kubeClient.PersistentVolumesGetter = client.CoreV1()
 	kubeClient.NodesGetter = client.CoreV1()
 	kubeClient.NamespacesGetter = client.CoreV1()
+	kubeClient.EventsGetter = client.CoreV1()
 	kubeClient.StatefulSetsGetter = client.AppsV1beta1()
 	kubeClient.PodDisruptionBudgetsGetter = client.PolicyV1beta1()
+	kubeClient.JobsGetter = client.BatchV1()
+	kubeClient.CronJobsGetter = client.BatchV2alpha1()
 	kubeClient.RESTClient = client.CoreV1().RESTClient()
+	kubeClient.StorageRESTClient = client.StorageV1().RESTClient()
 
 	cfg2 := *cfg
 	cfg2.GroupVersion = &schema.GroupVersion{
@@ -98,6 +173,20 @@ func NewFromConfig(cfg *rest.Config) (KubernetesClient, error) {
 	}
 	kubeClient.CRDREST = crd
 
+	cfg3 := *cfg
+	cfg3.GroupVersion = &schema.GroupVersion{
+		Group:   constants.VolumeSnapshotGroup,
+		Version: constants.VolumeSnapshotAPIVersion,
+	}
+	cfg3.APIPath = constants.K8sAPIPath
+	cfg3.NegotiatedSerializer = serializer.DirectCodecFactory{CodecFactory: api.Codecs}
+
+	volumeSnapshots, err := rest.RESTClientFor(&cfg3)
+	if err != nil {
+		return kubeClient, fmt.Errorf("could not get volume snapshot rest client: %v", err)
+	}
+	kubeClient.VolumeSnapshotREST = volumeSnapshots
+
 	apiextClient, err := apiextclient.NewForConfig(cfg)
 	if err != nil {
 		return kubeClient, fmt.Errorf("could not create api client:%v", err)
@@ -108,6 +197,22 @@ func NewFromConfig(cfg *rest.Config) (KubernetesClient, error) {
 	return kubeClient, nil
 }
 
+// NodeIsDrained checks if the node is cordoned or carries one of the given taints keeping new pods off it.
+func NodeIsDrained(node *v1.Node, drainTaints []string) bool {
+	if node.Spec.Unschedulable {
+		return true
+	}
+	for _, taint := range node.Spec.Taints {
+		if taint.Effect != v1.TaintEffectNoSchedule && taint.Effect != v1.TaintEffectNoExecute {
+			continue
+		}
+		if util.SliceContains(drainTaints, taint.Key) {
+			return true
+		}
+	}
+	return false
+}
+
 // SameService compares the Services
 func SameService(cur, new *v1.Service) (match bool, reason string) {
 	//TODO: improve comparison
@@ -139,10 +244,12 @@ func SameService(cur, new *v1.Service) (match bool, reason string) {
 // SamePDB compares the PodDisruptionBudgets
 func SamePDB(cur, new *policybeta1.PodDisruptionBudget) (match bool, reason string) {
 	//TODO: improve comparison
-	match = reflect.DeepEqual(new.Spec, cur.Spec)
-	if !match {
-		reason = "new service spec doesn't match the current one"
+	if !reflect.DeepEqual(new.Spec, cur.Spec) {
+		return false, "new pod disruption budget spec doesn't match the current one"
+	}
+	if !reflect.DeepEqual(new.Labels, cur.Labels) {
+		return false, "new pod disruption budget labels don't match the current ones"
 	}
 
-	return
+	return true, ""
 }
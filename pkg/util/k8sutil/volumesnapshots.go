@@ -0,0 +1,151 @@
+package k8sutil
+
+import (
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/rest"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+)
+
+// VolumeSnapshot describes the fields of the CSI VolumeSnapshot object used by the operator.
+// The client library doesn't know about the snapshot.storage.k8s.io API group, therefore we talk to it via REST.
+type VolumeSnapshot struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+
+	Spec   VolumeSnapshotSpec    `json:"spec"`
+	Status *VolumeSnapshotStatus `json:"status,omitempty"`
+}
+
+// VolumeSnapshotSpec defines the source persistent volume claim and the class of the snapshot.
+type VolumeSnapshotSpec struct {
+	Source                  VolumeSnapshotSource `json:"source"`
+	VolumeSnapshotClassName *string              `json:"volumeSnapshotClassName,omitempty"`
+}
+
+// VolumeSnapshotSource points to the persistent volume claim to take the snapshot of.
+type VolumeSnapshotSource struct {
+	PersistentVolumeClaimName *string `json:"persistentVolumeClaimName,omitempty"`
+}
+
+// VolumeSnapshotStatus is filled in by the snapshot controller.
+type VolumeSnapshotStatus struct {
+	CreationTime *metav1.Time `json:"creationTime,omitempty"`
+	ReadyToUse   *bool        `json:"readyToUse,omitempty"`
+}
+
+// VolumeSnapshotList is a list of volume snapshots.
+type VolumeSnapshotList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []VolumeSnapshot `json:"items"`
+}
+
+// IsReady checks if the snapshot can be used to provision new volumes.
+func (s *VolumeSnapshot) IsReady() bool {
+	return s.Status != nil && s.Status.ReadyToUse != nil && *s.Status.ReadyToUse
+}
+
+// CreateVolumeSnapshot creates a new volume snapshot object.
+func CreateVolumeSnapshot(client rest.Interface, snapshot *VolumeSnapshot) error {
+	snapshot.TypeMeta = metav1.TypeMeta{
+		Kind:       constants.VolumeSnapshotKind,
+		APIVersion: constants.VolumeSnapshotGroup + "/" + constants.VolumeSnapshotAPIVersion,
+	}
+	body, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("could not marshal volume snapshot: %v", err)
+	}
+	_, err = client.Post().
+		Namespace(snapshot.Namespace).
+		Resource(constants.VolumeSnapshotResource).
+		Body(body).
+		DoRaw()
+
+	return err
+}
+
+// GetVolumeSnapshot fetches the volume snapshot by its name.
+func GetVolumeSnapshot(client rest.Interface, namespace, name string) (*VolumeSnapshot, error) {
+	body, err := client.Get().
+		Namespace(namespace).
+		Resource(constants.VolumeSnapshotResource).
+		Name(name).
+		DoRaw()
+	if err != nil {
+		return nil, err
+	}
+	var snapshot VolumeSnapshot
+	if err := json.Unmarshal(body, &snapshot); err != nil {
+		return nil, fmt.Errorf("could not unmarshal volume snapshot %q: %v", name, err)
+	}
+
+	return &snapshot, nil
+}
+
+// ListVolumeSnapshots returns volume snapshots in the namespace matching the label selector.
+func ListVolumeSnapshots(client rest.Interface, namespace string, options metav1.ListOptions) ([]VolumeSnapshot, error) {
+	body, err := client.Get().
+		Namespace(namespace).
+		Resource(constants.VolumeSnapshotResource).
+		VersionedParams(&options, metav1.ParameterCodec).
+		DoRaw()
+	if err != nil {
+		return nil, err
+	}
+	var list VolumeSnapshotList
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("could not unmarshal list of volume snapshots: %v", err)
+	}
+
+	return list.Items, nil
+}
+
+// DeleteVolumeSnapshot removes the volume snapshot object, the snapshot class decides what happens to the actual snapshot.
+func DeleteVolumeSnapshot(client rest.Interface, namespace, name string) error {
+	return client.Delete().
+		Namespace(namespace).
+		Resource(constants.VolumeSnapshotResource).
+		Name(name).
+		Do().
+		Error()
+}
+
+// CreatePersistentVolumeClaimFromSnapshot creates a persistent volume claim provisioned from the volume snapshot.
+// The typed client has no dataSource field in the claim spec, so the claim is posted as a raw object to the core API.
+func CreatePersistentVolumeClaimFromSnapshot(client rest.Interface, pvc *v1.PersistentVolumeClaim, snapshotName string) error {
+	pvc.TypeMeta = metav1.TypeMeta{Kind: "PersistentVolumeClaim", APIVersion: "v1"}
+	data, err := json.Marshal(pvc)
+	if err != nil {
+		return fmt.Errorf("could not marshal persistent volume claim: %v", err)
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return fmt.Errorf("could not unmarshal persistent volume claim: %v", err)
+	}
+	claimSpec, ok := object["spec"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("persistent volume claim %q has no spec", pvc.Name)
+	}
+	claimSpec["dataSource"] = map[string]string{
+		"apiGroup": constants.VolumeSnapshotGroup,
+		"kind":     constants.VolumeSnapshotKind,
+		"name":     snapshotName,
+	}
+	body, err := json.Marshal(object)
+	if err != nil {
+		return fmt.Errorf("could not marshal persistent volume claim: %v", err)
+	}
+	_, err = client.Post().
+		Namespace(pvc.Namespace).
+		Resource("persistentvolumeclaims").
+		Body(body).
+		DoRaw()
+
+	return err
+}
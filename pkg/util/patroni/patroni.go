@@ -14,6 +14,9 @@ import (
 
 const (
 	failoverPath = "/failover"
+	configPath   = "/config"
+	memberPath   = "/patroni"
+	clusterPath  = "/cluster"
 	apiPort      = 8008
 	timeout      = 30 * time.Second
 )
@@ -21,6 +24,41 @@ const (
 // Interface describe patroni methods
 type Interface interface {
 	Failover(master *v1.Pod, candidate string) error
+	FailoverWithoutLeader(candidate *v1.Pod) error
+	SetConfig(server *v1.Pod, config map[string]interface{}) error
+	GetConfig(server *v1.Pod) (map[string]interface{}, error)
+	GetMemberData(server *v1.Pod) (MemberData, error)
+	GetClusterMembers(server *v1.Pod) ([]ClusterMember, error)
+}
+
+// MemberData is the state of a cluster member reported by its patroni api
+type MemberData struct {
+	State         string `json:"state"`
+	Role          string `json:"role"`
+	ServerVersion int    `json:"server_version"`
+}
+
+// ClusterMember is a member of the cluster as listed by the patroni api, its role being one of leader, replica,
+// sync_standby or standby_leader
+type ClusterMember struct {
+	Name  string    `json:"name"`
+	Role  string    `json:"role"`
+	State string    `json:"state"`
+	Lag   MemberLag `json:"lag"`
+}
+
+// MemberLag is the replication lag of the member in bytes, -1 if patroni reports it as unknown
+type MemberLag int64
+
+// UnmarshalJSON accepts both the number of bytes and the "unknown" string patroni reports for members not streaming
+func (l *MemberLag) UnmarshalJSON(data []byte) error {
+	var lag int64
+	if err := json.Unmarshal(data, &lag); err != nil {
+		*l = -1
+		return nil
+	}
+	*l = MemberLag(lag)
+	return nil
 }
 
 // Patroni API client
@@ -47,13 +85,114 @@ func apiURL(masterPod *v1.Pod) string {
 
 // Failover does manual failover via patroni api
 func (p *Patroni) Failover(master *v1.Pod, candidate string) error {
+	return p.request(http.MethodPost, apiURL(master)+failoverPath, map[string]string{"leader": master.Name, "member": candidate})
+}
+
+// FailoverWithoutLeader promotes the candidate via its patroni api when the cluster has no leader to switch over from
+func (p *Patroni) FailoverWithoutLeader(candidate *v1.Pod) error {
+	return p.request(http.MethodPost, apiURL(candidate)+failoverPath, map[string]string{"candidate": candidate.Name})
+}
+
+// SetConfig patches the dynamic configuration of the cluster in the DCS via patroni api of any of its members.
+// Keys with nil values are removed from the configuration.
+func (p *Patroni) SetConfig(server *v1.Pod, config map[string]interface{}) error {
+	return p.request(http.MethodPatch, apiURL(server)+configPath, config)
+}
+
+// GetConfig returns the dynamic configuration of the cluster in the DCS via patroni api of any of its members.
+func (p *Patroni) GetConfig(server *v1.Pod) (map[string]interface{}, error) {
+	config := make(map[string]interface{})
+
+	url := apiURL(server) + configPath
+	p.logger.Debugf("making http request: %s", url)
+
+	resp, err := p.httpClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("could not make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("could not read response: %v", err)
+		}
+
+		return nil, fmt.Errorf("patroni returned '%s'", string(bodyBytes))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&config); err != nil {
+		return nil, fmt.Errorf("could not decode response: %v", err)
+	}
+
+	return config, nil
+}
+
+// GetMemberData returns the state of the member running in the pod via patroni api
+func (p *Patroni) GetMemberData(server *v1.Pod) (MemberData, error) {
+	var data MemberData
+
+	url := apiURL(server) + memberPath
+	p.logger.Debugf("making http request: %s", url)
+
+	resp, err := p.httpClient.Get(url)
+	if err != nil {
+		return data, fmt.Errorf("could not make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return data, fmt.Errorf("could not read response: %v", err)
+		}
+
+		return data, fmt.Errorf("patroni returned '%s'", string(bodyBytes))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return data, fmt.Errorf("could not decode response: %v", err)
+	}
+
+	return data, nil
+}
+
+// GetClusterMembers returns the members of the cluster via patroni api of any of them
+func (p *Patroni) GetClusterMembers(server *v1.Pod) ([]ClusterMember, error) {
+	var data struct {
+		Members []ClusterMember `json:"members"`
+	}
+
+	url := apiURL(server) + clusterPath
+	p.logger.Debugf("making http request: %s", url)
+
+	resp, err := p.httpClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("could not make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("could not read response: %v", err)
+		}
+
+		return nil, fmt.Errorf("patroni returned '%s'", string(bodyBytes))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("could not decode response: %v", err)
+	}
+
+	return data.Members, nil
+}
+
+func (p *Patroni) request(method, url string, body interface{}) error {
 	buf := &bytes.Buffer{}
 
-	err := json.NewEncoder(buf).Encode(map[string]string{"leader": master.Name, "member": candidate})
+	err := json.NewEncoder(buf).Encode(body)
 	if err != nil {
 		return fmt.Errorf("could not encode json: %v", err)
 	}
-	request, err := http.NewRequest(http.MethodPost, apiURL(master)+failoverPath, buf)
+	request, err := http.NewRequest(method, url, buf)
 	if err != nil {
 		return fmt.Errorf("could not create request: %v", err)
 	}
@@ -0,0 +1,87 @@
+package util
+
+import (
+	"crypto/hmac"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+)
+
+const (
+	scramPrefix     = "SCRAM-SHA-256"
+	scramIterations = 4096
+	scramSaltLength = 16
+)
+
+// ScramSHA256Password returns the SCRAM-SHA-256 verifier of the password with a random salt, in the format Postgres
+// stores it in pg_authid, i.e. SCRAM-SHA-256$<iterations>:<salt>$<StoredKey>:<ServerKey>.
+func ScramSHA256Password(password string) (string, error) {
+	salt := make([]byte, scramSaltLength)
+	if _, err := cryptorand.Read(salt); err != nil {
+		return "", fmt.Errorf("could not generate salt: %v", err)
+	}
+	return scramVerifier(password, salt, scramIterations), nil
+}
+
+func scramVerifier(password string, salt []byte, iterations int) string {
+	saltedPassword := pbkdf2.Key([]byte(password), salt, iterations, sha256.Size, sha256.New)
+	clientKey := hmacSHA256(saltedPassword, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	serverKey := hmacSHA256(saltedPassword, "Server Key")
+
+	return fmt.Sprintf("%s$%d:%s$%s:%s", scramPrefix, iterations, base64.StdEncoding.EncodeToString(salt),
+		base64.StdEncoding.EncodeToString(storedKey[:]), base64.StdEncoding.EncodeToString(serverKey))
+}
+
+func hmacSHA256(key []byte, message string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+// EncryptedPassword returns the password of the user hashed with the given password_encryption of Postgres.
+// Already hashed and empty passwords are returned as is.
+func EncryptedPassword(user spec.PgUser, encryption string) (string, error) {
+	if user.Password == "" || strings.HasPrefix(user.Password, scramPrefix+"$") || PGUserPassword(user) == user.Password {
+		return user.Password, nil
+	}
+	if encryption == constants.PasswordEncryptionSCRAM {
+		return ScramSHA256Password(user.Password)
+	}
+	return PGUserPassword(user), nil
+}
+
+// PasswordMatches checks if the password of the user is the one stored in the database, either as MD5 hash or as
+// SCRAM-SHA-256 verifier.
+func PasswordMatches(user spec.PgUser, stored string) bool {
+	if !strings.HasPrefix(stored, scramPrefix+"$") {
+		return PGUserPassword(user) == stored
+	}
+	// SCRAM-SHA-256$<iterations>:<salt>$<StoredKey>:<ServerKey>
+	parts := strings.Split(strings.TrimPrefix(stored, scramPrefix+"$"), "$")
+	if len(parts) != 2 {
+		return false
+	}
+	params := strings.SplitN(parts[0], ":", 2)
+	if len(params) != 2 {
+		return false
+	}
+	iterations, err := strconv.Atoi(params[0])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(params[1])
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal([]byte(scramVerifier(user.Password, salt, iterations)), []byte(stored))
+}
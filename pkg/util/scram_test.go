@@ -0,0 +1,43 @@
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+)
+
+func TestScramVerifier(t *testing.T) {
+	expected := "SCRAM-SHA-256$4096:MDEyMzQ1Njc4OWFiY2RlZg==$bpSY5Ze9NUH+I35LC3gVq+DpBfK46iXBxvhAKqVu9pE=:VpYlBuxyzeCI1KnctrefdljpB1mk3Gp7sBI/t11+NkQ="
+	if verifier := scramVerifier("secret", []byte("0123456789abcdef"), 4096); verifier != expected {
+		t.Errorf("SCRAM verifier expected: %q, got: %q", expected, verifier)
+	}
+}
+
+func TestPasswordMatches(t *testing.T) {
+	user := spec.PgUser{Name: "test", Password: "password"}
+	scram, err := EncryptedPassword(user, constants.PasswordEncryptionSCRAM)
+	if err != nil {
+		t.Fatalf("could not encrypt password: %v", err)
+	}
+	if !strings.HasPrefix(scram, "SCRAM-SHA-256$4096:") {
+		t.Errorf("expected a SCRAM-SHA-256 verifier, got: %q", scram)
+	}
+	tests := []struct {
+		stored string
+		match  bool
+	}{
+		{scram, true},
+		{"md587f77988ccb5aa917c93201ba314fcd4", true},
+		{"md592f413f3974bdf3799bb6fecb5f9f2c6", false},
+		{"SCRAM-SHA-256$4096:MDEyMzQ1Njc4OWFiY2RlZg==$bpSY5Ze9NUH+I35LC3gVq+DpBfK46iXBxvhAKqVu9pE=:VpYlBuxyzeCI1KnctrefdljpB1mk3Gp7sBI/t11+NkQ=", false},
+		{"SCRAM-SHA-256$invalid", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if match := PasswordMatches(user, tt.stored); match != tt.match {
+			t.Errorf("password match of %q expected: %t, got: %t", tt.stored, tt.match, match)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package secretbackend
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+)
+
+// AWSSecretsManager stores the credentials as JSON secrets of AWS Secrets Manager, the path being the secret name.
+type AWSSecretsManager struct {
+	// KMSKeyID encrypts the new secrets instead of the default key of the account, if set
+	KMSKeyID string
+
+	connection secretsmanageriface.SecretsManagerAPI
+}
+
+// NewAWSSecretsManager connects to AWS Secrets Manager in the region.
+func NewAWSSecretsManager(region, kmsKeyID string) (*AWSSecretsManager, error) {
+	sess, err := session.NewSession(&aws.Config{Region: aws.String(region)})
+	if err != nil {
+		return nil, fmt.Errorf("could not establish AWS session: %v", err)
+	}
+	return &AWSSecretsManager{KMSKeyID: kmsKeyID, connection: secretsmanager.New(sess)}, nil
+}
+
+// Read returns the current version of the secret.
+func (s *AWSSecretsManager) Read(path string) (map[string]string, error) {
+	out, err := s.connection.GetSecretValue(&secretsmanager.GetSecretValueInput{SecretId: aws.String(path)})
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == secretsmanager.ErrCodeResourceNotFoundException {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get secret %q: %v", path, err)
+	}
+	data := make(map[string]string)
+	if err := json.Unmarshal([]byte(aws.StringValue(out.SecretString)), &data); err != nil {
+		return nil, fmt.Errorf("could not parse secret %q: %v", path, err)
+	}
+	return data, nil
+}
+
+// Write stores a new version of the secret, creating it if it doesn't exist.
+func (s *AWSSecretsManager) Write(path string, data map[string]string) error {
+	value, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("could not marshal secret %q: %v", path, err)
+	}
+	_, err = s.connection.PutSecretValue(&secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String(path),
+		SecretString: aws.String(string(value)),
+	})
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == secretsmanager.ErrCodeResourceNotFoundException {
+		input := &secretsmanager.CreateSecretInput{
+			Name:         aws.String(path),
+			SecretString: aws.String(string(value)),
+		}
+		if s.KMSKeyID != "" {
+			input.KmsKeyId = aws.String(s.KMSKeyID)
+		}
+		_, err = s.connection.CreateSecret(input)
+	}
+	if err != nil {
+		return fmt.Errorf("could not write secret %q: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package secretbackend
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+)
+
+type mockSecretsManager struct {
+	secretsmanageriface.SecretsManagerAPI
+	secrets map[string]string
+	keys    map[string]string
+}
+
+func (m *mockSecretsManager) notFound() error {
+	return awserr.New(secretsmanager.ErrCodeResourceNotFoundException, "secret not found", nil)
+}
+
+func (m *mockSecretsManager) GetSecretValue(input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+	value, ok := m.secrets[aws.StringValue(input.SecretId)]
+	if !ok {
+		return nil, m.notFound()
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(value)}, nil
+}
+
+func (m *mockSecretsManager) PutSecretValue(input *secretsmanager.PutSecretValueInput) (*secretsmanager.PutSecretValueOutput, error) {
+	if _, ok := m.secrets[aws.StringValue(input.SecretId)]; !ok {
+		return nil, m.notFound()
+	}
+	m.secrets[aws.StringValue(input.SecretId)] = aws.StringValue(input.SecretString)
+	return &secretsmanager.PutSecretValueOutput{}, nil
+}
+
+func (m *mockSecretsManager) CreateSecret(input *secretsmanager.CreateSecretInput) (*secretsmanager.CreateSecretOutput, error) {
+	m.secrets[aws.StringValue(input.Name)] = aws.StringValue(input.SecretString)
+	m.keys[aws.StringValue(input.Name)] = aws.StringValue(input.KmsKeyId)
+	return &secretsmanager.CreateSecretOutput{}, nil
+}
+
+func TestAWSSecretsManager(t *testing.T) {
+	mock := &mockSecretsManager{secrets: map[string]string{}, keys: map[string]string{}}
+	backend := &AWSSecretsManager{KMSKeyID: "alias/postgres", connection: mock}
+	name := "postgres/default/acid-test/foo"
+
+	if data, err := backend.Read(name); err != nil || data != nil {
+		t.Errorf("expected no data for a missing secret, got %v, error: %v", data, err)
+	}
+	if err := backend.Write(name, map[string]string{"username": "foo", "password": "bar"}); err != nil {
+		t.Fatalf("could not create secret: %v", err)
+	}
+	if mock.keys[name] != "alias/postgres" {
+		t.Errorf("expected the secret to be encrypted with the KMS key, got %q", mock.keys[name])
+	}
+	rotated := map[string]string{"username": "foo", "password": "baz"}
+	if err := backend.Write(name, rotated); err != nil {
+		t.Fatalf("could not update secret: %v", err)
+	}
+	if data, err := backend.Read(name); err != nil || !reflect.DeepEqual(data, rotated) {
+		t.Errorf("expected %v, got %v, error: %v", rotated, data, err)
+	}
+}
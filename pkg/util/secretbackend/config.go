@@ -0,0 +1,59 @@
+package secretbackend
+
+import (
+	"fmt"
+
+	"github.com/Sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/config"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+// FromConfig returns the backends of the credentials_backends besides Kubernetes by their names. The backends that
+// can't be set up are left out with an error.
+func FromConfig(cfg *config.Config, kubeClient k8sutil.KubernetesClient, logger *logrus.Entry) map[string]Interface {
+	backends := make(map[string]Interface)
+	for _, name := range cfg.CredentialsBackends {
+		switch name {
+		case constants.CredentialsBackendVault:
+			if vault := NewVaultFromConfig(cfg, kubeClient, logger); vault != nil {
+				backends[name] = vault
+			}
+		case constants.CredentialsBackendAWSSecretsManager:
+			secretsManager, err := NewAWSSecretsManager(cfg.SecretsManagerRegion, cfg.SecretsManagerKMSKeyID)
+			if err != nil {
+				logger.Errorf("could not set up the %q credentials backend: %v", name, err)
+				continue
+			}
+			backends[name] = secretsManager
+		}
+	}
+	return backends
+}
+
+// NewVaultFromConfig returns the Vault backend of the operator configuration, or nil if there is no Vault address.
+func NewVaultFromConfig(cfg *config.Config, kubeClient k8sutil.KubernetesClient, logger *logrus.Entry) Interface {
+	if cfg.VaultAddress == "" {
+		return nil
+	}
+	vaultConfig := VaultConfig{
+		Address:  cfg.VaultAddress,
+		KVMount:  cfg.VaultKVMount,
+		AuthPath: cfg.VaultAuthPath,
+		AuthRole: cfg.VaultAuthRole,
+	}
+	if tokenSecret := cfg.VaultTokenSecretName; tokenSecret != (spec.NamespacedName{}) {
+		vaultConfig.Token = func() (string, error) {
+			secret, err := kubeClient.Secrets(tokenSecret.Namespace).Get(tokenSecret.Name, metav1.GetOptions{})
+			if err != nil {
+				return "", fmt.Errorf("could not get vault token secret: %v", err)
+			}
+			return string(secret.Data["token"]), nil
+		}
+	}
+
+	return NewVault(vaultConfig, logger)
+}
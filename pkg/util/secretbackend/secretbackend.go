@@ -0,0 +1,9 @@
+package secretbackend
+
+// Interface stores the credentials of the database users outside of the Kubernetes secrets.
+type Interface interface {
+	// Read returns the data stored at the path, or nil if there is none.
+	Read(path string) (map[string]string, error)
+	// Write replaces the data stored at the path.
+	Write(path string, data map[string]string) error
+}
@@ -0,0 +1,191 @@
+package secretbackend
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	serviceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	requestTimeout          = 10 * time.Second
+)
+
+type httpClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// VaultConfig describes how to reach and authenticate to Vault.
+type VaultConfig struct {
+	Address string
+	// KVMount is the mount path of the version 2 key/value secrets engine
+	KVMount string
+	// AuthPath and AuthRole configure the Kubernetes auth method, used when there is no token
+	AuthPath string
+	AuthRole string
+	// Token returns a static token, it is optional
+	Token func() (string, error)
+}
+
+// Vault stores the credentials in the key/value secrets engine of HashiCorp Vault.
+type Vault struct {
+	httpClient
+	config    VaultConfig
+	logger    *logrus.Entry
+	readJWT   func() ([]byte, error)
+	mu        sync.Mutex
+	authToken string
+}
+
+// NewVault creates the Vault backend.
+func NewVault(config VaultConfig, logger *logrus.Entry) *Vault {
+	config.Address = strings.TrimRight(config.Address, "/")
+	config.KVMount = strings.Trim(config.KVMount, "/")
+	return &Vault{
+		httpClient: &http.Client{Timeout: requestTimeout},
+		config:     config,
+		logger:     logger.WithField("pkg", "vault"),
+		readJWT: func() ([]byte, error) {
+			return ioutil.ReadFile(serviceAccountTokenFile)
+		},
+	}
+}
+
+// Read returns the latest version of the data at the path.
+func (v *Vault) Read(path string) (map[string]string, error) {
+	var response struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+	found, err := v.request("GET", v.dataURL(path), nil, &response)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %q: %v", path, err)
+	}
+	if !found {
+		return nil, nil
+	}
+	return response.Data.Data, nil
+}
+
+// Write stores a new version of the data at the path.
+func (v *Vault) Write(path string, data map[string]string) error {
+	body := map[string]interface{}{"data": data}
+	if _, err := v.request("POST", v.dataURL(path), body, nil); err != nil {
+		return fmt.Errorf("could not write %q: %v", path, err)
+	}
+	return nil
+}
+
+func (v *Vault) dataURL(path string) string {
+	return fmt.Sprintf("%s/v1/%s/data/%s", v.config.Address, v.config.KVMount, strings.Trim(path, "/"))
+}
+
+// request sends the request with the token, logging in again once if the token has expired. It returns false if
+// nothing is found at the URL.
+func (v *Vault) request(method, url string, body interface{}, result interface{}) (bool, error) {
+	found, status, err := v.authorizedRequest(method, url, body, result, false)
+	if status == http.StatusForbidden && v.config.Token == nil {
+		v.logger.Debugf("vault token has been rejected, logging in again")
+		found, _, err = v.authorizedRequest(method, url, body, result, true)
+	}
+	return found, err
+}
+
+func (v *Vault) authorizedRequest(method, url string, body interface{}, result interface{}, renew bool) (bool, int, error) {
+	token, err := v.token(renew)
+	if err != nil {
+		return false, 0, fmt.Errorf("could not authenticate to vault: %v", err)
+	}
+	return v.do(method, url, token, body, result)
+}
+
+func (v *Vault) do(method, url, token string, body interface{}, result interface{}) (found bool, status int, err error) {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return false, 0, fmt.Errorf("could not marshal request: %v", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return false, 0, err
+	}
+	if token != "" {
+		req.Header.Add("X-Vault-Token", token)
+	}
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return false, 0, err
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			err = fmt.Errorf("error when closing response: %v", closeErr)
+		}
+	}()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound && method == "GET":
+		return false, resp.StatusCode, nil
+	case resp.StatusCode >= 300:
+		var response struct {
+			Errors []string `json:"errors"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil || len(response.Errors) == 0 {
+			return false, resp.StatusCode, fmt.Errorf("vault request failed with status code %d", resp.StatusCode)
+		}
+		return false, resp.StatusCode, fmt.Errorf("vault request failed with status code %d: %s",
+			resp.StatusCode, strings.Join(response.Errors, ", "))
+	}
+	if result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return false, resp.StatusCode, fmt.Errorf("could not parse vault response: %v", err)
+		}
+	}
+
+	return true, resp.StatusCode, nil
+}
+
+// token returns the static token or the one of the Kubernetes auth method, logging in when there is none yet.
+func (v *Vault) token(renew bool) (string, error) {
+	if v.config.Token != nil {
+		return v.config.Token()
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.authToken != "" && !renew {
+		return v.authToken, nil
+	}
+
+	jwt, err := v.readJWT()
+	if err != nil {
+		return "", fmt.Errorf("could not read service account token: %v", err)
+	}
+	var response struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	url := fmt.Sprintf("%s/v1/auth/%s/login", v.config.Address, strings.Trim(v.config.AuthPath, "/"))
+	body := map[string]string{"role": v.config.AuthRole, "jwt": strings.TrimSpace(string(jwt))}
+	if _, _, err := v.do("POST", url, "", body, &response); err != nil {
+		return "", fmt.Errorf("could not log in with the role %q: %v", v.config.AuthRole, err)
+	}
+	if response.Auth.ClientToken == "" {
+		return "", fmt.Errorf("vault login with the role %q returned no token", v.config.AuthRole)
+	}
+	v.authToken = response.Auth.ClientToken
+
+	return v.authToken, nil
+}
@@ -0,0 +1,113 @@
+package secretbackend
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+)
+
+var logger = logrus.New().WithField("test", "secretbackend")
+
+type fakeVault struct {
+	logins int
+	tokens map[string]bool
+	data   map[string]map[string]string
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/v1/auth/kubernetes/login" {
+		var login map[string]string
+		json.NewDecoder(r.Body).Decode(&login)
+		if login["role"] != "postgres-operator" || login["jwt"] != "jwt" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.logins++
+		json.NewEncoder(w).Encode(map[string]interface{}{"auth": map[string]string{"client_token": "token"}})
+		return
+	}
+	if !f.tokens[r.Header.Get("X-Vault-Token")] {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string][]string{"errors": {"permission denied"}})
+		return
+	}
+	switch r.Method {
+	case "GET":
+		data, ok := f.data[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"data": data}})
+	case "POST":
+		var body struct {
+			Data map[string]string `json:"data"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.data[r.URL.Path] = body.Data
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func TestVaultKubernetesAuth(t *testing.T) {
+	fake := &fakeVault{tokens: map[string]bool{"token": true}, data: map[string]map[string]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	vault := NewVault(VaultConfig{Address: server.URL + "/", KVMount: "secret", AuthPath: "kubernetes",
+		AuthRole: "postgres-operator"}, logger)
+	vault.readJWT = func() ([]byte, error) { return []byte("jwt\n"), nil }
+
+	data, err := vault.Read("postgres/default/acid-test/foo")
+	if err != nil || data != nil {
+		t.Errorf("expected no data for a missing path, got %v, error: %v", data, err)
+	}
+	credentials := map[string]string{"username": "foo", "password": "bar"}
+	if err := vault.Write("postgres/default/acid-test/foo", credentials); err != nil {
+		t.Fatalf("could not write: %v", err)
+	}
+	if _, ok := fake.data["/v1/secret/data/postgres/default/acid-test/foo"]; !ok {
+		t.Errorf("expected the data to be written to the kv v2 data path, got %v", fake.data)
+	}
+	if data, err = vault.Read("/postgres/default/acid-test/foo"); err != nil || !reflect.DeepEqual(data, credentials) {
+		t.Errorf("expected %v, got %v, error: %v", credentials, data, err)
+	}
+	if fake.logins != 1 {
+		t.Errorf("expected a single login, got %d", fake.logins)
+	}
+
+	// the expired token is replaced by logging in again
+	fake.tokens = map[string]bool{"token": false}
+	if _, err := vault.Read("postgres/default/acid-test/foo"); err == nil {
+		t.Errorf("expected an error for a rejected token")
+	}
+	if fake.logins != 2 {
+		t.Errorf("expected a second login after the token has been rejected, got %d", fake.logins)
+	}
+}
+
+func TestVaultStaticToken(t *testing.T) {
+	fake := &fakeVault{tokens: map[string]bool{"static": true}, data: map[string]map[string]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	vault := NewVault(VaultConfig{Address: server.URL, KVMount: "kv",
+		Token: func() (string, error) { return "static", nil }}, logger)
+	if err := vault.Write("roles/robot_zmon", map[string]string{"password": "secret"}); err != nil {
+		t.Fatalf("could not write: %v", err)
+	}
+	if fake.logins != 0 {
+		t.Errorf("expected no login with a static token, got %d", fake.logins)
+	}
+
+	vault = NewVault(VaultConfig{Address: server.URL, KVMount: "kv",
+		Token: func() (string, error) { return "wrong", nil }}, logger)
+	expected := "could not read \"roles/robot_zmon\": vault request failed with status code 403: permission denied"
+	if _, err := vault.Read("roles/robot_zmon"); err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
@@ -0,0 +1,30 @@
+package teams
+
+import (
+	"github.com/Sirupsen/logrus"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/util/config"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/k8sutil"
+)
+
+// FromConfig returns the source of the teams selected by teams_api_type, or nil if the teams are disabled.
+func FromConfig(cfg *config.Config, kubeClient k8sutil.KubernetesClient, logger *logrus.Entry) Interface {
+	if !cfg.EnableTeamsAPI {
+		return nil
+	}
+	switch cfg.TeamsAPIType {
+	case constants.TeamsAPITypeConfigMap:
+		return NewConfigMapTeams(kubeClient, cfg.TeamsConfigMapName)
+	case constants.TeamsAPITypeSCIM:
+		return NewSCIM(cfg.TeamsAPIUrl, logger)
+	case constants.TeamsAPITypeDisabled:
+		return nil
+	}
+	return NewTeamsAPI(cfg.TeamsAPIUrl, logger)
+}
+
+// RequiresToken tells if the source of the teams selected by teams_api_type authenticates with the OAuth token.
+func RequiresToken(cfg *config.Config) bool {
+	return cfg.TeamsAPIType != constants.TeamsAPITypeConfigMap
+}
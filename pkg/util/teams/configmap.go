@@ -0,0 +1,41 @@
+package teams
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+)
+
+// ConfigMapTeams reads the members of the teams from a config map, mapping the teams to their comma-separated
+// members, for the installations without a teams service.
+type ConfigMapTeams struct {
+	client v1core.ConfigMapsGetter
+	name   spec.NamespacedName
+}
+
+// NewConfigMapTeams creates an object to read the teams from the given config map.
+func NewConfigMapTeams(client v1core.ConfigMapsGetter, name spec.NamespacedName) *ConfigMapTeams {
+	return &ConfigMapTeams{client: client, name: name}
+}
+
+// TeamInfo returns the members of the team listed in the config map, read on every call so that its changes are
+// picked up on the next sync. Teams missing in the config map have no members. The token is not used.
+func (t *ConfigMapTeams) TeamInfo(teamID, token string) (*Team, error) {
+	configMap, err := t.client.ConfigMaps(t.name.Namespace).Get(t.name.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not get teams config map %q: %v", t.name, err)
+	}
+
+	members := make([]string, 0)
+	for _, member := range strings.Split(configMap.Data[teamID], ",") {
+		if member = strings.TrimSpace(member); member != "" {
+			members = append(members, member)
+		}
+	}
+
+	return &Team{ID: teamID, TeamName: teamID, Members: members}, nil
+}
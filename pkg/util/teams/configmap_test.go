@@ -0,0 +1,66 @@
+package teams
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+)
+
+type mockConfigMapsGetter struct {
+	v1core.ConfigMapsGetter
+	data map[string]string
+}
+
+type mockConfigMap struct {
+	v1core.ConfigMapInterface
+	data map[string]string
+}
+
+func (c *mockConfigMapsGetter) ConfigMaps(namespace string) v1core.ConfigMapInterface {
+	return &mockConfigMap{data: c.data}
+}
+
+func (c *mockConfigMap) Get(name string, options metav1.GetOptions) (*v1.ConfigMap, error) {
+	if name != "postgres-teams" {
+		return nil, fmt.Errorf("not found")
+	}
+	return &v1.ConfigMap{Data: c.data}, nil
+}
+
+func TestConfigMapTeamInfo(t *testing.T) {
+	client := &mockConfigMapsGetter{data: map[string]string{"acid": "foo, bar,,baz", "empty": ""}}
+	tests := []struct {
+		name    string
+		teamID  string
+		members []string
+		err     error
+	}{
+		{"postgres-teams", "acid", []string{"foo", "bar", "baz"}, nil},
+		{"postgres-teams", "empty", []string{}, nil},
+		{"postgres-teams", "unknown", []string{}, nil},
+		{"missing", "acid", nil, fmt.Errorf(`could not get teams config map "default/missing": not found`)},
+	}
+	for _, tt := range tests {
+		teams := NewConfigMapTeams(client, spec.NamespacedName{Namespace: "default", Name: tt.name})
+		team, err := teams.TeamInfo(tt.teamID, "")
+		if err != nil {
+			if tt.err == nil || err.Error() != tt.err.Error() {
+				t.Errorf("expected error: %v, got: %v", tt.err, err)
+			}
+			continue
+		}
+		if tt.err != nil {
+			t.Errorf("expected error: %v, got none", tt.err)
+			continue
+		}
+		if !reflect.DeepEqual(team.Members, tt.members) {
+			t.Errorf("members of the team %q expected: %#v, got: %#v", tt.teamID, tt.members, team.Members)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package teams
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+type scimMember struct {
+	Value string `json:"value"`
+	Type  string `json:"type"`
+}
+
+type scimGroup struct {
+	ID          string       `json:"id"`
+	DisplayName string       `json:"displayName"`
+	Members     []scimMember `json:"members"`
+}
+
+type scimUser struct {
+	UserName string `json:"userName"`
+	Active   *bool  `json:"active"`
+}
+
+type scimGroupList struct {
+	Resources []scimGroup `json:"Resources"`
+}
+
+// SCIM reads the members of the teams from the groups of an identity provider implementing SCIM 2.0, i.e. a
+// directory synced from LDAP. The teams are the groups with their name as displayName.
+type SCIM struct {
+	httpClient
+	url    string
+	logger *logrus.Entry
+}
+
+// NewSCIM creates an object to query the SCIM API at the given base URL.
+func NewSCIM(url string, log *logrus.Entry) *SCIM {
+	return &SCIM{
+		url:        strings.TrimRight(url, "/"),
+		httpClient: &http.Client{},
+		logger:     log.WithField("pkg", "teamsapi"),
+	}
+}
+
+// TeamInfo returns the user names of the active members of the group named after the team. Nested groups are not
+// resolved.
+func (s *SCIM) TeamInfo(teamID, token string) (*Team, error) {
+	var groups scimGroupList
+	filter := url.QueryEscape(fmt.Sprintf("displayName eq %q", teamID))
+	if err := s.get(fmt.Sprintf("%s/Groups?filter=%s", s.url, filter), token, &groups); err != nil {
+		return nil, fmt.Errorf("could not get group of the team %q: %v", teamID, err)
+	}
+	if len(groups.Resources) != 1 {
+		return nil, fmt.Errorf("expected one group named %q, found %d", teamID, len(groups.Resources))
+	}
+
+	group := groups.Resources[0]
+	members := make([]string, 0, len(group.Members))
+	for _, member := range group.Members {
+		if member.Type != "" && member.Type != "User" {
+			continue
+		}
+		var user scimUser
+		if err := s.get(fmt.Sprintf("%s/Users/%s", s.url, url.PathEscape(member.Value)), token, &user); err != nil {
+			return nil, fmt.Errorf("could not get member %q of the team %q: %v", member.Value, teamID, err)
+		}
+		if user.Active != nil && !*user.Active {
+			continue
+		}
+		members = append(members, user.UserName)
+	}
+
+	return &Team{ID: group.ID, TeamName: group.DisplayName, Members: members}, nil
+}
+
+func (s *SCIM) get(url, token string, result interface{}) (err error) {
+	s.logger.Debugf("request url: %s", url)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Add("Accept", "application/scim+json")
+	req.Header.Add("Authorization", "Bearer "+token)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer func() {
+		closeErr := resp.Body.Close()
+		if closeErr != nil {
+			err = fmt.Errorf("error when closing response: %v", closeErr)
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("SCIM query failed with status code %d", resp.StatusCode)
+	}
+	if err = json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("could not parse SCIM response: %v", err)
+	}
+
+	return
+}
@@ -0,0 +1,55 @@
+package teams
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestSCIMTeamInfo(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/scim/v2/Groups":
+			if r.URL.Query().Get("filter") != `displayName eq "acid"` {
+				fmt.Fprint(w, `{"Resources": []}`)
+				return
+			}
+			fmt.Fprint(w, `{"Resources": [{"id": "1", "displayName": "acid", "members": [
+				{"value": "u1", "type": "User"}, {"value": "g1", "type": "Group"}, {"value": "u2"}, {"value": "u3"}]}]}`)
+		case "/scim/v2/Users/u1":
+			fmt.Fprint(w, `{"userName": "foo", "active": true}`)
+		case "/scim/v2/Users/u2":
+			fmt.Fprint(w, `{"userName": "bar"}`)
+		case "/scim/v2/Users/u3":
+			fmt.Fprint(w, `{"userName": "baz", "active": false}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	scim := NewSCIM(ts.URL+"/scim/v2/", logger)
+	team, err := scim.TeamInfo("acid", token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"foo", "bar"}; !reflect.DeepEqual(team.Members, expected) {
+		t.Errorf("expected members %v, got: %v", expected, team.Members)
+	}
+
+	expErr := `expected one group named "unknown", found 0`
+	if _, err := scim.TeamInfo("unknown", token); err == nil || err.Error() != expErr {
+		t.Errorf("expected error: %v, got: %v", expErr, err)
+	}
+
+	expErr = `could not get group of the team "acid": SCIM query failed with status code 401`
+	if _, err := scim.TeamInfo("acid", "invalid"); err == nil || err.Error() != expErr {
+		t.Errorf("expected error: %v, got: %v", expErr, err)
+	}
+}
@@ -16,6 +16,7 @@ const (
 	alterRoleResetAllSQL = `ALTER ROLE "%s" RESET ALL`
 	alterRoleSetSQL      = `ALTER ROLE "%s" SET %s TO %s`
 	grantToUserSQL       = `GRANT %s TO "%s"`
+	revokeFromUserSQL    = `REVOKE %s FROM "%s"`
 	doBlockStmt          = `SET LOCAL synchronous_commit = 'local'; DO $$ BEGIN %s; END;$$;`
 	passwordTemplate     = "ENCRYPTED PASSWORD '%s'"
 	inRoleTemplate       = `IN ROLE %s`
@@ -23,9 +24,13 @@ const (
 
 // DefaultUserSyncStrategy implements a user sync strategy that merges already existing database users
 // with those defined in the manifest, altering existing users when necessary. It will never strips
-// an existing roles of another role membership, nor it removes the already assigned flag
-// (except for the NOLOGIN). TODO: process other NOflags, i.e. NOSUPERUSER correctly.
+// an existing roles of another role membership, nor it removes the already assigned flag unless
+// the manifest sets the NO flag, i.e. NOSUPERUSER. Role attributes with values, like the connection
+// limit, are altered whenever they differ. Only the roles with ExclusiveMemberOf lose the memberships
+// they are not supposed to have.
 type DefaultUserSyncStrategy struct {
+	// PasswordEncryption is the password_encryption new passwords are hashed with, md5 or scram-sha-256
+	PasswordEncryption string
 }
 
 // ProduceSyncRequests figures out the types of changes that need to happen with the given users.
@@ -42,10 +47,10 @@ func (strategy DefaultUserSyncStrategy) ProduceSyncRequests(dbUsers spec.PgUserM
 			}
 		} else {
 			r := spec.PgSyncUserRequest{}
-			newMD5Password := util.PGUserPassword(newUser)
 
-			if dbUser.Password != newMD5Password {
-				r.User.Password = newMD5Password
+			// the password of the manifest is kept, existing MD5 hashes are converted only when it changes
+			if !util.PasswordMatches(newUser, dbUser.Password) {
+				r.User.Password = newUser.Password
 				r.Kind = spec.PGsyncUserAlter
 			}
 			if addNewRoles, equal := util.SubstractStringSlices(newUser.MemberOf, dbUser.MemberOf); !equal {
@@ -63,10 +68,62 @@ func (strategy DefaultUserSyncStrategy) ProduceSyncRequests(dbUsers spec.PgUserM
 			if len(newUser.Parameters) > 0 && !reflect.DeepEqual(dbUser.Parameters, newUser.Parameters) {
 				reqs = append(reqs, spec.PgSyncUserRequest{Kind: spec.PGSyncAlterSet, User: newUser})
 			}
+			if revokeRoles, equal := util.SubstractStringSlices(dbUser.MemberOf, newUser.MemberOf); newUser.ExclusiveMemberOf && !equal {
+				reqs = append(reqs, spec.PgSyncUserRequest{Kind: spec.PGSyncUserRevoke,
+					User: spec.PgUser{Name: newUser.Name, MemberOf: revokeRoles}})
+			}
 		}
 	}
 
-	return
+	return orderByMembership(reqs)
+}
+
+// orderByMembership puts the creation of the roles before the requests granting them to other roles, as neither
+// IN ROLE nor GRANT accept roles that don't exist yet. The other requests keep their order after the creations.
+func orderByMembership(reqs []spec.PgSyncUserRequest) []spec.PgSyncUserRequest {
+	pending := make(map[string]bool)
+	for _, r := range reqs {
+		if r.Kind == spec.PGSyncUserAdd {
+			pending[r.User.Name] = true
+		}
+	}
+
+	ordered := make([]spec.PgSyncUserRequest, 0, len(reqs))
+	for len(pending) > 0 {
+		progress := false
+		for _, r := range reqs {
+			if r.Kind != spec.PGSyncUserAdd || !pending[r.User.Name] {
+				continue
+			}
+			ready := true
+			for _, role := range r.User.MemberOf {
+				if pending[role] && role != r.User.Name {
+					ready = false
+				}
+			}
+			if ready {
+				ordered = append(ordered, r)
+				delete(pending, r.User.Name)
+				progress = true
+			}
+		}
+		// a cycle of memberships fails on creation anyway
+		if !progress {
+			for _, r := range reqs {
+				if r.Kind == spec.PGSyncUserAdd && pending[r.User.Name] {
+					ordered = append(ordered, r)
+				}
+			}
+			break
+		}
+	}
+	for _, r := range reqs {
+		if r.Kind != spec.PGSyncUserAdd {
+			ordered = append(ordered, r)
+		}
+	}
+
+	return ordered
 }
 
 // ExecuteSyncRequests makes actual database changes from the requests passed in its arguments.
@@ -85,6 +142,10 @@ func (strategy DefaultUserSyncStrategy) ExecuteSyncRequests(reqs []spec.PgSyncUs
 			if err := strategy.alterPgUserSet(r.User, db); err != nil {
 				return fmt.Errorf("could not set custom user %q parameters: %v", r.User.Name, err)
 			}
+		case spec.PGSyncUserRevoke:
+			if err := strategy.revokePgUserRoles(r.User, db); err != nil {
+				return fmt.Errorf("could not revoke roles of user %q: %v", r.User.Name, err)
+			}
 		default:
 			return fmt.Errorf("unrecognized operation: %v", r.Kind)
 		}
@@ -116,7 +177,11 @@ func (strategy DefaultUserSyncStrategy) createPgUser(user spec.PgUser, db *sql.D
 	if user.Password == "" {
 		userPassword = "PASSWORD NULL"
 	} else {
-		userPassword = fmt.Sprintf(passwordTemplate, util.PGUserPassword(user))
+		encrypted, err := util.EncryptedPassword(user, strategy.PasswordEncryption)
+		if err != nil {
+			return fmt.Errorf("could not encrypt password: %v", err)
+		}
+		userPassword = fmt.Sprintf(passwordTemplate, encrypted)
 	}
 	query := fmt.Sprintf(createUserSQL, user.Name, strings.Join(userFlags, " "), userPassword)
 
@@ -132,6 +197,9 @@ func (strategy DefaultUserSyncStrategy) createPgUser(user spec.PgUser, db *sql.D
 func (strategy DefaultUserSyncStrategy) alterPgUser(user spec.PgUser, db *sql.DB) (err error) {
 	var resultStmt []string
 
+	if user.Password, err = util.EncryptedPassword(user, strategy.PasswordEncryption); err != nil {
+		return fmt.Errorf("could not encrypt password: %v", err)
+	}
 	if user.Password != "" || len(user.Flags) > 0 {
 		alterStmt := produceAlterStmt(user)
 		resultStmt = append(resultStmt, alterStmt)
@@ -155,6 +223,14 @@ func (strategy DefaultUserSyncStrategy) alterPgUser(user spec.PgUser, db *sql.DB
 	return
 }
 
+func (strategy DefaultUserSyncStrategy) revokePgUserRoles(user spec.PgUser, db *sql.DB) error {
+	query := fmt.Sprintf(doBlockStmt, produceRevokeStmt(user))
+	if _, err := db.Exec(query); err != nil {
+		return fmt.Errorf("dB error: %v query %s", err, query)
+	}
+	return nil
+}
+
 func produceAlterStmt(user spec.PgUser) string {
 	// ALTER ROLE ... LOGIN ENCRYPTED PASSWORD ..
 	result := make([]string, 0)
@@ -162,7 +238,7 @@ func produceAlterStmt(user spec.PgUser) string {
 	flags := user.Flags
 
 	if password != "" {
-		result = append(result, fmt.Sprintf(passwordTemplate, util.PGUserPassword(user)))
+		result = append(result, fmt.Sprintf(passwordTemplate, password))
 	}
 	if len(flags) != 0 {
 		result = append(result, strings.Join(flags, " "))
@@ -184,6 +260,11 @@ func produceGrantStmt(user spec.PgUser) string {
 	return fmt.Sprintf(grantToUserSQL, quoteMemberList(user), user.Name)
 }
 
+func produceRevokeStmt(user spec.PgUser) string {
+	// REVOKE "foo", "bar" FROM baz
+	return fmt.Sprintf(revokeFromUserSQL, quoteMemberList(user), user.Name)
+}
+
 func quoteMemberList(user spec.PgUser) string {
 	var memberof []string
 	for _, member := range user.MemberOf {
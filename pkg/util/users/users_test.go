@@ -0,0 +1,66 @@
+package users
+
+import (
+	"testing"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+)
+
+func TestOrderByMembership(t *testing.T) {
+	reqs := []spec.PgSyncUserRequest{
+		{Kind: spec.PGSyncAlterSet, User: spec.PgUser{Name: "foo_owner_user"}},
+		{Kind: spec.PGSyncUserAdd, User: spec.PgUser{Name: "foo_owner_user", MemberOf: []string{"foo_owner"}}},
+		{Kind: spec.PGSyncUserAdd, User: spec.PgUser{Name: "foo_owner", MemberOf: []string{"foo_writer"}}},
+		{Kind: spec.PGsyncUserAlter, User: spec.PgUser{Name: "bar", MemberOf: []string{"foo_reader"}}},
+		{Kind: spec.PGSyncUserAdd, User: spec.PgUser{Name: "foo_writer", MemberOf: []string{"foo_reader", "admin"}}},
+		{Kind: spec.PGSyncUserAdd, User: spec.PgUser{Name: "foo_reader"}},
+	}
+	expected := []string{"foo_reader", "foo_writer", "foo_owner", "foo_owner_user", "foo_owner_user", "bar"}
+
+	ordered := orderByMembership(reqs)
+	if len(ordered) != len(expected) {
+		t.Fatalf("expected %d requests, got %d", len(expected), len(ordered))
+	}
+	for i, r := range ordered {
+		if r.User.Name != expected[i] {
+			t.Errorf("expected request %d for %q, got %q", i, expected[i], r.User.Name)
+		}
+	}
+	if ordered[4].Kind != spec.PGSyncAlterSet {
+		t.Errorf("expected the parameters of %q to be set after its creation", ordered[4].User.Name)
+	}
+}
+
+func TestProduceSyncRequestsExclusiveMemberOf(t *testing.T) {
+	dbUsers := spec.PgUserMap{
+		"foo": {Name: "foo", Flags: []string{"LOGIN"}, MemberOf: []string{"readonly", "admin"}},
+		"bar": {Name: "bar", Flags: []string{"LOGIN"}, MemberOf: []string{"admin"}},
+	}
+	newUsers := spec.PgUserMap{
+		"foo": {Name: "foo", Flags: []string{"LOGIN"}, MemberOf: []string{"readonly", "monitoring"}, ExclusiveMemberOf: true},
+		"bar": {Name: "bar", Flags: []string{"LOGIN"}},
+	}
+
+	reqs := DefaultUserSyncStrategy{}.ProduceSyncRequests(dbUsers, newUsers)
+	if len(reqs) != 2 {
+		t.Fatalf("expected 2 requests, got %#v", reqs)
+	}
+	for _, r := range reqs {
+		if r.User.Name != "foo" {
+			t.Errorf("expected no requests for %q, got %#v", r.User.Name, r)
+			continue
+		}
+		switch r.Kind {
+		case spec.PGsyncUserAlter:
+			if len(r.User.MemberOf) != 1 || r.User.MemberOf[0] != "monitoring" {
+				t.Errorf("expected the role monitoring to be granted, got %#v", r.User.MemberOf)
+			}
+		case spec.PGSyncUserRevoke:
+			if len(r.User.MemberOf) != 1 || r.User.MemberOf[0] != "admin" {
+				t.Errorf("expected the role admin to be revoked, got %#v", r.User.MemberOf)
+			}
+		default:
+			t.Errorf("unexpected request %#v", r)
+		}
+	}
+}
@@ -120,6 +120,16 @@ func MapContains(haystack, needle map[string]string) bool {
 	return true
 }
 
+// SliceContains returns true if the haystack contains the needle
+func SliceContains(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+	return false
+}
+
 func Coalesce(val, defaultVal string) string {
 	if val == "" {
 		return defaultVal
@@ -0,0 +1,225 @@
+package volumes
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/arm/compute"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/go-autorest/autorest/azure"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+)
+
+// AzureVolumeResizer implements volume resizing interface for Azure managed disks.
+// The service principal credentials are read from the secret given by CredentialsSecretName.
+type AzureVolumeResizer struct {
+	SecretsGetter         v1core.SecretsGetter
+	CredentialsSecretName spec.NamespacedName
+	connection            *compute.DisksClient
+	snapshots             *compute.SnapshotsClient
+}
+
+// ConnectToProvider reads the service principal credentials and connects to Azure.
+func (c *AzureVolumeResizer) ConnectToProvider() error {
+	if c.CredentialsSecretName.Name == "" {
+		return fmt.Errorf("azure credentials secret name is not set")
+	}
+	secret, err := c.SecretsGetter.
+		Secrets(c.CredentialsSecretName.Namespace).
+		Get(c.CredentialsSecretName.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("could not get azure credentials secret: %v", err)
+	}
+	data := secret.Data
+	for _, key := range []string{constants.AzureSubscriptionIDKey, constants.AzureTenantIDKey,
+		constants.AzureClientIDKey, constants.AzureClientSecretKey} {
+		if len(data[key]) == 0 {
+			return fmt.Errorf("azure credentials secret %q has no %q key", c.CredentialsSecretName, key)
+		}
+	}
+
+	oauthConfig, err := adal.NewOAuthConfig(azure.PublicCloud.ActiveDirectoryEndpoint, string(data[constants.AzureTenantIDKey]))
+	if err != nil {
+		return fmt.Errorf("could not create azure oauth config: %v", err)
+	}
+	token, err := adal.NewServicePrincipalToken(*oauthConfig, string(data[constants.AzureClientIDKey]),
+		string(data[constants.AzureClientSecretKey]), azure.PublicCloud.ResourceManagerEndpoint)
+	if err != nil {
+		return fmt.Errorf("could not obtain azure service principal token: %v", err)
+	}
+
+	authorizer := autorest.NewBearerAuthorizer(token)
+	client := compute.NewDisksClient(string(data[constants.AzureSubscriptionIDKey]))
+	client.Authorizer = authorizer
+	snapshots := compute.NewSnapshotsClient(string(data[constants.AzureSubscriptionIDKey]))
+	snapshots.Authorizer = authorizer
+	c.connection = &client
+	c.snapshots = &snapshots
+	return nil
+}
+
+// IsConnectedToProvider checks if Azure connection is established.
+func (c *AzureVolumeResizer) IsConnectedToProvider() bool {
+	return c.connection != nil
+}
+
+// VolumeBelongsToProvider checks if the given persistent volume is backed by an Azure managed disk.
+func (c *AzureVolumeResizer) VolumeBelongsToProvider(pv *v1.PersistentVolume) bool {
+	return pv.Spec.AzureDisk != nil && pv.Spec.AzureDisk.Kind != nil && *pv.Spec.AzureDisk.Kind == v1.AzureManagedDisk &&
+		pv.Annotations[constants.VolumeStorateProvisionerAnnotation] == constants.AzureDiskProvisioner
+}
+
+// GetProviderVolumeID returns the resource id of the managed disk, i.e.
+// /subscriptions/{id}/resourceGroups/{group}/providers/Microsoft.Compute/disks/{name}
+func (c *AzureVolumeResizer) GetProviderVolumeID(pv *v1.PersistentVolume) (string, error) {
+	volumeID := pv.Spec.AzureDisk.DataDiskURI
+	if volumeID == "" {
+		return "", fmt.Errorf("disk URI is empty for volume %q", pv.Name)
+	}
+	return volumeID, nil
+}
+
+// ResizeVolume actually calls Azure API to resize the managed disk if necessary.
+// Note that Azure refuses to resize the disk while it is attached to the running virtual machine.
+func (c *AzureVolumeResizer) ResizeVolume(volumeID string, newSize int64) error {
+	resourceGroup, diskName, err := parseAzureDiskID(volumeID)
+	if err != nil {
+		return err
+	}
+
+	/* first check if the volume is already of a requested size */
+	disk, err := c.connection.Get(resourceGroup, diskName)
+	if err != nil {
+		return fmt.Errorf("could not get information about the disk: %v", err)
+	}
+	newSizeGB := gigabytesRoundedUp(newSize)
+	if resize, err := azureDiskNeedsResize(diskName, &disk, newSizeGB); err != nil || !resize {
+		return err
+	}
+	if azureDiskAttached(&disk) {
+		return fmt.Errorf("managed disk %q is attached to the virtual machine %q: detach required to resize it",
+			diskName, *disk.ManagedBy)
+	}
+
+	size := int32(newSizeGB)
+	update := compute.DiskUpdate{DiskUpdateProperties: &compute.DiskUpdateProperties{DiskSizeGB: &size}}
+	resultCh, errCh := c.connection.Update(resourceGroup, diskName, update, nil)
+	if err := <-errCh; err != nil {
+		return fmt.Errorf("could not update managed disk: %v", err)
+	}
+	result := <-resultCh
+	if result.DiskProperties == nil || result.DiskSizeGB == nil || int64(*result.DiskSizeGB) != newSizeGB {
+		return fmt.Errorf("managed disk %q has not been resized to %dGB", diskName, newSizeGB)
+	}
+	return nil
+}
+
+// VolumeResizable checks if the managed disk is detached, as Azure refuses to resize the disks attached to a virtual
+// machine.
+func (c *AzureVolumeResizer) VolumeResizable(volumeID string) (bool, error) {
+	resourceGroup, diskName, err := parseAzureDiskID(volumeID)
+	if err != nil {
+		return false, err
+	}
+	disk, err := c.connection.Get(resourceGroup, diskName)
+	if err != nil {
+		return false, fmt.Errorf("could not get information about the disk: %v", err)
+	}
+	return !azureDiskAttached(&disk), nil
+}
+
+func azureDiskAttached(disk *compute.Disk) bool {
+	return disk.ManagedBy != nil && *disk.ManagedBy != ""
+}
+
+// azureDiskNeedsResize checks if the managed disk has to grow to the new size, refusing to shrink it.
+func azureDiskNeedsResize(diskName string, disk *compute.Disk, newSizeGB int64) (bool, error) {
+	if disk.DiskProperties != nil && disk.DiskSizeGB != nil {
+		currentSizeGB := int64(*disk.DiskSizeGB)
+		if currentSizeGB == newSizeGB {
+			return false, nil
+		}
+		if currentSizeGB > newSizeGB {
+			return false, fmt.Errorf("could not shrink managed disk %q from %dGB to %dGB", diskName, currentSizeGB, newSizeGB)
+		}
+	}
+	return true, nil
+}
+
+// SnapshotVolume creates a snapshot of the managed disk in the same resource group and returns the snapshot id.
+func (c *AzureVolumeResizer) SnapshotVolume(volumeID string, description string) (string, error) {
+	resourceGroup, diskName, err := parseAzureDiskID(volumeID)
+	if err != nil {
+		return "", err
+	}
+	disk, err := c.connection.Get(resourceGroup, diskName)
+	if err != nil {
+		return "", fmt.Errorf("could not get information about the disk: %v", err)
+	}
+	snapshotName := fmt.Sprintf("%s-%s", diskName, time.Now().UTC().Format("20060102150405"))
+	snapshot := compute.Snapshot{
+		Location: disk.Location,
+		Tags:     &map[string]*string{"description": &description},
+		DiskProperties: &compute.DiskProperties{
+			CreationData: &compute.CreationData{CreateOption: compute.Copy, SourceResourceID: &volumeID},
+		},
+	}
+	resultCh, errCh := c.snapshots.CreateOrUpdate(resourceGroup, snapshotName, snapshot, nil)
+	if err := <-errCh; err != nil {
+		return "", fmt.Errorf("could not create snapshot of the managed disk: %v", err)
+	}
+	result := <-resultCh
+	if result.ID == nil {
+		return "", fmt.Errorf("received empty snapshot id for the managed disk %q", diskName)
+	}
+	return *result.ID, nil
+}
+
+// DeleteSnapshot deletes the snapshot of a managed disk given by its resource id.
+func (c *AzureVolumeResizer) DeleteSnapshot(snapshotID string) error {
+	resourceGroup, snapshotName, err := parseAzureResourceID(snapshotID, "snapshots")
+	if err != nil {
+		return err
+	}
+	_, errCh := c.snapshots.Delete(resourceGroup, snapshotName, nil)
+	if err := <-errCh; err != nil {
+		return fmt.Errorf("could not delete snapshot %q: %v", snapshotName, err)
+	}
+	return nil
+}
+
+// DisconnectFromProvider drops the Azure client.
+func (c *AzureVolumeResizer) DisconnectFromProvider() error {
+	c.connection = nil
+	c.snapshots = nil
+	return nil
+}
+
+// parseAzureDiskID extracts the resource group and the disk name from the managed disk resource id.
+func parseAzureDiskID(volumeID string) (resourceGroup, diskName string, err error) {
+	return parseAzureResourceID(volumeID, "disks")
+}
+
+// parseAzureResourceID extracts the resource group and the name of the resource of the given type from its id.
+func parseAzureResourceID(id, resourceType string) (resourceGroup, name string, err error) {
+	parts := strings.Split(strings.Trim(id, "/"), "/")
+	for i := 0; i+1 < len(parts); i += 2 {
+		switch strings.ToLower(parts[i]) {
+		case "resourcegroups":
+			resourceGroup = parts[i+1]
+		case resourceType:
+			name = parts[i+1]
+		}
+	}
+	if resourceGroup == "" || name == "" {
+		return "", "", fmt.Errorf("malformed azure %s id %q", strings.TrimSuffix(resourceType, "s"), id)
+	}
+	return resourceGroup, name, nil
+}
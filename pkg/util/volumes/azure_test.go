@@ -0,0 +1,81 @@
+package volumes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/arm/compute"
+)
+
+var azureDiskIDTest = []struct {
+	in            string
+	resourceGroup string
+	diskName      string
+	err           bool
+}{
+	{"/subscriptions/123/resourceGroups/MC_acid/providers/Microsoft.Compute/disks/kubernetes-dynamic-pvc-1",
+		"MC_acid", "kubernetes-dynamic-pvc-1", false},
+	{"/subscriptions/123/resourcegroups/acid/providers/Microsoft.Compute/disks/pgdata", "acid", "pgdata", false},
+	{"/subscriptions/123/resourceGroups/acid/providers/Microsoft.Compute", "", "", true},
+	{"https://acid.blob.core.windows.net/vhds/pgdata.vhd", "", "", true},
+}
+
+func TestParseAzureDiskID(t *testing.T) {
+	for _, tt := range azureDiskIDTest {
+		resourceGroup, diskName, err := parseAzureDiskID(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("%s expected error: %t, got: %v", t.Name(), tt.err, err)
+			continue
+		}
+		if resourceGroup != tt.resourceGroup || diskName != tt.diskName {
+			t.Errorf("%s expected: %q, %q, got: %q, %q", t.Name(), tt.resourceGroup, tt.diskName, resourceGroup, diskName)
+		}
+	}
+}
+
+func TestAzureDiskNeedsResize(t *testing.T) {
+	disk := func(sizeGB int32, managedBy string) *compute.Disk {
+		result := &compute.Disk{DiskProperties: &compute.DiskProperties{DiskSizeGB: &sizeGB}}
+		if managedBy != "" {
+			result.ManagedBy = &managedBy
+		}
+		return result
+	}
+	tests := []struct {
+		disk      *compute.Disk
+		newSizeGB int64
+		resize    bool
+		err       string
+	}{
+		{disk(10, ""), 10, false, ""},
+		{disk(10, "/subscriptions/123/virtualMachines/vm-0"), 10, false, ""},
+		{disk(10, ""), 20, true, ""},
+		{disk(10, ""), 5, false, "could not shrink"},
+		{disk(10, "/subscriptions/123/virtualMachines/vm-0"), 20, true, ""},
+	}
+	for _, tt := range tests {
+		resize, err := azureDiskNeedsResize("pgdata", tt.disk, tt.newSizeGB)
+		if resize != tt.resize || (err == nil) != (tt.err == "") || err != nil && !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s expected resize %t and error %q for %dGB, got: %t, %v", t.Name(), tt.resize, tt.err,
+				tt.newSizeGB, resize, err)
+		}
+	}
+}
+
+func TestAzureDiskAttached(t *testing.T) {
+	empty := ""
+	vm := "/subscriptions/123/virtualMachines/vm-0"
+	tests := []struct {
+		managedBy *string
+		attached  bool
+	}{
+		{nil, false},
+		{&empty, false},
+		{&vm, true},
+	}
+	for _, tt := range tests {
+		if attached := azureDiskAttached(&compute.Disk{ManagedBy: tt.managedBy}); attached != tt.attached {
+			t.Errorf("%s expected attached %t, got: %t", t.Name(), tt.attached, attached)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package volumes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/retryutil"
+)
+
+// CephRBDVolumeResizer implements volume resizing interface for the Ceph RBD images behind the in-tree rbd volumes.
+// Images are resized via the REST API of the Ceph dashboard at APIURL, with the credentials from the secret given
+// by CredentialsSecretName. Volumes of the Ceph CSI driver are expanded by Kubernetes when their storage class
+// allows volume expansion.
+type CephRBDVolumeResizer struct {
+	SecretsGetter         v1core.SecretsGetter
+	CredentialsSecretName spec.NamespacedName
+	APIURL                string
+	client                *http.Client
+	token                 string
+}
+
+type cephRBDImage struct {
+	Size int64 `json:"size"`
+}
+
+// ConnectToProvider reads the credentials of the dashboard user and obtains the API token.
+func (c *CephRBDVolumeResizer) ConnectToProvider() error {
+	if c.APIURL == "" {
+		return fmt.Errorf("ceph api url is not set")
+	}
+	if c.CredentialsSecretName.Name == "" {
+		return fmt.Errorf("ceph credentials secret name is not set")
+	}
+	secret, err := c.SecretsGetter.
+		Secrets(c.CredentialsSecretName.Namespace).
+		Get(c.CredentialsSecretName.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("could not get ceph credentials secret: %v", err)
+	}
+	for _, key := range []string{constants.CephUsernameKey, constants.CephPasswordKey} {
+		if len(secret.Data[key]) == 0 {
+			return fmt.Errorf("ceph credentials secret %q has no %q key", c.CredentialsSecretName, key)
+		}
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	credentials := map[string]string{
+		"username": string(secret.Data[constants.CephUsernameKey]),
+		"password": string(secret.Data[constants.CephPasswordKey]),
+	}
+	var auth struct {
+		Token string `json:"token"`
+	}
+	if err := cephRequest(client, http.MethodPost, c.APIURL+"/api/auth", "", credentials, &auth); err != nil {
+		return fmt.Errorf("could not authenticate to the ceph api: %v", err)
+	}
+	if auth.Token == "" {
+		return fmt.Errorf("received empty token from the ceph api")
+	}
+	c.client = client
+	c.token = auth.Token
+	return nil
+}
+
+// IsConnectedToProvider checks if the API token has been obtained.
+func (c *CephRBDVolumeResizer) IsConnectedToProvider() bool {
+	return c.client != nil
+}
+
+// VolumeBelongsToProvider checks if the given persistent volume is an RBD image.
+func (c *CephRBDVolumeResizer) VolumeBelongsToProvider(pv *v1.PersistentVolume) bool {
+	return pv.Spec.RBD != nil
+}
+
+// GetProviderVolumeID returns the pool and the name of the RBD image in the form of replicapool/kubernetes-dynamic-pvc-1234
+func (c *CephRBDVolumeResizer) GetProviderVolumeID(pv *v1.PersistentVolume) (string, error) {
+	image := pv.Spec.RBD.RBDImage
+	if image == "" {
+		return "", fmt.Errorf("rbd image is empty for volume %q", pv.Name)
+	}
+	pool := pv.Spec.RBD.RBDPool
+	if pool == "" {
+		// default pool of the rbd volume plugin
+		pool = "rbd"
+	}
+	return pool + constants.CephRBDImageSeparator + image, nil
+}
+
+// ResizeVolume calls the Ceph API to resize the RBD image if necessary and waits until it has the new size.
+func (c *CephRBDVolumeResizer) ResizeVolume(volumeID string, newSize int64) error {
+	imageURL := c.APIURL + "/api/block/image/" + url.PathEscape(volumeID)
+
+	/* first check if the volume is already of a requested size */
+	var image cephRBDImage
+	if err := cephRequest(c.client, http.MethodGet, imageURL, c.token, nil, &image); err != nil {
+		return fmt.Errorf("could not get information about the rbd image: %v", err)
+	}
+	if image.Size == newSize {
+		// nothing to do
+		return nil
+	}
+
+	if err := cephRequest(c.client, http.MethodPut, imageURL, c.token, cephRBDImage{Size: newSize}, nil); err != nil {
+		return fmt.Errorf("could not resize rbd image %q: %v", volumeID, err)
+	}
+	// the dashboard may run the resize as a background task
+	return retryutil.Retry(constants.CephResizeWaitInterval, constants.CephResizeWaitTimeout,
+		func() (bool, error) {
+			if err := cephRequest(c.client, http.MethodGet, imageURL, c.token, nil, &image); err != nil {
+				return false, fmt.Errorf("could not get information about the rbd image: %v", err)
+			}
+			return image.Size == newSize, nil
+		})
+}
+
+// DisconnectFromProvider forgets the API token.
+func (c *CephRBDVolumeResizer) DisconnectFromProvider() error {
+	c.client = nil
+	c.token = ""
+	return nil
+}
+
+// cephRequest sends the request with the JSON body to the Ceph dashboard API and decodes the JSON response into result.
+func cephRequest(client *http.Client, method, requestURL, token string, body, result interface{}) error {
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("could not marshal request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, requestURL, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", constants.CephAPIContentType)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("could not read response: %v", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s returned %s: %s", method, requestURL, resp.Status, strings.TrimSpace(string(data)))
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, result); err != nil {
+		return fmt.Errorf("could not unmarshal response: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package volumes
+
+import (
+	"testing"
+
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+var cephVolumeIDTest = []struct {
+	in  v1.RBDVolumeSource
+	out string
+	err bool
+}{
+	{v1.RBDVolumeSource{RBDPool: "replicapool", RBDImage: "kubernetes-dynamic-pvc-1"}, "replicapool/kubernetes-dynamic-pvc-1", false},
+	{v1.RBDVolumeSource{RBDImage: "pgdata"}, "rbd/pgdata", false},
+	{v1.RBDVolumeSource{RBDPool: "replicapool"}, "", true},
+}
+
+func TestCephGetProviderVolumeID(t *testing.T) {
+	resizer := CephRBDVolumeResizer{}
+	for _, tt := range cephVolumeIDTest {
+		source := tt.in
+		pv := &v1.PersistentVolume{Spec: v1.PersistentVolumeSpec{PersistentVolumeSource: v1.PersistentVolumeSource{RBD: &source}}}
+		volumeID, err := resizer.GetProviderVolumeID(pv)
+		if (err != nil) != tt.err {
+			t.Errorf("%s expected error: %t, got: %v", t.Name(), tt.err, err)
+			continue
+		}
+		if volumeID != tt.out {
+			t.Errorf("%s expected: %q, got: %q", t.Name(), tt.out, volumeID)
+		}
+	}
+}
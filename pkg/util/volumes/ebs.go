@@ -2,29 +2,58 @@ package volumes
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/sts"
 	"k8s.io/client-go/pkg/api/v1"
 
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
 	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
 	"github.com/zalando-incubator/postgres-operator/pkg/util/retryutil"
 )
 
-// EBSVolumeResizer implements volume resizing interface for AWS EBS volumes.
+// EBSVolumeResizer implements volume resizing interface for AWS EBS volumes. When RoleARN is set, the resizer
+// assumes that role, via the web identity token from WebIdentityTokenFile (IAM roles for service accounts) if given.
 type EBSVolumeResizer struct {
-	connection *ec2.EC2
+	RoleARN              string
+	WebIdentityTokenFile string
+
+	connection  *ec2.EC2
+	credentials *credentials.Credentials
 }
 
 // ConnectToProvider connects to AWS.
 func (c *EBSVolumeResizer) ConnectToProvider() error {
+	if c.WebIdentityTokenFile != "" && c.RoleARN == "" {
+		return fmt.Errorf("could not establish AWS session: web identity token file is set without the role to assume")
+	}
 	sess, err := session.NewSession(&aws.Config{Region: aws.String(constants.AWSRegion)})
 	if err != nil {
 		return fmt.Errorf("could not establish AWS session: %v", err)
 	}
-	c.connection = ec2.New(sess)
+	// temporary credentials are refreshed by the SDK before they expire
+	if c.WebIdentityTokenFile != "" {
+		provider := stscreds.NewWebIdentityRoleProvider(sts.New(sess), c.RoleARN, constants.AWSRoleSessionName, c.WebIdentityTokenFile)
+		provider.ExpiryWindow = constants.AWSCredentialsExpiryWindow
+		c.credentials = credentials.NewCredentials(provider)
+	} else if c.RoleARN != "" {
+		c.credentials = stscreds.NewCredentials(sess, c.RoleARN, func(p *stscreds.AssumeRoleProvider) {
+			p.RoleSessionName = constants.AWSRoleSessionName
+			p.ExpiryWindow = constants.AWSCredentialsExpiryWindow
+		})
+	}
+	if c.credentials != nil {
+		c.connection = ec2.New(sess, &aws.Config{Credentials: c.credentials})
+	} else {
+		c.connection = ec2.New(sess)
+	}
 	return nil
 }
 
@@ -54,20 +83,114 @@ func (c *EBSVolumeResizer) GetProviderVolumeID(pv *v1.PersistentVolume) (string,
 // ResizeVolume actually calls AWS API to resize the EBS volume if necessary.
 func (c *EBSVolumeResizer) ResizeVolume(volumeID string, newSize int64) error {
 	/* first check if the volume is already of a requested size */
-	volumeOutput, err := c.connection.DescribeVolumes(&ec2.DescribeVolumesInput{VolumeIds: []*string{&volumeID}})
+	vol, err := c.describeVolume(volumeID)
 	if err != nil {
-		return fmt.Errorf("could not get information about the volume: %v", err)
+		return err
 	}
-	vol := volumeOutput.Volumes[0]
-	if *vol.VolumeId != volumeID {
-		return fmt.Errorf("describe volume %q returned information about a non-matching volume %q", volumeID, *vol.VolumeId)
+	newSizeGB := gigabytesRoundedUp(newSize)
+	if *vol.Size == newSizeGB {
+		// nothing to do
+		return nil
+	}
+	return c.modifyVolume(&ec2.ModifyVolumeInput{Size: &newSizeGB, VolumeId: &volumeID})
+}
+
+// VolumeNeedsModification checks if the type, IOPS or throughput of the EBS volume differ from the ones in the manifest.
+// Properties not set in the manifest are left to the storage class.
+func (c *EBSVolumeResizer) VolumeNeedsModification(volumeID string, newVolume spec.Volume) (bool, error) {
+	vol, err := c.describeVolume(volumeID)
+	if err != nil {
+		return false, err
+	}
+	input := volumeModificationInput(vol, newVolume)
+	return input.VolumeType != nil || input.Iops != nil || input.Throughput != nil, nil
+}
+
+// ModifyVolume changes size, type and performance of the EBS volume in one modification, since AWS
+// permits only one modification of the volume every six hours.
+func (c *EBSVolumeResizer) ModifyVolume(volumeID string, newSize int64, newVolume spec.Volume) error {
+	vol, err := c.describeVolume(volumeID)
+	if err != nil {
+		return err
+	}
+	input := volumeModificationInput(vol, newVolume)
+	if newSizeGB := gigabytesRoundedUp(newSize); *vol.Size != newSizeGB {
+		input.Size = &newSizeGB
 	}
-	if *vol.Size == newSize {
+	if input.Size == nil && input.VolumeType == nil && input.Iops == nil && input.Throughput == nil {
 		// nothing to do
 		return nil
 	}
-	input := ec2.ModifyVolumeInput{Size: &newSize, VolumeId: &volumeID}
-	output, err := c.connection.ModifyVolume(&input)
+	input.VolumeId = &volumeID
+	return c.modifyVolume(input)
+}
+
+// VolumeEncryption returns the encryption status and the ARN of the KMS key of the EBS volume.
+func (c *EBSVolumeResizer) VolumeEncryption(volumeID string) (bool, string, error) {
+	vol, err := c.describeVolume(volumeID)
+	if err != nil {
+		return false, "", err
+	}
+	return aws.BoolValue(vol.Encrypted), aws.StringValue(vol.KmsKeyId), nil
+}
+
+// TagVolume sets the tags of the EBS volume that are missing or differ from the given ones.
+func (c *EBSVolumeResizer) TagVolume(volumeID string, tags map[string]string) error {
+	vol, err := c.describeVolume(volumeID)
+	if err != nil {
+		return err
+	}
+	newTags := missingTags(vol.Tags, tags)
+	if len(newTags) == 0 {
+		// nothing to do
+		return nil
+	}
+	if _, err := c.connection.CreateTags(&ec2.CreateTagsInput{Resources: []*string{&volumeID}, Tags: newTags}); err != nil {
+		return fmt.Errorf("could not tag volume %q: %v", volumeID, err)
+	}
+	return nil
+}
+
+// missingTags returns the tags to set on the volume with the current tags, sorted by key.
+func missingTags(current []*ec2.Tag, desired map[string]string) []*ec2.Tag {
+	currentValues := make(map[string]string, len(current))
+	for _, tag := range current {
+		currentValues[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	keys := make([]string, 0, len(desired))
+	for key, value := range desired {
+		if currentValue, ok := currentValues[key]; !ok || currentValue != value {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	result := make([]*ec2.Tag, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, &ec2.Tag{Key: aws.String(key), Value: aws.String(desired[key])})
+	}
+	return result
+}
+
+func (c *EBSVolumeResizer) describeVolume(volumeID string) (*ec2.Volume, error) {
+	volumeOutput, err := c.connection.DescribeVolumes(&ec2.DescribeVolumesInput{VolumeIds: []*string{&volumeID}})
+	if err != nil {
+		return nil, fmt.Errorf("could not get information about the volume: %v", err)
+	}
+	if len(volumeOutput.Volumes) != 1 {
+		return nil, fmt.Errorf("describe volume didn't return one record for volume %q", volumeID)
+	}
+	vol := volumeOutput.Volumes[0]
+	if *vol.VolumeId != volumeID {
+		return nil, fmt.Errorf("describe volume %q returned information about a non-matching volume %q", volumeID, *vol.VolumeId)
+	}
+	return vol, nil
+}
+
+// modifyVolume starts the volume modification and waits until it reaches the "optimizing" or "completed" state
+func (c *EBSVolumeResizer) modifyVolume(input *ec2.ModifyVolumeInput) error {
+	volumeID := *input.VolumeId
+	output, err := c.connection.ModifyVolume(input)
 	if err != nil {
 		return fmt.Errorf("could not modify persistent volume: %v", err)
 	}
@@ -88,6 +211,11 @@ func (c *EBSVolumeResizer) ResizeVolume(volumeID string, newSize int64) error {
 		func() (bool, error) {
 			out, err := c.connection.DescribeVolumesModifications(&in)
 			if err != nil {
+				if c.credentialsExpired(err) {
+					// the modification goes on without us, poll again with fresh credentials
+					c.credentials.Expire()
+					return false, nil
+				}
 				return false, fmt.Errorf("could not describe volume modification: %v", err)
 			}
 			if len(out.VolumesModifications) != 1 {
@@ -101,8 +229,62 @@ func (c *EBSVolumeResizer) ResizeVolume(volumeID string, newSize int64) error {
 		})
 }
 
+// credentialsExpired checks if the request failed because the temporary credentials of the assumed role expired.
+func (c *EBSVolumeResizer) credentialsExpired(err error) bool {
+	if c.credentials == nil {
+		return false
+	}
+	if awsErr, ok := err.(awserr.Error); ok {
+		switch awsErr.Code() {
+		case "ExpiredToken", "ExpiredTokenException", "RequestExpired":
+			return true
+		}
+	}
+	return false
+}
+
+// volumeModificationInput fills in the type and the performance settings of the manifest that differ from the volume.
+func volumeModificationInput(vol *ec2.Volume, newVolume spec.Volume) *ec2.ModifyVolumeInput {
+	input := &ec2.ModifyVolumeInput{}
+	if newVolume.StorageType != "" && aws.StringValue(vol.VolumeType) != newVolume.StorageType {
+		input.VolumeType = aws.String(newVolume.StorageType)
+	}
+	if newVolume.Iops != nil && aws.Int64Value(vol.Iops) != *newVolume.Iops {
+		input.Iops = newVolume.Iops
+	}
+	if newVolume.Throughput != nil && aws.Int64Value(vol.Throughput) != *newVolume.Throughput {
+		input.Throughput = newVolume.Throughput
+	}
+	return input
+}
+
+// SnapshotVolume creates an EBS snapshot of the volume and returns the snapshot id.
+// The snapshot is taken at the time of the call, there is no need to wait for its completion before modifying the volume.
+func (c *EBSVolumeResizer) SnapshotVolume(volumeID string, description string) (string, error) {
+	snapshot, err := c.connection.CreateSnapshot(&ec2.CreateSnapshotInput{VolumeId: &volumeID, Description: &description})
+	if err != nil {
+		return "", fmt.Errorf("could not create snapshot of the volume %q: %v", volumeID, err)
+	}
+	if snapshot.SnapshotId == nil || *snapshot.SnapshotId == "" {
+		return "", fmt.Errorf("received empty snapshot id for the volume %q", volumeID)
+	}
+	if snapshot.State != nil && *snapshot.State == constants.EBSSnapshotStateError {
+		return "", fmt.Errorf("could not create snapshot of the volume %q: snapshot state error", volumeID)
+	}
+	return *snapshot.SnapshotId, nil
+}
+
+// DeleteSnapshot deletes the EBS snapshot with the given id.
+func (c *EBSVolumeResizer) DeleteSnapshot(snapshotID string) error {
+	if _, err := c.connection.DeleteSnapshot(&ec2.DeleteSnapshotInput{SnapshotId: &snapshotID}); err != nil {
+		return fmt.Errorf("could not delete snapshot %q: %v", snapshotID, err)
+	}
+	return nil
+}
+
 // DisconnectFromProvider closes connection to the EC2 instance
 func (c *EBSVolumeResizer) DisconnectFromProvider() error {
 	c.connection = nil
+	c.credentials = nil
 	return nil
 }
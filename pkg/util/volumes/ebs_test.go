@@ -0,0 +1,81 @@
+package volumes
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+)
+
+var volumeModificationTest = []struct {
+	volume     *ec2.Volume
+	manifest   spec.Volume
+	volumeType string
+	iops       int64
+	throughput int64
+}{
+	{&ec2.Volume{VolumeType: aws.String("gp2"), Iops: aws.Int64(100)}, spec.Volume{Size: "10Gi"}, "", 0, 0},
+	{&ec2.Volume{VolumeType: aws.String("gp2"), Iops: aws.Int64(100)}, spec.Volume{StorageType: "gp3"}, "gp3", 0, 0},
+	{&ec2.Volume{VolumeType: aws.String("gp3"), Iops: aws.Int64(3000), Throughput: aws.Int64(125)},
+		spec.Volume{StorageType: "gp3", Iops: aws.Int64(3000), Throughput: aws.Int64(250)}, "", 0, 250},
+	{&ec2.Volume{VolumeType: aws.String("io1"), Iops: aws.Int64(1000)},
+		spec.Volume{Iops: aws.Int64(2000)}, "", 2000, 0},
+}
+
+func TestVolumeModificationInput(t *testing.T) {
+	for _, tt := range volumeModificationTest {
+		input := volumeModificationInput(tt.volume, tt.manifest)
+		if aws.StringValue(input.VolumeType) != tt.volumeType || aws.Int64Value(input.Iops) != tt.iops ||
+			aws.Int64Value(input.Throughput) != tt.throughput {
+			t.Errorf("%s expected type %q, iops %d, throughput %d, got: %v", t.Name(), tt.volumeType, tt.iops, tt.throughput, input)
+		}
+	}
+}
+
+func TestMissingTags(t *testing.T) {
+	current := []*ec2.Tag{
+		{Key: aws.String("team"), Value: aws.String("acid")},
+		{Key: aws.String("cost-center"), Value: aws.String("1234")},
+		{Key: aws.String("kubernetes.io/created-for/pvc/name"), Value: aws.String("pgdata-acid-test-0")},
+	}
+	desired := map[string]string{"team": "acid", "cost-center": "5678", "acid.zalan.do/cluster": "acid-test"}
+
+	result := missingTags(current, desired)
+	if len(result) != 2 {
+		t.Fatalf("expected 2 tags, got %v", result)
+	}
+	if aws.StringValue(result[0].Key) != "acid.zalan.do/cluster" || aws.StringValue(result[0].Value) != "acid-test" {
+		t.Errorf("unexpected first tag %v", result[0])
+	}
+	if aws.StringValue(result[1].Key) != "cost-center" || aws.StringValue(result[1].Value) != "5678" {
+		t.Errorf("unexpected second tag %v", result[1])
+	}
+	if result := missingTags(current, map[string]string{"team": "acid"}); len(result) != 0 {
+		t.Errorf("expected no tags, got %v", result)
+	}
+}
+
+func TestCredentialsExpired(t *testing.T) {
+	withRole := &EBSVolumeResizer{credentials: credentials.NewStaticCredentials("id", "secret", "token")}
+	tests := []struct {
+		resizer  *EBSVolumeResizer
+		err      error
+		expected bool
+	}{
+		{withRole, awserr.New("RequestExpired", "request has expired", nil), true},
+		{withRole, awserr.New("ExpiredToken", "token has expired", nil), true},
+		{withRole, awserr.New("InvalidVolume.NotFound", "volume not found", nil), false},
+		{withRole, fmt.Errorf("connection reset"), false},
+		{&EBSVolumeResizer{}, awserr.New("RequestExpired", "request has expired", nil), false},
+	}
+	for _, tt := range tests {
+		if result := tt.resizer.credentialsExpired(tt.err); result != tt.expected {
+			t.Errorf("expected %t for %v, got %t", tt.expected, tt.err, result)
+		}
+	}
+}
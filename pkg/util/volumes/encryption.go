@@ -0,0 +1,30 @@
+package volumes
+
+import (
+	"strings"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+)
+
+// StorageClassEncryption tells if the volumes provisioned with the given storage class parameters are encrypted,
+// and with which key if it is set explicitly. GCE and Azure always encrypt disks at rest, EBS only on request.
+func StorageClassEncryption(provisioner string, parameters map[string]string) (encrypted bool, keyID string) {
+	switch provisioner {
+	case constants.EBSProvisioner, constants.EBSCSIProvisioner:
+		return parameters[constants.EBSEncryptedParameter] == "true", parameters[constants.EBSKMSKeyParameter]
+	case constants.GCEProvisioner, constants.GCECSIProvisioner:
+		return true, parameters[constants.GCEKMSKeyParameter]
+	case constants.AzureDiskProvisioner, constants.AzureDiskCSIProvisioner:
+		return true, parameters[constants.AzureDiskEncryptionSetParameter]
+	}
+	return false, ""
+}
+
+// KeyMatches checks if the actual encryption key of the volume is the expected one. Providers report the full
+// resource name of the key, i.e. an ARN, while the configuration may contain only the key id.
+func KeyMatches(expected, actual string) bool {
+	if expected == "" || expected == actual {
+		return true
+	}
+	return actual != "" && strings.HasSuffix(actual, "/"+expected)
+}
@@ -0,0 +1,48 @@
+package volumes
+
+import (
+	"testing"
+)
+
+var keyMatchesTest = []struct {
+	expected string
+	actual   string
+	match    bool
+}{
+	{"", "", true},
+	{"", "arn:aws:kms:eu-central-1:123:key/abcd", true},
+	{"abcd", "arn:aws:kms:eu-central-1:123:key/abcd", true},
+	{"arn:aws:kms:eu-central-1:123:key/abcd", "arn:aws:kms:eu-central-1:123:key/abcd", true},
+	{"abcd", "arn:aws:kms:eu-central-1:123:key/xabcd", false},
+	{"abcd", "", false},
+}
+
+func TestKeyMatches(t *testing.T) {
+	for _, tt := range keyMatchesTest {
+		if match := KeyMatches(tt.expected, tt.actual); match != tt.match {
+			t.Errorf("%s expected %t for %q and %q, got: %t", t.Name(), tt.match, tt.expected, tt.actual, match)
+		}
+	}
+}
+
+var storageClassEncryptionTest = []struct {
+	provisioner string
+	parameters  map[string]string
+	encrypted   bool
+	keyID       string
+}{
+	{"kubernetes.io/aws-ebs", map[string]string{"type": "gp2"}, false, ""},
+	{"kubernetes.io/aws-ebs", map[string]string{"encrypted": "true", "kmsKeyId": "abcd"}, true, "abcd"},
+	{"ebs.csi.aws.com", map[string]string{"encrypted": "true"}, true, ""},
+	{"kubernetes.io/gce-pd", nil, true, ""},
+	{"kubernetes.io/host-path", nil, false, ""},
+}
+
+func TestStorageClassEncryption(t *testing.T) {
+	for _, tt := range storageClassEncryptionTest {
+		encrypted, keyID := StorageClassEncryption(tt.provisioner, tt.parameters)
+		if encrypted != tt.encrypted || keyID != tt.keyID {
+			t.Errorf("%s expected: %t, %q, got: %t, %q", t.Name(), tt.encrypted, tt.keyID, encrypted, keyID)
+		}
+	}
+}
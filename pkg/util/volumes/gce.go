@@ -0,0 +1,187 @@
+package volumes
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/compute/metadata"
+	"golang.org/x/oauth2/google"
+	compute "google.golang.org/api/compute/v1"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/retryutil"
+)
+
+// GCEVolumeResizer implements volume resizing interface for GCE persistent disks.
+type GCEVolumeResizer struct {
+	connection *compute.Service
+	project    string
+}
+
+// ConnectToProvider connects to the GCE compute API using the default credentials of the node.
+func (c *GCEVolumeResizer) ConnectToProvider() error {
+	project, err := metadata.ProjectID()
+	if err != nil {
+		return fmt.Errorf("could not get GCE project id from the metadata server: %v", err)
+	}
+	client, err := google.DefaultClient(context.Background(), compute.ComputeScope)
+	if err != nil {
+		return fmt.Errorf("could not create GCE client: %v", err)
+	}
+	service, err := compute.New(client)
+	if err != nil {
+		return fmt.Errorf("could not establish GCE compute session: %v", err)
+	}
+	c.connection = service
+	c.project = project
+	return nil
+}
+
+// IsConnectedToProvider checks if GCE connection is established.
+func (c *GCEVolumeResizer) IsConnectedToProvider() bool {
+	return c.connection != nil
+}
+
+// VolumeBelongsToProvider checks if the given persistent volume is backed by GCE PD.
+func (c *GCEVolumeResizer) VolumeBelongsToProvider(pv *v1.PersistentVolume) bool {
+	return pv.Spec.GCEPersistentDisk != nil && pv.Annotations[constants.VolumeStorateProvisionerAnnotation] == constants.GCEProvisioner
+}
+
+// GetProviderVolumeID returns the zone and the disk name of the GCE PD in the form of europe-west1-b/gke-pvc-1234
+func (c *GCEVolumeResizer) GetProviderVolumeID(pv *v1.PersistentVolume) (string, error) {
+	diskName := pv.Spec.GCEPersistentDisk.PDName
+	if diskName == "" {
+		return "", fmt.Errorf("disk name is empty for volume %q", pv.Name)
+	}
+	zone := pv.Labels[constants.GCEZoneLabel]
+	if zone == "" {
+		return "", fmt.Errorf("could not determine zone of the volume %q: label %q is empty", pv.Name, constants.GCEZoneLabel)
+	}
+	return zone + constants.GCEVolumeIDZoneDiskSeparator + diskName, nil
+}
+
+// ResizeVolume actually calls GCE API to resize the persistent disk if necessary.
+func (c *GCEVolumeResizer) ResizeVolume(volumeID string, newSize int64) error {
+	zone, diskName, err := parseGCEVolumeID(volumeID)
+	if err != nil {
+		return err
+	}
+
+	/* first check if the volume is already of a requested size */
+	disk, err := c.connection.Disks.Get(c.project, zone, diskName).Do()
+	if err != nil {
+		return fmt.Errorf("could not get information about the disk: %v", err)
+	}
+	newSizeGB := gigabytesRoundedUp(newSize)
+	if disk.SizeGb == newSizeGB {
+		// nothing to do
+		return nil
+	}
+	if disk.SizeGb > newSizeGB {
+		return fmt.Errorf("could not shrink disk %q from %dGB to %dGB", diskName, disk.SizeGb, newSizeGB)
+	}
+	op, err := c.connection.Disks.Resize(c.project, zone, diskName, &compute.DisksResizeRequest{SizeGb: newSizeGB}).Do()
+	if err != nil {
+		return fmt.Errorf("could not resize persistent disk: %v", err)
+	}
+	return c.waitForOperation(zone, op)
+}
+
+// SnapshotVolume creates a snapshot of the persistent disk and returns the snapshot name.
+func (c *GCEVolumeResizer) SnapshotVolume(volumeID string, description string) (string, error) {
+	zone, diskName, err := parseGCEVolumeID(volumeID)
+	if err != nil {
+		return "", err
+	}
+	prefix := diskName
+	suffix := "-" + time.Now().UTC().Format("20060102150405")
+	if len(prefix)+len(suffix) > constants.GCEResourceNameMaxLength {
+		prefix = prefix[:constants.GCEResourceNameMaxLength-len(suffix)]
+	}
+	snapshotName := prefix + suffix
+	op, err := c.connection.Disks.CreateSnapshot(c.project, zone, diskName, &compute.Snapshot{
+		Name:        snapshotName,
+		Description: description,
+	}).Do()
+	if err != nil {
+		return "", fmt.Errorf("could not create snapshot of the persistent disk: %v", err)
+	}
+	if err := c.waitForOperation(zone, op); err != nil {
+		return "", err
+	}
+	return snapshotName, nil
+}
+
+// DeleteSnapshot deletes the snapshot with the given name; the deletion itself completes in the background.
+func (c *GCEVolumeResizer) DeleteSnapshot(snapshotID string) error {
+	op, err := c.connection.Snapshots.Delete(c.project, snapshotID).Do()
+	if err != nil {
+		return fmt.Errorf("could not delete snapshot %q: %v", snapshotID, err)
+	}
+	return operationError(op)
+}
+
+// VolumeEncryption returns the customer-managed key of the persistent disk, if any. GCE disks are always encrypted.
+func (c *GCEVolumeResizer) VolumeEncryption(volumeID string) (bool, string, error) {
+	zone, diskName, err := parseGCEVolumeID(volumeID)
+	if err != nil {
+		return false, "", err
+	}
+	disk, err := c.connection.Disks.Get(c.project, zone, diskName).Do()
+	if err != nil {
+		return false, "", fmt.Errorf("could not get information about the disk: %v", err)
+	}
+	// disks without a KMS key are encrypted with a Google-managed or a customer-supplied key, not a CMEK
+	if disk.DiskEncryptionKey == nil || disk.DiskEncryptionKey.KmsKeyName == "" {
+		return true, "", nil
+	}
+	// strip the key version, i.e. projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1
+	keyName := disk.DiskEncryptionKey.KmsKeyName
+	if idx := strings.Index(keyName, "/cryptoKeyVersions/"); idx > 0 {
+		keyName = keyName[:idx]
+	}
+	return true, keyName, nil
+}
+
+// DisconnectFromProvider closes connection to the GCE compute API
+func (c *GCEVolumeResizer) DisconnectFromProvider() error {
+	c.connection = nil
+	return nil
+}
+
+// waitForOperation waits until the zone operation is done
+func (c *GCEVolumeResizer) waitForOperation(zone string, op *compute.Operation) error {
+	if op.Status == constants.GCEOperationStatusDone {
+		return operationError(op)
+	}
+	return retryutil.Retry(constants.GCEVolumeResizeWaitInterval, constants.GCEVolumeResizeWaitTimeout,
+		func() (bool, error) {
+			out, err := c.connection.ZoneOperations.Get(c.project, zone, op.Name).Do()
+			if err != nil {
+				return false, fmt.Errorf("could not get status of the operation %q: %v", op.Name, err)
+			}
+			if out.Status != constants.GCEOperationStatusDone {
+				return false, nil
+			}
+			return true, operationError(out)
+		})
+}
+
+func operationError(op *compute.Operation) error {
+	if op.Error == nil || len(op.Error.Errors) == 0 {
+		return nil
+	}
+	return fmt.Errorf("operation %q failed: %s", op.Name, op.Error.Errors[0].Message)
+}
+
+// parseGCEVolumeID splits the volume id produced by GetProviderVolumeID into the zone and the disk name.
+func parseGCEVolumeID(volumeID string) (zone, diskName string, err error) {
+	parts := strings.SplitN(volumeID, constants.GCEVolumeIDZoneDiskSeparator, 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("malformed GCE volume id %q", volumeID)
+	}
+	return parts[0], parts[1], nil
+}
@@ -0,0 +1,160 @@
+package volumes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	compute "google.golang.org/api/compute/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
+)
+
+var gceVolumeIDTest = []struct {
+	in       string
+	zone     string
+	diskName string
+	err      bool
+}{
+	{"europe-west1-b/gke-pvc-1234", "europe-west1-b", "gke-pvc-1234", false},
+	{"europe-west1-b/", "", "", true},
+	{"/gke-pvc-1234", "", "", true},
+	{"gke-pvc-1234", "", "", true},
+}
+
+func TestParseGCEVolumeID(t *testing.T) {
+	for _, tt := range gceVolumeIDTest {
+		zone, diskName, err := parseGCEVolumeID(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("%s expected error: %t, got: %v", t.Name(), tt.err, err)
+			continue
+		}
+		if zone != tt.zone || diskName != tt.diskName {
+			t.Errorf("%s expected: %q, %q, got: %q, %q", t.Name(), tt.zone, tt.diskName, zone, diskName)
+		}
+	}
+}
+
+// fakeGCE serves the disk and the resize calls of the compute API for a single 10GB disk.
+type fakeGCE struct {
+	diskStatus    int
+	encryptionKey string
+	resizeError   string
+	resizedTo     int64
+	resizeRequest bool
+}
+
+func (f *fakeGCE) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/acid/zones/europe-west1-b/disks/pgdata":
+		if f.diskStatus != http.StatusOK {
+			w.WriteHeader(f.diskStatus)
+			fmt.Fprint(w, `{"error": {"code": 404, "message": "disk not found"}}`)
+			return
+		}
+		if f.encryptionKey != "" {
+			fmt.Fprintf(w, `{"name": "pgdata", "sizeGb": "10", "diskEncryptionKey": %s}`, f.encryptionKey)
+			return
+		}
+		fmt.Fprint(w, `{"name": "pgdata", "sizeGb": "10"}`)
+	case r.Method == http.MethodPost && r.URL.Path == "/acid/zones/europe-west1-b/disks/pgdata/resize":
+		f.resizeRequest = true
+		var request compute.DisksResizeRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.resizedTo = request.SizeGb
+		operation := &compute.Operation{Name: "resize-pgdata", Status: constants.GCEOperationStatusDone}
+		if f.resizeError != "" {
+			operation.Error = &compute.OperationError{Errors: []*compute.OperationErrorErrors{{Message: f.resizeError}}}
+		}
+		json.NewEncoder(w).Encode(operation)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestGCEResizeVolume(t *testing.T) {
+	tests := []struct {
+		name        string
+		volumeID    string
+		newSize     int64
+		diskStatus  int
+		resizeError string
+		resizedTo   int64
+		err         string
+	}{
+		{"same size", "europe-west1-b/pgdata", 10 * constants.Gigabyte, http.StatusOK, "", 0, ""},
+		{"grow", "europe-west1-b/pgdata", 20 * constants.Gigabyte, http.StatusOK, "", 20, ""},
+		{"grow rounded up", "europe-west1-b/pgdata", 15*constants.Gigabyte + 1, http.StatusOK, "", 16, ""},
+		{"shrink", "europe-west1-b/pgdata", 5 * constants.Gigabyte, http.StatusOK, "", 0, "could not shrink"},
+		{"missing disk", "europe-west1-b/pgdata", 20 * constants.Gigabyte, http.StatusNotFound, "", 0,
+			"could not get information about the disk"},
+		{"failed operation", "europe-west1-b/pgdata", 20 * constants.Gigabyte, http.StatusOK, "quota exceeded", 20,
+			"quota exceeded"},
+		{"malformed id", "pgdata", 20 * constants.Gigabyte, http.StatusOK, "", 0, "malformed GCE volume id"},
+	}
+	for _, tt := range tests {
+		fake := &fakeGCE{diskStatus: tt.diskStatus, resizeError: tt.resizeError}
+		server := httptest.NewServer(fake)
+		service, err := compute.New(&http.Client{})
+		if err != nil {
+			t.Fatalf("could not create the compute service: %v", err)
+		}
+		service.BasePath = server.URL + "/"
+		resizer := &GCEVolumeResizer{connection: service, project: "acid"}
+
+		err = resizer.ResizeVolume(tt.volumeID, tt.newSize)
+		server.Close()
+		if tt.err == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		} else if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: expected an error containing %q, got: %v", tt.name, tt.err, err)
+		}
+		if fake.resizedTo != tt.resizedTo || fake.resizeRequest != (tt.resizedTo > 0) {
+			t.Errorf("%s: expected a resize to %dGB, got: %dGB", tt.name, tt.resizedTo, fake.resizedTo)
+		}
+	}
+}
+
+func TestGCEVolumeEncryption(t *testing.T) {
+	tests := []struct {
+		name          string
+		encryptionKey string
+		keyID         string
+	}{
+		{"google-managed key", "", ""},
+		{"customer-supplied key", `{"sha256": "abcd"}`, ""},
+		{"empty kms key", `{"kmsKeyName": ""}`, ""},
+		{"kms key", `{"kmsKeyName": "projects/p/locations/l/keyRings/r/cryptoKeys/k"}`,
+			"projects/p/locations/l/keyRings/r/cryptoKeys/k"},
+		{"kms key version", `{"kmsKeyName": "projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1"}`,
+			"projects/p/locations/l/keyRings/r/cryptoKeys/k"},
+	}
+	for _, tt := range tests {
+		server := httptest.NewServer(&fakeGCE{diskStatus: http.StatusOK, encryptionKey: tt.encryptionKey})
+		service, err := compute.New(&http.Client{})
+		if err != nil {
+			t.Fatalf("could not create the compute service: %v", err)
+		}
+		service.BasePath = server.URL + "/"
+		resizer := &GCEVolumeResizer{connection: service, project: "acid"}
+
+		encrypted, keyID, err := resizer.VolumeEncryption("europe-west1-b/pgdata")
+		server.Close()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if !encrypted || keyID != tt.keyID {
+			t.Errorf("%s: expected encrypted with %q, got: %t, %q", tt.name, tt.keyID, encrypted, keyID)
+		}
+		if tt.keyID == "" && KeyMatches("projects/p/locations/l/keyRings/r/cryptoKeys/k", keyID) {
+			t.Errorf("%s: disk without a KMS key passed the check of the required key", tt.name)
+		}
+	}
+}
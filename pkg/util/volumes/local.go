@@ -0,0 +1,51 @@
+package volumes
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// LocalVolumeResizer implements volume resizing interface for the local and hostPath persistent volumes, i.e. the ones
+// created by the local-path provisioner on bare-metal clusters. The capacity of such volumes is managed outside of
+// Kubernetes and their filesystem might be the one of the node, so they are recognized only to refuse resizing them.
+type LocalVolumeResizer struct{}
+
+// ConnectToProvider does nothing, there is no provider API for local volumes.
+func (c *LocalVolumeResizer) ConnectToProvider() error {
+	return nil
+}
+
+// IsConnectedToProvider always returns true, since no connection is required.
+func (c *LocalVolumeResizer) IsConnectedToProvider() bool {
+	return true
+}
+
+// VolumeBelongsToProvider checks if the given persistent volume is a local or a hostPath one.
+func (c *LocalVolumeResizer) VolumeBelongsToProvider(pv *v1.PersistentVolume) bool {
+	return pv.Spec.Local != nil || pv.Spec.HostPath != nil
+}
+
+// GetProviderVolumeID returns the path of the volume on the node.
+func (c *LocalVolumeResizer) GetProviderVolumeID(pv *v1.PersistentVolume) (string, error) {
+	var path string
+	if pv.Spec.Local != nil {
+		path = pv.Spec.Local.Path
+	} else if pv.Spec.HostPath != nil {
+		path = pv.Spec.HostPath.Path
+	}
+	if path == "" {
+		return "", fmt.Errorf("path is empty for volume %q", pv.Name)
+	}
+	return path, nil
+}
+
+// ResizeVolume always fails, the device behind the local volume can only be extended by the node administrator.
+func (c *LocalVolumeResizer) ResizeVolume(volumeID string, newSize int64) error {
+	return fmt.Errorf("could not resize volume %q: resizing local and hostPath volumes is not supported", volumeID)
+}
+
+// DisconnectFromProvider does nothing.
+func (c *LocalVolumeResizer) DisconnectFromProvider() error {
+	return nil
+}
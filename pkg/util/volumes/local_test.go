@@ -0,0 +1,38 @@
+package volumes
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+func TestLocalVolumeResizer(t *testing.T) {
+	tests := []struct {
+		name   string
+		source v1.PersistentVolumeSource
+		owned  bool
+	}{
+		{"local", v1.PersistentVolumeSource{Local: &v1.LocalVolumeSource{Path: "/mnt/disks/pgdata"}}, true},
+		{"hostPath", v1.PersistentVolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/var/lib/pgdata"}}, true},
+		{"ebs", v1.PersistentVolumeSource{AWSElasticBlockStore: &v1.AWSElasticBlockStoreVolumeSource{VolumeID: "vol-1"}}, false},
+	}
+	resizer := &LocalVolumeResizer{}
+	for _, tt := range tests {
+		pv := &v1.PersistentVolume{Spec: v1.PersistentVolumeSpec{PersistentVolumeSource: tt.source}}
+		if owned := resizer.VolumeBelongsToProvider(pv); owned != tt.owned {
+			t.Errorf("%s: expected the volume to belong to the provider: %t, got: %t", tt.name, tt.owned, owned)
+		}
+		if !tt.owned {
+			continue
+		}
+		volumeID, err := resizer.GetProviderVolumeID(pv)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if err := resizer.ResizeVolume(volumeID, 20); err == nil || !strings.Contains(err.Error(), "not supported") {
+			t.Errorf("%s: expected resizing to be refused, got: %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package volumes
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/util/config"
+)
+
+// ResizerOptions holds what the resizer factories need to construct a resizer for a cluster.
+type ResizerOptions struct {
+	SecretsGetter v1core.SecretsGetter
+	Config        *config.Config
+}
+
+// ResizerFactory creates a new instance of the resizer; instances are not shared between the clusters.
+type ResizerFactory func(options ResizerOptions) VolumeResizer
+
+var (
+	resizerFactoriesMu sync.RWMutex
+	resizerFactories   = make(map[string]ResizerFactory)
+)
+
+// RegisterResizer makes the resizer available under the given name for the volume_resizers option. Packages
+// providing additional resizers call it from their init function; registering the same name twice panics.
+func RegisterResizer(name string, factory ResizerFactory) {
+	resizerFactoriesMu.Lock()
+	defer resizerFactoriesMu.Unlock()
+
+	if factory == nil {
+		panic("volumes: resizer factory is nil")
+	}
+	if _, ok := resizerFactories[name]; ok {
+		panic(fmt.Sprintf("volumes: resizer %q is already registered", name))
+	}
+	resizerFactories[name] = factory
+}
+
+// RegisteredResizers returns the sorted names of all registered resizers.
+func RegisteredResizers() []string {
+	resizerFactoriesMu.RLock()
+	defer resizerFactoriesMu.RUnlock()
+
+	names := make([]string, 0, len(resizerFactories))
+	for name := range resizerFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// NewResizers creates the resizers with the given names, in the same order.
+func NewResizers(names []string, options ResizerOptions) ([]VolumeResizer, error) {
+	resizerFactoriesMu.RLock()
+	defer resizerFactoriesMu.RUnlock()
+
+	result := make([]VolumeResizer, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		factory, ok := resizerFactories[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown volume resizer %q", name)
+		}
+		result = append(result, factory(options))
+	}
+
+	return result, nil
+}
+
+func init() {
+	RegisterResizer("ebs", func(options ResizerOptions) VolumeResizer {
+		return &EBSVolumeResizer{
+			RoleARN:              options.Config.AWSRoleARN,
+			WebIdentityTokenFile: options.Config.AWSWebIdentityTokenFile,
+		}
+	})
+	RegisterResizer("gce", func(options ResizerOptions) VolumeResizer {
+		return &GCEVolumeResizer{}
+	})
+	RegisterResizer("azure", func(options ResizerOptions) VolumeResizer {
+		return &AzureVolumeResizer{
+			SecretsGetter:         options.SecretsGetter,
+			CredentialsSecretName: options.Config.AzureCredentialsSecretName,
+		}
+	})
+	RegisterResizer("ceph-rbd", func(options ResizerOptions) VolumeResizer {
+		return &CephRBDVolumeResizer{
+			SecretsGetter:         options.SecretsGetter,
+			CredentialsSecretName: options.Config.CephCredentialsSecretName,
+			APIURL:                options.Config.CephAPIURL,
+		}
+	})
+	RegisterResizer("local", func(options ResizerOptions) VolumeResizer {
+		return &LocalVolumeResizer{}
+	})
+}
@@ -0,0 +1,33 @@
+package volumes
+
+import (
+	"testing"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/util/config"
+)
+
+func TestNewResizers(t *testing.T) {
+	options := ResizerOptions{Config: &config.Config{CephAPIURL: "https://ceph.example.com"}}
+
+	resizers, err := NewResizers([]string{"ceph-rbd", " ebs"}, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resizers) != 2 {
+		t.Fatalf("expected 2 resizers, got %d", len(resizers))
+	}
+	ceph, ok := resizers[0].(*CephRBDVolumeResizer)
+	if !ok {
+		t.Fatalf("expected the Ceph RBD resizer first, got %T", resizers[0])
+	}
+	if ceph.APIURL != options.Config.CephAPIURL {
+		t.Errorf("expected API URL %q, got %q", options.Config.CephAPIURL, ceph.APIURL)
+	}
+	if _, ok := resizers[1].(*EBSVolumeResizer); !ok {
+		t.Errorf("expected the EBS resizer second, got %T", resizers[1])
+	}
+
+	if _, err := NewResizers([]string{"nfs"}, options); err == nil {
+		t.Errorf("expected an error for the unknown resizer")
+	}
+}
@@ -2,9 +2,13 @@ package volumes
 
 import (
 	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/postgres-operator/pkg/spec"
+	"github.com/zalando-incubator/postgres-operator/pkg/util/constants"
 )
 
 // VolumeResizer defines the set of methods used to implememnt provider-specific resizing of persistent volumes.
+// Sizes are passed in bytes; providers that only allocate whole gigabytes round them up.
 type VolumeResizer interface {
 	ConnectToProvider() error
 	IsConnectedToProvider() bool
@@ -13,3 +17,38 @@ type VolumeResizer interface {
 	ResizeVolume(providerVolumeID string, newSize int64) error
 	DisconnectFromProvider() error
 }
+
+// VolumeSnapshotter is implemented by the resizers able to snapshot the provider volume, i.e. before resizing it.
+type VolumeSnapshotter interface {
+	SnapshotVolume(providerVolumeID string, description string) (snapshotID string, err error)
+	DeleteSnapshot(snapshotID string) error
+}
+
+// VolumeModifier is implemented by the resizers able to change the type and the performance of the provider volume.
+type VolumeModifier interface {
+	VolumeNeedsModification(providerVolumeID string, newVolume spec.Volume) (bool, error)
+	ModifyVolume(providerVolumeID string, newSize int64, newVolume spec.Volume) error
+}
+
+// VolumeTagger is implemented by the resizers able to tag the provider volume. Tags missing on the volume or having
+// a different value are set, other tags of the volume are kept.
+type VolumeTagger interface {
+	TagVolume(providerVolumeID string, tags map[string]string) error
+}
+
+// VolumeResizabilityChecker is implemented by the resizers that can't resize every volume of the provider right now,
+// i.e. the managed disks attached to a virtual machine, so that the volumes are left to the persistent volume claims.
+type VolumeResizabilityChecker interface {
+	VolumeResizable(providerVolumeID string) (bool, error)
+}
+
+// VolumeEncryptionChecker is implemented by the resizers able to tell if the provider volume is encrypted and with which key.
+type VolumeEncryptionChecker interface {
+	VolumeEncryption(providerVolumeID string) (encrypted bool, keyID string, err error)
+}
+
+// gigabytesRoundedUp converts the size in bytes to whole gigabytes, rounding up, for the providers that can't
+// allocate fractions of a gigabyte.
+func gigabytesRoundedUp(size int64) int64 {
+	return (size + constants.Gigabyte - 1) / constants.Gigabyte
+}
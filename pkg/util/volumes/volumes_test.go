@@ -0,0 +1,24 @@
+package volumes
+
+import (
+	"testing"
+)
+
+func TestGigabytesRoundedUp(t *testing.T) {
+	tests := []struct {
+		size     int64
+		expected int64
+	}{
+		{0, 0},
+		{1, 1},
+		{512 * 1024 * 1024, 1},
+		{1024 * 1024 * 1024, 1},
+		{1536 * 1024 * 1024, 2},
+		{10 * 1024 * 1024 * 1024, 10},
+	}
+	for _, tt := range tests {
+		if result := gigabytesRoundedUp(tt.size); result != tt.expected {
+			t.Errorf("expected %d gigabytes for %d bytes, got %d", tt.expected, tt.size, result)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package walarchive
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// WAL-E and WAL-G share the layout of the archive under the prefix of the cluster
+const (
+	baseBackupsDirectory = "basebackups_005/"
+	walDirectory         = "wal_005/"
+	backupSentinelSuffix = "_backup_stop_sentinel.json"
+)
+
+// Range is the time span a cluster can be recovered to from its archive: from the end of the oldest complete base
+// backup until the last archived WAL segment.
+type Range struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Contains checks if the cluster can be recovered to the given time.
+func (r *Range) Contains(t time.Time) bool {
+	return !t.Before(r.Start) && !t.After(r.End)
+}
+
+// S3Archive reads the WAL archives of the clusters in S3.
+type S3Archive struct {
+	connection s3iface.S3API
+}
+
+// NewS3Archive connects to S3 in the region, or to the S3-compatible storage at the endpoint if set.
+func NewS3Archive(region, endpoint string, forcePathStyle bool) (*S3Archive, error) {
+	config := &aws.Config{Region: aws.String(region), S3ForcePathStyle: aws.Bool(forcePathStyle)}
+	if endpoint != "" {
+		config.Endpoint = aws.String(endpoint)
+	}
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return nil, fmt.Errorf("could not establish AWS session: %v", err)
+	}
+	return &S3Archive{connection: s3.New(sess)}, nil
+}
+
+// Range returns the recovery range of the archive at the prefix, i.e. s3://bucket/spilo/cluster/wal.
+func (a *S3Archive) Range(prefix string) (*Range, error) {
+	bucket, key, err := parseS3Prefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var result Range
+	err = a.listObjects(bucket, key+baseBackupsDirectory, func(object *s3.Object) {
+		// the sentinel is uploaded once the backup is complete
+		if !strings.HasSuffix(aws.StringValue(object.Key), backupSentinelSuffix) {
+			return
+		}
+		if modified := aws.TimeValue(object.LastModified); result.Start.IsZero() || modified.Before(result.Start) {
+			result.Start = modified
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Start.IsZero() {
+		return nil, fmt.Errorf("no base backups in %q", prefix)
+	}
+
+	err = a.listObjects(bucket, key+walDirectory, func(object *s3.Object) {
+		if modified := aws.TimeValue(object.LastModified); modified.After(result.End) {
+			result.End = modified
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the WAL of the oldest backup might not be archived yet
+	if result.End.Before(result.Start) {
+		result.End = result.Start
+	}
+
+	return &result, nil
+}
+
+func (a *S3Archive) listObjects(bucket, prefix string, fn func(*s3.Object)) error {
+	err := a.connection.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			fn(object)
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("could not list s3://%s/%s: %v", bucket, prefix, err)
+	}
+	return nil
+}
+
+// parseS3Prefix splits s3://bucket/path into the bucket and the key prefix of the objects, ending with a slash.
+func parseS3Prefix(prefix string) (bucket, key string, err error) {
+	if !strings.HasPrefix(prefix, "s3://") {
+		return "", "", fmt.Errorf("%q is not an S3 path", prefix)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(prefix, "s3://"), "/", 2)
+	if parts[0] == "" {
+		return "", "", fmt.Errorf("no bucket in %q", prefix)
+	}
+	bucket = parts[0]
+	if len(parts) == 2 {
+		key = strings.Trim(parts[1], "/")
+	}
+	if key != "" {
+		key += "/"
+	}
+	return bucket, key, nil
+}
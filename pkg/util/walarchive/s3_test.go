@@ -0,0 +1,60 @@
+package walarchive
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+type mockS3 struct {
+	s3iface.S3API
+	objects map[string]time.Time
+}
+
+func (m *mockS3) ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error {
+	page := &s3.ListObjectsV2Output{}
+	for key, modified := range m.objects {
+		if strings.HasPrefix(key, aws.StringValue(input.Bucket)+"/"+aws.StringValue(input.Prefix)) {
+			page.Contents = append(page.Contents, &s3.Object{Key: aws.String(key), LastModified: aws.Time(modified)})
+		}
+	}
+	fn(page, true)
+	return nil
+}
+
+func TestS3ArchiveRange(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2017, 12, d, 0, 0, 0, 0, time.UTC) }
+	archive := &S3Archive{connection: &mockS3{objects: map[string]time.Time{
+		"backups/spilo/acid-test/wal/basebackups_005/base_000000010000000000000002_00000040_backup_stop_sentinel.json":     day(2),
+		"backups/spilo/acid-test/wal/basebackups_005/base_000000010000000000000002_00000040/tar_partitions/part_1.tar.lzo": day(1),
+		"backups/spilo/acid-test/wal/basebackups_005/base_000000010000000000000009_00000040_backup_stop_sentinel.json":     day(5),
+		"backups/spilo/acid-test/wal/wal_005/000000010000000000000001.lzo":                                                 day(1),
+		"backups/spilo/acid-test/wal/wal_005/00000001000000000000000A.lzo":                                                 day(7),
+		"backups/spilo/acid-other/wal/wal_005/00000001000000000000000B.lzo":                                                day(9),
+		"backups/spilo/acid-empty/wal/wal_005/00000001000000000000000B.lzo":                                                day(9),
+	}}}
+
+	r, err := archive.Range("s3://backups/spilo/acid-test/wal/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !r.Start.Equal(day(2)) || !r.End.Equal(day(7)) {
+		t.Errorf("expected the range from %v to %v, got: %v to %v", day(2), day(7), r.Start, r.End)
+	}
+	for d, expected := range map[int]bool{1: false, 2: true, 6: true, 8: false} {
+		if r.Contains(day(d)) != expected {
+			t.Errorf("expected the range to contain %v: %t", day(d), expected)
+		}
+	}
+
+	if _, err := archive.Range("s3://backups/spilo/acid-empty/wal"); err == nil {
+		t.Errorf("expected an error for an archive without base backups")
+	}
+	if _, err := archive.Range("backups/spilo/acid-test/wal"); err == nil {
+		t.Errorf("expected an error for a path without the s3 scheme")
+	}
+}